@@ -0,0 +1,60 @@
+// Copyright 2017 Baliance. All rights reserved.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/unidoc/unioffice/measurement"
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+func main() {
+	start := time.Now()
+	f, err := os.Create("lots-of-rows-stream.xlsx")
+	if err != nil {
+		log.Fatalf("error creating file: %s", err)
+	}
+	defer f.Close()
+
+	sw := spreadsheet.NewStreamWriter(f)
+	sheet, err := sw.AddSheet()
+	if err != nil {
+		log.Fatalf("error adding sheet: %s", err)
+	}
+
+	// column widths and frozen panes must be set before adding rows
+	col, err := sheet.Column(1)
+	if err != nil {
+		log.Fatalf("error getting column: %s", err)
+	}
+	col.SetWidth(1.5 * measurement.Inch)
+	if err := sheet.SetFrozen(true, false); err != nil {
+		log.Fatalf("error freezing the first row: %s", err)
+	}
+
+	nRows := 1000000
+	nCols := 10
+	hdr, _ := sheet.AddRow()
+	for c := 0; c < nCols; c++ {
+		hdr.AddCell().SetString(fmt.Sprintf("Column %d", c+1))
+	}
+
+	// each row is written to the file as the next row is added
+	for r := 0; r < nRows; r++ {
+		row, err := sheet.AddRow()
+		if err != nil {
+			log.Fatalf("error adding row: %s", err)
+		}
+		for c := 0; c < nCols; c++ {
+			row.AddCell().SetNumber(float64(r + c))
+		}
+	}
+
+	if err := sw.Close(); err != nil {
+		log.Fatalf("error writing workbook: %s", err)
+	}
+	fmt.Printf("writing %d rows * %d cells took %s\n", nRows, nCols, time.Now().Sub(start))
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package cfb
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Signature is the signature that every compound file starts with.
+var Signature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// special sector numbers
+const (
+	maxRegSect = 0xFFFFFFFA
+	difSect    = 0xFFFFFFFC
+	fatSect    = 0xFFFFFFFD
+	endOfChain = 0xFFFFFFFE
+	freeSect   = 0xFFFFFFFF
+	noStream   = 0xFFFFFFFF
+)
+
+// directory entry object types
+const (
+	typeUnknown = 0
+	typeStorage = 1
+	typeStream  = 2
+	typeRoot    = 5
+)
+
+const (
+	headerSize       = 512
+	dirEntrySize     = 128
+	miniStreamCutoff = 4096
+	maxNameLength    = 31
+)
+
+// File is a compound file, which is held in memory as the contents of its
+// streams.
+type File struct {
+	streams map[string][]byte
+}
+
+// New constructs a new empty compound file.
+func New() *File {
+	return &File{streams: map[string][]byte{}}
+}
+
+// IsCompoundFile returns true if r starts with the compound file signature.
+// Encrypted OOXML packages are compound files while unencrypted ones are zip
+// files.
+func IsCompoundFile(r io.ReaderAt) bool {
+	buf := make([]byte, len(Signature))
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, Signature)
+}
+
+// Streams returns the paths of the streams in the file in sorted order.
+func (f *File) Streams() []string {
+	ret := make([]string, 0, len(f.streams))
+	for p := range f.streams {
+		ret = append(ret, p)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Stream returns the contents of the stream with a path, or false if the file
+// doesn't contain it.  Storage and stream names are compared without regard
+// to case.
+func (f *File) Stream(path string) ([]byte, bool) {
+	if d, ok := f.streams[path]; ok {
+		return d, true
+	}
+	for p, d := range f.streams {
+		if strings.EqualFold(p, path) {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// SetStream sets the contents of the stream with a path, adding the stream and
+// any storages in its path if they don't exist.
+func (f *File) SetStream(path string, data []byte) {
+	f.streams[path] = data
+}
+
+// RemoveStream removes the stream with a path.
+func (f *File) RemoveStream(path string) {
+	delete(f.streams, path)
+}
+
+// compareNames compares two directory entry names in the order required for
+// the red-black trees of a directory, which is by length and then by the upper
+// case name.
+func compareNames(a, b string) int {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	if len(ua) != len(ub) {
+		if len(ua) < len(ub) {
+			return -1
+		}
+		return 1
+	}
+	for i := range ua {
+		ca := uint16(unicode.ToUpper(rune(ua[i])))
+		cb := uint16(unicode.ToUpper(rune(ub[i])))
+		if ca != cb {
+			if ca < cb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
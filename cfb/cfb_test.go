@@ -0,0 +1,122 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package cfb_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/unidoc/unioffice/cfb"
+)
+
+func fill(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i) ^ seed
+	}
+	return b
+}
+
+func roundTrip(t *testing.T, f *cfb.File) *cfb.File {
+	buf := bytes.Buffer{}
+	if err := f.Write(&buf); err != nil {
+		t.Fatalf("error writing: %s", err)
+	}
+	if buf.Len()%512 != 0 {
+		t.Errorf("expected a whole number of sectors, got %d bytes", buf.Len())
+	}
+	r := bytes.NewReader(buf.Bytes())
+	if !cfb.IsCompoundFile(r) {
+		t.Errorf("expected a compound file signature")
+	}
+	f2, err := cfb.Read(r, int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading: %s", err)
+	}
+	return f2
+}
+
+func TestRoundTrip(t *testing.T) {
+	f := cfb.New()
+	exp := map[string][]byte{
+		"EncryptionInfo":              fill(100, 1),
+		"EncryptedPackage":            fill(10000, 2),
+		"Exact":                       fill(4096, 3),
+		"Small":                       fill(4095, 4),
+		"Empty":                       {},
+		"\x06DataSpaces/Version":      fill(76, 5),
+		"\x06DataSpaces/DataSpaceMap": fill(112, 6),
+		"\x06DataSpaces/TransformInfo/StrongEncryptionTransform/\x06Primary": fill(200, 7),
+	}
+	for i := 0; i < 20; i++ {
+		exp[fmt.Sprintf("Many/Stream%d", i)] = fill(i*30, byte(i))
+	}
+	for p, d := range exp {
+		f.SetStream(p, d)
+	}
+
+	f2 := roundTrip(t, f)
+	if !reflect.DeepEqual(f.Streams(), f2.Streams()) {
+		t.Fatalf("expected streams %v, got %v", f.Streams(), f2.Streams())
+	}
+	for p, d := range exp {
+		got, ok := f2.Stream(p)
+		if !ok {
+			t.Errorf("expected stream %q", p)
+			continue
+		}
+		if !bytes.Equal(got, d) {
+			t.Errorf("stream %q differs after reading", p)
+		}
+	}
+	if _, ok := f2.Stream("encryptioninfo"); !ok {
+		t.Errorf("expected stream names to be case insensitive")
+	}
+	if _, ok := f2.Stream("Missing"); ok {
+		t.Errorf("expected no stream for a missing path")
+	}
+}
+
+func TestRoundTripLarge(t *testing.T) {
+	// large enough to need more FAT sectors than fit in the header
+	f := cfb.New()
+	data := fill(8<<20, 9)
+	f.SetStream("Large", data)
+	f2 := roundTrip(t, f)
+	if got, _ := f2.Stream("Large"); !bytes.Equal(got, data) {
+		t.Errorf("large stream differs after reading")
+	}
+}
+
+func TestWriteInvalidPath(t *testing.T) {
+	f := cfb.New()
+	f.SetStream("ThisNameIsLongerThanThirtyOneCharacters", nil)
+	if err := f.Write(&bytes.Buffer{}); err == nil {
+		t.Errorf("expected an error for a long stream name")
+	}
+	f = cfb.New()
+	f.SetStream("a", nil)
+	f.SetStream("a/b", nil)
+	if err := f.Write(&bytes.Buffer{}); err == nil {
+		t.Errorf("expected an error for a stream used as a storage")
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	data := []byte("PK\x03\x04 this is not a compound file")
+	data = append(data, make([]byte, 1024)...)
+	r := bytes.NewReader(data)
+	if cfb.IsCompoundFile(r) {
+		t.Errorf("expected a zip file not to be a compound file")
+	}
+	if _, err := cfb.Read(r, int64(len(data))); err == nil {
+		t.Errorf("expected an error reading a zip file")
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+// Package cfb reads and writes compound file binary files (MS-CFB), the OLE
+// container format that encrypted OOXML packages are stored in.
+//
+// A compound file is a small file system of storages (directories) and
+// streams (files).  Streams are addressed by their path, with storage names
+// separated by '/', e.g. "\x06DataSpaces/Version".
+package cfb
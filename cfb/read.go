@@ -0,0 +1,235 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package cfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// dirEntry is a parsed directory entry.
+type dirEntry struct {
+	name               string
+	typ                byte
+	left, right, child uint32
+	start              uint32
+	size               uint64
+}
+
+type reader struct {
+	r          io.ReaderAt
+	size       int64
+	sectorSize int
+	major      uint16
+	fat        []uint32
+}
+
+// Read reads a compound file, loading the contents of all of its streams.
+func Read(r io.ReaderAt, size int64) (*File, error) {
+	hdr := make([]byte, headerSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, fmt.Errorf("reading header: %s", err)
+	}
+	if !bytes.Equal(hdr[0:8], Signature) {
+		return nil, errors.New("not a compound file")
+	}
+	le := binary.LittleEndian
+	rd := &reader{r: r, size: size, major: le.Uint16(hdr[26:])}
+	if le.Uint16(hdr[28:]) != 0xFFFE {
+		return nil, errors.New("unsupported byte order")
+	}
+	shift := le.Uint16(hdr[30:])
+	if shift != 9 && shift != 12 {
+		return nil, fmt.Errorf("unsupported sector shift %d", shift)
+	}
+	rd.sectorSize = 1 << shift
+	miniShift := le.Uint16(hdr[32:])
+	if miniShift != 6 {
+		return nil, fmt.Errorf("unsupported mini sector shift %d", miniShift)
+	}
+	numFAT := le.Uint32(hdr[44:])
+	firstDir := le.Uint32(hdr[48:])
+	cutoff := le.Uint32(hdr[56:])
+	firstMiniFAT := le.Uint32(hdr[60:])
+	firstDIFAT := le.Uint32(hdr[68:])
+	numDIFAT := le.Uint32(hdr[72:])
+
+	// the locations of the FAT sectors are in the header and the DIFAT sectors
+	fatSectors := []uint32{}
+	for i := 0; i < 109; i++ {
+		fatSectors = append(fatSectors, le.Uint32(hdr[76+4*i:]))
+	}
+	next := firstDIFAT
+	for i := uint32(0); i < numDIFAT && next <= maxRegSect; i++ {
+		sec, err := rd.sector(next)
+		if err != nil {
+			return nil, err
+		}
+		n := rd.sectorSize/4 - 1
+		for j := 0; j < n; j++ {
+			fatSectors = append(fatSectors, le.Uint32(sec[4*j:]))
+		}
+		next = le.Uint32(sec[4*n:])
+	}
+	if uint32(len(fatSectors)) < numFAT {
+		return nil, errors.New("truncated DIFAT")
+	}
+	for _, s := range fatSectors[:numFAT] {
+		sec, err := rd.sector(s)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < rd.sectorSize; j += 4 {
+			rd.fat = append(rd.fat, le.Uint32(sec[j:]))
+		}
+	}
+
+	dir, err := readChain(firstDir, rd.fat, rd.sectorSize, rd.sector)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory: %s", err)
+	}
+	entries := []dirEntry{}
+	for i := 0; i+dirEntrySize <= len(dir); i += dirEntrySize {
+		entries = append(entries, parseDirEntry(dir[i:i+dirEntrySize], rd.major))
+	}
+	if len(entries) == 0 || entries[0].typ != typeRoot {
+		return nil, errors.New("missing root directory entry")
+	}
+
+	// small streams are stored in the mini stream, which is the stream of the
+	// root entry
+	miniFAT := []uint32{}
+	if firstMiniFAT <= maxRegSect {
+		mf, err := readChain(firstMiniFAT, rd.fat, rd.sectorSize, rd.sector)
+		if err != nil {
+			return nil, fmt.Errorf("reading mini FAT: %s", err)
+		}
+		for j := 0; j+4 <= len(mf); j += 4 {
+			miniFAT = append(miniFAT, le.Uint32(mf[j:]))
+		}
+	}
+	miniStream := []byte{}
+	if entries[0].start <= maxRegSect {
+		if miniStream, err = readChain(entries[0].start, rd.fat, rd.sectorSize, rd.sector); err != nil {
+			return nil, fmt.Errorf("reading mini stream: %s", err)
+		}
+	}
+	miniSector := func(n uint32) ([]byte, error) {
+		off := int(n) * 64
+		if off+64 > len(miniStream) {
+			return nil, fmt.Errorf("mini sector %d out of range", n)
+		}
+		return miniStream[off : off+64], nil
+	}
+
+	f := New()
+	visited := map[uint32]bool{}
+	var walk func(idx uint32, prefix string) error
+	walk = func(idx uint32, prefix string) error {
+		if idx == noStream {
+			return nil
+		}
+		if int(idx) >= len(entries) || visited[idx] {
+			return errors.New("invalid directory tree")
+		}
+		visited[idx] = true
+		e := entries[idx]
+		if err := walk(e.left, prefix); err != nil {
+			return err
+		}
+		switch e.typ {
+		case typeStorage:
+			if err := walk(e.child, prefix+e.name+"/"); err != nil {
+				return err
+			}
+		case typeStream:
+			var data []byte
+			var err error
+			switch {
+			case e.size == 0:
+				data = []byte{}
+			case e.size < uint64(cutoff):
+				data, err = readChain(e.start, miniFAT, 64, miniSector)
+			default:
+				data, err = readChain(e.start, rd.fat, rd.sectorSize, rd.sector)
+			}
+			if err != nil {
+				return fmt.Errorf("reading stream %s: %s", e.name, err)
+			}
+			if uint64(len(data)) < e.size {
+				return fmt.Errorf("stream %s is truncated", e.name)
+			}
+			f.streams[prefix+e.name] = data[:e.size]
+		}
+		return walk(e.right, prefix)
+	}
+	if err := walk(entries[0].child, ""); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// sector returns the contents of a regular sector.
+func (rd *reader) sector(n uint32) ([]byte, error) {
+	off := int64(n+1) * int64(rd.sectorSize)
+	if n > maxRegSect || off+int64(rd.sectorSize) > rd.size {
+		return nil, fmt.Errorf("sector %d out of range", n)
+	}
+	buf := make([]byte, rd.sectorSize)
+	if _, err := rd.r.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readChain reads a chain of sectors from an allocation table.
+func readChain(start uint32, table []uint32, size int, sector func(uint32) ([]byte, error)) ([]byte, error) {
+	buf := []byte{}
+	for n, count := start, 0; n != endOfChain; count++ {
+		if int(n) >= len(table) || count > len(table) {
+			return nil, errors.New("invalid sector chain")
+		}
+		sec, err := sector(n)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, sec[:size]...)
+		n = table[n]
+	}
+	return buf, nil
+}
+
+func parseDirEntry(b []byte, major uint16) dirEntry {
+	le := binary.LittleEndian
+	e := dirEntry{
+		typ:   b[66],
+		left:  le.Uint32(b[68:]),
+		right: le.Uint32(b[72:]),
+		child: le.Uint32(b[76:]),
+		start: le.Uint32(b[116:]),
+		size:  le.Uint64(b[120:]),
+	}
+	// version 3 files may have garbage in the high bits of the size
+	if major == 3 {
+		e.size &= 0xFFFFFFFF
+	}
+	n := int(le.Uint16(b[64:]))/2 - 1
+	if n < 0 || n > maxNameLength {
+		n = 0
+	}
+	name := make([]uint16, n)
+	for i := range name {
+		name[i] = le.Uint16(b[2*i:])
+	}
+	e.name = string(utf16.Decode(name))
+	return e
+}
@@ -0,0 +1,335 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package cfb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Files are written as version 3 compound files, which have 512 byte sectors.
+const (
+	sectorSize     = 512
+	miniSectorSize = 64
+	idsPerSector   = sectorSize / 4
+)
+
+// node is a directory entry being written.
+type node struct {
+	name     string
+	typ      byte
+	data     []byte
+	children []*node
+
+	id                 uint32
+	left, right, child uint32
+	color              byte
+	start              uint32
+}
+
+// Write writes the compound file.
+func (f *File) Write(w io.Writer) error {
+	root, err := f.tree()
+	if err != nil {
+		return err
+	}
+
+	// number the entries and link the children of each storage into a tree
+	nodes := []*node{}
+	var number func(n *node)
+	number = func(n *node) {
+		n.id = uint32(len(nodes))
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			number(c)
+		}
+	}
+	number(root)
+	for _, n := range nodes {
+		n.left, n.right, n.child = noStream, noStream, noStream
+	}
+	for _, n := range nodes {
+		if len(n.children) > 0 {
+			sort.Slice(n.children, func(i, j int) bool {
+				return compareNames(n.children[i].name, n.children[j].name) < 0
+			})
+			n.child = balance(n.children, 0, depth(len(n.children)))
+		}
+	}
+
+	// small streams are stored in the mini stream, in 64 byte sectors
+	miniStream := []byte{}
+	miniFAT := []uint32{}
+	regular := []*node{}
+	for _, n := range nodes {
+		switch {
+		case n.typ != typeStream || len(n.data) == 0:
+			n.start = endOfChain
+		case len(n.data) < miniStreamCutoff:
+			cnt := (len(n.data) + miniSectorSize - 1) / miniSectorSize
+			n.start = uint32(len(miniFAT))
+			miniFAT = appendChain(miniFAT, n.start, cnt)
+			miniStream = append(miniStream, n.data...)
+			miniStream = append(miniStream, make([]byte, cnt*miniSectorSize-len(n.data))...)
+		default:
+			regular = append(regular, n)
+		}
+	}
+	root.data = miniStream
+	if len(miniStream) > 0 {
+		regular = append(regular, root)
+	}
+
+	// lay out the regular sectors as stream data, directory, mini FAT, DIFAT
+	// and finally FAT sectors
+	fat := []uint32{}
+	for _, n := range regular {
+		n.start = uint32(len(fat))
+		fat = appendChain(fat, n.start, sectors(len(n.data)))
+	}
+	dirStart := uint32(len(fat))
+	dirSectors := sectors(len(nodes) * dirEntrySize)
+	fat = appendChain(fat, dirStart, dirSectors)
+	miniFATStart := uint32(endOfChain)
+	miniFATSectors := sectors(len(miniFAT) * 4)
+	if miniFATSectors > 0 {
+		miniFATStart = uint32(len(fat))
+		fat = appendChain(fat, miniFATStart, miniFATSectors)
+	}
+	numFAT, numDIFAT := 0, 0
+	for {
+		total := len(fat) + numFAT + numDIFAT
+		nf := (total + idsPerSector - 1) / idsPerSector
+		nd := 0
+		if nf > 109 {
+			nd = (nf - 109 + idsPerSector - 2) / (idsPerSector - 1)
+		}
+		if nf == numFAT && nd == numDIFAT {
+			break
+		}
+		numFAT, numDIFAT = nf, nd
+	}
+	difatStart := uint32(len(fat))
+	for i := 0; i < numDIFAT; i++ {
+		fat = append(fat, difSect)
+	}
+	fatStart := uint32(len(fat))
+	for i := 0; i < numFAT; i++ {
+		fat = append(fat, fatSect)
+	}
+	for len(fat) < numFAT*idsPerSector {
+		fat = append(fat, freeSect)
+	}
+
+	le := binary.LittleEndian
+	hdr := make([]byte, headerSize)
+	copy(hdr, Signature)
+	le.PutUint16(hdr[24:], 0x003E)
+	le.PutUint16(hdr[26:], 3)
+	le.PutUint16(hdr[28:], 0xFFFE)
+	le.PutUint16(hdr[30:], 9)
+	le.PutUint16(hdr[32:], 6)
+	le.PutUint32(hdr[44:], uint32(numFAT))
+	le.PutUint32(hdr[48:], dirStart)
+	le.PutUint32(hdr[56:], miniStreamCutoff)
+	le.PutUint32(hdr[60:], miniFATStart)
+	le.PutUint32(hdr[64:], uint32(miniFATSectors))
+	if numDIFAT > 0 {
+		le.PutUint32(hdr[68:], difatStart)
+	} else {
+		le.PutUint32(hdr[68:], endOfChain)
+	}
+	le.PutUint32(hdr[72:], uint32(numDIFAT))
+	difat := []uint32{}
+	for i := 0; i < numFAT; i++ {
+		difat = append(difat, fatStart+uint32(i))
+	}
+	for i := 0; i < 109; i++ {
+		v := uint32(freeSect)
+		if i < len(difat) {
+			v = difat[i]
+		}
+		le.PutUint32(hdr[76+4*i:], v)
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	write := func(b []byte) error {
+		b = append(b, make([]byte, sectors(len(b))*sectorSize-len(b))...)
+		_, err := w.Write(b)
+		return err
+	}
+	for _, n := range regular {
+		if err := write(n.data); err != nil {
+			return err
+		}
+	}
+	dir := make([]byte, 0, dirSectors*sectorSize)
+	for _, n := range nodes {
+		dir = append(dir, n.entry()...)
+	}
+	for len(dir) < dirSectors*sectorSize {
+		dir = append(dir, emptyEntry()...)
+	}
+	if err := write(dir); err != nil {
+		return err
+	}
+	if miniFATSectors > 0 {
+		if err := write(uint32s(miniFAT, miniFATSectors*idsPerSector)); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < numDIFAT; i++ {
+		sec := make([]uint32, idsPerSector)
+		for j := range sec {
+			k := 109 + i*(idsPerSector-1) + j
+			switch {
+			case j == idsPerSector-1 && i == numDIFAT-1:
+				sec[j] = endOfChain
+			case j == idsPerSector-1:
+				sec[j] = difatStart + uint32(i+1)
+			case k < len(difat):
+				sec[j] = difat[k]
+			default:
+				sec[j] = freeSect
+			}
+		}
+		if err := write(uint32s(sec, idsPerSector)); err != nil {
+			return err
+		}
+	}
+	return write(uint32s(fat, numFAT*idsPerSector))
+}
+
+// tree builds the directory tree of the file from the stream paths.
+func (f *File) tree() (*node, error) {
+	root := &node{name: "Root Entry", typ: typeRoot, color: 1}
+	for _, p := range f.Streams() {
+		parent := root
+		parts := strings.Split(p, "/")
+		for i, name := range parts {
+			if name == "" || len(utf16.Encode([]rune(name))) > maxNameLength {
+				return nil, fmt.Errorf("invalid stream path %q", p)
+			}
+			var n *node
+			for _, c := range parent.children {
+				if compareNames(c.name, name) == 0 {
+					n = c
+				}
+			}
+			last := i == len(parts)-1
+			if n == nil {
+				n = &node{name: name, typ: typeStorage}
+				if last {
+					n.typ = typeStream
+					n.data = f.streams[p]
+				}
+				parent.children = append(parent.children, n)
+			} else if last || n.typ != typeStorage {
+				return nil, fmt.Errorf("duplicate stream path %q", p)
+			}
+			parent = n
+		}
+	}
+	return root, nil
+}
+
+// balance links sorted sibling entries into a balanced binary tree, returning
+// the ID of its root.  Every level of the tree but the last is full, so coloring
+// the entries of the last level red and all others black makes it a valid
+// red-black tree.
+func balance(nodes []*node, level, maxLevel int) uint32 {
+	if len(nodes) == 0 {
+		return noStream
+	}
+	mid := len(nodes) / 2
+	n := nodes[mid]
+	n.color = 1 // black
+	if level == maxLevel && level > 0 {
+		n.color = 0
+	}
+	n.left = balance(nodes[:mid], level+1, maxLevel)
+	n.right = balance(nodes[mid+1:], level+1, maxLevel)
+	return n.id
+}
+
+// depth returns the level of the deepest entries of a balanced tree.
+func depth(n int) int {
+	d := 0
+	for n > 1 {
+		n /= 2
+		d++
+	}
+	return d
+}
+
+func (n *node) entry() []byte {
+	le := binary.LittleEndian
+	b := make([]byte, dirEntrySize)
+	name := utf16.Encode([]rune(n.name))
+	for i, c := range name {
+		le.PutUint16(b[2*i:], c)
+	}
+	le.PutUint16(b[64:], uint16(2*(len(name)+1)))
+	b[66] = n.typ
+	b[67] = n.color
+	le.PutUint32(b[68:], n.left)
+	le.PutUint32(b[72:], n.right)
+	le.PutUint32(b[76:], n.child)
+	if n.typ == typeStorage {
+		le.PutUint32(b[116:], 0)
+	} else {
+		le.PutUint32(b[116:], n.start)
+	}
+	le.PutUint64(b[120:], uint64(len(n.data)))
+	return b
+}
+
+func emptyEntry() []byte {
+	b := make([]byte, dirEntrySize)
+	le := binary.LittleEndian
+	le.PutUint32(b[68:], noStream)
+	le.PutUint32(b[72:], noStream)
+	le.PutUint32(b[76:], noStream)
+	return b
+}
+
+// sectors returns the number of regular sectors needed to store n bytes.
+func sectors(n int) int {
+	return (n + sectorSize - 1) / sectorSize
+}
+
+// appendChain appends a chain of cnt sectors that starts at start to an
+// allocation table.
+func appendChain(table []uint32, start uint32, cnt int) []uint32 {
+	for i := 1; i < cnt; i++ {
+		table = append(table, start+uint32(i))
+	}
+	if cnt > 0 {
+		table = append(table, endOfChain)
+	}
+	return table
+}
+
+// uint32s encodes an allocation table padded with free sectors to n entries.
+func uint32s(v []uint32, n int) []byte {
+	b := make([]byte, 4*n)
+	for i := 0; i < n; i++ {
+		s := uint32(freeSect)
+		if i < len(v) {
+			s = v[i]
+		}
+		binary.LittleEndian.PutUint32(b[4*i:], s)
+	}
+	return b
+}
@@ -18,21 +18,29 @@ func main() {
 	if flag.NArg() != 1 {
 		log.Fatalf("pass a single document as a parameter")
 	}
-	wb, err := spreadsheet.Open(flag.Arg(0))
+	// the workbook is streamed so that large files can be converted without
+	// reading entire sheets into memory
+	sr, err := spreadsheet.OpenStreamReader(flag.Arg(0))
 	if err != nil {
 		log.Fatalf("error opening: %s", err)
 	}
+	defer sr.Close()
 
-	for _, sheet := range wb.Sheets() {
-		f, err := os.Create(sheet.Name() + ".csv")
+	for i, name := range sr.SheetNames() {
+		// the first pass finds the range of columns used
+		scIdx, ecIdx := columnExtents(sr, i)
+
+		f, err := os.Create(name + ".csv")
 		if err != nil {
 			log.Fatalf("error creating sheet: %s", err)
 		}
 		cw := csv.NewWriter(f)
-		sc, _, ec, _ := sheet.ExtentsIndex()
-		scIdx := reference.ColumnToIndex(sc)
-		ecIdx := reference.ColumnToIndex(ec)
-		for _, r := range sheet.Rows() {
+		rr, err := sr.SheetByIndex(i)
+		if err != nil {
+			log.Fatalf("error reading sheet %s: %s", name, err)
+		}
+		for rr.Next() {
+			r := rr.Row()
 			record := []string{}
 			for c := scIdx; c <= ecIdx; c++ {
 				cell := r.Cell(reference.IndexToColumn(c))
@@ -45,7 +53,41 @@ func main() {
 			}
 			cw.Write(record)
 		}
+		if err := rr.Err(); err != nil {
+			log.Fatalf("error reading sheet %s: %s", name, err)
+		}
+		rr.Close()
 		cw.Flush()
 		f.Close()
 	}
 }
+
+// columnExtents returns the first and last column indexes used in a sheet.
+func columnExtents(sr *spreadsheet.StreamReader, idx int) (uint32, uint32) {
+	rr, err := sr.SheetByIndex(idx)
+	if err != nil {
+		log.Fatalf("error reading sheet: %s", err)
+	}
+	defer rr.Close()
+	var sc, ec uint32
+	found := false
+	for rr.Next() {
+		for _, c := range rr.Row().Cells() {
+			cr, err := reference.ParseCellReference(c.Reference())
+			if err != nil {
+				continue
+			}
+			if !found || cr.ColumnIdx < sc {
+				sc = cr.ColumnIdx
+			}
+			if !found || cr.ColumnIdx > ec {
+				ec = cr.ColumnIdx
+			}
+			found = true
+		}
+	}
+	if err := rr.Err(); err != nil {
+		log.Fatalf("error reading sheet: %s", err)
+	}
+	return sc, ec
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/unidoc/unioffice"
 	"github.com/unidoc/unioffice/common"
+	"github.com/unidoc/unioffice/encryption"
 	"github.com/unidoc/unioffice/zippkg"
 
 	"github.com/unidoc/unioffice/schema/soo/dml"
@@ -493,8 +494,18 @@ func OpenTemplate(filename string) (*Document, error) {
 	return d, nil
 }
 
-// Read reads a document from an io.Reader.
+// Read reads a document from an io.Reader.  Encrypted documents can only be
+// read if they are encrypted with the default password, others must be read
+// with ReadWithPassword.
 func Read(r io.ReaderAt, size int64) (*Document, error) {
+	if encryption.IsEncrypted(r) {
+		doc, err := ReadWithPassword(r, size, encryption.DefaultPassword)
+		if err == encryption.ErrInvalidPassword {
+			return nil, encryption.ErrEncrypted
+		}
+		return doc, err
+	}
+
 	doc := New()
 	// numbering is not required
 	doc.Numbering.x = nil
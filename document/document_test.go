@@ -15,6 +15,7 @@ import (
 
 	"github.com/unidoc/unioffice/common"
 	"github.com/unidoc/unioffice/document"
+	"github.com/unidoc/unioffice/encryption"
 	"github.com/unidoc/unioffice/schema/soo/wml"
 	"github.com/unidoc/unioffice/testhelper"
 )
@@ -385,3 +386,24 @@ func TestGetTables(t *testing.T) {
 		t.Errorf("nested table not enumerated. found %d, expected 2", len(tables))
 	}
 }
+
+func TestSaveWithPassword(t *testing.T) {
+	doc := document.New()
+	doc.AddParagraph().AddRun().AddText("secret")
+
+	buf := bytes.Buffer{}
+	if err := doc.SaveWithPassword(&buf, "gooxml"); err != nil {
+		t.Fatalf("error saving: %s", err)
+	}
+	r := bytes.NewReader(buf.Bytes())
+	if _, err := document.Read(r, int64(buf.Len())); err != encryption.ErrEncrypted {
+		t.Errorf("expected an encrypted document error, got %v", err)
+	}
+	doc2, err := document.ReadWithPassword(r, int64(buf.Len()), "gooxml")
+	if err != nil {
+		t.Fatalf("error reading: %s", err)
+	}
+	if got := doc2.Paragraphs()[0].Runs()[0].Text(); got != "secret" {
+		t.Errorf("expected text secret, got %s", got)
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+const (
+	passwordKeyEncryptorURI = "http://schemas.microsoft.com/office/2006/keyEncryptor/password"
+
+	// packages are encrypted in segments that each have their own IV
+	agileSegmentSize = 4096
+	agileSpinCount   = 100000
+	// maxSpinCount is the largest spin count allowed by MS-OFFCRYPTO
+	maxSpinCount = 10000000
+	maxSaltSize  = 65536
+)
+
+// Block keys that are hashed with the password hash or salt to derive the
+// different keys and IVs of agile encryption.
+var (
+	blockKeyVerifierHashInput = []byte{0xfe, 0xa7, 0xd2, 0x76, 0x3b, 0x4b, 0x9e, 0x79}
+	blockKeyVerifierHashValue = []byte{0xd7, 0xaa, 0x0f, 0x6d, 0x30, 0x61, 0x34, 0x4e}
+	blockKeyEncryptedKey      = []byte{0x14, 0x6e, 0x0b, 0xe7, 0xab, 0xac, 0xd0, 0xd6}
+	blockKeyIntegrityKey      = []byte{0x5f, 0xb2, 0xad, 0x01, 0x0c, 0xb9, 0xe1, 0xf6}
+	blockKeyIntegrityValue    = []byte{0xa0, 0x67, 0x7f, 0x02, 0xb2, 0x2c, 0x84, 0x33}
+)
+
+// agileParams are the cipher and hash parameters shared by the key data and
+// the password key encryptor.
+type agileParams struct {
+	SaltSize        int    `xml:"saltSize,attr"`
+	BlockSize       int    `xml:"blockSize,attr"`
+	KeyBits         int    `xml:"keyBits,attr"`
+	HashSize        int    `xml:"hashSize,attr"`
+	CipherAlgorithm string `xml:"cipherAlgorithm,attr"`
+	CipherChaining  string `xml:"cipherChaining,attr"`
+	HashAlgorithm   string `xml:"hashAlgorithm,attr"`
+	SaltValue       string `xml:"saltValue,attr"`
+}
+
+type agileEncryptedKey struct {
+	agileParams
+	SpinCount                  uint32 `xml:"spinCount,attr"`
+	EncryptedVerifierHashInput string `xml:"encryptedVerifierHashInput,attr"`
+	EncryptedVerifierHashValue string `xml:"encryptedVerifierHashValue,attr"`
+	EncryptedKeyValue          string `xml:"encryptedKeyValue,attr"`
+}
+
+type agileInfo struct {
+	KeyData       agileParams `xml:"keyData"`
+	DataIntegrity *struct {
+		EncryptedHmacKey   string `xml:"encryptedHmacKey,attr"`
+		EncryptedHmacValue string `xml:"encryptedHmacValue,attr"`
+	} `xml:"dataIntegrity"`
+	KeyEncryptors []struct {
+		URI          string             `xml:"uri,attr"`
+		EncryptedKey *agileEncryptedKey `xml:"http://schemas.microsoft.com/office/2006/keyEncryptor/password encryptedKey"`
+	} `xml:"keyEncryptors>keyEncryptor"`
+}
+
+// agileCipher is a cipher and hash configured from agile parameters.
+type agileCipher struct {
+	params  agileParams
+	salt    []byte
+	newHash func() hash.Hash
+}
+
+func newAgileCipher(p agileParams) (*agileCipher, error) {
+	if p.CipherAlgorithm != "AES" {
+		return nil, fmt.Errorf("unsupported cipher algorithm %s", p.CipherAlgorithm)
+	}
+	if p.CipherChaining != "ChainingModeCBC" {
+		return nil, fmt.Errorf("unsupported cipher chaining %s", p.CipherChaining)
+	}
+	if p.BlockSize != aes.BlockSize || (p.KeyBits != 128 && p.KeyBits != 192 && p.KeyBits != 256) {
+		return nil, fmt.Errorf("unsupported AES block size %d and key size %d", p.BlockSize, p.KeyBits)
+	}
+	nh, err := newHash(p.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if p.HashSize != nh().Size() {
+		return nil, fmt.Errorf("invalid hash size %d for %s", p.HashSize, p.HashAlgorithm)
+	}
+	if p.SaltSize < 1 || p.SaltSize > maxSaltSize {
+		return nil, fmt.Errorf("invalid salt size %d", p.SaltSize)
+	}
+	salt, err := base64.StdEncoding.DecodeString(p.SaltValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %s", err)
+	}
+	return &agileCipher{params: p, salt: salt, newHash: nh}, nil
+}
+
+// iv returns the IV derived from the salt and a block key, or the salt itself
+// if there is no block key.
+func (c *agileCipher) iv(blockKey []byte) []byte {
+	if blockKey == nil {
+		return resize(c.salt, c.params.BlockSize, 0x36)
+	}
+	return resize(hashOf(c.newHash, c.salt, blockKey), c.params.BlockSize, 0x36)
+}
+
+// passwordKey derives the key that decrypts one of the values of the password
+// key encryptor.
+func (c *agileCipher) passwordKey(pwHash, blockKey []byte) (cipher.Block, error) {
+	return aes.NewCipher(resize(hashOf(c.newHash, pwHash, blockKey), c.params.KeyBits/8, 0x36))
+}
+
+func (c *agileCipher) crypt(key cipher.Block, blockKey []byte, data []byte, encrypt bool) ([]byte, error) {
+	return cbc(key, c.iv(blockKey), data, encrypt)
+}
+
+func decodeValue(s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption info: %s", err)
+	}
+	return b, nil
+}
+
+func decryptAgile(info, pkg []byte, password string) ([]byte, error) {
+	ai := agileInfo{}
+	if err := xml.Unmarshal(info, &ai); err != nil {
+		return nil, fmt.Errorf("parsing encryption info: %s", err)
+	}
+	var ek *agileEncryptedKey
+	for _, ke := range ai.KeyEncryptors {
+		if ke.URI == passwordKeyEncryptorURI && ke.EncryptedKey != nil {
+			ek = ke.EncryptedKey
+		}
+	}
+	if ek == nil {
+		return nil, errors.New("package isn't encrypted with a password")
+	}
+
+	// verify the password and decrypt the key of the package with it
+	pc, err := newAgileCipher(ek.agileParams)
+	if err != nil {
+		return nil, err
+	}
+	if ek.SpinCount > maxSpinCount {
+		return nil, fmt.Errorf("spin count %d exceeds the limit of %d", ek.SpinCount, maxSpinCount)
+	}
+	dc, err := newAgileCipher(ai.KeyData)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkg) < 8 {
+		return nil, errors.New("encrypted package is truncated")
+	}
+	pwHash := hashPassword(pc.newHash, pc.salt, password, ek.SpinCount)
+	values := [][]byte{}
+	for _, v := range []struct {
+		value    string
+		blockKey []byte
+	}{
+		{ek.EncryptedVerifierHashInput, blockKeyVerifierHashInput},
+		{ek.EncryptedVerifierHashValue, blockKeyVerifierHashValue},
+		{ek.EncryptedKeyValue, blockKeyEncryptedKey},
+	} {
+		enc, err := decodeValue(v.value)
+		if err != nil {
+			return nil, err
+		}
+		key, err := pc.passwordKey(pwHash, v.blockKey)
+		if err != nil {
+			return nil, err
+		}
+		dec, err := pc.crypt(key, nil, enc, false)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, dec)
+	}
+	if len(values[0]) < ek.SaltSize || len(values[1]) < ek.HashSize || len(values[2]) < ai.KeyData.KeyBits/8 {
+		return nil, errors.New("invalid encryption info")
+	}
+	verifierHash := hashOf(pc.newHash, values[0][:ek.SaltSize])
+	if !bytes.Equal(resize(verifierHash, ek.HashSize, 0), values[1][:ek.HashSize]) {
+		return nil, ErrInvalidPassword
+	}
+
+	key, err := aes.NewCipher(values[2][:ai.KeyData.KeyBits/8])
+	if err != nil {
+		return nil, err
+	}
+
+	if ai.DataIntegrity != nil {
+		if err := dc.verifyIntegrity(key, ai.DataIntegrity.EncryptedHmacKey,
+			ai.DataIntegrity.EncryptedHmacValue, pkg); err != nil {
+			return nil, err
+		}
+	}
+
+	size := binary.LittleEndian.Uint64(pkg)
+	data := pkg[8:]
+	ret := make([]byte, 0, len(data))
+	seg := make([]byte, 4)
+	for i := 0; i*agileSegmentSize < len(data); i++ {
+		end := (i + 1) * agileSegmentSize
+		if end > len(data) {
+			end = len(data)
+		}
+		binary.LittleEndian.PutUint32(seg, uint32(i))
+		dec, err := dc.crypt(key, seg, data[i*agileSegmentSize:end], false)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, dec...)
+	}
+	if uint64(len(ret)) < size {
+		return nil, errors.New("encrypted package is truncated")
+	}
+	return ret[:size], nil
+}
+
+// verifyIntegrity checks the HMAC of the encrypted package.
+func (c *agileCipher) verifyIntegrity(key cipher.Block, encHmacKey, encHmacValue string, pkg []byte) error {
+	hk, err := decodeValue(encHmacKey)
+	if err != nil {
+		return err
+	}
+	hv, err := decodeValue(encHmacValue)
+	if err != nil {
+		return err
+	}
+	if hk, err = c.crypt(key, blockKeyIntegrityKey, hk, false); err != nil {
+		return err
+	}
+	if hv, err = c.crypt(key, blockKeyIntegrityValue, hv, false); err != nil {
+		return err
+	}
+	hs := c.params.HashSize
+	if len(hk) < hs || len(hv) < hs {
+		return errors.New("invalid data integrity")
+	}
+	mac := hmac.New(c.newHash, hk[:hs])
+	mac.Write(pkg)
+	if !hmac.Equal(mac.Sum(nil), hv[:hs]) {
+		return errors.New("encrypted package failed the integrity check")
+	}
+	return nil
+}
+
+func encryptAgile(pkg []byte, password string) ([]byte, []byte, error) {
+	rnd, err := randomBytes(16 + 16 + 32 + 16 + sha512.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+	keySalt, pwSalt, secret := rnd[0:16], rnd[16:32], rnd[32:64]
+	verifier, hmacKey := rnd[64:80], rnd[80:]
+	params := func(salt []byte) agileParams {
+		return agileParams{
+			SaltSize:        16,
+			BlockSize:       aes.BlockSize,
+			KeyBits:         256,
+			HashSize:        sha512.Size,
+			CipherAlgorithm: "AES",
+			CipherChaining:  "ChainingModeCBC",
+			HashAlgorithm:   "SHA512",
+			SaltValue:       base64.StdEncoding.EncodeToString(salt),
+		}
+	}
+	dc, err := newAgileCipher(params(keySalt))
+	if err != nil {
+		return nil, nil, err
+	}
+	pc, err := newAgileCipher(params(pwSalt))
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the package is prefixed by its size and encrypted in segments
+	enc := make([]byte, 8, 8+len(pkg)+aes.BlockSize)
+	binary.LittleEndian.PutUint64(enc, uint64(len(pkg)))
+	seg := make([]byte, 4)
+	for i := 0; i*agileSegmentSize < len(pkg); i++ {
+		end := (i + 1) * agileSegmentSize
+		if end > len(pkg) {
+			end = len(pkg)
+		}
+		binary.LittleEndian.PutUint32(seg, uint32(i))
+		e, err := dc.crypt(key, seg, padBlock(pkg[i*agileSegmentSize:end], aes.BlockSize), true)
+		if err != nil {
+			return nil, nil, err
+		}
+		enc = append(enc, e...)
+	}
+
+	// the password key encryptor values
+	ek := agileEncryptedKey{agileParams: pc.params, SpinCount: agileSpinCount}
+	pwHash := hashPassword(pc.newHash, pc.salt, password, agileSpinCount)
+	for _, v := range []struct {
+		dst      *string
+		value    []byte
+		blockKey []byte
+	}{
+		{&ek.EncryptedVerifierHashInput, verifier, blockKeyVerifierHashInput},
+		{&ek.EncryptedVerifierHashValue, hashOf(pc.newHash, verifier), blockKeyVerifierHashValue},
+		{&ek.EncryptedKeyValue, secret, blockKeyEncryptedKey},
+	} {
+		k, err := pc.passwordKey(pwHash, v.blockKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := pc.crypt(k, nil, padBlock(v.value, aes.BlockSize), true)
+		if err != nil {
+			return nil, nil, err
+		}
+		*v.dst = base64.StdEncoding.EncodeToString(e)
+	}
+
+	// the HMAC of the encrypted package
+	mac := hmac.New(dc.newHash, hmacKey)
+	mac.Write(enc)
+	encHmacKey, err := dc.crypt(key, blockKeyIntegrityKey, hmacKey, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	encHmacValue, err := dc.crypt(key, blockKeyIntegrityValue, mac.Sum(nil), true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := bytes.Buffer{}
+	binary.Write(&info, binary.LittleEndian, []uint16{4, 4})
+	binary.Write(&info, binary.LittleEndian, uint32(0x40))
+	info.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\r\n")
+	info.WriteString(`<encryption xmlns="http://schemas.microsoft.com/office/2006/encryption"` +
+		` xmlns:p="http://schemas.microsoft.com/office/2006/keyEncryptor/password"` +
+		` xmlns:c="http://schemas.microsoft.com/office/2006/keyEncryptor/certificate">`)
+	fmt.Fprintf(&info, `<keyData %s/>`, dc.params.attrs())
+	fmt.Fprintf(&info, `<dataIntegrity encryptedHmacKey="%s" encryptedHmacValue="%s"/>`,
+		base64.StdEncoding.EncodeToString(encHmacKey), base64.StdEncoding.EncodeToString(encHmacValue))
+	fmt.Fprintf(&info, `<keyEncryptors><keyEncryptor uri="%s">`, passwordKeyEncryptorURI)
+	fmt.Fprintf(&info, `<p:encryptedKey spinCount="%d" %s encryptedVerifierHashInput="%s"`+
+		` encryptedVerifierHashValue="%s" encryptedKeyValue="%s"/>`, ek.SpinCount, ek.attrs(),
+		ek.EncryptedVerifierHashInput, ek.EncryptedVerifierHashValue, ek.EncryptedKeyValue)
+	info.WriteString(`</keyEncryptor></keyEncryptors></encryption>`)
+	return info.Bytes(), enc, nil
+}
+
+// attrs returns the parameters as XML attributes.
+func (p agileParams) attrs() string {
+	return fmt.Sprintf(`saltSize="%d" blockSize="%d" keyBits="%d" hashSize="%d" cipherAlgorithm="%s"`+
+		` cipherChaining="%s" hashAlgorithm="%s" saltValue="%s"`, p.SaltSize, p.BlockSize, p.KeyBits,
+		p.HashSize, p.CipherAlgorithm, p.CipherChaining, p.HashAlgorithm, p.SaltValue)
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/unidoc/unioffice/cfb"
+)
+
+// addDataSpaces adds the data spaces streams that declare that the
+// EncryptedPackage stream is transformed by encryption.
+func addDataSpaces(f *cfb.File) {
+	f.SetStream("\x06DataSpaces/Version", dataSpaceStream(
+		unicodeLP("Microsoft.Container.DataSpaces"), versions()))
+
+	entry := dataSpaceStream(
+		uint32(1), // reference components
+		uint32(0), // a stream
+		unicodeLP("EncryptedPackage"),
+		unicodeLP("StrongEncryptionDataSpace"))
+	f.SetStream("\x06DataSpaces/DataSpaceMap", dataSpaceStream(
+		uint32(8), // header length
+		uint32(1), // entries
+		uint32(len(entry)+4), entry))
+
+	f.SetStream("\x06DataSpaces/DataSpaceInfo/StrongEncryptionDataSpace", dataSpaceStream(
+		uint32(8), // header length
+		uint32(1), // transforms
+		unicodeLP("StrongEncryptionTransform")))
+
+	id := unicodeLP("{FF9A3F03-56EF-4613-BDD5-5A41C1D07246}")
+	f.SetStream("\x06DataSpaces/TransformInfo/StrongEncryptionTransform/\x06Primary", dataSpaceStream(
+		uint32(8+len(id)), // length of the header before the name
+		uint32(1),         // transform type
+		id,
+		unicodeLP("Microsoft.Container.EncryptionTransform"),
+		versions(),
+		// the encryption name, block size, cipher mode and reserved value
+		[]uint32{0, 0, 0, 4}))
+}
+
+// dataSpaceStream encodes a sequence of little endian values and byte slices.
+func dataSpaceStream(values ...interface{}) []byte {
+	buf := bytes.Buffer{}
+	for _, v := range values {
+		if b, ok := v.([]byte); ok {
+			buf.Write(b)
+		} else {
+			binary.Write(&buf, binary.LittleEndian, v)
+		}
+	}
+	return buf.Bytes()
+}
+
+// versions returns the reader, updater and writer versions, which are all 1.0.
+func versions() []uint16 {
+	return []uint16{1, 0, 1, 0, 1, 0}
+}
+
+// unicodeLP encodes a string prefixed with its length in bytes and padded to a
+// multiple of four bytes.
+func unicodeLP(s string) []byte {
+	u := utf16le(s)
+	b := make([]byte, 4, 4+len(u)+2)
+	binary.LittleEndian.PutUint32(b, uint32(len(u)))
+	b = append(b, u...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
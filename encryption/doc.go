@@ -0,0 +1,15 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+// Package encryption encrypts and decrypts password protected OOXML packages
+// (MS-OFFCRYPTO).  An encrypted package is a compound file that contains the
+// encryption parameters in an EncryptionInfo stream and the encrypted zip
+// package in an EncryptedPackage stream.
+//
+// Agile encryption, used by Office 2010 and later, and Standard encryption,
+// used by Office 2007, are supported for both reading and writing.
+package encryption
@@ -0,0 +1,206 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"unicode/utf16"
+
+	"github.com/unidoc/unioffice/cfb"
+)
+
+// Names of the streams of an encrypted package.
+const (
+	encryptionInfoStream   = "EncryptionInfo"
+	encryptedPackageStream = "EncryptedPackage"
+)
+
+// DefaultPassword is the password that Office uses to encrypt packages that
+// are only protected from modification, so that they can be opened without a
+// password.
+const DefaultPassword = "VelvetSweatshop"
+
+var (
+	// ErrEncrypted is returned when reading an encrypted package without a
+	// password.
+	ErrEncrypted = errors.New("package is encrypted, a password is required to read it")
+	// ErrInvalidPassword is returned when decrypting with the wrong password.
+	ErrInvalidPassword = errors.New("invalid password")
+)
+
+// Method is a method of encrypting a package.
+type Method byte
+
+// Method constants.
+const (
+	MethodAgile    Method = iota // AES-256 with SHA-512 keys, Office 2010 and later
+	MethodStandard               // AES-128 with SHA-1 keys, Office 2007
+)
+
+// IsEncrypted returns true if r is an encrypted package rather than a zip file.
+func IsEncrypted(r io.ReaderAt) bool {
+	return cfb.IsCompoundFile(r)
+}
+
+// Decrypt decrypts an encrypted package with a password, returning the
+// contents of the zip package.
+func Decrypt(r io.ReaderAt, size int64, password string) ([]byte, error) {
+	f, err := cfb.Read(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("reading encrypted package: %s", err)
+	}
+	info, ok := f.Stream(encryptionInfoStream)
+	if !ok {
+		return nil, errors.New("encrypted package has no EncryptionInfo stream")
+	}
+	pkg, ok := f.Stream(encryptedPackageStream)
+	if !ok {
+		return nil, errors.New("encrypted package has no EncryptedPackage stream")
+	}
+	if len(info) < 8 || len(pkg) < 8 {
+		return nil, errors.New("encrypted package is truncated")
+	}
+	major := binary.LittleEndian.Uint16(info)
+	minor := binary.LittleEndian.Uint16(info[2:])
+	switch {
+	case major == 4 && minor == 4:
+		return decryptAgile(info[8:], pkg, password)
+	case (major == 2 || major == 3 || major == 4) && minor == 2:
+		return decryptStandard(info[4:], pkg, password)
+	}
+	return nil, fmt.Errorf("unsupported encryption version %d.%d", major, minor)
+}
+
+// Encrypt encrypts the contents of a zip package with a password, writing the
+// encrypted package to w.
+func Encrypt(w io.Writer, pkg []byte, password string, m Method) error {
+	var info, enc []byte
+	var err error
+	switch m {
+	case MethodAgile:
+		info, enc, err = encryptAgile(pkg, password)
+	case MethodStandard:
+		info, enc, err = encryptStandard(pkg, password)
+	default:
+		err = fmt.Errorf("unsupported encryption method %d", m)
+	}
+	if err != nil {
+		return err
+	}
+	f := cfb.New()
+	addDataSpaces(f)
+	f.SetStream(encryptionInfoStream, info)
+	f.SetStream(encryptedPackageStream, enc)
+	return f.Write(w)
+}
+
+// newHash returns the constructor of a hash algorithm by its name in the
+// encryption info.
+func newHash(name string) (func() hash.Hash, error) {
+	switch name {
+	case "SHA1", "SHA-1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA384":
+		return sha512.New384, nil
+	case "SHA512":
+		return sha512.New, nil
+	case "MD5":
+		return md5.New, nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %s", name)
+}
+
+// hashPassword derives the hash of a password that keys are generated from,
+// hashing the salt and password and then rehashing with an iteration counter
+// spinCount times.
+func hashPassword(newHash func() hash.Hash, salt []byte, password string, spinCount uint32) []byte {
+	h := newHash()
+	h.Write(salt)
+	h.Write(utf16le(password))
+	sum := h.Sum(nil)
+	it := make([]byte, 4)
+	for i := uint32(0); i < spinCount; i++ {
+		binary.LittleEndian.PutUint32(it, i)
+		h.Reset()
+		h.Write(it)
+		h.Write(sum)
+		sum = h.Sum(sum[:0])
+	}
+	return sum
+}
+
+// hashOf returns the hash of the concatenation of some byte slices.
+func hashOf(newHash func() hash.Hash, bs ...[]byte) []byte {
+	h := newHash()
+	for _, b := range bs {
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
+
+// resize truncates b to n bytes, or pads it to n bytes with a padding byte.
+func resize(b []byte, n int, pad byte) []byte {
+	ret := make([]byte, n)
+	copy(ret, b)
+	for i := len(b); i < n; i++ {
+		ret[i] = pad
+	}
+	return ret
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// cbc encrypts or decrypts data, which must be a multiple of the block size,
+// in CBC mode.
+func cbc(block cipher.Block, iv, data []byte, encrypt bool) ([]byte, error) {
+	if len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("encrypted data is not a multiple of the block size")
+	}
+	ret := make([]byte, len(data))
+	if encrypt {
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ret, data)
+	} else {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(ret, data)
+	}
+	return ret, nil
+}
+
+// padBlock pads data with zeros to a multiple of the block size.
+func padBlock(data []byte, blockSize int) []byte {
+	if r := len(data) % blockSize; r != 0 {
+		data = append(data[:len(data):len(data)], make([]byte, blockSize-r)...)
+	}
+	return data
+}
@@ -0,0 +1,175 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package encryption_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/unidoc/unioffice/cfb"
+	"github.com/unidoc/unioffice/encryption"
+)
+
+func testPackage(n int) []byte {
+	pkg := make([]byte, n)
+	for i := range pkg {
+		pkg[i] = byte(i * 7)
+	}
+	return pkg
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, m := range []encryption.Method{encryption.MethodAgile, encryption.MethodStandard} {
+		// sizes around the agile segment size and the AES block size
+		for _, n := range []int{0, 1, 16, 4095, 4096, 4097, 10000} {
+			pkg := testPackage(n)
+			buf := bytes.Buffer{}
+			if err := encryption.Encrypt(&buf, pkg, "pässwörd", m); err != nil {
+				t.Fatalf("error encrypting: %s", err)
+			}
+			r := bytes.NewReader(buf.Bytes())
+			if !encryption.IsEncrypted(r) {
+				t.Errorf("expected the package to be encrypted")
+			}
+			got, err := encryption.Decrypt(r, int64(buf.Len()), "pässwörd")
+			if err != nil {
+				t.Fatalf("method %d size %d: error decrypting: %s", m, n, err)
+			}
+			if !bytes.Equal(got, pkg) {
+				t.Errorf("method %d size %d: decrypted package differs", m, n)
+			}
+			if _, err := encryption.Decrypt(r, int64(buf.Len()), "password"); err != encryption.ErrInvalidPassword {
+				t.Errorf("method %d: expected an invalid password error, got %v", m, err)
+			}
+		}
+	}
+}
+
+func TestEncryptedStreams(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := encryption.Encrypt(&buf, testPackage(100), "secret", encryption.MethodAgile); err != nil {
+		t.Fatalf("error encrypting: %s", err)
+	}
+	f, err := cfb.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading compound file: %s", err)
+	}
+	for _, s := range []string{
+		"EncryptionInfo",
+		"EncryptedPackage",
+		"\x06DataSpaces/Version",
+		"\x06DataSpaces/DataSpaceMap",
+		"\x06DataSpaces/DataSpaceInfo/StrongEncryptionDataSpace",
+		"\x06DataSpaces/TransformInfo/StrongEncryptionTransform/\x06Primary",
+	} {
+		if _, ok := f.Stream(s); !ok {
+			t.Errorf("expected stream %q", s)
+		}
+	}
+	info, _ := f.Stream("EncryptionInfo")
+	if !bytes.Equal(info[:8], []byte{4, 0, 4, 0, 0x40, 0, 0, 0}) {
+		t.Errorf("expected agile encryption version 4.4, got % x", info[:8])
+	}
+	if !bytes.Contains(info, []byte(`hashAlgorithm="SHA512"`)) {
+		t.Errorf("expected SHA512 to be used")
+	}
+
+	// tampering with the package fails the integrity check
+	pkg, _ := f.Stream("EncryptedPackage")
+	pkg[20] ^= 0xff
+	f.SetStream("EncryptedPackage", pkg)
+	buf.Reset()
+	if err := f.Write(&buf); err != nil {
+		t.Fatalf("error writing compound file: %s", err)
+	}
+	if _, err := encryption.Decrypt(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "secret"); err == nil {
+		t.Errorf("expected an error decrypting a modified package")
+	}
+}
+
+func TestDecryptNotEncrypted(t *testing.T) {
+	data := append([]byte("PK\x03\x04"), make([]byte, 1024)...)
+	r := bytes.NewReader(data)
+	if encryption.IsEncrypted(r) {
+		t.Errorf("expected a zip file not to be encrypted")
+	}
+	if _, err := encryption.Decrypt(r, int64(len(data)), "secret"); err == nil {
+		t.Errorf("expected an error decrypting a zip file")
+	}
+
+	// a compound file that isn't an encrypted package
+	f := cfb.New()
+	f.SetStream("WordDocument", []byte("data"))
+	buf := bytes.Buffer{}
+	if err := f.Write(&buf); err != nil {
+		t.Fatalf("error writing compound file: %s", err)
+	}
+	if _, err := encryption.Decrypt(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "secret"); err == nil {
+		t.Errorf("expected an error decrypting a compound file without encryption info")
+	}
+}
+
+// modifyInfo encrypts a package and returns it with its encryption info
+// modified by fn.
+func modifyInfo(t *testing.T, m encryption.Method, fn func(info []byte) []byte) []byte {
+	buf := bytes.Buffer{}
+	if err := encryption.Encrypt(&buf, testPackage(100), "secret", m); err != nil {
+		t.Fatalf("error encrypting: %s", err)
+	}
+	f, err := cfb.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading compound file: %s", err)
+	}
+	info, _ := f.Stream("EncryptionInfo")
+	f.SetStream("EncryptionInfo", fn(append([]byte(nil), info...)))
+	buf.Reset()
+	if err := f.Write(&buf); err != nil {
+		t.Fatalf("error writing compound file: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecryptMalformed(t *testing.T) {
+	replace := func(old, new string) func(info []byte) []byte {
+		return func(info []byte) []byte {
+			if !bytes.Contains(info, []byte(old)) {
+				t.Fatalf("expected %s in the encryption info", old)
+			}
+			return bytes.Replace(info, []byte(old), []byte(new), 1)
+		}
+	}
+	keyBits := func(bits uint32) func(info []byte) []byte {
+		return func(info []byte) []byte {
+			// the key size in the header following the version, flags and
+			// header size
+			binary.LittleEndian.PutUint32(info[28:], bits)
+			return info
+		}
+	}
+	td := []struct {
+		Name   string
+		Method encryption.Method
+		Modify func(info []byte) []byte
+	}{
+		{"negative salt size", encryption.MethodAgile, replace(`spinCount="100000" saltSize="16"`, `spinCount="100000" saltSize="-1"`)},
+		{"huge spin count", encryption.MethodAgile, replace(`spinCount="100000"`, `spinCount="4000000000"`)},
+		{"oversized hash", encryption.MethodAgile, replace(`keyBits="256" hashSize="64"`, `keyBits="256" hashSize="100000"`)},
+		{"mismatched key data", encryption.MethodAgile, replace(`<keyData saltSize="16" blockSize="16" keyBits="256"`, `<keyData saltSize="16" blockSize="16" keyBits="128"`)},
+		{"oversized key", encryption.MethodStandard, keyBits(14208)},
+		{"key size of another algorithm", encryption.MethodStandard, keyBits(256)},
+	}
+	for _, tc := range td {
+		data := modifyInfo(t, tc.Method, tc.Modify)
+		for _, pw := range []string{"secret", "wrong"} {
+			if _, err := encryption.Decrypt(bytes.NewReader(data), int64(len(data)), pw); err == nil {
+				t.Errorf("%s: expected an error decrypting with password %s", tc.Name, pw)
+			}
+		}
+	}
+}
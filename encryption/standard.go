@@ -0,0 +1,189 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Flags and algorithm IDs of standard encryption.
+const (
+	standardFlagCryptoAPI = 0x04
+	standardFlagExternal  = 0x10
+	standardFlagAES       = 0x20
+
+	algAES128 = 0x660E
+	algAES192 = 0x660F
+	algAES256 = 0x6610
+	algSHA1   = 0x8004
+
+	providerAES      = 0x18
+	standardSpin     = 50000
+	standardProvider = "Microsoft Enhanced RSA and AES Cryptographic Provider"
+)
+
+// standardKey derives the key of standard encryption from a password.
+func standardKey(salt []byte, password string, keyBytes int) []byte {
+	h := hashPassword(sha1.New, salt, password, standardSpin)
+	h = hashOf(sha1.New, h, []byte{0, 0, 0, 0})
+	derive := func(pad byte) []byte {
+		buf := bytes.Repeat([]byte{pad}, 64)
+		for i := range h {
+			buf[i] ^= h[i]
+		}
+		return hashOf(sha1.New, buf)
+	}
+	return append(derive(0x36), derive(0x5c)...)[:keyBytes]
+}
+
+// ecb encrypts or decrypts data, which must be a multiple of the block size,
+// in ECB mode.
+func ecb(block cipher.Block, data []byte, encrypt bool) ([]byte, error) {
+	bs := block.BlockSize()
+	if len(data)%bs != 0 {
+		return nil, errors.New("encrypted data is not a multiple of the block size")
+	}
+	ret := make([]byte, len(data))
+	for i := 0; i < len(data); i += bs {
+		if encrypt {
+			block.Encrypt(ret[i:], data[i:i+bs])
+		} else {
+			block.Decrypt(ret[i:], data[i:i+bs])
+		}
+	}
+	return ret, nil
+}
+
+func decryptStandard(info, pkg []byte, password string) ([]byte, error) {
+	le := binary.LittleEndian
+	if len(info) < 8 {
+		return nil, errors.New("invalid encryption info")
+	}
+	flags := le.Uint32(info)
+	if flags&standardFlagExternal != 0 {
+		return nil, errors.New("unsupported external encryption")
+	}
+	if flags&standardFlagCryptoAPI == 0 || flags&standardFlagAES == 0 {
+		return nil, errors.New("unsupported standard encryption, only AES is supported")
+	}
+	hdrSize := int(le.Uint32(info[4:]))
+	if len(info) < 8+hdrSize+4 || hdrSize < 32 {
+		return nil, errors.New("invalid encryption info")
+	}
+	hdr := info[8 : 8+hdrSize]
+	algID, algIDHash, keyBits := le.Uint32(hdr[8:]), le.Uint32(hdr[12:]), le.Uint32(hdr[16:])
+	// the key size must match the algorithm, where an algorithm of zero
+	// means AES-128
+	algKeyBits := map[uint32]uint32{0: 128, algAES128: 128, algAES192: 192, algAES256: 256}
+	bits, ok := algKeyBits[algID]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encryption algorithm 0x%x", algID)
+	}
+	if algIDHash != 0 && algIDHash != algSHA1 {
+		return nil, fmt.Errorf("unsupported hash algorithm 0x%x", algIDHash)
+	}
+	if keyBits == 0 && algID == 0 {
+		keyBits = 128
+	}
+	if keyBits != bits {
+		return nil, fmt.Errorf("invalid key size %d for encryption algorithm 0x%x", keyBits, algID)
+	}
+	if len(pkg) < 8 {
+		return nil, errors.New("encrypted package is truncated")
+	}
+
+	v := info[8+hdrSize:]
+	saltSize := int(le.Uint32(v))
+	if saltSize != 16 || len(v) < 4+16+16+4+32 {
+		return nil, errors.New("invalid encryption verifier")
+	}
+	salt := v[4:20]
+	encVerifier := v[20:36]
+	hashSize := int(le.Uint32(v[36:]))
+	encVerifierHash := v[40:72]
+	if hashSize > sha1.Size {
+		return nil, errors.New("invalid encryption verifier")
+	}
+
+	block, err := aes.NewCipher(standardKey(salt, password, int(keyBits/8)))
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := ecb(block, encVerifier, false)
+	if err != nil {
+		return nil, err
+	}
+	verifierHash, err := ecb(block, encVerifierHash, false)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hashOf(sha1.New, verifier)[:hashSize], verifierHash[:hashSize]) {
+		return nil, ErrInvalidPassword
+	}
+
+	size := le.Uint64(pkg)
+	data := pkg[8:]
+	data = data[:len(data)-len(data)%aes.BlockSize]
+	ret, err := ecb(block, data, false)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(ret)) < size {
+		return nil, errors.New("encrypted package is truncated")
+	}
+	return ret[:size], nil
+}
+
+func encryptStandard(pkg []byte, password string) ([]byte, []byte, error) {
+	rnd, err := randomBytes(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	salt, verifier := rnd[:16], rnd[16:]
+	block, err := aes.NewCipher(standardKey(salt, password, 16))
+	if err != nil {
+		return nil, nil, err
+	}
+	encVerifier, err := ecb(block, verifier, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	encVerifierHash, err := ecb(block, padBlock(hashOf(sha1.New, verifier), aes.BlockSize), true)
+	if err != nil {
+		return nil, nil, err
+	}
+	encPkg, err := ecb(block, padBlock(pkg, aes.BlockSize), true)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc := make([]byte, 8, 8+len(encPkg))
+	binary.LittleEndian.PutUint64(enc, uint64(len(pkg)))
+	enc = append(enc, encPkg...)
+
+	flags := uint32(standardFlagCryptoAPI | standardFlagAES)
+	hdr := bytes.Buffer{}
+	binary.Write(&hdr, binary.LittleEndian, []uint32{flags, 0, algAES128, algSHA1, 128, providerAES, 0, 0})
+	hdr.Write(utf16le(standardProvider + "\x00"))
+
+	info := bytes.Buffer{}
+	binary.Write(&info, binary.LittleEndian, []uint16{3, 2})
+	binary.Write(&info, binary.LittleEndian, []uint32{flags, uint32(hdr.Len())})
+	info.Write(hdr.Bytes())
+	binary.Write(&info, binary.LittleEndian, uint32(len(salt)))
+	info.Write(salt)
+	info.Write(encVerifier)
+	binary.Write(&info, binary.LittleEndian, uint32(sha1.Size))
+	info.Write(encVerifierHash)
+	return info.Bytes(), enc, nil
+}
@@ -120,6 +120,14 @@ func AbsoluteFilename(dt DocType, typ string, index int) string {
 		}
 	case TableType, TableTypeStrict, TableContentType:
 		return fmt.Sprintf("xl/tables/table%d.xml", index)
+	case PivotTableType, PivotTableTypeStrict, PivotTableContentType:
+		return fmt.Sprintf("xl/pivotTables/pivotTable%d.xml", index)
+	case PivotCacheDefinitionType, PivotCacheDefinitionTypeStrict, PivotCacheDefinitionContentType:
+		return fmt.Sprintf("xl/pivotCache/pivotCacheDefinition%d.xml", index)
+	case PivotCacheRecordsType, PivotCacheRecordsTypeStrict, PivotCacheRecordsContentType:
+		return fmt.Sprintf("xl/pivotCache/pivotCacheRecords%d.xml", index)
+	case SheetMetadataType, SheetMetadataTypeStrict, SheetMetadataContentType:
+		return "xl/metadata.xml"
 
 	case DrawingType, DrawingTypeStrict, DrawingContentType:
 		switch dt {
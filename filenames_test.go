@@ -55,6 +55,9 @@ func TestSMLFilenames(t *testing.T) {
 		{15, unioffice.ChartType, "xl/charts/chart15.xml"},
 		{12, unioffice.DrawingType, "xl/drawings/drawing12.xml"},
 		{13, unioffice.TableType, "xl/tables/table13.xml"},
+		{3, unioffice.PivotTableType, "xl/pivotTables/pivotTable3.xml"},
+		{2, unioffice.PivotCacheDefinitionType, "xl/pivotCache/pivotCacheDefinition2.xml"},
+		{2, unioffice.PivotCacheRecordsType, "xl/pivotCache/pivotCacheRecords2.xml"},
 		{2, unioffice.CommentsType, "xl/comments2.xml"},
 		{15, unioffice.WorksheetType, "xl/worksheets/sheet15.xml"},
 		{2, unioffice.VMLDrawingType, "xl/drawings/vmlDrawing2.vml"},
@@ -0,0 +1,66 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package presentation
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/unidoc/unioffice/encryption"
+)
+
+// ReadWithPassword reads a presentation that is encrypted with a password.
+// Presentations that aren't encrypted are read as by Read.
+func ReadWithPassword(r io.ReaderAt, size int64, password string) (*Presentation, error) {
+	if !encryption.IsEncrypted(r) {
+		return Read(r, size)
+	}
+	pkg, err := encryption.Decrypt(r, size, password)
+	if err != nil {
+		return nil, err
+	}
+	return Read(bytes.NewReader(pkg), int64(len(pkg)))
+}
+
+// OpenWithPassword opens and reads a presentation from a file (.pptx) that is
+// encrypted with a password.
+func OpenWithPassword(filename, password string) (*Presentation, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %s", filename, err)
+	}
+	defer f.Close()
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %s", filename, err)
+	}
+	return ReadWithPassword(f, fi.Size(), password)
+}
+
+// SaveWithPassword writes the presentation to an io.Writer encrypted with a
+// password, using the agile encryption of current versions of PowerPoint.
+func (p *Presentation) SaveWithPassword(w io.Writer, password string) error {
+	buf := bytes.Buffer{}
+	if err := p.Save(&buf); err != nil {
+		return err
+	}
+	return encryption.Encrypt(w, buf.Bytes(), password, encryption.MethodAgile)
+}
+
+// SaveToFileWithPassword writes the presentation to a file encrypted with a
+// password.
+func (p *Presentation) SaveToFileWithPassword(path, password string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.SaveWithPassword(f, password)
+}
@@ -14,11 +14,22 @@ import (
 	"io/ioutil"
 
 	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/encryption"
 	"github.com/unidoc/unioffice/zippkg"
 )
 
-// Read reads a document from an io.Reader.
+// Read reads a document from an io.Reader.  Encrypted presentations can only
+// be read if they are encrypted with the default password, others must be read
+// with ReadWithPassword.
 func Read(r io.ReaderAt, size int64) (*Presentation, error) {
+	if encryption.IsEncrypted(r) {
+		p, err := ReadWithPassword(r, size, encryption.DefaultPassword)
+		if err == encryption.ErrInvalidPassword {
+			return nil, encryption.ErrEncrypted
+		}
+		return p, err
+	}
+
 	doc := newEmpty()
 
 	td, err := ioutil.TempDir("", "gooxml-pptx")
@@ -23,9 +23,13 @@ const (
 	CustomXMLTypeStrict          = "http://purl.oclc.org/ooxml/officeDocument/relationships/customXml"
 
 	// SML strict
-	WorksheetTypeStrict    = "http://purl.oclc.org/ooxml/officeDocument/relationships/worksheet"
-	SharedStingsTypeStrict = "http://purl.oclc.org/ooxml/officeDocument/relationships/sharedStrings"
-	TableTypeStrict        = "http://purl.oclc.org/ooxml/officeDocument/relationships/table"
+	WorksheetTypeStrict            = "http://purl.oclc.org/ooxml/officeDocument/relationships/worksheet"
+	SharedStingsTypeStrict         = "http://purl.oclc.org/ooxml/officeDocument/relationships/sharedStrings"
+	TableTypeStrict                = "http://purl.oclc.org/ooxml/officeDocument/relationships/table"
+	PivotTableTypeStrict           = "http://purl.oclc.org/ooxml/officeDocument/relationships/pivotTable"
+	PivotCacheDefinitionTypeStrict = "http://purl.oclc.org/ooxml/officeDocument/relationships/pivotCacheDefinition"
+	PivotCacheRecordsTypeStrict    = "http://purl.oclc.org/ooxml/officeDocument/relationships/pivotCacheRecords"
+	SheetMetadataTypeStrict        = "http://purl.oclc.org/ooxml/officeDocument/relationships/sheetMetadata"
 
 	// WML strict
 	HeaderTypeStrict      = "http://purl.oclc.org/ooxml/officeDocument/relationships/header"
@@ -62,15 +66,23 @@ const (
 	CustomXMLType          = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXml"
 
 	// SML
-	WorksheetType            = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet"
-	WorksheetContentType     = "application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"
-	SharedStingsType         = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings"
-	SharedStringsContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"
-	SMLStyleSheetContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"
-	TableType                = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/table"
-	TableContentType         = "application/vnd.openxmlformats-officedocument.spreadsheetml.table+xml"
-	ViewPropertiesType       = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/viewProps"
-	TableStylesType          = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/tableStyles"
+	WorksheetType                   = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet"
+	WorksheetContentType            = "application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"
+	SharedStingsType                = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings"
+	SharedStringsContentType        = "application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"
+	SMLStyleSheetContentType        = "application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"
+	TableType                       = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/table"
+	TableContentType                = "application/vnd.openxmlformats-officedocument.spreadsheetml.table+xml"
+	ViewPropertiesType              = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/viewProps"
+	TableStylesType                 = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/tableStyles"
+	PivotTableType                  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/pivotTable"
+	PivotTableContentType           = "application/vnd.openxmlformats-officedocument.spreadsheetml.pivotTable+xml"
+	PivotCacheDefinitionType        = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/pivotCacheDefinition"
+	PivotCacheDefinitionContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.pivotCacheDefinition+xml"
+	PivotCacheRecordsType           = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/pivotCacheRecords"
+	PivotCacheRecordsContentType    = "application/vnd.openxmlformats-officedocument.spreadsheetml.pivotCacheRecords+xml"
+	SheetMetadataType               = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/sheetMetadata"
+	SheetMetadataContentType        = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheetMetadata+xml"
 
 	// WML
 	HeaderType      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/header"
@@ -0,0 +1,820 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/formula"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// Excel's defaults for iterative calculation.
+const (
+	defaultIterateCount = 100
+	defaultIterateDelta = 0.001
+)
+
+// calcKey identifies a cell in a workbook.
+type calcKey struct {
+	ws  *sml.Worksheet
+	ref string
+}
+
+type calcState byte
+
+const (
+	calcDirty calcState = iota
+	calcEvaluating
+	calcDone
+)
+
+// calcNode is a formula cell tracked by the calculation engine.
+type calcNode struct {
+	key   calcKey
+	sheet Sheet
+	x     *sml.CT_Cell
+	expr  formula.Expression
+	// text is the formula, which is the formula of the master cell for cells
+	// that share a formula
+	text           string
+	colOff, rowOff uint32
+	state          calcState
+	result         formula.Result
+	precedents     map[calcKey]struct{}
+	// dynamic is true for dynamic array formulas, whose results spill into
+	// the cells below and to the right of them
+	dynamic bool
+	// spilled is the cells that the result of a dynamic array formula
+	// spilled into when it was last evaluated
+	spilled []calcKey
+	// volatile is true for formulas that call volatile functions, which are
+	// recalculated even if their precedents haven't changed
+	volatile bool
+}
+
+// arrayMember is a cell that receives part of the result of an array formula,
+// or that the result of a dynamic array formula spills into.
+type arrayMember struct {
+	node     *calcNode
+	row, col int
+}
+
+// calcEngine evaluates the formulas in a workbook.  Each formula is parsed
+// once, and the cells that each formula reads are recorded as it is evaluated
+// so that after a cell changes, only the formulas that depend on it need to be
+// recalculated.  Evaluating formulas depth first as their precedents are read
+// results in formulas being evaluated in topological order.
+type calcEngine struct {
+	wb         *Workbook
+	ev         formula.Evaluator
+	parsed     map[string]formula.Expression
+	isVolatile map[string]bool
+	cells      map[calcKey]*sml.CT_Cell
+	nodes      map[calcKey]*calcNode
+	arrays     map[calcKey]arrayMember
+	dynamic    map[calcKey]*calcNode
+	volatile   map[calcKey]*calcNode
+	spills     map[calcKey]arrayMember
+	blocked    map[calcKey]*calcNode
+	dependents map[calcKey]map[calcKey]struct{}
+	dirty      map[calcKey]*sml.CT_Cell
+	stack      []*calcNode
+	circular   map[calcKey]struct{}
+	iterate    bool
+	rebuild    bool
+}
+
+func newCalcEngine(wb *Workbook) *calcEngine {
+	return &calcEngine{wb: wb}
+}
+
+// build scans the workbook for formula cells, discarding any previously
+// computed state.  Formulas are evaluated with the given evaluator, or with a
+// new evaluator if it is nil.
+func (e *calcEngine) build(ev formula.Evaluator) {
+	if ev == nil {
+		ev = formula.NewEvaluator()
+	}
+	e.ev = ev
+	e.parsed = map[string]formula.Expression{}
+	e.isVolatile = map[string]bool{}
+	e.cells = map[calcKey]*sml.CT_Cell{}
+	e.nodes = map[calcKey]*calcNode{}
+	e.arrays = map[calcKey]arrayMember{}
+	e.dynamic = map[calcKey]*calcNode{}
+	e.volatile = map[calcKey]*calcNode{}
+	e.spills = map[calcKey]arrayMember{}
+	e.blocked = map[calcKey]*calcNode{}
+	e.dependents = map[calcKey]map[calcKey]struct{}{}
+	e.dirty = map[calcKey]*sml.CT_Cell{}
+	e.circular = map[calcKey]struct{}{}
+	e.rebuild = false
+	e.iterate = e.wb.x.CalcPr != nil && e.wb.x.CalcPr.IterateAttr != nil && *e.wb.x.CalcPr.IterateAttr
+
+	for _, s := range e.wb.Sheets() {
+		// shared formulas are stored once on the master cell, and the other
+		// cells only store the shared index
+		masters := map[uint32]*sml.CT_Cell{}
+		for _, r := range s.x.SheetData.Row {
+			for _, c := range r.C {
+				if c.RAttr == nil {
+					continue
+				}
+				e.cells[calcKey{s.x, normalizeRef(*c.RAttr)}] = c
+				if isSharedMaster(c) && c.F.SiAttr != nil {
+					masters[*c.F.SiAttr] = c
+				}
+			}
+		}
+		for _, r := range s.x.SheetData.Row {
+			for _, c := range r.C {
+				if c.RAttr != nil && c.F != nil {
+					e.addNode(s, c, masters)
+				}
+			}
+		}
+	}
+}
+
+func normalizeRef(ref string) string {
+	cr, err := reference.ParseCellReference(ref)
+	if err != nil {
+		return ref
+	}
+	return fmt.Sprintf("%s%d", cr.Column, cr.RowIdx)
+}
+
+// parse returns the parsed form of a formula, parsing each distinct formula
+// only once.
+func (e *calcEngine) parse(f string) formula.Expression {
+	if expr, ok := e.parsed[f]; ok {
+		return expr
+	}
+	expr := formula.ParseString(f)
+	e.parsed[f] = expr
+	return expr
+}
+
+func (e *calcEngine) addNode(s Sheet, c *sml.CT_Cell, masters map[uint32]*sml.CT_Cell) {
+	key := calcKey{s.x, normalizeRef(*c.RAttr)}
+	n := &calcNode{key: key, sheet: s, x: c, result: cachedResult(c)}
+	text := c.F.Content
+	if c.F.TAttr == sml.ST_CellFormulaTypeShared && text == "" {
+		if c.F.SiAttr == nil || masters[*c.F.SiAttr] == nil {
+			return
+		}
+		m := masters[*c.F.SiAttr]
+		from, err := reference.ParseCellReference(*m.RAttr)
+		if err != nil {
+			return
+		}
+		to, err := reference.ParseCellReference(key.ref)
+		if err != nil {
+			return
+		}
+		text = m.F.Content
+		n.colOff = to.ColumnIdx - from.ColumnIdx
+		n.rowOff = to.RowIdx - from.RowIdx
+	}
+	n.expr = e.parse(text)
+	n.text = text
+	e.nodes[key] = n
+	n.dynamic = isDynamicArray(c)
+	if n.dynamic {
+		e.dynamic[key] = n
+	}
+	volatile, ok := e.isVolatile[text]
+	if !ok {
+		volatile = formula.RegistryOf(e.ev).IsVolatile(text)
+		e.isVolatile[text] = volatile
+	}
+	if volatile {
+		n.volatile = true
+		e.volatile[key] = n
+	}
+
+	if c.F.TAttr == sml.ST_CellFormulaTypeArray && c.F.RefAttr != nil {
+		from, to, err := reference.ParseRangeReference(*c.F.RefAttr)
+		if err != nil {
+			return
+		}
+		for r := from.RowIdx; r <= to.RowIdx; r++ {
+			for col := from.ColumnIdx; col <= to.ColumnIdx; col++ {
+				ref := fmt.Sprintf("%s%d", reference.IndexToColumn(col), r)
+				if ref == key.ref {
+					continue
+				}
+				m := arrayMember{n, int(r - from.RowIdx), int(col - from.ColumnIdx)}
+				if n.dynamic {
+					// the range a dynamic array formula spilled into when it
+					// was last calculated, so the values there aren't
+					// mistaken for values that block it
+					e.spills[calcKey{s.x, ref}] = m
+					n.spilled = append(n.spilled, calcKey{s.x, ref})
+				} else {
+					e.arrays[calcKey{s.x, ref}] = m
+				}
+			}
+		}
+	}
+}
+
+// isDynamicArray returns true if a cell contains a dynamic array formula.
+// These are stored as array formulas with cell metadata.
+func isDynamicArray(c *sml.CT_Cell) bool {
+	return c.F != nil && c.F.TAttr == sml.ST_CellFormulaTypeArray && c.CmAttr != nil
+}
+
+// removeNode stops tracking a formula cell, returning the cells that its
+// result spilled into, which are now empty.
+func (e *calcEngine) removeNode(key calcKey) []calcKey {
+	n, ok := e.nodes[key]
+	if !ok {
+		return nil
+	}
+	e.clearPrecedents(n)
+	delete(e.nodes, key)
+	delete(e.dynamic, key)
+	delete(e.volatile, key)
+	for k, m := range e.arrays {
+		if m.node == n {
+			delete(e.arrays, k)
+		}
+	}
+	spilled := n.spilled
+	e.releaseSpill(n)
+	return spilled
+}
+
+// cachedResult returns the value last computed for a formula cell, which is
+// used as the starting point for iterative calculation.
+func cachedResult(c *sml.CT_Cell) formula.Result {
+	if c.V == nil {
+		return formula.MakeNumberResult(0)
+	}
+	switch c.TAttr {
+	case sml.ST_CellTypeN, sml.ST_CellTypeUnset:
+		if f, err := strconv.ParseFloat(*c.V, 64); err == nil {
+			return formula.MakeNumberResult(f)
+		}
+	case sml.ST_CellTypeB:
+		return formula.MakeBoolResult(*c.V == "1")
+	case sml.ST_CellTypeE:
+		t, _ := formula.ParseErrorType(*c.V)
+		return formula.MakeErrorResultType(t, "")
+	}
+	return formula.MakeStringResult(*c.V)
+}
+
+func (e *calcEngine) clearPrecedents(n *calcNode) {
+	for p := range n.precedents {
+		delete(e.dependents[p], n.key)
+		if len(e.dependents[p]) == 0 {
+			delete(e.dependents, p)
+		}
+	}
+	n.precedents = nil
+}
+
+// addPrecedent records that the node read the value of a cell.
+func (e *calcEngine) addPrecedent(n *calcNode, key calcKey) {
+	if n.precedents == nil {
+		n.precedents = map[calcKey]struct{}{}
+	}
+	n.precedents[key] = struct{}{}
+	deps, ok := e.dependents[key]
+	if !ok {
+		deps = map[calcKey]struct{}{}
+		e.dependents[key] = deps
+	}
+	deps[n.key] = struct{}{}
+}
+
+// value returns the value of a cell, evaluating it first if it is a formula.
+func (e *calcEngine) value(s Sheet, key calcKey) formula.Result {
+	if n, ok := e.nodes[key]; ok {
+		return e.evaluate(n)
+	}
+	if m, ok := e.arrays[key]; ok {
+		res := e.evaluate(m.node)
+		if res.Type == formula.ResultTypeArray {
+			if m.row < len(res.ValueArray) && m.col < len(res.ValueArray[m.row]) {
+				return res.ValueArray[m.row][m.col]
+			}
+			return formula.MakeErrorResultType(formula.ErrorTypeNA, "")
+		}
+		if res.Type == formula.ResultTypeList && m.row == 0 && m.col < len(res.ValueList) {
+			return res.ValueList[m.col]
+		}
+	}
+	if m, ok := e.spillMember(key); ok {
+		return spillValue(m)
+	}
+	if c, ok := e.cells[key]; ok {
+		return cellResult(Cell{w: e.wb, s: s.x, x: c})
+	}
+	return formula.MakeEmptyResult()
+}
+
+// evaluate computes the value of a formula cell, first evaluating any formula
+// cells that it reads.
+func (e *calcEngine) evaluate(n *calcNode) formula.Result {
+	switch n.state {
+	case calcDone:
+		return n.result
+	case calcEvaluating:
+		// every cell on the stack back to this one is part of the cycle
+		for i := len(e.stack) - 1; i >= 0; i-- {
+			e.circular[e.stack[i].key] = struct{}{}
+			if e.stack[i] == n {
+				break
+			}
+		}
+		if e.iterate {
+			// use the value from the previous iteration
+			return n.result
+		}
+		return formula.MakeErrorResult("circular reference to " + e.name(n.key))
+	}
+
+	n.state = calcEvaluating
+	e.clearPrecedents(n)
+	e.stack = append(e.stack, n)
+	res := formula.MakeErrorResult("unable to parse formula in " + e.name(n.key))
+	if n.expr != nil {
+		ctx := &calcContext{e: e, s: n.sheet, node: n, colOff: n.colOff, rowOff: n.rowOff}
+		res = n.expr.Eval(ctx, e.ev)
+	}
+	if n.dynamic {
+		res = e.spill(n, res)
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+	n.result = res
+	n.state = calcDone
+	return res
+}
+
+func (e *calcEngine) name(key calcKey) string {
+	for _, s := range e.wb.Sheets() {
+		if s.x == key.ws {
+			name := s.Name()
+			if reference.SheetNameNeedsQuotes(name) {
+				name = reference.QuoteSheetName(name)
+			}
+			return name + "!" + key.ref
+		}
+	}
+	return key.ref
+}
+
+// calculate evaluates the nodes, repeating the calculation of any circular
+// references if iterative calculation is enabled.
+func (e *calcEngine) calculate(nodes []*calcNode) {
+	for _, n := range nodes {
+		n.state = calcDirty
+	}
+	for _, n := range nodes {
+		e.evaluate(n)
+	}
+	if !e.iterate || len(e.circular) == 0 {
+		return
+	}
+
+	count, delta := uint32(defaultIterateCount), defaultIterateDelta
+	if cp := e.wb.x.CalcPr; cp.IterateCountAttr != nil {
+		count = *cp.IterateCountAttr
+	}
+	if cp := e.wb.x.CalcPr; cp.IterateDeltaAttr != nil {
+		delta = *cp.IterateDeltaAttr
+	}
+	keys := []calcKey{}
+	for k := range e.circular {
+		keys = append(keys, k)
+	}
+	affected := e.sortedNodes(e.affectedBy(keys))
+	for i := uint32(1); i < count; i++ {
+		prev := map[*calcNode]formula.Result{}
+		for _, n := range affected {
+			prev[n] = n.result
+			n.state = calcDirty
+		}
+		for _, n := range affected {
+			e.evaluate(n)
+		}
+		maxChange := 0.0
+		for _, n := range affected {
+			if _, ok := e.circular[n.key]; ok {
+				maxChange = math.Max(maxChange, resultChange(prev[n], n.result))
+			}
+		}
+		if maxChange < delta {
+			break
+		}
+	}
+}
+
+// resultChange returns the magnitude of the change between two results.
+func resultChange(a, b formula.Result) float64 {
+	if a.Type == formula.ResultTypeNumber && b.Type == formula.ResultTypeNumber {
+		return math.Abs(a.ValueNumber - b.ValueNumber)
+	}
+	if a.Type == b.Type && a.Value() == b.Value() {
+		return 0
+	}
+	return math.Inf(1)
+}
+
+// affectedBy returns the formula cells that are the given cells, or that
+// depend on them directly or indirectly.
+func (e *calcEngine) affectedBy(keys []calcKey) map[calcKey]*calcNode {
+	ret := map[calcKey]*calcNode{}
+	queue := append([]calcKey{}, keys...)
+	seen := map[calcKey]struct{}{}
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		if n, ok := e.nodes[k]; ok {
+			ret[k] = n
+		}
+		for d := range e.dependents[k] {
+			queue = append(queue, d)
+		}
+		// cells in an array formula's range depend on the formula
+		if n, ok := e.nodes[k]; ok {
+			for ak, m := range e.arrays {
+				if m.node == n {
+					queue = append(queue, ak)
+				}
+			}
+			queue = append(queue, n.spilled...)
+		}
+	}
+	return ret
+}
+
+// sortedNodes returns nodes in a stable order so that calculation is
+// deterministic.
+func (e *calcEngine) sortedNodes(m map[calcKey]*calcNode) []*calcNode {
+	keys := make([]calcKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	e.sortKeys(keys)
+	ret := make([]*calcNode, 0, len(m))
+	for _, k := range keys {
+		ret = append(ret, m[k])
+	}
+	return ret
+}
+
+// sortKeys sorts cells by sheet order and then row and column.
+func (e *calcEngine) sortKeys(keys []calcKey) {
+	order := map[*sml.Worksheet]int{}
+	for i, ws := range e.wb.xws {
+		order[ws] = i
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.ws != b.ws {
+			return order[a.ws] < order[b.ws]
+		}
+		ca, _ := reference.ParseCellReference(a.ref)
+		cb, _ := reference.ParseCellReference(b.ref)
+		if ca.RowIdx != cb.RowIdx {
+			return ca.RowIdx < cb.RowIdx
+		}
+		return ca.ColumnIdx < cb.ColumnIdx
+	})
+}
+
+// store writes the computed value of a formula cell to the cell's cached
+// value.
+func (e *calcEngine) store(n *calcNode) {
+	c := n.x
+	res := n.result
+	if n.dynamic {
+		e.storeSpill(n)
+	}
+	if res.Type == formula.ResultTypeLambda {
+		// a LAMBDA function must be called to have a value
+		res = formula.MakeErrorResultType(formula.ErrorTypeCalc, "formula returns a LAMBDA function")
+	}
+	switch res.Type {
+	case formula.ResultTypeError:
+		unioffice.Log("error evaulating formula %s in %s: %s", c.F.Content, e.name(n.key), res.ErrorMessage)
+		if _, ok := e.circular[n.key]; ok {
+			// there's no error value for a circular reference
+			c.V = nil
+			c.TAttr = sml.ST_CellTypeUnset
+			return
+		}
+	case formula.ResultTypeEmpty:
+		// a reference to an empty cell evaluates to zero
+		res = formula.MakeNumberResult(0)
+	case formula.ResultTypeArray, formula.ResultTypeList:
+		// array formulas expand their result into the surrounding cells,
+		// other formulas only store the first value
+		arr := res
+		if arr.Type == formula.ResultTypeList {
+			arr = formula.MakeArrayResult([][]formula.Result{arr.ValueList})
+		}
+		if c.F.TAttr == sml.ST_CellFormulaTypeArray && !n.dynamic {
+			n.sheet.setArray(n.key.ref, arr)
+		}
+		if len(arr.ValueArray) == 0 || len(arr.ValueArray[0]) == 0 {
+			res = formula.MakeErrorResultType(formula.ErrorTypeNA, "")
+		} else {
+			res = arr.ValueArray[0][0]
+		}
+		if res.Type == formula.ResultTypeEmpty {
+			res = formula.MakeNumberResult(0)
+		}
+	}
+	setCachedResult(c, res)
+}
+
+// setCachedResult writes a single value to the cached value of a formula cell,
+// with the cell type of the value.
+func setCachedResult(c *sml.CT_Cell, res formula.Result) {
+	switch res.Type {
+	case formula.ResultTypeNumber:
+		c.TAttr = sml.ST_CellTypeN
+		c.V = unioffice.String(res.Value())
+	case formula.ResultTypeBool:
+		c.TAttr = sml.ST_CellTypeB
+		c.V = unioffice.String(strconv.Itoa(b2i(res.ValueBool)))
+	case formula.ResultTypeError:
+		c.TAttr = sml.ST_CellTypeE
+		c.V = unioffice.String(res.ValueString)
+	default:
+		c.TAttr = sml.ST_CellTypeStr
+		c.V = unioffice.String(res.Value())
+	}
+}
+
+// recalculate rebuilds the dependency graph and recalculates every formula
+// with an evaluator, storing the results for formulas on the given sheet, or
+// on every sheet if the sheet is nil.
+func (e *calcEngine) recalculate(ws *sml.Worksheet, ev formula.Evaluator) {
+	e.build(ev)
+	nodes := map[calcKey]*calcNode{}
+	for k, n := range e.nodes {
+		if ws == nil || k.ws == ws {
+			nodes[k] = n
+		}
+	}
+	sorted := e.sortedNodes(nodes)
+	e.calculate(sorted)
+	for _, n := range sorted {
+		e.store(n)
+	}
+}
+
+// recalculateDirty recalculates only the formulas affected by cells that
+// have changed since the last calculation.
+func (e *calcEngine) recalculateDirty() {
+	if e.nodes == nil {
+		e.recalculate(nil, e.ev)
+		return
+	}
+	keys := []calcKey{}
+	if e.rebuild {
+		e.recalculate(nil, e.ev)
+		return
+	}
+	for k, c := range e.dirty {
+		if isSharedMaster(c) {
+			// shared formulas span many cells, so start over
+			e.recalculate(nil, e.ev)
+			return
+		}
+		keys = append(keys, e.removeNode(k)...)
+		if n, ok := e.blocked[k]; ok {
+			// the formula may be able to spill now
+			delete(e.blocked, k)
+			keys = append(keys, n.key)
+		}
+		e.cells[k] = c
+		if c.F != nil {
+			s := e.sheetFor(k.ws)
+			if !s.IsValid() {
+				continue
+			}
+			e.addNode(s, c, nil)
+		}
+		keys = append(keys, k)
+	}
+	e.dirty = map[calcKey]*sml.CT_Cell{}
+	e.circular = map[calcKey]struct{}{}
+	for k := range e.volatile {
+		keys = append(keys, k)
+	}
+
+	affected := e.affectedBy(keys)
+	sorted := e.sortedNodes(affected)
+	before := map[*calcNode][]calcKey{}
+	for _, n := range sorted {
+		if n.dynamic {
+			before[n] = n.spilled
+		}
+	}
+	e.calculate(sorted)
+
+	// formulas that read cells that a spill range grew or shrank over also
+	// need to be recalculated
+	changed := []calcKey{}
+	for n, prev := range before {
+		if !sameKeys(prev, n.spilled) {
+			changed = append(changed, prev...)
+			changed = append(changed, n.spilled...)
+		}
+	}
+	if len(changed) > 0 {
+		more := map[calcKey]*calcNode{}
+		for k, n := range e.affectedBy(changed) {
+			if _, ok := affected[k]; !ok {
+				more[k] = n
+			}
+		}
+		moreSorted := e.sortedNodes(more)
+		e.calculate(moreSorted)
+		sorted = append(sorted, moreSorted...)
+	}
+	for _, n := range sorted {
+		e.store(n)
+	}
+}
+
+func sameKeys(a, b []calcKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *calcEngine) sheetFor(ws *sml.Worksheet) Sheet {
+	for _, s := range e.wb.Sheets() {
+		if s.x == ws {
+			return s
+		}
+	}
+	return Sheet{}
+}
+
+// markDirty records that a cell's value or formula has changed.
+func (e *calcEngine) markDirty(ws *sml.Worksheet, c *sml.CT_Cell) {
+	if e.nodes == nil || c.RAttr == nil {
+		return
+	}
+	key := calcKey{ws, normalizeRef(*c.RAttr)}
+	e.dirty[key] = c
+	// a value entered in the spill range of a dynamic array formula blocks it,
+	// and the formula no longer spills into the rest of the range
+	if m, ok := e.spills[key]; ok {
+		n := m.node
+		e.releaseSpill(n)
+		n.x.F.RefAttr = unioffice.String(n.key.ref)
+		e.dirty[n.key] = n.x
+	}
+	// the cell's formula is about to be cleared, so changes to the master cell
+	// of a shared formula have to be noted now
+	if isSharedMaster(c) {
+		e.rebuild = true
+	}
+}
+
+func isSharedMaster(c *sml.CT_Cell) bool {
+	return c.F != nil && c.F.TAttr == sml.ST_CellFormulaTypeShared && c.F.Content != ""
+}
+
+// circularReferences returns the cells that were part of a circular reference
+// in the last calculation.
+func (e *calcEngine) circularReferences() []string {
+	nodes := map[calcKey]*calcNode{}
+	for k := range e.circular {
+		if n, ok := e.nodes[k]; ok {
+			nodes[k] = n
+		}
+	}
+	ret := []string{}
+	for _, n := range e.sortedNodes(nodes) {
+		ret = append(ret, e.name(n.key))
+	}
+	return ret
+}
+
+// calcContext is the formula evaluation context used by the calculation
+// engine.  It records each cell read as a precedent of the formula being
+// evaluated.
+type calcContext struct {
+	e              *calcEngine
+	s              Sheet
+	node           *calcNode
+	colOff, rowOff uint32
+}
+
+// key returns the cell referred to, adjusted by the offset of a shared formula.
+func (c *calcContext) key(ref string) (calcKey, error) {
+	cr, err := reference.ParseCellReference(ref)
+	if err != nil {
+		return calcKey{}, err
+	}
+	if c.colOff != 0 && !cr.AbsoluteColumn {
+		cr.ColumnIdx += c.colOff
+		cr.Column = reference.IndexToColumn(cr.ColumnIdx)
+	}
+	if c.rowOff != 0 && !cr.AbsoluteRow {
+		cr.RowIdx += c.rowOff
+	}
+	return calcKey{c.s.x, fmt.Sprintf("%s%d", cr.Column, cr.RowIdx)}, nil
+}
+
+func (c *calcContext) Cell(ref string, ev formula.Evaluator) formula.Result {
+	key, err := c.key(ref)
+	if err != nil {
+		return formula.MakeErrorResult(fmt.Sprintf("error parsing %s: %s", ref, err))
+	}
+	c.e.addPrecedent(c.node, key)
+	res := c.e.value(c.s, key)
+	if n, ok := c.e.nodes[key]; ok && n.dynamic {
+		// only a spill range reference (e.g. A1#) refers to the whole result
+		return firstValue(res)
+	}
+	return res
+}
+
+func (c *calcContext) Spill(ref string, ev formula.Evaluator) formula.Result {
+	key, err := c.key(ref)
+	if err != nil {
+		return formula.MakeErrorResult(fmt.Sprintf("error parsing %s: %s", ref, err))
+	}
+	c.e.addPrecedent(c.node, key)
+	n, ok := c.e.nodes[key]
+	if !ok || !n.dynamic {
+		return formula.MakeErrorResultType(formula.ErrorTypeRef, ref+" doesn't contain a dynamic array formula")
+	}
+	return c.e.evaluate(n)
+}
+
+func (c *calcContext) CurrentCell() string {
+	return c.node.key.ref
+}
+
+func (c *calcContext) Formula(ref string) string {
+	key, err := c.key(ref)
+	if err != nil {
+		return ""
+	}
+	if n, ok := c.e.nodes[key]; ok {
+		return n.text
+	}
+	return ""
+}
+
+func (c *calcContext) Sheet(name string) formula.Context {
+	for _, s := range c.e.wb.Sheets() {
+		if strings.EqualFold(s.Name(), name) {
+			return &calcContext{e: c.e, s: s, node: c.node, colOff: c.colOff, rowOff: c.rowOff}
+		}
+	}
+	return formula.InvalidReferenceContext
+}
+
+func (c *calcContext) NamedRange(name string) formula.Reference {
+	return namedRangeReference(c.e.wb, name)
+}
+
+func (c *calcContext) Table(name string) (formula.Table, bool) {
+	return formulaTable(c.e.wb, name, c.node.sheet, c.node.key.ref)
+}
+
+func (c *calcContext) SetOffset(col, row uint32) {
+	c.colOff = col
+	c.rowOff = row
+}
+
+func (c *calcContext) GetEpoch() time.Time {
+	return c.e.wb.Epoch()
+}
@@ -0,0 +1,263 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet_test
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet"
+	"github.com/unidoc/unioffice/spreadsheet/formula"
+)
+
+func expectNumber(t *testing.T, c spreadsheet.Cell, exp float64) {
+	// TODO: uncomment once we quit building on 1.8
+	//t.Helper()
+	got, err := c.GetValueAsNumber()
+	if err != nil {
+		t.Errorf("expected %s to be a number, got error %s", c.Reference(), err)
+		return
+	}
+	if math.Abs(got-exp) > 1e-6 {
+		t.Errorf("expected %s = %f, got %f", c.Reference(), exp, got)
+	}
+}
+
+func TestRecalculateChained(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	data := wb.AddSheet()
+	calc := wb.AddSheet()
+	data.Cell("A1").SetNumber(1)
+	data.Cell("A2").SetNumber(2)
+	data.Cell("A3").SetNumber(3)
+	wb.AddDefinedName("Values", data.RangeReference("A1:A3"))
+
+	// formulas refer to cells that are calculated later in the sheet order
+	calc.Cell("A1").SetFormulaRaw("A2*2")
+	calc.Cell("A2").SetFormulaRaw("SUM(Values)+A3")
+	calc.Cell("A3").SetFormulaRaw("'Sheet 1'!A3*10")
+
+	wb.RecalculateFormulas()
+	expectNumber(t, calc.Cell("A3"), 30)
+	expectNumber(t, calc.Cell("A2"), 36)
+	expectNumber(t, calc.Cell("A1"), 72)
+
+	data.Cell("A3").SetNumber(4)
+	wb.RecalculateDirty()
+	expectNumber(t, calc.Cell("A3"), 40)
+	expectNumber(t, calc.Cell("A2"), 47)
+	expectNumber(t, calc.Cell("A1"), 94)
+
+	// replacing a formula with a value updates its dependents
+	calc.Cell("A2").SetNumber(1)
+	wb.RecalculateDirty()
+	expectNumber(t, calc.Cell("A1"), 2)
+
+	// adding a new formula computes it
+	calc.Cell("B1").SetFormulaRaw("A1+1")
+	wb.RecalculateDirty()
+	expectNumber(t, calc.Cell("B1"), 3)
+}
+
+func TestRecalculateDirtyOnlyDependents(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetNumber(1)
+	sheet.Cell("B1").SetFormulaRaw("A1+1")
+	sheet.Cell("C1").SetFormulaRaw("A2+1")
+	wb.RecalculateFormulas()
+
+	// an unrelated formula is left alone
+	sheet.Cell("C1").X().V = unioffice.String("100")
+	sheet.Cell("A1").SetNumber(5)
+	wb.RecalculateDirty()
+	expectNumber(t, sheet.Cell("B1"), 6)
+	expectNumber(t, sheet.Cell("C1"), 100)
+}
+
+func TestRecalculateShared(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	for i := 1; i <= 3; i++ {
+		sheet.Row(uint32(i)).Cell("A").SetNumber(float64(i))
+	}
+	sheet.Cell("B1").SetFormulaShared("A1*2", 2, 0)
+	sheet.Cell("C1").SetFormulaRaw("SUM(B1:B3)")
+	wb.RecalculateFormulas()
+	expectNumber(t, sheet.Cell("B3"), 6)
+	expectNumber(t, sheet.Cell("C1"), 12)
+
+	sheet.Cell("A2").SetNumber(10)
+	wb.RecalculateDirty()
+	expectNumber(t, sheet.Cell("B2"), 20)
+	expectNumber(t, sheet.Cell("C1"), 28)
+}
+
+func TestRecalculateBoolAndError(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetNumber(0)
+	sheet.Cell("B1").SetFormulaRaw("A1=0")
+	sheet.Cell("B2").SetFormulaRaw("1/A1")
+	sheet.Cell("B3").SetFormulaRaw("ISLOGICAL(B1)")
+	sheet.Cell("B4").SetFormulaRaw("ERROR.TYPE(B2)")
+	wb.RecalculateFormulas()
+
+	b1 := sheet.Cell("B1").X()
+	if b1.TAttr != sml.ST_CellTypeB || b1.V == nil || *b1.V != "1" {
+		t.Errorf("expected B1 to be cached as boolean true")
+	}
+	b2 := sheet.Cell("B2").X()
+	if b2.TAttr != sml.ST_CellTypeE || b2.V == nil || *b2.V != "#DIV/0!" {
+		t.Errorf("expected B2 to be cached as #DIV/0!")
+	}
+	if got := sheet.Cell("B3").GetFormattedValue(); got != "TRUE" {
+		t.Errorf("expected B3 = TRUE, got %s", got)
+	}
+	expectNumber(t, sheet.Cell("B4"), 2)
+
+	sheet.Cell("A1").SetNumber(2)
+	wb.RecalculateDirty()
+	if got := sheet.Cell("B1").GetFormattedValue(); got != "FALSE" {
+		t.Errorf("expected B1 = FALSE, got %s", got)
+	}
+	expectNumber(t, sheet.Cell("B2"), 0.5)
+}
+
+func TestRecalculateWithEvaluator(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetNumber(1)
+	sheet.Cell("B1").SetFormulaRaw("TICK()")
+	sheet.Cell("C1").SetFormulaRaw("A1*10")
+
+	ticks := 0
+	reg := formula.NewRegistry()
+	reg.RegisterFunction("TICK", func(args []formula.Result) formula.Result {
+		ticks++
+		return formula.MakeNumberResult(float64(ticks))
+	})
+	reg.RegisterFunctionInfo("TICK", formula.FunctionInfo{MinArgs: 0, MaxArgs: 0, Volatile: true})
+	wb.RecalculateFormulasWith(formula.NewEvaluatorWithRegistry(reg))
+	expectNumber(t, sheet.Cell("B1"), 1)
+
+	// volatile formulas are recalculated even though their precedents haven't
+	// changed
+	sheet.Cell("A1").SetNumber(2)
+	wb.RecalculateDirty()
+	expectNumber(t, sheet.Cell("B1"), 2)
+	expectNumber(t, sheet.Cell("C1"), 20)
+}
+
+func TestRecalculateCircular(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetFormulaRaw("B1+1")
+	sheet.Cell("B1").SetFormulaRaw("A1+1")
+	sheet.Cell("C1").SetFormulaRaw("1+1")
+	wb.RecalculateFormulas()
+
+	exp := []string{"'Sheet 1'!A1", "'Sheet 1'!B1"}
+	if got := wb.CircularReferences(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected circular references %v, got %v", exp, got)
+	}
+	if sheet.Cell("A1").X().V != nil {
+		t.Errorf("expected no value for circular reference")
+	}
+	expectNumber(t, sheet.Cell("C1"), 2)
+
+	// breaking the cycle clears it
+	sheet.Cell("B1").SetNumber(1)
+	wb.RecalculateDirty()
+	if got := wb.CircularReferences(); len(got) != 0 {
+		t.Errorf("expected no circular references, got %v", got)
+	}
+	expectNumber(t, sheet.Cell("A1"), 2)
+}
+
+func TestRecalculateIterative(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	wb.X().CalcPr = sml.NewCT_CalcPr()
+	wb.X().CalcPr.IterateAttr = unioffice.Bool(true)
+	wb.X().CalcPr.IterateDeltaAttr = unioffice.Float64(1e-9)
+	sheet := wb.AddSheet()
+
+	// converges to 2
+	sheet.Cell("A1").SetFormulaRaw("A1/2+1")
+	sheet.Cell("B1").SetFormulaRaw("A1*10")
+	wb.RecalculateFormulas()
+	expectNumber(t, sheet.Cell("A1"), 2)
+	expectNumber(t, sheet.Cell("B1"), 20)
+
+	// the iteration count limits the number of calculations
+	wb.X().CalcPr.IterateCountAttr = unioffice.Uint32(3)
+	sheet.Cell("A2").SetFormulaRaw("A2+1")
+	wb.RecalculateFormulas()
+	expectNumber(t, sheet.Cell("A2"), 3)
+}
+
+func TestRecalculateSpill(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetFormulaDynamicArray("_xlfn.SEQUENCE(3)")
+	sheet.Cell("B1").SetFormulaRaw("SUM(A1#)")
+	wb.RecalculateFormulas()
+	expectNumber(t, sheet.Cell("A1"), 1)
+	expectNumber(t, sheet.Cell("A3"), 3)
+	expectNumber(t, sheet.Cell("B1"), 6)
+	if got := *sheet.Cell("A1").X().F.RefAttr; got != "A1:A3" {
+		t.Errorf("expected spill range A1:A3, got %s", got)
+	}
+	if sheet.Cell("A1").X().CmAttr == nil {
+		t.Errorf("expected cell metadata for dynamic array formula")
+	}
+
+	// a value in the spill range blocks the formula
+	sheet.Cell("A2").SetNumber(10)
+	wb.RecalculateDirty()
+	if got := sheet.Cell("A1").GetFormattedValue(); got != "#SPILL!" {
+		t.Errorf("expected #SPILL! for blocked spill, got %s", got)
+	}
+	if got := sheet.Cell("A3").GetFormattedValue(); got != "" {
+		t.Errorf("expected A3 to be cleared, got %s", got)
+	}
+
+	// and clearing it lets it spill again
+	sheet.Cell("A2").Clear()
+	wb.RecalculateDirty()
+	expectNumber(t, sheet.Cell("A2"), 2)
+	expectNumber(t, sheet.Cell("B1"), 6)
+
+	// the metadata marking the formula as a dynamic array is saved
+	buf := bytes.Buffer{}
+	if err := wb.Save(&buf); err != nil {
+		t.Fatalf("error saving: %s", err)
+	}
+	rd, err := spreadsheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading: %s", err)
+	}
+	defer rd.Close()
+	sheet = rd.Sheets()[0]
+	sheet.Cell("A1").SetFormulaDynamicArray("_xlfn.SEQUENCE(4)")
+	rd.RecalculateFormulas()
+	expectNumber(t, sheet.Cell("A4"), 4)
+	expectNumber(t, sheet.Cell("B1"), 10)
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/unidoc/unioffice/common"
 	"github.com/unidoc/unioffice/schema/soo/sml"
 	"github.com/unidoc/unioffice/spreadsheet/format"
+	"github.com/unidoc/unioffice/spreadsheet/formula"
 	"github.com/unidoc/unioffice/spreadsheet/reference"
 )
 
@@ -53,9 +54,14 @@ func (c Cell) Clear() {
 }
 
 func (c Cell) clearValue() {
+	if c.w != nil && c.w.calc != nil {
+		c.w.calc.markDirty(c.s, c.x)
+	}
+	c.clearSpill()
 	c.x.F = nil
 	c.x.Is = nil
 	c.x.V = nil
+	c.x.CmAttr = nil
 	c.x.TAttr = sml.ST_CellTypeUnset
 }
 
@@ -84,6 +90,18 @@ func (c Cell) SetFormulaRaw(s string) {
 	c.x.F.Content = s
 }
 
+// SetFormulaR1C1 sets the cell type to formula, and the formula to the given
+// formula in R1C1 notation (e.g. SUM(R[-3]C:R[-1]C)), which is stored in A1
+// notation.
+func (c Cell) SetFormulaR1C1(s string) error {
+	f, err := formula.ConvertFromR1C1(s, c.Reference())
+	if err != nil {
+		return err
+	}
+	c.SetFormulaRaw(f)
+	return nil
+}
+
 // SetFormulaArray sets the cell type to formula array, and the raw formula to
 // the given string. This is equivlent to entering a formula and pressing
 // Ctrl+Shift+Enter in Excel.
@@ -95,6 +113,22 @@ func (c Cell) SetFormulaArray(s string) {
 	c.x.F.Content = s
 }
 
+// SetFormulaDynamicArray sets the cell to a dynamic array formula, the way
+// that formulas are entered in Excel 365.  When the formula returns an array,
+// the array spills into the cells below and to the right of the cell, or the
+// formula returns #SPILL! if those cells aren't empty.
+func (c Cell) SetFormulaDynamicArray(s string) {
+	c.clearValue()
+	c.x.TAttr = sml.ST_CellTypeStr
+	c.x.F = sml.NewCT_CellFormula()
+	c.x.F.TAttr = sml.ST_CellFormulaTypeArray
+	c.x.F.RefAttr = unioffice.String(c.Reference())
+	c.x.F.Content = s
+	if c.w != nil {
+		c.x.CmAttr = unioffice.Uint32(c.w.dynamicArrayMetadata())
+	}
+}
+
 // SetFormulaShared sets the cell type to formula shared, and the raw formula to
 // the given string. The range is the range of cells that the formula applies
 // to, and is used to conserve disk space.
@@ -197,49 +231,64 @@ func (c Cell) getFormat() string {
 // be used if you care about replicating what Excel would show, otherwise
 // GetValueAsNumber()/GetValueAsTime
 func (c Cell) GetFormattedValue() string {
+	return c.GetFormattedValueWithLocale(nil).Text
+}
+
+// GetFormattedValueWithLocale returns the formatted cell value as it would
+// appear in Excel with the regional settings of a locale, or en-US if nil,
+// along with the color of the section of the number format that was applied.
+// Built in number formats whose display depends on the locale, such as the
+// short date format, are displayed as they are in the locale.
+func (c Cell) GetFormattedValueWithLocale(loc *format.Locale) format.Result {
 	f := c.getFormat()
+	if loc != nil && c.x.SAttr != nil {
+		id := c.w.StyleSheet.GetCellStyle(*c.x.SAttr).NumberFormat()
+		if lf, ok := loc.BuiltinFormat(id); ok {
+			f = lf
+		}
+	}
 	switch c.x.TAttr {
 	// boolean
 	case sml.ST_CellTypeB:
 		b, _ := c.GetValueAsBool()
 		if b {
-			return "TRUE"
+			return format.Result{Text: "TRUE"}
 		}
-		return "FALSE"
+		return format.Result{Text: "FALSE"}
 	// number
 	case sml.ST_CellTypeN:
 		v, _ := c.GetValueAsNumber()
-		return format.Number(v, f)
+		return format.NumberWithLocale(v, f, loc)
 	// error
 	case sml.ST_CellTypeE:
 		if c.x.V != nil {
-			return *c.x.V
+			return format.Result{Text: *c.x.V}
 		}
-		return ""
+		return format.Result{}
 	// string / inline string
 	case sml.ST_CellTypeS, sml.ST_CellTypeInlineStr:
-		return format.String(c.GetString(), f)
+		return format.StringWithLocale(c.GetString(), f, loc)
 	case sml.ST_CellTypeStr:
 		s := c.GetString()
 		if format.IsNumber(s) {
 			v, _ := strconv.ParseFloat(s, 64)
-			return format.Number(v, f)
+			return format.NumberWithLocale(v, f, loc)
 		}
-		return format.String(s, f)
+		return format.StringWithLocale(s, f, loc)
 	case sml.ST_CellTypeUnset:
 		fallthrough
 	default:
 		s, _ := c.GetRawValue()
 		// avoid returning zero for an empty cell
 		if len(s) == 0 {
-			return ""
+			return format.Result{}
 		}
 
 		v, err := c.GetValueAsNumber()
 		if err == nil {
-			return format.Number(v, f)
+			return format.NumberWithLocale(v, f, loc)
 		}
-		return format.String(s, f)
+		return format.StringWithLocale(s, f, loc)
 	}
 }
 
@@ -528,6 +577,16 @@ func (c Cell) GetFormula() string {
 	return ""
 }
 
+// GetFormulaR1C1 returns the formula in the cell in R1C1 notation, where
+// relative references are relative to the cell.
+func (c Cell) GetFormulaR1C1() string {
+	f, err := formula.ConvertToR1C1(c.GetFormula(), c.Reference())
+	if err != nil {
+		return ""
+	}
+	return f
+}
+
 // GetCachedFormulaResult returns the cached formula result if it exists. If the
 // cell type is not a formula cell, the result will be the cell value if it's a
 // string/number/bool cell.
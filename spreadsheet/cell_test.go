@@ -15,6 +15,7 @@ import (
 
 	"github.com/unidoc/unioffice/schema/soo/sml"
 	"github.com/unidoc/unioffice/spreadsheet"
+	"github.com/unidoc/unioffice/spreadsheet/format"
 )
 
 func TestCell(t *testing.T) {
@@ -246,3 +247,52 @@ func TestCellDateFormat(t *testing.T) {
 	}
 	wb.SaveToFile("/tmp/future.xlsx")
 }
+
+func TestCellFormulaR1C1(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	cell := sheet.Cell("B4")
+	if err := cell.SetFormulaR1C1("SUM(R1C:R[-1]C)+RC[-1]"); err != nil {
+		t.Fatalf("error setting formula: %s", err)
+	}
+	if got := cell.GetFormula(); got != "SUM(B$1:B3)+A4" {
+		t.Errorf("expected formula SUM(B$1:B3)+A4, got %s", got)
+	}
+	if got := cell.GetFormulaR1C1(); got != "SUM(R1C:R[-1]C)+RC[-1]" {
+		t.Errorf("expected formula SUM(R1C:R[-1]C)+RC[-1], got %s", got)
+	}
+}
+
+func TestCellFormattedValueWithLocale(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+
+	date := wb.StyleSheet.AddCellStyle()
+	date.SetNumberFormatStandard(spreadsheet.StandardFormatDate)
+	sheet.Cell("A1").SetNumber(42996.6996269676)
+	sheet.Cell("A1").SetStyle(date)
+
+	red := wb.StyleSheet.AddCellStyle()
+	red.SetNumberFormat(`#,##0.00;[Red]-#,##0.00`)
+	sheet.Cell("A2").SetNumber(-1234.5)
+	sheet.Cell("A2").SetStyle(red)
+
+	td := []struct {
+		cell   string
+		locale *format.Locale
+		exp    string
+		color  string
+	}{
+		{"A1", nil, "9/18/17", ""},
+		{"A1", format.LocaleEnUS, "9/18/2017", ""},
+		{"A1", format.LocaleDeDE, "18.09.2017", ""},
+		{"A2", nil, "-1,234.50", "Red"},
+		{"A2", format.LocaleDeDE, "-1.234,50", "Red"},
+	}
+	for _, tc := range td {
+		got := sheet.Cell(tc.cell).GetFormattedValueWithLocale(tc.locale)
+		if got.Text != tc.exp || got.Color != tc.color {
+			t.Errorf("expected %s/%s for %s, got %s/%s", tc.exp, tc.color, tc.cell, got.Text, got.Color)
+		}
+	}
+}
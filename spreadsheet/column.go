@@ -42,3 +42,44 @@ func (c Column) SetHidden(b bool) {
 		c.x.HiddenAttr = unioffice.Bool(true)
 	}
 }
+
+// IsHidden returns whether the column is hidden or not.
+func (c Column) IsHidden() bool {
+	return c.x.HiddenAttr != nil && *c.x.HiddenAttr
+}
+
+// OutlineLevel returns the outline level of the column, which is the number of
+// groups that it's in.
+func (c Column) OutlineLevel() uint8 {
+	if c.x.OutlineLevelAttr == nil {
+		return 0
+	}
+	return *c.x.OutlineLevelAttr
+}
+
+// SetOutlineLevel sets the outline level of the column from 0 to 7.  Sheet's
+// GroupColumns and UngroupColumns also update the outline level of the sheet.
+func (c Column) SetOutlineLevel(level uint8) {
+	if level == 0 {
+		c.x.OutlineLevelAttr = nil
+	} else {
+		c.x.OutlineLevelAttr = unioffice.Uint8(level)
+	}
+}
+
+// IsCollapsed returns whether the group of columns that the column summarizes
+// is collapsed.
+func (c Column) IsCollapsed() bool {
+	return c.x.CollapsedAttr != nil && *c.x.CollapsedAttr
+}
+
+// SetCollapsed marks the group of columns that the column summarizes as
+// collapsed.  It doesn't hide the columns of the group, which Sheet's
+// CollapseColumns does.
+func (c Column) SetCollapsed(b bool) {
+	if !b {
+		c.x.CollapsedAttr = nil
+	} else {
+		c.x.CollapsedAttr = unioffice.Bool(true)
+	}
+}
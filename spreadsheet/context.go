@@ -9,7 +9,10 @@ package spreadsheet
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/unidoc/unioffice/schema/soo/sml"
 	"github.com/unidoc/unioffice/spreadsheet/formula"
 	"github.com/unidoc/unioffice/spreadsheet/reference"
 )
@@ -22,13 +25,38 @@ type evalContext struct {
 	s              *Sheet
 	colOff, rowOff uint32
 	evaluating     map[string]struct{}
+	// cur is the cell whose formula is being evaluated, if any
+	cur string
 }
 
 func (e *evalContext) Cell(ref string, ev formula.Evaluator) formula.Result {
-	cr, err := reference.ParseCellReference(ref)
+	cr, err := e.cellReference(ref)
 	if err != nil {
 		return formula.MakeErrorResult(fmt.Sprintf("error parsing %s: %s", ref, err))
 	}
+	c := e.s.Cell(cr.String())
+
+	// if we have a formula, evaluate it
+	if c.HasFormula() {
+		res := e.evalFormula(ref, cr, c, ev)
+		if isDynamicArray(c.x) {
+			// only a spill range reference (e.g. A1#) refers to the whole
+			// result
+			return firstValue(res)
+		}
+		return res
+	}
+
+	return cellResult(c)
+}
+
+// cellReference parses a cell reference, adjusting it by the offset of a shared
+// formula.
+func (e *evalContext) cellReference(ref string) (reference.CellReference, error) {
+	cr, err := reference.ParseCellReference(ref)
+	if err != nil {
+		return cr, err
+	}
 
 	// offsets are used in shared formulas so that references like 'A1', '$A1',
 	// 'A$1', '$A$1' will behave differently according to the offset
@@ -39,21 +67,53 @@ func (e *evalContext) Cell(ref string, ev formula.Evaluator) formula.Result {
 	if e.rowOff != 0 && !cr.AbsoluteRow {
 		cr.RowIdx += e.rowOff
 	}
+	return cr, nil
+}
+
+// evalFormula evaluates the formula in a cell.
+func (e *evalContext) evalFormula(ref string, cr reference.CellReference, c Cell, ev formula.Evaluator) formula.Result {
+	if _, ok := e.evaluating[ref]; ok {
+		// recursively evaluating, so bail out
+		return formula.MakeErrorResult("recursion detected during evaluation of " + ref)
+	}
+	e.evaluating[ref] = struct{}{}
+	prev := e.cur
+	e.cur = cr.String()
+	res := ev.Eval(e, c.GetFormula())
+	e.cur = prev
+	delete(e.evaluating, ref)
+	return res
+}
 
+// Spill returns the result of the dynamic array formula in a cell.
+func (e *evalContext) Spill(ref string, ev formula.Evaluator) formula.Result {
+	cr, err := e.cellReference(ref)
+	if err != nil {
+		return formula.MakeErrorResult(fmt.Sprintf("error parsing %s: %s", ref, err))
+	}
 	c := e.s.Cell(cr.String())
+	if !isDynamicArray(c.x) {
+		return formula.MakeErrorResultType(formula.ErrorTypeRef, ref+" doesn't contain a dynamic array formula")
+	}
+	return e.evalFormula(ref, cr, c, ev)
+}
 
-	// if we have a formula, evaluate it
-	if c.HasFormula() {
-		if _, ok := e.evaluating[ref]; ok {
-			// recursively evaluating, so bail out
-			return formula.MakeErrorResult("recursion detected during evaluation of " + ref)
-		}
-		e.evaluating[ref] = struct{}{}
-		res := ev.Eval(e, c.GetFormula())
-		delete(e.evaluating, ref)
-		return res
+// CurrentCell returns the cell whose formula is being evaluated.
+func (e *evalContext) CurrentCell() string {
+	return e.cur
+}
+
+// Formula returns the formula in a cell.
+func (e *evalContext) Formula(ref string) string {
+	cr, err := e.cellReference(ref)
+	if err != nil {
+		return ""
 	}
+	return e.s.Cell(cr.String()).GetFormula()
+}
 
+// cellResult returns the value stored in a cell as a formula result.
+func cellResult(c Cell) formula.Result {
 	if c.IsEmpty() {
 		return formula.MakeEmptyResult()
 	} else if c.IsNumber() {
@@ -65,12 +125,16 @@ func (e *evalContext) Cell(ref string, ev formula.Evaluator) formula.Result {
 	}
 
 	v, _ := c.GetRawValue()
+	if c.x.TAttr == sml.ST_CellTypeE {
+		t, _ := formula.ParseErrorType(v)
+		return formula.MakeErrorResultType(t, "")
+	}
 	return formula.MakeStringResult(v)
 }
 
 func (e *evalContext) Sheet(name string) formula.Context {
 	for _, sheet := range e.s.w.Sheets() {
-		if sheet.Name() == name {
+		if strings.EqualFold(sheet.Name(), name) {
 			return sheet.FormulaContext()
 		}
 	}
@@ -78,20 +142,83 @@ func (e *evalContext) Sheet(name string) formula.Context {
 }
 
 func (e *evalContext) NamedRange(ref string) formula.Reference {
-	for _, dn := range e.s.w.DefinedNames() {
+	return namedRangeReference(e.s.w, ref)
+}
+
+// namedRangeReference returns the reference for a defined name or table.
+func namedRangeReference(wb *Workbook, ref string) formula.Reference {
+	for _, dn := range wb.DefinedNames() {
 		if dn.Name() == ref {
 			return formula.MakeRangeReference(dn.Content())
 		}
 	}
-	for _, tbl := range e.s.w.Tables() {
-		if tbl.Name() == ref {
-			return formula.MakeRangeReference(tbl.Reference())
+	for i, tbl := range wb.tables {
+		if tbl.NameAttr == nil || *tbl.NameAttr != ref {
+			continue
+		}
+		if s, ok := wb.tableSheet(i); ok {
+			return formula.MakeRangeReference(reference.QuoteSheetName(s.Name()) + "!" + tbl.RefAttr)
 		}
+		return formula.MakeRangeReference(tbl.RefAttr)
 	}
 	return formula.ReferenceInvalid
 }
 
+// Table returns the table with a given name, or the table containing the cell
+// being evaluated if the name is empty.
+func (e *evalContext) Table(name string) (formula.Table, bool) {
+	return formulaTable(e.s.w, name, *e.s, e.cur)
+}
+
+// formulaTable returns the table with a given name, or the table containing a
+// cell if the name is empty, for evaluating structured references.
+func formulaTable(wb *Workbook, name string, s Sheet, cell string) (formula.Table, bool) {
+	cr, err := reference.ParseCellReference(cell)
+	if err != nil && name == "" {
+		return formula.Table{}, false
+	}
+	for i, tbl := range wb.tables {
+		ts, ok := wb.tableSheet(i)
+		if !ok {
+			continue
+		}
+		t := Table{wb, tbl}
+		from, to, rerr := reference.ParseRangeReference(tbl.RefAttr)
+		if rerr != nil {
+			continue
+		}
+		if name == "" {
+			if ts.x != s.x || cr.ColumnIdx < from.ColumnIdx || cr.ColumnIdx > to.ColumnIdx ||
+				cr.RowIdx < from.RowIdx || cr.RowIdx > to.RowIdx {
+				continue
+			}
+		} else if !strings.EqualFold(t.Name(), name) {
+			continue
+		}
+		ft := formula.Table{Name: t.Name(), Sheet: ts.Name(), Ref: tbl.RefAttr, HeaderRows: 1}
+		if tbl.HeaderRowCountAttr != nil {
+			ft.HeaderRows = *tbl.HeaderRowCountAttr
+		}
+		if tbl.TotalsRowCountAttr != nil {
+			ft.TotalsRows = *tbl.TotalsRowCountAttr
+		}
+		for _, c := range t.Columns() {
+			ft.Columns = append(ft.Columns, c.Name())
+		}
+		if err == nil {
+			ft.CurrentRow = cr.RowIdx
+		}
+		return ft, true
+	}
+	return formula.Table{}, false
+}
+
 func (e *evalContext) SetOffset(col, row uint32) {
 	e.colOff = col
 	e.rowOff = row
 }
+
+// GetEpoch returns the workbook epoch used for serial dates.
+func (e *evalContext) GetEpoch() time.Time {
+	return e.s.w.Epoch()
+}
@@ -47,9 +47,9 @@ var standardFmtTestData = []struct {
 	{42996.6996269676, spreadsheet.StandardFormat17, "Sep-17"},
 	{42996.6996269676, spreadsheet.StandardFormat18, "4:47 PM"},
 	{42996.6996269676, spreadsheet.StandardFormat19, "4:47:28 PM"},
-	{42996.6996269676, spreadsheet.StandardFormat20, "4:47"},
-	{42996.6996269676, spreadsheet.StandardFormat21, "4:47:28"},
-	{42996.6996269676, spreadsheet.StandardFormat22, "9/18/17 4:47"},
+	{42996.6996269676, spreadsheet.StandardFormat20, "16:47"},
+	{42996.6996269676, spreadsheet.StandardFormat21, "16:47:28"},
+	{42996.6996269676, spreadsheet.StandardFormat22, "9/18/17 16:47"},
 
 	{1234, spreadsheet.StandardFormat37, "1,234 "},
 	{-1234, spreadsheet.StandardFormat37, "(1,234)"},
@@ -15,4 +15,10 @@
 // - "1 23/100" with fornat "0 0/100"
 // - "1.23E+00" with format "0.00E+00"
 // - "29:37:41s" with format `[h]:mm:ss"s"`
+//
+// Formats can have up to four sections separated by semicolons, for positive
+// numbers, negative numbers, zero and text, or choose sections with conditions
+// such as [>=1000].  NumberWithLocale and ValueWithLocale also return the color
+// of the section that was applied (e.g. [Red]), and format with the separators
+// and month and day names of a Locale.
 package format
@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/unidoc/unioffice"
 )
@@ -38,6 +39,12 @@ type Format struct {
 
 	denom       int64
 	denomDigits int
+
+	// ampm is true if the format displays AM or PM, so that hours are
+	// displayed from 1 to 12 rather than 0 to 23.
+	ampm bool
+	// names is the locale whose month and day names dates are displayed with.
+	names *Locale
 }
 
 // FmtType is the type of a format token.
@@ -129,50 +136,23 @@ func (f *Format) AddToken(t FmtType, l []byte) {
 // string is empty, then General number formatting is used which attempts to mimic
 // Excel's general formatting.
 func Number(v float64, f string) string {
-	if f == "" || f == "General" {
-		return NumberGeneric(v)
-	}
-	fmts := Parse(f)
-	if len(fmts) == 1 {
-		return number(v, fmts[0], false)
-	} else if len(fmts) > 1 && v < 0 {
-		return number(v, fmts[1], true)
-	} else if len(fmts) > 2 && v == 0 {
-		return number(v, fmts[2], false)
-	}
-	return number(v, fmts[0], false)
+	return NumberWithLocale(v, f, nil).Text
 }
 
 // Value formats a value as a number or string depending on  if it appears to be
 // a number or string.
 func Value(v string, f string) string {
-	if IsNumber(v) {
-		v, _ := strconv.ParseFloat(v, 64)
-		return Number(v, f)
-	}
-	return String(v, f)
+	return ValueWithLocale(v, f, nil).Text
 }
 
 // String returns the string formatted according to the type.  In format strings
 // this is the fourth item, where '@' is used as a placeholder for text.
 func String(v string, f string) string {
-	fmts := Parse(f)
-	var fm Format
-	if len(fmts) == 1 {
-		fm = fmts[0]
-	} else if len(fmts) == 4 {
-		fm = fmts[3]
-	}
-	fmtHasText := false
-	for _, w := range fm.Whole {
-		if w.Type == FmtTypeText {
-			fmtHasText = true
-		}
-	}
-	// no text placeholder in the format (@), so just return the original string
-	if !fmtHasText {
-		return v
-	}
+	return StringWithLocale(v, f, nil).Text
+}
+
+// text formats a string with a text format.
+func text(v string, fm Format) string {
 	b := bytes.Buffer{}
 	for _, w := range fm.Whole {
 		// these appear to be the only formats that matter for string
@@ -196,7 +176,10 @@ func reverse(b []byte) []byte {
 
 func number(vOrig float64, f Format, isNeg bool) string {
 	if f.isGeneral {
-		return NumberGeneric(vOrig)
+		if isNeg {
+			vOrig = math.Abs(vOrig)
+		}
+		return strings.Replace(NumberGeneric(vOrig), ".", string(sepDecimal), 1)
 	}
 	buf := make([]byte, 0, 20)
 	wasNeg := math.Signbit(vOrig)
@@ -303,9 +286,18 @@ func formatWholeNumber(pre, vOrig float64, f Format) []byte {
 	if len(f.Whole) == 0 {
 		return nil
 	}
+	// the sign of a negative time is written before it by number, so the time
+	// is that of the magnitude of the value
+	vOrig = math.Abs(vOrig)
 	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
-	t := epoch.Add(time.Duration(vOrig * float64(24*time.Hour)))
+	// times are rounded to the precision they're displayed with
+	prec := time.Second
+	if hasFractionalSeconds(f) {
+		prec = time.Millisecond
+	}
+	t := epoch.Add(time.Duration(vOrig * float64(24*time.Hour))).Round(prec)
 	t = asLocal(t)
+	elapsed := roundHalfAway(vOrig*86400/prec.Seconds()) * prec.Seconds()
 
 	raw := strconv.AppendFloat(nil, pre, 'f', -1, 64)
 	op := make([]byte, 0, len(raw))
@@ -356,9 +348,9 @@ lfor:
 		case FmtTypeLiteral:
 			op = append(op, ph.Literal)
 		case FmtTypeDate:
-			op = append(op, reverse(dDate(t, ph.DateTime))...)
+			op = append(op, reverse(dDate(t, ph.DateTime, f.names))...)
 		case FmtTypeTime:
-			op = append(op, reverse(dTime(t, vOrig, ph.DateTime))...)
+			op = append(op, reverse(dTime(t, elapsed, ph.DateTime, f))...)
 		default:
 			unioffice.Log("unsupported type in whole %v", ph)
 		}
@@ -376,24 +368,21 @@ lfor:
 		buf = o
 	}
 	if f.hasThousands {
-		b := bytes.Buffer{}
-		nonTerm := 0
-		for i := len(buf) - 1; i >= 0; i-- {
-			if !(buf[i] >= '0' && buf[i] <= '9') {
-				nonTerm++
-			} else {
-				break
-			}
-		}
-		for i := 0; i < len(buf); i++ {
-			idx := (len(buf) - i - nonTerm)
-			if idx%3 == 0 && idx != 0 && i != 0 {
-				b.WriteByte(',')
+		// separate the thousands of the digits between any literals
+		beg := bytes.IndexFunc(buf, isDigit)
+		end := bytes.LastIndexFunc(buf, isDigit) + 1
+		if beg != -1 {
+			b := bytes.Buffer{}
+			b.Write(buf[:beg])
+			for i := beg; i < end; i++ {
+				if idx := end - i; idx%3 == 0 && i != beg {
+					b.WriteByte(sepThousands)
+				}
+				b.WriteByte(buf[i])
 			}
-			b.WriteByte(buf[i])
-
+			b.Write(buf[end:])
+			buf = b.Bytes()
 		}
-		buf = b.Bytes()
 	}
 	return buf
 }
@@ -411,7 +400,7 @@ func formatFractional(post, vOrig float64, f Format) []byte {
 	}
 
 	op := make([]byte, 0, len(raw))
-	op = append(op, '.')
+	op = append(op, sepDecimal)
 	consumed := 0
 lforPost:
 	for i := 0; i < len(f.Fractional); i++ {
@@ -592,8 +581,36 @@ func performCarries(b []byte) []byte {
 	return b
 }
 
-// dDate formats a time with an Excel format date string.
-func dDate(t time.Time, f string) []byte {
+// roundHalfAway rounds x to the nearest integer, rounding halves away from
+// zero.
+func roundHalfAway(x float64) float64 {
+	if x < 0 {
+		return -math.Floor(-x + 0.5)
+	}
+	return math.Floor(x + 0.5)
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// hasFractionalSeconds returns true if a format displays fractions of a
+// second.
+func hasFractionalSeconds(f Format) bool {
+	for _, ph := range f.Whole {
+		if ph.Type == FmtTypeTime && strings.Contains(ph.DateTime, "s.") {
+			return true
+		}
+	}
+	return false
+}
+
+// dDate formats a time with an Excel format date string, using the month and
+// day names of a locale.
+func dDate(t time.Time, f string, names *Locale) []byte {
+	if names == nil {
+		names = LocaleEnUS
+	}
 	ret := []byte{}
 	beg := 0
 	for i := 0; i < len(f); i++ {
@@ -618,36 +635,21 @@ func dDate(t time.Time, f string) []byte {
 		case "mm":
 			ret = t.AppendFormat(ret, "01")
 		case "mmm":
-			ret = t.AppendFormat(ret, "Jan")
+			ret = append(ret, names.MonthAbbreviations[t.Month()-1]...)
 		case "mmmm":
-			ret = t.AppendFormat(ret, "January")
+			ret = append(ret, names.MonthNames[t.Month()-1]...)
 		case "mmmmm":
-			switch t.Month() {
-			case time.January, time.July, time.June:
-				ret = append(ret, 'J')
-			case time.February:
-				ret = append(ret, 'M')
-			case time.March, time.May:
-				ret = append(ret, 'M')
-			case time.April, time.August:
-				ret = append(ret, 'A')
-			case time.September:
-				ret = append(ret, 'S')
-			case time.October:
-				ret = append(ret, 'O')
-			case time.November:
-				ret = append(ret, 'N')
-			case time.December:
-				ret = append(ret, 'D')
-			}
+			// the first letter of the month
+			r, _ := utf8.DecodeRuneInString(names.MonthNames[t.Month()-1])
+			ret = append(ret, string(r)...)
 		case "d":
 			ret = t.AppendFormat(ret, "2")
 		case "dd":
 			ret = t.AppendFormat(ret, "02")
 		case "ddd":
-			ret = t.AppendFormat(ret, "Mon")
+			ret = append(ret, names.DayAbbreviations[t.Weekday()]...)
 		case "dddd":
-			ret = t.AppendFormat(ret, "Monday")
+			ret = append(ret, names.DayNames[t.Weekday()]...)
 		default:
 			unioffice.Log("unsupported date format %s", s)
 		}
@@ -658,28 +660,44 @@ func dDate(t time.Time, f string) []byte {
 	return ret
 }
 
-// dTime formats a time with an Excel format time string.
-func dTime(t time.Time, v float64, f string) []byte {
+// dTime formats a time with an Excel format time string, where elapsed is
+// the number of seconds displayed by elapsed times such as [h].
+func dTime(t time.Time, elapsed float64, ts string, f Format) []byte {
+	names := f.names
+	if names == nil {
+		names = LocaleEnUS
+	}
 	ret := []byte{}
 	beg := 0
-	for i := 0; i < len(f); i++ {
+	for i := 0; i < len(ts); i++ {
 		var s string
 		// split on ':'
-		if f[i] == ':' {
-			s = string(f[beg:i])
+		if ts[i] == ':' {
+			s = string(ts[beg:i])
 			beg = i + 1
-		} else if i == len(f)-1 {
-			s = string(f[beg : i+1])
+		} else if i == len(ts)-1 {
+			s = string(ts[beg : i+1])
 		} else {
 			continue
 		}
 
+		n := len(ret)
 		// Mon Jan 2 15:04:05 MST 2006
 		switch s {
 		case "d":
 			ret = t.AppendFormat(ret, "2")
 		case "h":
-			ret = t.AppendFormat(ret, "3")
+			if f.ampm {
+				ret = t.AppendFormat(ret, "3")
+			} else {
+				ret = t.AppendFormat(ret, "15")
+			}
+		case "hh":
+			if f.ampm {
+				ret = t.AppendFormat(ret, "03")
+			} else {
+				ret = t.AppendFormat(ret, "15")
+			}
 		case "m":
 			ret = t.AppendFormat(ret, "4")
 		case "mm":
@@ -701,20 +719,44 @@ func dTime(t time.Time, v float64, f string) []byte {
 		case "ss.000":
 			ret = t.Round(time.Second/1000).AppendFormat(ret, "05.000")
 		case "AM/PM":
-			ret = t.AppendFormat(ret, "PM")
-		case "[h]":
-			ret = strconv.AppendInt(ret, int64(v*24), 10)
-		case "[m]":
-			ret = strconv.AppendInt(ret, int64(v*24*60), 10)
-		case "[s]":
-			ret = strconv.AppendInt(ret, int64(v*24*60*60), 10)
+			if t.Hour() < 12 {
+				ret = append(ret, names.AM...)
+			} else {
+				ret = append(ret, names.PM...)
+			}
+		case "A/P":
+			if t.Hour() < 12 {
+				ret = append(ret, 'A')
+			} else {
+				ret = append(ret, 'P')
+			}
+		case "[h]", "[hh]":
+			ret = appendElapsed(ret, elapsed/3600, len(s)-2)
+		case "[m]", "[mm]":
+			ret = appendElapsed(ret, elapsed/60, len(s)-2)
+		case "[s]", "[ss]":
+			ret = appendElapsed(ret, elapsed, len(s)-2)
 		case "":
 		default:
 			unioffice.Log("unsupported time format %s", s)
 		}
-		if f[i] == ':' {
+		// fractions of a second use the decimal separator of the locale
+		if j := bytes.IndexByte(ret[n:], '.'); j != -1 {
+			ret[n+j] = sepDecimal
+		}
+		if ts[i] == ':' {
 			ret = append(ret, ':')
 		}
 	}
 	return ret
 }
+
+// appendElapsed appends the whole part of an elapsed time with at least a
+// number of digits.
+func appendElapsed(b []byte, v float64, digits int) []byte {
+	s := strconv.FormatInt(int64(v), 10)
+	for i := len(s); i < digits; i++ {
+		b = append(b, '0')
+	}
+	return append(b, s...)
+}
@@ -90,7 +90,7 @@ func TestCellFormattingNumber(t *testing.T) {
 		{123.456, `"foo"0"bar"`, "foo123bar"},
 
 		// negative format
-		{1234, "$#,##0_);($#,##0)", "$1,234"},
+		{1234, "$#,##0_);($#,##0)", "$1,234 "},
 		{-1234, "$#,##0_);($#,##0)", "($1,234)"},
 		{-4, "#,##0_);[Red](#,##0)", "(4)"},
 
@@ -179,3 +179,121 @@ func TestCellFormattingValue(t *testing.T) {
 		}
 	}
 }
+
+func TestCellFormattingSections(t *testing.T) {
+	// rendered by Excel 365 with en-US regional settings unless a locale is
+	// given
+	td := []struct {
+		Inp    float64
+		Fmt    string
+		Locale *format.Locale
+		Exp    string
+		Color  string
+	}{
+		// sections and colors
+		{1234.5, `0;[Red]-0;"zero";@`, nil, "1235", ""},
+		{-1234.5, `0;[Red]-0;"zero";@`, nil, "-1235", "Red"},
+		{0, `0;[Red]-0;"zero";@`, nil, "zero", ""},
+		{-1234.5, `#,##0.00;[Red](#,##0.00)`, nil, "(1,234.50)", "Red"},
+		{5, `[Blue]0;[Color10]0`, nil, "5", "Blue"},
+		{-5, `[Blue]0;[Color10]0`, nil, "5", "Color10"},
+		{-5, `0;`, nil, "", ""},
+		{0, `0;-0;;@`, nil, "", ""},
+		{-0.5, `0.0;(0.0);"-"`, nil, "(0.5)", ""},
+		{1234.5, `#,##0.00_);(#,##0.00)`, nil, "1,234.50 ", ""},
+
+		// conditions
+		{1234, `[>=1000]#,##0,"K";0`, nil, "1K", ""},
+		{999, `[>=1000]#,##0,"K";0`, nil, "999", ""},
+		{-5, `[>=1000]#,##0,"K";0`, nil, "-5", ""},
+		{1500000, `[>=1000000]0.0,,"M";[>=1000]0.0,"K";0`, nil, "1.5M", ""},
+		{2500, `[>=1000000]0.0,,"M";[>=1000]0.0,"K";0`, nil, "2.5K", ""},
+		{12, `[>=1000000]0.0,,"M";[>=1000]0.0,"K";0`, nil, "12", ""},
+		{50, `[Red][<=100]0;[Blue][>100]0`, nil, "50", "Red"},
+		{150, `[Red][<=100]0;[Blue][>100]0`, nil, "150", "Blue"},
+		{-3, `[<0]"neg "0;0`, nil, "neg 3", ""},
+
+		// scaling
+		{1234567, `0.0,,`, nil, "1.2", ""},
+		{1234567, `#,##0,`, nil, "1,235", ""},
+
+		// elapsed and 24 hour times
+		{1.5, `[h]:mm:ss`, nil, "36:00:00", ""},
+		{-0.5, `[h]:mm:ss`, nil, "-12:00:00", ""},
+		{-0.0104166667, `[h]:mm:ss`, nil, "-0:15:00", ""},
+		{0.0034722222, `[mm]:ss`, nil, "05:00", ""},
+		{0.0034722222, `[m]:ss`, nil, "5:00", ""},
+		{0.5, `[ss]`, nil, "43200", ""},
+		{0.25, `[hh]:mm`, nil, "06:00", ""},
+		{42996.6996269676, `h:mm`, nil, "16:47", ""},
+		{42996.6996269676, `hh:mm:ss`, nil, "16:47:28", ""},
+		{42996.2, `hh:mm AM/PM`, nil, "04:48 AM", ""},
+		{42996.6996269676, `h:mm A/P`, nil, "4:47 P", ""},
+
+		// locale and currency tags
+		{1234.5, `[$€-407]#,##0.00`, nil, "€1,234.50", ""},
+		{1234.5, `[$€-407]#,##0.00`, format.LocaleDeDE, "€1.234,50", ""},
+		{1234.5, `#,##0.00 [$€-407]`, format.LocaleDeDE, "1.234,50 €", ""},
+		{-1234.5, `[$$-409]#,##0.00;[Red]-[$$-409]#,##0.00`, nil, "-$1,234.50", "Red"},
+		{1234567.891, `#,##0.00`, format.LocaleFrFR, "1 234 567,89", ""},
+		{0.5, `0.0%`, format.LocaleDeDE, "50,0%", ""},
+		{1.234, `0.00E+00`, format.LocaleDeDE, "1,23E+00", ""},
+		{1.5, `General`, format.LocaleDeDE, "1,5", ""},
+		{42996.6996269676, `[$-407]dddd, d. mmmm yyyy`, nil, "Montag, 18. September 2017", ""},
+		{42996.6996269676, `[$-40C]dddd d mmmm yyyy`, nil, "lundi 18 septembre 2017", ""},
+		{42796, `dddd d mmmm`, format.LocaleDeDE, "Donnerstag 2 März", ""},
+		{42796, `mmmmm`, format.LocaleDeDE, "M", ""},
+		{42996.6996269676, `mm:ss.0`, format.LocaleDeDE, "47:27,8", ""},
+		{42996.6996269676, `[$-409]h:mm:ss AM/PM;@`, nil, "4:47:28 PM", ""},
+	}
+	for _, tc := range td {
+		got := format.NumberWithLocale(tc.Inp, tc.Fmt, tc.Locale)
+		if got.Text != tc.Exp || got.Color != tc.Color {
+			t.Errorf("expected %q/%q, got %q/%q for %g %s", tc.Exp, tc.Color, got.Text, got.Color, tc.Inp, tc.Fmt)
+		}
+	}
+}
+
+func TestCellFormattingText(t *testing.T) {
+	td := []struct {
+		Inp   string
+		Fmt   string
+		Exp   string
+		Color string
+	}{
+		{"abc", `0;[Red]-0;"zero";@`, "abc", ""},
+		{"abc", `0;0;0;[Magenta]"t:"@`, "t:abc", "Magenta"},
+		{"abc", `0;0;0;"n/a"`, "n/a", ""},
+		{"abc", `0.00`, "abc", ""},
+		{"5", `"x"@`, "x5", ""},
+	}
+	for _, tc := range td {
+		got := format.ValueWithLocale(tc.Inp, tc.Fmt, nil)
+		if got.Text != tc.Exp || got.Color != tc.Color {
+			t.Errorf("expected %q/%q, got %q/%q for %s %s", tc.Exp, tc.Color, got.Text, got.Color, tc.Inp, tc.Fmt)
+		}
+	}
+}
+
+func TestCellFormattingFill(t *testing.T) {
+	// the text of a cell that is Width characters wide, where _ pads by the
+	// width of a space and the fill character takes up the rest of the width
+	td := []struct {
+		Inp   float64
+		Fmt   string
+		Width int
+		Exp   string
+	}{
+		{5, `*-0`, 5, "----5"},
+		{5, `0*-`, 5, "5----"},
+		{1234.5, `_("$"* #,##0.00_)`, 12, " $ 1,234.50 "},
+		{1234.5, `0.0`, 12, "1234.5"},
+		{123456, `*-0`, 3, "123456"},
+	}
+	for _, tc := range td {
+		got := format.NumberWithLocale(tc.Inp, tc.Fmt, nil).Pad(tc.Width)
+		if got != tc.Exp {
+			t.Errorf("expected %q, got %q for %g %s", tc.Exp, got, tc.Inp, tc.Fmt)
+		}
+	}
+}
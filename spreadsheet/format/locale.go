@@ -0,0 +1,243 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package format
+
+import "strings"
+
+// Locale is the regional settings that values are formatted with.  The decimal
+// and thousands separators replace the '.' and ',' of number formats, and the
+// month and day names are used for dates.
+type Locale struct {
+	// LCID is the Windows locale ID (e.g. 0x409 for en-US) used by the locale
+	// tags of number formats such as [$-409].
+	LCID uint32
+	Name string
+
+	DecimalSeparator   string
+	ThousandsSeparator string
+
+	// MonthNames and MonthAbbreviations start with January, and DayNames and
+	// DayAbbreviations with Sunday.
+	MonthNames         [12]string
+	MonthAbbreviations [12]string
+	DayNames           [7]string
+	DayAbbreviations   [7]string
+	AM, PM             string
+
+	// Formats are the format codes of built in number formats whose display
+	// depends on the locale, such as the short date format 14, by number
+	// format ID.
+	Formats map[uint32]string
+}
+
+// LocaleEnUS is the English (United States) locale, the default locale.
+var LocaleEnUS = &Locale{
+	LCID:               0x409,
+	Name:               "en-US",
+	DecimalSeparator:   ".",
+	ThousandsSeparator: ",",
+	MonthNames: [12]string{"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December"},
+	MonthAbbreviations: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun",
+		"Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	DayNames:         [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	DayAbbreviations: [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	AM:               "AM",
+	PM:               "PM",
+	Formats: map[uint32]string{
+		5:  `"$"#,##0_);\("$"#,##0\)`,
+		6:  `"$"#,##0_);[Red]\("$"#,##0\)`,
+		7:  `"$"#,##0.00_);\("$"#,##0.00\)`,
+		8:  `"$"#,##0.00_);[Red]\("$"#,##0.00\)`,
+		14: "m/d/yyyy",
+		22: "m/d/yyyy h:mm",
+	},
+}
+
+// LocaleEnGB is the English (United Kingdom) locale.
+var LocaleEnGB = &Locale{
+	LCID:               0x809,
+	Name:               "en-GB",
+	DecimalSeparator:   ".",
+	ThousandsSeparator: ",",
+	MonthNames:         LocaleEnUS.MonthNames,
+	MonthAbbreviations: LocaleEnUS.MonthAbbreviations,
+	DayNames:           LocaleEnUS.DayNames,
+	DayAbbreviations:   LocaleEnUS.DayAbbreviations,
+	AM:                 "AM",
+	PM:                 "PM",
+	Formats: map[uint32]string{
+		5:  `"£"#,##0;\-"£"#,##0`,
+		6:  `"£"#,##0;[Red]\-"£"#,##0`,
+		7:  `"£"#,##0.00;\-"£"#,##0.00`,
+		8:  `"£"#,##0.00;[Red]\-"£"#,##0.00`,
+		14: "dd/mm/yyyy",
+		15: "dd-mmm-yy",
+		16: "dd-mmm",
+		22: "dd/mm/yyyy hh:mm",
+	},
+}
+
+// LocaleDeDE is the German (Germany) locale.
+var LocaleDeDE = &Locale{
+	LCID:               0x407,
+	Name:               "de-DE",
+	DecimalSeparator:   ",",
+	ThousandsSeparator: ".",
+	MonthNames: [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni",
+		"Juli", "August", "September", "Oktober", "November", "Dezember"},
+	MonthAbbreviations: [12]string{"Jan", "Feb", "Mrz", "Apr", "Mai", "Jun",
+		"Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+	DayNames:         [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+	DayAbbreviations: [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	AM:               "AM",
+	PM:               "PM",
+	Formats: map[uint32]string{
+		5:  `#,##0 "€";\-#,##0 "€"`,
+		6:  `#,##0 "€";[Red]\-#,##0 "€"`,
+		7:  `#,##0.00 "€";\-#,##0.00 "€"`,
+		8:  `#,##0.00 "€";[Red]\-#,##0.00 "€"`,
+		14: "dd.mm.yyyy",
+		15: "dd. mmm yy",
+		16: "dd. mmm",
+		17: "mmm yy",
+		18: "hh:mm AM/PM",
+		19: "hh:mm:ss AM/PM",
+		20: "hh:mm",
+		21: "hh:mm:ss",
+		22: "dd.mm.yyyy hh:mm",
+	},
+}
+
+// LocaleFrFR is the French (France) locale.
+var LocaleFrFR = &Locale{
+	LCID:               0x40c,
+	Name:               "fr-FR",
+	DecimalSeparator:   ",",
+	ThousandsSeparator: "\u00a0",
+	MonthNames: [12]string{"janvier", "février", "mars", "avril", "mai", "juin",
+		"juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+	MonthAbbreviations: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin",
+		"juil.", "août", "sept.", "oct.", "nov.", "déc."},
+	DayNames:         [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+	DayAbbreviations: [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	AM:               "AM",
+	PM:               "PM",
+	Formats: map[uint32]string{
+		5:  `#,##0 "€";\-#,##0 "€"`,
+		6:  `#,##0 "€";[Red]\-#,##0 "€"`,
+		7:  `#,##0.00 "€";\-#,##0.00 "€"`,
+		8:  `#,##0.00 "€";[Red]\-#,##0.00 "€"`,
+		14: "dd/mm/yyyy",
+		15: "dd-mmm-yy",
+		16: "dd-mmm",
+		17: "mmm-yy",
+		18: "hh:mm AM/PM",
+		19: "hh:mm:ss AM/PM",
+		20: "hh:mm",
+		21: "hh:mm:ss",
+		22: "dd/mm/yyyy hh:mm",
+	},
+}
+
+// LocaleEsES is the Spanish (Spain) locale.
+var LocaleEsES = &Locale{
+	LCID:               0xc0a,
+	Name:               "es-ES",
+	DecimalSeparator:   ",",
+	ThousandsSeparator: ".",
+	MonthNames: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio",
+		"julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+	MonthAbbreviations: [12]string{"ene", "feb", "mar", "abr", "may", "jun",
+		"jul", "ago", "sep", "oct", "nov", "dic"},
+	DayNames:         [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+	DayAbbreviations: [7]string{"do.", "lu.", "ma.", "mi.", "ju.", "vi.", "sá."},
+	AM:               "a. m.",
+	PM:               "p. m.",
+	Formats: map[uint32]string{
+		5:  `#,##0 "€";\-#,##0 "€"`,
+		6:  `#,##0 "€";[Red]\-#,##0 "€"`,
+		7:  `#,##0.00 "€";\-#,##0.00 "€"`,
+		8:  `#,##0.00 "€";[Red]\-#,##0.00 "€"`,
+		14: "dd/mm/yyyy",
+		15: "dd-mmm-yy",
+		16: "dd-mmm",
+		17: "mmm-yy",
+		18: "hh:mm AM/PM",
+		19: "hh:mm:ss AM/PM",
+		20: "hh:mm",
+		21: "hh:mm:ss",
+		22: "dd/mm/yyyy hh:mm",
+	},
+}
+
+// LocaleItIT is the Italian (Italy) locale.
+var LocaleItIT = &Locale{
+	LCID:               0x410,
+	Name:               "it-IT",
+	DecimalSeparator:   ",",
+	ThousandsSeparator: ".",
+	MonthNames: [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno",
+		"luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+	MonthAbbreviations: [12]string{"gen", "feb", "mar", "apr", "mag", "giu",
+		"lug", "ago", "set", "ott", "nov", "dic"},
+	DayNames:         [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+	DayAbbreviations: [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	AM:               "AM",
+	PM:               "PM",
+	Formats: map[uint32]string{
+		5:  `#,##0 "€";\-#,##0 "€"`,
+		6:  `#,##0 "€";[Red]\-#,##0 "€"`,
+		7:  `#,##0.00 "€";\-#,##0.00 "€"`,
+		8:  `#,##0.00 "€";[Red]\-#,##0.00 "€"`,
+		14: "dd/mm/yyyy",
+		15: "dd-mmm-yy",
+		16: "dd-mmm",
+		17: "mmm-yy",
+		18: "hh:mm AM/PM",
+		19: "hh:mm:ss AM/PM",
+		20: "hh:mm",
+		21: "hh:mm:ss",
+		22: "dd/mm/yyyy hh:mm",
+	},
+}
+
+var locales = []*Locale{LocaleEnUS, LocaleEnGB, LocaleDeDE, LocaleFrFR, LocaleEsES, LocaleItIT}
+
+// LookupLocale returns the locale with a name (e.g. de-DE), or nil if there
+// isn't one.
+func LookupLocale(name string) *Locale {
+	for _, l := range locales {
+		if strings.EqualFold(l.Name, name) {
+			return l
+		}
+	}
+	return nil
+}
+
+// localeForLCID returns the locale with a Windows locale ID, or nil if there
+// isn't one.
+func localeForLCID(lcid uint32) *Locale {
+	for _, l := range locales {
+		if l.LCID == lcid {
+			return l
+		}
+	}
+	return nil
+}
+
+// BuiltinFormat returns the format code that a built in number format is
+// displayed with in the locale, or false if the format doesn't depend on the
+// locale.
+func (l *Locale) BuiltinFormat(id uint32) (string, bool) {
+	if l == nil {
+		l = LocaleEnUS
+	}
+	f, ok := l.Formats[id]
+	return f, ok
+}
@@ -0,0 +1,464 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package format
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Placeholder bytes written while formatting and replaced with the separators
+// of the locale, or the fill position, once the value is formatted.
+const (
+	sepDecimal   = '\x1e'
+	sepThousands = '\x1d'
+	fillMark     = '\x1f'
+)
+
+// Result is a value formatted with a number format.
+type Result struct {
+	// Text is the formatted value.
+	Text string
+	// Color is the color of the format section that was applied (e.g. Red or
+	// Color10), or empty if the section doesn't set one.
+	Color string
+	// Fill is the character that the format repeats to fill the width of the
+	// cell (e.g. '-' for *-), which is inserted at the byte offset FillIndex
+	// of Text, or zero if the format doesn't have one.
+	Fill      rune
+	FillIndex int
+}
+
+// Pad returns the text padded to a width in characters by repeating the fill
+// character, or the text as is if the format doesn't have one.
+func (r Result) Pad(width int) string {
+	n := width - utf8.RuneCountInString(r.Text)
+	if r.Fill == 0 || n <= 0 {
+		return r.Text
+	}
+	return r.Text[:r.FillIndex] + strings.Repeat(string(r.Fill), n) + r.Text[r.FillIndex:]
+}
+
+var colors = []string{"Black", "Blue", "Cyan", "Green", "Magenta", "Red", "White", "Yellow"}
+
+// condition is the condition of a section, such as [>=1000].
+type condition struct {
+	op  string
+	val float64
+}
+
+func (c condition) matches(v float64) bool {
+	switch c.op {
+	case "<":
+		return v < c.val
+	case "<=":
+		return v <= c.val
+	case ">":
+		return v > c.val
+	case ">=":
+		return v >= c.val
+	case "<>":
+		return v != c.val
+	}
+	return v == c.val
+}
+
+// negativeOnly returns true if only negative numbers match the condition, in
+// which case they're displayed without a minus sign.
+func (c condition) negativeOnly() bool {
+	switch c.op {
+	case "<":
+		return c.val <= 0
+	case "<=", "=":
+		return c.val < 0
+	}
+	return false
+}
+
+func parseCondition(s string) (*condition, bool) {
+	for _, op := range []string{"<=", ">=", "<>", "<", ">", "="} {
+		if strings.HasPrefix(s, op) {
+			v, err := strconv.ParseFloat(s[len(op):], 64)
+			if err != nil {
+				return nil, false
+			}
+			return &condition{op, v}, true
+		}
+	}
+	return nil, false
+}
+
+// section is one of the semicolon separated sections of a number format, with
+// the tags that the lexer doesn't handle removed.
+type section struct {
+	Format
+	color  string
+	cond   *condition
+	locale *Locale
+	fill   rune
+	// scale is the number of trailing commas after the digits, each of which
+	// divides the number by 1000.
+	scale   int
+	hasText bool
+}
+
+// parseSections parses the sections of a number format.
+func parseSections(f string) []section {
+	parts := splitSections(f)
+	ret := make([]section, len(parts))
+	for i, p := range parts {
+		ret[i] = parseSection(p)
+	}
+	return ret
+}
+
+// skipQuoted returns the index of the closing quote of the string starting at
+// s[i].
+func skipQuoted(s string, i int) int {
+	j := strings.IndexByte(s[i+1:], '"')
+	if j == -1 {
+		return len(s) - 1
+	}
+	return i + 1 + j
+}
+
+// splitSections splits a number format on the semicolons that separate its
+// sections.
+func splitSections(f string) []string {
+	ret := []string{}
+	beg := 0
+	for i := 0; i < len(f); i++ {
+		switch f[i] {
+		case '"':
+			i = skipQuoted(f, i)
+		case '\\', '_', '*':
+			i++
+		case '[':
+			if j := strings.IndexByte(f[i:], ']'); j != -1 {
+				i += j
+			}
+		case ';':
+			ret = append(ret, f[beg:i])
+			beg = i + 1
+		}
+	}
+	return append(ret, f[beg:])
+}
+
+func isDigitPlaceholder(c byte) bool {
+	return c == '0' || c == '#' || c == '?'
+}
+
+func parseSection(s string) section {
+	sec := section{}
+	buf := bytes.Buffer{}
+	// the number of digits of each elapsed time token, such as 2 for [mm]
+	elapsed := []int{}
+	ampm := false
+	isDate := isDateSection(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			j := skipQuoted(s, i)
+			buf.WriteString(s[i : j+1])
+			i = j
+		case c == '\\':
+			_, n := utf8.DecodeRuneInString(s[minInt(i+1, len(s)):])
+			buf.WriteString(s[i : i+1+n])
+			i += n
+		case c == '_':
+			// padding the width of a character, which is displayed as a space
+			_, n := utf8.DecodeRuneInString(s[minInt(i+1, len(s)):])
+			buf.WriteString("\\ ")
+			i += n
+		case c == '*':
+			r, n := utf8.DecodeRuneInString(s[minInt(i+1, len(s)):])
+			if n > 0 && sec.fill == 0 {
+				sec.fill = r
+				buf.WriteByte(fillMark)
+			}
+			i += n
+		case c == '[':
+			j := strings.IndexByte(s[i:], ']')
+			if j == -1 {
+				buf.WriteString(s[i:])
+				i = len(s)
+				continue
+			}
+			tag := s[i+1 : i+j]
+			i += j
+			if isElapsed(tag) {
+				buf.WriteString("[" + tag[:1] + "]")
+				elapsed = append(elapsed, len(tag))
+			} else {
+				sec.parseTag(tag, &buf)
+			}
+		case c == ',':
+			// commas following the digits scale the number by 1000 each rather
+			// than separating thousands
+			j := i
+			for j < len(s) && s[j] == ',' {
+				j++
+			}
+			b := buf.Bytes()
+			if len(b) > 0 && (isDigitPlaceholder(b[len(b)-1]) || b[len(b)-1] == '.') &&
+				(j == len(s) || !isDigitPlaceholder(s[j])) {
+				sec.scale += j - i
+			} else {
+				buf.WriteString(s[i:j])
+			}
+			i = j - 1
+		case c == '.' && isDate:
+			// a period in a date is just text, unless it's the decimal point
+			// of fractional seconds
+			b := buf.Bytes()
+			if len(b) > 0 && b[len(b)-1] == 's' && i+1 < len(s) && s[i+1] == '0' {
+				buf.WriteByte(c)
+			} else {
+				buf.WriteString("\\.")
+			}
+		default:
+			if c == '@' {
+				sec.hasText = true
+			}
+			if strings.HasPrefix(s[i:], "AM/PM") || strings.HasPrefix(s[i:], "A/P") {
+				ampm = true
+			}
+			buf.WriteByte(c)
+		}
+	}
+
+	fmts := Parse(buf.String())
+	sec.Format = fmts[0]
+	sec.ampm = ampm
+	for i, ph := range sec.Whole {
+		if len(elapsed) == 0 {
+			break
+		}
+		if ph.Type == FmtTypeTime && isElapsed(strings.Trim(ph.DateTime, "[]")) {
+			if elapsed[0] > 1 {
+				u := ph.DateTime[1:2]
+				sec.Whole[i].DateTime = "[" + u + u + "]"
+			}
+			elapsed = elapsed[1:]
+		}
+	}
+	return sec
+}
+
+// isDateSection returns true if a section formats dates or times.
+func isDateSection(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			i = skipQuoted(s, i)
+		case '\\', '_', '*':
+			i++
+		case '[':
+			if j := strings.IndexByte(s[i:], ']'); j != -1 {
+				if isElapsed(s[i+1 : i+j]) {
+					return true
+				}
+				i += j
+			}
+		case 'y', 'm', 'd', 'h', 's':
+			return true
+		}
+	}
+	return false
+}
+
+// isElapsed returns true for the tag of an elapsed time, such as h or mm.
+func isElapsed(tag string) bool {
+	if tag == "" || (tag[0] != 'h' && tag[0] != 'm' && tag[0] != 's') {
+		return false
+	}
+	return strings.Count(tag, tag[:1]) == len(tag)
+}
+
+// parseTag handles a color, condition or locale tag, writing any text that it
+// displays to buf.
+func (s *section) parseTag(tag string, buf *bytes.Buffer) {
+	if cond, ok := parseCondition(tag); ok {
+		s.cond = cond
+		return
+	}
+	if strings.HasPrefix(tag, "$") {
+		// [$€-407] displays the currency symbol € and formats dates with the
+		// names of the locale with the LCID 0x407
+		sym := tag[1:]
+		if idx := strings.LastIndexByte(sym, '-'); idx != -1 {
+			if lcid, err := strconv.ParseUint(sym[idx+1:], 16, 32); err == nil {
+				s.locale = localeForLCID(uint32(lcid) & 0xffff)
+			}
+			sym = sym[:idx]
+		}
+		for i := 0; i < len(sym); i++ {
+			buf.WriteByte('\\')
+			buf.WriteByte(sym[i])
+		}
+		return
+	}
+	for _, c := range colors {
+		if strings.EqualFold(tag, c) {
+			s.color = c
+			return
+		}
+	}
+	if len(tag) > 5 && strings.EqualFold(tag[:5], "Color") {
+		if n, err := strconv.Atoi(tag[5:]); err == nil && n >= 1 && n <= 56 {
+			s.color = "Color" + tag[5:]
+		}
+	}
+	// anything else, such as the [DBNum1] of East Asian numerals, is ignored
+}
+
+// hasDigits returns true if the section formats numbers rather than just text.
+func (s *section) hasDigits() bool {
+	if s.isGeneral || s.isFraction || s.IsExponential {
+		return true
+	}
+	for _, t := range [][]Token{s.Whole, s.Fractional} {
+		for _, ph := range t {
+			switch ph.Type {
+			case FmtTypeDigit, FmtTypeDigitOpt, FmtTypeDate, FmtTypeTime:
+				return true
+			}
+		}
+	}
+	return s.hasThousands
+}
+
+// numberSection returns the section that formats a number and whether the
+// section displays the number without its minus sign, or nil if no section
+// matches.  Without conditions, the second section is for negative numbers
+// and the third for zero, while conditions choose a section for any numbers.
+func numberSection(v float64, secs []section) (*section, bool) {
+	n := minInt(len(secs), 3)
+	hasCond := false
+	for i := 0; i < n; i++ {
+		if secs[i].cond != nil {
+			hasCond = true
+		}
+	}
+	for i := 0; i < n; i++ {
+		s := &secs[i]
+		if s.cond != nil {
+			if s.cond.matches(v) {
+				return s, s.cond.negativeOnly()
+			}
+			continue
+		}
+		// the last section is for anything that the others aren't
+		if i == n-1 {
+			return s, !hasCond && i > 0
+		}
+		if i == 0 && (v > 0 || (v == 0 && n < 3)) || i == 1 && v < 0 {
+			return s, i == 1
+		}
+	}
+	return nil, false
+}
+
+// finish replaces the placeholder separators in formatted text with those of
+// the locale and removes the fill position.
+func finish(text string, s *section, loc *Locale) Result {
+	ret := Result{}
+	if s != nil {
+		ret.Color = s.color
+		ret.Fill = s.fill
+	}
+	b := bytes.Buffer{}
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case sepDecimal:
+			b.WriteString(loc.DecimalSeparator)
+		case sepThousands:
+			b.WriteString(loc.ThousandsSeparator)
+		case fillMark:
+			ret.FillIndex = b.Len()
+		default:
+			b.WriteByte(text[i])
+		}
+	}
+	ret.Text = b.String()
+	return ret
+}
+
+// NumberWithLocale formats a number with a format string like Number, but
+// using the separators and names of a locale (or en-US if nil), and also
+// returns the color of the section of the format that was applied.
+func NumberWithLocale(v float64, f string, loc *Locale) Result {
+	if loc == nil {
+		loc = LocaleEnUS
+	}
+	if f == "" || f == "General" {
+		return finish(strings.Replace(NumberGeneric(v), ".", string(sepDecimal), 1), nil, loc)
+	}
+	secs := parseSections(f)
+	s, noSign := numberSection(v, secs)
+	if s == nil {
+		// no section's condition matched
+		return finish(strings.Replace(NumberGeneric(v), ".", string(sepDecimal), 1), nil, loc)
+	}
+	if s.hasText && !s.hasDigits() {
+		// numbers are displayed as text in a text section
+		return finish(text(NumberGeneric(v), s.Format), s, loc)
+	}
+	s.names = loc
+	if s.locale != nil {
+		s.names = s.locale
+	}
+	if s.scale > 0 {
+		v /= math.Pow(1000, float64(s.scale))
+	}
+	return finish(number(v, s.Format, noSign), s, loc)
+}
+
+// StringWithLocale formats a string with a format string like String, and
+// also returns the color of the section of the format that was applied.
+func StringWithLocale(v string, f string, loc *Locale) Result {
+	if loc == nil {
+		loc = LocaleEnUS
+	}
+	secs := parseSections(f)
+	var s *section
+	switch {
+	case len(secs) >= 4:
+		s = &secs[3]
+	case len(secs) == 1 && secs[0].hasText:
+		s = &secs[0]
+	default:
+		return Result{Text: v}
+	}
+	return finish(text(v, s.Format), s, loc)
+}
+
+// ValueWithLocale formats a value as a number or string depending on if it
+// appears to be a number or string, like Value, but using the separators and
+// names of a locale (or en-US if nil), and also returns the color of the
+// section of the format that was applied.
+func ValueWithLocale(v string, f string, loc *Locale) Result {
+	if IsNumber(v) {
+		v, _ := strconv.ParseFloat(v, 64)
+		return NumberWithLocale(v, f, loc)
+	}
+	return StringWithLocale(v, f, loc)
+}
+
+// minInt returns the smaller of two ints.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -10,6 +10,7 @@ package formula
 import (
 	"fmt"
 	"math"
+	"strings"
 )
 
 // BinOpType is the binary operation operator type
@@ -49,6 +50,9 @@ func (b BinaryExpr) Eval(ctx Context, ev Evaluator) Result {
 	lhs := b.lhs.Eval(ctx, ev)
 	rhs := b.rhs.Eval(ctx, ev)
 
+	// a single value is combined with each element of an array or list
+	lhs, rhs = expandScalar(lhs, rhs), expandScalar(rhs, lhs)
+
 	// peel off array/list ops first
 	if lhs.Type == rhs.Type {
 		if lhs.Type == ResultTypeArray {
@@ -65,87 +69,74 @@ func (b BinaryExpr) Eval(ctx Context, ev Evaluator) Result {
 
 	}
 
-	// TODO: check for and add support for binary operators on boolean values
-	switch b.op {
-	case BinOpTypePlus:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeNumberResult(lhs.ValueNumber + rhs.ValueNumber)
-			}
-		}
-	case BinOpTypeMinus:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeNumberResult(lhs.ValueNumber - rhs.ValueNumber)
-			}
-		}
-	case BinOpTypeMult:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeNumberResult(lhs.ValueNumber * rhs.ValueNumber)
-			}
-		}
-	case BinOpTypeDiv:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				if rhs.ValueNumber == 0 {
-					return MakeErrorResultType(ErrorTypeDivideByZero, "divide by zero")
-				}
-				return MakeNumberResult(lhs.ValueNumber / rhs.ValueNumber)
-			}
-		}
+	return scalarOp(b.op, lhs, rhs)
+}
+
+func (b BinaryExpr) Reference(ctx Context, ev Evaluator) Reference {
+	return ReferenceInvalid
+}
+
+func (b BinaryExpr) References() []Reference {
+	return append(b.lhs.References(), b.rhs.References()...)
+}
+
+// binOpText is the formula text of each operator.
+var binOpText = map[BinOpType]string{
+	BinOpTypePlus:   "+",
+	BinOpTypeMinus:  "-",
+	BinOpTypeMult:   "*",
+	BinOpTypeDiv:    "/",
+	BinOpTypeExp:    "^",
+	BinOpTypeLT:     "<",
+	BinOpTypeGT:     ">",
+	BinOpTypeEQ:     "=",
+	BinOpTypeLEQ:    "<=",
+	BinOpTypeGEQ:    ">=",
+	BinOpTypeNE:     "<>",
+	BinOpTypeConcat: "&",
+}
+
+// precedence returns the precedence of an operator in Excel, where higher
+// precedence operators bind more tightly.
+func (o BinOpType) precedence() int {
+	switch o {
+	case BinOpTypeConcat:
+		return 2
+	case BinOpTypePlus, BinOpTypeMinus:
+		return 3
+	case BinOpTypeMult, BinOpTypeDiv:
+		return 4
 	case BinOpTypeExp:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeNumberResult(math.Pow(lhs.ValueNumber, rhs.ValueNumber))
-			}
-		}
-	case BinOpTypeLT:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeBoolResult(lhs.ValueNumber < rhs.ValueNumber)
-			}
-		}
-	case BinOpTypeGT:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeBoolResult(lhs.ValueNumber > rhs.ValueNumber)
-			}
-		}
-	case BinOpTypeEQ:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				// TODO: see what Excel does regarding floating point comparison
-				return MakeBoolResult(lhs.ValueNumber == rhs.ValueNumber)
-			}
-		}
-	case BinOpTypeNE:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeBoolResult(lhs.ValueNumber != rhs.ValueNumber)
-			}
-		}
-	case BinOpTypeLEQ:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeBoolResult(lhs.ValueNumber <= rhs.ValueNumber)
-			}
+		return 5
+	}
+	return 1
+}
+
+// String returns the formula text of the expression, with parentheses added
+// where needed to preserve the order of evaluation.
+func (b BinaryExpr) String() string {
+	prec := b.op.precedence()
+	lhs := b.lhs.String()
+	switch l := b.lhs.(type) {
+	case BinaryExpr:
+		if l.op.precedence() < prec {
+			lhs = "(" + lhs + ")"
 		}
-	case BinOpTypeGEQ:
-		if lhs.Type == rhs.Type {
-			if lhs.Type == ResultTypeNumber {
-				return MakeBoolResult(lhs.ValueNumber >= rhs.ValueNumber)
-			}
+	case Negate:
+		// the negation would otherwise apply to the whole expression
+		if prec > BinOpTypeMinus.precedence() {
+			lhs = "(" + lhs + ")"
 		}
-	case BinOpTypeConcat:
-		return MakeStringResult(lhs.Value() + rhs.Value())
 	}
-
-	return MakeErrorResult("unsupported binary op")
+	rhs := b.rhs.String()
+	if r, ok := b.rhs.(BinaryExpr); ok && r.op.precedence() <= prec {
+		rhs = "(" + rhs + ")"
+	}
+	return lhs + binOpText[b.op] + rhs
 }
 
-func (b BinaryExpr) Reference(ctx Context, ev Evaluator) Reference {
-	return ReferenceInvalid
+func (b BinaryExpr) Update(q *UpdateQuery) Expression {
+	return NewBinaryExpr(b.lhs.Update(q), b.op, b.rhs.Update(q))
 }
 
 // sameDim returns true if the arrays have the same dimensions.
@@ -161,6 +152,33 @@ func sameDim(lhs, rhs [][]Result) bool {
 	return true
 }
 
+// expandScalar returns a single value repeated to the dimensions of other if it
+// is an array or list.
+func expandScalar(v, other Result) Result {
+	switch v.Type {
+	case ResultTypeArray, ResultTypeList, ResultTypeError:
+		return v
+	}
+	switch other.Type {
+	case ResultTypeList:
+		lst := make([]Result, len(other.ValueList))
+		for i := range lst {
+			lst[i] = v
+		}
+		return MakeListResult(lst)
+	case ResultTypeArray:
+		arr := make([][]Result, len(other.ValueArray))
+		for i, row := range other.ValueArray {
+			arr[i] = make([]Result, len(row))
+			for j := range row {
+				arr[i][j] = v
+			}
+		}
+		return MakeArrayResult(arr)
+	}
+	return v
+}
+
 func arrayOp(op BinOpType, lhs, rhs [][]Result) Result {
 	// we can assume the arrays are the same size here
 	res := [][]Result{}
@@ -178,42 +196,104 @@ func listOp(op BinOpType, lhs, rhs []Result) Result {
 	res := []Result{}
 	// we can assume the arrays are the same size here
 	for i := range lhs {
-		l := lhs[i].AsNumber()
-		r := rhs[i].AsNumber()
-		if l.Type != ResultTypeNumber || r.Type != ResultTypeNumber {
-			return MakeErrorResult("non-nunmeric value in binary operation")
+		res = append(res, scalarOp(op, lhs[i], rhs[i]))
+	}
+	return MakeListResult(res)
+}
+
+// scalarOp applies a binary operator to two single values.  Errors propagate,
+// and booleans and numeric text are treated as numbers by arithmetic
+// operators.
+func scalarOp(op BinOpType, lhs, rhs Result) Result {
+	if lhs.Type == ResultTypeError {
+		return lhs
+	}
+	if rhs.Type == ResultTypeError {
+		return rhs
+	}
+	switch op {
+	case BinOpTypeConcat:
+		return MakeStringResult(lhs.Value() + rhs.Value())
+	case BinOpTypeLT:
+		return MakeBoolResult(compareValues(lhs, rhs) < 0)
+	case BinOpTypeGT:
+		return MakeBoolResult(compareValues(lhs, rhs) > 0)
+	case BinOpTypeEQ:
+		// TODO: see what Excel does regarding floating point comparison
+		return MakeBoolResult(compareValues(lhs, rhs) == 0)
+	case BinOpTypeNE:
+		return MakeBoolResult(compareValues(lhs, rhs) != 0)
+	case BinOpTypeLEQ:
+		return MakeBoolResult(compareValues(lhs, rhs) <= 0)
+	case BinOpTypeGEQ:
+		return MakeBoolResult(compareValues(lhs, rhs) >= 0)
+	}
+
+	l, r := lhs.AsNumber(), rhs.AsNumber()
+	if l.Type != ResultTypeNumber || r.Type != ResultTypeNumber {
+		return MakeErrorResult("non-numeric value in binary operation")
+	}
+	switch op {
+	case BinOpTypePlus:
+		return MakeNumberResult(l.ValueNumber + r.ValueNumber)
+	case BinOpTypeMinus:
+		return MakeNumberResult(l.ValueNumber - r.ValueNumber)
+	case BinOpTypeMult:
+		return MakeNumberResult(l.ValueNumber * r.ValueNumber)
+	case BinOpTypeDiv:
+		if r.ValueNumber == 0 {
+			return MakeErrorResultType(ErrorTypeDivideByZero, "divide by zero")
 		}
-		switch op {
-		case BinOpTypePlus:
-			res = append(res, MakeNumberResult(l.ValueNumber+r.ValueNumber))
-		case BinOpTypeMinus:
-			res = append(res, MakeNumberResult(l.ValueNumber-r.ValueNumber))
-		case BinOpTypeMult:
-			res = append(res, MakeNumberResult(l.ValueNumber*r.ValueNumber))
-		case BinOpTypeDiv:
-			if r.ValueNumber == 0 {
-				return MakeErrorResultType(ErrorTypeDivideByZero, "")
-			}
-			res = append(res, MakeNumberResult(l.ValueNumber/r.ValueNumber))
-		case BinOpTypeExp:
-			res = append(res, MakeNumberResult(math.Pow(l.ValueNumber, r.ValueNumber)))
-		case BinOpTypeLT:
-			res = append(res, MakeBoolResult(l.ValueNumber < r.ValueNumber))
-		case BinOpTypeGT:
-			res = append(res, MakeBoolResult(l.ValueNumber > r.ValueNumber))
-		case BinOpTypeEQ:
-			res = append(res, MakeBoolResult(l.ValueNumber == r.ValueNumber))
-		case BinOpTypeLEQ:
-			res = append(res, MakeBoolResult(l.ValueNumber <= r.ValueNumber))
-		case BinOpTypeGEQ:
-			res = append(res, MakeBoolResult(l.ValueNumber >= r.ValueNumber))
-		case BinOpTypeNE:
-			res = append(res, MakeBoolResult(l.ValueNumber != r.ValueNumber))
-		// TODO: support concat here
-		// case BinOpTypeConcat:
-		default:
-			return MakeErrorResult(fmt.Sprintf("unsupported list binary op %s", op))
+		return MakeNumberResult(l.ValueNumber / r.ValueNumber)
+	case BinOpTypeExp:
+		return MakeNumberResult(math.Pow(l.ValueNumber, r.ValueNumber))
+	}
+	return MakeErrorResult(fmt.Sprintf("unsupported binary op %s", op))
+}
+
+// compareValues compares two single values as Excel's comparison operators
+// do, returning a negative number if lhs is less than rhs, a positive number if
+// it's greater, or zero if they're equal.  Numbers are less than text, which is
+// less than booleans, and text is compared case insensitively.  An empty value
+// is compared as zero, empty text or FALSE depending on the other value.
+func compareValues(lhs, rhs Result) int {
+	if lhs.Type == ResultTypeEmpty {
+		lhs = emptyAs(rhs)
+	}
+	if rhs.Type == ResultTypeEmpty {
+		rhs = emptyAs(lhs)
+	}
+	rank := func(r Result) int {
+		switch r.Type {
+		case ResultTypeNumber:
+			return 0
+		case ResultTypeBool:
+			return 2
 		}
+		return 1
 	}
-	return MakeListResult(res)
+	if lr, rr := rank(lhs), rank(rhs); lr != rr {
+		return lr - rr
+	}
+	if lhs.Type == ResultTypeNumber || lhs.Type == ResultTypeBool {
+		switch {
+		case lhs.ValueNumber < rhs.ValueNumber:
+			return -1
+		case lhs.ValueNumber > rhs.ValueNumber:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(lhs.Value()), strings.ToLower(rhs.Value()))
+}
+
+// emptyAs returns the value an empty value is equal to when compared to other.
+func emptyAs(other Result) Result {
+	switch other.Type {
+	case ResultTypeString:
+		return MakeStringResult("")
+	case ResultTypeBool:
+		return MakeBoolResult(false)
+	}
+	return MakeNumberResult(0)
 }
@@ -32,3 +32,18 @@ func (b Bool) Eval(ctx Context, ev Evaluator) Result {
 func (b Bool) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
+
+func (b Bool) References() []Reference {
+	return nil
+}
+
+func (b Bool) String() string {
+	if b.b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (b Bool) Update(q *UpdateQuery) Expression {
+	return b
+}
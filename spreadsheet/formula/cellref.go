@@ -25,3 +25,21 @@ func (c CellRef) Eval(ctx Context, ev Evaluator) Result {
 func (c CellRef) Reference(ctx Context, ev Evaluator) Reference {
 	return Reference{Type: ReferenceTypeCell, Value: c.s}
 }
+
+func (c CellRef) References() []Reference {
+	return []Reference{{Type: ReferenceTypeCell, Value: c.s}}
+}
+
+func (c CellRef) String() string {
+	return c.s
+}
+
+// Update returns the cell reference updated by the query, or #REF! if the
+// cell was removed.
+func (c CellRef) Update(q *UpdateQuery) Expression {
+	ref, ok := q.updateCell(c.s)
+	if !ok {
+		return refError()
+	}
+	return NewCellRef(ref)
+}
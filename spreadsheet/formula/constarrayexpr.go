@@ -7,6 +7,8 @@
 
 package formula
 
+import "strings"
+
 type ConstArrayExpr struct {
 	data [][]Expression
 }
@@ -30,3 +32,29 @@ func (c ConstArrayExpr) Eval(ctx Context, ev Evaluator) Result {
 func (c ConstArrayExpr) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
+
+func (c ConstArrayExpr) References() []Reference {
+	ret := []Reference{}
+	for _, row := range c.data {
+		for _, col := range row {
+			ret = append(ret, col.References()...)
+		}
+	}
+	return ret
+}
+
+func (c ConstArrayExpr) String() string {
+	rows := make([]string, len(c.data))
+	for i, row := range c.data {
+		rows[i] = joinStrings(row, ",")
+	}
+	return "{" + strings.Join(rows, ";") + "}"
+}
+
+func (c ConstArrayExpr) Update(q *UpdateQuery) Expression {
+	data := make([][]Expression, len(c.data))
+	for i, row := range c.data {
+		data[i] = updateAll(row, q)
+	}
+	return NewConstArrayExpr(data)
+}
@@ -7,6 +7,8 @@
 
 package formula
 
+import "time"
+
 // Context is a formula execution context.  Formula evaluation uses the context
 // to retreive information from sheets.
 type Context interface {
@@ -20,8 +22,30 @@ type Context interface {
 	// NamedRange returns a named range.
 	NamedRange(name string) Reference
 
+	// Table returns the table with a given name, used to evaluate structured
+	// references (e.g. Table1[Amount]).  An empty name refers to the table
+	// containing the cell being evaluated.
+	Table(name string) (Table, bool)
+
+	// Spill returns the result of the dynamic array formula in a cell, used to
+	// evaluate references to the range that the result spills into (e.g. A1#).
+	Spill(ref string, ev Evaluator) Result
+
+	// CurrentCell returns the reference of the cell whose formula is being
+	// evaluated (e.g. B3), or an empty string if there isn't one.  This is
+	// used by functions like ROW() that refer to the calling cell.
+	CurrentCell() string
+
+	// Formula returns the formula in a cell, or an empty string if the cell
+	// doesn't contain a formula.
+	Formula(ref string) string
+
 	// SetOffset is used so that the Context can evaluate cell references
 	// differently when they are not absolute (e.g. not like '$A$5').  See the
 	// shared formula support in Cell for usage.
 	SetOffset(col, row uint32)
+
+	// GetEpoch returns the date that serial date numbers are relative to, which
+	// depends on whether the workbook uses the 1900 or 1904 date system.
+	GetEpoch() time.Time
 }
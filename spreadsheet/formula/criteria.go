@@ -0,0 +1,347 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+type criteriaOp byte
+
+const (
+	criteriaEq criteriaOp = iota
+	criteriaNe
+	criteriaLt
+	criteriaLe
+	criteriaGt
+	criteriaGe
+)
+
+// criteria is a parsed criteria argument as used by COUNTIF, SUMIFS and
+// similar functions, e.g. 5, ">=10", "<>apple" or "a*".
+type criteria struct {
+	op      criteriaOp
+	isNum   bool
+	isBool  bool
+	num     float64
+	text    string
+	pattern *regexp.Regexp
+}
+
+var criteriaOps = []struct {
+	prefix string
+	op     criteriaOp
+}{
+	// two character operators must be checked first
+	{"<>", criteriaNe},
+	{"<=", criteriaLe},
+	{">=", criteriaGe},
+	{"<", criteriaLt},
+	{">", criteriaGt},
+	{"=", criteriaEq},
+}
+
+// parseCriteria parses a criteria argument.
+func parseCriteria(r Result) criteria {
+	switch r.Type {
+	case ResultTypeNumber:
+		return criteria{op: criteriaEq, isNum: true, num: r.ValueNumber}
+	case ResultTypeBool:
+		return criteria{op: criteriaEq, isBool: true, num: r.ValueNumber}
+	case ResultTypeEmpty:
+		// an empty criteria argument matches zero
+		return criteria{op: criteriaEq, isNum: true}
+	case ResultTypeList, ResultTypeArray:
+		// only the first value of an array is used as criteria
+		if vals := r.ListValues(); len(vals) > 0 {
+			return parseCriteria(vals[0])
+		}
+		return criteria{op: criteriaEq, isNum: true}
+	}
+
+	s := r.ValueString
+	c := criteria{op: criteriaEq}
+	for _, o := range criteriaOps {
+		if strings.HasPrefix(s, o.prefix) {
+			c.op = o.op
+			s = s[len(o.prefix):]
+			break
+		}
+	}
+	if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && s != "" {
+		c.isNum = true
+		c.num = f
+		return c
+	}
+	switch strings.ToUpper(s) {
+	case "TRUE":
+		c.isBool, c.num = true, 1
+		return c
+	case "FALSE":
+		c.isBool = true
+		return c
+	}
+	c.text = strings.ToLower(s)
+	if (c.op == criteriaEq || c.op == criteriaNe) && strings.ContainsAny(s, "*?~") {
+		c.pattern = wildcardToRegexp(s)
+	}
+	return c
+}
+
+// wildcardToRegexp converts an Excel wildcard pattern where '*' matches any
+// sequence of characters, '?' matches any single character and '~' escapes the
+// next character to a case insensitive regular expression.
+func wildcardToRegexp(s string) *regexp.Regexp {
+	buf := bytes.Buffer{}
+	buf.WriteString("(?is)^")
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '~':
+			escaped = true
+		case r == '*':
+			buf.WriteString(".*")
+		case r == '?':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		buf.WriteString("~")
+	}
+	buf.WriteString("$")
+	return regexp.MustCompile(buf.String())
+}
+
+func (c criteria) compare(cmp int) bool {
+	switch c.op {
+	case criteriaEq:
+		return cmp == 0
+	case criteriaNe:
+		return cmp != 0
+	case criteriaLt:
+		return cmp < 0
+	case criteriaLe:
+		return cmp <= 0
+	case criteriaGt:
+		return cmp > 0
+	case criteriaGe:
+		return cmp >= 0
+	}
+	return false
+}
+
+// matches returns true if the value satisfies the criteria.
+func (c criteria) matches(v Result) bool {
+	switch v.Type {
+	case ResultTypeError:
+		return false
+	case ResultTypeEmpty:
+		// "" and "=" match empty cells, "<>" matches non-empty cells
+		if !c.isNum && !c.isBool && c.text == "" {
+			return c.op == criteriaEq
+		}
+		return c.op == criteriaNe
+	}
+
+	// booleans only match boolean criteria
+	if c.isBool || v.Type == ResultTypeBool {
+		if !c.isBool || v.Type != ResultTypeBool {
+			return c.op == criteriaNe
+		}
+		return c.compare(int(v.ValueNumber - c.num))
+	}
+
+	if c.isNum {
+		n := v.ValueNumber
+		if v.Type == ResultTypeString {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v.ValueString), 64)
+			if err != nil || (c.op != criteriaEq && c.op != criteriaNe) {
+				// text never compares as less or greater than a number
+				return c.op == criteriaNe
+			}
+			n = f
+		}
+		switch {
+		case n < c.num:
+			return c.compare(-1)
+		case n > c.num:
+			return c.compare(1)
+		}
+		return c.compare(0)
+	}
+
+	if v.Type != ResultTypeString {
+		// numbers only match text criteria by inequality
+		return c.op == criteriaNe
+	}
+	if c.pattern != nil {
+		m := c.pattern.MatchString(v.ValueString)
+		return m == (c.op == criteriaEq)
+	}
+	return c.compare(strings.Compare(strings.ToLower(v.ValueString), c.text))
+}
+
+// flatten returns the values of a list or array result in row major order, or
+// a single element slice for any other result.
+func flatten(r Result) []Result {
+	if r.Type == ResultTypeList || r.Type == ResultTypeArray {
+		return r.ListValues()
+	}
+	return []Result{r}
+}
+
+// dims returns the number of rows and columns in a result.
+func dims(r Result) (int, int) {
+	switch r.Type {
+	case ResultTypeArray:
+		if len(r.ValueArray) == 0 {
+			return 0, 0
+		}
+		return len(r.ValueArray), len(r.ValueArray[0])
+	case ResultTypeList:
+		return 1, len(r.ValueList)
+	}
+	return 1, 1
+}
+
+// matchCriteria evaluates the range/criteria pairs used by the *IFS functions
+// and returns a mask of which values in the ranges satisfied every criteria.
+// The ranges must all be the same shape as the shape argument.
+func matchCriteria(shape Result, pairs []Result, fn string) ([]bool, Result) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, MakeErrorResult(fn + " requires range/criteria pairs")
+	}
+	rows, cols := dims(shape)
+	mask := make([]bool, rows*cols)
+	for i := range mask {
+		mask[i] = true
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		if r, c := dims(pairs[i]); r != rows || c != cols {
+			return nil, MakeErrorResult(fn + " ranges must all be the same size")
+		}
+		crit := parseCriteria(pairs[i+1])
+		for j, v := range flatten(pairs[i]) {
+			if mask[j] && !crit.matches(v) {
+				mask[j] = false
+			}
+		}
+	}
+	return mask, MakeEmptyResult()
+}
+
+// resize returns the values of a result resized to the given dimensions from
+// its top left corner, padding with empty values as necessary.
+func resize(r Result, rows, cols int) []Result {
+	arr := [][]Result{}
+	switch r.Type {
+	case ResultTypeArray:
+		arr = r.ValueArray
+	case ResultTypeList:
+		arr = [][]Result{r.ValueList}
+	default:
+		arr = [][]Result{{r}}
+	}
+	ret := make([]Result, 0, rows*cols)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			if i < len(arr) && j < len(arr[i]) {
+				ret = append(ret, arr[i][j])
+			} else {
+				ret = append(ret, MakeEmptyResult())
+			}
+		}
+	}
+	return ret
+}
+
+// selectNumbers returns the numbers in values whose corresponding mask entry is
+// set. Text and empty values are ignored, but errors are returned.
+func selectNumbers(values []Result, mask []bool) ([]float64, Result) {
+	ret := []float64{}
+	for i, v := range values {
+		if !mask[i] {
+			continue
+		}
+		switch v.Type {
+		case ResultTypeNumber:
+			ret = append(ret, v.ValueNumber)
+		case ResultTypeError:
+			return nil, v
+		}
+	}
+	return ret, MakeEmptyResult()
+}
+
+// resizeRange returns the values of a value range argument resized to the
+// given dimensions.  Like Excel, a reference to a range of a different size is
+// treated as a reference to a range of the same size as the criteria range
+// starting at the top left cell.
+func resizeRange(ctx Context, ev Evaluator, r Result, rows, cols int) []Result {
+	if r.Ref.Type != ReferenceTypeCell && r.Ref.Type != ReferenceTypeRange {
+		return resize(r, rows, cols)
+	}
+	if rr, rc := dims(r); rr == rows && rc == cols {
+		return flatten(r)
+	}
+	ref := r.Ref.Value
+	if sheet, rest, ok := reference.SplitSheetPrefix(ref); ok {
+		ctx, ref = ctx.Sheet(sheet), rest
+	}
+	from := strings.Split(ref, ":")[0]
+	col, row, err := ParseCellReference(from)
+	if err != nil {
+		return resize(r, rows, cols)
+	}
+	to := fmt.Sprintf("%s%d", reference.IndexToColumn(reference.ColumnToIndex(col)+uint32(cols)-1), int(row)+rows-1)
+	return resize(resultFromCellRange(ctx, ev, from, to), rows, cols)
+}
+
+// ifValues returns the numbers selected by the range, criteria and optional
+// value range arguments of functions like SUMIF and AVERAGEIF.
+func ifValues(ctx Context, ev Evaluator, args []Result, fn string) ([]float64, Result) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, MakeErrorResult(fn + " requires two or three arguments")
+	}
+	crit := parseCriteria(args[1])
+	candidates := flatten(args[0])
+	values := candidates
+	if len(args) == 3 {
+		rows, cols := dims(args[0])
+		values = resizeRange(ctx, ev, args[2], rows, cols)
+	}
+	mask := make([]bool, len(candidates))
+	for i, v := range candidates {
+		mask[i] = crit.matches(v)
+	}
+	return selectNumbers(values, mask)
+}
+
+// ifsValues returns the numbers selected by the value range and range/criteria
+// pair arguments of functions like SUMIFS and MAXIFS.
+func ifsValues(args []Result, fn string) ([]float64, Result) {
+	if len(args) < 3 {
+		return nil, MakeErrorResult(fn + " requires at least three arguments")
+	}
+	mask, err := matchCriteria(args[0], args[1:], fn)
+	if err.Type == ResultTypeError {
+		return nil, err
+	}
+	return selectNumbers(flatten(args[0]), mask)
+}
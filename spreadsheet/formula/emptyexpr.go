@@ -21,3 +21,15 @@ func (e EmptyExpr) Eval(ctx Context, ev Evaluator) Result {
 func (e EmptyExpr) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
+
+func (e EmptyExpr) References() []Reference {
+	return nil
+}
+
+func (e EmptyExpr) String() string {
+	return ""
+}
+
+func (e EmptyExpr) Update(q *UpdateQuery) Expression {
+	return e
+}
@@ -16,9 +16,22 @@ func NewError(v string) Expression {
 }
 
 func (e Error) Eval(ctx Context, ev Evaluator) Result {
-	return MakeErrorResult(e.s)
+	t, _ := ParseErrorType(e.s)
+	return MakeErrorResultType(t, e.s)
 }
 
 func (e Error) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
+
+func (e Error) References() []Reference {
+	return nil
+}
+
+func (e Error) String() string {
+	return e.s
+}
+
+func (e Error) Update(q *UpdateQuery) Expression {
+	return e
+}
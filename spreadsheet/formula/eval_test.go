@@ -12,8 +12,11 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/schema/soo/sml"
 	"github.com/unidoc/unioffice/spreadsheet"
 	"github.com/unidoc/unioffice/spreadsheet/formula"
 )
@@ -23,8 +26,8 @@ func TestEval(t *testing.T) {
 		Inp string
 		Exp string
 	}{
-		{"TRUE", "1 ResultTypeNumber"},
-		{"=FALSE", "0 ResultTypeNumber"},
+		{"TRUE", "TRUE ResultTypeBool"},
+		{"=FALSE", "FALSE ResultTypeBool"},
 		{"=1+2", "3 ResultTypeNumber"},
 		{"=1+2+3", "6 ResultTypeNumber"},
 		{"=1+2-3", "0 ResultTypeNumber"},
@@ -32,12 +35,14 @@ func TestEval(t *testing.T) {
 		{"=2*5-3", "7 ResultTypeNumber"},
 		{"=2*5+3*6-4", "24 ResultTypeNumber"},
 		{"=2^10", "1024 ResultTypeNumber"},
-		{"=1=1", "1 ResultTypeNumber"},
-		{"=1<>1", "0 ResultTypeNumber"},
-		{"=1<=5", "1 ResultTypeNumber"},
-		{"=1>=5", "0 ResultTypeNumber"},
-		{"=5*1>=5", "1 ResultTypeNumber"},
-		{"=5*1>=5+1", "0 ResultTypeNumber"},
+		{"=1&2*3", "16 ResultTypeString"},
+		{"=1+2&3", "33 ResultTypeString"},
+		{"=1=1", "TRUE ResultTypeBool"},
+		{"=1<>1", "FALSE ResultTypeBool"},
+		{"=1<=5", "TRUE ResultTypeBool"},
+		{"=1>=5", "FALSE ResultTypeBool"},
+		{"=5*1>=5", "TRUE ResultTypeBool"},
+		{"=5*1>=5+1", "FALSE ResultTypeBool"},
 		{"=A1", "1.23 ResultTypeNumber"},
 		{"A1", "1.23 ResultTypeNumber"},
 		{"=A1+A1", "2.46 ResultTypeNumber"},
@@ -45,7 +50,7 @@ func TestEval(t *testing.T) {
 		{"=SUM(1,2,3,4,5)", "15 ResultTypeNumber"},
 		{"SUM(-2,-3,2,3,4)", "4 ResultTypeNumber"},
 		{"SUM(B1:B3)", "6 ResultTypeNumber"},
-		{"TRUE()", "1 ResultTypeNumber"},
+		{"TRUE()", "TRUE ResultTypeBool"},
 		{`"test"`, "test ResultTypeString"},
 		{`"te""st"`, `te"st ResultTypeString`},
 	}
@@ -82,6 +87,72 @@ func TestMacExcelSheet(t *testing.T) {
 	testSheet("MacExcel365.xlsx", t)
 }
 
+// The datetime, financial and statistical sheets were written with unioffice
+// rather than saved by Excel.  Their cached values were entered by hand and
+// checked against independent calculations, but the sheets should be
+// replaced by ones recalculated and saved by Excel or LibreOffice.
+func TestDateTimeSheet(t *testing.T) {
+	testSheet("datetime.xlsx", t)
+}
+func TestFinancialSheet(t *testing.T) {
+	testSheet("financial.xlsx", t)
+}
+func TestStatisticalSheet(t *testing.T) {
+	testSheet("statistical.xlsx", t)
+}
+
+func TestDate1904(t *testing.T) {
+	wb := spreadsheet.New()
+	wb.X().WorkbookPr = sml.NewCT_WorkbookPr()
+	wb.X().WorkbookPr.Date1904Attr = unioffice.Bool(true)
+	sheet := wb.AddSheet()
+	ctx := sheet.FormulaContext()
+	ev := formula.NewEvaluator()
+
+	td := []struct {
+		Inp string
+		Exp string
+	}{
+		{"DATE(1904,1,2)", "1"},
+		{"DATE(2020,1,15)", "42383"},
+		{"YEAR(0)", "1904"},
+		{"DAY(0)", "1"},
+		{"WEEKDAY(0)", "6"},
+		{"DATEVALUE(\"2020-01-15\")", "42383"},
+	}
+	for _, tc := range td {
+		if got := ev.Eval(ctx, tc.Inp).Value(); got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+}
+
+func TestDateValueText(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	ctx := sheet.FormulaContext()
+	ev := formula.NewEvaluator()
+
+	td := []struct {
+		Inp string
+		Exp string
+	}{
+		{`DATEVALUE("15-Feb-2020")`, "43876"},
+		{`DATEVALUE("15-feb-20")`, "43876"},
+		{`DATEVALUE("15 Feb 2020")`, "43876"},
+		{`DATEVALUE("15 FEBRUARY 2020")`, "43876"},
+		{`DATEVALUE("March 15, 2020")`, "43905"},
+		{`DATEVALUE("Mar 15 2020")`, "43905"},
+		{`TIMEVALUE("March 15, 2020 6:00 pm")`, "0.75"},
+		{`TIMEVALUE("6:00 pm")`, "0.75"},
+	}
+	for _, tc := range td {
+		if got := ev.Eval(ctx, tc.Inp).Value(); got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+}
+
 func testSheet(fn string, t *testing.T) {
 	// TODO: uncomment once we quit building on 1.8
 	//t.Helper()
@@ -97,6 +168,12 @@ func testSheet(fn string, t *testing.T) {
 				// the value should have a computed value for the formula that
 				// Excel has cached
 				cachedValue := cell.GetCachedFormulaResult()
+				if cell.IsBool() {
+					cachedValue = cell.GetFormattedValue()
+				}
+				if v, ok := excelValues[sheet.Name()+"!"+cell.Reference()]; ok {
+					cachedValue = v
+				}
 				if cell.HasFormula() {
 					cellFormula := formula.ParseString(cell.GetFormula())
 					if cellFormula == nil {
@@ -120,6 +197,13 @@ func testSheet(fn string, t *testing.T) {
 	t.Logf("evaluated %d formulas from %s sheet", formulaCount, fn)
 }
 
+// excelValues are the values Excel computes for formulas in the reference
+// sheets whose cached values differ, as they were saved by LibreOffice which
+// treats booleans as numbers.
+var excelValues = map[string]string{
+	"Text!G3": "T", // LEFT(TRUE)
+}
+
 func cmpValue(l, r string) bool {
 	if l == r {
 		return true
@@ -179,3 +263,731 @@ func TestArrayFormula(t *testing.T) {
 	}
 
 }
+
+func TestReferences(t *testing.T) {
+	td := []struct {
+		Inp string
+		Exp []formula.Reference
+	}{
+		{"1+2", []formula.Reference{}},
+		{"A1+$B$2", []formula.Reference{
+			{Type: formula.ReferenceTypeCell, Value: "A1"},
+			{Type: formula.ReferenceTypeCell, Value: "$B$2"}}},
+		{"SUM(A1:B3,Sales)*-C1", []formula.Reference{
+			formula.MakeRangeReference("A1:B3"),
+			{Type: formula.ReferenceTypeNamedRange, Value: "Sales"},
+			{Type: formula.ReferenceTypeCell, Value: "C1"}}},
+		{"Sheet2!A1:B3+'Sheet 1'!C1", []formula.Reference{
+			formula.MakeRangeReference("'Sheet2'!A1:B3"),
+			{Type: formula.ReferenceTypeCell, Value: "'Sheet 1'!C1"}}},
+		{"SUM({1,2;3,D4})", []formula.Reference{
+			{Type: formula.ReferenceTypeCell, Value: "D4"}}},
+		{"SUM(Table1[[#Totals],[Qty]])+[@Price]", []formula.Reference{
+			{Type: formula.ReferenceTypeStructured, Value: "Table1[[#Totals],[Qty]]"},
+			{Type: formula.ReferenceTypeStructured, Value: "[@Price]"}}},
+	}
+	for _, tc := range td {
+		expr := formula.ParseString(tc.Inp)
+		if expr == nil {
+			t.Errorf("error parsing %s", tc.Inp)
+			continue
+		}
+		got := expr.References()
+		if len(got) != len(tc.Exp) {
+			t.Errorf("expected %d references for %s, got %v", len(tc.Exp), tc.Inp, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.Exp[i] {
+				t.Errorf("expected reference %v for %s, got %v", tc.Exp[i], tc.Inp, got[i])
+			}
+		}
+	}
+}
+
+func TestStructuredReference(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	other := wb.AddSheet()
+	sheet.Cell("B2").SetString("Item")
+	sheet.Cell("C2").SetString("Qty")
+	sheet.Cell("D2").SetString("Unit Price")
+	sheet.Cell("E2").SetString("Total")
+	for i, qty := range []float64{2, 3, 5} {
+		row := fmt.Sprintf("%d", i+3)
+		sheet.Cell("B" + row).SetString(fmt.Sprintf("item%d", i))
+		sheet.Cell("C" + row).SetNumber(qty)
+		sheet.Cell("D" + row).SetNumber(float64(i + 1))
+	}
+	tbl, err := sheet.AddTable("B2:E5")
+	if err != nil {
+		t.Fatalf("error adding table: %s", err)
+	}
+	total, _ := tbl.Column("Total")
+	total.SetCalculatedColumnFormula("[@Qty]*[@[Unit Price]]")
+	tbl.SetShowTotalsRow(true)
+	qty, _ := tbl.Column("Qty")
+	qty.SetTotalsRowFunction(sml.ST_TotalsRowFunctionSum)
+	sheet.RecalculateFormulas()
+
+	for _, tc := range []struct {
+		cell string
+		exp  string
+	}{
+		{"E3", "2"},
+		{"E4", "6"},
+		{"E5", "15"},
+		{"C6", "10"},
+	} {
+		if got := sheet.Cell(tc.cell).GetFormattedValue(); got != tc.exp {
+			t.Errorf("expected %s = %s, got %s", tc.cell, tc.exp, got)
+		}
+	}
+
+	ctx := other.FormulaContext()
+	ev := formula.NewEvaluator()
+	for _, tc := range []struct {
+		Inp string
+		Exp string
+	}{
+		{"SUM(Table1[Qty])", "10 ResultTypeNumber"},
+		{"SUM(Table1[[Qty]:[Unit Price]])", "16 ResultTypeNumber"},
+		{"Table1[[#Totals],[Qty]]", "10 ResultTypeNumber"},
+		{"SUBTOTAL(101,Table1[Unit Price])", "2 ResultTypeNumber"},
+		{"Table1[[#Headers],[Unit Price]]", "Unit Price ResultTypeString"},
+		{"COUNTA(Table1[#All])", "17 ResultTypeNumber"},
+		{"COUNTA(Table1[])", "12 ResultTypeNumber"},
+		{"COUNTA(Table1[[#Data],[#Totals],[Item]])", "3 ResultTypeNumber"},
+		{`Table1[Missing]`, "#REF! ResultTypeError"},
+		{`Missing[Qty]`, "#REF! ResultTypeError"},
+		{`[@Qty]`, "#REF! ResultTypeError"},
+		{`"[x]"&Table1[[#Headers],[Item]]`, "[x]Item ResultTypeString"},
+	} {
+		result := ev.Eval(ctx, tc.Inp)
+		got := fmt.Sprintf("%s %s", result.Value(), result.Type)
+		if got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+}
+
+func TestDynamicArrays(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	for i, v := range []struct {
+		name string
+		qty  float64
+	}{{"b", 3}, {"a", 1}, {"c", 4}, {"a", 1}, {"d", 5}} {
+		row := fmt.Sprintf("%d", i+1)
+		sheet.Cell("A" + row).SetString(v.name)
+		sheet.Cell("B" + row).SetNumber(v.qty)
+	}
+	ctx := sheet.FormulaContext()
+	ev := formula.NewEvaluator()
+
+	for _, tc := range []struct {
+		Inp string
+		Exp string
+	}{
+		{"SUM(_xlfn.SEQUENCE(4))", "10 ResultTypeNumber"},
+		{"INDEX(_xlfn.SEQUENCE(2,3,10,5),2,3)", "35 ResultTypeNumber"},
+		{"_xlfn.SEQUENCE(0)", "#CALC! ResultTypeError"},
+		{"SUM(_xlfn._xlws.FILTER(B1:B5,B1:B5>2))", "12 ResultTypeNumber"},
+		{`_xlfn._xlws.FILTER(B1:B5,A1:A5="z")`, "#CALC! ResultTypeError"},
+		{`_xlfn._xlws.FILTER(B1:B5,A1:A5="z","none")`, "none ResultTypeString"},
+		{"INDEX(_xlfn._xlws.SORT(A1:A5),1,1)", "a ResultTypeString"},
+		{"INDEX(_xlfn._xlws.SORT(B1:B5,1,-1),1,1)", "5 ResultTypeNumber"},
+		{"INDEX(_xlfn.SORTBY(A1:A5,B1:B5,-1),1,1)", "d ResultTypeString"},
+		{"COUNTA(_xlfn.UNIQUE(A1:A5))", "4 ResultTypeNumber"},
+		{"COUNTA(_xlfn.UNIQUE(A1:A5,FALSE,TRUE))", "3 ResultTypeNumber"},
+		{`_xlfn.XLOOKUP("c",A1:A5,B1:B5)`, "4 ResultTypeNumber"},
+		{`_xlfn.XLOOKUP("z",A1:A5,B1:B5,"missing")`, "missing ResultTypeString"},
+		{`_xlfn.XLOOKUP("a",A1:A5,B1:B5,,0,-1)`, "1 ResultTypeNumber"},
+		{`_xlfn.XMATCH("a",A1:A5)`, "2 ResultTypeNumber"},
+		{`_xlfn.XMATCH("a",A1:A5,0,-1)`, "4 ResultTypeNumber"},
+		{"_xlfn.LET(_xlpm.x,B3*2,_xlpm.x+1)", "9 ResultTypeNumber"},
+		{"_xlfn.LET(_xlpm.x,2,_xlpm.y,_xlpm.x*3,_xlpm.x+_xlpm.y)", "8 ResultTypeNumber"},
+		{"_xlfn.LET(_xlpm.r,B1:B5,SUM(_xlpm.r))", "14 ResultTypeNumber"},
+	} {
+		result := ev.Eval(ctx, tc.Inp)
+		got := fmt.Sprintf("%s %s", result.Value(), result.Type)
+		if got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+
+	// spill references are parsed both in the cell and file forms
+	for _, inp := range []string{"SUM(C1#)", "SUM(_xlfn.ANCHORARRAY(C1))"} {
+		expr := formula.ParseString(inp)
+		if expr == nil {
+			t.Errorf("error parsing %s", inp)
+			continue
+		}
+		refs := expr.References()
+		if len(refs) != 1 || refs[0].Value != "C1" {
+			t.Errorf("expected C1 to be referenced by %s, got %v", inp, refs)
+		}
+	}
+}
+
+func TestLambda(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	for i, v := range []float64{1, 2, 3} {
+		row := fmt.Sprintf("%d", i+1)
+		sheet.Cell("A" + row).SetNumber(v)
+		sheet.Cell("B" + row).SetNumber(v * 10)
+	}
+	wb.AddDefinedName("TAXCALC", "_xlfn.LAMBDA(_xlpm.x,_xlpm.x*0.2)")
+	wb.AddDefinedName("Hypot", "_xlfn.LAMBDA(_xlpm.a,_xlpm.b,SQRT(_xlpm.a^2+_xlpm.b^2))")
+	wb.AddDefinedName("Rate", "0.5")
+	wb.AddDefinedName("FACT2", "_xlfn.LAMBDA(_xlpm.n,IF(_xlpm.n<=1,1,_xlpm.n*FACT2(_xlpm.n-1)))")
+	wb.AddDefinedName("LOOP", "_xlfn.LAMBDA(_xlpm.n,LOOP(_xlpm.n+1))")
+	ctx := sheet.FormulaContext()
+	ev := formula.NewEvaluator()
+
+	for _, tc := range []struct {
+		Inp string
+		Exp string
+	}{
+		{"TAXCALC(100)", "20 ResultTypeNumber"},
+		{"TAXCALC(A3)+1", "1.6 ResultTypeNumber"},
+		{"Hypot(3,4)", "5 ResultTypeNumber"},
+		{"Hypot(3)", "#VALUE! ResultTypeError"},
+		{"Rate(1)", "#VALUE! ResultTypeError"},
+		{"_xlfn.LET(_xlpm.f,_xlfn.LAMBDA(_xlpm.x,_xlpm.x+1),_xlpm.f(2))", "3 ResultTypeNumber"},
+		// parameters hide names bound outside the function
+		{"_xlfn.LET(_xlpm.x,5,_xlpm.f,_xlfn.LAMBDA(_xlpm.x,_xlpm.x*2),_xlpm.f(1)+_xlpm.x)", "7 ResultTypeNumber"},
+		// and names bound where the function is created are visible in it
+		{"_xlfn.LET(_xlpm.y,5,_xlpm.f,_xlfn.LAMBDA(_xlpm.x,_xlpm.x*_xlpm.y),_xlpm.f(2))", "10 ResultTypeNumber"},
+		{"SUM(_xlfn.MAP(A1:A3,_xlfn.LAMBDA(_xlpm.x,_xlpm.x*2)))", "12 ResultTypeNumber"},
+		{"SUM(_xlfn.MAP(A1:A3,B1:B3,_xlfn.LAMBDA(_xlpm.x,_xlpm.y,_xlpm.x+_xlpm.y)))", "66 ResultTypeNumber"},
+		{"SUM(_xlfn.MAP(A1:A3,TAXCALC))", "1.2 ResultTypeNumber"},
+		{"_xlfn.MAP(A1:A3,B1:B2,_xlfn.LAMBDA(_xlpm.x,_xlpm.y,_xlpm.x+_xlpm.y))", "#VALUE! ResultTypeError"},
+		{"_xlfn.REDUCE(0,A1:B3,_xlfn.LAMBDA(_xlpm.a,_xlpm.v,_xlpm.a+_xlpm.v))", "66 ResultTypeNumber"},
+		{"_xlfn.REDUCE(,A1:A3,_xlfn.LAMBDA(_xlpm.a,_xlpm.v,_xlpm.a+_xlpm.v))", "6 ResultTypeNumber"},
+		{"INDEX(_xlfn.SCAN(1,A1:A3,_xlfn.LAMBDA(_xlpm.a,_xlpm.v,_xlpm.a*_xlpm.v)),3,1)", "6 ResultTypeNumber"},
+		{"INDEX(_xlfn.BYROW(A1:B3,_xlfn.LAMBDA(_xlpm.r,SUM(_xlpm.r))),2,1)", "22 ResultTypeNumber"},
+		{"INDEX(_xlfn.BYCOL(A1:B3,_xlfn.LAMBDA(_xlpm.c,MAX(_xlpm.c))),1,2)", "30 ResultTypeNumber"},
+		{"SUM(_xlfn.MAKEARRAY(2,3,_xlfn.LAMBDA(_xlpm.r,_xlpm.c,_xlpm.r*_xlpm.c)))", "18 ResultTypeNumber"},
+		{"_xlfn.MAP(A1:A3,_xlfn.LAMBDA(_xlpm.x,_xlpm.y,_xlpm.x))", "#VALUE! ResultTypeError"},
+		{"_xlfn.LAMBDA(_xlpm.x,_xlpm.x)", "#CALC! ResultTypeLambda"},
+		// recursive functions end with the branch of an IF that isn't recursive
+		{"FACT2(5)", "120 ResultTypeNumber"},
+		{"FACT2(10)", "3628800 ResultTypeNumber"},
+		{"LOOP(1)", "#NUM! ResultTypeError"},
+		// branches that aren't chosen aren't evaluated
+		{"IF(TRUE,1,LOOP(1))", "1 ResultTypeNumber"},
+		{"IF(A1>5,LOOP(1),2)", "2 ResultTypeNumber"},
+		{"IFERROR(1/0,3)", "3 ResultTypeNumber"},
+		{"IFERROR(4,LOOP(1))", "4 ResultTypeNumber"},
+		{"_xlfn.IFNA(5,LOOP(1))", "5 ResultTypeNumber"},
+		{"CHOOSE(2,LOOP(1),7)", "7 ResultTypeNumber"},
+		// a function can be called where it's created
+		{"_xlfn.LAMBDA(_xlpm.x,_xlpm.x+1)(5)", "6 ResultTypeNumber"},
+		{"_xlfn.LAMBDA(_xlpm.x,_xlpm.y,_xlpm.x*_xlpm.y)(A2,B3)", "60 ResultTypeNumber"},
+		{"_xlfn.LAMBDA(42)()", "42 ResultTypeNumber"},
+		{"_xlfn.LAMBDA(_xlpm.x,_xlpm.x+1)()", "#VALUE! ResultTypeError"},
+		{"SUM(1,2)(3)", "#VALUE! ResultTypeError"},
+	} {
+		result := ev.Eval(ctx, tc.Inp)
+		got := fmt.Sprintf("%s %s", result.Value(), result.Type)
+		if got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+
+	// a named function is used like a built in function
+	sheet.Cell("C1").SetFormulaRaw("TAXCALC(B1)")
+	sheet.Cell("C2").SetFormulaRaw("_xlfn.LAMBDA(_xlpm.x,_xlpm.x)")
+	wb.RecalculateFormulas()
+	if got := sheet.Cell("C1").GetFormattedValue(); got != "2" {
+		t.Errorf("expected 2 in C1, got %s", got)
+	}
+	if got := sheet.Cell("C2").GetFormattedValue(); got != "#CALC!" {
+		t.Errorf("expected #CALC! for a formula returning a LAMBDA function, got %s", got)
+	}
+}
+
+func TestInformationFunctions(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	other := wb.AddSheet()
+	sheet.Cell("A1").SetNumber(3)
+	sheet.Cell("A2").SetString("text")
+	sheet.Cell("A3").SetFormulaRaw("A1*2")
+	sheet.Cell("B1").SetString("a")
+	sheet.Cell("B2").SetString("b")
+	sheet.Cell("B3").SetString("c")
+	sheet.Cell("C1").SetNumber(10)
+	sheet.Cell("C2").SetNumber(20)
+	sheet.Cell("C3").SetNumber(30)
+	other.Cell("B2").SetNumber(1)
+	wb.AddDefinedName("Areas", "'Sheet 1'!$A$1:$A$2,'Sheet 1'!$C$1")
+	ctx := sheet.FormulaContext()
+	ev := formula.NewEvaluator()
+
+	for _, tc := range []struct {
+		Inp string
+		Exp string
+	}{
+		{"ISBLANK(D1)", "TRUE ResultTypeBool"},
+		{"ISBLANK(A1)", "FALSE ResultTypeBool"},
+		{"ISNUMBER(A1)", "TRUE ResultTypeBool"},
+		{"ISNUMBER(A2)", "FALSE ResultTypeBool"},
+		{"ISTEXT(A2)", "TRUE ResultTypeBool"},
+		{"ISERROR(1/0)", "TRUE ResultTypeBool"},
+		{"ISERR(NA())", "FALSE ResultTypeBool"},
+		{"ISNA(NA())", "TRUE ResultTypeBool"},
+		{"ISREF(A1:B2)", "TRUE ResultTypeBool"},
+		{"ISREF(1)", "FALSE ResultTypeBool"},
+		{"_xlfn.ISFORMULA(A3)", "TRUE ResultTypeBool"},
+		{"_xlfn.ISFORMULA(A1)", "FALSE ResultTypeBool"},
+		{"ISEVEN(-2.5)", "TRUE ResultTypeBool"},
+		{"ISODD(A1)", "TRUE ResultTypeBool"},
+		{"ISODD(A2)", "#VALUE! ResultTypeError"},
+		{"TYPE(A1)", "1 ResultTypeNumber"},
+		{"TYPE(A2)", "2 ResultTypeNumber"},
+		{"TYPE(1/0)", "16 ResultTypeNumber"},
+		{"TYPE({1,2})", "64 ResultTypeNumber"},
+		{"N(A2)", "0 ResultTypeNumber"},
+		{"N(A1)", "3 ResultTypeNumber"},
+		{"ERROR.TYPE(1/0)", "2 ResultTypeNumber"},
+		{"ERROR.TYPE(1)", "#N/A ResultTypeError"},
+		{`CELL("address",B2)`, "$B$2 ResultTypeString"},
+		{`CELL("address",'Sheet 2'!B2)`, "'Sheet 2'!$B$2 ResultTypeString"},
+		{`CELL("col",C3)`, "3 ResultTypeNumber"},
+		{`CELL("contents",'Sheet 2'!B2)`, "1 ResultTypeNumber"},
+		{`CELL("type",A2)`, "l ResultTypeString"},
+		{`CELL("type",D1)`, "b ResultTypeString"},
+		{`INFO("recalc")`, "Automatic ResultTypeString"},
+		{`MATCH("b",B1:B3,0)`, "2 ResultTypeNumber"},
+		{`MATCH("?",B1:B3,0)`, "1 ResultTypeNumber"},
+		{"MATCH(25,C1:C3)", "2 ResultTypeNumber"},
+		{"MATCH(5,C1:C3)", "#N/A ResultTypeError"},
+		{"MATCH(25,{30,20,10},-1)", "1 ResultTypeNumber"},
+		{`CHOOSE(2,"x","y","z")`, "y ResultTypeString"},
+		{`CHOOSE(4,"x","y","z")`, "#VALUE! ResultTypeError"},
+		{"ROW(C3)", "3 ResultTypeNumber"},
+		{"SUM(ROW(A2:A4))", "9 ResultTypeNumber"},
+		{"COLUMN(C3)", "3 ResultTypeNumber"},
+		{"ROWS(A1:C3)", "3 ResultTypeNumber"},
+		{"COLUMNS(A1:D2)", "4 ResultTypeNumber"},
+		{"COLUMNS({1,2,3})", "3 ResultTypeNumber"},
+		{"ADDRESS(2,3)", "$C$2 ResultTypeString"},
+		{"ADDRESS(2,3,4)", "C2 ResultTypeString"},
+		{"ADDRESS(2,3,2,FALSE)", "R2C[3] ResultTypeString"},
+		{`ADDRESS(2,3,1,TRUE,"Data")`, "'Data'!$C$2 ResultTypeString"},
+		{"AREAS(A1:B2)", "1 ResultTypeNumber"},
+		{"AREAS(Areas)", "2 ResultTypeNumber"},
+		{`HYPERLINK("http://example.com","Example")`, "Example ResultTypeString"},
+		{"_xlfn.FORMULATEXT(A3)", "=A1*2 ResultTypeString"},
+		{"_xlfn.FORMULATEXT(A1)", "#N/A ResultTypeError"},
+	} {
+		result := ev.Eval(ctx, tc.Inp)
+		got := fmt.Sprintf("%s %s", result.Value(), result.Type)
+		if got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+
+	// functions without a reference use the cell containing the formula
+	sheet.Cell("E4").SetFormulaRaw("ROW()*100+COLUMN()")
+	sheet.Cell("E5").SetFormulaRaw(`CELL("address")`)
+	wb.RecalculateFormulas()
+	if got := sheet.Cell("E4").GetFormattedValue(); got != "405" {
+		t.Errorf("expected 405 in E4, got %s", got)
+	}
+	if got := sheet.Cell("E5").GetFormattedValue(); got != "$E$5" {
+		t.Errorf("expected $E$5 in E5, got %s", got)
+	}
+}
+
+func TestBooleanArguments(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetNumber(1)
+	sheet.Cell("A2").SetBool(true)
+	sheet.Cell("A3").SetString("x")
+	sheet.Cell("B1").SetNumber(2)
+	sheet.Cell("B2").SetNumber(3)
+	sheet.Cell("B3").SetBool(true)
+	ctx := sheet.FormulaContext()
+	ev := formula.NewEvaluator()
+
+	// booleans typed as arguments are counted, those in cells aren't
+	for _, tc := range []struct {
+		Inp string
+		Exp string
+	}{
+		{"COUNT(A1:A3)", "1 ResultTypeNumber"},
+		{"COUNT(A1,A2,A3)", "1 ResultTypeNumber"},
+		{`COUNT(1,TRUE,"x")`, "2 ResultTypeNumber"},
+		{"COUNTA(A1:A3)", "3 ResultTypeNumber"},
+		{"SUM(B1:B3)", "5 ResultTypeNumber"},
+		{"SUM(B3)", "0 ResultTypeNumber"},
+		{"SUM(2,3,TRUE)", "6 ResultTypeNumber"},
+		{"SUM(2,3,1=1)", "6 ResultTypeNumber"},
+		{"SUM({2,3,TRUE})", "5 ResultTypeNumber"},
+		{"PRODUCT(B1:B3)", "6 ResultTypeNumber"},
+		{"PRODUCT(2,3,FALSE)", "0 ResultTypeNumber"},
+		{"AVERAGE(B1:B3)", "2.5 ResultTypeNumber"},
+		{"AVERAGE(2,3,TRUE)", "2 ResultTypeNumber"},
+		{"AVERAGEA(B1:B3)", "2 ResultTypeNumber"},
+		{"MAX(A1:A3)", "1 ResultTypeNumber"},
+		{"MIN(B1:B3,TRUE)", "1 ResultTypeNumber"},
+	} {
+		result := ev.Eval(ctx, tc.Inp)
+		got := fmt.Sprintf("%s %s", result.Value(), result.Type)
+		if got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+}
+
+func TestEngineeringFunctions(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetString("3+4i")
+	sheet.Cell("A2").SetString("1-i")
+	sheet.Cell("A3").SetString("2")
+	ctx := sheet.FormulaContext()
+	ev := formula.NewEvaluator()
+
+	for _, tc := range []struct {
+		Inp string
+		Exp string
+	}{
+		{"DEC2BIN(9,4)", "1001 ResultTypeString"},
+		{"DEC2BIN(-1)", "1111111111 ResultTypeString"},
+		{"DEC2BIN(512)", "#NUM! ResultTypeError"},
+		{"DEC2BIN(9,2)", "#NUM! ResultTypeError"},
+		{"DEC2HEX(255)", "FF ResultTypeString"},
+		{"DEC2HEX(-54)", "FFFFFFFFCA ResultTypeString"},
+		{"DEC2OCT(58,3)", "072 ResultTypeString"},
+		{`BIN2DEC("1111111111")`, "-1 ResultTypeNumber"},
+		{"BIN2DEC(1100100)", "100 ResultTypeNumber"},
+		{`BIN2DEC("102")`, "#NUM! ResultTypeError"},
+		{`HEX2DEC("A5")`, "165 ResultTypeNumber"},
+		{`HEX2DEC("FFFFFFFF5B")`, "-165 ResultTypeNumber"},
+		{`HEX2BIN("F",8)`, "00001111 ResultTypeString"},
+		{`HEX2OCT("FFFFFFFF00")`, "7777777400 ResultTypeString"},
+		{`OCT2HEX("7777777533")`, "FFFFFFFF5B ResultTypeString"},
+		{`OCT2BIN("3")`, "11 ResultTypeString"},
+		{"_xlfn.BITAND(13,25)", "9 ResultTypeNumber"},
+		{"_xlfn.BITOR(23,10)", "31 ResultTypeNumber"},
+		{"_xlfn.BITXOR(5,3)", "6 ResultTypeNumber"},
+		{"_xlfn.BITLSHIFT(4,2)", "16 ResultTypeNumber"},
+		{"_xlfn.BITLSHIFT(4,-2)", "1 ResultTypeNumber"},
+		{"_xlfn.BITRSHIFT(13,2)", "3 ResultTypeNumber"},
+		{"_xlfn.BITAND(-1,1)", "#NUM! ResultTypeError"},
+		{"DELTA(5,4)", "0 ResultTypeNumber"},
+		{"DELTA(0)", "1 ResultTypeNumber"},
+		{"GESTEP(5,4)", "1 ResultTypeNumber"},
+		{"GESTEP(-4)", "0 ResultTypeNumber"},
+		{"ROUND(ERF(0.745),8)", "0.70792892 ResultTypeNumber"},
+		{"ROUND(ERF(0,1),9)", "0.842700793 ResultTypeNumber"},
+		{"ROUND(ERFC(1),9)", "0.157299207 ResultTypeNumber"},
+		{"ROUND(BESSELI(1.5,1),6)", "0.981666 ResultTypeNumber"},
+		{"ROUND(BESSELJ(1.9,2),6)", "0.329926 ResultTypeNumber"},
+		{"ROUND(BESSELK(1.5,1),6)", "0.277388 ResultTypeNumber"},
+		{"ROUND(BESSELY(2.5,1),6)", "0.145918 ResultTypeNumber"},
+		{"BESSELY(-1,1)", "#NUM! ResultTypeError"},
+		{"COMPLEX(3,4)", "3+4i ResultTypeString"},
+		{`COMPLEX(0,-1,"j")`, "-j ResultTypeString"},
+		{`COMPLEX(1,1,"k")`, "#VALUE! ResultTypeError"},
+		{"IMABS(A1)", "5 ResultTypeNumber"},
+		{"IMREAL(A1)", "3 ResultTypeNumber"},
+		{"IMAGINARY(A2)", "-1 ResultTypeNumber"},
+		{"IMCONJUGATE(A1)", "3-4i ResultTypeString"},
+		{"IMSUM(A1:A3)", "6+3i ResultTypeString"},
+		{"IMSUB(A1,A2)", "2+5i ResultTypeString"},
+		{"IMPRODUCT(A1,A2)", "7+i ResultTypeString"},
+		{`IMDIV("-238+240i","10+24i")`, "5+12i ResultTypeString"},
+		{`IMDIV(A1,0)`, "#NUM! ResultTypeError"},
+		{`IMPOWER("2+3i",3)`, "-46+9.00000000000001i ResultTypeString"},
+		{`IMSQRT("-4")`, "2i ResultTypeString"},
+		{`IMSUM("1+i","1+j")`, "#VALUE! ResultTypeError"},
+		{`IMABS("1+2k")`, "#NUM! ResultTypeError"},
+		{`IMLN(0)`, "#NUM! ResultTypeError"},
+		{`IMARGUMENT(0)`, "#DIV/0! ResultTypeError"},
+		{`CONVERT(1,"lbm","kg")`, "0.45359237 ResultTypeNumber"},
+		{`CONVERT(68,"F","C")`, "20 ResultTypeNumber"},
+		{`CONVERT(2.5,"ft","sec")`, "#N/A ResultTypeError"},
+		{`CONVERT(300,"mK","C")`, "-272.85 ResultTypeNumber"},
+		{`CONVERT(1,"km","m")`, "1000 ResultTypeNumber"},
+		{`CONVERT(1,"km2","m2")`, "1000000 ResultTypeNumber"},
+		{`CONVERT(1,"kibyte","bit")`, "8192 ResultTypeNumber"},
+		{`CONVERT(1,"xyz","m")`, "#N/A ResultTypeError"},
+	} {
+		result := ev.Eval(ctx, tc.Inp)
+		got := fmt.Sprintf("%s %s", result.Value(), result.Type)
+		if got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+}
+
+func TestDatabaseFunctions(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	for r, row := range [][]interface{}{
+		{"Tree", "Height", "Age", "Yield", "Profit"},
+		{"Apple", 18, 20, 14, 105},
+		{"Pear", 12, 12, 10, 96},
+		{"Cherry", 13, 14, 9, 105},
+		{"Apple", 14, nil, 10, 75},
+		{"Pear", 9, 8, 8, 76.8},
+		{"Apple", 8, 9, 6, 45},
+	} {
+		for c, v := range row {
+			cell := sheet.Cell(fmt.Sprintf("%c%d", 'A'+c, r+1))
+			switch v := v.(type) {
+			case string:
+				cell.SetString(v)
+			case int:
+				cell.SetNumber(float64(v))
+			case float64:
+				cell.SetNumber(v)
+			}
+		}
+	}
+	// apples taller than 10, or any pear
+	sheet.Cell("H1").SetString("Tree")
+	sheet.Cell("I1").SetString("Height")
+	sheet.Cell("H2").SetString("Apple")
+	sheet.Cell("I2").SetString(">10")
+	sheet.Cell("H3").SetString("=Pear")
+	// cherries
+	sheet.Cell("K1").SetString("Tree")
+	sheet.Cell("K2").SetString("Ch")
+	ctx := sheet.FormulaContext()
+	ev := formula.NewEvaluator()
+
+	for _, tc := range []struct {
+		Inp string
+		Exp string
+	}{
+		{`DSUM(A1:E7,"Profit",H1:I3)`, "352.8 ResultTypeNumber"},
+		{`DSUM(A1:E7,5,A1:A1)`, "502.8 ResultTypeNumber"},
+		{`DCOUNT(A1:E7,"Age",H1:I3)`, "3 ResultTypeNumber"},
+		{`DCOUNT(A1:E7,,H1:I3)`, "4 ResultTypeNumber"},
+		{`DCOUNTA(A1:E7,"tree",H1:I3)`, "4 ResultTypeNumber"},
+		{`DAVERAGE(A1:E7,"Yield",H1:I3)`, "10.5 ResultTypeNumber"},
+		{`DMAX(A1:E7,"Profit",H1:I3)`, "105 ResultTypeNumber"},
+		{`DMIN(A1:E7,"Profit",H1:I3)`, "75 ResultTypeNumber"},
+		{`DPRODUCT(A1:E7,"Yield",H1:I3)`, "11200 ResultTypeNumber"},
+		{`DGET(A1:E7,"Yield",K1:K2)`, "9 ResultTypeNumber"},
+		{`DGET(A1:E7,"Yield",H1:I3)`, "#NUM! ResultTypeError"},
+		{`DGET(A1:E7,"Yield",H1:H1)`, "#NUM! ResultTypeError"},
+		{`DGET(A1:E7,"Color",K1:K2)`, "#VALUE! ResultTypeError"},
+		{`ROUND(DSTDEV(A1:E7,"Yield",H1:I3),3)`, "2.517 ResultTypeNumber"},
+		{`DVARP(A1:E7,"Yield",K1:K2)`, "0 ResultTypeNumber"},
+		{`DVAR(A1:E7,"Yield",K1:K2)`, "#DIV/0! ResultTypeError"},
+	} {
+		result := ev.Eval(ctx, tc.Inp)
+		got := fmt.Sprintf("%s %s", result.Value(), result.Type)
+		if got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetNumber(2)
+	ctx := sheet.FormulaContext()
+
+	reg := formula.NewRegistry()
+	reg.RegisterFunction("DOUBLE", func(args []formula.Result) formula.Result {
+		return formula.MakeNumberResult(2 * args[0].AsNumber().ValueNumber)
+	})
+	reg.RegisterFunctionInfo("DOUBLE", formula.FunctionInfo{MinArgs: 1, MaxArgs: 1})
+	// overriding a built in function only affects this registry
+	reg.RegisterFunction("ABS", func(args []formula.Result) formula.Result {
+		return formula.MakeNumberResult(-1)
+	})
+	custom := formula.NewEvaluatorWithRegistry(reg)
+	builtin := formula.NewEvaluator()
+
+	for _, tc := range []struct {
+		Ev  formula.Evaluator
+		Inp string
+		Exp string
+	}{
+		{custom, "DOUBLE(A1)+SUM(1,2)", "7 ResultTypeNumber"},
+		{custom, "DOUBLE(A1,1)", "#VALUE! ResultTypeError"},
+		{custom, "ABS(-3)", "-1 ResultTypeNumber"},
+		{builtin, "ABS(-3)", "3 ResultTypeNumber"},
+		{builtin, "DOUBLE(A1)", "#VALUE! ResultTypeError"},
+		{builtin, "RAND(1)", "#VALUE! ResultTypeError"},
+	} {
+		result := tc.Ev.Eval(ctx, tc.Inp)
+		got := fmt.Sprintf("%s %s", result.Value(), result.Type)
+		if got != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+
+	if formula.RegistryOf(custom) != reg {
+		t.Errorf("expected the evaluator's registry")
+	}
+	if !reg.IsVolatile("1+NOW()") {
+		t.Errorf("expected NOW() to be volatile")
+	}
+	if reg.IsVolatile("DOUBLE(A1)") {
+		t.Errorf("expected DOUBLE() not to be volatile")
+	}
+}
+
+// TestEvaluatorConcurrent shares an evaluator between goroutines and should
+// be run with -race.
+func TestEvaluatorConcurrent(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	for i := 1; i <= 10; i++ {
+		sheet.Cell(fmt.Sprintf("A%d", i)).SetNumber(float64(i))
+	}
+	sheet.Cell("B1").SetFormulaRaw("SUM(A1:A10)")
+	ev := formula.NewEvaluator()
+
+	wg := sync.WaitGroup{}
+	errs := make(chan string, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			ctx := sheet.FormulaContext()
+			for i := 1; i <= 50; i++ {
+				// each goroutine parses new formulas and reuses the ones
+				// other goroutines have parsed
+				inp := fmt.Sprintf("B1+A%d*%d", i%10+1, (g+i)%4)
+				exp := 55 + float64(i%10+1)*float64((g+i)%4)
+				if got := ev.Eval(ctx, inp); got.ValueNumber != exp {
+					errs <- fmt.Sprintf("expected %s = %v, got %s", inp, exp, got.Value())
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestUpdateFormula(t *testing.T) {
+	for _, tc := range []struct {
+		Inp string
+		Q   formula.UpdateQuery
+		Exp string
+	}{
+		// round trip
+		{`SUM(A1:B2,$C$3)*D4^2&"a""b"`, formula.UpdateQuery{}, `SUM(A1:B2,$C$3)*D4^2&"a""b"`},
+		{`(1+2)*3-(4-5)`, formula.UpdateQuery{}, `(1+2)*3-(4-5)`},
+		{`(A1&B1)*2&A1&B1*2`, formula.UpdateQuery{}, `(A1&B1)*2&A1&B1*2`},
+		{`1+2&3=(4&5)+6`, formula.UpdateQuery{}, `1+2&3=(4&5)+6`},
+		{`(-A1)^2+{1,2;3,4}`, formula.UpdateQuery{}, `(-A1)^2+{1,2;3,4}`},
+		{`IF(A1,,"x")`, formula.UpdateQuery{}, `IF(A1,,"x")`},
+		{`_xlfn.LET(_xlpm.x,A1,_xlpm.x+1)`, formula.UpdateQuery{}, `_xlfn.LET(_xlpm.x,A1,_xlpm.x+1)`},
+		// copying a formula
+		{`A1+$B$1+C$2+'My Sheet'!$D3`, formula.UpdateQuery{ColumnOffset: 1, RowOffset: 2},
+			`B3+$B$1+D$2+'My Sheet'!$D5`},
+		{`SUM(A1:A3)`, formula.UpdateQuery{RowOffset: -1}, `SUM(#REF!)`},
+		// renaming a sheet
+		{`Sheet1!A1+SUM('sheet1'!B1:B3)+Other!A1`, formula.UpdateQuery{OldSheetName: "Sheet1", NewSheetName: "Q1 Sales"},
+			`'Q1 Sales'!A1+SUM('Q1 Sales'!B1:B3)+Other!A1`},
+		// inserting and removing rows and columns
+		{`A1+A5+SUM(A2:A6)+Other!A5`, formula.UpdateQuery{UpdateType: formula.UpdateTypeInsertRows,
+			Sheet: "Sheet1", CurrentSheet: true, Index: 3, Count: 2}, `A1+A7+SUM(A2:A8)+Other!A5`},
+		{`A1+A3+SUM(A2:A6)+SUM(A3:A4)`, formula.UpdateQuery{UpdateType: formula.UpdateTypeRemoveRows,
+			Sheet: "Sheet1", CurrentSheet: true, Index: 3, Count: 2}, `A1+#REF!+SUM(A2:A4)+SUM(#REF!)`},
+		{`Sheet1!C1+C1`, formula.UpdateQuery{UpdateType: formula.UpdateTypeInsertColumns,
+			Sheet: "Sheet1", Index: 1, Count: 1}, `Sheet1!D1+C1`},
+		{`SUM(B1:D1)`, formula.UpdateQuery{UpdateType: formula.UpdateTypeRemoveColumns,
+			Sheet: "Sheet1", CurrentSheet: true, Index: 2, Count: 1}, `SUM(B1:C1)`},
+	} {
+		got, err := formula.UpdateFormula(tc.Inp, &tc.Q)
+		if err != nil {
+			t.Errorf("error updating %s: %s", tc.Inp, err)
+			continue
+		}
+		if got != tc.Exp {
+			t.Errorf("expected %s to be updated to %s, got %s", tc.Inp, tc.Exp, got)
+		}
+	}
+}
+
+func TestUpdateFormulaPartialParse(t *testing.T) {
+	for _, f := range []string{"A1%*2+B1", "A1 + B1", "SUM(A1:A3)%", "A1+"} {
+		if got, err := formula.UpdateFormula(f, &formula.UpdateQuery{RowOffset: 1}); err == nil {
+			t.Errorf("expected an error updating %s, got %s", f, got)
+		}
+	}
+}
+
+func TestUpdateReference(t *testing.T) {
+	rows := formula.UpdateQuery{UpdateType: formula.UpdateTypeRemoveRows, CurrentSheet: true, Index: 3, Count: 2}
+	copied := formula.UpdateQuery{ColumnOffset: 1, RowOffset: -1}
+	for _, tc := range []struct {
+		Ref string
+		Q   formula.UpdateQuery
+		Exp string
+		OK  bool
+	}{
+		{"A5", rows, "A3", true},
+		{"$A$3:B6", rows, "$A$3:B4", true},
+		{"2:$6", rows, "2:$4", true},
+		{"3:4", rows, "3:4", false},
+		{"A:C", rows, "A:C", true},
+		{"A:$C", copied, "B:$C", true},
+		{"1:3", copied, "0:2", false},
+		{"Name", copied, "Name", true},
+	} {
+		got, ok := tc.Q.UpdateReference(tc.Ref)
+		if ok != tc.OK || (ok && got != tc.Exp) {
+			t.Errorf("expected %s to be updated to %s (%v), got %s (%v)", tc.Ref, tc.Exp, tc.OK, got, ok)
+		}
+	}
+}
+
+func TestR1C1(t *testing.T) {
+	for _, tc := range []struct {
+		A1   string
+		R1C1 string
+	}{
+		{`SUM(A1:B2)+$A$1-C$3`, `SUM(R[-2]C[-1]:R[-1]C)+R1C1-R3C[1]`},
+		{`"A1"&Sheet1!B3&'My Sheet'!$D4`, `"A1"&Sheet1!RC&'My Sheet'!R[1]C4`},
+		{`ROUND(SUM(A:$C,2:$5),1)`, `ROUND(SUM(C[-1]:C3,R[-1]:R5),1)`},
+		{`Table1[Qty]+A1#`, `Table1[Qty]+R[-2]C[-1]#`},
+		{`'It''s A1'!A1&IFERROR(#DIV/0!,[1]Sheet1!B3:C4)`, `'It''s A1'!R[-2]C[-1]&IFERROR(#DIV/0!,[1]Sheet1!RC:R[1]C[1])`},
+	} {
+		got, err := formula.ConvertToR1C1(tc.A1, "B3")
+		if err != nil || got != tc.R1C1 {
+			t.Errorf("expected %s in R1C1 notation = %s, got %s (%v)", tc.A1, tc.R1C1, got, err)
+		}
+		got, err = formula.ConvertFromR1C1(tc.R1C1, "B3")
+		if err != nil || got != tc.A1 {
+			t.Errorf("expected %s in A1 notation = %s, got %s (%v)", tc.R1C1, tc.A1, got, err)
+		}
+	}
+	if got, err := formula.ConvertFromR1C1("R+C[1]", "B3"); err != nil || got != "3:3+C:C" {
+		t.Errorf("expected 3:3+C:C, got %s (%v)", got, err)
+	}
+	for _, inp := range []string{"R[-5]C+R+C[1]", "R0C1", "R1048577C1", "R1C16385", "SUM(R1:R[1048576])", "C[-3]"} {
+		if _, err := formula.ConvertFromR1C1(inp, "B3"); err == nil {
+			t.Errorf("expected an error converting %s", inp)
+		}
+	}
+
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetNumber(1)
+	sheet.Cell("A2").SetNumber(2)
+	result := formula.ParseStringR1C1("SUM(R1C1:R[-1]C)*2", "A3").Eval(sheet.FormulaContext(), formula.NewEvaluator())
+	if got := fmt.Sprintf("%s %s", result.Value(), result.Type); got != "6 ResultTypeNumber" {
+		t.Errorf("expected 6 ResultTypeNumber, got %s", got)
+	}
+}
@@ -7,7 +7,10 @@
 
 package formula
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 // Evaluator is the interface for a formula evaluator.  This is needed so we can
 // pass it to the spreadsheet to let it evaluate formula cells before returning
@@ -16,15 +19,58 @@ type Evaluator interface {
 	Eval(ctx Context, formula string) Result
 }
 
+// NewEvaluator constructs a new evaluator.  The evaluator caches the parsed
+// form of up to maxCachedFormulas formulas, so formulas that are evaluated
+// repeatedly are usually only parsed once, and is safe to use from multiple
+// goroutines.
 func NewEvaluator() Evaluator {
-	return &defEval{}
+	return NewEvaluatorWithRegistry(builtins)
 }
 
+// NewEvaluatorWithRegistry constructs a new evaluator that calls the functions
+// in a registry rather than the globally registered functions.
+func NewEvaluatorWithRegistry(r *Registry) Evaluator {
+	return &defEval{cache: map[string]Expression{}, registry: r}
+}
+
+// RegistryOf returns the registry that an evaluator calls functions from,
+// which is the global registry for evaluators that weren't constructed with
+// NewEvaluatorWithRegistry.
+func RegistryOf(ev Evaluator) *Registry {
+	if d, ok := ev.(*defEval); ok && d.registry != nil {
+		return d.registry
+	}
+	return builtins
+}
+
+// maxCachedFormulas is the number of parsed formulas an evaluator keeps.  The
+// cache is emptied when it's full, so that evaluating many distinct formulas
+// doesn't grow it without bound.
+const maxCachedFormulas = 10000
+
 type defEval struct {
+	lock     sync.RWMutex
+	cache    map[string]Expression
+	registry *Registry
 }
 
 func (d *defEval) Eval(ctx Context, formula string) Result {
-	expr := ParseString(formula)
+	d.lock.RLock()
+	expr, ok := d.cache[formula]
+	d.lock.RUnlock()
+	if !ok {
+		expr = ParseString(formula)
+		// formulas that can't be parsed aren't cached, as they're usually
+		// evaluated once to report the error
+		if expr != nil {
+			d.lock.Lock()
+			if len(d.cache) >= maxCachedFormulas {
+				d.cache = map[string]Expression{}
+			}
+			d.cache[formula] = expr
+			d.lock.Unlock()
+		}
+	}
 	if expr != nil {
 		return expr.Eval(ctx, d)
 	}
@@ -10,4 +10,13 @@ package formula
 type Expression interface {
 	Eval(ctx Context, ev Evaluator) Result
 	Reference(ctx Context, ev Evaluator) Reference
+	// References returns the cells, ranges and named ranges that the
+	// expression refers to.  References to other sheets are qualified with the
+	// quoted sheet name, e.g. 'Sheet 1'!A1:B3.
+	References() []Reference
+	// String returns the formula text of the expression, without a leading
+	// '='.
+	String() string
+	// Update returns the expression with its references updated.
+	Update(q *UpdateQuery) Expression
 }
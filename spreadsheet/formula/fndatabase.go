@@ -0,0 +1,334 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The database functions take a database range whose first row contains field
+// labels, a field and a criteria range.  The first row of the criteria range
+// contains labels of the fields to check, and each following row contains
+// criteria that must all be satisfied.  A record is selected if it satisfies
+// any of the rows.
+func init() {
+	RegisterFunction("DAVERAGE", DAverage)
+	RegisterFunction("DCOUNT", DCount)
+	RegisterFunction("DCOUNTA", DCountA)
+	RegisterFunction("DGET", DGet)
+	RegisterFunction("DMAX", DMax)
+	RegisterFunction("DMIN", DMin)
+	RegisterFunction("DPRODUCT", DProduct)
+	RegisterFunction("DSTDEV", makeDVarianceFunction("DSTDEV", true, true))
+	RegisterFunction("DSTDEVP", makeDVarianceFunction("DSTDEVP", false, true))
+	RegisterFunction("DSUM", DSum)
+	RegisterFunction("DVAR", makeDVarianceFunction("DVAR", true, false))
+	RegisterFunction("DVARP", makeDVarianceFunction("DVARP", false, false))
+}
+
+// dbLabel normalizes a field label for comparison, as labels are matched case
+// insensitively.
+func dbLabel(r Result) string {
+	return strings.ToLower(strings.TrimSpace(r.Value()))
+}
+
+// dbField returns the index of the column in the database selected by a
+// field argument, which is either a label or a 1-based column number.  If the
+// field is omitted and omitted is true, -1 is returned.
+func dbField(labels []Result, field Result, omitted bool, fn string) (int, Result) {
+	switch field.Type {
+	case ResultTypeError:
+		return 0, field
+	case ResultTypeEmpty:
+		if omitted {
+			return -1, MakeEmptyResult()
+		}
+	case ResultTypeNumber:
+		idx := int(field.ValueNumber)
+		if idx < 1 || idx > len(labels) {
+			return 0, MakeErrorResult(fn + " field number out of range")
+		}
+		return idx - 1, MakeEmptyResult()
+	case ResultTypeString:
+		label := dbLabel(field)
+		for i, l := range labels {
+			if dbLabel(l) == label {
+				return i, MakeEmptyResult()
+			}
+		}
+	}
+	return 0, MakeErrorResult(fn + " has an unknown field " + field.Value())
+}
+
+// dbCriteria parses a criteria value.  Like Excel, text without a comparison
+// operator matches any text that begins with it.
+func dbCriteria(r Result) criteria {
+	if r.Type == ResultTypeString && r.ValueString != "" {
+		s := r.ValueString
+		if _, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err != nil && !strings.ContainsAny(s[:1], "<>=") {
+			return parseCriteria(MakeStringResult(s + "*"))
+		}
+	}
+	return parseCriteria(r)
+}
+
+// dbRecords returns the records of the database argument that satisfy the
+// criteria argument, along with the field labels.
+func dbRecords(database, crit Result) ([]Result, [][]Result) {
+	db := asArray(database)
+	labels, records := db[0], db[1:]
+	critArr := asArray(crit)
+
+	// each criteria row is a list of criteria on database columns, where a
+	// column of -1 has a label that isn't in the database and is never
+	// satisfied
+	type condition struct {
+		col  int
+		crit criteria
+	}
+	rows := [][]condition{}
+	for _, row := range critArr[1:] {
+		conds := []condition{}
+		for i, v := range row {
+			if v.Type == ResultTypeEmpty || i >= len(critArr[0]) {
+				continue
+			}
+			col := -1
+			label := dbLabel(critArr[0][i])
+			for j, l := range labels {
+				if dbLabel(l) == label {
+					col = j
+					break
+				}
+			}
+			conds = append(conds, condition{col, dbCriteria(v)})
+		}
+		rows = append(rows, conds)
+	}
+
+	ret := [][]Result{}
+	for _, rec := range records {
+		selected := len(rows) == 0
+		for _, conds := range rows {
+			matched := true
+			for _, c := range conds {
+				if c.col == -1 || c.col >= len(rec) || !c.crit.matches(rec[c.col]) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				selected = true
+				break
+			}
+		}
+		if selected {
+			ret = append(ret, rec)
+		}
+	}
+	return labels, ret
+}
+
+// dbValues returns the values of a field in the records of a database that
+// satisfy the criteria.  If the field is omitted and omitted is true, a 1 is
+// returned for each record so that the records can be counted.
+func dbValues(args []Result, fn string, omitted bool) ([]Result, Result) {
+	if len(args) != 3 {
+		return nil, MakeErrorResult(fn + " requires three arguments")
+	}
+	for _, a := range []Result{args[0], args[2]} {
+		if a.Type == ResultTypeError {
+			return nil, a
+		}
+	}
+	labels, records := dbRecords(args[0], args[2])
+	col, errResult := dbField(labels, args[1], omitted, fn)
+	if errResult.Type == ResultTypeError {
+		return nil, errResult
+	}
+	ret := make([]Result, len(records))
+	for i, rec := range records {
+		switch {
+		case col == -1:
+			ret[i] = MakeNumberResult(1)
+		case col < len(rec):
+			ret[i] = rec[col]
+		default:
+			ret[i] = MakeEmptyResult()
+		}
+	}
+	return ret, MakeEmptyResult()
+}
+
+// dbNumbers returns the numbers in a field of the records of a database that
+// satisfy the criteria.
+func dbNumbers(args []Result, fn string) ([]float64, Result) {
+	values, errResult := dbValues(args, fn, false)
+	if errResult.Type == ResultTypeError {
+		return nil, errResult
+	}
+	mask := make([]bool, len(values))
+	for i := range mask {
+		mask[i] = true
+	}
+	return selectNumbers(values, mask)
+}
+
+// DAverage is an implementation of the Excel DAVERAGE() function that returns
+// the average of a field in the selected records.
+func DAverage(args []Result) Result {
+	values, errResult := dbNumbers(args, "DAVERAGE")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if len(values) == 0 {
+		return MakeErrorResultType(ErrorTypeDivideByZero, "DAVERAGE divide by zero")
+	}
+	return MakeNumberResult(mean(values))
+}
+
+// DCount is an implementation of the Excel DCOUNT() function that counts the
+// numbers in a field of the selected records, or the selected records if the
+// field is omitted.
+func DCount(args []Result) Result {
+	values, errResult := dbValues(args, "DCOUNT", true)
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	cnt := 0
+	for _, v := range values {
+		if v.Type == ResultTypeNumber {
+			cnt++
+		}
+	}
+	return MakeNumberResult(float64(cnt))
+}
+
+// DCountA is an implementation of the Excel DCOUNTA() function that counts the
+// non-empty values in a field of the selected records, or the selected records
+// if the field is omitted.
+func DCountA(args []Result) Result {
+	values, errResult := dbValues(args, "DCOUNTA", true)
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	cnt := 0
+	for _, v := range values {
+		if v.Type != ResultTypeEmpty {
+			cnt++
+		}
+	}
+	return MakeNumberResult(float64(cnt))
+}
+
+// DGet is an implementation of the Excel DGET() function that returns the
+// value of a field in the single selected record.
+func DGet(args []Result) Result {
+	values, errResult := dbValues(args, "DGET", false)
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	switch len(values) {
+	case 0:
+		return MakeErrorResult("DGET found no matching record")
+	case 1:
+		if values[0].Type == ResultTypeEmpty {
+			return MakeNumberResult(0)
+		}
+		return values[0]
+	}
+	return MakeErrorResultType(ErrorTypeNum, "DGET found more than one matching record")
+}
+
+// DMax is an implementation of the Excel DMAX() function that returns the
+// largest number in a field of the selected records.
+func DMax(args []Result) Result {
+	values, errResult := dbNumbers(args, "DMAX")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if len(values) == 0 {
+		return MakeNumberResult(0)
+	}
+	v := values[0]
+	for _, x := range values {
+		v = math.Max(v, x)
+	}
+	return MakeNumberResult(v)
+}
+
+// DMin is an implementation of the Excel DMIN() function that returns the
+// smallest number in a field of the selected records.
+func DMin(args []Result) Result {
+	values, errResult := dbNumbers(args, "DMIN")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if len(values) == 0 {
+		return MakeNumberResult(0)
+	}
+	v := values[0]
+	for _, x := range values {
+		v = math.Min(v, x)
+	}
+	return MakeNumberResult(v)
+}
+
+// DProduct is an implementation of the Excel DPRODUCT() function that
+// multiplies the numbers in a field of the selected records.
+func DProduct(args []Result) Result {
+	values, errResult := dbNumbers(args, "DPRODUCT")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if len(values) == 0 {
+		return MakeNumberResult(0)
+	}
+	v := 1.0
+	for _, x := range values {
+		v *= x
+	}
+	return MakeNumberResult(v)
+}
+
+// DSum is an implementation of the Excel DSUM() function that adds the numbers
+// in a field of the selected records.
+func DSum(args []Result) Result {
+	values, errResult := dbNumbers(args, "DSUM")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	v := 0.0
+	for _, x := range values {
+		v += x
+	}
+	return MakeNumberResult(v)
+}
+
+// makeDVarianceFunction returns a function that computes the sample or
+// population variance or standard deviation of a field in the selected
+// records.
+func makeDVarianceFunction(name string, sample, stdev bool) Function {
+	variance := makeVarianceFunction(name, sample, stdev)
+	return func(args []Result) Result {
+		values, errResult := dbNumbers(args, name)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		if len(values) == 0 {
+			return MakeErrorResultType(ErrorTypeDivideByZero, name+" divide by zero")
+		}
+		nums := make([]Result, len(values))
+		for i, v := range values {
+			nums[i] = MakeNumberResult(v)
+		}
+		return variance(nums)
+	}
+}
@@ -0,0 +1,1071 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterFunctionComplex("DATE", Date)
+	RegisterFunctionComplex("DATEDIF", DateDif)
+	RegisterFunctionComplex("DATEVALUE", DateValue)
+	RegisterFunctionComplex("DAY", Day)
+	RegisterFunctionComplex("_xlfn.DAYS", Days)
+	RegisterFunctionComplex("DAYS360", Days360)
+	RegisterFunctionComplex("EDATE", Edate)
+	RegisterFunctionComplex("EOMONTH", Eomonth)
+	RegisterFunction("HOUR", Hour)
+	RegisterFunctionComplex("_xlfn.ISOWEEKNUM", IsoWeekNum)
+	RegisterFunction("MINUTE", Minute)
+	RegisterFunctionComplex("MONTH", Month)
+	RegisterFunctionComplex("NETWORKDAYS", NetworkDays)
+	RegisterFunctionComplex("_xlfn.NETWORKDAYS.INTL", NetworkDaysIntl)
+	RegisterFunctionComplex("NOW", Now)
+	RegisterFunctionInfo("NOW", FunctionInfo{MinArgs: 0, MaxArgs: 0, Volatile: true})
+	RegisterFunction("SECOND", Second)
+	RegisterFunction("TIME", Time)
+	RegisterFunction("TIMEVALUE", TimeValue)
+	RegisterFunctionComplex("TODAY", Today)
+	RegisterFunctionInfo("TODAY", FunctionInfo{MinArgs: 0, MaxArgs: 0, Volatile: true})
+	RegisterFunctionComplex("WEEKDAY", Weekday)
+	RegisterFunctionComplex("WEEKNUM", WeekNum)
+	RegisterFunctionComplex("WORKDAY", WorkDay)
+	RegisterFunctionComplex("_xlfn.WORKDAY.INTL", WorkDayIntl)
+	RegisterFunctionComplex("YEAR", Year)
+	RegisterFunctionComplex("YEARFRAC", YearFrac)
+}
+
+// maxSerialDate is the serial number of 31 Dec 9999 in the 1900 date system,
+// the largest date that Excel supports.
+const maxSerialDate = 2958465
+
+const secondsPerDay = 24 * 60 * 60
+
+// uses1900 returns true if the epoch is that of the 1900 date system.
+func uses1900(epoch time.Time) bool {
+	return epoch.Year() < 1900
+}
+
+// timeFromSerial converts the integer portion of a serial date to the date it
+// represents.  The 1900 date system contains a non-existent 29 Feb 1900 (serial
+// 60) for compatibility with Lotus 1-2-3, so dates prior to 1 Mar 1900 are
+// shifted by a day.
+func timeFromSerial(epoch time.Time, serial float64) time.Time {
+	days := int(math.Floor(serial))
+	if uses1900(epoch) && days < 61 {
+		days++
+	}
+	return epoch.AddDate(0, 0, days)
+}
+
+// ymdFromSerial returns the year, month and day of a serial date as Excel
+// reports them, including the fictional dates 0 Jan 1900 and 29 Feb 1900.
+func ymdFromSerial(epoch time.Time, serial float64) (int, time.Month, int) {
+	if uses1900(epoch) {
+		switch int(math.Floor(serial)) {
+		case 0:
+			return 1900, time.January, 0
+		case 60:
+			return 1900, time.February, 29
+		}
+	}
+	t := timeFromSerial(epoch, serial)
+	return t.Year(), t.Month(), t.Day()
+}
+
+// serialFromTime converts the date portion of t to a serial date.
+func serialFromTime(epoch time.Time, t time.Time) float64 {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	days := (t.Unix() - epoch.Unix()) / secondsPerDay
+	if uses1900(epoch) && days < 61 {
+		days--
+	}
+	return float64(days)
+}
+
+// serialFromYMD converts a year, month and day to a serial date, normalizing
+// out of range months and days the same way that Excel's DATE() does.
+func serialFromYMD(epoch time.Time, y int, m time.Month, d int) float64 {
+	if uses1900(epoch) && y == 1900 && m == time.February && d == 29 {
+		return 60
+	}
+	return serialFromTime(epoch, time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+}
+
+// excelWeekday returns the day of the week of a serial date the way Excel
+// computes it, which for the 1900 date system is off by a day prior to 1 Mar
+// 1900.
+func excelWeekday(epoch time.Time, serial float64) time.Weekday {
+	wd := timeFromSerial(epoch, serial).Weekday()
+	if uses1900(epoch) && math.Floor(serial) < 61 {
+		wd = (wd + 6) % 7
+	}
+	return wd
+}
+
+func daysInMonth(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func isLeapYear(y int) bool {
+	return y%4 == 0 && (y%100 != 0 || y%400 == 0)
+}
+
+func daysInYear(y int) int {
+	if isLeapYear(y) {
+		return 366
+	}
+	return 365
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"1/2/2006",
+	"1-2-2006",
+	"1/2/06",
+	"2-Jan-2006",
+	"2-Jan-06",
+	"2 Jan 2006",
+	"2 January 2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"Jan 2 2006",
+	"January 2 2006",
+}
+
+var timeLayouts = []string{
+	"15:04:05",
+	"15:04",
+	"3:04:05 PM",
+	"3:04 PM",
+	"3:04:05PM",
+	"3:04PM",
+	"3 PM",
+	"3PM",
+}
+
+// parseDateTime parses text in one of the formats that Excel accepts when
+// converting text to a date or time, returning the date if one was present and
+// the time of day as a fraction of a day.
+func parseDateTime(s string) (date time.Time, hasDate bool, frac float64, ok bool) {
+	// month names are matched without regard to case, but AM/PM must be
+	// upper case
+	s = strings.ToUpper(strings.Join(strings.Fields(s), " "))
+	if s == "" {
+		return date, false, 0, false
+	}
+
+	parseDate := func(s string) (time.Time, bool) {
+		for _, l := range dateLayouts {
+			if t, err := time.Parse(l, s); err == nil {
+				// Excel maps two digit years 00-29 to 2000-2029 and 30-99 to
+				// 1930-1999, Go uses 69 as the cutoff
+				if strings.HasSuffix(l, "06") && t.Year() >= 2030 {
+					t = t.AddDate(-100, 0, 0)
+				}
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	}
+	parseTime := func(s string) (float64, bool) {
+		for _, l := range timeLayouts {
+			if t, err := time.Parse(l, s); err == nil {
+				secs := t.Hour()*3600 + t.Minute()*60 + t.Second()
+				return float64(secs) / secondsPerDay, true
+			}
+		}
+		return 0, false
+	}
+
+	if d, ok := parseDate(s); ok {
+		return d, true, 0, true
+	}
+	if f, ok := parseTime(s); ok {
+		return date, false, f, true
+	}
+	// date followed by a time, the time may contain a space before AM/PM so
+	// try each split point
+	for i := strings.Index(s, " "); i != -1; {
+		if d, ok := parseDate(s[:i]); ok {
+			if f, ok := parseTime(s[i+1:]); ok {
+				return d, true, f, true
+			}
+		}
+		next := strings.Index(s[i+1:], " ")
+		if next == -1 {
+			break
+		}
+		i += next + 1
+	}
+	return date, false, 0, false
+}
+
+// serialDateArg converts an argument to a serial date, parsing text values as
+// dates.
+func serialDateArg(ctx Context, arg Result, fn string) (float64, Result) {
+	v := 0.0
+	switch arg.Type {
+	case ResultTypeEmpty:
+	case ResultTypeNumber, ResultTypeBool:
+		v = arg.ValueNumber
+	case ResultTypeString:
+		if n := arg.AsNumber(); n.Type == ResultTypeNumber {
+			v = n.ValueNumber
+			break
+		}
+		d, hasDate, frac, ok := parseDateTime(arg.ValueString)
+		if !ok {
+			return 0, MakeErrorResult(fn + " requires a date argument")
+		}
+		v = frac
+		if hasDate {
+			v += serialFromTime(ctx.GetEpoch(), d)
+		}
+	case ResultTypeError:
+		return 0, arg
+	default:
+		return 0, MakeErrorResult(fmt.Sprintf("unhandled %s argument type %s", fn, arg.Type))
+	}
+	if v < 0 || v >= maxSerialDate+1 {
+		return 0, MakeErrorResultType(ErrorTypeNum, fn+" date out of range")
+	}
+	return v, MakeEmptyResult()
+}
+
+// serialTimeArg converts an argument to a serial date/time, parsing text values
+// as times.  Unlike serialDateArg, it doesn't require an epoch as the date
+// portion of text values is not needed.
+func serialTimeArg(arg Result, fn string) (float64, Result) {
+	v := 0.0
+	switch arg.Type {
+	case ResultTypeEmpty:
+	case ResultTypeNumber, ResultTypeBool:
+		v = arg.ValueNumber
+	case ResultTypeString:
+		if n := arg.AsNumber(); n.Type == ResultTypeNumber {
+			v = n.ValueNumber
+			break
+		}
+		_, _, frac, ok := parseDateTime(arg.ValueString)
+		if !ok {
+			return 0, MakeErrorResult(fn + " requires a time argument")
+		}
+		v = frac
+	case ResultTypeError:
+		return 0, arg
+	default:
+		return 0, MakeErrorResult(fmt.Sprintf("unhandled %s argument type %s", fn, arg.Type))
+	}
+	if v < 0 {
+		return 0, MakeErrorResultType(ErrorTypeNum, fn+" time out of range")
+	}
+	return v, MakeEmptyResult()
+}
+
+// numberArg converts an argument to a number, returning an error result if it
+// isn't numeric.
+func numberArg(arg Result, fn string) (float64, Result) {
+	switch arg.Type {
+	case ResultTypeError:
+		return 0, arg
+	case ResultTypeEmpty:
+		return 0, MakeEmptyResult()
+	}
+	n := arg.AsNumber()
+	if n.Type != ResultTypeNumber {
+		return 0, MakeErrorResult(fn + " requires a numeric argument")
+	}
+	return n.ValueNumber, MakeEmptyResult()
+}
+
+// hmsFromSerial returns the hour, minute and second of a serial time, rounded
+// to the nearest second.
+func hmsFromSerial(serial float64) (int, int, int) {
+	_, frac := math.Modf(serial)
+	secs := int(math.Floor(frac*secondsPerDay+0.5)) % secondsPerDay
+	return secs / 3600, (secs / 60) % 60, secs % 60
+}
+
+// Date is an implementation of the Excel DATE() function.
+func Date(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 3 {
+		return MakeErrorResult("DATE requires three arguments")
+	}
+	var ymd [3]float64
+	for i, a := range args {
+		v, err := numberArg(a, "DATE")
+		if err.Type == ResultTypeError {
+			return err
+		}
+		ymd[i] = math.Trunc(v)
+	}
+	year := int(ymd[0])
+	if year < 0 || year >= 10000 {
+		return MakeErrorResultType(ErrorTypeNum, "DATE year out of range")
+	}
+	if uses1900(ctx.GetEpoch()) {
+		if year < 1900 {
+			year += 1900
+		}
+	} else if year < 1904 {
+		year += 1900
+	}
+	v := serialFromYMD(ctx.GetEpoch(), year, time.Month(ymd[1]), int(ymd[2]))
+	if v < 0 || v > maxSerialDate {
+		return MakeErrorResultType(ErrorTypeNum, "DATE result out of range")
+	}
+	return MakeNumberResult(v)
+}
+
+// DateValue is an implementation of the Excel DATEVALUE() function which
+// converts a date stored as text to a serial date.
+func DateValue(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("DATEVALUE requires one argument")
+	}
+	arg := args[0]
+	switch arg.Type {
+	case ResultTypeError:
+		return arg
+	case ResultTypeString:
+	default:
+		return MakeErrorResult("DATEVALUE requires a string argument")
+	}
+	d, hasDate, _, ok := parseDateTime(arg.ValueString)
+	if !ok {
+		return MakeErrorResult("DATEVALUE unable to parse date " + arg.ValueString)
+	}
+	if !hasDate {
+		return MakeNumberResult(0)
+	}
+	v := serialFromTime(ctx.GetEpoch(), d)
+	if v < 0 || v > maxSerialDate {
+		return MakeErrorResult("DATEVALUE date out of range")
+	}
+	return MakeNumberResult(v)
+}
+
+// TimeValue is an implementation of the Excel TIMEVALUE() function which
+// converts a time stored as text to a fraction of a day.
+func TimeValue(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("TIMEVALUE requires one argument")
+	}
+	arg := args[0]
+	switch arg.Type {
+	case ResultTypeError:
+		return arg
+	case ResultTypeString:
+	default:
+		return MakeErrorResult("TIMEVALUE requires a string argument")
+	}
+	_, _, frac, ok := parseDateTime(arg.ValueString)
+	if !ok {
+		return MakeErrorResult("TIMEVALUE unable to parse time " + arg.ValueString)
+	}
+	return MakeNumberResult(frac)
+}
+
+// Day is an implementation of the Excel DAY() function.
+func Day(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("DAY requires one argument")
+	}
+	v, err := serialDateArg(ctx, args[0], "DAY")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	_, _, d := ymdFromSerial(ctx.GetEpoch(), v)
+	return MakeNumberResult(float64(d))
+}
+
+// Month is an implementation of the Excel MONTH() function.
+func Month(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("MONTH requires one argument")
+	}
+	v, err := serialDateArg(ctx, args[0], "MONTH")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	_, m, _ := ymdFromSerial(ctx.GetEpoch(), v)
+	return MakeNumberResult(float64(m))
+}
+
+// Year is an implementation of the Excel YEAR() function.
+func Year(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("YEAR requires one argument")
+	}
+	v, err := serialDateArg(ctx, args[0], "YEAR")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	y, _, _ := ymdFromSerial(ctx.GetEpoch(), v)
+	return MakeNumberResult(float64(y))
+}
+
+// Time is an implementation of the Excel TIME() function which returns the
+// fraction of a day represented by an hour, minute and second.
+func Time(args []Result) Result {
+	if len(args) != 3 {
+		return MakeErrorResult("TIME requires three arguments")
+	}
+	var hms [3]float64
+	for i, a := range args {
+		v, err := numberArg(a, "TIME")
+		if err.Type == ResultTypeError {
+			return err
+		}
+		hms[i] = math.Trunc(v)
+	}
+	if hms[0] > 32767 || hms[1] > 32767 || hms[2] > 32767 {
+		return MakeErrorResultType(ErrorTypeNum, "TIME argument too large")
+	}
+	secs := hms[0]*3600 + hms[1]*60 + hms[2]
+	if secs < 0 {
+		return MakeErrorResultType(ErrorTypeNum, "TIME result is negative")
+	}
+	return MakeNumberResult(math.Mod(secs, secondsPerDay) / secondsPerDay)
+}
+
+// Hour is an implementation of the Excel HOUR() function.
+func Hour(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("HOUR requires one argument")
+	}
+	v, err := serialTimeArg(args[0], "HOUR")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	h, _, _ := hmsFromSerial(v)
+	return MakeNumberResult(float64(h))
+}
+
+// Minute is an implementation of the Excel MINUTE() function.
+func Minute(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("MINUTE requires one argument")
+	}
+	v, err := serialTimeArg(args[0], "MINUTE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	_, m, _ := hmsFromSerial(v)
+	return MakeNumberResult(float64(m))
+}
+
+// Second is an implementation of the Excel SECOND() function.
+func Second(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("SECOND requires one argument")
+	}
+	v, err := serialTimeArg(args[0], "SECOND")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	_, _, s := hmsFromSerial(v)
+	return MakeNumberResult(float64(s))
+}
+
+// Today is an implementation of the Excel TODAY() function which returns the
+// current date.
+func Today(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 0 {
+		return MakeErrorResult("TODAY takes no arguments")
+	}
+	return MakeNumberResult(serialFromTime(ctx.GetEpoch(), time.Now()))
+}
+
+// Now is an implementation of the Excel NOW() function which returns the
+// current date and time.
+func Now(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 0 {
+		return MakeErrorResult("NOW takes no arguments")
+	}
+	now := time.Now()
+	secs := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	frac := (float64(secs) + float64(now.Nanosecond())/1e9) / secondsPerDay
+	return MakeNumberResult(serialFromTime(ctx.GetEpoch(), now) + frac)
+}
+
+// addMonths adds a number of months to a date, clamping the day to the end of
+// the resulting month.
+func addMonths(y int, m time.Month, d, months int) (int, time.Month, int) {
+	t := time.Date(y, m+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	if dim := daysInMonth(t.Year(), t.Month()); d > dim {
+		d = dim
+	}
+	return t.Year(), t.Month(), d
+}
+
+// Edate is an implementation of the Excel EDATE() function which returns the
+// date that is a number of months before or after a start date.
+func Edate(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 {
+		return MakeErrorResult("EDATE requires two arguments")
+	}
+	start, err := serialDateArg(ctx, args[0], "EDATE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	months, err := numberArg(args[1], "EDATE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	epoch := ctx.GetEpoch()
+	y, m, d := ymdFromSerial(epoch, start)
+	var v float64
+	if d != 0 {
+		ny, nm, nd := addMonths(y, m, d, int(months))
+		v = serialFromYMD(epoch, ny, nm, nd)
+	} else {
+		// the fictional 0 Jan 1900 behaves like the last day of the prior
+		// month
+		v = serialFromYMD(epoch, y, m+time.Month(months), 0)
+	}
+	if v < 0 || v > maxSerialDate {
+		return MakeErrorResultType(ErrorTypeNum, "EDATE result out of range")
+	}
+	return MakeNumberResult(v)
+}
+
+// Eomonth is an implementation of the Excel EOMONTH() function which returns
+// the last day of the month that is a number of months before or after a start
+// date.
+func Eomonth(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 {
+		return MakeErrorResult("EOMONTH requires two arguments")
+	}
+	start, err := serialDateArg(ctx, args[0], "EOMONTH")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	months, err := numberArg(args[1], "EOMONTH")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	epoch := ctx.GetEpoch()
+	y, m, _ := ymdFromSerial(epoch, start)
+	v := serialFromYMD(epoch, y, m+time.Month(months)+1, 0)
+	if v < 0 || v > maxSerialDate {
+		return MakeErrorResultType(ErrorTypeNum, "EOMONTH result out of range")
+	}
+	return MakeNumberResult(v)
+}
+
+// Weekday is an implementation of the Excel WEEKDAY() function.
+func Weekday(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 && len(args) != 2 {
+		return MakeErrorResult("WEEKDAY requires one or two arguments")
+	}
+	v, err := serialDateArg(ctx, args[0], "WEEKDAY")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	retType := 1.0
+	if len(args) == 2 && args[1].Type != ResultTypeEmpty {
+		if retType, err = numberArg(args[1], "WEEKDAY"); err.Type == ResultTypeError {
+			return err
+		}
+	}
+	wd := int(excelWeekday(ctx.GetEpoch(), v))
+	switch rt := int(retType); {
+	case rt == 1:
+		return MakeNumberResult(float64(wd + 1))
+	case rt == 2:
+		return MakeNumberResult(float64((wd+6)%7 + 1))
+	case rt == 3:
+		return MakeNumberResult(float64((wd + 6) % 7))
+	case rt >= 11 && rt <= 17:
+		first := (rt - 10) % 7
+		return MakeNumberResult(float64((wd-first+7)%7 + 1))
+	}
+	return MakeErrorResultType(ErrorTypeNum, "WEEKDAY invalid return type")
+}
+
+// WeekNum is an implementation of the Excel WEEKNUM() function.
+func WeekNum(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 && len(args) != 2 {
+		return MakeErrorResult("WEEKNUM requires one or two arguments")
+	}
+	v, err := serialDateArg(ctx, args[0], "WEEKNUM")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	retType := 1.0
+	if len(args) == 2 && args[1].Type != ResultTypeEmpty {
+		if retType, err = numberArg(args[1], "WEEKNUM"); err.Type == ResultTypeError {
+			return err
+		}
+	}
+	epoch := ctx.GetEpoch()
+	var first int
+	switch rt := int(retType); {
+	case rt == 1 || rt == 17:
+		first = int(time.Sunday)
+	case rt == 2 || rt == 11:
+		first = int(time.Monday)
+	case rt >= 12 && rt <= 16:
+		first = rt - 10
+	case rt == 21:
+		_, wk := timeFromSerial(epoch, v).ISOWeek()
+		return MakeNumberResult(float64(wk))
+	default:
+		return MakeErrorResultType(ErrorTypeNum, "WEEKNUM invalid return type")
+	}
+	y, _, _ := ymdFromSerial(epoch, v)
+	jan1 := serialFromYMD(epoch, y, time.January, 1)
+	offset := (int(excelWeekday(epoch, jan1)) - first + 7) % 7
+	doy := int(math.Floor(v) - jan1)
+	return MakeNumberResult(float64((doy+offset)/7 + 1))
+}
+
+// IsoWeekNum is an implementation of the Excel ISOWEEKNUM() function which
+// returns the ISO 8601 week number of a date.
+func IsoWeekNum(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("ISOWEEKNUM requires one argument")
+	}
+	v, err := serialDateArg(ctx, args[0], "ISOWEEKNUM")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	_, wk := timeFromSerial(ctx.GetEpoch(), v).ISOWeek()
+	return MakeNumberResult(float64(wk))
+}
+
+// Days is an implementation of the Excel DAYS() function which returns the
+// number of days between two dates.
+func Days(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 {
+		return MakeErrorResult("DAYS requires two arguments")
+	}
+	end, err := serialDateArg(ctx, args[0], "DAYS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	start, err := serialDateArg(ctx, args[1], "DAYS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	return MakeNumberResult(math.Floor(end) - math.Floor(start))
+}
+
+// Days360 is an implementation of the Excel DAYS360() function which returns
+// the number of days between two dates based on a 360 day year.
+func Days360(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 && len(args) != 3 {
+		return MakeErrorResult("DAYS360 requires two or three arguments")
+	}
+	start, err := serialDateArg(ctx, args[0], "DAYS360")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	end, err := serialDateArg(ctx, args[1], "DAYS360")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	european := false
+	if len(args) == 3 {
+		m, err := numberArg(args[2], "DAYS360")
+		if err.Type == ResultTypeError {
+			return err
+		}
+		european = m != 0
+	}
+	epoch := ctx.GetEpoch()
+	sy, sm, sd := ymdFromSerial(epoch, start)
+	ey, em, ed := ymdFromSerial(epoch, end)
+	if european {
+		if sd == 31 {
+			sd = 30
+		}
+		if ed == 31 {
+			ed = 30
+		}
+	} else {
+		if sd == daysInMonth(sy, sm) || (sm == time.February && sd == 29) {
+			sd = 30
+		}
+		if ed == 31 {
+			if sd < 30 {
+				ed = 1
+				em++
+			} else {
+				ed = 30
+			}
+		}
+	}
+	return MakeNumberResult(float64(days360(sy, int(sm), sd, ey, int(em), ed)))
+}
+
+func days360(sy, sm, sd, ey, em, ed int) int {
+	return (ey-sy)*360 + (em-sm)*30 + (ed - sd)
+}
+
+// weekendMask returns the days of the week that are considered weekend days
+// for the NETWORKDAYS.INTL/WORKDAY.INTL weekend argument.
+func weekendMask(arg Result, fn string) ([7]bool, Result) {
+	mask := [7]bool{}
+	switch arg.Type {
+	case ResultTypeEmpty:
+		mask[time.Saturday] = true
+		mask[time.Sunday] = true
+		return mask, MakeEmptyResult()
+	case ResultTypeError:
+		return mask, arg
+	case ResultTypeString:
+		s := arg.ValueString
+		if len(s) != 7 || strings.Trim(s, "01") != "" {
+			return mask, MakeErrorResult(fn + " invalid weekend string")
+		}
+		// the string starts on Monday
+		for i, c := range s {
+			mask[(i+1)%7] = c == '1'
+		}
+		return mask, MakeEmptyResult()
+	case ResultTypeNumber:
+		switch n := int(arg.ValueNumber); {
+		case n >= 1 && n <= 7:
+			// 1 = Saturday/Sunday, 2 = Sunday/Monday, ...
+			mask[(n+5)%7] = true
+			mask[(n+6)%7] = true
+		case n >= 11 && n <= 17:
+			// 11 = Sunday only, 12 = Monday only, ...
+			mask[(n-11)%7] = true
+		default:
+			return mask, MakeErrorResultType(ErrorTypeNum, fn+" invalid weekend number")
+		}
+		return mask, MakeEmptyResult()
+	}
+	return mask, MakeErrorResult(fn + " invalid weekend argument")
+}
+
+// holidaySet returns the set of serial dates contained in a holidays argument.
+func holidaySet(ctx Context, arg Result, fn string) (map[float64]struct{}, Result) {
+	hols := map[float64]struct{}{}
+	var values []Result
+	switch arg.Type {
+	case ResultTypeList, ResultTypeArray:
+		values = arg.ListValues()
+	default:
+		values = []Result{arg}
+	}
+	for _, h := range values {
+		if h.Type == ResultTypeEmpty {
+			continue
+		}
+		v, err := serialDateArg(ctx, h, fn)
+		if err.Type == ResultTypeError {
+			return nil, err
+		}
+		hols[math.Floor(v)] = struct{}{}
+	}
+	return hols, MakeEmptyResult()
+}
+
+func networkDays(ctx Context, fn string, startArg, endArg, weekendArg, holidayArg Result) Result {
+	start, err := serialDateArg(ctx, startArg, fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	end, err := serialDateArg(ctx, endArg, fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	mask, err := weekendMask(weekendArg, fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	hols, err := holidaySet(ctx, holidayArg, fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	start = math.Floor(start)
+	end = math.Floor(end)
+	sign := 1.0
+	if start > end {
+		start, end = end, start
+		sign = -1
+	}
+	epoch := ctx.GetEpoch()
+	cnt := 0.0
+	for d := start; d <= end; d++ {
+		if mask[excelWeekday(epoch, d)] {
+			continue
+		}
+		if _, ok := hols[d]; ok {
+			continue
+		}
+		cnt++
+	}
+	return MakeNumberResult(sign * cnt)
+}
+
+// NetworkDays is an implementation of the Excel NETWORKDAYS() function which
+// returns the number of whole working days between two dates.
+func NetworkDays(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 && len(args) != 3 {
+		return MakeErrorResult("NETWORKDAYS requires two or three arguments")
+	}
+	hols := MakeEmptyResult()
+	if len(args) == 3 {
+		hols = args[2]
+	}
+	return networkDays(ctx, "NETWORKDAYS", args[0], args[1], MakeEmptyResult(), hols)
+}
+
+// NetworkDaysIntl is an implementation of the Excel NETWORKDAYS.INTL()
+// function which allows specifying which days are weekend days.
+func NetworkDaysIntl(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) < 2 || len(args) > 4 {
+		return MakeErrorResult("NETWORKDAYS.INTL requires two to four arguments")
+	}
+	weekend, hols := MakeEmptyResult(), MakeEmptyResult()
+	if len(args) > 2 {
+		weekend = args[2]
+	}
+	if len(args) > 3 {
+		hols = args[3]
+	}
+	return networkDays(ctx, "NETWORKDAYS.INTL", args[0], args[1], weekend, hols)
+}
+
+func workDay(ctx Context, fn string, startArg, daysArg, weekendArg, holidayArg Result) Result {
+	start, err := serialDateArg(ctx, startArg, fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	days, err := numberArg(daysArg, fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	mask, err := weekendMask(weekendArg, fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if mask == [7]bool{true, true, true, true, true, true, true} {
+		return MakeErrorResult(fn + " requires at least one working day per week")
+	}
+	hols, err := holidaySet(ctx, holidayArg, fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	epoch := ctx.GetEpoch()
+	d := math.Floor(start)
+	step := 1.0
+	remaining := math.Trunc(days)
+	if remaining < 0 {
+		step = -1
+		remaining = -remaining
+	}
+	for remaining > 0 {
+		d += step
+		if d < 0 || d > maxSerialDate {
+			return MakeErrorResultType(ErrorTypeNum, fn+" result out of range")
+		}
+		if mask[excelWeekday(epoch, d)] {
+			continue
+		}
+		if _, ok := hols[d]; ok {
+			continue
+		}
+		remaining--
+	}
+	return MakeNumberResult(d)
+}
+
+// WorkDay is an implementation of the Excel WORKDAY() function which returns
+// the date that is a number of working days before or after a start date.
+func WorkDay(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 && len(args) != 3 {
+		return MakeErrorResult("WORKDAY requires two or three arguments")
+	}
+	hols := MakeEmptyResult()
+	if len(args) == 3 {
+		hols = args[2]
+	}
+	return workDay(ctx, "WORKDAY", args[0], args[1], MakeEmptyResult(), hols)
+}
+
+// WorkDayIntl is an implementation of the Excel WORKDAY.INTL() function which
+// allows specifying which days are weekend days.
+func WorkDayIntl(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) < 2 || len(args) > 4 {
+		return MakeErrorResult("WORKDAY.INTL requires two to four arguments")
+	}
+	weekend, hols := MakeEmptyResult(), MakeEmptyResult()
+	if len(args) > 2 {
+		weekend = args[2]
+	}
+	if len(args) > 3 {
+		hols = args[3]
+	}
+	return workDay(ctx, "WORKDAY.INTL", args[0], args[1], weekend, hols)
+}
+
+// DateDif is an implementation of the Excel DATEDIF() function which returns
+// the difference between two dates in years, months or days.
+func DateDif(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 3 {
+		return MakeErrorResult("DATEDIF requires three arguments")
+	}
+	start, err := serialDateArg(ctx, args[0], "DATEDIF")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	end, err := serialDateArg(ctx, args[1], "DATEDIF")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	unit := args[2].AsString()
+	if unit.Type != ResultTypeString {
+		return MakeErrorResult("DATEDIF requires a string unit")
+	}
+	start, end = math.Floor(start), math.Floor(end)
+	if start > end {
+		return MakeErrorResultType(ErrorTypeNum, "DATEDIF start date is after end date")
+	}
+	epoch := ctx.GetEpoch()
+	sy, sm, sd := ymdFromSerial(epoch, start)
+	ey, em, ed := ymdFromSerial(epoch, end)
+
+	months := (ey-sy)*12 + int(em-sm)
+	if ed < sd {
+		months--
+	}
+	switch strings.ToUpper(unit.ValueString) {
+	case "Y":
+		return MakeNumberResult(float64(months / 12))
+	case "M":
+		return MakeNumberResult(float64(months))
+	case "D":
+		return MakeNumberResult(end - start)
+	case "YM":
+		return MakeNumberResult(float64(months % 12))
+	case "MD":
+		if ed >= sd {
+			return MakeNumberResult(float64(ed - sd))
+		}
+		return MakeNumberResult(end - serialFromYMD(epoch, ey, em-1, sd))
+	case "YD":
+		v := serialFromYMD(epoch, ey, sm, sd)
+		if v > end {
+			v = serialFromYMD(epoch, ey-1, sm, sd)
+		}
+		return MakeNumberResult(end - v)
+	}
+	return MakeErrorResultType(ErrorTypeNum, "DATEDIF invalid unit "+unit.ValueString)
+}
+
+// YearFrac is an implementation of the Excel YEARFRAC() function which returns
+// the fraction of a year between two dates using a given day count basis.
+func YearFrac(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 && len(args) != 3 {
+		return MakeErrorResult("YEARFRAC requires two or three arguments")
+	}
+	start, err := serialDateArg(ctx, args[0], "YEARFRAC")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	end, err := serialDateArg(ctx, args[1], "YEARFRAC")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	basis := 0.0
+	if len(args) == 3 && args[2].Type != ResultTypeEmpty {
+		if basis, err = numberArg(args[2], "YEARFRAC"); err.Type == ResultTypeError {
+			return err
+		}
+	}
+	v, ok := yearFrac(ctx.GetEpoch(), start, end, int(basis))
+	if !ok {
+		return MakeErrorResultType(ErrorTypeNum, "YEARFRAC invalid basis")
+	}
+	return MakeNumberResult(v)
+}
+
+// yearFrac computes the fraction of a year between two serial dates for a
+// given day count basis.  It's shared with the financial functions that use
+// the same basis argument.
+func yearFrac(epoch time.Time, start, end float64, basis int) (float64, bool) {
+	start, end = math.Floor(start), math.Floor(end)
+	if start > end {
+		start, end = end, start
+	}
+	sy, sm, sd := ymdFromSerial(epoch, start)
+	ey, em, ed := ymdFromSerial(epoch, end)
+	switch basis {
+	case 0:
+		// US (NASD) 30/360
+		isLastFeb := func(y int, m time.Month, d int) bool {
+			return m == time.February && d == daysInMonth(y, m)
+		}
+		switch {
+		case sd == 31 && ed == 31:
+			sd, ed = 30, 30
+		case sd == 31:
+			sd = 30
+		case sd == 30 && ed == 31:
+			ed = 30
+		case isLastFeb(sy, sm, sd) && isLastFeb(ey, em, ed):
+			sd, ed = 30, 30
+		case isLastFeb(sy, sm, sd):
+			sd = 30
+		}
+		return float64(days360(sy, int(sm), sd, ey, int(em), ed)) / 360, true
+	case 1:
+		// actual/actual
+		days := end - start
+		sameYearPeriod := sy == ey || (ey == sy+1 && (sm > em || (sm == em && sd >= ed)))
+		if sameYearPeriod {
+			yearLen := 365.0
+			if sy == ey && isLeapYear(sy) {
+				yearLen = 366
+			} else if sy != ey {
+				for y := sy; y <= ey; y++ {
+					if !isLeapYear(y) {
+						continue
+					}
+					feb29 := serialFromYMD(epoch, y, time.February, 29)
+					if feb29 >= start && feb29 <= end {
+						yearLen = 366
+					}
+				}
+			}
+			return days / yearLen, true
+		}
+		total := 0
+		for y := sy; y <= ey; y++ {
+			total += daysInYear(y)
+		}
+		avg := float64(total) / float64(ey-sy+1)
+		return days / avg, true
+	case 2:
+		return (end - start) / 360, true
+	case 3:
+		return (end - start) / 365, true
+	case 4:
+		// European 30/360
+		if sd == 31 {
+			sd = 30
+		}
+		if ed == 31 {
+			ed = 30
+		}
+		return float64(days360(sy, int(sm), sd, ey, int(em), ed)) / 360, true
+	}
+	return 0, false
+}
@@ -0,0 +1,558 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The dynamic array functions return arrays that spill into the cells around
+// the formula.  They are only in Excel 365 and are stored with an _xlfn. or
+// _xlfn._xlws. prefix.
+func init() {
+	RegisterFunction("_xlfn._xlws.FILTER", Filter)
+	RegisterFunction("_xlfn.RANDARRAY", RandArray)
+	RegisterFunctionInfo("_xlfn.RANDARRAY", FunctionInfo{MinArgs: 0, MaxArgs: 5, Volatile: true})
+	RegisterFunction("_xlfn.SEQUENCE", Sequence)
+	RegisterFunction("_xlfn._xlws.SORT", Sort)
+	RegisterFunction("_xlfn.SORTBY", SortBy)
+	RegisterFunction("_xlfn.UNIQUE", Unique)
+	RegisterFunction("_xlfn.XLOOKUP", XLookup)
+	RegisterFunction("_xlfn.XMATCH", XMatch)
+}
+
+// asArray returns the values of a result as an array, treating a list as a
+// single row and any other value as a single cell.
+func asArray(r Result) [][]Result {
+	switch r.Type {
+	case ResultTypeArray:
+		if len(r.ValueArray) == 0 {
+			return [][]Result{{MakeEmptyResult()}}
+		}
+		return r.ValueArray
+	case ResultTypeList:
+		if len(r.ValueList) == 0 {
+			return [][]Result{{MakeEmptyResult()}}
+		}
+		return [][]Result{r.ValueList}
+	}
+	return [][]Result{{r}}
+}
+
+func transposeArray(arr [][]Result) [][]Result {
+	ret := make([][]Result, len(arr[0]))
+	for _, row := range arr {
+		for j, v := range row {
+			ret[j] = append(ret[j], v)
+		}
+	}
+	return ret
+}
+
+// optionalNumber returns the numeric value of an optional argument, or def if
+// it was omitted.
+func optionalNumber(args []Result, i int, def float64, fn string) (float64, Result) {
+	if i >= len(args) || args[i].Type == ResultTypeEmpty {
+		return def, MakeEmptyResult()
+	}
+	n := args[i].AsNumber()
+	switch n.Type {
+	case ResultTypeNumber:
+		return n.ValueNumber, MakeEmptyResult()
+	case ResultTypeError:
+		return 0, n
+	}
+	return 0, MakeErrorResult(fn + " requires numeric arguments")
+}
+
+// Filter is an implementation of the Excel FILTER() function that returns the
+// rows or columns of an array for which the include argument is true.
+func Filter(args []Result) Result {
+	if len(args) < 2 || len(args) > 3 {
+		return MakeErrorResult("FILTER requires two or three arguments")
+	}
+	arr := asArray(args[0])
+	rows, cols := len(arr), len(arr[0])
+	ir, ic := dims(args[1])
+	byCol := false
+	switch {
+	case ic == 1 && ir == rows:
+	case ir == 1 && ic == cols:
+		byCol = true
+		arr = transposeArray(arr)
+	default:
+		return MakeErrorResult("FILTER include argument must be a row or column the size of the array")
+	}
+
+	ret := [][]Result{}
+	for i, v := range flatten(args[1]) {
+		switch v.Type {
+		case ResultTypeError:
+			return v
+		case ResultTypeString:
+			return MakeErrorResult("FILTER include argument must be boolean")
+		case ResultTypeNumber, ResultTypeBool:
+			if v.ValueNumber != 0 {
+				ret = append(ret, arr[i])
+			}
+		}
+	}
+	if len(ret) == 0 {
+		if len(args) == 3 {
+			return args[2]
+		}
+		return MakeErrorResultType(ErrorTypeCalc, "FILTER result is empty")
+	}
+	if byCol {
+		ret = transposeArray(ret)
+	}
+	return MakeArrayResult(ret)
+}
+
+// arraySize returns the number of rows and columns requested by the optional
+// arguments of SEQUENCE and RANDARRAY.
+func arraySize(args []Result, fn string) (int, int, Result) {
+	rows, err := optionalNumber(args, 0, 1, fn)
+	if err.Type == ResultTypeError {
+		return 0, 0, err
+	}
+	cols, err := optionalNumber(args, 1, 1, fn)
+	if err.Type == ResultTypeError {
+		return 0, 0, err
+	}
+	if rows < 0 || cols < 0 {
+		return 0, 0, MakeErrorResult(fn + " requires a positive number of rows and columns")
+	}
+	if int(rows) == 0 || int(cols) == 0 {
+		return 0, 0, MakeErrorResultType(ErrorTypeCalc, fn+" result is empty")
+	}
+	return int(rows), int(cols), MakeEmptyResult()
+}
+
+// Sequence is an implementation of the Excel SEQUENCE() function that returns
+// an array of sequential numbers.
+func Sequence(args []Result) Result {
+	if len(args) < 1 || len(args) > 4 {
+		return MakeErrorResult("SEQUENCE requires one to four arguments")
+	}
+	rows, cols, err := arraySize(args, "SEQUENCE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	start, err := optionalNumber(args, 2, 1, "SEQUENCE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	step, err := optionalNumber(args, 3, 1, "SEQUENCE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	arr := make([][]Result, rows)
+	for i := range arr {
+		arr[i] = make([]Result, cols)
+		for j := range arr[i] {
+			arr[i][j] = MakeNumberResult(start + step*float64(i*cols+j))
+		}
+	}
+	return MakeArrayResult(arr)
+}
+
+// RandArray is an implementation of the Excel RANDARRAY() function that
+// returns an array of random numbers.
+func RandArray(args []Result) Result {
+	if len(args) > 5 {
+		return MakeErrorResult("RANDARRAY accepts at most five arguments")
+	}
+	rows, cols, err := arraySize(args, "RANDARRAY")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	min, err := optionalNumber(args, 2, 0, "RANDARRAY")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	max, err := optionalNumber(args, 3, 1, "RANDARRAY")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	whole, err := optionalNumber(args, 4, 0, "RANDARRAY")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if whole != 0 {
+		min, max = math.Ceil(min), math.Floor(max)
+	}
+	if min > max {
+		return MakeErrorResult("RANDARRAY requires min to be less than max")
+	}
+	arr := make([][]Result, rows)
+	for i := range arr {
+		arr[i] = make([]Result, cols)
+		for j := range arr[i] {
+			if whole != 0 {
+				arr[i][j] = MakeNumberResult(min + float64(rnd.Int63n(int64(max-min)+1)))
+			} else {
+				arr[i][j] = MakeNumberResult(min + rnd.Float64()*(max-min))
+			}
+		}
+	}
+	return MakeArrayResult(arr)
+}
+
+// sortRank orders values of different types as Excel sorts them, numbers
+// before text before booleans before errors, with empty values last.
+func sortRank(r Result) int {
+	switch r.Type {
+	case ResultTypeNumber:
+		return 0
+	case ResultTypeString:
+		return 1
+	case ResultTypeBool:
+		return 2
+	case ResultTypeError:
+		return 3
+	}
+	return 4
+}
+
+// sortCompare compares two values for sorting, returning a negative number if
+// a sorts before b, a positive number if a sorts after b, or zero if they are
+// equal.
+func sortCompare(a, b Result) int {
+	ra, rb := sortRank(a), sortRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch a.Type {
+	case ResultTypeNumber, ResultTypeBool:
+		switch {
+		case a.ValueNumber < b.ValueNumber:
+			return -1
+		case a.ValueNumber > b.ValueNumber:
+			return 1
+		}
+	case ResultTypeString:
+		return strings.Compare(strings.ToLower(a.ValueString), strings.ToLower(b.ValueString))
+	}
+	return 0
+}
+
+// sortRows returns the rows sorted by the keys, where keys[k][i] is the k'th
+// key of the i'th row and orders[k] is 1 to sort that key ascending or -1 to
+// sort it descending.  The sort is stable.
+func sortRows(rows [][]Result, keys [][]Result, orders []int) [][]Result {
+	idx := make([]int, len(rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		for k, key := range keys {
+			if c := sortCompare(key[idx[i]], key[idx[j]]) * orders[k]; c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	ret := make([][]Result, len(rows))
+	for i, j := range idx {
+		ret[i] = rows[j]
+	}
+	return ret
+}
+
+// sortOrder returns the sort order argument of SORT and SORTBY.
+func sortOrder(args []Result, i int, fn string) (int, Result) {
+	order, err := optionalNumber(args, i, 1, fn)
+	if err.Type == ResultTypeError {
+		return 0, err
+	}
+	switch order {
+	case 1:
+		return 1, MakeEmptyResult()
+	case -1:
+		return -1, MakeEmptyResult()
+	}
+	return 0, MakeErrorResult(fn + " requires a sort order of 1 or -1")
+}
+
+// Sort is an implementation of the Excel SORT() function that returns the rows
+// or columns of an array sorted by one of its columns or rows.
+func Sort(args []Result) Result {
+	if len(args) < 1 || len(args) > 4 {
+		return MakeErrorResult("SORT requires one to four arguments")
+	}
+	arr := asArray(args[0])
+	index, err := optionalNumber(args, 1, 1, "SORT")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	order, err := sortOrder(args, 2, "SORT")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	byCol, err := optionalNumber(args, 3, 0, "SORT")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if byCol != 0 {
+		arr = transposeArray(arr)
+	}
+	col := int(index) - 1
+	if col < 0 || col >= len(arr[0]) {
+		return MakeErrorResult("SORT index is outside of the array")
+	}
+	key := make([]Result, len(arr))
+	for i, row := range arr {
+		key[i] = row[col]
+	}
+	ret := sortRows(arr, [][]Result{key}, []int{order})
+	if byCol != 0 {
+		ret = transposeArray(ret)
+	}
+	return MakeArrayResult(ret)
+}
+
+// SortBy is an implementation of the Excel SORTBY() function that returns the
+// rows or columns of an array sorted by the values in other ranges.
+func SortBy(args []Result) Result {
+	if len(args) < 2 {
+		return MakeErrorResult("SORTBY requires at least two arguments")
+	}
+	arr := asArray(args[0])
+	rows, cols := len(arr), len(arr[0])
+	keys := [][]Result{}
+	orders := []int{}
+	byCol := false
+	for i := 1; i < len(args); i += 2 {
+		r, c := dims(args[i])
+		switch {
+		case c == 1 && r == rows && (i == 1 || !byCol):
+		case r == 1 && c == cols && (i == 1 || byCol):
+			byCol = true
+		default:
+			return MakeErrorResult("SORTBY ranges must be a row or column the size of the array")
+		}
+		order, err := sortOrder(args, i+1, "SORTBY")
+		if err.Type == ResultTypeError {
+			return err
+		}
+		keys = append(keys, flatten(args[i]))
+		orders = append(orders, order)
+	}
+	if byCol {
+		arr = transposeArray(arr)
+	}
+	ret := sortRows(arr, keys, orders)
+	if byCol {
+		ret = transposeArray(ret)
+	}
+	return MakeArrayResult(ret)
+}
+
+// sameValues returns true if the values in two rows are equal, ignoring case.
+func sameValues(a, b []Result) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if compareResults(a[i], b[i], false) != cmpResultEqual {
+			return false
+		}
+	}
+	return true
+}
+
+// Unique is an implementation of the Excel UNIQUE() function that returns the
+// distinct rows or columns of an array.
+func Unique(args []Result) Result {
+	if len(args) < 1 || len(args) > 3 {
+		return MakeErrorResult("UNIQUE requires one to three arguments")
+	}
+	arr := asArray(args[0])
+	byCol, err := optionalNumber(args, 1, 0, "UNIQUE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	once, err := optionalNumber(args, 2, 0, "UNIQUE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if byCol != 0 {
+		arr = transposeArray(arr)
+	}
+	distinct := [][]Result{}
+	counts := []int{}
+lfor:
+	for _, row := range arr {
+		for i, d := range distinct {
+			if sameValues(row, d) {
+				counts[i]++
+				continue lfor
+			}
+		}
+		distinct = append(distinct, row)
+		counts = append(counts, 1)
+	}
+	ret := [][]Result{}
+	for i, row := range distinct {
+		if once == 0 || counts[i] == 1 {
+			ret = append(ret, row)
+		}
+	}
+	if len(ret) == 0 {
+		return MakeErrorResultType(ErrorTypeCalc, "UNIQUE result is empty")
+	}
+	if byCol != 0 {
+		ret = transposeArray(ret)
+	}
+	return MakeArrayResult(ret)
+}
+
+// lookupModes returns the match and search mode arguments of XLOOKUP and
+// XMATCH.
+func lookupModes(args []Result, i int, fn string) (int, int, Result) {
+	mm, err := optionalNumber(args, i, 0, fn)
+	if err.Type == ResultTypeError {
+		return 0, 0, err
+	}
+	sm, err := optionalNumber(args, i+1, 1, fn)
+	if err.Type == ResultTypeError {
+		return 0, 0, err
+	}
+	matchMode, searchMode := int(mm), int(sm)
+	if matchMode < -1 || matchMode > 2 {
+		return 0, 0, MakeErrorResult(fn + " requires a match mode of -1, 0, 1 or 2")
+	}
+	if searchMode != 1 && searchMode != -1 && searchMode != 2 && searchMode != -2 {
+		return 0, 0, MakeErrorResult(fn + " requires a search mode of 1, -1, 2 or -2")
+	}
+	return matchMode, searchMode, MakeEmptyResult()
+}
+
+// lookupVector returns the values of a range that must be a single row or
+// column, and whether it was a column.
+func lookupVector(r Result) ([]Result, bool, bool) {
+	rows, cols := dims(r)
+	switch {
+	case cols == 1:
+		return flatten(r), true, true
+	case rows == 1:
+		return flatten(r), false, true
+	}
+	return nil, false, false
+}
+
+// xlookupIndex returns the index of the value in values that matches v, or -1
+// if there is no match.  A match mode of 0 requires an exact match, -1 and 1
+// accept the next smaller or larger value, and 2 treats v as a wildcard
+// pattern.  A negative search mode searches from the last value to the first.
+// Binary searches (search modes 2 and -2) are performed as linear searches,
+// which give the same result for sorted values.
+func xlookupIndex(v Result, values []Result, matchMode, searchMode int) int {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+		if searchMode < 0 {
+			order[i] = len(values) - 1 - i
+		}
+	}
+	var pattern *regexp.Regexp
+	if matchMode == 2 && v.Type == ResultTypeString {
+		pattern = wildcardToRegexp(v.ValueString)
+	}
+	best := -1
+	for _, i := range order {
+		c := values[i]
+		if pattern != nil {
+			if c.Type == ResultTypeString && pattern.MatchString(c.ValueString) {
+				return i
+			}
+			continue
+		}
+		switch cmp := compareResults(c, v, false); {
+		case cmp == cmpResultEqual:
+			return i
+		case matchMode == -1 && cmp == cmpResultLess:
+			if best == -1 || compareResults(c, values[best], false) == cmpResultGreater {
+				best = i
+			}
+		case matchMode == 1 && cmp == cmpResultGreater:
+			if best == -1 || compareResults(c, values[best], false) == cmpResultLess {
+				best = i
+			}
+		}
+	}
+	return best
+}
+
+// XLookup is an implementation of the Excel XLOOKUP() function that searches a
+// row or column for a value and returns the corresponding value, row or column
+// from a second range.
+func XLookup(args []Result) Result {
+	if len(args) < 3 || len(args) > 6 {
+		return MakeErrorResult("XLOOKUP requires three to six arguments")
+	}
+	values, vertical, ok := lookupVector(args[1])
+	if !ok {
+		return MakeErrorResult("XLOOKUP lookup array must be a single row or column")
+	}
+	matchMode, searchMode, err := lookupModes(args, 4, "XLOOKUP")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	ret := asArray(args[2])
+	if vertical && len(ret) != len(values) || !vertical && len(ret[0]) != len(values) {
+		return MakeErrorResult("XLOOKUP return array must be the same size as the lookup array")
+	}
+
+	idx := xlookupIndex(args[0], values, matchMode, searchMode)
+	if idx == -1 {
+		if len(args) > 3 && args[3].Type != ResultTypeEmpty {
+			return args[3]
+		}
+		return MakeErrorResultType(ErrorTypeNA, "XLOOKUP no result found")
+	}
+	if vertical {
+		if len(ret[idx]) == 1 {
+			return ret[idx][0]
+		}
+		return MakeListResult(ret[idx])
+	}
+	if len(ret) == 1 {
+		return ret[0][idx]
+	}
+	col := make([][]Result, len(ret))
+	for i, row := range ret {
+		col[i] = []Result{row[idx]}
+	}
+	return MakeArrayResult(col)
+}
+
+// XMatch is an implementation of the Excel XMATCH() function that returns the
+// position of a value in a row or column.
+func XMatch(args []Result) Result {
+	if len(args) < 2 || len(args) > 4 {
+		return MakeErrorResult("XMATCH requires two to four arguments")
+	}
+	values, _, ok := lookupVector(args[1])
+	if !ok {
+		return MakeErrorResult("XMATCH lookup array must be a single row or column")
+	}
+	matchMode, searchMode, err := lookupModes(args, 2, "XMATCH")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	idx := xlookupIndex(args[0], values, matchMode, searchMode)
+	if idx == -1 {
+		return MakeErrorResultType(ErrorTypeNA, "XMATCH no result found")
+	}
+	return MakeNumberResult(float64(idx + 1))
+}
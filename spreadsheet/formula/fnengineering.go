@@ -0,0 +1,1073 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterFunction("BESSELI", BesselI)
+	RegisterFunction("BESSELJ", BesselJ)
+	RegisterFunction("BESSELK", BesselK)
+	RegisterFunction("BESSELY", BesselY)
+	RegisterFunction("BIN2DEC", makeBaseToDec("BIN2DEC", 2))
+	RegisterFunction("BIN2HEX", makeBaseToBase("BIN2HEX", 2, 16))
+	RegisterFunction("BIN2OCT", makeBaseToBase("BIN2OCT", 2, 8))
+	RegisterFunction("_xlfn.BITAND", makeBitWrapper("BITAND", func(a, b uint64) uint64 { return a & b }))
+	RegisterFunction("_xlfn.BITLSHIFT", makeBitShift("BITLSHIFT", 1))
+	RegisterFunction("_xlfn.BITOR", makeBitWrapper("BITOR", func(a, b uint64) uint64 { return a | b }))
+	RegisterFunction("_xlfn.BITRSHIFT", makeBitShift("BITRSHIFT", -1))
+	RegisterFunction("_xlfn.BITXOR", makeBitWrapper("BITXOR", func(a, b uint64) uint64 { return a ^ b }))
+	RegisterFunction("COMPLEX", Complex)
+	RegisterFunction("CONVERT", Convert)
+	RegisterFunction("DEC2BIN", makeDecToBase("DEC2BIN", 2))
+	RegisterFunction("DEC2HEX", makeDecToBase("DEC2HEX", 16))
+	RegisterFunction("DEC2OCT", makeDecToBase("DEC2OCT", 8))
+	RegisterFunction("DELTA", Delta)
+	RegisterFunction("ERF", Erf)
+	RegisterFunction("_xlfn.ERF.PRECISE", ErfPrecise)
+	RegisterFunction("ERFC", ErfC)
+	RegisterFunction("_xlfn.ERFC.PRECISE", ErfC)
+	RegisterFunction("GESTEP", GeStep)
+	RegisterFunction("HEX2BIN", makeBaseToBase("HEX2BIN", 16, 2))
+	RegisterFunction("HEX2DEC", makeBaseToDec("HEX2DEC", 16))
+	RegisterFunction("HEX2OCT", makeBaseToBase("HEX2OCT", 16, 8))
+	RegisterFunction("IMABS", makeImValue("IMABS", cmplx.Abs))
+	RegisterFunction("IMAGINARY", makeImValue("IMAGINARY", func(z complex128) float64 { return imag(z) }))
+	RegisterFunction("IMARGUMENT", ImArgument)
+	RegisterFunction("IMCONJUGATE", makeImWrapper("IMCONJUGATE", cmplx.Conj))
+	RegisterFunction("IMCOS", makeImWrapper("IMCOS", cmplx.Cos))
+	RegisterFunction("_xlfn.IMCOSH", makeImWrapper("IMCOSH", cmplx.Cosh))
+	RegisterFunction("_xlfn.IMCOT", makeImWrapperInv("IMCOT", cmplx.Tan))
+	RegisterFunction("_xlfn.IMCSC", makeImWrapperInv("IMCSC", cmplx.Sin))
+	RegisterFunction("_xlfn.IMCSCH", makeImWrapperInv("IMCSCH", cmplx.Sinh))
+	RegisterFunction("IMDIV", ImDiv)
+	RegisterFunction("IMEXP", makeImWrapper("IMEXP", cmplx.Exp))
+	RegisterFunction("IMLN", makeImLog("IMLN", 1))
+	RegisterFunction("IMLOG10", makeImLog("IMLOG10", math.Ln10))
+	RegisterFunction("IMLOG2", makeImLog("IMLOG2", math.Ln2))
+	RegisterFunction("IMPOWER", ImPower)
+	RegisterFunction("IMPRODUCT", ImProduct)
+	RegisterFunction("IMREAL", makeImValue("IMREAL", func(z complex128) float64 { return real(z) }))
+	RegisterFunction("_xlfn.IMSEC", makeImWrapperInv("IMSEC", cmplx.Cos))
+	RegisterFunction("_xlfn.IMSECH", makeImWrapperInv("IMSECH", cmplx.Cosh))
+	RegisterFunction("IMSIN", makeImWrapper("IMSIN", cmplx.Sin))
+	RegisterFunction("_xlfn.IMSINH", makeImWrapper("IMSINH", cmplx.Sinh))
+	RegisterFunction("IMSQRT", makeImWrapper("IMSQRT", cmplx.Sqrt))
+	RegisterFunction("IMSUB", ImSub)
+	RegisterFunction("IMSUM", ImSum)
+	RegisterFunction("_xlfn.IMTAN", makeImWrapper("IMTAN", cmplx.Tan))
+	RegisterFunction("OCT2BIN", makeBaseToBase("OCT2BIN", 8, 2))
+	RegisterFunction("OCT2DEC", makeBaseToDec("OCT2DEC", 8))
+	RegisterFunction("OCT2HEX", makeBaseToBase("OCT2HEX", 8, 16))
+}
+
+// baseDigits is the number of digits that the base conversion functions
+// accept and return.  Negative numbers are represented by the two's
+// complement of all of the digits.
+const baseDigits = 10
+
+// baseBits returns the number of bits represented by the ten digits of a
+// number in base 2, 8 or 16.
+func baseBits(base int) uint {
+	switch base {
+	case 2:
+		return baseDigits
+	case 8:
+		return 3 * baseDigits
+	}
+	return 4 * baseDigits
+}
+
+// parseBase parses the number argument of a function that converts from base
+// 2, 8 or 16.
+func parseBase(r Result, base int, fn string) (int64, Result) {
+	s := ""
+	switch r.Type {
+	case ResultTypeNumber:
+		s = strconv.FormatFloat(r.ValueNumber, 'f', -1, 64)
+	case ResultTypeString:
+		s = r.ValueString
+	case ResultTypeEmpty:
+	case ResultTypeError:
+		return 0, r
+	default:
+		return 0, MakeErrorResult(fn + " requires a number argument")
+	}
+	if s == "" {
+		return 0, MakeEmptyResult()
+	}
+	if len(s) > baseDigits {
+		return 0, MakeErrorResultType(ErrorTypeNum, fn+" accepts at most 10 digits")
+	}
+	u, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		return 0, MakeErrorResultType(ErrorTypeNum, fn+" has an invalid number "+s)
+	}
+	v := int64(u)
+	bits := baseBits(base)
+	if len(s) == baseDigits && v >= 1<<(bits-1) {
+		v -= 1 << bits
+	}
+	return v, MakeEmptyResult()
+}
+
+// formatBase formats a number in base 2, 8 or 16, padded with zeros to the
+// optional number of places in args[i].
+func formatBase(v int64, base int, args []Result, i int, fn string) Result {
+	bits := baseBits(base)
+	if v < -(1<<(bits-1)) || v >= 1<<(bits-1) {
+		return MakeErrorResultType(ErrorTypeNum, fn+" number out of range")
+	}
+	if v < 0 {
+		// the number of places is ignored for negative numbers
+		return MakeStringResult(strings.ToUpper(strconv.FormatInt(v+1<<bits, base)))
+	}
+	s := strings.ToUpper(strconv.FormatInt(v, base))
+	if i < len(args) && args[i].Type != ResultTypeEmpty {
+		p, errResult := numberArg(args[i], fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		places := int(p)
+		if places < len(s) || places > baseDigits {
+			return MakeErrorResultType(ErrorTypeNum, fn+" has an invalid number of places")
+		}
+		s = strings.Repeat("0", places-len(s)) + s
+	}
+	return MakeStringResult(s)
+}
+
+// makeDecToBase returns a function like DEC2BIN that converts a decimal number
+// to another base.
+func makeDecToBase(fn string, base int) Function {
+	return func(args []Result) Result {
+		if len(args) != 1 && len(args) != 2 {
+			return MakeErrorResult(fn + " requires one or two arguments")
+		}
+		v, errResult := numberArg(args[0], fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		return formatBase(int64(v), base, args, 1, fn)
+	}
+}
+
+// makeBaseToDec returns a function like BIN2DEC that converts a number in
+// another base to decimal.
+func makeBaseToDec(fn string, base int) Function {
+	return func(args []Result) Result {
+		if len(args) != 1 {
+			return MakeErrorResult(fn + " requires one argument")
+		}
+		v, errResult := parseBase(args[0], base, fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		return MakeNumberResult(float64(v))
+	}
+}
+
+// makeBaseToBase returns a function like BIN2HEX that converts a number
+// between bases.
+func makeBaseToBase(fn string, from, to int) Function {
+	return func(args []Result) Result {
+		if len(args) != 1 && len(args) != 2 {
+			return MakeErrorResult(fn + " requires one or two arguments")
+		}
+		v, errResult := parseBase(args[0], from, fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		return formatBase(v, to, args, 1, fn)
+	}
+}
+
+// maxBitValue is the limit on the numbers accepted by the bit functions.
+const maxBitValue = 1 << 48
+
+// bitArg returns an argument of the bit functions, which must be a non-negative
+// integer less than 2^48.
+func bitArg(r Result, fn string) (uint64, Result) {
+	v, errResult := numberArg(r, fn)
+	if errResult.Type == ResultTypeError {
+		return 0, errResult
+	}
+	if v < 0 || v >= maxBitValue || v != math.Trunc(v) {
+		return 0, MakeErrorResultType(ErrorTypeNum, fn+" requires integers between 0 and 2^48")
+	}
+	return uint64(v), MakeEmptyResult()
+}
+
+// makeBitWrapper returns a function like BITAND that combines the bits of two
+// numbers.
+func makeBitWrapper(fn string, op func(a, b uint64) uint64) Function {
+	return func(args []Result) Result {
+		if len(args) != 2 {
+			return MakeErrorResult(fn + " requires two arguments")
+		}
+		a, errResult := bitArg(args[0], fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		b, errResult := bitArg(args[1], fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		return MakeNumberResult(float64(op(a, b)))
+	}
+}
+
+// makeBitShift returns BITLSHIFT or BITRSHIFT, which shift a number in the
+// given direction.  A negative shift amount shifts in the opposite direction.
+func makeBitShift(fn string, dir int) Function {
+	return func(args []Result) Result {
+		if len(args) != 2 {
+			return MakeErrorResult(fn + " requires two arguments")
+		}
+		v, errResult := bitArg(args[0], fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		s, errResult := numberArg(args[1], fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		shift := int(s) * dir
+		if shift > 53 || shift < -53 {
+			return MakeErrorResultType(ErrorTypeNum, fn+" shift amount must be between -53 and 53")
+		}
+		if shift < 0 {
+			return MakeNumberResult(float64(v >> uint(-shift)))
+		}
+		v <<= uint(shift)
+		if v >= maxBitValue {
+			return MakeErrorResultType(ErrorTypeNum, fn+" result must be less than 2^48")
+		}
+		return MakeNumberResult(float64(v))
+	}
+}
+
+// Delta is an implementation of the Excel DELTA() function that returns 1 if
+// two numbers are equal.
+func Delta(args []Result) Result {
+	if len(args) != 1 && len(args) != 2 {
+		return MakeErrorResult("DELTA requires one or two arguments")
+	}
+	a, errResult := numberArg(args[0], "DELTA")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	b := 0.0
+	if len(args) == 2 {
+		if b, errResult = numberArg(args[1], "DELTA"); errResult.Type == ResultTypeError {
+			return errResult
+		}
+	}
+	if a == b {
+		return MakeNumberResult(1)
+	}
+	return MakeNumberResult(0)
+}
+
+// GeStep is an implementation of the Excel GESTEP() function that returns 1 if
+// a number is greater than or equal to a step value.
+func GeStep(args []Result) Result {
+	if len(args) != 1 && len(args) != 2 {
+		return MakeErrorResult("GESTEP requires one or two arguments")
+	}
+	v, errResult := numberArg(args[0], "GESTEP")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	step := 0.0
+	if len(args) == 2 {
+		if step, errResult = numberArg(args[1], "GESTEP"); errResult.Type == ResultTypeError {
+			return errResult
+		}
+	}
+	if v >= step {
+		return MakeNumberResult(1)
+	}
+	return MakeNumberResult(0)
+}
+
+// Erf is an implementation of the Excel ERF() function that returns the error
+// function integrated between zero and a limit, or between two limits.
+func Erf(args []Result) Result {
+	if len(args) != 1 && len(args) != 2 {
+		return MakeErrorResult("ERF requires one or two arguments")
+	}
+	lower, errResult := numberArg(args[0], "ERF")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if len(args) == 2 {
+		upper, errResult := numberArg(args[1], "ERF")
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		return MakeNumberResult(math.Erf(upper) - math.Erf(lower))
+	}
+	return MakeNumberResult(math.Erf(lower))
+}
+
+// ErfPrecise is an implementation of the Excel ERF.PRECISE() function.
+func ErfPrecise(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("ERF.PRECISE requires one argument")
+	}
+	return Erf(args)
+}
+
+// ErfC is an implementation of the Excel ERFC() and ERFC.PRECISE() functions
+// that return the complementary error function.
+func ErfC(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("ERFC requires one argument")
+	}
+	v, errResult := numberArg(args[0], "ERFC")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	return MakeNumberResult(math.Erfc(v))
+}
+
+// besselArgs returns the x and order arguments of the Bessel functions.  The
+// order is truncated to an integer and must not be negative.
+func besselArgs(args []Result, fn string) (float64, int, Result) {
+	if len(args) != 2 {
+		return 0, 0, MakeErrorResult(fn + " requires two arguments")
+	}
+	x, errResult := numberArg(args[0], fn)
+	if errResult.Type == ResultTypeError {
+		return 0, 0, errResult
+	}
+	n, errResult := numberArg(args[1], fn)
+	if errResult.Type == ResultTypeError {
+		return 0, 0, errResult
+	}
+	if n < 0 {
+		return 0, 0, MakeErrorResultType(ErrorTypeNum, fn+" requires a non-negative order")
+	}
+	return x, int(n), MakeEmptyResult()
+}
+
+// BesselJ is an implementation of the Excel BESSELJ() function that returns
+// the Bessel function of the first kind.
+func BesselJ(args []Result) Result {
+	x, n, errResult := besselArgs(args, "BESSELJ")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	return MakeNumberResult(math.Jn(n, x))
+}
+
+// BesselY is an implementation of the Excel BESSELY() function that returns
+// the Bessel function of the second kind.
+func BesselY(args []Result) Result {
+	x, n, errResult := besselArgs(args, "BESSELY")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if x <= 0 {
+		return MakeErrorResultType(ErrorTypeNum, "BESSELY requires a positive x")
+	}
+	return MakeNumberResult(math.Yn(n, x))
+}
+
+// BesselI is an implementation of the Excel BESSELI() function that returns
+// the modified Bessel function of the first kind.
+func BesselI(args []Result) Result {
+	x, n, errResult := besselArgs(args, "BESSELI")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	return MakeNumberResult(besselI(x, n))
+}
+
+// besselI computes the modified Bessel function of the first kind from its
+// power series.
+func besselI(x float64, n int) float64 {
+	h := x / 2
+	term := 1.0
+	for i := 1; i <= n; i++ {
+		term *= h / float64(i)
+	}
+	sum := term
+	for k := 1; k < 1000; k++ {
+		term *= h * h / (float64(k) * float64(k+n))
+		sum += term
+		if math.Abs(term) <= 1e-16*math.Abs(sum) {
+			break
+		}
+	}
+	return sum
+}
+
+// BesselK is an implementation of the Excel BESSELK() function that returns
+// the modified Bessel function of the second kind.
+func BesselK(args []Result) Result {
+	x, n, errResult := besselArgs(args, "BESSELK")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if x <= 0 {
+		return MakeErrorResultType(ErrorTypeNum, "BESSELK requires a positive x")
+	}
+	// K0 and K1 use the polynomial approximations from Abramowitz and Stegun,
+	// and higher orders the recurrence relation
+	var k0, k1 float64
+	if x <= 2 {
+		y := x * x / 4
+		k0 = -math.Log(x/2)*besselI(x, 0) + (-0.57721566 + y*(0.42278420+y*(0.23069756+
+			y*(0.3488590e-1+y*(0.262698e-2+y*(0.10750e-3+y*0.74e-5))))))
+		k1 = math.Log(x/2)*besselI(x, 1) + (1/x)*(1+y*(0.15443144+y*(-0.67278579+
+			y*(-0.18156897+y*(-0.1919402e-1+y*(-0.110404e-2+y*(-0.4686e-4)))))))
+	} else {
+		y := 2 / x
+		k0 = math.Exp(-x) / math.Sqrt(x) * (1.25331414 + y*(-0.7832358e-1+y*(0.2189568e-1+
+			y*(-0.1062446e-1+y*(0.587872e-2+y*(-0.251540e-2+y*0.53208e-3))))))
+		k1 = math.Exp(-x) / math.Sqrt(x) * (1.25331414 + y*(0.23498619+y*(-0.3655620e-1+
+			y*(0.1504268e-1+y*(-0.780353e-2+y*(0.325614e-2+y*(-0.68245e-3)))))))
+	}
+	if n == 0 {
+		return MakeNumberResult(k0)
+	}
+	for i := 1; i < n; i++ {
+		k0, k1 = k1, k0+float64(2*i)/x*k1
+	}
+	return MakeNumberResult(k1)
+}
+
+// parseImPart parses the real or imaginary part of a complex number.
+func parseImPart(s string) (float64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-') {
+			return 0, false
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+// parseComplex parses a complex number argument of the form x+yi or x+yj.  The
+// returned suffix is 0 if the number has no imaginary part.
+func parseComplex(r Result, fn string) (complex128, byte, Result) {
+	switch r.Type {
+	case ResultTypeNumber:
+		return complex(r.ValueNumber, 0), 0, MakeEmptyResult()
+	case ResultTypeEmpty:
+		return 0, 0, MakeEmptyResult()
+	case ResultTypeError:
+		return 0, 0, r
+	case ResultTypeString:
+	default:
+		return 0, 0, MakeErrorResult(fn + " requires a complex number argument")
+	}
+	s := r.ValueString
+	invalid := MakeErrorResultType(ErrorTypeNum, fn+" has an invalid complex number "+s)
+	if s == "" {
+		return 0, 0, invalid
+	}
+	suffix := s[len(s)-1]
+	if suffix != 'i' && suffix != 'j' {
+		re, ok := parseImPart(s)
+		if !ok {
+			return 0, 0, invalid
+		}
+		return complex(re, 0), 0, MakeEmptyResult()
+	}
+
+	// split before the sign of the imaginary part, which isn't the sign of an
+	// exponent
+	body := s[:len(s)-1]
+	split := -1
+	for i := len(body) - 1; i > 0; i-- {
+		if (body[i] == '+' || body[i] == '-') && body[i-1] != 'e' && body[i-1] != 'E' {
+			split = i
+			break
+		}
+	}
+	re, imStr := 0.0, body
+	if split != -1 {
+		var ok bool
+		if re, ok = parseImPart(body[:split]); !ok {
+			return 0, 0, invalid
+		}
+		imStr = body[split:]
+	}
+	var im float64
+	switch imStr {
+	case "", "+":
+		im = 1
+	case "-":
+		im = -1
+	default:
+		var ok bool
+		if im, ok = parseImPart(imStr); !ok {
+			return 0, 0, invalid
+		}
+	}
+	return complex(re, im), suffix, MakeEmptyResult()
+}
+
+// combineSuffix returns the suffix for the result of a function of several
+// complex numbers, which can't mix i and j.
+func combineSuffix(a, b byte) (byte, bool) {
+	if a == 0 {
+		return b, true
+	}
+	if b == 0 || a == b {
+		return a, true
+	}
+	return 0, false
+}
+
+// formatImPart formats the real or imaginary part of a complex number with
+// the fifteen significant digits that Excel uses.
+func formatImPart(v float64) string {
+	if v == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(v, 'G', 15, 64)
+}
+
+// formatComplex formats a complex number result, e.g. 3+4i.
+func formatComplex(z complex128, suffix byte) Result {
+	if cmplx.IsNaN(z) || cmplx.IsInf(z) {
+		return MakeErrorResultType(ErrorTypeNum, "complex number out of range")
+	}
+	if suffix == 0 {
+		suffix = 'i'
+	}
+	re, im := real(z), imag(z)
+	if im == 0 {
+		return MakeStringResult(formatImPart(re))
+	}
+	imStr := formatImPart(im)
+	switch im {
+	case 1:
+		imStr = ""
+	case -1:
+		imStr = "-"
+	}
+	if re == 0 {
+		return MakeStringResult(imStr + string(suffix))
+	}
+	sign := ""
+	if im > 0 {
+		sign = "+"
+	}
+	return MakeStringResult(formatImPart(re) + sign + imStr + string(suffix))
+}
+
+// Complex is an implementation of the Excel COMPLEX() function that returns a
+// complex number from its real and imaginary parts.
+func Complex(args []Result) Result {
+	if len(args) != 2 && len(args) != 3 {
+		return MakeErrorResult("COMPLEX requires two or three arguments")
+	}
+	re, errResult := numberArg(args[0], "COMPLEX")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	im, errResult := numberArg(args[1], "COMPLEX")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	suffix := byte('i')
+	if len(args) == 3 && args[2].Type != ResultTypeEmpty {
+		switch args[2].ValueString {
+		case "i":
+		case "j":
+			suffix = 'j'
+		default:
+			return MakeErrorResult("COMPLEX suffix must be i or j")
+		}
+	}
+	return formatComplex(complex(re, im), suffix)
+}
+
+// makeImValue returns a function like IMABS that returns a number computed
+// from a complex number.
+func makeImValue(fn string, f func(z complex128) float64) Function {
+	return func(args []Result) Result {
+		if len(args) != 1 {
+			return MakeErrorResult(fn + " requires one argument")
+		}
+		z, _, errResult := parseComplex(args[0], fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		return MakeNumberResult(f(z))
+	}
+}
+
+// makeImWrapper returns a function like IMSIN that applies a function to a
+// complex number.
+func makeImWrapper(fn string, f func(z complex128) complex128) Function {
+	return func(args []Result) Result {
+		if len(args) != 1 {
+			return MakeErrorResult(fn + " requires one argument")
+		}
+		z, suffix, errResult := parseComplex(args[0], fn)
+		if errResult.Type == ResultTypeError {
+			return errResult
+		}
+		return formatComplex(f(z), suffix)
+	}
+}
+
+// makeImWrapperInv returns a function like IMSEC that returns the reciprocal
+// of a function of a complex number.
+func makeImWrapperInv(fn string, f func(z complex128) complex128) Function {
+	return makeImWrapper(fn, func(z complex128) complex128 {
+		v := f(z)
+		if v == 0 {
+			return cmplx.Inf()
+		}
+		return 1 / v
+	})
+}
+
+// makeImLog returns IMLN, IMLOG10 or IMLOG2 which return the logarithm of a
+// complex number, divided by the natural logarithm of the base.
+func makeImLog(fn string, lnBase float64) Function {
+	return makeImWrapper(fn, func(z complex128) complex128 {
+		if z == 0 {
+			return cmplx.Inf()
+		}
+		return cmplx.Log(z) / complex(lnBase, 0)
+	})
+}
+
+// ImArgument is an implementation of the Excel IMARGUMENT() function that
+// returns the angle of a complex number in radians.
+func ImArgument(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("IMARGUMENT requires one argument")
+	}
+	z, _, errResult := parseComplex(args[0], "IMARGUMENT")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if z == 0 {
+		return MakeErrorResultType(ErrorTypeDivideByZero, "IMARGUMENT of zero")
+	}
+	return MakeNumberResult(cmplx.Phase(z))
+}
+
+// imPair parses the two complex number arguments of IMDIV and IMSUB.
+func imPair(args []Result, fn string) (complex128, complex128, byte, Result) {
+	if len(args) != 2 {
+		return 0, 0, 0, MakeErrorResult(fn + " requires two arguments")
+	}
+	a, sa, errResult := parseComplex(args[0], fn)
+	if errResult.Type == ResultTypeError {
+		return 0, 0, 0, errResult
+	}
+	b, sb, errResult := parseComplex(args[1], fn)
+	if errResult.Type == ResultTypeError {
+		return 0, 0, 0, errResult
+	}
+	suffix, ok := combineSuffix(sa, sb)
+	if !ok {
+		return 0, 0, 0, MakeErrorResult(fn + " can't mix i and j suffixes")
+	}
+	return a, b, suffix, MakeEmptyResult()
+}
+
+// ImDiv is an implementation of the Excel IMDIV() function that divides two
+// complex numbers.
+func ImDiv(args []Result) Result {
+	a, b, suffix, errResult := imPair(args, "IMDIV")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if b == 0 {
+		return MakeErrorResultType(ErrorTypeNum, "IMDIV by zero")
+	}
+	return formatComplex(a/b, suffix)
+}
+
+// ImSub is an implementation of the Excel IMSUB() function that subtracts two
+// complex numbers.
+func ImSub(args []Result) Result {
+	a, b, suffix, errResult := imPair(args, "IMSUB")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	return formatComplex(a-b, suffix)
+}
+
+// ImPower is an implementation of the Excel IMPOWER() function that raises a
+// complex number to a power.
+func ImPower(args []Result) Result {
+	if len(args) != 2 {
+		return MakeErrorResult("IMPOWER requires two arguments")
+	}
+	z, suffix, errResult := parseComplex(args[0], "IMPOWER")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	n, errResult := numberArg(args[1], "IMPOWER")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	if z == 0 && n <= 0 {
+		return MakeErrorResultType(ErrorTypeNum, "IMPOWER of zero")
+	}
+	return formatComplex(cmplx.Pow(z, complex(n, 0)), suffix)
+}
+
+// imFold combines the complex numbers in the arguments of IMSUM and
+// IMPRODUCT, which may be ranges.
+func imFold(args []Result, fn string, init complex128, op func(a, b complex128) complex128) Result {
+	if len(args) == 0 {
+		return MakeErrorResult(fn + " requires at least one argument")
+	}
+	acc, suffix := init, byte(0)
+	for _, a := range args {
+		for _, v := range flatten(a) {
+			if v.Type == ResultTypeEmpty && a.Type != ResultTypeEmpty {
+				// empty cells in ranges are ignored
+				continue
+			}
+			z, s, errResult := parseComplex(v, fn)
+			if errResult.Type == ResultTypeError {
+				return errResult
+			}
+			var ok bool
+			if suffix, ok = combineSuffix(suffix, s); !ok {
+				return MakeErrorResult(fn + " can't mix i and j suffixes")
+			}
+			acc = op(acc, z)
+		}
+	}
+	return formatComplex(acc, suffix)
+}
+
+// ImSum is an implementation of the Excel IMSUM() function that adds complex
+// numbers.
+func ImSum(args []Result) Result {
+	return imFold(args, "IMSUM", 0, func(a, b complex128) complex128 { return a + b })
+}
+
+// ImProduct is an implementation of the Excel IMPRODUCT() function that
+// multiplies complex numbers.
+func ImProduct(args []Result) Result {
+	return imFold(args, "IMPRODUCT", 1, func(a, b complex128) complex128 { return a * b })
+}
+
+// unitCategory is the quantity that a unit of CONVERT measures.  Only units of
+// the same category can be converted.
+type unitCategory byte
+
+const (
+	unitMass unitCategory = iota
+	unitDistance
+	unitTime
+	unitPressure
+	unitForce
+	unitEnergy
+	unitPower
+	unitMagnetism
+	unitTemperature
+	unitVolume
+	unitArea
+	unitInformation
+	unitSpeed
+)
+
+// unit is a unit of measurement for CONVERT.  A value is converted to the base
+// unit of its category by adding the offset and multiplying by the factor.
+type unit struct {
+	category unitCategory
+	factor   float64
+	offset   float64
+	// prefixed units can be used with a metric prefix, which is raised to the
+	// power of the unit (e.g. km2 is 1e6 m2)
+	prefixed bool
+	power    int
+}
+
+const (
+	inch     = 0.0254
+	foot     = 0.3048
+	yard     = 0.9144
+	mile     = 1609.344
+	nmile    = 1852
+	pica     = inch / 72
+	lyear    = 9.4607304725808e15
+	angstrom = 1e-10
+)
+
+// units are the units of measurement that CONVERT supports, along with their
+// alternative names.
+var units = map[string]unit{
+	// mass, in grams
+	"g":        {unitMass, 1, 0, true, 1},
+	"sg":       {unitMass, 14593.902937206364, 0, false, 1},
+	"lbm":      {unitMass, 453.59237, 0, false, 1},
+	"u":        {unitMass, 1.660538782e-24, 0, true, 1},
+	"ozm":      {unitMass, 28.349523125, 0, false, 1},
+	"grain":    {unitMass, 0.06479891, 0, false, 1},
+	"cwt":      {unitMass, 45359.237, 0, false, 1},
+	"shweight": {unitMass, 45359.237, 0, false, 1},
+	"uk_cwt":   {unitMass, 50802.34544, 0, false, 1},
+	"lcwt":     {unitMass, 50802.34544, 0, false, 1},
+	"hweight":  {unitMass, 50802.34544, 0, false, 1},
+	"stone":    {unitMass, 6350.29318, 0, false, 1},
+	"ton":      {unitMass, 907184.74, 0, false, 1},
+	"uk_ton":   {unitMass, 1016046.9088, 0, false, 1},
+	"LTON":     {unitMass, 1016046.9088, 0, false, 1},
+	"brton":    {unitMass, 1016046.9088, 0, false, 1},
+
+	// distance, in meters
+	"m":         {unitDistance, 1, 0, true, 1},
+	"mi":        {unitDistance, mile, 0, false, 1},
+	"Nmi":       {unitDistance, nmile, 0, false, 1},
+	"in":        {unitDistance, inch, 0, false, 1},
+	"ft":        {unitDistance, foot, 0, false, 1},
+	"yd":        {unitDistance, yard, 0, false, 1},
+	"ang":       {unitDistance, angstrom, 0, true, 1},
+	"ell":       {unitDistance, 1.143, 0, false, 1},
+	"ly":        {unitDistance, lyear, 0, true, 1},
+	"parsec":    {unitDistance, 3.08567758128155e16, 0, false, 1},
+	"pc":        {unitDistance, 3.08567758128155e16, 0, false, 1},
+	"Picapt":    {unitDistance, pica, 0, false, 1},
+	"Pica":      {unitDistance, pica, 0, false, 1},
+	"pica":      {unitDistance, inch / 6, 0, false, 1},
+	"survey_mi": {unitDistance, 1609.3472186944373, 0, false, 1},
+
+	// time, in seconds
+	"yr":  {unitTime, 31557600, 0, false, 1},
+	"day": {unitTime, 86400, 0, false, 1},
+	"d":   {unitTime, 86400, 0, false, 1},
+	"hr":  {unitTime, 3600, 0, false, 1},
+	"mn":  {unitTime, 60, 0, false, 1},
+	"min": {unitTime, 60, 0, false, 1},
+	"sec": {unitTime, 1, 0, true, 1},
+	"s":   {unitTime, 1, 0, true, 1},
+
+	// pressure, in pascals
+	"Pa":   {unitPressure, 1, 0, true, 1},
+	"p":    {unitPressure, 1, 0, true, 1},
+	"atm":  {unitPressure, 101325, 0, true, 1},
+	"at":   {unitPressure, 101325, 0, true, 1},
+	"mmHg": {unitPressure, 133.322, 0, true, 1},
+	"psi":  {unitPressure, 6894.757293168361, 0, false, 1},
+	"Torr": {unitPressure, 133.32236842105263, 0, false, 1},
+
+	// force, in newtons
+	"N":    {unitForce, 1, 0, true, 1},
+	"dyn":  {unitForce, 1e-5, 0, true, 1},
+	"dy":   {unitForce, 1e-5, 0, true, 1},
+	"lbf":  {unitForce, 4.4482216152605, 0, false, 1},
+	"pond": {unitForce, 9.80665e-3, 0, true, 1},
+
+	// energy, in joules
+	"J":   {unitEnergy, 1, 0, true, 1},
+	"e":   {unitEnergy, 1e-7, 0, true, 1},
+	"c":   {unitEnergy, 4.184, 0, true, 1},
+	"cal": {unitEnergy, 4.1868, 0, true, 1},
+	"eV":  {unitEnergy, 1.602176487e-19, 0, true, 1},
+	"ev":  {unitEnergy, 1.602176487e-19, 0, true, 1},
+	"HPh": {unitEnergy, 2684519.5376961706, 0, false, 1},
+	"hh":  {unitEnergy, 2684519.5376961706, 0, false, 1},
+	"Wh":  {unitEnergy, 3600, 0, true, 1},
+	"wh":  {unitEnergy, 3600, 0, true, 1},
+	"flb": {unitEnergy, 0.04214011009380476, 0, false, 1},
+	"BTU": {unitEnergy, 1055.05585262, 0, false, 1},
+	"btu": {unitEnergy, 1055.05585262, 0, false, 1},
+
+	// power, in watts
+	"HP": {unitPower, 745.6998715822702, 0, false, 1},
+	"h":  {unitPower, 745.6998715822702, 0, false, 1},
+	"PS": {unitPower, 735.49875, 0, false, 1},
+	"W":  {unitPower, 1, 0, true, 1},
+	"w":  {unitPower, 1, 0, true, 1},
+
+	// magnetism, in teslas
+	"T":  {unitMagnetism, 1, 0, true, 1},
+	"ga": {unitMagnetism, 1e-4, 0, true, 1},
+
+	// temperature, in degrees Celsius
+	"C":    {unitTemperature, 1, 0, false, 1},
+	"cel":  {unitTemperature, 1, 0, false, 1},
+	"F":    {unitTemperature, 5.0 / 9, -32, false, 1},
+	"fah":  {unitTemperature, 5.0 / 9, -32, false, 1},
+	"K":    {unitTemperature, 1, -273.15, true, 1},
+	"kel":  {unitTemperature, 1, -273.15, true, 1},
+	"Rank": {unitTemperature, 5.0 / 9, -491.67, false, 1},
+	"Reau": {unitTemperature, 1.25, 0, false, 1},
+
+	// volume, in cubic meters
+	"tsp":      {unitVolume, 4.92892159375e-6, 0, false, 1},
+	"tspm":     {unitVolume, 5e-6, 0, false, 1},
+	"tbs":      {unitVolume, 1.478676478125e-5, 0, false, 1},
+	"oz":       {unitVolume, 2.95735295625e-5, 0, false, 1},
+	"cup":      {unitVolume, 2.365882365e-4, 0, false, 1},
+	"pt":       {unitVolume, 4.73176473e-4, 0, false, 1},
+	"us_pt":    {unitVolume, 4.73176473e-4, 0, false, 1},
+	"uk_pt":    {unitVolume, 5.6826125e-4, 0, false, 1},
+	"qt":       {unitVolume, 9.46352946e-4, 0, false, 1},
+	"uk_qt":    {unitVolume, 1.1365225e-3, 0, false, 1},
+	"gal":      {unitVolume, 3.785411784e-3, 0, false, 1},
+	"uk_gal":   {unitVolume, 4.54609e-3, 0, false, 1},
+	"l":        {unitVolume, 1e-3, 0, true, 1},
+	"L":        {unitVolume, 1e-3, 0, true, 1},
+	"lt":       {unitVolume, 1e-3, 0, true, 1},
+	"ang3":     {unitVolume, angstrom * angstrom * angstrom, 0, true, 3},
+	"ang^3":    {unitVolume, angstrom * angstrom * angstrom, 0, true, 3},
+	"barrel":   {unitVolume, 0.158987294928, 0, false, 1},
+	"bushel":   {unitVolume, 0.03523907016688, 0, false, 1},
+	"ft3":      {unitVolume, foot * foot * foot, 0, false, 3},
+	"ft^3":     {unitVolume, foot * foot * foot, 0, false, 3},
+	"in3":      {unitVolume, inch * inch * inch, 0, false, 3},
+	"in^3":     {unitVolume, inch * inch * inch, 0, false, 3},
+	"ly3":      {unitVolume, lyear * lyear * lyear, 0, false, 3},
+	"ly^3":     {unitVolume, lyear * lyear * lyear, 0, false, 3},
+	"m3":       {unitVolume, 1, 0, true, 3},
+	"m^3":      {unitVolume, 1, 0, true, 3},
+	"mi3":      {unitVolume, mile * mile * mile, 0, false, 3},
+	"mi^3":     {unitVolume, mile * mile * mile, 0, false, 3},
+	"yd3":      {unitVolume, yard * yard * yard, 0, false, 3},
+	"yd^3":     {unitVolume, yard * yard * yard, 0, false, 3},
+	"Nmi3":     {unitVolume, nmile * nmile * nmile, 0, false, 3},
+	"Nmi^3":    {unitVolume, nmile * nmile * nmile, 0, false, 3},
+	"Picapt3":  {unitVolume, pica * pica * pica, 0, false, 3},
+	"Picapt^3": {unitVolume, pica * pica * pica, 0, false, 3},
+	"Pica3":    {unitVolume, pica * pica * pica, 0, false, 3},
+	"Pica^3":   {unitVolume, pica * pica * pica, 0, false, 3},
+	"GRT":      {unitVolume, 2.8316846592, 0, false, 1},
+	"regton":   {unitVolume, 2.8316846592, 0, false, 1},
+	"MTON":     {unitVolume, 1.13267386368, 0, false, 1},
+
+	// area, in square meters
+	"uk_acre":  {unitArea, 4046.8564224, 0, false, 1},
+	"us_acre":  {unitArea, 4046.872609874252, 0, false, 1},
+	"ang2":     {unitArea, angstrom * angstrom, 0, true, 2},
+	"ang^2":    {unitArea, angstrom * angstrom, 0, true, 2},
+	"ar":       {unitArea, 100, 0, true, 1},
+	"ft2":      {unitArea, foot * foot, 0, false, 2},
+	"ft^2":     {unitArea, foot * foot, 0, false, 2},
+	"ha":       {unitArea, 10000, 0, false, 1},
+	"in2":      {unitArea, inch * inch, 0, false, 2},
+	"in^2":     {unitArea, inch * inch, 0, false, 2},
+	"ly2":      {unitArea, lyear * lyear, 0, false, 2},
+	"ly^2":     {unitArea, lyear * lyear, 0, false, 2},
+	"m2":       {unitArea, 1, 0, true, 2},
+	"m^2":      {unitArea, 1, 0, true, 2},
+	"Morgen":   {unitArea, 2500, 0, false, 1},
+	"mi2":      {unitArea, mile * mile, 0, false, 2},
+	"mi^2":     {unitArea, mile * mile, 0, false, 2},
+	"Nmi2":     {unitArea, nmile * nmile, 0, false, 2},
+	"Nmi^2":    {unitArea, nmile * nmile, 0, false, 2},
+	"Picapt2":  {unitArea, pica * pica, 0, false, 2},
+	"Picapt^2": {unitArea, pica * pica, 0, false, 2},
+	"Pica2":    {unitArea, pica * pica, 0, false, 2},
+	"Pica^2":   {unitArea, pica * pica, 0, false, 2},
+	"yd2":      {unitArea, yard * yard, 0, false, 2},
+	"yd^2":     {unitArea, yard * yard, 0, false, 2},
+
+	// information, in bits
+	"bit":  {unitInformation, 1, 0, true, 1},
+	"byte": {unitInformation, 8, 0, true, 1},
+
+	// speed, in meters per second
+	"admkn": {unitSpeed, 6080 * foot / 3600, 0, false, 1},
+	"kn":    {unitSpeed, nmile / 3600.0, 0, false, 1},
+	"m/h":   {unitSpeed, 1 / 3600.0, 0, true, 1},
+	"m/hr":  {unitSpeed, 1 / 3600.0, 0, true, 1},
+	"m/s":   {unitSpeed, 1, 0, true, 1},
+	"m/sec": {unitSpeed, 1, 0, true, 1},
+	"mph":   {unitSpeed, mile / 3600, 0, false, 1},
+}
+
+// unitPrefixes are the metric prefixes that can be used with units.
+var unitPrefixes = map[string]float64{
+	"Y": 1e24, "Z": 1e21, "E": 1e18, "P": 1e15, "T": 1e12, "G": 1e9,
+	"M": 1e6, "k": 1e3, "h": 1e2, "da": 1e1, "d": 1e-1, "c": 1e-2,
+	"m": 1e-3, "u": 1e-6, "n": 1e-9, "p": 1e-12, "f": 1e-15, "a": 1e-18,
+	"z": 1e-21, "y": 1e-24,
+}
+
+// binaryPrefixes are the prefixes that can be used with units of information.
+var binaryPrefixes = map[string]float64{
+	"ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30, "Ti": 1 << 40,
+	"Pi": 1 << 50, "Ei": 1 << 60, "Zi": 1 << 70, "Yi": 1 << 80,
+}
+
+// lookupUnit returns a unit for CONVERT, which may have a prefix.
+func lookupUnit(s string) (unit, bool) {
+	if u, ok := units[s]; ok {
+		return u, true
+	}
+	for _, l := range []int{2, 1} {
+		if len(s) <= l {
+			continue
+		}
+		u, ok := units[s[l:]]
+		if !ok || !u.prefixed {
+			continue
+		}
+		p, ok := unitPrefixes[s[:l]]
+		if !ok && u.category == unitInformation {
+			p, ok = binaryPrefixes[s[:l]]
+		}
+		if !ok {
+			continue
+		}
+		p = math.Pow(p, float64(u.power))
+		u.factor *= p
+		u.offset /= p
+		return u, true
+	}
+	return unit{}, false
+}
+
+// Convert is an implementation of the Excel CONVERT() function that converts a
+// number from one unit of measurement to another.
+func Convert(args []Result) Result {
+	if len(args) != 3 {
+		return MakeErrorResult("CONVERT requires three arguments")
+	}
+	v, errResult := numberArg(args[0], "CONVERT")
+	if errResult.Type == ResultTypeError {
+		return errResult
+	}
+	for _, a := range args[1:] {
+		if a.Type == ResultTypeError {
+			return a
+		}
+	}
+	from, ok := lookupUnit(args[1].Value())
+	if !ok {
+		return MakeErrorResultType(ErrorTypeNA, "CONVERT has an unknown unit "+args[1].Value())
+	}
+	to, ok := lookupUnit(args[2].Value())
+	if !ok {
+		return MakeErrorResultType(ErrorTypeNA, "CONVERT has an unknown unit "+args[2].Value())
+	}
+	if from.category != to.category {
+		return MakeErrorResultType(ErrorTypeNA, "CONVERT requires units of the same quantity")
+	}
+	base := (v + from.offset) * from.factor
+	// round to the fifteen significant digits that Excel uses
+	ret, _ := strconv.ParseFloat(strconv.FormatFloat(base/to.factor-to.offset, 'g', 15, 64), 64)
+	return MakeNumberResult(ret)
+}
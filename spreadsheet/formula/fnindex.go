@@ -8,6 +8,7 @@
 package formula
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 
@@ -15,11 +16,23 @@ import (
 )
 
 func init() {
+	RegisterFunction("ADDRESS", Address)
+	RegisterFunctionComplex("AREAS", Areas)
+	RegisterFunction("CHOOSE", Choose)
+	RegisterFunctionComplex("COLUMN", Column)
+	RegisterFunctionComplex("COLUMNS", Columns)
+	RegisterFunctionComplex("_xlfn.FORMULATEXT", FormulaText) // Only in Excel 2013+
+	RegisterFunction("HYPERLINK", Hyperlink)
 	RegisterFunction("INDEX", Index)
 	RegisterFunctionComplex("INDIRECT", Indirect)
+	RegisterFunctionInfo("INDIRECT", FunctionInfo{MinArgs: 1, MaxArgs: 2, Volatile: true})
+	RegisterFunction("MATCH", Match)
 	RegisterFunctionComplex("OFFSET", Offset)
+	RegisterFunctionInfo("OFFSET", FunctionInfo{MinArgs: 3, MaxArgs: 5, Volatile: true})
 	RegisterFunction("HLOOKUP", HLookup)
 	RegisterFunction("LOOKUP", Lookup)
+	RegisterFunctionComplex("ROW", Row)
+	RegisterFunctionComplex("ROWS", Rows)
 	RegisterFunction("VLOOKUP", VLookup)
 	RegisterFunction("TRANSPOSE", Transpose)
 }
@@ -91,6 +104,11 @@ func Offset(ctx Context, ev Evaluator, args []Result) Result {
 		ref = ctx.NamedRange(ref.Value)
 	}
 
+	// the reference may be on another sheet
+	if sheet, rest, ok := reference.SplitSheetPrefix(ref.Value); ok {
+		ctx, ref.Value = ctx.Sheet(sheet), rest
+	}
+
 	origin := ""
 	switch ref.Type {
 	case ReferenceTypeCell:
@@ -211,6 +229,13 @@ const (
 )
 
 func compareResults(lhs, rhs Result, caseSensitive bool) cmpResult {
+	// booleans only compare to booleans, not to the numbers 1 and 0
+	if lhs.Type == ResultTypeBool || rhs.Type == ResultTypeBool {
+		if lhs.Type != rhs.Type {
+			return cmpResultInvalid
+		}
+		return cmpResult(compareValues(lhs, rhs))
+	}
 	lhs = lhs.AsNumber()
 	rhs = rhs.AsNumber()
 	// differing types
@@ -437,3 +462,355 @@ func Transpose(args []Result) Result {
 	}
 	return MakeArrayResult(res)
 }
+
+// refRange is a reference argument resolved to the range of cells it refers
+// to.
+type refRange struct {
+	// ctx is the context of the sheet containing the range
+	ctx Context
+	// sheet is the name of the sheet if the reference had a sheet prefix
+	sheet    string
+	from, to reference.CellReference
+}
+
+// resolveRange resolves a reference to a cell or range, following named
+// ranges.  The boolean is false if it doesn't refer to cells.
+func resolveRange(ctx Context, ref Reference) (refRange, bool) {
+	for ref.Type == ReferenceTypeNamedRange {
+		ref = ctx.NamedRange(ref.Value)
+	}
+	if ref.Type != ReferenceTypeCell && ref.Type != ReferenceTypeRange {
+		return refRange{}, false
+	}
+	rng := refRange{ctx: ctx}
+	v := ref.Value
+	if sheet, rest, ok := reference.SplitSheetPrefix(v); ok {
+		rng.ctx, rng.sheet, v = ctx.Sheet(sheet), sheet, rest
+	}
+	sp := strings.Split(v, ":")
+	if len(sp) > 2 {
+		return refRange{}, false
+	}
+	var err error
+	if rng.from, err = reference.ParseCellReference(sp[0]); err != nil {
+		return refRange{}, false
+	}
+	rng.to = rng.from
+	if len(sp) == 2 {
+		if rng.to, err = reference.ParseCellReference(sp[1]); err != nil {
+			return refRange{}, false
+		}
+	}
+	return rng, true
+}
+
+// positionArg returns the range referred to by the optional argument of ROW
+// and COLUMN, or the cell containing the formula if it's omitted.
+func positionArg(ctx Context, args []Result, fn string) (refRange, Result) {
+	if len(args) > 1 {
+		return refRange{}, MakeErrorResult(fn + " requires zero or one arguments")
+	}
+	ref := Reference{Type: ReferenceTypeCell, Value: ctx.CurrentCell()}
+	if len(args) == 1 {
+		ref = args[0].Ref
+	}
+	rng, ok := resolveRange(ctx, ref)
+	if !ok {
+		return refRange{}, MakeErrorResult(fn + " requires a reference argument")
+	}
+	return rng, MakeEmptyResult()
+}
+
+// Row is an implementation of the Excel ROW() function that returns the row
+// number of a reference, or of the cell containing the formula.  A range
+// returns a column of its row numbers.
+func Row(ctx Context, ev Evaluator, args []Result) Result {
+	rng, err := positionArg(ctx, args, "ROW")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if rng.from.RowIdx == rng.to.RowIdx {
+		return MakeNumberResult(float64(rng.from.RowIdx))
+	}
+	ret := [][]Result{}
+	for r := rng.from.RowIdx; r <= rng.to.RowIdx; r++ {
+		ret = append(ret, []Result{MakeNumberResult(float64(r))})
+	}
+	return MakeArrayResult(ret)
+}
+
+// Column is an implementation of the Excel COLUMN() function that returns the
+// column number of a reference, or of the cell containing the formula.  A
+// range returns a row of its column numbers.
+func Column(ctx Context, ev Evaluator, args []Result) Result {
+	rng, err := positionArg(ctx, args, "COLUMN")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if rng.from.ColumnIdx == rng.to.ColumnIdx {
+		return MakeNumberResult(float64(rng.from.ColumnIdx + 1))
+	}
+	ret := []Result{}
+	for c := rng.from.ColumnIdx; c <= rng.to.ColumnIdx; c++ {
+		ret = append(ret, MakeNumberResult(float64(c+1)))
+	}
+	return MakeArrayResult([][]Result{ret})
+}
+
+// Rows is an implementation of the Excel ROWS() function that returns the
+// number of rows in a reference or array.
+func Rows(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("ROWS requires one argument")
+	}
+	if rng, ok := resolveRange(ctx, args[0].Ref); ok {
+		return MakeNumberResult(float64(rng.to.RowIdx - rng.from.RowIdx + 1))
+	}
+	if args[0].Type == ResultTypeError {
+		return args[0]
+	}
+	rows, _ := dims(args[0])
+	return MakeNumberResult(float64(rows))
+}
+
+// Columns is an implementation of the Excel COLUMNS() function that returns
+// the number of columns in a reference or array.
+func Columns(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("COLUMNS requires one argument")
+	}
+	if rng, ok := resolveRange(ctx, args[0].Ref); ok {
+		return MakeNumberResult(float64(rng.to.ColumnIdx - rng.from.ColumnIdx + 1))
+	}
+	if args[0].Type == ResultTypeError {
+		return args[0]
+	}
+	_, cols := dims(args[0])
+	return MakeNumberResult(float64(cols))
+}
+
+// Areas is an implementation of the Excel AREAS() function that returns the
+// number of areas in a reference.  Only named ranges can refer to more than
+// one area (e.g. Sheet1!$A$1:$B$2,Sheet1!$D$4).
+func Areas(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("AREAS requires one argument")
+	}
+	ref := args[0].Ref
+	for ref.Type == ReferenceTypeNamedRange {
+		ref = ctx.NamedRange(ref.Value)
+	}
+	n := 0
+	for _, area := range splitAreas(ref.Value) {
+		if _, ok := resolveRange(ctx, MakeRangeReference(area)); !ok {
+			return MakeErrorResult("AREAS requires a reference argument")
+		}
+		n++
+	}
+	if n == 0 {
+		return MakeErrorResult("AREAS requires a reference argument")
+	}
+	return MakeNumberResult(float64(n))
+}
+
+// splitAreas splits a reference to several areas at the commas that aren't
+// part of a quoted sheet name.
+func splitAreas(s string) []string {
+	if s == "" {
+		return nil
+	}
+	ret := []string{}
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				ret = append(ret, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(ret, s[start:])
+}
+
+// Address is an implementation of the Excel ADDRESS() function that returns a
+// cell reference as text from its row and column numbers.
+func Address(args []Result) Result {
+	if len(args) < 2 || len(args) > 5 {
+		return MakeErrorResult("ADDRESS requires two to five arguments")
+	}
+	row, err := optionalNumber(args, 0, 0, "ADDRESS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	col, err := optionalNumber(args, 1, 0, "ADDRESS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	absNum, err := optionalNumber(args, 2, 1, "ADDRESS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	a1, err := optionalNumber(args, 3, 1, "ADDRESS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	r, c := int(row), int(col)
+	if r < 1 || c < 1 {
+		return MakeErrorResult("ADDRESS requires positive row and column numbers")
+	}
+	absRow, absCol := false, false
+	switch int(absNum) {
+	case 1:
+		absRow, absCol = true, true
+	case 2:
+		absRow = true
+	case 3:
+		absCol = true
+	case 4:
+	default:
+		return MakeErrorResult("ADDRESS requires an absolute number of 1, 2, 3 or 4")
+	}
+
+	buf := bytes.Buffer{}
+	if len(args) == 5 && args[4].Type != ResultTypeEmpty {
+		sheet := args[4].AsString()
+		if sheet.Type != ResultTypeString {
+			return MakeErrorResult("ADDRESS requires a text sheet name")
+		}
+		buf.WriteString(reference.QuoteSheetName(sheet.ValueString))
+		buf.WriteByte('!')
+	}
+	if a1 != 0 {
+		if absCol {
+			buf.WriteByte('$')
+		}
+		buf.WriteString(reference.IndexToColumn(uint32(c - 1)))
+		if absRow {
+			buf.WriteByte('$')
+		}
+		fmt.Fprintf(&buf, "%d", r)
+	} else {
+		// relative R1C1 references are relative to the cell containing the
+		// formula
+		if absRow {
+			fmt.Fprintf(&buf, "R%d", r)
+		} else {
+			fmt.Fprintf(&buf, "R[%d]", r)
+		}
+		if absCol {
+			fmt.Fprintf(&buf, "C%d", c)
+		} else {
+			fmt.Fprintf(&buf, "C[%d]", c)
+		}
+	}
+	return MakeStringResult(buf.String())
+}
+
+// Choose is an implementation of the Excel CHOOSE() function that returns one
+// of its arguments by index.
+func Choose(args []Result) Result {
+	if len(args) < 2 {
+		return MakeErrorResult("CHOOSE requires at least two arguments")
+	}
+	idx := args[0].AsNumber()
+	switch idx.Type {
+	case ResultTypeError:
+		return idx
+	case ResultTypeNumber:
+	default:
+		return MakeErrorResult("CHOOSE requires a numeric index")
+	}
+	i := int(idx.ValueNumber)
+	if i < 1 || i >= len(args) {
+		return MakeErrorResult("CHOOSE index out of range")
+	}
+	return args[i]
+}
+
+// Match is an implementation of the Excel MATCH() function that returns the
+// position of a value in a row or column.  A match type of 1 (the default)
+// finds the largest value less than or equal to the lookup value in values
+// sorted in ascending order, -1 finds the smallest value greater than or equal
+// to it in values sorted in descending order, and 0 finds the first exact
+// match, supporting wildcards for text.
+func Match(args []Result) Result {
+	if len(args) != 2 && len(args) != 3 {
+		return MakeErrorResult("MATCH requires two or three arguments")
+	}
+	values, _, ok := lookupVector(args[1])
+	if !ok {
+		return MakeErrorResultType(ErrorTypeNA, "MATCH lookup array must be a single row or column")
+	}
+	mt, err := optionalNumber(args, 2, 1, "MATCH")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	v := args[0]
+	if v.Type == ResultTypeError {
+		return v
+	}
+
+	idx := -1
+	switch {
+	case mt == 0:
+		idx = xlookupIndex(v, values, 2, 1)
+	case mt > 0:
+		for i, c := range values {
+			cmp := compareResults(c, v, false)
+			if cmp == cmpResultGreater {
+				break
+			}
+			if cmp != cmpResultInvalid {
+				idx = i
+			}
+		}
+	default:
+		for i, c := range values {
+			cmp := compareResults(c, v, false)
+			if cmp == cmpResultLess {
+				break
+			}
+			if cmp != cmpResultInvalid {
+				idx = i
+			}
+		}
+	}
+	if idx == -1 {
+		return MakeErrorResultType(ErrorTypeNA, "MATCH no result found")
+	}
+	return MakeNumberResult(float64(idx + 1))
+}
+
+// Hyperlink is an implementation of the Excel HYPERLINK() function.  Outside
+// of Excel it just returns the friendly name, or the link location if there
+// isn't one.
+func Hyperlink(args []Result) Result {
+	if len(args) != 1 && len(args) != 2 {
+		return MakeErrorResult("HYPERLINK requires one or two arguments")
+	}
+	if len(args) == 2 && args[1].Type != ResultTypeEmpty {
+		return args[1]
+	}
+	return args[0]
+}
+
+// FormulaText is an implementation of the Excel FORMULATEXT() function that
+// returns the formula in a cell as text.
+func FormulaText(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("FORMULATEXT requires one argument")
+	}
+	rng, ok := resolveRange(ctx, args[0].Ref)
+	if !ok {
+		return MakeErrorResult("FORMULATEXT requires a reference argument")
+	}
+	f := rng.ctx.Formula(rng.from.String())
+	if f == "" {
+		return MakeErrorResultType(ErrorTypeNA, "FORMULATEXT requires a cell containing a formula")
+	}
+	return MakeStringResult("=" + f)
+}
@@ -7,8 +7,34 @@
 
 package formula
 
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
 func init() {
+	RegisterFunctionComplex("CELL", Cell)
+	RegisterFunctionInfo("CELL", FunctionInfo{MinArgs: 1, MaxArgs: 2, Volatile: true})
+	RegisterFunction("ERROR.TYPE", ErrorDotType)
+	RegisterFunction("INFO", Info)
+	RegisterFunctionInfo("INFO", FunctionInfo{MinArgs: 1, MaxArgs: 1, Volatile: true})
+	RegisterFunction("ISBLANK", IsBlank)
+	RegisterFunction("ISERR", IsErr)
+	RegisterFunction("ISERROR", IsError)
+	RegisterFunction("ISEVEN", IsEven)
+	RegisterFunctionComplex("_xlfn.ISFORMULA", IsFormula) // Only in Excel 2013+
+	RegisterFunction("ISLOGICAL", IsLogical)
+	RegisterFunction("ISNA", IsNA)
+	RegisterFunction("ISNUMBER", IsNumber)
+	RegisterFunction("ISODD", IsOdd)
+	RegisterFunctionComplex("ISREF", IsRef)
+	RegisterFunction("ISTEXT", IsText)
+	RegisterFunction("N", N)
 	RegisterFunction("NA", NA)
+	RegisterFunction("TYPE", Type)
 }
 
 // NA is an implementation of the Excel NA() function that just returns the #N/A! error.
@@ -18,3 +44,271 @@ func NA(args []Result) Result {
 	}
 	return MakeErrorResultType(ErrorTypeNA, "")
 }
+
+// isType implements the IS functions that check the type of their single
+// argument.
+func isType(args []Result, fn string, check func(r Result) bool) Result {
+	if len(args) != 1 {
+		return MakeErrorResult(fn + " requires one argument")
+	}
+	return MakeBoolResult(check(args[0]))
+}
+
+// IsBlank is an implementation of the Excel ISBLANK() function that returns
+// true if its argument refers to an empty cell.
+func IsBlank(args []Result) Result {
+	return isType(args, "ISBLANK", func(r Result) bool {
+		return r.Type == ResultTypeEmpty
+	})
+}
+
+// IsErr is an implementation of the Excel ISERR() function that returns true if
+// its argument is an error other than #N/A.
+func IsErr(args []Result) Result {
+	return isType(args, "ISERR", func(r Result) bool {
+		return r.Type == ResultTypeError && r.ErrorType != ErrorTypeNA
+	})
+}
+
+// IsError is an implementation of the Excel ISERROR() function that returns
+// true if its argument is an error.
+func IsError(args []Result) Result {
+	return isType(args, "ISERROR", func(r Result) bool {
+		return r.Type == ResultTypeError
+	})
+}
+
+// IsLogical is an implementation of the Excel ISLOGICAL() function that returns
+// true if its argument is a boolean.
+func IsLogical(args []Result) Result {
+	return isType(args, "ISLOGICAL", func(r Result) bool {
+		return r.Type == ResultTypeBool
+	})
+}
+
+// IsNA is an implementation of the Excel ISNA() function that returns true if
+// its argument is the #N/A error.
+func IsNA(args []Result) Result {
+	return isType(args, "ISNA", func(r Result) bool {
+		return r.Type == ResultTypeError && r.ErrorType == ErrorTypeNA
+	})
+}
+
+// IsNumber is an implementation of the Excel ISNUMBER() function that returns
+// true if its argument is a number.
+func IsNumber(args []Result) Result {
+	return isType(args, "ISNUMBER", func(r Result) bool {
+		return r.Type == ResultTypeNumber
+	})
+}
+
+// IsText is an implementation of the Excel ISTEXT() function that returns true
+// if its argument is text.
+func IsText(args []Result) Result {
+	return isType(args, "ISTEXT", func(r Result) bool {
+		return r.Type == ResultTypeString
+	})
+}
+
+// parity implements ISEVEN and ISODD, returning whether the integer part of
+// the argument is even.
+func parity(args []Result, fn string) (bool, Result) {
+	if len(args) != 1 {
+		return false, MakeErrorResult(fn + " requires one argument")
+	}
+	n := args[0].AsNumber()
+	switch n.Type {
+	case ResultTypeNumber:
+		return math.Mod(math.Trunc(n.ValueNumber), 2) == 0, MakeEmptyResult()
+	case ResultTypeError:
+		return false, n
+	}
+	return false, MakeErrorResult(fn + " requires a numeric argument")
+}
+
+// IsEven is an implementation of the Excel ISEVEN() function.
+func IsEven(args []Result) Result {
+	even, err := parity(args, "ISEVEN")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	return MakeBoolResult(even)
+}
+
+// IsOdd is an implementation of the Excel ISODD() function.
+func IsOdd(args []Result) Result {
+	even, err := parity(args, "ISODD")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	return MakeBoolResult(!even)
+}
+
+// IsRef is an implementation of the Excel ISREF() function that returns true
+// if its argument is a reference to a cell or range.
+func IsRef(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("ISREF requires one argument")
+	}
+	_, ok := resolveRange(ctx, args[0].Ref)
+	return MakeBoolResult(ok)
+}
+
+// IsFormula is an implementation of the Excel ISFORMULA() function that
+// returns true if its argument refers to a cell containing a formula.
+func IsFormula(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("ISFORMULA requires one argument")
+	}
+	rng, ok := resolveRange(ctx, args[0].Ref)
+	if !ok {
+		return MakeErrorResult("ISFORMULA requires a reference argument")
+	}
+	return MakeBoolResult(rng.ctx.Formula(rng.from.String()) != "")
+}
+
+// N is an implementation of the Excel N() function that converts its argument
+// to a number.  Text is converted to zero.
+func N(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("N requires one argument")
+	}
+	switch r := args[0]; r.Type {
+	case ResultTypeNumber, ResultTypeError:
+		return r
+	case ResultTypeBool:
+		return r.AsNumber()
+	case ResultTypeList, ResultTypeArray:
+		return N(flatten(r)[:1])
+	}
+	return MakeNumberResult(0)
+}
+
+// Type is an implementation of the Excel TYPE() function that returns a number
+// indicating the type of its argument.
+func Type(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("TYPE requires one argument")
+	}
+	switch args[0].Type {
+	case ResultTypeNumber, ResultTypeEmpty:
+		return MakeNumberResult(1)
+	case ResultTypeString:
+		return MakeNumberResult(2)
+	case ResultTypeBool:
+		return MakeNumberResult(4)
+	case ResultTypeError:
+		return MakeNumberResult(16)
+	case ResultTypeList, ResultTypeArray:
+		return MakeNumberResult(64)
+	case ResultTypeLambda:
+		return MakeNumberResult(128)
+	}
+	return MakeErrorResult("TYPE has an unsupported argument type")
+}
+
+// errorTypes are the numbers that ERROR.TYPE returns for each error.
+var errorTypes = map[ErrorType]float64{
+	ErrorTypeNull:         1,
+	ErrorTypeDivideByZero: 2,
+	ErrorTypeValue:        3,
+	ErrorTypeRef:          4,
+	ErrorTypeName:         5,
+	ErrorTypeNum:          6,
+	ErrorTypeNA:           7,
+	ErrorTypeSpill:        9,
+	ErrorTypeCalc:         14,
+}
+
+// ErrorDotType is an implementation of the Excel ERROR.TYPE() function that
+// returns a number indicating the type of an error.
+func ErrorDotType(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("ERROR.TYPE requires one argument")
+	}
+	if args[0].Type == ResultTypeError {
+		if n, ok := errorTypes[args[0].ErrorType]; ok {
+			return MakeNumberResult(n)
+		}
+	}
+	return MakeErrorResultType(ErrorTypeNA, "")
+}
+
+// Cell is an implementation of the Excel CELL() function that returns
+// information about a cell.  The address, col, contents, row and type info
+// types are supported.  If the reference is omitted, the cell containing the
+// formula is used.
+func Cell(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 1 && len(args) != 2 {
+		return MakeErrorResult("CELL requires one or two arguments")
+	}
+	info := args[0].AsString()
+	if info.Type != ResultTypeString {
+		return MakeErrorResult("CELL requires the info type to be text")
+	}
+
+	ref := Reference{Type: ReferenceTypeCell, Value: ctx.CurrentCell()}
+	if len(args) == 2 {
+		ref = args[1].Ref
+	}
+	rng, ok := resolveRange(ctx, ref)
+	if !ok {
+		return MakeErrorResult("CELL requires a reference argument")
+	}
+	from := rng.from
+	cell := fmt.Sprintf("%s%d", from.Column, from.RowIdx)
+
+	switch strings.ToLower(info.ValueString) {
+	case "address":
+		prefix := ""
+		if rng.sheet != "" {
+			prefix = reference.QuoteSheetName(rng.sheet) + "!"
+		}
+		return MakeStringResult(fmt.Sprintf("%s$%s$%d", prefix, from.Column, from.RowIdx))
+	case "col":
+		return MakeNumberResult(float64(from.ColumnIdx + 1))
+	case "row":
+		return MakeNumberResult(float64(from.RowIdx))
+	case "contents":
+		v := rng.ctx.Cell(cell, ev)
+		if v.Type == ResultTypeEmpty {
+			return MakeNumberResult(0)
+		}
+		return v
+	case "type":
+		switch rng.ctx.Cell(cell, ev).Type {
+		case ResultTypeEmpty:
+			return MakeStringResult("b")
+		case ResultTypeString:
+			return MakeStringResult("l")
+		}
+		return MakeStringResult("v")
+	}
+	return MakeErrorResult("CELL doesn't support the info type " + info.ValueString)
+}
+
+// Info is an implementation of the Excel INFO() function that returns
+// information about the environment.  Information that isn't available outside
+// of Excel, such as the current directory, is returned as #N/A.
+func Info(args []Result) Result {
+	if len(args) != 1 {
+		return MakeErrorResult("INFO requires one argument")
+	}
+	info := args[0].AsString()
+	if info.Type != ResultTypeString {
+		return MakeErrorResult("INFO requires the info type to be text")
+	}
+	switch strings.ToLower(info.ValueString) {
+	case "origin":
+		return MakeStringResult("$A:$A$1")
+	case "recalc":
+		return MakeStringResult("Automatic")
+	case "release":
+		return MakeStringResult("16.0")
+	case "system":
+		return MakeStringResult("pcdos")
+	case "directory", "numfile", "osversion":
+		return MakeErrorResultType(ErrorTypeNA, "INFO "+info.ValueString+" isn't available")
+	}
+	return MakeErrorResult("INFO doesn't support the info type " + info.ValueString)
+}
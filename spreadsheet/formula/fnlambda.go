@@ -0,0 +1,214 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import "fmt"
+
+// The LAMBDA helper functions call a LAMBDA function for the values of an
+// array.
+func init() {
+	RegisterFunctionComplex("_xlfn.BYCOL", ByCol)
+	RegisterFunctionComplex("_xlfn.BYROW", ByRow)
+	RegisterFunctionComplex("_xlfn.MAKEARRAY", MakeArray)
+	RegisterFunctionComplex("_xlfn.MAP", Map)
+	RegisterFunctionComplex("_xlfn.REDUCE", Reduce)
+	RegisterFunctionComplex("_xlfn.SCAN", Scan)
+}
+
+// lambdaArg returns the LAMBDA function passed as the last argument of a
+// function, checking the number of parameters it accepts.
+func lambdaArg(args []Result, params int, fn string) (*Lambda, Result) {
+	if len(args) == 0 {
+		return nil, MakeErrorResult(fn + " requires a LAMBDA argument")
+	}
+	l := args[len(args)-1]
+	if l.Type == ResultTypeError {
+		return nil, l
+	}
+	if l.Type != ResultTypeLambda {
+		return nil, MakeErrorResult(fn + " requires a LAMBDA as its last argument")
+	}
+	if l.ValueLambda.Params() != params {
+		return nil, MakeErrorResult(fmt.Sprintf("%s requires a LAMBDA with %d parameters", fn, params))
+	}
+	return l.ValueLambda, MakeEmptyResult()
+}
+
+// lambdaValue returns the result of a call to a LAMBDA function that must be a
+// single value.
+func lambdaValue(r Result) Result {
+	switch r.Type {
+	case ResultTypeArray, ResultTypeList:
+		if rows, cols := dims(r); rows == 1 && cols == 1 {
+			return flatten(r)[0]
+		}
+		return MakeErrorResultType(ErrorTypeCalc, "nested arrays aren't supported")
+	case ResultTypeLambda:
+		return MakeErrorResultType(ErrorTypeCalc, "LAMBDA result must be a value")
+	case ResultTypeEmpty:
+		return MakeNumberResult(0)
+	}
+	return r
+}
+
+// Map is an implementation of the Excel MAP() function that returns an array
+// of the results of a LAMBDA function called with the values from each array.
+func Map(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) < 2 {
+		return MakeErrorResult("MAP requires at least two arguments")
+	}
+	arrays := args[:len(args)-1]
+	l, errResult := lambdaArg(args, len(arrays), "MAP")
+	if l == nil {
+		return errResult
+	}
+	arr := asArray(arrays[0])
+	rows, cols := len(arr), len(arr[0])
+	values := make([][][]Result, len(arrays))
+	for i, a := range arrays {
+		values[i] = asArray(a)
+		if len(values[i]) != rows || len(values[i][0]) != cols {
+			return MakeErrorResult("MAP requires arrays of the same size")
+		}
+	}
+	ret := make([][]Result, rows)
+	for r := range ret {
+		ret[r] = make([]Result, cols)
+		for c := range ret[r] {
+			vals := make([]Result, len(values))
+			for i := range values {
+				vals[i] = values[i][r][c]
+			}
+			ret[r][c] = lambdaValue(l.Call(ctx, ev, vals))
+		}
+	}
+	return MakeArrayResult(ret)
+}
+
+// accumulate calls the LAMBDA function of REDUCE or SCAN for each value of an
+// array, returning the accumulated values.
+func accumulate(ctx Context, ev Evaluator, args []Result, fn string) ([][]Result, Result) {
+	if len(args) != 3 {
+		return nil, MakeErrorResult(fn + " requires three arguments")
+	}
+	l, errResult := lambdaArg(args, 2, fn)
+	if l == nil {
+		return nil, errResult
+	}
+	// the initial value can be omitted
+	acc := MakeNumberResult(0)
+	if args[0].Type != ResultTypeEmpty {
+		acc = args[0]
+	}
+	arr := asArray(args[1])
+	ret := make([][]Result, len(arr))
+	for r, row := range arr {
+		ret[r] = make([]Result, len(row))
+		for c, v := range row {
+			acc = l.Call(ctx, ev, []Result{acc, v})
+			if acc.Type == ResultTypeLambda {
+				return nil, MakeErrorResultType(ErrorTypeCalc, fn+" LAMBDA result must be a value")
+			}
+			ret[r][c] = acc
+		}
+	}
+	return ret, acc
+}
+
+// Reduce is an implementation of the Excel REDUCE() function that reduces an
+// array to a single value by calling a LAMBDA function with the value so far
+// and each value of the array.
+func Reduce(ctx Context, ev Evaluator, args []Result) Result {
+	_, acc := accumulate(ctx, ev, args, "REDUCE")
+	return acc
+}
+
+// Scan is an implementation of the Excel SCAN() function that returns an array
+// of the intermediate values of REDUCE.
+func Scan(ctx Context, ev Evaluator, args []Result) Result {
+	ret, errResult := accumulate(ctx, ev, args, "SCAN")
+	if ret == nil {
+		return errResult
+	}
+	for _, row := range ret {
+		for c, v := range row {
+			row[c] = lambdaValue(v)
+		}
+	}
+	return MakeArrayResult(ret)
+}
+
+// ByRow is an implementation of the Excel BYROW() function that returns a
+// column of the results of a LAMBDA function called with each row of an array.
+func ByRow(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 {
+		return MakeErrorResult("BYROW requires two arguments")
+	}
+	l, errResult := lambdaArg(args, 1, "BYROW")
+	if l == nil {
+		return errResult
+	}
+	ret := [][]Result{}
+	for _, row := range asArray(args[0]) {
+		ret = append(ret, []Result{lambdaValue(l.Call(ctx, ev, []Result{MakeArrayResult([][]Result{row})}))})
+	}
+	return MakeArrayResult(ret)
+}
+
+// ByCol is an implementation of the Excel BYCOL() function that returns a row
+// of the results of a LAMBDA function called with each column of an array.
+func ByCol(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 2 {
+		return MakeErrorResult("BYCOL requires two arguments")
+	}
+	l, errResult := lambdaArg(args, 1, "BYCOL")
+	if l == nil {
+		return errResult
+	}
+	ret := []Result{}
+	for _, col := range transposeArray(asArray(args[0])) {
+		colArr := make([][]Result, len(col))
+		for i, v := range col {
+			colArr[i] = []Result{v}
+		}
+		ret = append(ret, lambdaValue(l.Call(ctx, ev, []Result{MakeArrayResult(colArr)})))
+	}
+	return MakeArrayResult([][]Result{ret})
+}
+
+// MakeArray is an implementation of the Excel MAKEARRAY() function that
+// returns an array of the results of a LAMBDA function called with the row and
+// column number of each value.
+func MakeArray(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != 3 {
+		return MakeErrorResult("MAKEARRAY requires three arguments")
+	}
+	rows, errResult := optionalNumber(args, 0, 0, "MAKEARRAY")
+	if errResult.Type != ResultTypeEmpty {
+		return errResult
+	}
+	cols, errResult := optionalNumber(args, 1, 0, "MAKEARRAY")
+	if errResult.Type != ResultTypeEmpty {
+		return errResult
+	}
+	if rows < 1 || cols < 1 {
+		return MakeErrorResult("MAKEARRAY requires a positive number of rows and columns")
+	}
+	l, errResult := lambdaArg(args, 2, "MAKEARRAY")
+	if l == nil {
+		return errResult
+	}
+	ret := make([][]Result, int(rows))
+	for r := range ret {
+		ret[r] = make([]Result, int(cols))
+		for c := range ret[r] {
+			ret[r][c] = lambdaValue(l.Call(ctx, ev, []Result{MakeNumberResult(float64(r + 1)), MakeNumberResult(float64(c + 1))}))
+		}
+	}
+	return MakeArrayResult(ret)
+}
@@ -74,7 +74,9 @@ func If(args []Result) Result {
 	}
 	cond := args[0]
 	switch cond.Type {
-	case ResultTypeNumber:
+	case ResultTypeNumber, ResultTypeBool:
+	case ResultTypeEmpty:
+		cond = MakeBoolResult(false)
 	case ResultTypeError:
 		return cond
 	default:
@@ -122,7 +124,7 @@ func IfNA(args []Result) Result {
 		return MakeErrorResult("IFNA requires two arguments")
 	}
 
-	if args[0].Type == ResultTypeError && args[0].ValueString == "#N/A" {
+	if args[0].Type == ResultTypeError && args[0].ErrorType == ErrorTypeNA {
 		return args[1]
 	}
 	return args[0]
@@ -139,7 +141,7 @@ func Not(args []Result) Result {
 		return args[0]
 	case ResultTypeString, ResultTypeList:
 		return MakeErrorResult("NOT expects a numeric argument")
-	case ResultTypeNumber:
+	case ResultTypeNumber, ResultTypeBool:
 		return MakeBoolResult(!(args[0].ValueNumber != 0))
 	default:
 		return MakeErrorResult("unhandled NOT argument type")
@@ -163,7 +165,7 @@ func Or(args []Result) Result {
 			if res.ValueNumber != 0 {
 				result = true
 			}
-		case ResultTypeNumber:
+		case ResultTypeNumber, ResultTypeBool:
 			if a.ValueNumber != 0 {
 				result = true
 			}
@@ -208,7 +210,7 @@ func Xor(args []Result) Result {
 				cnt++
 			}
 			hasNum = true
-		case ResultTypeNumber:
+		case ResultTypeNumber, ResultTypeBool:
 			if arg.ValueNumber != 0 {
 				cnt++
 			}
@@ -75,7 +75,9 @@ func init() {
 	RegisterFunction("QUOTIENT", Quotient)
 	RegisterFunction("RADIANS", Radians)
 	RegisterFunction("RAND", Rand)
+	RegisterFunctionInfo("RAND", FunctionInfo{MinArgs: 0, MaxArgs: 0, Volatile: true})
 	RegisterFunction("RANDBETWEEN", RandBetween)
+	RegisterFunctionInfo("RANDBETWEEN", FunctionInfo{MinArgs: 2, MaxArgs: 2, Volatile: true})
 	RegisterFunction("ROMAN", Roman)
 	RegisterFunction("ROUND", Round)
 	RegisterFunction("ROUNDDOWN", RoundDown)
@@ -88,11 +90,10 @@ func init() {
 	RegisterFunction("SINH", makeMathWrapper("SINH", math.Sinh))
 	RegisterFunction("SQRT", makeMathWrapper("SQRT", math.Sqrt))
 	RegisterFunction("SQRTPI", makeMathWrapper("SQRTPI", func(v float64) float64 { return math.Sqrt(v * math.Pi) }))
-	// RegisterFunction("SUBTOTAL"
+	RegisterFunction("SUBTOTAL", Subtotal)
 	RegisterFunction("SUM", Sum)
-	// RegisterFunction("SUMIF",
-	// RegisterFunction("SUMIFS",
-	// RegisterFunction("SUMIFS",
+	RegisterFunctionComplex("SUMIF", SumIf)
+	RegisterFunction("SUMIFS", SumIfs)
 	RegisterFunction("SUMPRODUCT", SumProduct)
 	RegisterFunction("SUMSQ", SumSquares)
 	//RegisterFunction("SUMX2MY2"
@@ -1126,14 +1127,21 @@ func Power(args []Result) Result {
 
 // Product is an implementation of the Excel PRODUCT() function.
 func Product(args []Result) Result {
+	return product(args, false)
+}
+
+func product(args []Result, nested bool) Result {
 	res := 1.0
 	for _, a := range args {
+		if ignoredBool(a, nested) {
+			continue
+		}
 		a = a.AsNumber()
 		switch a.Type {
 		case ResultTypeNumber:
 			res *= a.ValueNumber
 		case ResultTypeList, ResultTypeArray:
-			subSum := Product(a.ListValues())
+			subSum := product(a.ListValues(), true)
 			if subSum.Type != ResultTypeNumber {
 				return subSum
 			}
@@ -1486,17 +1494,62 @@ func Sign(args []Result) Result {
 	return MakeNumberResult(0)
 }
 
+// subtotalFunctions are the functions applied by SUBTOTAL for each function
+// number.
+var subtotalFunctions = map[int]Function{
+	1:  Average,
+	2:  Count,
+	3:  Counta,
+	4:  Max,
+	5:  Min,
+	6:  Product,
+	7:  makeVarianceFunction("STDEV", true, true),
+	8:  makeVarianceFunction("STDEVP", false, true),
+	9:  Sum,
+	10: makeVarianceFunction("VAR", true, false),
+	11: makeVarianceFunction("VARP", false, false),
+}
+
+// Subtotal is an implementation of the Excel SUBTOTAL() function.  Function
+// numbers 101-111 ignore hidden rows in Excel, but as rows aren't hidden during
+// evaluation they behave the same as 1-11.
+func Subtotal(args []Result) Result {
+	if len(args) < 2 {
+		return MakeErrorResult("SUBTOTAL requires at least two arguments")
+	}
+	fnArg := args[0].AsNumber()
+	if fnArg.Type != ResultTypeNumber {
+		return MakeErrorResult("SUBTOTAL requires a numeric function number")
+	}
+	fnNum := int(fnArg.ValueNumber)
+	if fnNum > 100 {
+		fnNum -= 100
+	}
+	fn, ok := subtotalFunctions[fnNum]
+	if !ok {
+		return MakeErrorResult(fmt.Sprintf("invalid SUBTOTAL function number %d", int(fnArg.ValueNumber)))
+	}
+	return fn(args[1:])
+}
+
 // Sum is an implementation of the Excel SUM() function.
 func Sum(args []Result) Result {
+	return sum(args, false)
+}
+
+func sum(args []Result, nested bool) Result {
 	// Sum returns zero with no arguments
 	res := MakeNumberResult(0)
 	for _, a := range args {
+		if ignoredBool(a, nested) {
+			continue
+		}
 		a = a.AsNumber()
 		switch a.Type {
 		case ResultTypeNumber:
 			res.ValueNumber += a.ValueNumber
 		case ResultTypeList, ResultTypeArray:
-			subSum := Sum(a.ListValues())
+			subSum := sum(a.ListValues(), true)
 			// error as sum returns only numbers and errors
 			if subSum.Type != ResultTypeNumber {
 				return subSum
@@ -1515,6 +1568,32 @@ func Sum(args []Result) Result {
 	return res
 }
 
+// SumIf is an implementation of the Excel SUMIF() function.
+func SumIf(ctx Context, ev Evaluator, args []Result) Result {
+	values, err := ifValues(ctx, ev, args, "SUMIF")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return MakeNumberResult(sum)
+}
+
+// SumIfs is an implementation of the Excel SUMIFS() function.
+func SumIfs(args []Result) Result {
+	values, err := ifsValues(args, "SUMIFS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return MakeNumberResult(sum)
+}
+
 // SumProduct is an implementation of the Excel SUMPRODUCT() function.
 func SumProduct(args []Result) Result {
 	if len(args) == 0 {
@@ -8,6 +8,7 @@
 package formula
 
 import (
+	"fmt"
 	"math"
 	"sort"
 
@@ -17,15 +18,77 @@ import (
 func init() {
 	RegisterFunction("AVERAGE", Average)
 	RegisterFunction("AVERAGEA", Averagea)
+	RegisterFunctionComplex("AVERAGEIF", AverageIf)
+	RegisterFunction("AVERAGEIFS", AverageIfs)
+	RegisterFunction("BINOMDIST", BinomDist)
+	RegisterFunction("_xlfn.BINOM.DIST", BinomDist)
+	RegisterFunction("CHIDIST", ChisqDistRt)
+	RegisterFunction("_xlfn.CHISQ.DIST", ChisqDist)
+	RegisterFunction("_xlfn.CHISQ.DIST.RT", ChisqDistRt)
+	RegisterFunction("CORREL", Correl)
 	RegisterFunction("COUNT", Count)
 	RegisterFunction("COUNTA", Counta)
 	RegisterFunction("COUNTBLANK", CountBlank)
+	RegisterFunction("COUNTIF", CountIf)
+	RegisterFunction("COUNTIFS", CountIfs)
+	RegisterFunction("FORECAST", Forecast)
+	RegisterFunction("_xlfn.FORECAST.LINEAR", Forecast)
+	RegisterFunction("INTERCEPT", Intercept)
+	RegisterFunction("LARGE", Large)
+	RegisterFunction("LINEST", Linest)
 	RegisterFunction("MAX", Max)
-	RegisterFunction("MIN", Min)
+	RegisterFunction("_xlfn.MAXIFS", MaxIfs)
 	RegisterFunction("MEDIAN", Median)
+	RegisterFunction("MIN", Min)
+	RegisterFunction("_xlfn.MINIFS", MinIfs)
+	RegisterFunction("MODE", Mode)
+	RegisterFunction("_xlfn.MODE.MULT", ModeMult)
+	RegisterFunction("_xlfn.MODE.SNGL", Mode)
+	RegisterFunction("NORMDIST", NormDist)
+	RegisterFunction("_xlfn.NORM.DIST", NormDist)
+	RegisterFunction("NORMINV", NormInv)
+	RegisterFunction("_xlfn.NORM.INV", NormInv)
+	RegisterFunction("NORMSDIST", NormSDist)
+	RegisterFunction("_xlfn.NORM.S.DIST", NormSDist)
+	RegisterFunction("NORMSINV", NormSInv)
+	RegisterFunction("_xlfn.NORM.S.INV", NormSInv)
+	RegisterFunction("PERCENTILE", PercentileInc)
+	RegisterFunction("_xlfn.PERCENTILE.EXC", PercentileExc)
+	RegisterFunction("_xlfn.PERCENTILE.INC", PercentileInc)
+	RegisterFunction("POISSON", PoissonDist)
+	RegisterFunction("_xlfn.POISSON.DIST", PoissonDist)
+	RegisterFunction("QUARTILE", QuartileInc)
+	RegisterFunction("_xlfn.QUARTILE.EXC", QuartileExc)
+	RegisterFunction("_xlfn.QUARTILE.INC", QuartileInc)
+	RegisterFunction("RANK", RankEq)
+	RegisterFunction("_xlfn.RANK.AVG", RankAvg)
+	RegisterFunction("_xlfn.RANK.EQ", RankEq)
+	RegisterFunction("SLOPE", Slope)
+	RegisterFunction("SMALL", Small)
+	RegisterFunction("STDEV", makeVarianceFunction("STDEV", true, true))
+	RegisterFunction("_xlfn.STDEV.P", makeVarianceFunction("STDEV.P", false, true))
+	RegisterFunction("_xlfn.STDEV.S", makeVarianceFunction("STDEV.S", true, true))
+	RegisterFunction("STDEVP", makeVarianceFunction("STDEVP", false, true))
+	RegisterFunction("TDIST", TDist2)
+	RegisterFunction("_xlfn.T.DIST", TDist)
+	RegisterFunction("_xlfn.T.DIST.2T", TDist2T)
+	RegisterFunction("_xlfn.T.DIST.RT", TDistRt)
+	RegisterFunction("TREND", Trend)
+	RegisterFunction("VAR", makeVarianceFunction("VAR", true, false))
+	RegisterFunction("_xlfn.VAR.P", makeVarianceFunction("VAR.P", false, false))
+	RegisterFunction("_xlfn.VAR.S", makeVarianceFunction("VAR.S", true, false))
+	RegisterFunction("VARP", makeVarianceFunction("VARP", false, false))
+}
+
+// ignoredBool returns true if a boolean is ignored by functions such as SUM and
+// COUNT, which only count booleans that are arguments (e.g. SUM(1,TRUE)), not
+// those in cells or arrays.  nested is true for the values of a range or
+// array.
+func ignoredBool(a Result, nested bool) bool {
+	return a.Type == ResultTypeBool && (nested || a.Ref.Type != ReferenceTypeInvalid)
 }
 
-func sumCount(args []Result, countText bool) (float64, float64) {
+func sumCount(args []Result, countText, nested bool) (float64, float64) {
 	cnt := 0.0
 	sum := 0.0
 	for _, arg := range args {
@@ -33,8 +96,13 @@ func sumCount(args []Result, countText bool) (float64, float64) {
 		case ResultTypeNumber:
 			sum += arg.ValueNumber
 			cnt++
+		case ResultTypeBool:
+			if countText || !ignoredBool(arg, nested) {
+				sum += arg.ValueNumber
+				cnt++
+			}
 		case ResultTypeList, ResultTypeArray:
-			s, c := sumCount(arg.ListValues(), countText)
+			s, c := sumCount(arg.ListValues(), countText, true)
 			sum += s
 			cnt += c
 		case ResultTypeString:
@@ -48,12 +116,11 @@ func sumCount(args []Result, countText bool) (float64, float64) {
 	return sum, cnt
 }
 
-// Average implements the AVERAGE function. It differs slightly from Excel (and
-// agrees with LibreOffice) in that boolean values are counted. As an example,
-// AVERAGE of two cells containing TRUE & FALSE is 0.5 in LibreOffice and
-// #DIV/0! in Excel. gooxml will return 0.5 in this case.
+// Average implements the AVERAGE function. Boolean values are only counted if
+// they're arguments rather than in cells, so AVERAGE of two cells containing
+// TRUE & FALSE is #DIV/0! as in Excel.
 func Average(args []Result) Result {
-	sum, cnt := sumCount(args, false)
+	sum, cnt := sumCount(args, false, false)
 	if cnt == 0 {
 		return MakeErrorResultType(ErrorTypeDivideByZero, "AVERAGE divide by zero")
 	}
@@ -61,9 +128,10 @@ func Average(args []Result) Result {
 }
 
 // Averagea implements the AVERAGEA function, AVERAGEA counts cells that contain
-// text as a zero where AVERAGE ignores them entirely.
+// text as a zero where AVERAGE ignores them entirely, and counts booleans in
+// cells.
 func Averagea(args []Result) Result {
-	sum, cnt := sumCount(args, true)
+	sum, cnt := sumCount(args, true, false)
 	if cnt == 0 {
 		return MakeErrorResultType(ErrorTypeDivideByZero, "AVERAGE divide by zero")
 	}
@@ -78,7 +146,7 @@ const (
 	countEmpty
 )
 
-func count(args []Result, m countMode) float64 {
+func count(args []Result, m countMode, nested bool) float64 {
 	cnt := 0.0
 	for _, arg := range args {
 		switch arg.Type {
@@ -86,8 +154,12 @@ func count(args []Result, m countMode) float64 {
 			if m != countEmpty {
 				cnt++
 			}
+		case ResultTypeBool:
+			if m == countText || (m == countNormal && !ignoredBool(arg, nested)) {
+				cnt++
+			}
 		case ResultTypeList, ResultTypeArray:
-			cnt += count(arg.ListValues(), m)
+			cnt += count(arg.ListValues(), m, true)
 		case ResultTypeString:
 			if m == countText {
 				cnt++
@@ -104,12 +176,12 @@ func count(args []Result, m countMode) float64 {
 
 // Count implements the COUNT function.
 func Count(args []Result) Result {
-	return MakeNumberResult(count(args, countNormal))
+	return MakeNumberResult(count(args, countNormal, false))
 }
 
 // Counta implements the COUNTA function.
 func Counta(args []Result) Result {
-	return MakeNumberResult(count(args, countText))
+	return MakeNumberResult(count(args, countText, false))
 }
 
 // CountBlank implements the COUNTBLANK function.
@@ -118,7 +190,7 @@ func CountBlank(args []Result) Result {
 	if len(args) == 0 {
 		return MakeErrorResult("COUNTBLANK requires an argument")
 	}
-	return MakeNumberResult(count(args, countEmpty))
+	return MakeNumberResult(count(args, countEmpty, false))
 }
 
 // Min is an implementation of the Excel MIN() function.
@@ -126,9 +198,15 @@ func Min(args []Result) Result {
 	if len(args) == 0 {
 		return MakeErrorResult("MIN requires at least one argument")
 	}
+	return minOf(args, false)
+}
 
+func minOf(args []Result, nested bool) Result {
 	v := math.MaxFloat64
 	for _, a := range args {
+		if ignoredBool(a, nested) {
+			continue
+		}
 		a = a.AsNumber()
 		switch a.Type {
 		case ResultTypeNumber:
@@ -136,7 +214,7 @@ func Min(args []Result) Result {
 				v = a.ValueNumber
 			}
 		case ResultTypeList, ResultTypeArray:
-			subMin := Min(a.ListValues())
+			subMin := minOf(a.ListValues(), true)
 			if subMin.ValueNumber < v {
 				v = subMin.ValueNumber
 			}
@@ -164,8 +242,15 @@ func Max(args []Result) Result {
 	if len(args) == 0 {
 		return MakeErrorResult("MAX requires at least one argument")
 	}
+	return maxOf(args, false)
+}
+
+func maxOf(args []Result, nested bool) Result {
 	v := -math.MaxFloat64
 	for _, a := range args {
+		if ignoredBool(a, nested) {
+			continue
+		}
 		a = a.AsNumber()
 		switch a.Type {
 		case ResultTypeNumber:
@@ -173,7 +258,7 @@ func Max(args []Result) Result {
 				v = a.ValueNumber
 			}
 		case ResultTypeList, ResultTypeArray:
-			subMax := Max(a.ListValues())
+			subMax := maxOf(a.ListValues(), true)
 			if subMax.ValueNumber > v {
 				v = subMax.ValueNumber
 			}
@@ -195,9 +280,12 @@ func Max(args []Result) Result {
 }
 
 func extractNumbers(args []Result) []float64 {
-	values := make([]float64, 0)
+	return appendNumbers(make([]float64, 0), args, false)
+}
+
+func appendNumbers(values []float64, args []Result, nested bool) []float64 {
 	for _, a := range args {
-		if a.Type == ResultTypeEmpty {
+		if a.Type == ResultTypeEmpty || ignoredBool(a, nested) {
 			continue
 		}
 		a = a.AsNumber()
@@ -205,7 +293,7 @@ func extractNumbers(args []Result) []float64 {
 		case ResultTypeNumber:
 			values = append(values, a.ValueNumber)
 		case ResultTypeList, ResultTypeArray:
-			values = append(values, extractNumbers(a.ListValues())...)
+			values = appendNumbers(values, a.ListValues(), true)
 		case ResultTypeString:
 			// treated as zero by Excel
 		default:
@@ -231,3 +319,1229 @@ func Median(args []Result) Result {
 	}
 	return MakeNumberResult(v)
 }
+
+// CountIf implements the COUNTIF function.
+func CountIf(args []Result) Result {
+	if len(args) != 2 {
+		return MakeErrorResult("COUNTIF requires two arguments")
+	}
+	crit := parseCriteria(args[1])
+	cnt := 0.0
+	for _, v := range flatten(args[0]) {
+		if crit.matches(v) {
+			cnt++
+		}
+	}
+	return MakeNumberResult(cnt)
+}
+
+// CountIfs implements the COUNTIFS function.
+func CountIfs(args []Result) Result {
+	if len(args) < 2 {
+		return MakeErrorResult("COUNTIFS requires at least two arguments")
+	}
+	mask, err := matchCriteria(args[0], args, "COUNTIFS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	cnt := 0.0
+	for _, m := range mask {
+		if m {
+			cnt++
+		}
+	}
+	return MakeNumberResult(cnt)
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// AverageIf implements the AVERAGEIF function.
+func AverageIf(ctx Context, ev Evaluator, args []Result) Result {
+	values, err := ifValues(ctx, ev, args, "AVERAGEIF")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if len(values) == 0 {
+		return MakeErrorResultType(ErrorTypeDivideByZero, "AVERAGEIF divide by zero")
+	}
+	return MakeNumberResult(mean(values))
+}
+
+// AverageIfs implements the AVERAGEIFS function.
+func AverageIfs(args []Result) Result {
+	values, err := ifsValues(args, "AVERAGEIFS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if len(values) == 0 {
+		return MakeErrorResultType(ErrorTypeDivideByZero, "AVERAGEIFS divide by zero")
+	}
+	return MakeNumberResult(mean(values))
+}
+
+// MaxIfs implements the MAXIFS function.
+func MaxIfs(args []Result) Result {
+	values, err := ifsValues(args, "MAXIFS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if len(values) == 0 {
+		return MakeNumberResult(0)
+	}
+	v := values[0]
+	for _, x := range values {
+		v = math.Max(v, x)
+	}
+	return MakeNumberResult(v)
+}
+
+// MinIfs implements the MINIFS function.
+func MinIfs(args []Result) Result {
+	values, err := ifsValues(args, "MINIFS")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if len(values) == 0 {
+		return MakeNumberResult(0)
+	}
+	v := values[0]
+	for _, x := range values {
+		v = math.Min(v, x)
+	}
+	return MakeNumberResult(v)
+}
+
+// makeVarianceFunction returns a function that computes the sample or
+// population variance or standard deviation of its arguments.
+func makeVarianceFunction(name string, sample, stdev bool) Function {
+	return func(args []Result) Result {
+		if len(args) == 0 {
+			return MakeErrorResult(name + " requires at least one argument")
+		}
+		values := extractNumbers(args)
+		n := float64(len(values))
+		if n == 0 || (sample && n < 2) {
+			return MakeErrorResultType(ErrorTypeDivideByZero, name+" divide by zero")
+		}
+		m := mean(values)
+		ss := 0.0
+		for _, v := range values {
+			ss += (v - m) * (v - m)
+		}
+		if sample {
+			n--
+		}
+		if stdev {
+			return MakeNumberResult(math.Sqrt(ss / n))
+		}
+		return MakeNumberResult(ss / n)
+	}
+}
+
+// kthValue implements LARGE and SMALL which return the k-th largest or smallest
+// value in a data set.
+func kthValue(args []Result, fn string, largest bool) Result {
+	if len(args) != 2 {
+		return MakeErrorResult(fn + " requires two arguments")
+	}
+	if args[0].Type == ResultTypeError {
+		return args[0]
+	}
+	values := extractNumbers(args[:1])
+	k, err := numberArg(args[1], fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	k = math.Ceil(k)
+	if k < 1 || int(k) > len(values) {
+		return MakeErrorResultType(ErrorTypeNum, fn+" k is out of range")
+	}
+	sort.Float64s(values)
+	if largest {
+		return MakeNumberResult(values[len(values)-int(k)])
+	}
+	return MakeNumberResult(values[int(k)-1])
+}
+
+// Large implements the LARGE function.
+func Large(args []Result) Result {
+	return kthValue(args, "LARGE", true)
+}
+
+// Small implements the SMALL function.
+func Small(args []Result) Result {
+	return kthValue(args, "SMALL", false)
+}
+
+func rank(args []Result, fn string, average bool) Result {
+	if len(args) != 2 && len(args) != 3 {
+		return MakeErrorResult(fn + " requires two or three arguments")
+	}
+	num, err := numberArg(args[0], fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	ascending := false
+	if len(args) == 3 {
+		order, err := numberArg(args[2], fn)
+		if err.Type == ResultTypeError {
+			return err
+		}
+		ascending = order != 0
+	}
+	before, equal := 0.0, 0.0
+	for _, v := range extractNumbers(args[1:2]) {
+		switch {
+		case v == num:
+			equal++
+		case ascending && v < num, !ascending && v > num:
+			before++
+		}
+	}
+	if equal == 0 {
+		return MakeErrorResultType(ErrorTypeNA, fn+" number not found in reference")
+	}
+	if average {
+		return MakeNumberResult(before + (equal+1)/2)
+	}
+	return MakeNumberResult(before + 1)
+}
+
+// RankEq implements the RANK and RANK.EQ functions.
+func RankEq(args []Result) Result {
+	return rank(args, "RANK.EQ", false)
+}
+
+// RankAvg implements the RANK.AVG function that returns the average rank when
+// multiple values have the same rank.
+func RankAvg(args []Result) Result {
+	return rank(args, "RANK.AVG", true)
+}
+
+// percentile returns the k-th percentile of the sorted values, interpolating
+// between values.  Inclusive percentiles range over [0,1] and exclusive
+// percentiles over (1/(n+1), n/(n+1)).
+func percentile(values []float64, k float64, exclusive bool) (float64, bool) {
+	n := float64(len(values))
+	var pos float64
+	if exclusive {
+		pos = k*(n+1) - 1
+		if k <= 0 || k >= 1 || pos < 0 || pos > n-1 {
+			return 0, false
+		}
+	} else {
+		if k < 0 || k > 1 || n == 0 {
+			return 0, false
+		}
+		pos = k * (n - 1)
+	}
+	lo := math.Floor(pos)
+	v := values[int(lo)]
+	if frac := pos - lo; frac > 0 {
+		v += frac * (values[int(lo)+1] - v)
+	}
+	return v, true
+}
+
+func percentileFunction(args []Result, fn string, exclusive, quartile bool) Result {
+	if len(args) != 2 {
+		return MakeErrorResult(fn + " requires two arguments")
+	}
+	if args[0].Type == ResultTypeError {
+		return args[0]
+	}
+	values := extractNumbers(args[:1])
+	sort.Float64s(values)
+	k, err := numberArg(args[1], fn)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if quartile {
+		k = math.Trunc(k)
+		if k < 0 || k > 4 || (exclusive && (k < 1 || k > 3)) {
+			return MakeErrorResultType(ErrorTypeNum, fn+" quart is out of range")
+		}
+		k /= 4
+	}
+	v, ok := percentile(values, k, exclusive)
+	if !ok {
+		return MakeErrorResultType(ErrorTypeNum, fn+" k is out of range")
+	}
+	return MakeNumberResult(v)
+}
+
+// PercentileInc implements the PERCENTILE and PERCENTILE.INC functions.
+func PercentileInc(args []Result) Result {
+	return percentileFunction(args, "PERCENTILE.INC", false, false)
+}
+
+// PercentileExc implements the PERCENTILE.EXC function.
+func PercentileExc(args []Result) Result {
+	return percentileFunction(args, "PERCENTILE.EXC", true, false)
+}
+
+// QuartileInc implements the QUARTILE and QUARTILE.INC functions.
+func QuartileInc(args []Result) Result {
+	return percentileFunction(args, "QUARTILE.INC", false, true)
+}
+
+// QuartileExc implements the QUARTILE.EXC function.
+func QuartileExc(args []Result) Result {
+	return percentileFunction(args, "QUARTILE.EXC", true, true)
+}
+
+// modes returns the most frequently occurring values in the order that they
+// first appear.
+func modes(args []Result) []float64 {
+	values := extractNumbers(args)
+	counts := map[float64]int{}
+	order := []float64{}
+	best := 0
+	for _, v := range values {
+		if counts[v] == 0 {
+			order = append(order, v)
+		}
+		counts[v]++
+		if counts[v] > best {
+			best = counts[v]
+		}
+	}
+	ret := []float64{}
+	if best < 2 {
+		return ret
+	}
+	for _, v := range order {
+		if counts[v] == best {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// Mode implements the MODE and MODE.SNGL functions.
+func Mode(args []Result) Result {
+	if len(args) == 0 {
+		return MakeErrorResult("MODE requires at least one argument")
+	}
+	m := modes(args)
+	if len(m) == 0 {
+		return MakeErrorResultType(ErrorTypeNA, "MODE found no repeated values")
+	}
+	return MakeNumberResult(m[0])
+}
+
+// ModeMult implements the MODE.MULT function which returns a vertical array of
+// the most frequently occurring values.
+func ModeMult(args []Result) Result {
+	if len(args) == 0 {
+		return MakeErrorResult("MODE.MULT requires at least one argument")
+	}
+	m := modes(args)
+	if len(m) == 0 {
+		return MakeErrorResultType(ErrorTypeNA, "MODE.MULT found no repeated values")
+	}
+	arr := [][]Result{}
+	for _, v := range m {
+		arr = append(arr, []Result{MakeNumberResult(v)})
+	}
+	return MakeArrayResult(arr)
+}
+
+// pairedNumbers returns the pairs of values from two equally sized arrays where
+// both values are numbers.
+func pairedNumbers(ys, xs Result, fn string) ([]float64, []float64, Result) {
+	yv, xv := flatten(ys), flatten(xs)
+	if len(yv) != len(xv) {
+		return nil, nil, MakeErrorResultType(ErrorTypeNA, fn+" requires arrays of the same size")
+	}
+	y, x := []float64{}, []float64{}
+	for i := range yv {
+		if yv[i].Type == ResultTypeError {
+			return nil, nil, yv[i]
+		}
+		if xv[i].Type == ResultTypeError {
+			return nil, nil, xv[i]
+		}
+		if yv[i].Type == ResultTypeNumber && xv[i].Type == ResultTypeNumber {
+			y = append(y, yv[i].ValueNumber)
+			x = append(x, xv[i].ValueNumber)
+		}
+	}
+	return y, x, MakeEmptyResult()
+}
+
+// linearFit returns the slope and intercept of the least squares line through
+// the points.
+func linearFit(args []Result, fn string) (float64, float64, Result) {
+	if len(args) != 2 {
+		return 0, 0, MakeErrorResult(fn + " requires two arguments")
+	}
+	y, x, err := pairedNumbers(args[0], args[1], fn)
+	if err.Type == ResultTypeError {
+		return 0, 0, err
+	}
+	if len(y) == 0 {
+		return 0, 0, MakeErrorResultType(ErrorTypeDivideByZero, fn+" requires numeric data")
+	}
+	my, mx := mean(y), mean(x)
+	sxy, sxx := 0.0, 0.0
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+	}
+	if sxx == 0 {
+		return 0, 0, MakeErrorResultType(ErrorTypeDivideByZero, fn+" known_x's have zero variance")
+	}
+	slope := sxy / sxx
+	return slope, my - slope*mx, MakeEmptyResult()
+}
+
+// Slope implements the SLOPE function.
+func Slope(args []Result) Result {
+	m, _, err := linearFit(args, "SLOPE")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	return MakeNumberResult(m)
+}
+
+// Intercept implements the INTERCEPT function.
+func Intercept(args []Result) Result {
+	_, b, err := linearFit(args, "INTERCEPT")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	return MakeNumberResult(b)
+}
+
+// Forecast implements the FORECAST and FORECAST.LINEAR functions.
+func Forecast(args []Result) Result {
+	if len(args) != 3 {
+		return MakeErrorResult("FORECAST requires three arguments")
+	}
+	x, err := numberArg(args[0], "FORECAST")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	m, b, err := linearFit(args[1:], "FORECAST")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	return MakeNumberResult(m*x + b)
+}
+
+// Correl implements the CORREL function that returns the correlation
+// coefficient of two data sets.
+func Correl(args []Result) Result {
+	if len(args) != 2 {
+		return MakeErrorResult("CORREL requires two arguments")
+	}
+	a, b, err := pairedNumbers(args[0], args[1], "CORREL")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if len(a) == 0 {
+		return MakeErrorResultType(ErrorTypeDivideByZero, "CORREL requires numeric data")
+	}
+	ma, mb := mean(a), mean(b)
+	sab, saa, sbb := 0.0, 0.0, 0.0
+	for i := range a {
+		sab += (a[i] - ma) * (b[i] - mb)
+		saa += (a[i] - ma) * (a[i] - ma)
+		sbb += (b[i] - mb) * (b[i] - mb)
+	}
+	if saa == 0 || sbb == 0 {
+		return MakeErrorResultType(ErrorTypeDivideByZero, "CORREL data has zero variance")
+	}
+	return MakeNumberResult(sab / math.Sqrt(saa*sbb))
+}
+
+// regressionData holds the observations for LINEST and TREND.  Each element
+// of x holds the values of the independent variables for one observation.
+type regressionData struct {
+	y     []float64
+	x     [][]float64
+	byRow bool
+}
+
+func numericValues(r Result, fn string) ([]float64, Result) {
+	ret := []float64{}
+	for _, v := range flatten(r) {
+		switch v.Type {
+		case ResultTypeNumber:
+			ret = append(ret, v.ValueNumber)
+		case ResultTypeError:
+			return nil, v
+		default:
+			return nil, MakeErrorResult(fn + " requires numeric data")
+		}
+	}
+	return ret, MakeEmptyResult()
+}
+
+// parseRegressionData interprets the known_y's and known_x's arguments. If
+// known_y's is a single column, each column of known_x's is a separate
+// variable, and if it's a single row, each row of known_x's is.
+func parseRegressionData(knownY Result, knownX *Result, fn string) (regressionData, Result) {
+	d := regressionData{}
+	var err Result
+	if d.y, err = numericValues(knownY, fn); err.Type == ResultTypeError {
+		return d, err
+	}
+	yRows, yCols := dims(knownY)
+	d.byRow = yRows == 1 && yCols > 1
+	if knownX == nil {
+		for i := range d.y {
+			d.x = append(d.x, []float64{float64(i + 1)})
+		}
+		return d, MakeEmptyResult()
+	}
+	xv, err := numericValues(*knownX, fn)
+	if err.Type == ResultTypeError {
+		return d, err
+	}
+	xRows, xCols := dims(*knownX)
+	switch {
+	case xRows == yRows && xCols == yCols:
+		for _, v := range xv {
+			d.x = append(d.x, []float64{v})
+		}
+	case yCols == 1 && xRows == yRows:
+		for i := 0; i < xRows; i++ {
+			d.x = append(d.x, xv[i*xCols:(i+1)*xCols])
+		}
+	case yRows == 1 && xCols == yCols:
+		for j := 0; j < xCols; j++ {
+			obs := []float64{}
+			for i := 0; i < xRows; i++ {
+				obs = append(obs, xv[i*xCols+j])
+			}
+			d.x = append(d.x, obs)
+		}
+	default:
+		return d, MakeErrorResultType(ErrorTypeRef, fn+" known_x's doesn't match known_y's")
+	}
+	return d, MakeEmptyResult()
+}
+
+// regression is the result of a multiple linear regression.
+type regression struct {
+	m       []float64
+	b       float64
+	se      []float64
+	seB     float64
+	r2      float64
+	sey     float64
+	f       float64
+	df      float64
+	ssreg   float64
+	ssresid float64
+}
+
+// invert returns the inverse of a square matrix using Gauss-Jordan
+// elimination with partial pivoting.
+func invert(a [][]float64) ([][]float64, bool) {
+	n := len(a)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = make([]float64, 2*n)
+		copy(m[i], a[i])
+		m[i][n+i] = 1
+	}
+	for c := 0; c < n; c++ {
+		p := c
+		for r := c + 1; r < n; r++ {
+			if math.Abs(m[r][c]) > math.Abs(m[p][c]) {
+				p = r
+			}
+		}
+		if math.Abs(m[p][c]) < 1e-12 {
+			return nil, false
+		}
+		m[c], m[p] = m[p], m[c]
+		pv := m[c][c]
+		for j := range m[c] {
+			m[c][j] /= pv
+		}
+		for r := 0; r < n; r++ {
+			if r == c || m[r][c] == 0 {
+				continue
+			}
+			f := m[r][c]
+			for j := range m[r] {
+				m[r][j] -= f * m[c][j]
+			}
+		}
+	}
+	for i := range m {
+		m[i] = m[i][n:]
+	}
+	return m, true
+}
+
+// fitRegression performs a least squares fit of y against the variables in x.
+// The data is centered when fitting an intercept to improve accuracy.
+func fitRegression(d regressionData, intercept bool, fn string) (regression, Result) {
+	reg := regression{}
+	n := len(d.y)
+	if n == 0 || len(d.x) != n {
+		return reg, MakeErrorResultType(ErrorTypeNum, fn+" requires data")
+	}
+	k := len(d.x[0])
+	my := 0.0
+	mx := make([]float64, k)
+	if intercept {
+		my = mean(d.y)
+		for _, obs := range d.x {
+			for j, v := range obs {
+				mx[j] += v / float64(n)
+			}
+		}
+	}
+	xtx := make([][]float64, k)
+	xty := make([]float64, k)
+	for i := range xtx {
+		xtx[i] = make([]float64, k)
+	}
+	for o, obs := range d.x {
+		for i := 0; i < k; i++ {
+			xi := obs[i] - mx[i]
+			xty[i] += xi * (d.y[o] - my)
+			for j := 0; j < k; j++ {
+				xtx[i][j] += xi * (obs[j] - mx[j])
+			}
+		}
+	}
+	inv, ok := invert(xtx)
+	if !ok {
+		return reg, MakeErrorResultType(ErrorTypeNum, fn+" known_x's are collinear")
+	}
+	reg.m = make([]float64, k)
+	for i := range reg.m {
+		for j := range xty {
+			reg.m[i] += inv[i][j] * xty[j]
+		}
+	}
+	if intercept {
+		reg.b = my
+		for i := range reg.m {
+			reg.b -= reg.m[i] * mx[i]
+		}
+	}
+
+	sstotal := 0.0
+	for o, obs := range d.x {
+		yhat := reg.b
+		for i, v := range obs {
+			yhat += reg.m[i] * v
+		}
+		reg.ssresid += (d.y[o] - yhat) * (d.y[o] - yhat)
+		sstotal += (d.y[o] - my) * (d.y[o] - my)
+	}
+	reg.ssreg = sstotal - reg.ssresid
+	reg.df = float64(n - k)
+	if intercept {
+		reg.df--
+	}
+	reg.r2 = reg.ssreg / sstotal
+	s2 := reg.ssresid / reg.df
+	reg.sey = math.Sqrt(s2)
+	reg.f = (reg.ssreg / float64(k)) / s2
+	reg.se = make([]float64, k)
+	for i := range reg.se {
+		reg.se[i] = math.Sqrt(s2 * inv[i][i])
+	}
+	if intercept {
+		v := 1 / float64(n)
+		for i := range mx {
+			for j := range mx {
+				v += mx[i] * inv[i][j] * mx[j]
+			}
+		}
+		reg.seB = math.Sqrt(s2 * v)
+	}
+	return reg, MakeEmptyResult()
+}
+
+// optionalBool parses an optional boolean argument.
+func optionalBool(args []Result, idx int, def bool, fn string) (bool, Result) {
+	if idx >= len(args) || args[idx].Type == ResultTypeEmpty {
+		return def, MakeEmptyResult()
+	}
+	v, err := numberArg(args[idx], fn)
+	if err.Type == ResultTypeError {
+		return false, err
+	}
+	return v != 0, MakeEmptyResult()
+}
+
+// statResult converts a computed statistic to a result, using #NUM! for values
+// that can't be computed.
+func statResult(v float64) Result {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return MakeErrorResultType(ErrorTypeNum, "statistic is undefined")
+	}
+	return MakeNumberResult(v)
+}
+
+// Linest implements the LINEST function that returns the statistics for a line
+// fitted by least squares.  With multiple independent variables the
+// coefficients are returned in the reverse order of the variables.
+func Linest(args []Result) Result {
+	if len(args) < 1 || len(args) > 4 {
+		return MakeErrorResult("LINEST requires one to four arguments")
+	}
+	var knownX *Result
+	if len(args) > 1 && args[1].Type != ResultTypeEmpty {
+		knownX = &args[1]
+	}
+	intercept, err := optionalBool(args, 2, true, "LINEST")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	stats, err := optionalBool(args, 3, false, "LINEST")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	d, err := parseRegressionData(args[0], knownX, "LINEST")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	reg, err := fitRegression(d, intercept, "LINEST")
+	if err.Type == ResultTypeError {
+		return err
+	}
+
+	k := len(reg.m)
+	na := MakeErrorResultType(ErrorTypeNA, "")
+	row := func(vals ...Result) []Result {
+		for len(vals) < k+1 {
+			vals = append(vals, na)
+		}
+		return vals
+	}
+	coef := []Result{}
+	se := []Result{}
+	for i := k - 1; i >= 0; i-- {
+		coef = append(coef, MakeNumberResult(reg.m[i]))
+		se = append(se, statResult(reg.se[i]))
+	}
+	coef = append(coef, MakeNumberResult(reg.b))
+	if intercept {
+		se = append(se, statResult(reg.seB))
+	} else {
+		se = append(se, na)
+	}
+	if !stats {
+		return MakeListResult(coef)
+	}
+	return MakeArrayResult([][]Result{
+		coef,
+		se,
+		row(statResult(reg.r2), statResult(reg.sey)),
+		row(statResult(reg.f), MakeNumberResult(reg.df)),
+		row(MakeNumberResult(reg.ssreg), MakeNumberResult(reg.ssresid)),
+	})
+}
+
+// Trend implements the TREND function that returns values along a linear trend
+// fitted by least squares.
+func Trend(args []Result) Result {
+	if len(args) < 1 || len(args) > 4 {
+		return MakeErrorResult("TREND requires one to four arguments")
+	}
+	var knownX *Result
+	if len(args) > 1 && args[1].Type != ResultTypeEmpty {
+		knownX = &args[1]
+	}
+	intercept, err := optionalBool(args, 3, true, "TREND")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	d, err := parseRegressionData(args[0], knownX, "TREND")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	reg, err := fitRegression(d, intercept, "TREND")
+	if err.Type == ResultTypeError {
+		return err
+	}
+
+	newX := knownX
+	if len(args) > 2 && args[2].Type != ResultTypeEmpty {
+		newX = &args[2]
+	}
+	predict := func(obs []float64) Result {
+		v := reg.b
+		for i, x := range obs {
+			v += reg.m[i] * x
+		}
+		return MakeNumberResult(v)
+	}
+
+	// with a single variable the result has the same shape as new_x's
+	k := len(reg.m)
+	if k == 1 {
+		if newX == nil {
+			res := []Result{}
+			for _, obs := range d.x {
+				res = append(res, predict(obs))
+			}
+			if d.byRow {
+				return MakeListResult(res)
+			}
+			return MakeArrayResult(columnArray(res))
+		}
+		switch newX.Type {
+		case ResultTypeArray:
+			arr := [][]Result{}
+			for _, r := range newX.ValueArray {
+				vals, err := numericValues(MakeListResult(r), "TREND")
+				if err.Type == ResultTypeError {
+					return err
+				}
+				row := []Result{}
+				for _, v := range vals {
+					row = append(row, predict([]float64{v}))
+				}
+				arr = append(arr, row)
+			}
+			return MakeArrayResult(arr)
+		case ResultTypeList:
+			vals, err := numericValues(*newX, "TREND")
+			if err.Type == ResultTypeError {
+				return err
+			}
+			res := []Result{}
+			for _, v := range vals {
+				res = append(res, predict([]float64{v}))
+			}
+			return MakeListResult(res)
+		}
+		v, err := numberArg(*newX, "TREND")
+		if err.Type == ResultTypeError {
+			return err
+		}
+		return predict([]float64{v})
+	}
+
+	vals, err := numericValues(*newX, "TREND")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	rows, cols := dims(*newX)
+	if d.byRow {
+		// each column of new_x's is an observation
+		if rows != k {
+			return MakeErrorResultType(ErrorTypeRef, "TREND new_x's doesn't match known_x's")
+		}
+		res := []Result{}
+		for j := 0; j < cols; j++ {
+			obs := []float64{}
+			for i := 0; i < rows; i++ {
+				obs = append(obs, vals[i*cols+j])
+			}
+			res = append(res, predict(obs))
+		}
+		return MakeListResult(res)
+	}
+	// each row of new_x's is an observation
+	if cols != k {
+		return MakeErrorResultType(ErrorTypeRef, "TREND new_x's doesn't match known_x's")
+	}
+	res := []Result{}
+	for i := 0; i < rows; i++ {
+		res = append(res, predict(vals[i*k:(i+1)*k]))
+	}
+	return MakeArrayResult(columnArray(res))
+}
+
+// columnArray converts a list of values to a single column array.
+func columnArray(values []Result) [][]Result {
+	arr := [][]Result{}
+	for _, v := range values {
+		arr = append(arr, []Result{v})
+	}
+	return arr
+}
+
+// distributionArgs parses the numeric arguments to a distribution function.
+func distributionArgs(args []Result, fn string, n int) ([]float64, Result) {
+	if len(args) != n {
+		return nil, MakeErrorResult(fmt.Sprintf("%s requires %d arguments", fn, n))
+	}
+	ret := make([]float64, n)
+	for i := range args {
+		v, err := numberArg(args[i], fn)
+		if err.Type == ResultTypeError {
+			return nil, err
+		}
+		ret[i] = v
+	}
+	return ret, MakeEmptyResult()
+}
+
+func normCDF(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+func normPDF(z float64) float64 {
+	return math.Exp(-z*z/2) / math.Sqrt(2*math.Pi)
+}
+
+// NormDist implements the NORM.DIST and NORMDIST functions.
+func NormDist(args []Result) Result {
+	a, err := distributionArgs(args, "NORM.DIST", 4)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	x, m, sd, cumulative := a[0], a[1], a[2], a[3] != 0
+	if sd <= 0 {
+		return MakeErrorResultType(ErrorTypeNum, "NORM.DIST requires a positive standard deviation")
+	}
+	if cumulative {
+		return MakeNumberResult(normCDF((x - m) / sd))
+	}
+	return MakeNumberResult(normPDF((x-m)/sd) / sd)
+}
+
+// NormSDist implements the NORM.S.DIST and NORMSDIST functions. NORMSDIST only
+// has a cumulative form.
+func NormSDist(args []Result) Result {
+	cumulative := true
+	switch len(args) {
+	case 1:
+	case 2:
+		c, err := numberArg(args[1], "NORM.S.DIST")
+		if err.Type == ResultTypeError {
+			return err
+		}
+		cumulative = c != 0
+	default:
+		return MakeErrorResult("NORM.S.DIST requires one or two arguments")
+	}
+	z, err := numberArg(args[0], "NORM.S.DIST")
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if cumulative {
+		return MakeNumberResult(normCDF(z))
+	}
+	return MakeNumberResult(normPDF(z))
+}
+
+// NormInv implements the NORM.INV and NORMINV functions.
+func NormInv(args []Result) Result {
+	a, err := distributionArgs(args, "NORM.INV", 3)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	p, m, sd := a[0], a[1], a[2]
+	if p <= 0 || p >= 1 || sd <= 0 {
+		return MakeErrorResultType(ErrorTypeNum, "NORM.INV argument out of range")
+	}
+	return MakeNumberResult(m + sd*math.Sqrt2*math.Erfinv(2*p-1))
+}
+
+// NormSInv implements the NORM.S.INV and NORMSINV functions.
+func NormSInv(args []Result) Result {
+	a, err := distributionArgs(args, "NORM.S.INV", 1)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if a[0] <= 0 || a[0] >= 1 {
+		return MakeErrorResultType(ErrorTypeNum, "NORM.S.INV argument out of range")
+	}
+	return MakeNumberResult(math.Sqrt2 * math.Erfinv(2*a[0]-1))
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a,b).
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lab, _ := math.Lgamma(a + b)
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log1p(-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaCF(a, b, x) / a
+	}
+	return 1 - front*betaCF(b, a, 1-x)/b
+}
+
+// betaCF evaluates the continued fraction for the incomplete beta function
+// using the modified Lentz method.
+func betaCF(a, b, x float64) float64 {
+	const tiny = 1e-300
+	clamp := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	c := 1.0
+	d := 1 / clamp(1-(a+b)*x/(a+1))
+	h := d
+	for m := 1.0; m <= 300; m++ {
+		aa := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 / clamp(1+aa*d)
+		c = clamp(1 + aa/c)
+		h *= d * c
+		aa = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 / clamp(1+aa*d)
+		c = clamp(1 + aa/c)
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < 1e-16 {
+			break
+		}
+	}
+	return h
+}
+
+// regIncGamma returns the regularized lower and upper incomplete gamma
+// functions P(a,x) and Q(a,x).
+func regIncGamma(a, x float64) (float64, float64) {
+	if x <= 0 {
+		return 0, 1
+	}
+	lg, _ := math.Lgamma(a)
+	front := math.Exp(-x + a*math.Log(x) - lg)
+	if x < a+1 {
+		// series representation
+		ap, del := a, 1/a
+		sum := del
+		for i := 0; i < 1000; i++ {
+			ap++
+			del *= x / ap
+			sum += del
+			if math.Abs(del) < math.Abs(sum)*1e-16 {
+				break
+			}
+		}
+		p := sum * front
+		return p, 1 - p
+	}
+
+	// continued fraction representation
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1.0; i < 1000; i++ {
+		an := -i * (i - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < 1e-16 {
+			break
+		}
+	}
+	q := front * h
+	return 1 - q, q
+}
+
+// tDistRight returns the probability that a Student's t distributed value is
+// greater than x for x >= 0.
+func tDistRight(x, df float64) float64 {
+	return regIncBeta(df/2, 0.5, df/(df+x*x)) / 2
+}
+
+// TDist implements the T.DIST function that returns the left-tailed Student's
+// t-distribution.
+func TDist(args []Result) Result {
+	a, err := distributionArgs(args, "T.DIST", 3)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	x, df, cumulative := a[0], math.Trunc(a[1]), a[2] != 0
+	if df < 1 {
+		return MakeErrorResultType(ErrorTypeNum, "T.DIST requires at least one degree of freedom")
+	}
+	if !cumulative {
+		lg1, _ := math.Lgamma((df + 1) / 2)
+		lg2, _ := math.Lgamma(df / 2)
+		return MakeNumberResult(math.Exp(lg1-lg2) / math.Sqrt(df*math.Pi) * math.Pow(1+x*x/df, -(df+1)/2))
+	}
+	r := tDistRight(math.Abs(x), df)
+	if x < 0 {
+		return MakeNumberResult(r)
+	}
+	return MakeNumberResult(1 - r)
+}
+
+func tDistTails(args []Result, fn string, tails float64) Result {
+	a, err := distributionArgs(args, fn, 2)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	x, df := a[0], math.Trunc(a[1])
+	if df < 1 || (tails == 2 && x < 0) {
+		return MakeErrorResultType(ErrorTypeNum, fn+" argument out of range")
+	}
+	if x < 0 {
+		return MakeNumberResult(1 - tDistRight(-x, df))
+	}
+	return MakeNumberResult(tails * tDistRight(x, df))
+}
+
+// TDist2T implements the T.DIST.2T function that returns the two-tailed
+// Student's t-distribution.
+func TDist2T(args []Result) Result {
+	return tDistTails(args, "T.DIST.2T", 2)
+}
+
+// TDistRt implements the T.DIST.RT function that returns the right-tailed
+// Student's t-distribution.
+func TDistRt(args []Result) Result {
+	return tDistTails(args, "T.DIST.RT", 1)
+}
+
+// TDist2 implements the legacy TDIST function which takes the number of tails
+// as an argument.
+func TDist2(args []Result) Result {
+	a, err := distributionArgs(args, "TDIST", 3)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	x, df, tails := a[0], math.Trunc(a[1]), math.Trunc(a[2])
+	if x < 0 || df < 1 || (tails != 1 && tails != 2) {
+		return MakeErrorResultType(ErrorTypeNum, "TDIST argument out of range")
+	}
+	return MakeNumberResult(tails * tDistRight(x, df))
+}
+
+func chisqArgs(args []Result, fn string, n int) (float64, float64, []float64, Result) {
+	a, err := distributionArgs(args, fn, n)
+	if err.Type == ResultTypeError {
+		return 0, 0, nil, err
+	}
+	x, df := a[0], math.Trunc(a[1])
+	if x < 0 || df < 1 || df > 1e10 {
+		return 0, 0, nil, MakeErrorResultType(ErrorTypeNum, fn+" argument out of range")
+	}
+	return x, df, a, MakeEmptyResult()
+}
+
+// ChisqDist implements the CHISQ.DIST function that returns the left-tailed
+// chi-squared distribution.
+func ChisqDist(args []Result) Result {
+	x, df, a, err := chisqArgs(args, "CHISQ.DIST", 3)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	if a[2] != 0 {
+		p, _ := regIncGamma(df/2, x/2)
+		return MakeNumberResult(p)
+	}
+	if x == 0 {
+		switch {
+		case df == 1:
+			return MakeErrorResultType(ErrorTypeNum, "CHISQ.DIST density is infinite")
+		case df == 2:
+			return MakeNumberResult(0.5)
+		}
+		return MakeNumberResult(0)
+	}
+	lg, _ := math.Lgamma(df / 2)
+	return MakeNumberResult(math.Exp((df/2-1)*math.Log(x) - x/2 - df/2*math.Ln2 - lg))
+}
+
+// ChisqDistRt implements the CHISQ.DIST.RT and CHIDIST functions that return
+// the right-tailed chi-squared distribution.
+func ChisqDistRt(args []Result) Result {
+	x, df, _, err := chisqArgs(args, "CHISQ.DIST.RT", 2)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	_, q := regIncGamma(df/2, x/2)
+	return MakeNumberResult(q)
+}
+
+func binomPMF(k, n, p float64) float64 {
+	switch {
+	case p == 0:
+		if k == 0 {
+			return 1
+		}
+		return 0
+	case p == 1:
+		if k == n {
+			return 1
+		}
+		return 0
+	}
+	ln, _ := math.Lgamma(n + 1)
+	lk, _ := math.Lgamma(k + 1)
+	lnk, _ := math.Lgamma(n - k + 1)
+	return math.Exp(ln - lk - lnk + k*math.Log(p) + (n-k)*math.Log1p(-p))
+}
+
+// BinomDist implements the BINOM.DIST and BINOMDIST functions.
+func BinomDist(args []Result) Result {
+	a, err := distributionArgs(args, "BINOM.DIST", 4)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	k, n, p, cumulative := math.Trunc(a[0]), math.Trunc(a[1]), a[2], a[3] != 0
+	if k < 0 || k > n || p < 0 || p > 1 {
+		return MakeErrorResultType(ErrorTypeNum, "BINOM.DIST argument out of range")
+	}
+	if !cumulative {
+		return MakeNumberResult(binomPMF(k, n, p))
+	}
+	sum := 0.0
+	for i := 0.0; i <= k; i++ {
+		sum += binomPMF(i, n, p)
+	}
+	return MakeNumberResult(math.Min(sum, 1))
+}
+
+func poissonPMF(k, lambda float64) float64 {
+	if lambda == 0 {
+		if k == 0 {
+			return 1
+		}
+		return 0
+	}
+	lk, _ := math.Lgamma(k + 1)
+	return math.Exp(-lambda + k*math.Log(lambda) - lk)
+}
+
+// PoissonDist implements the POISSON.DIST and POISSON functions.
+func PoissonDist(args []Result) Result {
+	a, err := distributionArgs(args, "POISSON.DIST", 3)
+	if err.Type == ResultTypeError {
+		return err
+	}
+	x, lambda, cumulative := math.Trunc(a[0]), a[1], a[2] != 0
+	if x < 0 || lambda < 0 {
+		return MakeErrorResultType(ErrorTypeNum, "POISSON.DIST argument out of range")
+	}
+	if !cumulative {
+		return MakeNumberResult(poissonPMF(x, lambda))
+	}
+	// P(X <= x) is the regularized upper incomplete gamma function Q(x+1,lambda)
+	_, q := regIncGamma(x+1, lambda)
+	return MakeNumberResult(q)
+}
@@ -7,38 +7,150 @@
 
 package formula
 
+import "fmt"
+
 type FunctionCall struct {
 	name string
 	args []Expression
 }
 
 func NewFunction(name string, args []Expression) Expression {
+	switch name {
+	case "_xlfn.LET":
+		return NewLetExpr(args)
+	case "_xlfn.LAMBDA":
+		return NewLambdaExpr(args)
+	case "_xlfn.ANCHORARRAY":
+		// the spill range operator (e.g. A1#) is stored as ANCHORARRAY(A1)
+		if len(args) == 1 {
+			if e := anchorArray(args[0]); e != nil {
+				return e
+			}
+		}
+	}
 	return FunctionCall{name, args}
 }
 
 func (f FunctionCall) Eval(ctx Context, ev Evaluator) Result {
-	fn := LookupFunction(f.name)
-	if fn != nil {
-		args := make([]Result, len(f.args))
-		for i, a := range f.args {
-			args[i] = a.Eval(ctx, ev)
-			args[i].Ref = a.Reference(ctx, ev)
-		}
-		return fn(args)
-	}
-	fnx := LookupFunctionComplex(f.name)
-	if fnx != nil {
-		args := make([]Result, len(f.args))
-		for i, a := range f.args {
-			args[i] = a.Eval(ctx, ev)
-			args[i].Ref = a.Reference(ctx, ev)
+	reg := RegistryOf(ev)
+	fn, fnx := reg.lookup(f.name)
+	if fn != nil || fnx != nil {
+		if info, ok := reg.LookupFunctionInfo(f.name); ok {
+			if len(f.args) < info.MinArgs || (info.MaxArgs != UnlimitedArgs && len(f.args) > info.MaxArgs) {
+				return MakeErrorResult(fmt.Sprintf("%s called with %d arguments", f.name, len(f.args)))
+			}
+		}
+		var args []Result
+		if branch, ok := branchArgs[f.name]; ok && len(f.args) > 0 && !reg.overrides(f.name) {
+			args = evalBranch(ctx, ev, f.args, branch)
+		} else {
+			args = evalArgs(ctx, ev, f.args)
+		}
+		if fn != nil {
+			return fn(args)
 		}
 		return fnx(ctx, ev, args)
 	}
+	// a name assigned a LAMBDA function can be called like a function
+	if l, ok := lookupLambda(ctx, ev, f.name); ok {
+		return l.Call(ctx, ev, evalArgs(ctx, ev, f.args))
+	}
 
 	return MakeErrorResult("unknown function " + f.name)
 }
 
+// evalArgs evaluates the arguments of a function.
+func evalArgs(ctx Context, ev Evaluator, exprs []Expression) []Result {
+	args := make([]Result, len(exprs))
+	for i, a := range exprs {
+		args[i] = a.Eval(ctx, ev)
+		args[i].Ref = a.Reference(ctx, ev)
+	}
+	return args
+}
+
+// branchArgs are the functions that choose one of their arguments by the
+// value of the first.  They return the index of the chosen argument, zero if
+// only the first argument is needed or -1 if all of them are.  Only the
+// arguments that are needed are evaluated, so that the branch of an IF that
+// ends a recursive LAMBDA function isn't evaluated along with the one that
+// recurses.
+var branchArgs = map[string]func(first Result) int{
+	"IF": func(first Result) int {
+		switch first.Type {
+		case ResultTypeNumber, ResultTypeBool:
+			if first.ValueNumber != 0 {
+				return 1
+			}
+			return 2
+		case ResultTypeEmpty:
+			return 2
+		}
+		return 0
+	},
+	"IFERROR": func(first Result) int {
+		if first.Type == ResultTypeError {
+			return 1
+		}
+		return 0
+	},
+	"_xlfn.IFNA": func(first Result) int {
+		if first.Type == ResultTypeError && first.ErrorType == ErrorTypeNA {
+			return 1
+		}
+		return 0
+	},
+	"CHOOSE": func(first Result) int {
+		idx := first.AsNumber()
+		switch idx.Type {
+		case ResultTypeNumber:
+			if idx.ValueNumber < 1 {
+				return 0
+			}
+			return int(idx.ValueNumber)
+		case ResultTypeError:
+			return 0
+		}
+		return -1
+	},
+}
+
+// evalBranch evaluates the first argument of a function and the argument that
+// it chooses, leaving the others empty.
+func evalBranch(ctx Context, ev Evaluator, exprs []Expression, branch func(first Result) int) []Result {
+	first := evalArgs(ctx, ev, exprs[:1])[0]
+	i := branch(first)
+	if i == -1 {
+		return append([]Result{first}, evalArgs(ctx, ev, exprs[1:])...)
+	}
+	args := make([]Result, len(exprs))
+	args[0] = first
+	for j := 1; j < len(args); j++ {
+		if j == i {
+			args[j] = evalArgs(ctx, ev, exprs[j:j+1])[0]
+		} else {
+			args[j] = MakeEmptyResult()
+		}
+	}
+	return args
+}
+
 func (f FunctionCall) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
+
+func (f FunctionCall) References() []Reference {
+	ret := []Reference{}
+	for _, a := range f.args {
+		ret = append(ret, a.References()...)
+	}
+	return ret
+}
+
+func (f FunctionCall) String() string {
+	return f.name + "(" + joinStrings(f.args, ",") + ")"
+}
+
+func (f FunctionCall) Update(q *UpdateQuery) Expression {
+	return FunctionCall{f.name, updateAll(f.args, q)}
+}
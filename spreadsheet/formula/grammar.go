@@ -30,25 +30,27 @@ const tokenErrorRef = 57355
 const tokenSheet = 57356
 const tokenCell = 57357
 const tokenFunctionBuiltin = 57358
-const tokenLBrace = 57359
-const tokenRBrace = 57360
-const tokenLParen = 57361
-const tokenRParen = 57362
-const tokenPlus = 57363
-const tokenMinus = 57364
-const tokenMult = 57365
-const tokenDiv = 57366
-const tokenExp = 57367
-const tokenEQ = 57368
-const tokenLT = 57369
-const tokenGT = 57370
-const tokenLEQ = 57371
-const tokenGEQ = 57372
-const tokenNE = 57373
-const tokenColon = 57374
-const tokenComma = 57375
-const tokenAmpersand = 57376
-const tokenSemi = 57377
+const tokenStructuredRef = 57359
+const tokenSpillRef = 57360
+const tokenLBrace = 57361
+const tokenRBrace = 57362
+const tokenLParen = 57363
+const tokenRParen = 57364
+const tokenPlus = 57365
+const tokenMinus = 57366
+const tokenMult = 57367
+const tokenDiv = 57368
+const tokenExp = 57369
+const tokenEQ = 57370
+const tokenLT = 57371
+const tokenGT = 57372
+const tokenLEQ = 57373
+const tokenGEQ = 57374
+const tokenNE = 57375
+const tokenColon = 57376
+const tokenComma = 57377
+const tokenAmpersand = 57378
+const tokenSemi = 57379
 
 var yyToknames = [...]string{
 	"$end",
@@ -67,6 +69,8 @@ var yyToknames = [...]string{
 	"tokenSheet",
 	"tokenCell",
 	"tokenFunctionBuiltin",
+	"tokenStructuredRef",
+	"tokenSpillRef",
 	"tokenLBrace",
 	"tokenRBrace",
 	"tokenLParen",
@@ -87,13 +91,14 @@ var yyToknames = [...]string{
 	"tokenAmpersand",
 	"tokenSemi",
 }
+
 var yyStatenames = [...]string{}
 
 const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-var yyExca = [...]int{
+var yyExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
@@ -101,95 +106,104 @@ var yyExca = [...]int{
 
 const yyPrivate = 57344
 
-const yyLast = 179
-
-var yyAct = [...]int{
-
-	43, 3, 42, 30, 18, 38, 68, 44, 45, 28,
-	29, 30, 37, 46, 47, 30, 50, 41, 24, 13,
-	37, 19, 66, 52, 48, 23, 21, 53, 54, 55,
-	56, 57, 58, 59, 60, 61, 62, 63, 64, 67,
-	51, 65, 76, 11, 9, 1, 20, 10, 2, 8,
-	73, 71, 70, 26, 27, 28, 29, 30, 35, 31,
-	32, 33, 34, 36, 72, 0, 37, 0, 0, 75,
-	74, 0, 0, 77, 69, 26, 27, 28, 29, 30,
-	35, 31, 32, 33, 34, 36, 0, 0, 37, 26,
-	27, 28, 29, 30, 35, 31, 32, 33, 34, 36,
-	0, 0, 37, 26, 27, 28, 29, 30, 0, 0,
-	0, 24, 14, 15, 16, 17, 37, 25, 23, 22,
-	39, 0, 12, 0, 6, 7, 0, 0, 0, 40,
-	24, 14, 15, 16, 17, 0, 25, 23, 22, 5,
-	0, 12, 0, 6, 7, 0, 0, 0, 4, 24,
-	14, 15, 16, 17, 0, 25, 23, 22, 39, 0,
-	12, 49, 6, 7, 24, 14, 15, 16, 17, 0,
-	25, 23, 22, 39, 0, 12, 0, 6, 7,
+const yyLast = 217
+
+var yyAct = [...]int8{
+	46, 3, 54, 78, 45, 41, 71, 47, 48, 87,
+	73, 50, 76, 49, 29, 30, 31, 32, 33, 33,
+	83, 19, 77, 72, 57, 77, 44, 40, 13, 20,
+	58, 59, 60, 61, 62, 63, 64, 65, 66, 67,
+	68, 69, 51, 80, 70, 22, 29, 30, 31, 32,
+	33, 38, 34, 35, 36, 37, 39, 79, 21, 40,
+	29, 30, 31, 32, 33, 38, 34, 35, 36, 37,
+	39, 55, 75, 40, 82, 11, 9, 81, 79, 52,
+	1, 84, 10, 2, 57, 8, 86, 25, 14, 15,
+	16, 17, 18, 28, 24, 23, 26, 27, 42, 0,
+	12, 85, 6, 7, 29, 30, 31, 32, 33, 31,
+	32, 33, 0, 0, 56, 25, 14, 15, 16, 17,
+	18, 28, 24, 23, 26, 27, 42, 25, 12, 53,
+	6, 7, 0, 0, 24, 0, 26, 27, 0, 0,
+	0, 0, 56, 74, 29, 30, 31, 32, 33, 38,
+	34, 35, 36, 37, 39, 0, 0, 40, 25, 14,
+	15, 16, 17, 18, 28, 24, 23, 26, 27, 42,
+	0, 12, 0, 6, 7, 0, 0, 0, 43, 25,
+	14, 15, 16, 17, 18, 28, 24, 23, 26, 27,
+	5, 0, 12, 0, 6, 7, 0, 0, 0, 4,
+	25, 14, 15, 16, 17, 18, 28, 24, 23, 26,
+	27, 42, 0, 12, 0, 6, 7,
 }
-var yyPact = [...]int{
-
-	122, -1000, -1000, 68, 156, 103, 156, 156, -1000, -1000,
-	-1000, -1000, 156, -1000, -1000, -1000, -1000, -1000, -18, 10,
-	-1000, -1000, 141, -1000, -1000, -1000, 156, 156, 156, 156,
-	156, 156, 156, 156, 156, 156, 156, 156, 68, 156,
-	156, 4, -27, 68, -14, -14, 54, 10, -1000, -1000,
-	31, -1000, 68, -14, -14, -22, -22, -1000, 82, 82,
-	82, 82, 82, 82, -10, 32, -1000, 156, 156, -1000,
-	-1000, -1000, 156, -1000, -27, 68, -1000, 68,
+
+var yyPact = [...]int16{
+	171, -1000, -1000, 37, 192, 150, 192, 192, -1000, -1000,
+	-1000, -1000, 192, -1000, -1000, -1000, -1000, -1000, -1000, -23,
+	119, -1000, -1000, 107, -1000, -1000, -1000, -1000, -1000, 192,
+	192, 192, 192, 192, 192, 192, 192, 192, 192, 192,
+	192, 37, 192, 192, -14, -25, 37, 84, 84, 121,
+	119, -23, -1000, -1000, -10, -1000, 192, 37, 84, 84,
+	-8, -8, -1000, -9, -9, -9, -9, -9, -9, 81,
+	23, -1000, 192, 192, -1000, -1000, -1, 192, -1000, 37,
+	-1000, -25, 37, 79, -1000, -1000, -13, -1000,
 }
-var yyPgo = [...]int{
 
-	0, 0, 49, 48, 47, 4, 46, 45, 44, 43,
-	42, 40, 26, 21, 19, 17, 16, 2,
+var yyPgo = [...]int8{
+	0, 0, 85, 83, 82, 21, 58, 80, 76, 75,
+	3, 71, 45, 29, 28, 26, 2, 4,
 }
-var yyR1 = [...]int{
 
-	0, 7, 3, 3, 3, 8, 8, 8, 8, 1,
-	1, 1, 2, 2, 2, 2, 2, 14, 15, 15,
-	17, 17, 4, 4, 4, 13, 5, 5, 6, 12,
-	12, 12, 12, 12, 12, 12, 12, 12, 12, 12,
-	12, 9, 9, 9, 16, 16, 11, 10, 10,
+var yyR1 = [...]int8{
+	0, 7, 3, 3, 3, 8, 8, 8, 8, 8,
+	1, 1, 1, 2, 2, 2, 2, 2, 14, 15,
+	15, 17, 17, 4, 4, 4, 4, 13, 5, 5,
+	5, 5, 6, 12, 12, 12, 12, 12, 12, 12,
+	12, 12, 12, 12, 12, 9, 9, 9, 9, 9,
+	16, 16, 16, 11, 10, 10,
 }
-var yyR2 = [...]int{
 
-	0, 1, 1, 2, 4, 1, 1, 1, 1, 2,
-	2, 1, 1, 1, 1, 3, 1, 3, 1, 3,
-	1, 3, 1, 2, 1, 1, 1, 1, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 1, 2, 3, 1, 3, 1, 1, 0,
+var yyR2 = [...]int8{
+	0, 1, 1, 2, 4, 1, 1, 1, 1, 1,
+	2, 2, 1, 1, 1, 1, 3, 1, 3, 1,
+	3, 1, 3, 1, 2, 2, 1, 1, 1, 1,
+	1, 1, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 1, 2, 3, 5, 6,
+	1, 2, 3, 1, 1, 0,
 }
-var yyChk = [...]int{
-
-	-1000, -7, -3, -1, 26, 17, 21, 22, -2, -8,
-	-4, -9, 19, -14, 9, 10, 11, 12, -5, -13,
-	-6, -12, 16, 15, 8, 14, 21, 22, 23, 24,
-	25, 27, 28, 29, 30, 26, 31, 34, -1, 17,
-	26, -15, -17, -1, -1, -1, -1, 32, -5, 20,
-	-16, -11, -1, -1, -1, -1, -1, -1, -1, -1,
-	-1, -1, -1, -1, -1, -1, 18, 35, 33, 20,
-	-5, 20, 33, 18, -17, -1, -10, -1,
+
+var yyChk = [...]int16{
+	-1000, -7, -3, -1, 28, 19, 23, 24, -2, -8,
+	-4, -9, 21, -14, 9, 10, 11, 12, 13, -5,
+	-13, -6, -12, 16, 15, 8, 17, 18, 14, 23,
+	24, 25, 26, 27, 29, 30, 31, 32, 28, 33,
+	36, -1, 19, 28, -15, -17, -1, -1, -1, -1,
+	34, -5, -6, 22, -16, -11, 35, -1, -1, -1,
+	-1, -1, -1, -1, -1, -1, -1, -1, -1, -1,
+	-1, 20, 37, 35, 22, -5, 22, 35, -10, -1,
+	20, -17, -1, 21, -10, 22, -16, 22,
 }
-var yyDef = [...]int{
-
-	0, -2, 1, 2, 0, 0, 0, 0, 11, 12,
-	13, 14, 0, 16, 5, 6, 7, 8, 22, 0,
-	24, 41, 0, 26, 27, 25, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 3, 0,
-	0, 0, 18, 20, 9, 10, 0, 0, 23, 42,
-	0, 44, 46, 29, 30, 31, 32, 33, 34, 35,
-	36, 37, 38, 39, 40, 0, 17, 0, 0, 15,
-	28, 43, 48, 4, 19, 21, 45, 47,
+
+var yyDef = [...]int8{
+	0, -2, 1, 2, 0, 0, 0, 0, 12, 13,
+	14, 15, 0, 17, 5, 6, 7, 8, 9, 23,
+	0, 26, 45, 0, 28, 29, 30, 31, 27, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 3, 0, 0, 0, 19, 21, 10, 11, 0,
+	0, 24, 25, 46, 0, 50, 55, 53, 33, 34,
+	35, 36, 37, 38, 39, 40, 41, 42, 43, 44,
+	0, 18, 0, 0, 16, 32, 47, 55, 51, 54,
+	4, 20, 22, 0, 52, 48, 0, 49,
 }
-var yyTok1 = [...]int{
 
+var yyTok1 = [...]int8{
 	1,
 }
-var yyTok2 = [...]int{
 
+var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
-	32, 33, 34, 35,
+	32, 33, 34, 35, 36, 37,
 }
-var yyTok3 = [...]int{
+
+var yyTok3 = [...]int8{
 	0,
 }
 
@@ -269,9 +283,9 @@ func yyErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := yyPact[state]
+	base := int(yyPact[state])
 	for tok := TOKSTART; tok-1 < len(yyToknames); tok++ {
-		if n := base + tok; n >= 0 && n < yyLast && yyChk[yyAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < yyLast && int(yyChk[int(yyAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -281,13 +295,13 @@ func yyErrorMessage(state, lookAhead int) string {
 
 	if yyDef[state] == -2 {
 		i := 0
-		for yyExca[i] != -1 || yyExca[i+1] != state {
+		for yyExca[i] != -1 || int(yyExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; yyExca[i] >= 0; i += 2 {
-			tok := yyExca[i]
+			tok := int(yyExca[i])
 			if tok < TOKSTART || yyExca[i+1] == 0 {
 				continue
 			}
@@ -318,30 +332,30 @@ func yylex1(lex yyLexer, lval *yySymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = yyTok1[0]
+		token = int(yyTok1[0])
 		goto out
 	}
 	if char < len(yyTok1) {
-		token = yyTok1[char]
+		token = int(yyTok1[char])
 		goto out
 	}
 	if char >= yyPrivate {
 		if char < yyPrivate+len(yyTok2) {
-			token = yyTok2[char-yyPrivate]
+			token = int(yyTok2[char-yyPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(yyTok3); i += 2 {
-		token = yyTok3[i+0]
+		token = int(yyTok3[i+0])
 		if token == char {
-			token = yyTok3[i+1]
+			token = int(yyTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = yyTok2[1] /* unknown char */
+		token = int(yyTok2[1]) /* unknown char */
 	}
 	if yyDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(token), uint(char))
@@ -396,7 +410,7 @@ yystack:
 	yyS[yyp].yys = yystate
 
 yynewstate:
-	yyn = yyPact[yystate]
+	yyn = int(yyPact[yystate])
 	if yyn <= yyFlag {
 		goto yydefault /* simple state */
 	}
@@ -407,8 +421,8 @@ yynewstate:
 	if yyn < 0 || yyn >= yyLast {
 		goto yydefault
 	}
-	yyn = yyAct[yyn]
-	if yyChk[yyn] == yytoken { /* valid shift */
+	yyn = int(yyAct[yyn])
+	if int(yyChk[yyn]) == yytoken { /* valid shift */
 		yyrcvr.char = -1
 		yytoken = -1
 		yyVAL = yyrcvr.lval
@@ -421,7 +435,7 @@ yynewstate:
 
 yydefault:
 	/* default state action */
-	yyn = yyDef[yystate]
+	yyn = int(yyDef[yystate])
 	if yyn == -2 {
 		if yyrcvr.char < 0 {
 			yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
@@ -430,18 +444,18 @@ yydefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if yyExca[xi+0] == -1 && yyExca[xi+1] == yystate {
+			if yyExca[xi+0] == -1 && int(yyExca[xi+1]) == yystate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			yyn = yyExca[xi+0]
+			yyn = int(yyExca[xi+0])
 			if yyn < 0 || yyn == yytoken {
 				break
 			}
 		}
-		yyn = yyExca[xi+1]
+		yyn = int(yyExca[xi+1])
 		if yyn < 0 {
 			goto ret0
 		}
@@ -463,10 +477,10 @@ yydefault:
 
 			/* find a state where "error" is a legal shift action */
 			for yyp >= 0 {
-				yyn = yyPact[yyS[yyp].yys] + yyErrCode
+				yyn = int(yyPact[yyS[yyp].yys]) + yyErrCode
 				if yyn >= 0 && yyn < yyLast {
-					yystate = yyAct[yyn] /* simulate a shift of "error" */
-					if yyChk[yystate] == yyErrCode {
+					yystate = int(yyAct[yyn]) /* simulate a shift of "error" */
+					if int(yyChk[yystate]) == yyErrCode {
 						goto yystack
 					}
 				}
@@ -502,7 +516,7 @@ yydefault:
 	yypt := yyp
 	_ = yypt // guard against "declared and not used"
 
-	yyp -= yyR2[yyn]
+	yyp -= int(yyR2[yyn])
 	// yyp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if yyp+1 >= len(yyS) {
@@ -513,16 +527,16 @@ yydefault:
 	yyVAL = yyS[yyp+1]
 
 	/* consult goto table to find next state */
-	yyn = yyR1[yyn]
-	yyg := yyPgo[yyn]
+	yyn = int(yyR1[yyn])
+	yyg := int(yyPgo[yyn])
 	yyj := yyg + yyS[yyp].yys + 1
 
 	if yyj >= yyLast {
-		yystate = yyAct[yyg]
+		yystate = int(yyAct[yyg])
 	} else {
-		yystate = yyAct[yyj]
-		if yyChk[yystate] != -yyn {
-			yystate = yyAct[yyg]
+		yystate = int(yyAct[yyj])
+		if int(yyChk[yystate]) != -yyn {
+			yystate = int(yyAct[yyg])
 		}
 	}
 	// dummy call; replaced with literal code
@@ -563,151 +577,186 @@ yydefault:
 			yyVAL.expr = NewError(yyDollar[1].node.val)
 		}
 	case 9:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.expr = NewError(yyDollar[1].node.val)
+		}
+	case 10:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 10:
+	case 11:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.expr = NewNegate(yyDollar[2].expr)
 		}
-	case 15:
+	case 16:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 17:
+	case 18:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewConstArrayExpr(yyDollar[2].rows)
 		}
-	case 18:
+	case 19:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.rows = append(yyVAL.rows, yyDollar[1].args)
 		}
-	case 19:
+	case 20:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.rows = append(yyDollar[1].rows, yyDollar[3].args)
 		}
-	case 20:
+	case 21:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.args = append(yyVAL.args, yyDollar[1].expr)
 		}
-	case 21:
+	case 22:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.args = append(yyDollar[1].args, yyDollar[3].expr)
 		}
-	case 23:
+	case 24:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.expr = NewPrefixExpr(yyDollar[1].expr, yyDollar[2].expr)
 		}
 	case 25:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.expr = NewPrefixExpr(yyDollar[1].expr, yyDollar[2].expr)
+		}
+	case 27:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.expr = NewSheetPrefixExpr(yyDollar[1].node.val)
 		}
-	case 26:
+	case 28:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.expr = NewCellRef(yyDollar[1].node.val)
 		}
-	case 27:
+	case 29:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.expr = NewNamedRangeRef(yyDollar[1].node.val)
 		}
-	case 28:
+	case 30:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.expr = NewStructuredRef(yyDollar[1].node.val)
+		}
+	case 31:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.expr = NewSpillRef(yyDollar[1].node.val)
+		}
+	case 32:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewRange(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 29:
+	case 33:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypePlus, yyDollar[3].expr)
 		}
-	case 30:
+	case 34:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeMinus, yyDollar[3].expr)
 		}
-	case 31:
+	case 35:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeMult, yyDollar[3].expr)
 		}
-	case 32:
+	case 36:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeDiv, yyDollar[3].expr)
 		}
-	case 33:
+	case 37:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeExp, yyDollar[3].expr)
 		}
-	case 34:
+	case 38:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeLT, yyDollar[3].expr)
 		}
-	case 35:
+	case 39:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeGT, yyDollar[3].expr)
 		}
-	case 36:
+	case 40:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeLEQ, yyDollar[3].expr)
 		}
-	case 37:
+	case 41:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeGEQ, yyDollar[3].expr)
 		}
-	case 38:
+	case 42:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeEQ, yyDollar[3].expr)
 		}
-	case 39:
+	case 43:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeNE, yyDollar[3].expr)
 		}
-	case 40:
+	case 44:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewBinaryExpr(yyDollar[1].expr, BinOpTypeConcat, yyDollar[3].expr)
 		}
-	case 42:
+	case 46:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.expr = NewFunction(yyDollar[1].node.val, nil)
 		}
-	case 43:
+	case 47:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.expr = NewFunction(yyDollar[1].node.val, yyDollar[2].args)
 		}
-	case 44:
+	case 48:
+		yyDollar = yyS[yypt-5 : yypt+1]
+		{
+			yyVAL.expr = NewLambdaCall(NewFunction(yyDollar[1].node.val, yyDollar[2].args), nil)
+		}
+	case 49:
+		yyDollar = yyS[yypt-6 : yypt+1]
+		{
+			yyVAL.expr = NewLambdaCall(NewFunction(yyDollar[1].node.val, yyDollar[2].args), yyDollar[5].args)
+		}
+	case 50:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.args = append(yyVAL.args, yyDollar[1].expr)
 		}
-	case 45:
+	case 51:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.args = append(yyVAL.args, NewEmptyExpr(), yyDollar[2].expr)
+		}
+	case 52:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.args = append(yyDollar[1].args, yyDollar[3].expr)
 		}
-	case 48:
+	case 55:
 		yyDollar = yyS[yypt-0 : yypt+1]
 		{
 			yyVAL.expr = NewEmptyExpr()
@@ -25,16 +25,16 @@ package formula
 
 %token <node> tokenHorizontalRange tokenReservedName tokenDDECall  tokenLexError tokenNamedRange
 %token <node> tokenBool tokenNumber tokenString tokenError tokenErrorRef  tokenSheet tokenCell
-%token <node> tokenFunctionBuiltin 
+%token <node> tokenFunctionBuiltin tokenStructuredRef tokenSpillRef
 
 %token tokenLBrace tokenRBrace tokenLParen tokenRParen
 %token tokenPlus tokenMinus tokenMult tokenDiv tokenExp tokenEQ tokenLT tokenGT tokenLEQ tokenGEQ  tokenNE 
 %token tokenColon tokenComma tokenAmpersand tokenSemi
 
 %left tokenEQ tokenLT tokenGT tokenLEQ tokenGEQ  tokenNE
+%left tokenAmpersand
 %left tokenPlus tokenMinus
 %left tokenMult tokenDiv
-%left tokenAmpersand
 %left tokenExp
 
 %%
@@ -51,6 +51,7 @@ constant:
 	| tokenNumber { $$ = NewNumber($1.val) } 
 	| tokenString { $$ = NewString($1.val) } 
 	| tokenError { $$ = NewError($1.val) } 
+	| tokenErrorRef { $$ = NewError($1.val) } 
 
 formula: 
 	  tokenPlus formula { $$ = $2; } 
@@ -79,6 +80,7 @@ constArrayCols:
 reference: 
 	  referenceItem
     | prefix referenceItem { $$ = NewPrefixExpr($1,$2)}
+    | prefix refFunctionCall { $$ = NewPrefixExpr($1,$2)}
 	| refFunctionCall;
 
 prefix: tokenSheet { $$ = NewSheetPrefixExpr($1.val) };
@@ -86,6 +88,8 @@ prefix: tokenSheet { $$ = NewSheetPrefixExpr($1.val) };
 referenceItem: 
 	  tokenCell { $$ = NewCellRef($1.val)}
 	| tokenNamedRange { $$ = NewNamedRangeRef($1.val)}
+	| tokenStructuredRef { $$ = NewStructuredRef($1.val)}
+	| tokenSpillRef { $$ = NewSpillRef($1.val)}
 	;
 
 refFunctionCall:
@@ -111,9 +115,12 @@ functionCall:
 	  binOp;
 	| tokenFunctionBuiltin tokenRParen { $$ = NewFunction($1.val,nil)} ;
 	| tokenFunctionBuiltin arguments tokenRParen { $$ = NewFunction($1.val,$2)} ;
+	| tokenFunctionBuiltin arguments tokenRParen tokenLParen tokenRParen { $$ = NewLambdaCall(NewFunction($1.val,$2),nil)} ;
+	| tokenFunctionBuiltin arguments tokenRParen tokenLParen arguments tokenRParen { $$ = NewLambdaCall(NewFunction($1.val,$2),$5)} ;
 
 arguments: 
 	  argument1{ $$ = append($$, $1)  }
+	| tokenComma argument { $$ = append($$, NewEmptyExpr(), $2) }
 	| arguments tokenComma argument { $$ = append($1,$3) }
 	;
 
@@ -7,6 +7,8 @@
 
 package formula
 
+import "time"
+
 // InvalidReferenceContext is a Context that can be used when evaluating an
 // invalid reference (e.g. referencing a non-existent sheet).  It implements
 // Context safely, but returns error results.
@@ -23,6 +25,22 @@ func (i *ivr) NamedRange(ref string) Reference {
 	return ReferenceInvalid
 }
 
+func (i *ivr) Table(name string) (Table, bool) {
+	return Table{}, false
+}
+
+func (i *ivr) Spill(ref string, ev Evaluator) Result {
+	return MakeErrorResultType(ErrorTypeRef, "invalid reference")
+}
+
+func (i *ivr) CurrentCell() string {
+	return ""
+}
+
+func (i *ivr) Formula(ref string) string {
+	return ""
+}
+
 func (i *ivr) Sheet(name string) Context {
 	return i
 }
@@ -30,3 +48,7 @@ func (i *ivr) Sheet(name string) Context {
 func (i *ivr) SetOffset(col, row uint32) {
 
 }
+
+func (i *ivr) GetEpoch() time.Time {
+	return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+}
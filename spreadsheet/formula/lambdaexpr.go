@@ -0,0 +1,160 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import "fmt"
+
+// LambdaExpr is a call to the LAMBDA function, which creates a function from
+// parameter names and a calculation (e.g. LAMBDA(_xlpm.x,_xlpm.x*0.2)).  The
+// calculation isn't evaluated until the function is called.
+type LambdaExpr struct {
+	args []Expression
+}
+
+// NewLambdaExpr constructs a new LAMBDA expression from the function
+// arguments.
+func NewLambdaExpr(args []Expression) Expression {
+	return LambdaExpr{args}
+}
+
+// Eval returns the function, which can be assigned to a name or passed to
+// functions such as MAP.
+func (l LambdaExpr) Eval(ctx Context, ev Evaluator) Result {
+	if len(l.args) == 0 {
+		return MakeErrorResult("LAMBDA requires at least one argument")
+	}
+	params := make([]string, len(l.args)-1)
+	for i, a := range l.args[:len(l.args)-1] {
+		name, ok := a.(NamedRangeRef)
+		if !ok {
+			return MakeErrorResult("LAMBDA parameters must be names")
+		}
+		params[i] = name.s
+	}
+	return MakeLambdaResult(&Lambda{params: params, body: l.args[len(l.args)-1], ctx: ctx})
+}
+
+func (l LambdaExpr) Reference(ctx Context, ev Evaluator) Reference {
+	return ReferenceInvalid
+}
+
+func (l LambdaExpr) String() string {
+	return "_xlfn.LAMBDA(" + joinStrings(l.args, ",") + ")"
+}
+
+func (l LambdaExpr) Update(q *UpdateQuery) Expression {
+	return NewLambdaExpr(updateAll(l.args, q))
+}
+
+func (l LambdaExpr) References() []Reference {
+	ret := []Reference{}
+	for _, a := range l.args {
+		ret = append(ret, a.References()...)
+	}
+	return ret
+}
+
+// Lambda is a function created by LAMBDA.  It's evaluated in the context it
+// was created in, with its parameters bound to the arguments it's called with.
+type Lambda struct {
+	params []string
+	body   Expression
+	ctx    Context
+}
+
+// Params returns the number of parameters the function accepts.
+func (l *Lambda) Params() int {
+	return len(l.params)
+}
+
+// maxLambdaDepth is the number of nested LAMBDA calls after which a recursive
+// function fails with a #NUM! error rather than exhausting the stack.
+const maxLambdaDepth = 1024
+
+// Call evaluates the function with the given arguments, where ctx is the
+// context it's called from.
+func (l *Lambda) Call(ctx Context, ev Evaluator, args []Result) Result {
+	if len(args) != len(l.params) {
+		return MakeErrorResult(fmt.Sprintf("LAMBDA requires %d arguments, got %d", len(l.params), len(args)))
+	}
+	scope := newScopeContext(l.ctx)
+	scope.depth = scopeDepth(ctx) + 1
+	if scope.depth > maxLambdaDepth {
+		return MakeErrorResultType(ErrorTypeNum, "LAMBDA recursion is too deep")
+	}
+	for i, p := range l.params {
+		scope.bind(p, args[i], args[i].Ref)
+	}
+	return l.body.Eval(scope, ev)
+}
+
+// LambdaCall is a call to the function that an expression returns, such as a
+// LAMBDA that's called immediately (e.g. LAMBDA(_xlpm.x,_xlpm.x+1)(5)).
+type LambdaCall struct {
+	fn   Expression
+	args []Expression
+}
+
+// NewLambdaCall constructs a new call to the function returned by fn.
+func NewLambdaCall(fn Expression, args []Expression) Expression {
+	return LambdaCall{fn, args}
+}
+
+func (c LambdaCall) Eval(ctx Context, ev Evaluator) Result {
+	res := c.fn.Eval(ctx, ev)
+	switch res.Type {
+	case ResultTypeError:
+		return res
+	case ResultTypeLambda:
+	default:
+		return MakeErrorResult("only a LAMBDA function can be called")
+	}
+	return res.ValueLambda.Call(ctx, ev, evalArgs(ctx, ev, c.args))
+}
+
+func (c LambdaCall) Reference(ctx Context, ev Evaluator) Reference {
+	return ReferenceInvalid
+}
+
+func (c LambdaCall) String() string {
+	return c.fn.String() + "(" + joinStrings(c.args, ",") + ")"
+}
+
+func (c LambdaCall) Update(q *UpdateQuery) Expression {
+	return NewLambdaCall(c.fn.Update(q), updateAll(c.args, q))
+}
+
+func (c LambdaCall) References() []Reference {
+	ret := c.fn.References()
+	for _, a := range c.args {
+		ret = append(ret, a.References()...)
+	}
+	return ret
+}
+
+// lookupLambda returns the function assigned to a name, either by LET or
+// LAMBDA, or as a defined name in the workbook.
+func lookupLambda(ctx Context, ev Evaluator, name string) (*Lambda, bool) {
+	var res Result
+	if v, ok := lookupName(ctx, name); ok {
+		res = v.res
+	} else {
+		// defined names don't see the names bound where they're called
+		if sc, ok := ctx.(*scopeContext); ok {
+			ctx = sc.Context
+		}
+		if ref := ctx.NamedRange(name); ref.Type == ReferenceTypeInvalid {
+			return nil, false
+		}
+		res = NamedRangeRef{name}.Eval(ctx, ev)
+	}
+	if res.Type != ResultTypeLambda {
+		return nil, false
+	}
+	return res.ValueLambda, true
+}
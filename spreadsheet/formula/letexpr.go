@@ -0,0 +1,116 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import "strings"
+
+// LetExpr is a call to the LET function, which assigns names to the results of
+// calculations (e.g. LET(_xlpm.x,A1*2,_xlpm.x+1)).  It isn't a FunctionCall as
+// the names must be bound before the remaining arguments are evaluated.
+type LetExpr struct {
+	args []Expression
+}
+
+// NewLetExpr constructs a new LET expression from the function arguments.
+func NewLetExpr(args []Expression) Expression {
+	return LetExpr{args}
+}
+
+// Eval evaluates the calculation, the last argument, with each name bound to
+// the result of the argument that follows it.
+func (l LetExpr) Eval(ctx Context, ev Evaluator) Result {
+	if len(l.args) < 3 || len(l.args)%2 == 0 {
+		return MakeErrorResult("LET requires name/value pairs followed by a calculation")
+	}
+	scope := newScopeContext(ctx)
+	for i := 0; i < len(l.args)-1; i += 2 {
+		name, ok := l.args[i].(NamedRangeRef)
+		if !ok {
+			return MakeErrorResult("LET requires names to be assigned to values")
+		}
+		v := l.args[i+1]
+		scope.bind(name.s, v.Eval(scope, ev), v.Reference(scope, ev))
+	}
+	return l.args[len(l.args)-1].Eval(scope, ev)
+}
+
+func (l LetExpr) Reference(ctx Context, ev Evaluator) Reference {
+	return ReferenceInvalid
+}
+
+func (l LetExpr) References() []Reference {
+	ret := []Reference{}
+	for _, a := range l.args {
+		ret = append(ret, a.References()...)
+	}
+	return ret
+}
+
+// scopeContext is an evaluation context with names bound to values, such as
+// the names assigned by LET.  Everything else is passed through to the
+// enclosing context.
+type scopeContext struct {
+	Context
+	names map[string]scopeValue
+	// depth is the number of LAMBDA calls that the scope is nested in
+	depth int
+}
+
+type scopeValue struct {
+	res Result
+	ref Reference
+}
+
+// newScopeContext returns a context that inherits the names bound in ctx.
+func newScopeContext(ctx Context) *scopeContext {
+	sc := &scopeContext{Context: ctx, names: map[string]scopeValue{}}
+	if parent, ok := ctx.(*scopeContext); ok {
+		sc.Context = parent.Context
+		sc.depth = parent.depth
+		for k, v := range parent.names {
+			sc.names[k] = v
+		}
+	}
+	return sc
+}
+
+func (s *scopeContext) bind(name string, res Result, ref Reference) {
+	s.names[scopeName(name)] = scopeValue{res, ref}
+}
+
+// scopeName normalizes a name as names are case insensitive, and are stored
+// with an _xlpm. prefix.
+func scopeName(name string) string {
+	return strings.ToUpper(strings.TrimPrefix(name, "_xlpm."))
+}
+
+// scopeDepth returns the number of LAMBDA calls that a context is nested in.
+func scopeDepth(ctx Context) int {
+	if sc, ok := ctx.(*scopeContext); ok {
+		return sc.depth
+	}
+	return 0
+}
+
+// lookupName returns the value bound to a name in the context, if any.
+func lookupName(ctx Context, name string) (scopeValue, bool) {
+	sc, ok := ctx.(*scopeContext)
+	if !ok {
+		return scopeValue{}, false
+	}
+	v, ok := sc.names[scopeName(name)]
+	return v, ok
+}
+
+func (l LetExpr) String() string {
+	return "_xlfn.LET(" + joinStrings(l.args, ",") + ")"
+}
+
+func (l LetExpr) Update(q *UpdateQuery) Expression {
+	return NewLetExpr(updateAll(l.args, q))
+}
@@ -12,6 +12,7 @@ package formula
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 	"sync"
 )
@@ -54,10 +55,156 @@ func NewLexer() *Lexer {
 
 func LexReader(r io.Reader) chan *node {
 	l := NewLexer()
-	go l.lex(r)
+	go l.lexSplit(r)
 	return l.nodes
 }
 
+// lexSplit lexes a formula, emitting the tokens that the generated lexer can't
+// match itself: structured references (e.g. Table1[[#Totals],[Qty]]) as it
+// can't match their nested brackets, spill range references (e.g. A1#) and the
+// names of functions that aren't all upper case, such as those with lower case
+// prefixes (e.g. _xlfn._xlws.SORT) and LAMBDA functions assigned to names (e.g.
+// _xlpm.f or TaxCalc).  These are split out before the rest of the formula is
+// passed to the generated lexer.
+func (l *Lexer) lexSplit(r io.Reader) {
+	defer close(l.nodes)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		l.emit(tokenLexError, nil)
+		return
+	}
+	s := string(data)
+	pos := 0
+	for {
+		start, end, typ := findSplitToken(s, pos)
+		if start == -1 {
+			break
+		}
+		if start > pos {
+			l.lex(strings.NewReader(s[pos:start]))
+		}
+		switch typ {
+		case tokenSpillRef, tokenFunctionBuiltin:
+			// chop the trailing '#' or '('
+			l.emit(typ, data[start:end-1])
+		default:
+			l.emit(typ, data[start:end])
+		}
+		pos = end
+	}
+	if pos < len(s) {
+		l.lex(strings.NewReader(s[pos:]))
+	}
+}
+
+// findSplitToken returns the start, end and type of the first token in a
+// formula at or after pos that is split out before lexing, or -1 if there are
+// none.
+func findSplitToken(s string, pos int) (int, int, tokenType) {
+	for i := pos; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			// skip strings and quoted sheet names
+			q := s[i]
+			for i++; i < len(s); i++ {
+				if s[i] == q {
+					if i+1 < len(s) && s[i+1] == q {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case '[':
+			start := i
+			for start > pos && isTableNameChar(s[start-1]) {
+				start--
+			}
+			depth := 0
+			for j := i; j < len(s); j++ {
+				switch s[j] {
+				case '\'':
+					j++
+				case '[':
+					depth++
+				case ']':
+					depth--
+					if depth == 0 {
+						return start, j + 1, tokenStructuredRef
+					}
+				}
+			}
+			return -1, -1, tokenLexError
+		case '#':
+			if start := spillRefStart(s, pos, i); start != -1 {
+				return start, i + 1, tokenSpillRef
+			}
+		default:
+			if !isTableNameChar(s[i]) || (i > pos && isTableNameChar(s[i-1])) {
+				continue
+			}
+			j := i
+			for j < len(s) && isTableNameChar(s[j]) {
+				j++
+			}
+			if j < len(s) && s[j] == '(' && !isUpperName(s[i:j]) {
+				return i, j + 1, tokenFunctionBuiltin
+			}
+			i = j - 1
+		}
+	}
+	return -1, -1, tokenLexError
+}
+
+// spillRefStart returns the start of the cell reference before the '#' of a
+// spill range reference at s[i], or -1 if it isn't preceded by a cell
+// reference.
+func spillRefStart(s string, pos, i int) int {
+	j := i
+	for j > pos && s[j-1] >= '0' && s[j-1] <= '9' {
+		j--
+	}
+	if j == i {
+		return -1
+	}
+	if j > pos && s[j-1] == '$' {
+		j--
+	}
+	k := j
+	for j > pos && s[j-1] >= 'A' && s[j-1] <= 'Z' {
+		j--
+	}
+	if j == k {
+		return -1
+	}
+	if j > pos && s[j-1] == '$' {
+		j--
+	}
+	if j > pos && isTableNameChar(s[j-1]) {
+		return -1
+	}
+	return j
+}
+
+// isUpperName returns true if a function name is matched by the generated
+// lexer.
+func isUpperName(s string) bool {
+	if s == "" || s[0] < 'A' || s[0] > 'Z' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !(s[i] >= 'A' && s[i] <= 'Z' || s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func isTableNameChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '\\' || c >= 0x80
+}
+
 func (l *Lexer) emit(typ tokenType, val []byte) {
 	if debugLex {
 		fmt.Println("emit", typ, printable(string(val)))
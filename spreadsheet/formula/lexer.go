@@ -2610,6 +2610,11 @@ func (l *Lexer) lex(r io.Reader) {
 
 		// line 143 "lexer.rl"
 
+		if cs == formula_error {
+			// stop at the first character that can't be lexed rather than
+			// restarting the lexer on the rest of the input
+			break
+		}
 		if ts > 0 {
 			// currently parsing a token, so shift it to the
 			// beginning of the buffer
@@ -2621,5 +2626,4 @@ func (l *Lexer) lex(r io.Reader) {
 	if cs == formula_error {
 		l.emit(tokenLexError, nil)
 	}
-	close(l.nodes)
 }
@@ -142,6 +142,11 @@ for !done {
     write exec;
   }%%
   
+  if cs == formula_error {
+    // stop at the first character that can't be lexed rather than
+    // restarting the lexer on the rest of the input
+    break
+  }
   if ts > 0 {
       // currently parsing a token, so shift it to the
       // beginning of the buffer
@@ -153,5 +158,4 @@ for !done {
   if cs == formula_error {
      l.emit(tokenLexError,nil)
   }
-  close(l.nodes)
 }
@@ -10,6 +10,8 @@ package formula
 import (
 	"fmt"
 	"strings"
+
+	"github.com/unidoc/unioffice/spreadsheet/reference"
 )
 
 // NamedRangeRef is a reference to a named range
@@ -24,21 +26,53 @@ func NewNamedRangeRef(v string) Expression {
 
 // Eval evaluates and returns the result of the NamedRangeRef reference.
 func (n NamedRangeRef) Eval(ctx Context, ev Evaluator) Result {
+	if v, ok := lookupName(ctx, n.s); ok {
+		return v.res
+	}
 	ref := ctx.NamedRange(n.s)
 	switch ref.Type {
 	case ReferenceTypeCell:
 		return ev.Eval(ctx, ref.Value)
 	case ReferenceTypeRange:
-		// should look like "A2:C5"
-		sp := strings.Split(ref.Value, ":")
-		if len(sp) == 2 {
-			return resultFromCellRange(ctx, ev, sp[0], sp[1])
+		// should look like "A2:C5" or "'Sheet 1'!$A$2:$C$5"
+		sheetCtx, rng := ctx, ref.Value
+		if sheet, r, ok := reference.SplitSheetPrefix(ref.Value); ok {
+			sheetCtx, rng = ctx.Sheet(sheet), r
+		}
+		sp := strings.Split(rng, ":")
+		if len(sp) == 2 && isCellReference(sp[0]) && isCellReference(sp[1]) {
+			return resultFromCellRange(sheetCtx, ev, sp[0], sp[1])
+		}
+		if len(sp) == 1 && isCellReference(sp[0]) {
+			return sheetCtx.Cell(sp[0], ev)
 		}
-		return MakeErrorResult(fmt.Sprintf("unsuppported named range value %s", ref.Value))
+		// the name refers to a constant or formula
+		return ev.Eval(ctx, ref.Value)
 	}
 	return MakeErrorResult(fmt.Sprintf("unsuppported reference type %s", ref.Type))
 }
 
+func isCellReference(s string) bool {
+	_, _, err := ParseCellReference(s)
+	return err == nil
+}
+
 func (n NamedRangeRef) Reference(ctx Context, ev Evaluator) Reference {
+	if v, ok := lookupName(ctx, n.s); ok {
+		return v.ref
+	}
 	return Reference{Type: ReferenceTypeNamedRange, Value: n.s}
 }
+
+// References returns the named range referred to.
+func (n NamedRangeRef) References() []Reference {
+	return []Reference{{Type: ReferenceTypeNamedRange, Value: n.s}}
+}
+
+func (n NamedRangeRef) String() string {
+	return n.s
+}
+
+func (n NamedRangeRef) Update(q *UpdateQuery) Expression {
+	return n
+}
@@ -16,9 +16,12 @@ func NewNegate(e Expression) Expression {
 }
 
 func (n Negate) Eval(ctx Context, ev Evaluator) Result {
-	r := n.e.Eval(ctx, ev)
-	if r.Type == ResultTypeNumber {
+	r := n.e.Eval(ctx, ev).AsNumber()
+	switch r.Type {
+	case ResultTypeNumber:
 		return MakeNumberResult(-r.ValueNumber)
+	case ResultTypeError:
+		return r
 	}
 	return MakeErrorResult("NEGATE expected number argument")
 }
@@ -26,3 +29,18 @@ func (n Negate) Eval(ctx Context, ev Evaluator) Result {
 func (n Negate) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
+
+func (n Negate) References() []Reference {
+	return n.e.References()
+}
+
+func (n Negate) String() string {
+	if _, ok := n.e.(BinaryExpr); ok {
+		return "-(" + n.e.String() + ")"
+	}
+	return "-" + n.e.String()
+}
+
+func (n Negate) Update(q *UpdateQuery) Expression {
+	return NewNegate(n.e.Update(q))
+}
@@ -32,3 +32,15 @@ func (n Number) Eval(ctx Context, ev Evaluator) Result {
 func (n Number) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
+
+func (n Number) References() []Reference {
+	return nil
+}
+
+func (n Number) String() string {
+	return strconv.FormatFloat(n.v, 'f', -1, 64)
+}
+
+func (n Number) Update(q *UpdateQuery) Expression {
+	return n
+}
@@ -18,11 +18,19 @@ import (
 type plex struct {
 	nodes  chan *node
 	result Expression
+	// failed is true if the formula couldn't be parsed, as a result may
+	// already have been reduced from the start of the formula
+	failed bool
+}
+
+func init() {
+	// set once rather than by each parse, as formulas can be parsed
+	// concurrently
+	yyErrorVerbose = true
 }
 
 func (f *plex) Lex(lval *yySymType) int {
 	//yyDebug = 3
-	yyErrorVerbose = true
 	n := <-f.nodes
 	if n != nil {
 		lval.node = n
@@ -32,12 +40,21 @@ func (f *plex) Lex(lval *yySymType) int {
 }
 
 func (f *plex) Error(s string) {
+	f.failed = true
 	unioffice.Log("parse error: %s", s)
 }
 
+// Parse parses a formula, returning nil unless the whole formula could be
+// parsed.
 func Parse(r io.Reader) Expression {
-	p := &plex{LexReader(r), nil}
+	p := &plex{nodes: LexReader(r)}
 	yyParse(p)
+	if p.failed {
+		// drain the lexer so that it doesn't block
+		for range p.nodes {
+		}
+		return nil
+	}
 	return p.result
 }
 
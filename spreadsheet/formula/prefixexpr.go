@@ -7,7 +7,11 @@
 
 package formula
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
 
 type PrefixExpr struct {
 	pfx Expression
@@ -29,6 +33,54 @@ func (p PrefixExpr) Eval(ctx Context, ev Evaluator) Result {
 	}
 }
 
+// Reference returns the reference qualified with the sheet name.
 func (p PrefixExpr) Reference(ctx Context, ev Evaluator) Reference {
-	return ReferenceInvalid
+	pfx := p.pfx.Reference(ctx, ev)
+	if pfx.Type != ReferenceTypeSheet {
+		return ReferenceInvalid
+	}
+	ref := p.exp.Reference(ctx.Sheet(pfx.Value), ev)
+	if ref.Type == ReferenceTypeCell || ref.Type == ReferenceTypeRange {
+		if _, _, ok := reference.SplitSheetPrefix(ref.Value); !ok {
+			ref.Value = reference.QuoteSheetName(pfx.Value) + "!" + ref.Value
+		}
+	}
+	return ref
+}
+
+func (p PrefixExpr) References() []Reference {
+	refs := p.exp.References()
+	sp, ok := p.pfx.(*SheetPrefixExpr)
+	if !ok {
+		return refs
+	}
+	// qualify the references with the sheet name
+	for i := range refs {
+		if refs[i].Type == ReferenceTypeCell || refs[i].Type == ReferenceTypeRange {
+			refs[i].Value = reference.QuoteSheetName(sp.sheet) + "!" + refs[i].Value
+		}
+	}
+	return refs
+}
+
+func (p PrefixExpr) String() string {
+	// a spill range reference is stored as ANCHORARRAY(Sheet1!A1)
+	if s, ok := p.exp.(SpillRef); ok {
+		return "_xlfn.ANCHORARRAY(" + p.pfx.String() + s.s + ")"
+	}
+	return p.pfx.String() + p.exp.String()
+}
+
+// Update returns the expression updated by the query, where inserted or
+// removed rows and columns only affect references to the sheet they are on.
+func (p PrefixExpr) Update(q *UpdateQuery) Expression {
+	sq := q
+	if sp, ok := p.pfx.(*SheetPrefixExpr); ok {
+		sq = q.forSheet(sp.sheet)
+	}
+	exp := p.exp.Update(sq)
+	if _, ok := exp.(Error); ok {
+		return exp
+	}
+	return NewPrefixExpr(p.pfx.Update(q), exp)
 }
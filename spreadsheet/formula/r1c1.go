@@ -0,0 +1,233 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unidoc/unioffice/spreadsheet/internal/refscan"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// ParseStringR1C1 parses a formula with references in R1C1 notation (e.g.
+// SUM(R1C1:R[-1]C)), where relative references are relative to the cell
+// containing the formula (e.g. B3).
+func ParseStringR1C1(s, cell string) Expression {
+	f, err := ConvertFromR1C1(s, cell)
+	if err != nil {
+		return nil
+	}
+	return ParseString(f)
+}
+
+// ConvertToR1C1 converts the references in a formula from A1 notation to R1C1
+// notation relative to the cell containing the formula (e.g. B3).  Absolute
+// rows and columns become row and column numbers, and relative ones offsets
+// from the cell, so A1+$A$1 in B3 becomes R[-2]C[-1]+R1C1.
+func ConvertToR1C1(f, cell string) (string, error) {
+	origin, err := reference.ParseCellReference(cell)
+	if err != nil {
+		return f, err
+	}
+	return refscan.Rewriter{Ref: func(r refscan.Ref) string {
+		return a1ToR1C1(r.Text, origin)
+	}}.Rewrite(f), nil
+}
+
+// ConvertFromR1C1 converts the references in a formula from R1C1 notation to
+// A1 notation, where relative references are relative to the cell containing
+// the formula (e.g. B3).  References to rows or columns outside of a worksheet
+// are an error.
+func ConvertFromR1C1(f, cell string) (string, error) {
+	origin, err := reference.ParseCellReference(cell)
+	if err != nil {
+		return f, err
+	}
+	var rerr error
+	res := refscan.Rewriter{Match: matchR1C1Ref, Ref: func(r refscan.Ref) string {
+		a1, err := r1c1ToA1(r.Text, origin)
+		if err != nil {
+			if rerr == nil {
+				rerr = err
+			}
+			return r.Text
+		}
+		return a1
+	}}.Rewrite(f)
+	if rerr != nil {
+		return f, rerr
+	}
+	return res, nil
+}
+
+// a1ToR1C1 converts an A1 reference (e.g. $A$1:B2) to R1C1 notation.
+func a1ToR1C1(ref string, origin reference.CellReference) string {
+	a, b := ref, ""
+	if idx := strings.IndexByte(ref, ':'); idx != -1 {
+		a, b = ref[:idx], ref[idx+1:]
+	}
+	switch refscan.Classify(a, b) {
+	case refscan.KindCell:
+		c, _ := reference.ParseCellReference(a)
+		return c.R1C1(origin)
+	case refscan.KindArea:
+		from, _ := reference.ParseCellReference(a)
+		to, _ := reference.ParseCellReference(b)
+		return from.R1C1(origin) + ":" + to.R1C1(origin)
+	case refscan.KindColumns:
+		return a1Column(a, origin) + ":" + a1Column(b, origin)
+	case refscan.KindRows:
+		return a1Row(a, origin) + ":" + a1Row(b, origin)
+	}
+	return ref
+}
+
+// a1Column returns the R1C1 form of a column (e.g. $B) of a column range.
+func a1Column(s string, origin reference.CellReference) string {
+	c, _ := reference.ParseCellReference(s + "1")
+	c.AbsoluteRow = true
+	r := c.R1C1(origin)
+	return r[strings.IndexByte(r, 'C'):]
+}
+
+// a1Row returns the R1C1 form of a row (e.g. $3) of a row range.
+func a1Row(s string, origin reference.CellReference) string {
+	c, _ := reference.ParseCellReference("$A" + s)
+	r := c.R1C1(origin)
+	return r[:strings.IndexByte(r, 'C')]
+}
+
+// r1c1Kind is the kind of an R1C1 reference.
+type r1c1Kind byte
+
+const (
+	r1c1None r1c1Kind = iota
+	r1c1Cell
+	r1c1Row
+	r1c1Column
+)
+
+// matchR1C1Part returns the end of the row or column number or offset that
+// starts at f[i], if any.
+func matchR1C1Part(f string, i int) int {
+	if i < len(f) && f[i] == '[' {
+		j := i + 1
+		if j < len(f) && f[j] == '-' {
+			j++
+		}
+		k := j
+		for k < len(f) && f[k] >= '0' && f[k] <= '9' {
+			k++
+		}
+		if k == j || k >= len(f) || f[k] != ']' {
+			return i
+		}
+		return k + 1
+	}
+	for i < len(f) && f[i] >= '0' && f[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// matchR1C1 returns the kind and end of the R1C1 reference, if any, starting
+// at f[i].
+func matchR1C1(f string, i int) (r1c1Kind, int) {
+	kind := r1c1None
+	j := i
+	if j < len(f) && f[j] == 'R' {
+		j = matchR1C1Part(f, j+1)
+		kind = r1c1Row
+	}
+	if j < len(f) && f[j] == 'C' {
+		j = matchR1C1Part(f, j+1)
+		if kind == r1c1Row {
+			kind = r1c1Cell
+		} else {
+			kind = r1c1Column
+		}
+	}
+	if kind == r1c1None || (j < len(f) && refscan.IsNameChar(f[j])) || refscan.FollowedByName(f, j) {
+		return r1c1None, i
+	}
+	return kind, j
+}
+
+// matchR1C1Ref returns the end of the R1C1 cell, range, row or column
+// reference, if any, starting at f[i].
+func matchR1C1Ref(f string, i int) int {
+	kind, j := matchR1C1(f, i)
+	if kind != r1c1None && j < len(f) && f[j] == ':' {
+		if k2, k := matchR1C1(f, j+1); k2 == kind {
+			j = k
+		}
+	}
+	return j
+}
+
+// r1c1ToA1 converts an R1C1 reference (e.g. R1C1:R[-1]C) to A1 notation.
+func r1c1ToA1(ref string, origin reference.CellReference) (string, error) {
+	a, b := ref, ""
+	if idx := strings.IndexByte(ref, ':'); idx != -1 {
+		a, b = ref[:idx], ref[idx+1:]
+	}
+	kind, _ := matchR1C1(a, 0)
+	switch kind {
+	case r1c1Cell:
+		from, err := reference.ParseR1C1Reference(a, origin)
+		if err != nil {
+			return "", err
+		}
+		if b == "" {
+			return from.String(), nil
+		}
+		to, err := reference.ParseR1C1Reference(b, origin)
+		if err != nil {
+			return "", err
+		}
+		return from.String() + ":" + to.String(), nil
+	case r1c1Row:
+		// a single row or column is a range of one row or column in A1
+		// notation
+		if b == "" {
+			b = a
+		}
+		from, err := reference.ParseR1C1Reference(a+"C", origin)
+		if err != nil {
+			return "", err
+		}
+		to, err := reference.ParseR1C1Reference(b+"C", origin)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%d:%s%d", absMark(from.AbsoluteRow), from.RowIdx,
+			absMark(to.AbsoluteRow), to.RowIdx), nil
+	default:
+		if b == "" {
+			b = a
+		}
+		from, err := reference.ParseR1C1Reference("R"+a, origin)
+		if err != nil {
+			return "", err
+		}
+		to, err := reference.ParseR1C1Reference("R"+b, origin)
+		if err != nil {
+			return "", err
+		}
+		return absMark(from.AbsoluteColumn) + from.Column + ":" +
+			absMark(to.AbsoluteColumn) + to.Column, nil
+	}
+}
+
+func absMark(abs bool) string {
+	if abs {
+		return "$"
+	}
+	return ""
+}
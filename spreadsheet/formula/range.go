@@ -44,6 +44,15 @@ func (r Range) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
 
+func (r Range) References() []Reference {
+	from := r.from.References()
+	to := r.to.References()
+	if len(from) == 1 && len(to) == 1 && from[0].Type == ReferenceTypeCell && to[0].Type == ReferenceTypeCell {
+		return []Reference{MakeRangeReference(from[0].Value + ":" + to[0].Value)}
+	}
+	return append(from, to...)
+}
+
 // TODO: move these somewhere to remove duplication
 func ParseCellReference(s string) (col string, row uint32, err error) {
 	s = strings.Replace(s, "$", "", -1)
@@ -100,3 +109,28 @@ func resultFromCellRange(ctx Context, ev Evaluator, from, to string) Result {
 
 	return MakeArrayResult(arr)
 }
+
+func (r Range) String() string {
+	return r.from.String() + ":" + r.to.String()
+}
+
+// Update returns the range updated by the query, or #REF! if all of its cells
+// were removed.  Ranges shrink if some of their rows or columns are removed.
+func (r Range) Update(q *UpdateQuery) Expression {
+	from, fok := r.from.(CellRef)
+	to, tok := r.to.(CellRef)
+	if fok && tok {
+		f, t, ok := q.updateArea(from.s, to.s)
+		if !ok {
+			return refError()
+		}
+		return NewRange(NewCellRef(f), NewCellRef(t))
+	}
+	nf, nt := r.from.Update(q), r.to.Update(q)
+	for _, e := range []Expression{nf, nt} {
+		if _, ok := e.(Error); ok {
+			return e
+		}
+	}
+	return NewRange(nf, nt)
+}
@@ -17,6 +17,7 @@ const (
 	ReferenceTypeNamedRange
 	ReferenceTypeRange
 	ReferenceTypeSheet
+	ReferenceTypeStructured
 )
 
 type Reference struct {
@@ -4,9 +4,9 @@ package formula
 
 import "fmt"
 
-const _ReferenceType_name = "ReferenceTypeInvalidReferenceTypeCellReferenceTypeNamedRangeReferenceTypeRangeReferenceTypeSheet"
+const _ReferenceType_name = "ReferenceTypeInvalidReferenceTypeCellReferenceTypeNamedRangeReferenceTypeRangeReferenceTypeSheetReferenceTypeStructured"
 
-var _ReferenceType_index = [...]uint8{0, 20, 37, 60, 78, 96}
+var _ReferenceType_index = [...]uint8{0, 20, 37, 60, 78, 96, 119}
 
 func (i ReferenceType) String() string {
 	if i >= ReferenceType(len(_ReferenceType_index)-1) {
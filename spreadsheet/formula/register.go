@@ -9,6 +9,7 @@ package formula
 
 import (
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/unidoc/unioffice"
@@ -16,15 +17,7 @@ import (
 
 // SupportedFunctions returns a list of supported functions.
 func SupportedFunctions() []string {
-	ret := []string{}
-	for k := range registered {
-		ret = append(ret, k)
-	}
-	for k := range registeredComplex {
-		ret = append(ret, k)
-	}
-	sort.Strings(ret)
-	return ret
+	return builtins.SupportedFunctions()
 }
 
 // Function is a standard function whose result only depends on its arguments.
@@ -36,46 +29,199 @@ type Function func(args []Result) Result
 // the context to reach into the sheet and pull out required values.
 type FunctionComplex func(ctx Context, ev Evaluator, args []Result) Result
 
-var regLock sync.Mutex
-var registered = map[string]Function{}
-var registeredComplex = map[string]FunctionComplex{}
+// UnlimitedArgs is the MaxArgs of a function that accepts any number of
+// arguments.
+const UnlimitedArgs = -1
 
-// RegisterFunction registers a standard function.
-func RegisterFunction(name string, fn Function) {
-	regLock.Lock()
-	defer regLock.Unlock()
-	if _, ok := registered[name]; ok {
+// FunctionInfo is metadata about a function.
+type FunctionInfo struct {
+	// MinArgs and MaxArgs are the number of arguments that the function
+	// accepts, where a MaxArgs of UnlimitedArgs places no upper limit.  Calls
+	// with a number of arguments outside of these result in a #VALUE! error.
+	MinArgs, MaxArgs int
+	// Volatile is true for functions whose result can change even if their
+	// arguments don't (e.g. NOW), which are recalculated whenever the
+	// workbook is.
+	Volatile bool
+}
+
+// Registry is a set of functions that formulas can call.  A registry
+// constructed with NewRegistry inherits the functions of the global registry
+// that RegisterFunction and RegisterFunctionComplex add to, so custom
+// functions can be added to it, or built in functions overridden, without
+// affecting other evaluators.
+type Registry struct {
+	lock      sync.RWMutex
+	parent    *Registry
+	functions map[string]Function
+	complex   map[string]FunctionComplex
+	info      map[string]FunctionInfo
+}
+
+// builtins is the global registry.
+var builtins = newRegistry(nil)
+
+// NewRegistry constructs a new registry that inherits the globally registered
+// functions.
+func NewRegistry() *Registry {
+	return newRegistry(builtins)
+}
+
+func newRegistry(parent *Registry) *Registry {
+	return &Registry{
+		parent:    parent,
+		functions: map[string]Function{},
+		complex:   map[string]FunctionComplex{},
+		info:      map[string]FunctionInfo{},
+	}
+}
+
+// RegisterFunction registers a standard function, replacing any function of
+// the same name.
+func (r *Registry) RegisterFunction(name string, fn Function) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.functions[name]; ok {
 		unioffice.Log("duplicate registration of function %s", name)
 	}
-	registered[name] = fn
+	delete(r.complex, name)
+	r.functions[name] = fn
 }
 
-// RegisterFunctionComplex registers a standard function.
-func RegisterFunctionComplex(name string, fn FunctionComplex) {
-	regLock.Lock()
-	defer regLock.Unlock()
-	if _, ok := registeredComplex[name]; ok {
+// RegisterFunctionComplex registers a complex function, replacing any function
+// of the same name.
+func (r *Registry) RegisterFunctionComplex(name string, fn FunctionComplex) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.complex[name]; ok {
 		unioffice.Log("duplicate registration of function %s", name)
 	}
-	registeredComplex[name] = fn
+	delete(r.functions, name)
+	r.complex[name] = fn
+}
+
+// RegisterFunctionInfo sets the metadata of a function.
+func (r *Registry) RegisterFunctionInfo(name string, info FunctionInfo) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.info[name] = info
+}
+
+// lookup returns the standard or complex function with a given name, looking
+// in the parent registry if it isn't registered in this one.
+func (r *Registry) lookup(name string) (Function, FunctionComplex) {
+	for ; r != nil; r = r.parent {
+		r.lock.RLock()
+		fn, fnx := r.functions[name], r.complex[name]
+		r.lock.RUnlock()
+		if fn != nil || fnx != nil {
+			return fn, fnx
+		}
+	}
+	return nil, nil
+}
+
+// overrides returns true if a function is registered in the registry or a
+// parent other than the global registry, replacing the built in function.
+func (r *Registry) overrides(name string) bool {
+	for ; r != nil && r != builtins; r = r.parent {
+		r.lock.RLock()
+		fn, fnx := r.functions[name], r.complex[name]
+		r.lock.RUnlock()
+		if fn != nil || fnx != nil {
+			return true
+		}
+	}
+	return false
 }
 
 // LookupFunction looks up and returns a standard function or nil.
-func LookupFunction(name string) Function {
-	regLock.Lock()
-	defer regLock.Unlock()
-	if fn, ok := registered[name]; ok {
-		return fn
+func (r *Registry) LookupFunction(name string) Function {
+	fn, _ := r.lookup(name)
+	return fn
+}
+
+// LookupFunctionComplex looks up and returns a complex function or nil.
+func (r *Registry) LookupFunctionComplex(name string) FunctionComplex {
+	_, fnx := r.lookup(name)
+	return fnx
+}
+
+// LookupFunctionInfo looks up and returns the metadata of a function, if it
+// has any.
+func (r *Registry) LookupFunctionInfo(name string) (FunctionInfo, bool) {
+	for ; r != nil; r = r.parent {
+		r.lock.RLock()
+		info, ok := r.info[name]
+		r.lock.RUnlock()
+		if ok {
+			return info, true
+		}
+	}
+	return FunctionInfo{}, false
+}
+
+// SupportedFunctions returns a list of the functions in the registry.
+func (r *Registry) SupportedFunctions() []string {
+	names := map[string]struct{}{}
+	for ; r != nil; r = r.parent {
+		r.lock.RLock()
+		for k := range r.functions {
+			names[k] = struct{}{}
+		}
+		for k := range r.complex {
+			names[k] = struct{}{}
+		}
+		r.lock.RUnlock()
+	}
+	ret := make([]string, 0, len(names))
+	for k := range names {
+		ret = append(ret, k)
 	}
-	return nil
+	sort.Strings(ret)
+	return ret
+}
+
+// IsVolatile returns true if a formula calls a volatile function.
+func (r *Registry) IsVolatile(formula string) bool {
+	volatile := false
+	for n := range LexReader(strings.NewReader(formula)) {
+		// the lexer must be drained, so keep reading after a match
+		if n.token == tokenFunctionBuiltin && !volatile {
+			info, ok := r.LookupFunctionInfo(n.val)
+			volatile = ok && info.Volatile
+		}
+	}
+	return volatile
+}
+
+// RegisterFunction registers a standard function.
+func RegisterFunction(name string, fn Function) {
+	builtins.RegisterFunction(name, fn)
+}
+
+// RegisterFunctionComplex registers a standard function.
+func RegisterFunctionComplex(name string, fn FunctionComplex) {
+	builtins.RegisterFunctionComplex(name, fn)
+}
+
+// RegisterFunctionInfo sets the metadata of a globally registered function.
+func RegisterFunctionInfo(name string, info FunctionInfo) {
+	builtins.RegisterFunctionInfo(name, info)
+}
+
+// LookupFunction looks up and returns a standard function or nil.
+func LookupFunction(name string) Function {
+	return builtins.LookupFunction(name)
 }
 
 // LookupFunctionComplex looks up and returns a complex function or nil.
 func LookupFunctionComplex(name string) FunctionComplex {
-	regLock.Lock()
-	defer regLock.Unlock()
-	if fn, ok := registeredComplex[name]; ok {
-		return fn
-	}
-	return nil
+	return builtins.LookupFunctionComplex(name)
+}
+
+// LookupFunctionInfo looks up and returns the metadata of a globally
+// registered function, if it has any.
+func LookupFunctionInfo(name string) (FunctionInfo, bool) {
+	return builtins.LookupFunctionInfo(name)
 }
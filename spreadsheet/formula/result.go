@@ -25,14 +25,21 @@ const (
 	ResultTypeArray
 	ResultTypeError
 	ResultTypeEmpty
+	ResultTypeLambda
+	ResultTypeBool
 )
 
-// Result is the result of a formula or cell evaluation .
+// Result is the result of a formula or cell evaluation .  Boolean results also
+// have a ValueNumber of 1 or 0, and error results have the error text (e.g.
+// #N/A) as their ValueString.
 type Result struct {
 	ValueNumber  float64
 	ValueString  string
+	ValueBool    bool
 	ValueList    []Result
 	ValueArray   [][]Result
+	ValueLambda  *Lambda
+	ErrorType    ErrorType
 	ErrorMessage string
 	Type         ResultType
 
@@ -58,6 +65,11 @@ func (r Result) Value() string {
 			n = n[0 : end+1]
 		}
 		return n
+	case ResultTypeBool:
+		if r.ValueBool {
+			return "TRUE"
+		}
+		return "FALSE"
 	case ResultTypeError:
 		return r.ValueString
 	case ResultTypeString:
@@ -74,6 +86,8 @@ func (r Result) Value() string {
 		return r.ValueArray[0][0].Value()
 	case ResultTypeEmpty:
 		return ""
+	case ResultTypeLambda:
+		return "#CALC!"
 	default:
 		return "unhandled result value"
 	}
@@ -82,8 +96,11 @@ func (r Result) Value() string {
 // AsNumber attempts to intepret a string cell value as a number. Upon success,
 // it returns a new number result, upon  failure it returns the original result.
 // This is used as functions return strings that can then act like number (e.g.
-// LEFT(1.2345,3) + LEFT(1.2345,3) = 2.4)
+// LEFT(1.2345,3) + LEFT(1.2345,3) = 2.4).  Booleans are converted to 1 or 0.
 func (r Result) AsNumber() Result {
+	if r.Type == ResultTypeBool {
+		return MakeNumberResult(r.ValueNumber)
+	}
 	if r.Type == ResultTypeString {
 		f, err := strconv.ParseFloat(r.ValueString, 64)
 		if err == nil {
@@ -116,7 +133,7 @@ func (r Result) ListValues() []Result {
 }
 func (r Result) AsString() Result {
 	switch r.Type {
-	case ResultTypeNumber:
+	case ResultTypeNumber, ResultTypeBool:
 		return MakeStringResult(r.Value())
 	default:
 		return r
@@ -132,12 +149,12 @@ func MakeNumberResult(v float64) Result {
 	return Result{Type: ResultTypeNumber, ValueNumber: v}
 }
 
-// MakeBoolResult constructs a boolean result (internally a number).
+// MakeBoolResult constructs a boolean result.
 func MakeBoolResult(b bool) Result {
 	if b {
-		return Result{Type: ResultTypeNumber, ValueNumber: 1}
+		return Result{Type: ResultTypeBool, ValueBool: true, ValueNumber: 1}
 	}
-	return Result{Type: ResultTypeNumber, ValueNumber: 0}
+	return Result{Type: ResultTypeBool, ValueBool: false, ValueNumber: 0}
 }
 
 // MakeErrorResult constructs a #VALUE! error with a given extra error message.
@@ -159,29 +176,49 @@ const (
 	ErrorTypeNum
 	ErrorTypeNA
 	ErrorTypeDivideByZero
+	ErrorTypeSpill
+	ErrorTypeCalc
 )
 
+// errorTypeNames are the text of each error type as it appears in a cell.
+var errorTypeNames = map[ErrorType]string{
+	ErrorTypeValue:        "#VALUE!",
+	ErrorTypeNull:         "#NULL!",
+	ErrorTypeRef:          "#REF!",
+	ErrorTypeName:         "#NAME?",
+	ErrorTypeNum:          "#NUM!",
+	ErrorTypeNA:           "#N/A",
+	ErrorTypeDivideByZero: "#DIV/0!",
+	ErrorTypeSpill:        "#SPILL!",
+	ErrorTypeCalc:         "#CALC!",
+}
+
+// String returns the text of the error as it appears in a cell, e.g. #N/A.
+func (t ErrorType) String() string {
+	if s, ok := errorTypeNames[t]; ok {
+		return s
+	}
+	return "#VALUE!"
+}
+
+// ParseErrorType returns the error type for the text of an error as it appears
+// in a cell, e.g. #DIV/0!.
+func ParseErrorType(s string) (ErrorType, bool) {
+	for t, name := range errorTypeNames {
+		if name == s {
+			return t, true
+		}
+	}
+	return ErrorTypeValue, false
+}
+
 // MakeErrorResultType makes an error result of a given type with a specified
 // debug message
 func MakeErrorResultType(t ErrorType, msg string) Result {
-	switch t {
-	case ErrorTypeNull:
-		return Result{Type: ResultTypeError, ValueString: "#NULL!", ErrorMessage: msg}
-	case ErrorTypeValue:
-		return Result{Type: ResultTypeError, ValueString: "#VALUE!", ErrorMessage: msg}
-	case ErrorTypeRef:
-		return Result{Type: ResultTypeError, ValueString: "#REF!", ErrorMessage: msg}
-	case ErrorTypeName:
-		return Result{Type: ResultTypeError, ValueString: "#NAME?", ErrorMessage: msg}
-	case ErrorTypeNum:
-		return Result{Type: ResultTypeError, ValueString: "#NUM!", ErrorMessage: msg}
-	case ErrorTypeNA:
-		return Result{Type: ResultTypeError, ValueString: "#N/A", ErrorMessage: msg}
-	case ErrorTypeDivideByZero:
-		return Result{Type: ResultTypeError, ValueString: "#DIV/0!", ErrorMessage: msg}
-	default:
-		return Result{Type: ResultTypeError, ValueString: "#VALUE!", ErrorMessage: msg}
+	if _, ok := errorTypeNames[t]; !ok {
+		t = ErrorTypeValue
 	}
+	return Result{Type: ResultTypeError, ValueString: t.String(), ErrorType: t, ErrorMessage: msg}
 }
 
 // MakeStringResult constructs a string result.
@@ -199,6 +236,11 @@ func MakeArrayResult(arr [][]Result) Result {
 	return Result{Type: ResultTypeArray, ValueArray: arr}
 }
 
+// MakeLambdaResult constructs a result that is a LAMBDA function.
+func MakeLambdaResult(l *Lambda) Result {
+	return Result{Type: ResultTypeLambda, ValueLambda: l}
+}
+
 // MakeListResult constructs a list result.
 func MakeListResult(list []Result) Result {
 	return Result{Type: ResultTypeList, ValueList: list}
@@ -7,6 +7,12 @@
 
 package formula
 
+import (
+	"strings"
+
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
 type SheetPrefixExpr struct {
 	sheet string
 }
@@ -22,3 +28,23 @@ func (s SheetPrefixExpr) Eval(ctx Context, ev Evaluator) Result {
 func (s SheetPrefixExpr) Reference(ctx Context, ev Evaluator) Reference {
 	return Reference{Type: ReferenceTypeSheet, Value: s.sheet}
 }
+
+func (s SheetPrefixExpr) References() []Reference {
+	return nil
+}
+
+// String returns the sheet name, quoted if necessary, followed by '!'.
+func (s SheetPrefixExpr) String() string {
+	if reference.SheetNameNeedsQuotes(s.sheet) {
+		return reference.QuoteSheetName(s.sheet) + "!"
+	}
+	return s.sheet + "!"
+}
+
+// Update renames the sheet if it is renamed by the query.
+func (s SheetPrefixExpr) Update(q *UpdateQuery) Expression {
+	if q.OldSheetName != "" && strings.EqualFold(s.sheet, q.OldSheetName) {
+		return NewSheetPrefixExpr(q.NewSheetName)
+	}
+	return &s
+}
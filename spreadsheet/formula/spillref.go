@@ -0,0 +1,84 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"fmt"
+
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// SpillRef is a reference to the range that the result of a dynamic array
+// formula spills into (e.g. A1#).
+type SpillRef struct {
+	s string
+}
+
+// NewSpillRef constructs a new spill range reference to the dynamic array
+// formula in a cell.
+func NewSpillRef(v string) Expression {
+	return SpillRef{v}
+}
+
+// Eval evaluates and returns the array result of the formula.
+func (s SpillRef) Eval(ctx Context, ev Evaluator) Result {
+	return ctx.Spill(s.s, ev)
+}
+
+// Reference returns the range that the result of the formula spills into.
+func (s SpillRef) Reference(ctx Context, ev Evaluator) Reference {
+	res := ctx.Spill(s.s, ev)
+	if res.Type == ResultTypeError {
+		return ReferenceInvalid
+	}
+	cr, err := reference.ParseCellReference(s.s)
+	if err != nil {
+		return ReferenceInvalid
+	}
+	rows, cols := dims(res)
+	if rows <= 1 && cols <= 1 {
+		return Reference{Type: ReferenceTypeCell, Value: s.s}
+	}
+	return MakeRangeReference(fmt.Sprintf("%s:%s%d", s.s,
+		reference.IndexToColumn(cr.ColumnIdx+uint32(cols-1)), cr.RowIdx+uint32(rows-1)))
+}
+
+// References returns the cell containing the formula.
+func (s SpillRef) References() []Reference {
+	return []Reference{{Type: ReferenceTypeCell, Value: s.s}}
+}
+
+// anchorArray returns the spill range reference equivalent to the argument of
+// ANCHORARRAY, or nil if the argument isn't a cell reference.
+func anchorArray(arg Expression) Expression {
+	switch a := arg.(type) {
+	case CellRef:
+		return NewSpillRef(a.s)
+	case *PrefixExpr:
+		if c, ok := a.exp.(CellRef); ok {
+			return NewPrefixExpr(a.pfx, NewSpillRef(c.s))
+		}
+	}
+	return nil
+}
+
+// String returns the reference in the form it's stored in a file, as a call to
+// ANCHORARRAY.
+func (s SpillRef) String() string {
+	return "_xlfn.ANCHORARRAY(" + s.s + ")"
+}
+
+// Update returns the spill range reference updated by the query, or #REF! if
+// the cell containing the formula was removed.
+func (s SpillRef) Update(q *UpdateQuery) Expression {
+	ref, ok := q.updateCell(s.s)
+	if !ok {
+		return refError()
+	}
+	return NewSpillRef(ref)
+}
@@ -26,3 +26,15 @@ func (s String) Eval(ctx Context, ev Evaluator) Result {
 func (s String) Reference(ctx Context, ev Evaluator) Reference {
 	return ReferenceInvalid
 }
+
+func (s String) References() []Reference {
+	return nil
+}
+
+func (s String) String() string {
+	return `"` + strings.Replace(s.s, `"`, `""`, -1) + `"`
+}
+
+func (s String) Update(q *UpdateQuery) Expression {
+	return s
+}
@@ -0,0 +1,289 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// Table describes a table for evaluating structured references such as
+// Table1[Amount].
+type Table struct {
+	Name string
+	// Sheet is the name of the sheet containing the table.
+	Sheet string
+	// Ref is the range of the table (e.g. A1:C10) including its header and
+	// totals rows.
+	Ref        string
+	HeaderRows uint32
+	TotalsRows uint32
+	Columns    []string
+	// CurrentRow is the row of the cell being evaluated, used to resolve
+	// references to the current row (e.g. [@Amount]), or zero if unknown.
+	CurrentRow uint32
+}
+
+// structured reference item specifiers
+const (
+	itemAll = 1 << iota
+	itemData
+	itemHeaders
+	itemTotals
+	itemThisRow
+)
+
+var structuredItems = map[string]int{
+	"#all":      itemAll,
+	"#data":     itemData,
+	"#headers":  itemHeaders,
+	"#totals":   itemTotals,
+	"#this row": itemThisRow,
+}
+
+// StructuredRef is a reference to the cells of a table by its column names
+// (e.g. Table1[Amount], Table1[[#Totals],[Qty]] or [@Price]).
+type StructuredRef struct {
+	s        string
+	table    string
+	items    int
+	from, to string
+	err      error
+}
+
+// NewStructuredRef constructs a new structured reference.
+func NewStructuredRef(v string) Expression {
+	sr := StructuredRef{s: v}
+	idx := strings.IndexByte(v, '[')
+	if idx == -1 || !strings.HasSuffix(v, "]") {
+		sr.err = fmt.Errorf("invalid structured reference %s", v)
+		return sr
+	}
+	sr.table = v[:idx]
+	sr.err = sr.parse(v[idx+1 : len(v)-1])
+	return sr
+}
+
+// parse parses the specifier of a structured reference, the part within the
+// outer brackets.
+func (s *StructuredRef) parse(spec string) error {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "":
+		return nil
+	case strings.HasPrefix(spec, "@"):
+		s.items = itemThisRow
+		spec = strings.TrimSpace(spec[1:])
+		if spec == "" {
+			return nil
+		}
+		if !strings.HasPrefix(spec, "[") {
+			s.from = unescapeStructuredName(spec)
+			return nil
+		}
+	case !strings.HasPrefix(spec, "["):
+		if item, ok := structuredItems[strings.ToLower(spec)]; ok {
+			s.items = item
+		} else {
+			s.from = unescapeStructuredName(spec)
+		}
+		return nil
+	}
+
+	// a list of bracketed items and columns, e.g. [#Totals],[Qty]:[Price]
+	columns := []string{}
+	colon := false
+	for spec != "" {
+		if spec[0] != '[' {
+			return fmt.Errorf("invalid structured reference %s", s.s)
+		}
+		end := 1
+		for end < len(spec) && spec[end] != ']' {
+			if spec[end] == '\'' {
+				end++
+			}
+			end++
+		}
+		if end >= len(spec) {
+			return fmt.Errorf("invalid structured reference %s", s.s)
+		}
+		name := spec[1:end]
+		if item, ok := structuredItems[strings.ToLower(name)]; ok {
+			s.items |= item
+		} else {
+			columns = append(columns, unescapeStructuredName(name))
+		}
+		spec = strings.TrimSpace(spec[end+1:])
+		if strings.HasPrefix(spec, ",") {
+			spec = strings.TrimSpace(spec[1:])
+		} else if strings.HasPrefix(spec, ":") {
+			colon = true
+			spec = strings.TrimSpace(spec[1:])
+		}
+	}
+	switch {
+	case len(columns) == 1:
+		s.from = columns[0]
+	case len(columns) == 2 && colon:
+		s.from, s.to = columns[0], columns[1]
+	case len(columns) > 1:
+		return fmt.Errorf("invalid structured reference %s", s.s)
+	}
+	return nil
+}
+
+// unescapeStructuredName removes the escape characters from a column name.
+func unescapeStructuredName(s string) string {
+	if !strings.Contains(s, "'") {
+		return s
+	}
+	buf := []byte{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' && i+1 < len(s) {
+			i++
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf)
+}
+
+// Eval evaluates and returns the result of the structured reference.
+func (s StructuredRef) Eval(ctx Context, ev Evaluator) Result {
+	ref, err := s.resolve(ctx)
+	if err != nil {
+		return MakeErrorResultType(ErrorTypeRef, err.Error())
+	}
+	sheet, rng, _ := reference.SplitSheetPrefix(ref.Value)
+	sheetCtx := ctx.Sheet(sheet)
+	if ref.Type == ReferenceTypeCell {
+		return sheetCtx.Cell(rng, ev)
+	}
+	sp := strings.Split(rng, ":")
+	return resultFromCellRange(sheetCtx, ev, sp[0], sp[1])
+}
+
+// Reference returns the cell or range referred to, qualified with the name of
+// the sheet containing the table.
+func (s StructuredRef) Reference(ctx Context, ev Evaluator) Reference {
+	ref, err := s.resolve(ctx)
+	if err != nil {
+		return ReferenceInvalid
+	}
+	return ref
+}
+
+// References returns the structured reference, as the cells it refers to
+// depend on the table definitions in the workbook.
+func (s StructuredRef) References() []Reference {
+	return []Reference{{Type: ReferenceTypeStructured, Value: s.s}}
+}
+
+// resolve determines the cells referred to using the table definition.
+func (s StructuredRef) resolve(ctx Context) (Reference, error) {
+	if s.err != nil {
+		return ReferenceInvalid, s.err
+	}
+	t, ok := ctx.Table(s.table)
+	if !ok {
+		return ReferenceInvalid, fmt.Errorf("table %s not found", s.table)
+	}
+	from, to, err := reference.ParseRangeReference(t.Ref)
+	if err != nil {
+		return ReferenceInvalid, err
+	}
+
+	// columns
+	fc, tc := from.ColumnIdx, to.ColumnIdx
+	if s.from != "" {
+		idx, err := tableColumnIndex(t, s.from)
+		if err != nil {
+			return ReferenceInvalid, err
+		}
+		fc, tc = from.ColumnIdx+idx, from.ColumnIdx+idx
+		if s.to != "" {
+			idx, err := tableColumnIndex(t, s.to)
+			if err != nil {
+				return ReferenceInvalid, err
+			}
+			tc = from.ColumnIdx + idx
+			if tc < fc {
+				fc, tc = tc, fc
+			}
+		}
+	}
+
+	// rows
+	header := from.RowIdx
+	dataFrom := from.RowIdx + t.HeaderRows
+	dataTo := to.RowIdx - t.TotalsRows
+	items := s.items
+	if items == 0 {
+		items = itemData
+	}
+	var fr, tr uint32
+	switch {
+	case items&itemAll != 0:
+		fr, tr = from.RowIdx, to.RowIdx
+	case items&itemThisRow != 0:
+		if t.CurrentRow < dataFrom || t.CurrentRow > dataTo {
+			return ReferenceInvalid, fmt.Errorf("row %d is not within table %s", t.CurrentRow, t.Name)
+		}
+		fr, tr = t.CurrentRow, t.CurrentRow
+	default:
+		fr, tr = dataFrom, dataTo
+		if items&itemData == 0 {
+			fr, tr = 0, 0
+		}
+		if items&itemHeaders != 0 {
+			if t.HeaderRows == 0 {
+				return ReferenceInvalid, fmt.Errorf("table %s has no header row", t.Name)
+			}
+			fr = header
+			if tr == 0 {
+				tr = header
+			}
+		}
+		if items&itemTotals != 0 {
+			if t.TotalsRows == 0 {
+				return ReferenceInvalid, fmt.Errorf("table %s has no totals row", t.Name)
+			}
+			if fr == 0 {
+				fr = to.RowIdx
+			}
+			tr = to.RowIdx
+		}
+	}
+
+	prefix := reference.QuoteSheetName(t.Sheet) + "!"
+	if fc == tc && fr == tr {
+		return Reference{Type: ReferenceTypeCell, Value: fmt.Sprintf("%s%s%d", prefix, reference.IndexToColumn(fc), fr)}, nil
+	}
+	return MakeRangeReference(fmt.Sprintf("%s%s%d:%s%d", prefix, reference.IndexToColumn(fc), fr,
+		reference.IndexToColumn(tc), tr)), nil
+}
+
+func tableColumnIndex(t Table, name string) (uint32, error) {
+	for i, c := range t.Columns {
+		if strings.EqualFold(c, name) {
+			return uint32(i), nil
+		}
+	}
+	return 0, fmt.Errorf("column %s not found in table %s", name, t.Name)
+}
+
+func (s StructuredRef) String() string {
+	return s.s
+}
+
+// Update returns the structured reference unchanged, as it refers to the
+// table by name rather than by its cells.
+func (s StructuredRef) Update(q *UpdateQuery) Expression {
+	return s
+}
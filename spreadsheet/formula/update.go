@@ -0,0 +1,256 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package formula
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unioffice/spreadsheet/internal/refscan"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// UpdateType is the type of a structural edit to a sheet that references are
+// updated for.
+type UpdateType byte
+
+// UpdateType constants.
+const (
+	UpdateTypeNone UpdateType = iota
+	UpdateTypeInsertRows
+	UpdateTypeRemoveRows
+	UpdateTypeInsertColumns
+	UpdateTypeRemoveColumns
+)
+
+// UpdateQuery describes how to update the references in a formula.  Any
+// combination of the updates can be made at once.  References to cells that
+// are removed, or that would be moved before the first row or column, are
+// replaced with #REF!.
+type UpdateQuery struct {
+	// ColumnOffset and RowOffset move the relative parts of references, as
+	// when a formula is copied from one cell to another.  Copying a formula
+	// from A1 to C2 has a column offset of 2 and a row offset of 1.
+	ColumnOffset, RowOffset int
+
+	// OldSheetName and NewSheetName rename the sheet in references to it.
+	OldSheetName, NewSheetName string
+
+	// UpdateType inserts or removes Count rows or columns on a sheet, starting
+	// at Index, a 1-based row or 0-based column index.  References to Sheet,
+	// and references without a sheet name if CurrentSheet is true as the
+	// formula is on that sheet, are updated.
+	UpdateType   UpdateType
+	Sheet        string
+	CurrentSheet bool
+	Index, Count uint32
+}
+
+// UpdateFormula parses a formula and returns it with its references updated.
+func UpdateFormula(f string, q *UpdateQuery) (string, error) {
+	expr := ParseString(f)
+	if expr == nil {
+		return f, errors.New("unable to parse formula " + f)
+	}
+	return expr.Update(q).String(), nil
+}
+
+// UpdateReference returns a reference without a sheet prefix (e.g. A1,
+// $A$1:B2, A:C or 1:3) updated by the query, and false if the cells it refers
+// to were removed.  Rows and columns are inserted or removed only if
+// CurrentSheet is true, as the reference is then to the edited sheet.
+// References that can't be parsed are returned unchanged.
+func (q *UpdateQuery) UpdateReference(ref string) (string, bool) {
+	a, b := ref, ""
+	if idx := strings.IndexByte(ref, ':'); idx != -1 {
+		a, b = ref[:idx], ref[idx+1:]
+	}
+	switch refscan.Classify(a, b) {
+	case refscan.KindCell:
+		return q.updateCell(a)
+	case refscan.KindArea:
+		from, to, ok := q.updateArea(a, b)
+		return from + ":" + to, ok
+	case refscan.KindColumns:
+		from, fok := offset(reference.ColumnToIndex(strings.TrimPrefix(a, "$")), q.ColumnOffset, strings.HasPrefix(a, "$"))
+		to, tok := offset(reference.ColumnToIndex(strings.TrimPrefix(b, "$")), q.ColumnOffset, strings.HasPrefix(b, "$"))
+		ok := fok && tok
+		if ok && q.shiftsColumns() {
+			from, to, ok = q.shiftInterval(from, to)
+		}
+		return absMark(strings.HasPrefix(a, "$")) + reference.IndexToColumn(from) + ":" +
+			absMark(strings.HasPrefix(b, "$")) + reference.IndexToColumn(to), ok
+	case refscan.KindRows:
+		fr, _ := strconv.ParseUint(strings.TrimPrefix(a, "$"), 10, 32)
+		tr, _ := strconv.ParseUint(strings.TrimPrefix(b, "$"), 10, 32)
+		from, fok := offset(uint32(fr), q.RowOffset, strings.HasPrefix(a, "$"))
+		to, tok := offset(uint32(tr), q.RowOffset, strings.HasPrefix(b, "$"))
+		ok := fok && tok && from > 0
+		if ok && q.shiftsRows() {
+			from, to, ok = q.shiftInterval(from, to)
+		}
+		return fmt.Sprintf("%s%d:%s%d", absMark(strings.HasPrefix(a, "$")), from,
+			absMark(strings.HasPrefix(b, "$")), to), ok
+	}
+	return ref, true
+}
+
+// forSheet returns the query for references to a sheet.
+func (q *UpdateQuery) forSheet(sheet string) *UpdateQuery {
+	sq := *q
+	sq.CurrentSheet = strings.EqualFold(sheet, q.Sheet)
+	return &sq
+}
+
+func (q *UpdateQuery) shiftsColumns() bool {
+	return q.CurrentSheet && (q.UpdateType == UpdateTypeInsertColumns || q.UpdateType == UpdateTypeRemoveColumns)
+}
+
+func (q *UpdateQuery) shiftsRows() bool {
+	return q.CurrentSheet && (q.UpdateType == UpdateTypeInsertRows || q.UpdateType == UpdateTypeRemoveRows)
+}
+
+func (q *UpdateQuery) removes() bool {
+	return q.UpdateType == UpdateTypeRemoveRows || q.UpdateType == UpdateTypeRemoveColumns
+}
+
+// offset moves a row or column index unless it's absolute.
+func offset(v uint32, d int, abs bool) (uint32, bool) {
+	if abs {
+		return v, true
+	}
+	n := int64(v) + int64(d)
+	return uint32(n), n >= 0
+}
+
+// shiftIndex returns the new row or column index after rows or columns are
+// inserted or removed, returning false if it was removed.
+func (q *UpdateQuery) shiftIndex(v uint32) (uint32, bool) {
+	switch {
+	case v < q.Index:
+		return v, true
+	case !q.removes():
+		return v + q.Count, true
+	case v < q.Index+q.Count:
+		return 0, false
+	}
+	return v - q.Count, true
+}
+
+// shiftInterval returns the new interval of row or column indexes after rows
+// or columns are inserted or removed, shrinking it if some of them are
+// removed.
+func (q *UpdateQuery) shiftInterval(a, b uint32) (uint32, uint32, bool) {
+	if !q.removes() {
+		a, _ = q.shiftIndex(a)
+		b, _ = q.shiftIndex(b)
+		return a, b, true
+	}
+	if a >= q.Index && b < q.Index+q.Count {
+		return 0, 0, false
+	}
+	na, ok := q.shiftIndex(a)
+	if !ok {
+		na = q.Index
+	}
+	nb, ok := q.shiftIndex(b)
+	if !ok {
+		nb = q.Index - 1
+	}
+	return na, nb, true
+}
+
+// updateCell returns the updated form of a cell reference.
+func (q *UpdateQuery) updateCell(ref string) (string, bool) {
+	c, err := reference.ParseCellReference(ref)
+	if err != nil {
+		return ref, true
+	}
+	c, ok := q.cell(c)
+	return c.String(), ok
+}
+
+func (q *UpdateQuery) cell(c reference.CellReference) (reference.CellReference, bool) {
+	col, cok := offset(c.ColumnIdx, q.ColumnOffset, c.AbsoluteColumn)
+	row, rok := offset(c.RowIdx, q.RowOffset, c.AbsoluteRow)
+	if !cok || !rok || row == 0 {
+		return c, false
+	}
+	ok := true
+	switch {
+	case q.shiftsColumns():
+		col, ok = q.shiftIndex(col)
+	case q.shiftsRows():
+		row, ok = q.shiftIndex(row)
+	}
+	c.ColumnIdx, c.RowIdx = col, row
+	c.Column = reference.IndexToColumn(col)
+	return c, ok
+}
+
+// updateArea returns the updated form of the cell references at the corners
+// of a range.
+func (q *UpdateQuery) updateArea(from, to string) (string, string, bool) {
+	fc, err := reference.ParseCellReference(from)
+	if err != nil {
+		return from, to, true
+	}
+	tc, err := reference.ParseCellReference(to)
+	if err != nil {
+		return from, to, true
+	}
+	// offset first, then insert or remove rows or columns from the whole range
+	// rather than each cell separately
+	shift := *q
+	shift.UpdateType = UpdateTypeNone
+	fc, fok := shift.cell(fc)
+	tc, tok := shift.cell(tc)
+	if !fok || !tok {
+		return from, to, false
+	}
+	ok := true
+	switch {
+	case q.shiftsColumns():
+		fc.ColumnIdx, tc.ColumnIdx, ok = q.shiftInterval(fc.ColumnIdx, tc.ColumnIdx)
+		fc.Column = reference.IndexToColumn(fc.ColumnIdx)
+		tc.Column = reference.IndexToColumn(tc.ColumnIdx)
+	case q.shiftsRows():
+		fc.RowIdx, tc.RowIdx, ok = q.shiftInterval(fc.RowIdx, tc.RowIdx)
+	}
+	return fc.String(), tc.String(), ok
+}
+
+// refError is the expression that replaces a reference to cells that no
+// longer exist.
+func refError() Expression {
+	return NewError("#REF!")
+}
+
+// updateAll updates a list of expressions.
+func updateAll(exprs []Expression, q *UpdateQuery) []Expression {
+	if exprs == nil {
+		return nil
+	}
+	ret := make([]Expression, len(exprs))
+	for i, e := range exprs {
+		ret[i] = e.Update(q)
+	}
+	return ret
+}
+
+// joinStrings returns the formula text of a list of expressions separated by
+// sep.
+func joinStrings(exprs []Expression, sep string) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = e.String()
+	}
+	return strings.Join(s, sep)
+}
@@ -0,0 +1,339 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+// Package refscan finds the references in the text of a formula so that they
+// can be rewritten without parsing and re-emitting the whole formula, which
+// keeps the rest of the text unchanged.
+package refscan
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Kind is the kind of a reference found in formula text.
+type Kind byte
+
+// Kind constants.
+const (
+	KindNone    Kind = iota
+	KindCell         // A1
+	KindArea         // A1:B2
+	KindColumns      // A:C
+	KindRows         // 1:3
+)
+
+// Classify determines the kind of reference formed by one or two words of
+// formula text, separated by a colon if there are two.
+func Classify(a, b string) Kind {
+	if b == "" {
+		if IsCell(a) {
+			return KindCell
+		}
+		return KindNone
+	}
+	switch {
+	case IsCell(a) && IsCell(b):
+		return KindArea
+	case IsColumn(a) && IsColumn(b):
+		return KindColumns
+	case IsRow(a) && IsRow(b):
+		return KindRows
+	}
+	return KindNone
+}
+
+// IsCell returns true if s is a cell reference such as A1 or $A$1.
+func IsCell(s string) bool {
+	s = strings.TrimPrefix(s, "$")
+	n := 0
+	for n < len(s) && s[n] >= 'A' && s[n] <= 'Z' {
+		n++
+	}
+	if n == 0 || n > 3 {
+		return false
+	}
+	return IsRow(s[n:])
+}
+
+// IsColumn returns true if s is a column such as A or $A.
+func IsColumn(s string) bool {
+	s = strings.TrimPrefix(s, "$")
+	if len(s) == 0 || len(s) > 3 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsRow returns true if s is a row such as 1 or $1.
+func IsRow(s string) bool {
+	s = strings.TrimPrefix(s, "$")
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsNameChar returns true for the characters of names and references.
+func IsNameChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+		c == '$' || c == '_' || c == '.' || c == '\\' || c >= 0x80
+}
+
+// errorLiterals are the error values that can appear in formula text.
+var errorLiterals = []string{"#NULL!", "#DIV/0!", "#VALUE!", "#REF!", "#NAME?",
+	"#NUM!", "#N/A", "#SPILL!", "#CALC!", "#GETTING_DATA"}
+
+// Ref is a reference found in formula text.
+type Ref struct {
+	// Sheet is the name of the sheet in the sheet prefix, if Qualified is
+	// true.
+	Sheet     string
+	Qualified bool
+	// External is true if the sheet is in another workbook (e.g. [1]Sheet1!A1).
+	External bool
+	// Text is the reference without the sheet prefix (e.g. $A$1:B2).
+	Text string
+}
+
+// Rewriter rewrites the references in formula text, copying the text between
+// them unchanged.  Strings, structured references and error values are never
+// treated as references.
+type Rewriter struct {
+	// Match returns the end of the reference that starts at f[i], or i if
+	// there isn't one.  It defaults to MatchA1.
+	Match func(f string, i int) int
+	// Ref returns the replacement for a reference.  References are unchanged
+	// if it's nil.
+	Ref func(r Ref) string
+	// Prefix returns the replacement for a sheet prefix, including the '!',
+	// and true, or false to leave the prefix unchanged.  quoted is true if the
+	// sheet name was quoted.  Prefixes of sheets in other workbooks are never
+	// replaced.
+	Prefix func(sheet string, quoted bool) (string, bool)
+	// Name returns the replacement for a name, such as a defined name or the
+	// table name of a structured reference (e.g. Table1[Qty]), and true, or
+	// false to leave the name unchanged.  Functions and names in other
+	// workbooks are never replaced.
+	Name func(name string) (string, bool)
+}
+
+// Rewrite returns the formula text with its references rewritten.
+func (r Rewriter) Rewrite(f string) string {
+	match := r.Match
+	if match == nil {
+		match = MatchA1
+	}
+	buf := bytes.Buffer{}
+	external := false
+	// ref writes the reference, if any, starting at f[i] and returns the
+	// index of the following text
+	ref := func(i int, sheet string, qualified bool) int {
+		j := match(f, i)
+		if j == i {
+			return i
+		}
+		if r.Ref == nil {
+			buf.WriteString(f[i:j])
+		} else {
+			buf.WriteString(r.Ref(Ref{Sheet: sheet, Qualified: qualified, External: external, Text: f[i:j]}))
+		}
+		return j
+	}
+	prefix := func(text, sheet string, quoted bool) {
+		if r.Prefix != nil && !external {
+			if p, ok := r.Prefix(sheet, quoted); ok {
+				buf.WriteString(p)
+				return
+			}
+		}
+		buf.WriteString(text)
+	}
+
+	i := 0
+	for i < len(f) {
+		c := f[i]
+		switch {
+		case c == '"':
+			j := quoted(f, i)
+			buf.WriteString(f[i:j])
+			i = j
+		case c == '[':
+			// structured references and external workbook indexes
+			j := bracketed(f, i)
+			buf.WriteString(f[i:j])
+			i = j
+			external = true
+			continue
+		case c == '#':
+			j := i + 1
+			for _, e := range errorLiterals {
+				if strings.HasPrefix(f[i:], e) {
+					j = i + len(e)
+					break
+				}
+			}
+			buf.WriteString(f[i:j])
+			i = j
+		case c == '\'':
+			j := quoted(f, i)
+			if j < len(f) && f[j] == '!' {
+				name := strings.Replace(f[i+1:j-1], "''", "'", -1)
+				prefix(f[i:j+1], name, true)
+				i = j + 1
+				i = skipWord(&buf, f, ref(i, name, true), i)
+			} else {
+				buf.WriteString(f[i:j])
+				i = j
+			}
+		case IsNameChar(c):
+			j := i
+			for j < len(f) && IsNameChar(f[j]) {
+				j++
+			}
+			if k := sheetRange(f, i, j); k != j {
+				// a 3D reference without quotes (e.g. Jan:Mar!A1)
+				j = k
+			}
+			if j < len(f) && f[j] == '!' {
+				name := f[i:j]
+				prefix(f[i:j+1], name, false)
+				i = j + 1
+				i = skipWord(&buf, f, ref(i, name, true), i)
+				break
+			}
+			if k := ref(i, "", false); k != i {
+				i = k
+				break
+			}
+			// functions, names and numbers
+			name := f[i:j]
+			if r.Name != nil && (j == len(f) || f[j] != '(') && (i == 0 || f[i-1] != '!') {
+				if n, ok := r.Name(name); ok {
+					name = n
+				}
+			}
+			buf.WriteString(name)
+			i = j
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+		external = false
+	}
+	return buf.String()
+}
+
+// skipWord writes the word starting at f[i] if a reference didn't end at j,
+// as when a name follows a sheet prefix, and returns the index of the
+// following text.
+func skipWord(buf *bytes.Buffer, f string, j, i int) int {
+	if j != i {
+		return j
+	}
+	for j < len(f) && IsNameChar(f[j]) {
+		j++
+	}
+	buf.WriteString(f[i:j])
+	return j
+}
+
+// sheetRange returns the end of the sheet names of a 3D reference if the word
+// f[i:j] is followed by a colon, another word and '!', or j otherwise.
+func sheetRange(f string, i, j int) int {
+	if j >= len(f) || f[j] != ':' || IsCell(f[i:j]) {
+		return j
+	}
+	k := j + 1
+	for k < len(f) && IsNameChar(f[k]) {
+		k++
+	}
+	if k == j+1 || k >= len(f) || f[k] != '!' {
+		return j
+	}
+	return k
+}
+
+// quoted returns the index following the string or quoted sheet name starting
+// at f[i], where quotes are escaped by repeating them.
+func quoted(f string, i int) int {
+	q := f[i]
+	j := i + 1
+	for j < len(f) {
+		if f[j] == q {
+			if j+1 < len(f) && f[j+1] == q {
+				j += 2
+				continue
+			}
+			return j + 1
+		}
+		j++
+	}
+	return len(f)
+}
+
+// bracketed returns the index following the bracketed text starting at f[i],
+// which may contain nested brackets escaped by a quote (e.g. [Qty '[kg']]).
+func bracketed(f string, i int) int {
+	depth := 0
+	for j := i; j < len(f); j++ {
+		switch f[j] {
+		case '\'':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(f)
+}
+
+// FollowedByName returns true if the word ending at f[j] is followed by text
+// that makes it the name of a function, sheet or table rather than a
+// reference.
+func FollowedByName(f string, j int) bool {
+	return j < len(f) && (f[j] == '(' || f[j] == '!' || f[j] == '[')
+}
+
+// MatchA1 returns the end of the A1 cell, range, column or row reference
+// starting at f[i], or i if there isn't one.
+func MatchA1(f string, i int) int {
+	j := i
+	for j < len(f) && IsNameChar(f[j]) {
+		j++
+	}
+	if j == i || FollowedByName(f, j) {
+		return i
+	}
+	if j+1 < len(f) && f[j] == ':' {
+		k := j + 1
+		for k < len(f) && IsNameChar(f[k]) {
+			k++
+		}
+		if !FollowedByName(f, k) && Classify(f[i:j], f[j+1:k]) != KindNone {
+			return k
+		}
+	}
+	if Classify(f[i:j], "") == KindCell {
+		return j
+	}
+	return i
+}
@@ -0,0 +1,421 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// maxOutlineLevel is the maximum number of nested groups of rows or columns.
+const maxOutlineLevel = 7
+
+// outline is the rows or the columns of a sheet, which are grouped the same
+// way.  Rows and columns are referred to by their 1-based index.
+type outline interface {
+	level(i uint32) uint8
+	setLevel(i uint32, l uint8)
+	setHidden(i uint32, b bool)
+	collapsed(i uint32) bool
+	setCollapsed(i uint32, b bool)
+	// summaryAfter returns true if the summary row or column of a group
+	// follows it, which is the default.
+	summaryAfter() bool
+}
+
+type rowOutline struct {
+	s    Sheet
+	rows map[uint32]*sml.CT_Row
+}
+
+func newRowOutline(s Sheet) *rowOutline {
+	o := &rowOutline{s, map[uint32]*sml.CT_Row{}}
+	for _, r := range s.x.SheetData.Row {
+		if r.RAttr != nil {
+			o.rows[*r.RAttr] = r
+		}
+	}
+	return o
+}
+
+func (o *rowOutline) row(i uint32) Row {
+	if r, ok := o.rows[i]; ok {
+		return Row{o.s.w, o.s.x, r}
+	}
+	r := o.s.Row(i)
+	o.rows[i] = r.x
+	return r
+}
+
+func (o *rowOutline) level(i uint32) uint8 {
+	if r, ok := o.rows[i]; ok && r.OutlineLevelAttr != nil {
+		return *r.OutlineLevelAttr
+	}
+	return 0
+}
+
+func (o *rowOutline) setLevel(i uint32, l uint8) {
+	o.row(i).SetOutlineLevel(l)
+}
+
+func (o *rowOutline) setHidden(i uint32, b bool) {
+	if _, ok := o.rows[i]; ok || b {
+		o.row(i).SetHidden(b)
+	}
+}
+
+func (o *rowOutline) collapsed(i uint32) bool {
+	r, ok := o.rows[i]
+	return ok && r.CollapsedAttr != nil && *r.CollapsedAttr
+}
+
+func (o *rowOutline) setCollapsed(i uint32, b bool) {
+	if _, ok := o.rows[i]; ok || b {
+		o.row(i).SetCollapsed(b)
+	}
+}
+
+func (o *rowOutline) summaryAfter() bool {
+	pr := o.s.x.SheetPr
+	return pr == nil || pr.OutlinePr == nil || pr.OutlinePr.SummaryBelowAttr == nil ||
+		*pr.OutlinePr.SummaryBelowAttr
+}
+
+type columnOutline struct {
+	s Sheet
+}
+
+// find returns the column definition that includes a column, if any.
+func (o columnOutline) find(i uint32) *sml.CT_Col {
+	for _, cols := range o.s.x.Cols {
+		for _, c := range cols.Col {
+			if i >= c.MinAttr && i <= c.MaxAttr {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// column returns a column definition for just one column, splitting the one
+// that includes it if it's for several.
+func (o columnOutline) column(i uint32) Column {
+	for _, cols := range o.s.x.Cols {
+		for _, c := range cols.Col {
+			if i < c.MinAttr || i > c.MaxAttr {
+				continue
+			}
+			if c.MinAttr == c.MaxAttr {
+				return Column{c}
+			}
+			if c.MinAttr < i {
+				before := *c
+				before.MaxAttr = i - 1
+				cols.Col = append(cols.Col, &before)
+			}
+			if c.MaxAttr > i {
+				after := *c
+				after.MinAttr = i + 1
+				cols.Col = append(cols.Col, &after)
+			}
+			c.MinAttr, c.MaxAttr = i, i
+			sort.Slice(cols.Col, func(a, b int) bool {
+				return cols.Col[a].MinAttr < cols.Col[b].MinAttr
+			})
+			return Column{c}
+		}
+	}
+	c := o.s.Column(i)
+	cols := o.s.x.Cols[0]
+	sort.Slice(cols.Col, func(a, b int) bool {
+		return cols.Col[a].MinAttr < cols.Col[b].MinAttr
+	})
+	return c
+}
+
+func (o columnOutline) level(i uint32) uint8 {
+	if c := o.find(i); c != nil && c.OutlineLevelAttr != nil {
+		return *c.OutlineLevelAttr
+	}
+	return 0
+}
+
+func (o columnOutline) setLevel(i uint32, l uint8) {
+	o.column(i).SetOutlineLevel(l)
+}
+
+func (o columnOutline) setHidden(i uint32, b bool) {
+	if o.find(i) != nil || b {
+		o.column(i).SetHidden(b)
+	}
+}
+
+func (o columnOutline) collapsed(i uint32) bool {
+	c := o.find(i)
+	return c != nil && c.CollapsedAttr != nil && *c.CollapsedAttr
+}
+
+func (o columnOutline) setCollapsed(i uint32, b bool) {
+	if o.find(i) != nil || b {
+		o.column(i).SetCollapsed(b)
+	}
+}
+
+func (o columnOutline) summaryAfter() bool {
+	pr := o.s.x.SheetPr
+	return pr == nil || pr.OutlinePr == nil || pr.OutlinePr.SummaryRightAttr == nil ||
+		*pr.OutlinePr.SummaryRightAttr
+}
+
+// summary returns the index of the summary row or column of a group, which is
+// zero if it's before the first one.
+func summary(o outline, first, last uint32) uint32 {
+	if o.summaryAfter() {
+		return last + 1
+	}
+	return first - 1
+}
+
+// group adds the rows or columns to a group, nested in any groups they're
+// already in.
+func group(o outline, first, last uint32) error {
+	if first == 0 || first > last {
+		return fmt.Errorf("invalid range %d:%d", first, last)
+	}
+	for i := first; i <= last; i++ {
+		if o.level(i) >= maxOutlineLevel {
+			return fmt.Errorf("groups can't be nested more than %d levels", maxOutlineLevel)
+		}
+	}
+	for i := first; i <= last; i++ {
+		o.setLevel(i, o.level(i)+1)
+	}
+	return nil
+}
+
+// ungroup removes the rows or columns from their innermost group, showing any
+// that were hidden as the group was collapsed.
+func ungroup(o outline, first, last uint32) error {
+	if first == 0 || first > last {
+		return fmt.Errorf("invalid range %d:%d", first, last)
+	}
+	changed := map[uint32]bool{}
+	for i := first; i <= last; i++ {
+		if l := o.level(i); l > 0 {
+			o.setLevel(i, l-1)
+			changed[i] = true
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	// the summaries no longer summarize a group if there isn't one next to them
+	for _, s := range []uint32{first - 1, last + 1} {
+		if s == 0 || !o.collapsed(s) {
+			continue
+		}
+		next := s + 1
+		if o.summaryAfter() {
+			next = s - 1
+		}
+		if next == 0 || o.level(next) <= o.level(s) {
+			o.setCollapsed(s, false)
+		}
+	}
+	// and their rows or columns are only hidden if a group that they're
+	// still in is collapsed
+	a, b := first, last
+	for a > 1 && o.level(a-1) > 0 {
+		a--
+	}
+	for o.level(b+1) > 0 {
+		b++
+	}
+	show(o, a, b, 0, false, func(i uint32, hidden bool) {
+		if changed[i] {
+			o.setHidden(i, hidden)
+		}
+	})
+	return nil
+}
+
+// show determines which of the rows or columns in a range, whose outline level
+// is at least lvl, are hidden by collapsed groups.
+func show(o outline, first, last uint32, lvl uint8, hidden bool, set func(i uint32, hidden bool)) {
+	for i := first; i <= last; {
+		if o.level(i) <= lvl {
+			set(i, hidden)
+			i++
+			continue
+		}
+		// a group nested in this one
+		j := i
+		for j < last && o.level(j+1) > lvl {
+			j++
+		}
+		show(o, i, j, lvl+1, hidden || o.collapsed(summary(o, i, j)), set)
+		i = j + 1
+	}
+}
+
+// collapse collapses or expands a group of rows or columns, hiding or showing
+// them.  Groups nested in the group stay collapsed when it's expanded.
+func collapse(o outline, first, last uint32, collapsed bool) error {
+	if first == 0 || first > last {
+		return fmt.Errorf("invalid range %d:%d", first, last)
+	}
+	lvl := uint8(maxOutlineLevel)
+	for i := first; i <= last; i++ {
+		if l := o.level(i); l < lvl {
+			lvl = l
+		}
+	}
+	if lvl == 0 {
+		return errors.New("range isn't grouped")
+	}
+	s := summary(o, first, last)
+	if s == 0 {
+		return errors.New("group has no summary row or column")
+	}
+	o.setCollapsed(s, collapsed)
+	show(o, first, last, lvl, collapsed, o.setHidden)
+	return nil
+}
+
+// updateOutlineLevels sets the outline levels of the sheet, which are the
+// maximum outline levels of its rows and columns.
+func (s Sheet) updateOutlineLevels() {
+	rows, cols := uint8(0), uint8(0)
+	for _, r := range s.x.SheetData.Row {
+		if r.OutlineLevelAttr != nil && *r.OutlineLevelAttr > rows {
+			rows = *r.OutlineLevelAttr
+		}
+	}
+	for _, cs := range s.x.Cols {
+		for _, c := range cs.Col {
+			if c.OutlineLevelAttr != nil && *c.OutlineLevelAttr > cols {
+				cols = *c.OutlineLevelAttr
+			}
+		}
+	}
+	if s.x.SheetFormatPr == nil {
+		if rows == 0 && cols == 0 {
+			return
+		}
+		s.x.SheetFormatPr = sml.NewCT_SheetFormatPr()
+		s.x.SheetFormatPr.DefaultRowHeightAttr = 15
+	}
+	s.x.SheetFormatPr.OutlineLevelRowAttr = nil
+	if rows > 0 {
+		s.x.SheetFormatPr.OutlineLevelRowAttr = unioffice.Uint8(rows)
+	}
+	s.x.SheetFormatPr.OutlineLevelColAttr = nil
+	if cols > 0 {
+		s.x.SheetFormatPr.OutlineLevelColAttr = unioffice.Uint8(cols)
+	}
+}
+
+// GroupRows groups rows (1-N), nesting the group in any groups that the rows
+// are already in.
+func (s Sheet) GroupRows(first, last uint32) error {
+	if err := group(newRowOutline(s), first, last); err != nil {
+		return err
+	}
+	s.updateOutlineLevels()
+	return nil
+}
+
+// UngroupRows removes rows (1-N) from their innermost group, showing any rows
+// that were hidden as the group was collapsed.
+func (s Sheet) UngroupRows(first, last uint32) error {
+	if err := ungroup(newRowOutline(s), first, last); err != nil {
+		return err
+	}
+	s.updateOutlineLevels()
+	return nil
+}
+
+// CollapseRows collapses a group of rows (1-N), hiding them and marking the
+// summary row below (or above) the group as collapsed.
+func (s Sheet) CollapseRows(first, last uint32) error {
+	return collapse(newRowOutline(s), first, last, true)
+}
+
+// ExpandRows expands a collapsed group of rows (1-N), showing them apart from
+// those in nested groups that are collapsed.
+func (s Sheet) ExpandRows(first, last uint32) error {
+	return collapse(newRowOutline(s), first, last, false)
+}
+
+// columnRange returns the 1-based indexes of a range of columns (e.g. "B" to
+// "D").
+func columnRange(first, last string) (uint32, uint32) {
+	return reference.ColumnToIndex(first) + 1, reference.ColumnToIndex(last) + 1
+}
+
+// GroupColumns groups columns (e.g. "B" to "D"), nesting the group in any
+// groups that the columns are already in.
+func (s Sheet) GroupColumns(first, last string) error {
+	a, b := columnRange(first, last)
+	if err := group(columnOutline{s}, a, b); err != nil {
+		return err
+	}
+	s.updateOutlineLevels()
+	return nil
+}
+
+// UngroupColumns removes columns from their innermost group, showing any
+// columns that were hidden as the group was collapsed.
+func (s Sheet) UngroupColumns(first, last string) error {
+	a, b := columnRange(first, last)
+	if err := ungroup(columnOutline{s}, a, b); err != nil {
+		return err
+	}
+	s.updateOutlineLevels()
+	return nil
+}
+
+// CollapseColumns collapses a group of columns, hiding them and marking the
+// summary column to the right (or left) of the group as collapsed.
+func (s Sheet) CollapseColumns(first, last string) error {
+	a, b := columnRange(first, last)
+	return collapse(columnOutline{s}, a, b, true)
+}
+
+// ExpandColumns expands a collapsed group of columns, showing them apart from
+// those in nested groups that are collapsed.
+func (s Sheet) ExpandColumns(first, last string) error {
+	a, b := columnRange(first, last)
+	return collapse(columnOutline{s}, a, b, false)
+}
+
+// SetOutlineSummary sets whether the summary rows of groups are below them,
+// rather than above, and the summary columns to the right of them, rather than
+// to the left, which is the default.
+func (s Sheet) SetOutlineSummary(below, right bool) {
+	if s.x.SheetPr == nil {
+		s.x.SheetPr = sml.NewCT_SheetPr()
+	}
+	if s.x.SheetPr.OutlinePr == nil {
+		s.x.SheetPr.OutlinePr = sml.NewCT_OutlinePr()
+	}
+	pr := s.x.SheetPr.OutlinePr
+	pr.SummaryBelowAttr = nil
+	if !below {
+		pr.SummaryBelowAttr = unioffice.Bool(false)
+	}
+	pr.SummaryRightAttr = nil
+	if !right {
+		pr.SummaryRightAttr = unioffice.Bool(false)
+	}
+}
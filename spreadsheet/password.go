@@ -8,7 +8,12 @@
 package spreadsheet
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
+
+	"github.com/unidoc/unioffice/encryption"
 )
 
 // PasswordHash returns the password hash for a workbook using the modified
@@ -27,3 +32,52 @@ func PasswordHash(s string) string {
 	}
 	return fmt.Sprintf("%04X", uint64(hash))
 }
+
+// ReadWithPassword reads a workbook that is encrypted with a password.
+// Workbooks that aren't encrypted are read as by Read.
+func ReadWithPassword(r io.ReaderAt, size int64, password string) (*Workbook, error) {
+	if !encryption.IsEncrypted(r) {
+		return Read(r, size)
+	}
+	pkg, err := encryption.Decrypt(r, size, password)
+	if err != nil {
+		return nil, err
+	}
+	return Read(bytes.NewReader(pkg), int64(len(pkg)))
+}
+
+// OpenWithPassword opens and reads a workbook from a file (.xlsx) that is
+// encrypted with a password.
+func OpenWithPassword(filename, password string) (*Workbook, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %s", filename, err)
+	}
+	defer f.Close()
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %s", filename, err)
+	}
+	return ReadWithPassword(f, fi.Size(), password)
+}
+
+// SaveWithPassword writes the workbook to an io.Writer encrypted with a
+// password, using the agile encryption of current versions of Excel.
+func (wb *Workbook) SaveWithPassword(w io.Writer, password string) error {
+	buf := bytes.Buffer{}
+	if err := wb.Save(&buf); err != nil {
+		return err
+	}
+	return encryption.Encrypt(w, buf.Bytes(), password, encryption.MethodAgile)
+}
+
+// SaveToFileWithPassword writes the workbook to a file encrypted with a
+// password.
+func (wb *Workbook) SaveToFileWithPassword(path, password string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return wb.SaveWithPassword(f, password)
+}
@@ -8,8 +8,10 @@
 package spreadsheet_test
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/unidoc/unioffice/encryption"
 	"github.com/unidoc/unioffice/spreadsheet"
 )
 
@@ -27,3 +29,36 @@ func TestKnownHashes(t *testing.T) {
 		}
 	}
 }
+
+func TestSaveWithPassword(t *testing.T) {
+	wb := spreadsheet.New()
+	wb.AddSheet().Cell("A1").SetString("secret")
+
+	buf := bytes.Buffer{}
+	if err := wb.SaveWithPassword(&buf, "gooxml"); err != nil {
+		t.Fatalf("error saving: %s", err)
+	}
+	r := bytes.NewReader(buf.Bytes())
+	if _, err := spreadsheet.Read(r, int64(buf.Len())); err != encryption.ErrEncrypted {
+		t.Errorf("expected an encrypted workbook error, got %v", err)
+	}
+	if _, err := spreadsheet.ReadWithPassword(r, int64(buf.Len()), "wrong"); err != encryption.ErrInvalidPassword {
+		t.Errorf("expected an invalid password error, got %v", err)
+	}
+	wb2, err := spreadsheet.ReadWithPassword(r, int64(buf.Len()), "gooxml")
+	if err != nil {
+		t.Fatalf("error reading: %s", err)
+	}
+	if got := wb2.Sheets()[0].Cell("A1").GetString(); got != "secret" {
+		t.Errorf("expected A1 = secret, got %s", got)
+	}
+
+	// workbooks encrypted with the default password open without one
+	buf.Reset()
+	if err := wb.SaveWithPassword(&buf, encryption.DefaultPassword); err != nil {
+		t.Fatalf("error saving: %s", err)
+	}
+	if _, err := spreadsheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Errorf("expected to read a workbook with the default password, got %s", err)
+	}
+}
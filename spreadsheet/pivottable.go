@@ -0,0 +1,1517 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/common"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// PivotTable is a pivot table on a sheet that summarizes the data stored in a
+// pivot cache.  Pivot tables are laid out in tabular form, and the summarized
+// values are written to the sheet whenever fields are added so that the pivot
+// table is populated when the workbook is opened.
+type PivotTable struct {
+	s       Sheet
+	x       *sml.PivotTableDefinition
+	cache   *sml.PivotCacheDefinition
+	records *sml.PivotCacheRecords
+}
+
+// X returns the inner wrapped XML type.
+func (p PivotTable) X() *sml.PivotTableDefinition {
+	return p.x
+}
+
+// CacheDefinition returns the definition of the pivot cache that the pivot
+// table summarizes.
+func (p PivotTable) CacheDefinition() *sml.PivotCacheDefinition {
+	return p.cache
+}
+
+// CacheRecords returns the records of the pivot cache, or nil if the records
+// are not stored in the workbook.
+func (p PivotTable) CacheRecords() *sml.PivotCacheRecords {
+	return p.records
+}
+
+// Name returns the name of the pivot table.
+func (p PivotTable) Name() string {
+	return p.x.NameAttr
+}
+
+// Reference returns the cells occupied by the pivot table, not including any
+// page fields that are displayed above it.
+func (p PivotTable) Reference() string {
+	return p.x.Location.RefAttr
+}
+
+// Source returns the source of the pivot cache data, either a range reference
+// that includes the sheet name (e.g. 'Sheet 1'!A1:D10) or the name of a table
+// or defined name.
+func (p PivotTable) Source() string {
+	if p.cache.CacheSource == nil || p.cache.CacheSource.WorksheetSource == nil {
+		return ""
+	}
+	ws := p.cache.CacheSource.WorksheetSource
+	if ws.NameAttr != nil {
+		return *ws.NameAttr
+	}
+	if ws.RefAttr == nil {
+		return ""
+	}
+	if ws.SheetAttr == nil {
+		return *ws.RefAttr
+	}
+	return reference.QuoteSheetName(*ws.SheetAttr) + "!" + *ws.RefAttr
+}
+
+// Fields returns the names of the fields in the pivot cache, which are the
+// column headings of the source data.
+func (p PivotTable) Fields() []string {
+	ret := []string{}
+	for _, f := range p.cache.CacheFields.CacheField {
+		ret = append(ret, f.NameAttr)
+	}
+	return ret
+}
+
+// RowFields returns the names of the fields on the row axis.
+func (p PivotTable) RowFields() []string {
+	if p.x.RowFields == nil {
+		return nil
+	}
+	return p.fieldNames(p.x.RowFields.Field)
+}
+
+// ColumnFields returns the names of the fields on the column axis.  If the
+// pivot table has more than one data field, the data fields are arranged on
+// the column axis as a field named by the data caption ("Values").
+func (p PivotTable) ColumnFields() []string {
+	if p.x.ColFields == nil {
+		return nil
+	}
+	return p.fieldNames(p.x.ColFields.Field)
+}
+
+// PageFields returns the names of the page fields that are used to filter the
+// pivot table.
+func (p PivotTable) PageFields() []string {
+	ret := []string{}
+	if p.x.PageFields == nil {
+		return ret
+	}
+	for _, f := range p.x.PageFields.PageField {
+		ret = append(ret, p.fieldName(f.FldAttr))
+	}
+	return ret
+}
+
+// DataFields returns the fields whose values are summarized by the pivot
+// table.
+func (p PivotTable) DataFields() []PivotDataField {
+	ret := []PivotDataField{}
+	if p.x.DataFields == nil {
+		return ret
+	}
+	for _, df := range p.x.DataFields.DataField {
+		ret = append(ret, PivotDataField{p, df})
+	}
+	return ret
+}
+
+func (p PivotTable) fieldNames(fields []*sml.CT_Field) []string {
+	ret := []string{}
+	for _, f := range fields {
+		ret = append(ret, p.fieldName(f.XAttr))
+	}
+	return ret
+}
+
+// fieldName returns the name of a cache field, or the data caption for the
+// field used to arrange multiple data fields (-2).
+func (p PivotTable) fieldName(idx int32) string {
+	if idx == -2 {
+		if p.x.DataCaptionAttr == "" {
+			return "Values"
+		}
+		return p.x.DataCaptionAttr
+	}
+	if idx < 0 || int(idx) >= len(p.cache.CacheFields.CacheField) {
+		return ""
+	}
+	return p.cache.CacheFields.CacheField[idx].NameAttr
+}
+
+func (p PivotTable) fieldIndex(name string) (int, error) {
+	for i, f := range p.cache.CacheFields.CacheField {
+		if f.NameAttr == name {
+			if p.x.PivotFields == nil || i >= len(p.x.PivotFields.PivotField) {
+				break
+			}
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("pivot table field %s not found", name)
+}
+
+// AddRowField adds a field to the row axis, with a row for each of its
+// distinct values.
+func (p PivotTable) AddRowField(name string) error {
+	return p.addAxisField(name, sml.ST_AxisAxisRow)
+}
+
+// AddColumnField adds a field to the column axis, with a column for each of
+// its distinct values.
+func (p PivotTable) AddColumnField(name string) error {
+	return p.addAxisField(name, sml.ST_AxisAxisCol)
+}
+
+// AddPageField adds a page field which is displayed above the pivot table and
+// can be used to filter it.
+func (p PivotTable) AddPageField(name string) error {
+	return p.addAxisField(name, sml.ST_AxisAxisPage)
+}
+
+func (p PivotTable) addAxisField(name string, axis sml.ST_Axis) error {
+	idx, err := p.fieldIndex(name)
+	if err != nil {
+		return err
+	}
+	pf := p.x.PivotFields.PivotField[idx]
+	if pf.AxisAttr != sml.ST_AxisUnset {
+		return fmt.Errorf("pivot table field %s is already in use", name)
+	}
+	pf.AxisAttr = axis
+	setPivotFieldItems(pf, p.sharedItems()[idx])
+
+	fld := sml.NewCT_Field()
+	fld.XAttr = int32(idx)
+	switch axis {
+	case sml.ST_AxisAxisRow:
+		if p.x.RowFields == nil {
+			p.x.RowFields = sml.NewCT_RowFields()
+		}
+		p.x.RowFields.Field = append(p.x.RowFields.Field, fld)
+		p.x.RowFields.CountAttr = unioffice.Uint32(uint32(len(p.x.RowFields.Field)))
+	case sml.ST_AxisAxisCol:
+		if p.x.ColFields == nil {
+			p.x.ColFields = sml.NewCT_ColFields()
+		}
+		// keep the data fields innermost
+		fields := p.x.ColFields.Field
+		if n := len(fields); n > 0 && fields[n-1].XAttr == -2 {
+			fields = append(fields[:n-1], fld, fields[n-1])
+		} else {
+			fields = append(fields, fld)
+		}
+		p.x.ColFields.Field = fields
+		p.x.ColFields.CountAttr = unioffice.Uint32(uint32(len(fields)))
+	case sml.ST_AxisAxisPage:
+		if p.x.PageFields == nil {
+			p.x.PageFields = sml.NewCT_PageFields()
+		}
+		pg := sml.NewCT_PageField()
+		pg.FldAttr = int32(idx)
+		pg.HierAttr = unioffice.Int32(-1)
+		p.x.PageFields.PageField = append(p.x.PageFields.PageField, pg)
+		p.x.PageFields.CountAttr = unioffice.Uint32(uint32(len(p.x.PageFields.PageField)))
+	}
+	return p.render()
+}
+
+// pivotFunctionNames are the names used in the default caption of a data
+// field.
+var pivotFunctionNames = map[sml.ST_DataConsolidateFunction]string{
+	sml.ST_DataConsolidateFunctionAverage:   "Average",
+	sml.ST_DataConsolidateFunctionCount:     "Count",
+	sml.ST_DataConsolidateFunctionCountNums: "Count",
+	sml.ST_DataConsolidateFunctionMax:       "Max",
+	sml.ST_DataConsolidateFunctionMin:       "Min",
+	sml.ST_DataConsolidateFunctionProduct:   "Product",
+	sml.ST_DataConsolidateFunctionStdDev:    "StdDev",
+	sml.ST_DataConsolidateFunctionStdDevp:   "StdDevp",
+	sml.ST_DataConsolidateFunctionSum:       "Sum",
+	sml.ST_DataConsolidateFunctionVar:       "Var",
+	sml.ST_DataConsolidateFunctionVarp:      "Varp",
+}
+
+// AddDataField adds a field whose values are summarized by the pivot table
+// using an aggregation function, e.g. sml.ST_DataConsolidateFunctionSum.  The
+// data field is named after the function and field, e.g. "Sum of Sales".
+func (p PivotTable) AddDataField(name string, fn sml.ST_DataConsolidateFunction) (PivotDataField, error) {
+	idx, err := p.fieldIndex(name)
+	if err != nil {
+		return PivotDataField{}, err
+	}
+	if fn == sml.ST_DataConsolidateFunctionUnset {
+		fn = sml.ST_DataConsolidateFunctionSum
+	}
+	fnName, ok := pivotFunctionNames[fn]
+	if !ok {
+		return PivotDataField{}, fmt.Errorf("unsupported pivot table function %s", fn)
+	}
+	if p.x.DataFields == nil {
+		p.x.DataFields = sml.NewCT_DataFields()
+	}
+	caption := fmt.Sprintf("%s of %s", fnName, name)
+	for i := 2; p.hasDataField(caption); i++ {
+		caption = fmt.Sprintf("%s of %s%d", fnName, name, i)
+	}
+
+	df := sml.NewCT_DataField()
+	df.NameAttr = unioffice.String(caption)
+	df.FldAttr = uint32(idx)
+	df.SubtotalAttr = fn
+	p.x.DataFields.DataField = append(p.x.DataFields.DataField, df)
+	p.x.DataFields.CountAttr = unioffice.Uint32(uint32(len(p.x.DataFields.DataField)))
+	p.x.PivotFields.PivotField[idx].DataFieldAttr = unioffice.Bool(true)
+
+	// multiple data fields are arranged across the columns
+	if len(p.x.DataFields.DataField) == 2 && !p.hasValuesField() {
+		if p.x.ColFields == nil {
+			p.x.ColFields = sml.NewCT_ColFields()
+		}
+		fld := sml.NewCT_Field()
+		fld.XAttr = -2
+		p.x.ColFields.Field = append(p.x.ColFields.Field, fld)
+		p.x.ColFields.CountAttr = unioffice.Uint32(uint32(len(p.x.ColFields.Field)))
+	}
+	return PivotDataField{p, df}, p.render()
+}
+
+func (p PivotTable) hasDataField(name string) bool {
+	for _, df := range p.x.DataFields.DataField {
+		if df.NameAttr != nil && *df.NameAttr == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasValuesField returns true if the field that arranges multiple data fields
+// is on either axis.
+func (p PivotTable) hasValuesField() bool {
+	for _, f := range append(pivotAxisFields(p.x.RowFields), pivotAxisFields(p.x.ColFields)...) {
+		if f == -2 {
+			return true
+		}
+	}
+	return false
+}
+
+// pivotAxisFields returns the field indexes of a row or column axis.
+func pivotAxisFields(fields interface{}) []int32 {
+	var flds []*sml.CT_Field
+	switch f := fields.(type) {
+	case *sml.CT_RowFields:
+		if f != nil {
+			flds = f.Field
+		}
+	case *sml.CT_ColFields:
+		if f != nil {
+			flds = f.Field
+		}
+	}
+	ret := []int32{}
+	for _, f := range flds {
+		ret = append(ret, f.XAttr)
+	}
+	return ret
+}
+
+// Refresh reads the source data into the pivot cache and updates the values
+// displayed by the pivot table.  Fields are matched to the new source data by
+// name, and fields that no longer exist are removed from the pivot table.
+func (p PivotTable) Refresh() error {
+	names, rows, err := p.s.w.pivotSourceData(p.cache.CacheSource)
+	if err != nil {
+		return err
+	}
+	old := p.Fields()
+	p.setCache(names, rows)
+
+	idx := map[string]int32{}
+	for i, n := range names {
+		idx[n] = int32(i)
+	}
+	remap := map[int32]int32{-2: -2}
+	fields := make([]*sml.CT_PivotField, len(names))
+	for i, n := range old {
+		if j, ok := idx[n]; ok && p.x.PivotFields != nil && i < len(p.x.PivotFields.PivotField) {
+			fields[j] = p.x.PivotFields.PivotField[i]
+			remap[int32(i)] = j
+		}
+	}
+	items := p.sharedItems()
+	for i, pf := range fields {
+		if pf == nil {
+			fields[i] = newPivotField()
+		} else if pf.AxisAttr != sml.ST_AxisUnset {
+			setPivotFieldItems(pf, items[i])
+		}
+	}
+	p.x.PivotFields = sml.NewCT_PivotFields()
+	p.x.PivotFields.PivotField = fields
+	p.x.PivotFields.CountAttr = unioffice.Uint32(uint32(len(fields)))
+
+	remapFields := func(flds []*sml.CT_Field) []*sml.CT_Field {
+		ret := []*sml.CT_Field{}
+		for _, f := range flds {
+			if j, ok := remap[f.XAttr]; ok {
+				f.XAttr = j
+				ret = append(ret, f)
+			}
+		}
+		return ret
+	}
+	if p.x.RowFields != nil {
+		p.x.RowFields.Field = remapFields(p.x.RowFields.Field)
+		p.x.RowFields.CountAttr = unioffice.Uint32(uint32(len(p.x.RowFields.Field)))
+	}
+	if p.x.ColFields != nil {
+		p.x.ColFields.Field = remapFields(p.x.ColFields.Field)
+		p.x.ColFields.CountAttr = unioffice.Uint32(uint32(len(p.x.ColFields.Field)))
+	}
+	if p.x.PageFields != nil {
+		pages := []*sml.CT_PageField{}
+		for _, pg := range p.x.PageFields.PageField {
+			if j, ok := remap[pg.FldAttr]; ok {
+				// item indexes may have changed
+				pg.FldAttr = j
+				pg.ItemAttr = nil
+				pages = append(pages, pg)
+			}
+		}
+		p.x.PageFields.PageField = pages
+		p.x.PageFields.CountAttr = unioffice.Uint32(uint32(len(pages)))
+	}
+	if p.x.DataFields != nil {
+		data := []*sml.CT_DataField{}
+		for _, df := range p.x.DataFields.DataField {
+			if j, ok := remap[int32(df.FldAttr)]; ok {
+				df.FldAttr = uint32(j)
+				data = append(data, df)
+			}
+		}
+		p.x.DataFields.DataField = data
+		p.x.DataFields.CountAttr = unioffice.Uint32(uint32(len(data)))
+	}
+	return p.render()
+}
+
+// newPivotField returns a pivot field that is laid out in tabular form.
+func newPivotField() *sml.CT_PivotField {
+	pf := sml.NewCT_PivotField()
+	pf.ShowAllAttr = unioffice.Bool(false)
+	pf.CompactAttr = unioffice.Bool(false)
+	pf.OutlineAttr = unioffice.Bool(false)
+	return pf
+}
+
+// setPivotFieldItems sets the items of an axis field to its shared items in
+// sorted order, without subtotals.
+func setPivotFieldItems(pf *sml.CT_PivotField, shared []pivotItem) {
+	order := make([]int, len(shared))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return comparePivotItems(shared[order[a]], shared[order[b]]) < 0
+	})
+	pf.Items = sml.NewCT_Items()
+	for _, i := range order {
+		it := sml.NewCT_Item()
+		it.XAttr = unioffice.Uint32(uint32(i))
+		pf.Items.Item = append(pf.Items.Item, it)
+	}
+	pf.Items.CountAttr = unioffice.Uint32(uint32(len(pf.Items.Item)))
+	pf.DefaultSubtotalAttr = unioffice.Bool(false)
+}
+
+// PivotDataField is a field whose values are summarized in a pivot table.
+type PivotDataField struct {
+	p PivotTable
+	x *sml.CT_DataField
+}
+
+// X returns the inner wrapped XML type.
+func (d PivotDataField) X() *sml.CT_DataField {
+	return d.x
+}
+
+// Name returns the name of the data field, e.g. "Sum of Sales".
+func (d PivotDataField) Name() string {
+	if d.x.NameAttr != nil {
+		return *d.x.NameAttr
+	}
+	return ""
+}
+
+// Field returns the name of the field whose values are summarized.
+func (d PivotDataField) Field() string {
+	return d.p.fieldName(int32(d.x.FldAttr))
+}
+
+// Function returns the function used to summarize the values.
+func (d PivotDataField) Function() sml.ST_DataConsolidateFunction {
+	if d.x.SubtotalAttr == sml.ST_DataConsolidateFunctionUnset {
+		return sml.ST_DataConsolidateFunctionSum
+	}
+	return d.x.SubtotalAttr
+}
+
+type pivotItemType byte
+
+// the order matches the order that shared items are stored in by type
+const (
+	pivotItemMissing pivotItemType = iota
+	pivotItemNumber
+	pivotItemBool
+	pivotItemError
+	pivotItemString
+)
+
+// pivotItem is a value in a pivot cache.
+type pivotItem struct {
+	typ pivotItemType
+	n   float64
+	s   string
+}
+
+func cellPivotItem(c Cell) pivotItem {
+	switch {
+	case c.x.V == nil && c.x.Is == nil:
+		return pivotItem{}
+	case c.IsBool():
+		b, _ := c.GetValueAsBool()
+		if b {
+			return pivotItem{typ: pivotItemBool, n: 1}
+		}
+		return pivotItem{typ: pivotItemBool}
+	case c.IsNumber():
+		v, _ := c.GetValueAsNumber()
+		return pivotItem{typ: pivotItemNumber, n: v}
+	case c.x.TAttr == sml.ST_CellTypeE:
+		return pivotItem{typ: pivotItemError, s: c.GetString()}
+	}
+	return pivotItem{typ: pivotItemString, s: c.GetString()}
+}
+
+func (i pivotItem) String() string {
+	switch i.typ {
+	case pivotItemMissing:
+		return "(blank)"
+	case pivotItemNumber:
+		return strconv.FormatFloat(i.n, 'f', -1, 64)
+	case pivotItemBool:
+		if i.n != 0 {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	return i.s
+}
+
+// comparePivotItems orders items in the same way as Excel sorts, numbers
+// followed by text, logical values, errors and then blanks.
+func comparePivotItems(a, b pivotItem) int {
+	rank := map[pivotItemType]int{pivotItemNumber: 0, pivotItemString: 1, pivotItemBool: 2, pivotItemError: 3, pivotItemMissing: 4}
+	if ra, rb := rank[a.typ], rank[b.typ]; ra != rb {
+		return ra - rb
+	}
+	switch {
+	case a.n < b.n:
+		return -1
+	case a.n > b.n:
+		return 1
+	}
+	return strings.Compare(strings.ToLower(a.s), strings.ToLower(b.s))
+}
+
+// setCache replaces the fields and records of the pivot cache.  Every value is
+// stored as a shared item so that the records refer to them by index.
+func (p PivotTable) setCache(names []string, rows [][]pivotItem) {
+	p.cache.CacheFields = sml.NewCT_CacheFields()
+	indexes := make([]map[pivotItem]uint32, len(names))
+	for i, name := range names {
+		values := make([]pivotItem, len(rows))
+		for j, r := range rows {
+			values[j] = r[i]
+		}
+		var cf *sml.CT_CacheField
+		cf, indexes[i] = newPivotCacheField(name, values)
+		p.cache.CacheFields.CacheField = append(p.cache.CacheFields.CacheField, cf)
+	}
+	p.cache.CacheFields.CountAttr = unioffice.Uint32(uint32(len(names)))
+	p.cache.RecordCountAttr = unioffice.Uint32(uint32(len(rows)))
+
+	if p.records == nil {
+		return
+	}
+	p.records.R = nil
+	for _, r := range rows {
+		rec := sml.NewCT_Record()
+		for i, v := range r {
+			idx := sml.NewCT_Index()
+			idx.VAttr = indexes[i][v]
+			rec.X = append(rec.X, idx)
+		}
+		p.records.R = append(p.records.R, rec)
+	}
+	p.records.CountAttr = unioffice.Uint32(uint32(len(rows)))
+}
+
+// newPivotCacheField constructs a cache field with the distinct values of a
+// field as its shared items, returning the index of each value.
+func newPivotCacheField(name string, values []pivotItem) (*sml.CT_CacheField, map[pivotItem]uint32) {
+	byType := map[pivotItemType][]pivotItem{}
+	seen := map[pivotItem]struct{}{}
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		byType[v.typ] = append(byType[v.typ], v)
+	}
+
+	cf := sml.NewCT_CacheField()
+	cf.NameAttr = name
+	cf.NumFmtIdAttr = unioffice.Uint32(0)
+	si := sml.NewCT_SharedItems()
+	cf.SharedItems = si
+	indexes := map[pivotItem]uint32{}
+	idx := uint32(0)
+	for typ := pivotItemMissing; typ <= pivotItemString; typ++ {
+		for _, v := range byType[typ] {
+			switch typ {
+			case pivotItemMissing:
+				si.M = append(si.M, sml.NewCT_Missing())
+			case pivotItemNumber:
+				n := sml.NewCT_Number()
+				n.VAttr = v.n
+				si.N = append(si.N, n)
+			case pivotItemBool:
+				b := sml.NewCT_Boolean()
+				b.VAttr = v.n != 0
+				si.B = append(si.B, b)
+			case pivotItemError:
+				e := sml.NewCT_Error()
+				e.VAttr = v.s
+				si.E = append(si.E, e)
+			case pivotItemString:
+				s := sml.NewCT_String()
+				s.VAttr = v.s
+				si.S = append(si.S, s)
+			}
+			indexes[v] = idx
+			idx++
+		}
+	}
+	si.CountAttr = unioffice.Uint32(idx)
+
+	// describe the types of values, the defaults are for text
+	if len(byType[pivotItemMissing]) > 0 {
+		si.ContainsBlankAttr = unioffice.Bool(true)
+	}
+	if len(byType[pivotItemString]) == 0 {
+		si.ContainsStringAttr = unioffice.Bool(false)
+		if len(byType[pivotItemMissing]) == 0 {
+			si.ContainsSemiMixedTypesAttr = unioffice.Bool(false)
+		}
+	}
+	if nums := byType[pivotItemNumber]; len(nums) > 0 {
+		si.ContainsNumberAttr = unioffice.Bool(true)
+		integer := true
+		min, max := nums[0].n, nums[0].n
+		for _, v := range nums {
+			integer = integer && v.n == math.Trunc(v.n)
+			min, max = math.Min(min, v.n), math.Max(max, v.n)
+		}
+		if integer {
+			si.ContainsIntegerAttr = unioffice.Bool(true)
+		}
+		si.MinValueAttr = unioffice.Float64(min)
+		si.MaxValueAttr = unioffice.Float64(max)
+	}
+	types := 0
+	for typ := pivotItemNumber; typ <= pivotItemString; typ++ {
+		if len(byType[typ]) > 0 {
+			types++
+		}
+	}
+	if types > 1 {
+		si.ContainsMixedTypesAttr = unioffice.Bool(true)
+	}
+	return cf, indexes
+}
+
+// sharedItems returns the shared items of each cache field in index order.
+func (p PivotTable) sharedItems() [][]pivotItem {
+	ret := [][]pivotItem{}
+	for _, f := range p.cache.CacheFields.CacheField {
+		items := []pivotItem{}
+		if si := f.SharedItems; si != nil {
+			for range si.M {
+				items = append(items, pivotItem{})
+			}
+			for _, n := range si.N {
+				items = append(items, pivotItem{typ: pivotItemNumber, n: n.VAttr})
+			}
+			for _, b := range si.B {
+				v := pivotItem{typ: pivotItemBool}
+				if b.VAttr {
+					v.n = 1
+				}
+				items = append(items, v)
+			}
+			for _, e := range si.E {
+				items = append(items, pivotItem{typ: pivotItemError, s: e.VAttr})
+			}
+			for _, s := range si.S {
+				items = append(items, pivotItem{typ: pivotItemString, s: s.VAttr})
+			}
+			for _, d := range si.D {
+				items = append(items, pivotItem{typ: pivotItemString, s: d.VAttr.Format("2006-01-02")})
+			}
+		}
+		ret = append(ret, items)
+	}
+	return ret
+}
+
+// cacheRecords returns the values of the records in the pivot cache.
+func (p PivotTable) cacheRecords(shared [][]pivotItem) [][]pivotItem {
+	if p.records == nil {
+		return nil
+	}
+	ret := [][]pivotItem{}
+	for _, r := range p.records.R {
+		// the values of a record are decoded by type, so values that aren't
+		// shared items are matched to fields by the types the field contains
+		var m, n, b, e, s, d, x int
+		rec := make([]pivotItem, len(shared))
+		for i, f := range p.cache.CacheFields.CacheField {
+			si := f.SharedItems
+			switch {
+			case len(shared[i]) > 0 && x < len(r.X):
+				if idx := int(r.X[x].VAttr); idx < len(shared[i]) {
+					rec[i] = shared[i][idx]
+				}
+				x++
+			case si != nil && si.ContainsDateAttr != nil && *si.ContainsDateAttr && d < len(r.D):
+				rec[i] = pivotItem{typ: pivotItemString, s: r.D[d].VAttr.Format("2006-01-02")}
+				d++
+			case si != nil && si.ContainsNumberAttr != nil && *si.ContainsNumberAttr && n < len(r.N):
+				rec[i] = pivotItem{typ: pivotItemNumber, n: r.N[n].VAttr}
+				n++
+			case s < len(r.S):
+				rec[i] = pivotItem{typ: pivotItemString, s: r.S[s].VAttr}
+				s++
+			case b < len(r.B):
+				rec[i] = pivotItem{typ: pivotItemBool}
+				if r.B[b].VAttr {
+					rec[i].n = 1
+				}
+				b++
+			case e < len(r.E):
+				rec[i] = pivotItem{typ: pivotItemError, s: r.E[e].VAttr}
+				e++
+			case m < len(r.M):
+				m++
+			}
+		}
+		ret = append(ret, rec)
+	}
+	return ret
+}
+
+// pivotSourceData reads the field names and the values of the records from
+// the source of a pivot cache.
+func (wb *Workbook) pivotSourceData(src *sml.CT_CacheSource) ([]string, [][]pivotItem, error) {
+	if src == nil || src.WorksheetSource == nil {
+		return nil, nil, errors.New("unsupported pivot cache source")
+	}
+	s, ref, err := wb.pivotSourceRange(src.WorksheetSource)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, to, err := reference.ParseRangeReference(strings.Replace(ref, "$", "", -1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pivot cache source %s: %s", ref, err)
+	}
+
+	values := make([][]pivotItem, to.RowIdx-from.RowIdx+1)
+	for i := range values {
+		values[i] = make([]pivotItem, to.ColumnIdx-from.ColumnIdx+1)
+	}
+	for _, r := range s.Rows() {
+		rn := r.RowNumber()
+		if rn < from.RowIdx || rn > to.RowIdx {
+			continue
+		}
+		for _, c := range r.Cells() {
+			cr, err := reference.ParseCellReference(c.Reference())
+			if err != nil || cr.ColumnIdx < from.ColumnIdx || cr.ColumnIdx > to.ColumnIdx {
+				continue
+			}
+			values[rn-from.RowIdx][cr.ColumnIdx-from.ColumnIdx] = cellPivotItem(c)
+		}
+	}
+
+	// the first row contains the field names
+	names := []string{}
+	used := map[string]struct{}{}
+	for i, v := range values[0] {
+		if v.typ == pivotItemMissing {
+			return nil, nil, fmt.Errorf("pivot table field name in %s%d is empty", reference.IndexToColumn(from.ColumnIdx+uint32(i)), from.RowIdx)
+		}
+		name := v.String()
+		for j := 2; ; j++ {
+			if _, ok := used[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("%s%d", v.String(), j)
+		}
+		used[name] = struct{}{}
+		names = append(names, name)
+	}
+	return names, values[1:], nil
+}
+
+// pivotSourceRange returns the sheet and range of cells that a pivot cache
+// source refers to.
+func (wb *Workbook) pivotSourceRange(src *sml.CT_WorksheetSource) (Sheet, string, error) {
+	if src.NameAttr != nil {
+		name := *src.NameAttr
+		for i, t := range wb.tables {
+			if (t.NameAttr != nil && *t.NameAttr == name) || t.DisplayNameAttr == name {
+				s, ok := wb.tableSheet(i)
+				if !ok {
+					break
+				}
+				ref := t.RefAttr
+				// the totals row isn't part of the data
+				if t.TotalsRowCountAttr != nil && *t.TotalsRowCountAttr > 0 {
+					if from, to, err := reference.ParseRangeReference(ref); err == nil {
+						ref = fmt.Sprintf("%s:%s%d", from, to.Column, to.RowIdx-*t.TotalsRowCountAttr)
+					}
+				}
+				return s, ref, nil
+			}
+		}
+		for _, dn := range wb.DefinedNames() {
+			if dn.Name() != name {
+				continue
+			}
+			if sheet, ref, ok := reference.SplitSheetPrefix(dn.Content()); ok {
+				s, err := wb.GetSheet(sheet)
+				return s, ref, err
+			}
+		}
+		return Sheet{}, "", fmt.Errorf("pivot cache source %s not found", name)
+	}
+	if src.SheetAttr == nil || src.RefAttr == nil {
+		return Sheet{}, "", errors.New("pivot cache source must have a sheet and reference")
+	}
+	s, err := wb.GetSheet(*src.SheetAttr)
+	return s, *src.RefAttr, err
+}
+
+// tableSheet returns the sheet that contains the table at an index.
+func (wb *Workbook) tableSheet(idx int) (Sheet, bool) {
+	target := unioffice.RelativeFilename(unioffice.DocTypeSpreadsheet, unioffice.WorksheetType, unioffice.TableType, idx+1)
+	for i, rels := range wb.xwsRels {
+		for _, r := range rels.Relationships() {
+			if r.Type() == unioffice.TableType && r.Target() == target {
+				return Sheet{wb, wb.x.Sheets.Sheet[i], wb.xws[i]}, true
+			}
+		}
+	}
+	return Sheet{}, false
+}
+
+// pivotTable returns the pivot table at an index along with its cache.
+func (wb *Workbook) pivotTable(s Sheet, idx int) PivotTable {
+	dt := unioffice.DocTypeSpreadsheet
+	pt := PivotTable{s: s, x: wb.pivotTables[idx], cache: sml.NewPivotCacheDefinition()}
+	for _, r := range wb.pivotTableRels[idx].Relationships() {
+		if r.Type() != unioffice.PivotCacheDefinitionType {
+			continue
+		}
+		for i := range wb.pivotCaches {
+			if r.Target() == unioffice.RelativeFilename(dt, unioffice.PivotTableType, unioffice.PivotCacheDefinitionType, i+1) {
+				pt.cache, pt.records = wb.pivotCaches[i], wb.pivotRecords[i]
+			}
+		}
+	}
+	return pt
+}
+
+// addPivotTable adds a pivot table with a new pivot cache for the source data.
+func (s Sheet) addPivotTable(name, location string, src *sml.CT_CacheSource) (PivotTable, error) {
+	loc, err := reference.ParseCellReference(location)
+	if err != nil {
+		return PivotTable{}, err
+	}
+	for _, pt := range s.PivotTables() {
+		if pt.Name() == name {
+			return PivotTable{}, fmt.Errorf("pivot table %s already exists", name)
+		}
+	}
+	names, rows, err := s.w.pivotSourceData(src)
+	if err != nil {
+		return PivotTable{}, err
+	}
+
+	wb := s.w
+	dt := unioffice.DocTypeSpreadsheet
+	cache := sml.NewPivotCacheDefinition()
+	cache.CacheSource = src
+	// Excel rebuilds the pivot table from the cache when the file is opened
+	cache.RefreshOnLoadAttr = unioffice.Bool(true)
+	cache.CreatedVersionAttr = unioffice.Uint8(3)
+	cache.RefreshedVersionAttr = unioffice.Uint8(3)
+	cache.MinRefreshableVersionAttr = unioffice.Uint8(3)
+	records := sml.NewPivotCacheRecords()
+	cacheRels := common.NewRelationships()
+	wb.pivotCaches = append(wb.pivotCaches, cache)
+	wb.pivotCacheRels = append(wb.pivotCacheRels, cacheRels)
+	wb.pivotRecords = append(wb.pivotRecords, records)
+	cacheIdx := len(wb.pivotCaches)
+	rel := cacheRels.AddAutoRelationship(dt, unioffice.PivotCacheDefinitionType, cacheIdx, unioffice.PivotCacheRecordsType)
+	cache.IdAttr = unioffice.String(rel.ID())
+	wb.ContentTypes.AddOverride(unioffice.AbsoluteFilename(dt, unioffice.PivotCacheDefinitionType, cacheIdx), unioffice.PivotCacheDefinitionContentType)
+	wb.ContentTypes.AddOverride(unioffice.AbsoluteFilename(dt, unioffice.PivotCacheRecordsType, cacheIdx), unioffice.PivotCacheRecordsContentType)
+
+	// the pivot table refers to the cache by its ID in the workbook
+	pc := sml.NewCT_PivotCache()
+	pc.IdAttr = wb.wbRels.AddAutoRelationship(dt, unioffice.OfficeDocumentType, cacheIdx, unioffice.PivotCacheDefinitionType).ID()
+	if wb.x.PivotCaches == nil {
+		wb.x.PivotCaches = sml.NewCT_PivotCaches()
+	}
+	for _, c := range wb.x.PivotCaches.PivotCache {
+		if c.CacheIdAttr >= pc.CacheIdAttr {
+			pc.CacheIdAttr = c.CacheIdAttr + 1
+		}
+	}
+	wb.x.PivotCaches.PivotCache = append(wb.x.PivotCaches.PivotCache, pc)
+
+	x := sml.NewPivotTableDefinition()
+	x.NameAttr = name
+	x.CacheIdAttr = pc.CacheIdAttr
+	x.DataCaptionAttr = "Values"
+	x.UpdatedVersionAttr = unioffice.Uint8(3)
+	x.MinRefreshableVersionAttr = unioffice.Uint8(3)
+	x.CreatedVersionAttr = unioffice.Uint8(3)
+	x.UseAutoFormattingAttr = unioffice.Bool(true)
+	x.ItemPrintTitlesAttr = unioffice.Bool(true)
+	x.IndentAttr = unioffice.Uint32(0)
+	x.CompactAttr = unioffice.Bool(false)
+	x.CompactDataAttr = unioffice.Bool(false)
+	x.Location.RefAttr = fmt.Sprintf("%s%d", loc.Column, loc.RowIdx)
+	x.PivotFields = sml.NewCT_PivotFields()
+	for range names {
+		x.PivotFields.PivotField = append(x.PivotFields.PivotField, newPivotField())
+	}
+	x.PivotFields.CountAttr = unioffice.Uint32(uint32(len(names)))
+	x.PivotTableStyleInfo = sml.NewCT_PivotTableStyle()
+	x.PivotTableStyleInfo.NameAttr = unioffice.String("PivotStyleLight16")
+	x.PivotTableStyleInfo.ShowRowHeadersAttr = unioffice.Bool(true)
+	x.PivotTableStyleInfo.ShowColHeadersAttr = unioffice.Bool(true)
+	x.PivotTableStyleInfo.ShowRowStripesAttr = unioffice.Bool(false)
+	x.PivotTableStyleInfo.ShowColStripesAttr = unioffice.Bool(false)
+	x.PivotTableStyleInfo.ShowLastColumnAttr = unioffice.Bool(true)
+
+	ptRels := common.NewRelationships()
+	wb.pivotTables = append(wb.pivotTables, x)
+	wb.pivotTableRels = append(wb.pivotTableRels, ptRels)
+	ptIdx := len(wb.pivotTables)
+	ptRels.AddAutoRelationship(dt, unioffice.PivotTableType, cacheIdx, unioffice.PivotCacheDefinitionType)
+	wb.ContentTypes.AddOverride(unioffice.AbsoluteFilename(dt, unioffice.PivotTableType, ptIdx), unioffice.PivotTableContentType)
+	for i, ws := range wb.xws {
+		if ws == s.x {
+			wb.xwsRels[i].AddAutoRelationship(dt, unioffice.WorksheetType, ptIdx, unioffice.PivotTableType)
+		}
+	}
+
+	pt := PivotTable{s, x, cache, records}
+	pt.setCache(names, rows)
+	return pt, pt.render()
+}
+
+// pivotAggregate accumulates the values of a data field.
+type pivotAggregate struct {
+	count  int
+	values []float64
+}
+
+func (a *pivotAggregate) add(v pivotItem) {
+	if v.typ == pivotItemMissing {
+		return
+	}
+	a.count++
+	if v.typ == pivotItemNumber {
+		a.values = append(a.values, v.n)
+	}
+}
+
+// result computes the summarized value, returning an error value if it can't
+// be computed.
+func (a *pivotAggregate) result(fn sml.ST_DataConsolidateFunction) (float64, string) {
+	n := float64(len(a.values))
+	sum := 0.0
+	for _, v := range a.values {
+		sum += v
+	}
+	variance := func(sample bool) (float64, string) {
+		if n == 0 || (sample && n == 1) {
+			return 0, "#DIV/0!"
+		}
+		ss := 0.0
+		for _, v := range a.values {
+			ss += (v - sum/n) * (v - sum/n)
+		}
+		if sample {
+			return ss / (n - 1), ""
+		}
+		return ss / n, ""
+	}
+	switch fn {
+	case sml.ST_DataConsolidateFunctionCount:
+		return float64(a.count), ""
+	case sml.ST_DataConsolidateFunctionCountNums:
+		return n, ""
+	case sml.ST_DataConsolidateFunctionAverage:
+		if n == 0 {
+			return 0, "#DIV/0!"
+		}
+		return sum / n, ""
+	case sml.ST_DataConsolidateFunctionMax, sml.ST_DataConsolidateFunctionMin:
+		if n == 0 {
+			return 0, ""
+		}
+		ret := a.values[0]
+		for _, v := range a.values {
+			if fn == sml.ST_DataConsolidateFunctionMax {
+				ret = math.Max(ret, v)
+			} else {
+				ret = math.Min(ret, v)
+			}
+		}
+		return ret, ""
+	case sml.ST_DataConsolidateFunctionProduct:
+		if n == 0 {
+			return 0, ""
+		}
+		ret := 1.0
+		for _, v := range a.values {
+			ret *= v
+		}
+		return ret, ""
+	case sml.ST_DataConsolidateFunctionStdDev, sml.ST_DataConsolidateFunctionStdDevp:
+		v, err := variance(fn == sml.ST_DataConsolidateFunctionStdDev)
+		return math.Sqrt(v), err
+	case sml.ST_DataConsolidateFunctionVar:
+		return variance(true)
+	case sml.ST_DataConsolidateFunctionVarp:
+		return variance(false)
+	}
+	return sum, ""
+}
+
+// pivotAxis is the layout of the row or column axis of a pivot table.
+type pivotAxis struct {
+	fields []int32
+	// tuples are the item positions of each field for each row or column,
+	// with the data field index used for the values field (-2)
+	tuples [][]int
+	// grand contains the data field index of each grand total, -1 if the
+	// data field is determined by the other axis
+	grand []int
+}
+
+// key returns the tuple's items of the cache fields, which identify the
+// records summarized by a row or column.
+func (a pivotAxis) key(tuple []int) string {
+	ret := []string{}
+	for i, f := range a.fields {
+		if f != -2 {
+			ret = append(ret, strconv.Itoa(tuple[i]))
+		}
+	}
+	return strings.Join(ret, ",")
+}
+
+// data returns the data field index of a tuple, or -1 if the axis doesn't
+// contain the values field.
+func (a pivotAxis) data(tuple []int) int {
+	for i, f := range a.fields {
+		if f == -2 {
+			return tuple[i]
+		}
+	}
+	return -1
+}
+
+func (a pivotAxis) hasValues() bool {
+	for _, f := range a.fields {
+		if f == -2 {
+			return true
+		}
+	}
+	return false
+}
+
+func (a pivotAxis) hasFields() bool {
+	return len(a.fields) > 0 && !(len(a.fields) == 1 && a.fields[0] == -2)
+}
+
+// items returns the row or column items of the axis.
+func (a pivotAxis) items() []*sml.CT_I {
+	ret := []*sml.CT_I{}
+	if len(a.fields) == 0 {
+		return append(ret, sml.NewCT_I())
+	}
+	var prev []int
+	for _, t := range a.tuples {
+		it := sml.NewCT_I()
+		r := 0
+		for prev != nil && r < len(t) && t[r] == prev[r] {
+			r++
+		}
+		if r > 0 {
+			it.RAttr = unioffice.Uint32(uint32(r))
+		}
+		if d := a.data(t); d > 0 {
+			it.IAttr = unioffice.Uint32(uint32(d))
+		}
+		for _, v := range t[r:] {
+			x := sml.NewCT_X()
+			if v != 0 {
+				x.VAttr = unioffice.Int32(int32(v))
+			}
+			it.X = append(it.X, x)
+		}
+		ret = append(ret, it)
+		prev = t
+	}
+	for _, d := range a.grand {
+		it := sml.NewCT_I()
+		it.TAttr = sml.ST_ItemTypeGrand
+		if d > 0 {
+			it.IAttr = unioffice.Uint32(uint32(d))
+		}
+		it.X = append(it.X, sml.NewCT_X())
+		ret = append(ret, it)
+	}
+	return ret
+}
+
+// newPivotAxis lays out an axis with the distinct combinations of items found
+// in the records.
+func newPivotAxis(fields []int32, keys [][]int, dataCount int, grandTotals bool) pivotAxis {
+	a := pivotAxis{fields: fields}
+	if len(fields) == 0 {
+		a.tuples = [][]int{{}}
+		return a
+	}
+	seen := map[string]struct{}{}
+	for _, k := range keys {
+		key := fmt.Sprint(k)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		// expand the values field over the data fields
+		tuples := [][]int{{}}
+		j := 0
+		for _, f := range fields {
+			next := [][]int{}
+			for _, t := range tuples {
+				if f == -2 {
+					for d := 0; d < dataCount; d++ {
+						next = append(next, append(append([]int{}, t...), d))
+					}
+				} else {
+					next = append(next, append(append([]int{}, t...), k[j]))
+				}
+			}
+			if f != -2 {
+				j++
+			}
+			tuples = next
+		}
+		a.tuples = append(a.tuples, tuples...)
+	}
+	sort.Slice(a.tuples, func(i, j int) bool {
+		ti, tj := a.tuples[i], a.tuples[j]
+		for k := range ti {
+			if ti[k] != tj[k] {
+				return ti[k] < tj[k]
+			}
+		}
+		return false
+	})
+	if grandTotals && a.hasFields() && dataCount > 0 {
+		if a.hasValues() {
+			for d := 0; d < dataCount; d++ {
+				a.grand = append(a.grand, d)
+			}
+		} else {
+			a.grand = []int{-1}
+		}
+	}
+	return a
+}
+
+// origin returns the top left cell of the pivot table including its page
+// fields, and the number of rows used by the page fields.
+func (p PivotTable) origin() (reference.CellReference, uint32, error) {
+	ref := strings.Split(p.x.Location.RefAttr, ":")[0]
+	cr, err := reference.ParseCellReference(ref)
+	if err != nil {
+		return cr, 0, fmt.Errorf("invalid pivot table location %s: %s", p.x.Location.RefAttr, err)
+	}
+	pages := uint32(0)
+	if p.x.Location.RowPageCountAttr != nil && *p.x.Location.RowPageCountAttr > 0 {
+		// page fields are followed by a blank row
+		pages = *p.x.Location.RowPageCountAttr + 1
+	}
+	if cr.RowIdx > pages {
+		cr.RowIdx -= pages
+	}
+	return cr, pages, nil
+}
+
+// clear clears the cells previously occupied by the pivot table.
+func (p PivotTable) clear(origin reference.CellReference, pages uint32) {
+	from, to := origin, origin
+	if sp := strings.Split(p.x.Location.RefAttr, ":"); len(sp) == 2 {
+		if cr, err := reference.ParseCellReference(sp[1]); err == nil {
+			to = cr
+		}
+	}
+	if pages > 0 && to.ColumnIdx < from.ColumnIdx+1 {
+		to.ColumnIdx = from.ColumnIdx + 1
+	}
+	for _, r := range p.s.Rows() {
+		rn := r.RowNumber()
+		if rn < from.RowIdx || rn > to.RowIdx {
+			continue
+		}
+		for _, c := range r.Cells() {
+			cr, err := reference.ParseCellReference(c.Reference())
+			if err == nil && cr.ColumnIdx >= from.ColumnIdx && cr.ColumnIdx <= to.ColumnIdx {
+				c.Clear()
+			}
+		}
+	}
+}
+
+// render lays out the pivot table, updating the location and row and column
+// items and writing the summarized values to the sheet.
+func (p PivotTable) render() error {
+	origin, pages, err := p.origin()
+	if err != nil {
+		return err
+	}
+	p.clear(origin, pages)
+
+	shared := p.sharedItems()
+	records := p.cacheRecords(shared)
+	var dataFields []*sml.CT_DataField
+	if p.x.DataFields != nil {
+		dataFields = p.x.DataFields.DataField
+	}
+
+	// positions of each shared item within the items of axis fields
+	positions := make([]map[pivotItem]int, len(shared))
+	for i, pf := range p.x.PivotFields.PivotField {
+		if i >= len(shared) || pf.Items == nil {
+			continue
+		}
+		positions[i] = map[pivotItem]int{}
+		for j, it := range pf.Items.Item {
+			if it.XAttr != nil && int(*it.XAttr) < len(shared[i]) {
+				positions[i][shared[i][*it.XAttr]] = j
+			}
+		}
+	}
+
+	// page fields with a selected item filter the records
+	var pageFields []*sml.CT_PageField
+	if p.x.PageFields != nil {
+		pageFields = p.x.PageFields.PageField
+	}
+	filtered := [][]pivotItem{}
+	for _, rec := range records {
+		keep := true
+		for _, pg := range pageFields {
+			if pg.ItemAttr != nil && pg.FldAttr >= 0 && int(pg.FldAttr) < len(rec) {
+				keep = keep && positions[pg.FldAttr][rec[pg.FldAttr]] == int(*pg.ItemAttr)
+			}
+		}
+		if keep {
+			filtered = append(filtered, rec)
+		}
+	}
+
+	// aggregate the records for each row and column along with the totals
+	rowFields, colFields := pivotAxisFields(p.x.RowFields), pivotAxisFields(p.x.ColFields)
+	keyOf := func(rec []pivotItem, fields []int32) ([]int, bool) {
+		ret := []int{}
+		for _, f := range fields {
+			if f == -2 {
+				continue
+			}
+			if f < 0 || int(f) >= len(rec) || positions[f] == nil {
+				return nil, false
+			}
+			pos, ok := positions[f][rec[f]]
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, pos)
+		}
+		return ret, true
+	}
+	joinKey := func(k []int) string {
+		s := make([]string, len(k))
+		for i, v := range k {
+			s[i] = strconv.Itoa(v)
+		}
+		return strings.Join(s, ",")
+	}
+	aggs := map[[2]string][]*pivotAggregate{}
+	rowKeys, colKeys := [][]int{}, [][]int{}
+	for _, rec := range filtered {
+		rk, ok := keyOf(rec, rowFields)
+		if !ok {
+			continue
+		}
+		ck, ok := keyOf(rec, colFields)
+		if !ok {
+			continue
+		}
+		rowKeys, colKeys = append(rowKeys, rk), append(colKeys, ck)
+		r, c := joinKey(rk), joinKey(ck)
+		for _, k := range [][2]string{{r, c}, {r, "*"}, {"*", c}, {"*", "*"}} {
+			if aggs[k] == nil {
+				aggs[k] = make([]*pivotAggregate, len(dataFields))
+				for i := range aggs[k] {
+					aggs[k][i] = &pivotAggregate{}
+				}
+			}
+			for i, df := range dataFields {
+				if int(df.FldAttr) < len(rec) {
+					aggs[k][i].add(rec[df.FldAttr])
+				}
+			}
+		}
+	}
+
+	grandRows := p.x.ColGrandTotalsAttr == nil || *p.x.ColGrandTotalsAttr
+	grandCols := p.x.RowGrandTotalsAttr == nil || *p.x.RowGrandTotalsAttr
+	rows := newPivotAxis(rowFields, rowKeys, len(dataFields), grandRows)
+	cols := newPivotAxis(colFields, colKeys, len(dataFields), grandCols)
+	if len(colFields) == 0 && len(dataFields) == 0 {
+		cols.tuples = nil
+	}
+
+	// the body of the pivot table follows the page fields
+	body := origin
+	if len(pageFields) > 0 {
+		body.RowIdx += uint32(len(pageFields)) + 1
+	}
+	cell := func(row uint32, col int) Cell {
+		return p.s.Cell(fmt.Sprintf("%s%d", reference.IndexToColumn(origin.ColumnIdx+uint32(col)), row))
+	}
+	setLabel := func(c Cell, v pivotItem) {
+		switch v.typ {
+		case pivotItemNumber:
+			c.SetNumber(v.n)
+		case pivotItemBool:
+			c.SetBool(v.n != 0)
+		default:
+			c.SetString(v.String())
+		}
+	}
+	label := func(field int32, pos int) pivotItem {
+		if field == -2 {
+			if pos < len(dataFields) {
+				return pivotItem{typ: pivotItemString, s: PivotDataField{p, dataFields[pos]}.Name()}
+			}
+			return pivotItem{typ: pivotItemString}
+		}
+		it := p.x.PivotFields.PivotField[field].Items.Item[pos]
+		return shared[field][*it.XAttr]
+	}
+	dataName := func(d int) string {
+		if d < 0 || d >= len(dataFields) {
+			return ""
+		}
+		return PivotDataField{p, dataFields[d]}.Name()
+	}
+
+	for i, pg := range pageFields {
+		cell(origin.RowIdx+uint32(i), 0).SetString(p.fieldName(pg.FldAttr))
+		if pg.ItemAttr != nil && positions[pg.FldAttr] != nil && int(*pg.ItemAttr) < len(positions[pg.FldAttr]) {
+			setLabel(cell(origin.RowIdx+uint32(i), 1), label(pg.FldAttr, int(*pg.ItemAttr)))
+		} else {
+			cell(origin.RowIdx+uint32(i), 1).SetString("(All)")
+		}
+	}
+
+	// the row labels take at least one column if there is a column axis
+	labelCols := len(rowFields)
+	headerRows := uint32(1)
+	colAxis := len(colFields) > 0
+	if colAxis {
+		if labelCols == 0 {
+			labelCols = 1
+		}
+		headerRows += uint32(len(colFields))
+		if len(dataFields) == 1 {
+			cell(body.RowIdx, 0).SetString(dataName(0))
+		}
+		for j, f := range colFields {
+			cell(body.RowIdx, labelCols+j).SetString(p.fieldName(f))
+		}
+		for ci, t := range cols.tuples {
+			for j := range t {
+				if ci == 0 || !equalInts(t[:j+1], cols.tuples[ci-1][:j+1]) {
+					setLabel(cell(body.RowIdx+1+uint32(j), labelCols+ci), label(colFields[j], t[j]))
+				}
+			}
+		}
+		for gi, d := range cols.grand {
+			name := "Grand Total"
+			if len(cols.grand) > 1 {
+				name = "Total " + dataName(d)
+			}
+			cell(body.RowIdx+1, labelCols+len(cols.tuples)+gi).SetString(name)
+		}
+	} else if len(dataFields) > 0 {
+		name := dataName(0)
+		if len(dataFields) > 1 {
+			name = p.fieldName(-2)
+		}
+		cell(body.RowIdx, labelCols).SetString(name)
+	}
+	for j, f := range rowFields {
+		cell(body.RowIdx+headerRows-1, j).SetString(p.fieldName(f))
+	}
+
+	// the summarized values
+	value := func(row uint32, col int, rk, ck string, d int) {
+		if d < 0 || d >= len(dataFields) {
+			return
+		}
+		agg := aggs[[2]string{rk, ck}]
+		if agg == nil {
+			return
+		}
+		v, errVal := agg[d].result(PivotDataField{p, dataFields[d]}.Function())
+		c := cell(row, col)
+		if errVal != "" {
+			c.Clear()
+			c.x.TAttr = sml.ST_CellTypeE
+			c.x.V = unioffice.String(errVal)
+			return
+		}
+		c.SetNumber(v)
+	}
+	dataIdx := func(a, b int) int {
+		if a >= 0 {
+			return a
+		}
+		if b >= 0 {
+			return b
+		}
+		return 0
+	}
+	row := body.RowIdx + headerRows
+	for ri, rt := range rows.tuples {
+		for j := range rt {
+			if ri == 0 || !equalInts(rt[:j+1], rows.tuples[ri-1][:j+1]) {
+				setLabel(cell(row, j), label(rowFields[j], rt[j]))
+			}
+		}
+		if len(rowFields) == 0 && colAxis && len(dataFields) == 1 {
+			cell(row, 0).SetString(dataName(0))
+		}
+		rk := rows.key(rt)
+		for ci, ct := range cols.tuples {
+			value(row, labelCols+ci, rk, cols.key(ct), dataIdx(rows.data(rt), cols.data(ct)))
+		}
+		for gi, d := range cols.grand {
+			value(row, labelCols+len(cols.tuples)+gi, rk, "*", dataIdx(d, rows.data(rt)))
+		}
+		row++
+	}
+	for _, d := range rows.grand {
+		name := "Grand Total"
+		if len(rows.grand) > 1 {
+			name = "Total " + dataName(d)
+		}
+		cell(row, 0).SetString(name)
+		for ci, ct := range cols.tuples {
+			value(row, labelCols+ci, "*", cols.key(ct), dataIdx(d, cols.data(ct)))
+		}
+		for gi, gd := range cols.grand {
+			value(row, labelCols+len(cols.tuples)+gi, "*", "*", dataIdx(d, gd))
+		}
+		row++
+	}
+
+	width := labelCols + len(cols.tuples) + len(cols.grand)
+	if width == 0 {
+		width = 1
+	}
+	loc := p.x.Location
+	loc.RefAttr = fmt.Sprintf("%s%d:%s%d", body.Column, body.RowIdx,
+		reference.IndexToColumn(body.ColumnIdx+uint32(width-1)), row-1)
+	loc.FirstHeaderRowAttr = 1
+	loc.FirstDataRowAttr = headerRows
+	loc.FirstDataColAttr = uint32(labelCols)
+	loc.RowPageCountAttr, loc.ColPageCountAttr = nil, nil
+	if len(pageFields) > 0 {
+		loc.RowPageCountAttr = unioffice.Uint32(uint32(len(pageFields)))
+		loc.ColPageCountAttr = unioffice.Uint32(1)
+	}
+
+	p.x.RowItems = sml.NewCT_rowItems()
+	p.x.RowItems.I = rows.items()
+	p.x.RowItems.CountAttr = unioffice.Uint32(uint32(len(p.x.RowItems.I)))
+	p.x.ColItems = sml.NewCT_colItems()
+	p.x.ColItems.I = cols.items()
+	p.x.ColItems.CountAttr = unioffice.Uint32(uint32(len(p.x.ColItems.I)))
+	return nil
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
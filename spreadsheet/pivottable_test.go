@@ -0,0 +1,190 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+func pivotData(sheet spreadsheet.Sheet) {
+	data := []struct {
+		region, product string
+		sales           float64
+	}{
+		{"East", "A", 10},
+		{"West", "A", 20},
+		{"East", "B", 5},
+		{"West", "B", 7},
+		{"East", "A", 3},
+	}
+	hdr := sheet.AddRow()
+	hdr.AddCell().SetString("Region")
+	hdr.AddCell().SetString("Product")
+	hdr.AddCell().SetString("Sales")
+	for _, d := range data {
+		row := sheet.AddRow()
+		row.AddCell().SetString(d.region)
+		row.AddCell().SetString(d.product)
+		row.AddCell().SetNumber(d.sales)
+	}
+}
+
+func expectString(t *testing.T, c spreadsheet.Cell, exp string) {
+	// TODO: uncomment once we quit building on 1.8
+	//t.Helper()
+	if got := c.GetString(); got != exp {
+		t.Errorf("expected %s = %s, got %s", c.Reference(), exp, got)
+	}
+}
+
+func TestPivotTable(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	pivotData(sheet)
+
+	if _, err := sheet.AddPivotTable("Sales", "F1", "A1:C6"); err == nil {
+		t.Errorf("expected an error for a source without a sheet name")
+	}
+	pt, err := sheet.AddPivotTable("Sales", "F1", "'Sheet 1'!$A$1:$C$6")
+	if err != nil {
+		t.Fatalf("error adding pivot table: %s", err)
+	}
+	if err := pt.AddRowField("Region"); err != nil {
+		t.Fatalf("error adding row field: %s", err)
+	}
+	if err := pt.AddRowField("Region"); err == nil {
+		t.Errorf("expected an error adding a field twice")
+	}
+	if err := pt.AddRowField("Missing"); err == nil {
+		t.Errorf("expected an error adding a missing field")
+	}
+	if _, err := pt.AddDataField("Sales", sml.ST_DataConsolidateFunctionSum); err != nil {
+		t.Fatalf("error adding data field: %s", err)
+	}
+	if pt.Reference() != "F1:G4" {
+		t.Errorf("expected pivot table at F1:G4, got %s", pt.Reference())
+	}
+	expectString(t, sheet.Cell("F1"), "Region")
+	expectString(t, sheet.Cell("G1"), "Sum of Sales")
+	expectString(t, sheet.Cell("F2"), "East")
+	expectNumber(t, sheet.Cell("G2"), 18)
+	expectString(t, sheet.Cell("F3"), "West")
+	expectNumber(t, sheet.Cell("G3"), 27)
+	expectString(t, sheet.Cell("F4"), "Grand Total")
+	expectNumber(t, sheet.Cell("G4"), 45)
+
+	if err := pt.AddColumnField("Product"); err != nil {
+		t.Fatalf("error adding column field: %s", err)
+	}
+	if pt.Reference() != "F1:I5" {
+		t.Errorf("expected pivot table at F1:I5, got %s", pt.Reference())
+	}
+	expectString(t, sheet.Cell("F1"), "Sum of Sales")
+	expectString(t, sheet.Cell("G1"), "Product")
+	expectString(t, sheet.Cell("F2"), "Region")
+	expectString(t, sheet.Cell("G2"), "A")
+	expectString(t, sheet.Cell("H2"), "B")
+	expectString(t, sheet.Cell("I2"), "Grand Total")
+	expectNumber(t, sheet.Cell("G3"), 13)
+	expectNumber(t, sheet.Cell("H4"), 7)
+	expectNumber(t, sheet.Cell("I4"), 27)
+	expectNumber(t, sheet.Cell("G5"), 33)
+	expectNumber(t, sheet.Cell("I5"), 45)
+
+	buf := bytes.Buffer{}
+	if err := wb.Save(&buf); err != nil {
+		t.Fatalf("error saving: %s", err)
+	}
+	wb2, err := spreadsheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading: %s", err)
+	}
+	defer wb2.Close()
+	pts := wb2.Sheets()[0].PivotTables()
+	if len(pts) != 1 {
+		t.Fatalf("expected 1 pivot table, got %d", len(pts))
+	}
+	pt = pts[0]
+	if pt.Name() != "Sales" {
+		t.Errorf("expected pivot table Sales, got %s", pt.Name())
+	}
+	if got := pt.Source(); got != "'Sheet 1'!A1:C6" {
+		t.Errorf("expected source 'Sheet 1'!A1:C6, got %s", got)
+	}
+	if got := pt.Fields(); !reflect.DeepEqual(got, []string{"Region", "Product", "Sales"}) {
+		t.Errorf("unexpected fields %v", got)
+	}
+	if got := pt.RowFields(); !reflect.DeepEqual(got, []string{"Region"}) {
+		t.Errorf("unexpected row fields %v", got)
+	}
+	if got := pt.ColumnFields(); !reflect.DeepEqual(got, []string{"Product"}) {
+		t.Errorf("unexpected column fields %v", got)
+	}
+	df := pt.DataFields()
+	if len(df) != 1 || df[0].Name() != "Sum of Sales" || df[0].Field() != "Sales" ||
+		df[0].Function() != sml.ST_DataConsolidateFunctionSum {
+		t.Errorf("unexpected data fields %v", df)
+	}
+	if pt.CacheRecords() == nil || len(pt.CacheRecords().R) != 5 {
+		t.Errorf("expected 5 cache records")
+	}
+
+	// modifying a loaded pivot table
+	if _, err := pt.AddDataField("Sales", sml.ST_DataConsolidateFunctionCount); err != nil {
+		t.Fatalf("error adding data field: %s", err)
+	}
+	if got := pt.ColumnFields(); !reflect.DeepEqual(got, []string{"Product", "Values"}) {
+		t.Errorf("unexpected column fields %v", got)
+	}
+	s2 := wb2.Sheets()[0]
+	expectString(t, s2.Cell("G3"), "Sum of Sales")
+	expectString(t, s2.Cell("H3"), "Count of Sales")
+	expectNumber(t, s2.Cell("G4"), 13)
+	expectNumber(t, s2.Cell("H4"), 2)
+	expectString(t, s2.Cell("K2"), "Total Sum of Sales")
+	expectNumber(t, s2.Cell("L6"), 5)
+
+	if err := pt.AddPageField("Product"); err == nil {
+		t.Errorf("expected an error adding a column field as a page field")
+	}
+}
+
+func TestPivotTableRefresh(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	pivotData(sheet)
+	out := wb.AddSheet()
+
+	pt, err := out.AddPivotTable("Sales", "A1", "'Sheet 1'!A1:C6")
+	if err != nil {
+		t.Fatalf("error adding pivot table: %s", err)
+	}
+	pt.AddPageField("Region")
+	pt.AddRowField("Product")
+	pt.AddDataField("Sales", sml.ST_DataConsolidateFunctionAverage)
+	expectString(t, out.Cell("A1"), "Region")
+	expectString(t, out.Cell("B1"), "(All)")
+	if pt.Reference() != "A3:B6" {
+		t.Errorf("expected pivot table at A3:B6, got %s", pt.Reference())
+	}
+	expectNumber(t, out.Cell("B4"), 11)
+
+	sheet.Cell("C2").SetNumber(22)
+	if err := pt.Refresh(); err != nil {
+		t.Fatalf("error refreshing: %s", err)
+	}
+	expectNumber(t, out.Cell("B4"), 15)
+	expectNumber(t, out.Cell("B6"), 11.4)
+}
@@ -0,0 +1,242 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/formula"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// Precedents returns the cells that the formula in a cell refers to, in the
+// form "Sheet1!A1", with the sheet name quoted if necessary (e.g.
+// "'Sheet 1'!A1").  The cell reference must include the sheet name, e.g.
+// "Sheet 1!D10" or "'Sheet 1'!D10", which is matched without regard to case.
+// Named ranges are resolved to the cells
+// that they refer to, and ranges are resolved to the cells within them that
+// exist in the sheet.  If transitive is true, the precedents of any formula
+// cells found are included as well.
+func (wb *Workbook) Precedents(cellRef string, transitive bool) ([]string, error) {
+	return wb.traceReferences(cellRef, transitive, true)
+}
+
+// Dependents returns the formula cells that refer to a cell, in the same form
+// as Precedents.  The cell reference must include the sheet name, e.g.
+// "Sheet 1!D10" or "'Sheet 1'!D10", and the cell may be empty, as formulas
+// that refer to a range containing it depend on it.  If transitive is true,
+// the cells that depend on those cells are included as well.
+func (wb *Workbook) Dependents(cellRef string, transitive bool) ([]string, error) {
+	return wb.traceReferences(cellRef, transitive, false)
+}
+
+func (wb *Workbook) traceReferences(cellRef string, transitive, precedents bool) ([]string, error) {
+	// use a separate engine so that the state of the last calculation is kept
+	e := newCalcEngine(wb)
+	e.build(nil)
+	start, err := e.parseKey(cellRef)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := map[calcKey][]calcRange{}
+	for k, n := range e.nodes {
+		refs[k] = e.referencedRanges(n)
+	}
+	// next returns the cells that a cell refers to, or that refer to it
+	next := func(k calcKey) []calcKey {
+		ret := []calcKey{}
+		if precedents {
+			for _, r := range refs[k] {
+				ret = append(ret, e.cellsInRange(r)...)
+			}
+			return ret
+		}
+		// ranges are matched by their bounds, as a formula depends on the
+		// empty cells within the ranges it refers to
+		for d, rs := range refs {
+			for _, r := range rs {
+				if r.contains(k) {
+					ret = append(ret, d)
+					break
+				}
+			}
+		}
+		return ret
+	}
+
+	seen := map[calcKey]struct{}{start: {}}
+	ret := []calcKey{}
+	queue := []calcKey{start}
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+		for _, nk := range next(k) {
+			if _, ok := seen[nk]; ok {
+				continue
+			}
+			seen[nk] = struct{}{}
+			ret = append(ret, nk)
+			if transitive {
+				queue = append(queue, nk)
+			}
+		}
+	}
+
+	e.sortKeys(ret)
+	names := make([]string, 0, len(ret))
+	for _, k := range ret {
+		names = append(names, e.name(k))
+	}
+	return names, nil
+}
+
+// parseKey parses a sheet qualified cell reference.
+func (e *calcEngine) parseKey(cellRef string) (calcKey, error) {
+	name, ref, ok := reference.SplitSheetPrefix(cellRef)
+	if !ok {
+		return calcKey{}, errors.New("cell reference must include a sheet name")
+	}
+	s := e.sheetByName(name)
+	if !s.IsValid() {
+		return calcKey{}, fmt.Errorf("sheet %s not found", name)
+	}
+	cr, err := reference.ParseCellReference(ref)
+	if err != nil {
+		return calcKey{}, err
+	}
+	return calcKey{s.x, fmt.Sprintf("%s%d", cr.Column, cr.RowIdx)}, nil
+}
+
+func (e *calcEngine) sheetByName(name string) Sheet {
+	for _, s := range e.wb.Sheets() {
+		if strings.EqualFold(s.Name(), name) {
+			return s
+		}
+	}
+	return Sheet{}
+}
+
+// calcRange is a range of cells, which may be a single cell, that a formula
+// refers to.
+type calcRange struct {
+	ws       *sml.Worksheet
+	from, to reference.CellReference
+}
+
+// contains returns true if a cell is within the range.
+func (r calcRange) contains(k calcKey) bool {
+	if k.ws != r.ws {
+		return false
+	}
+	cr, err := reference.ParseCellReference(k.ref)
+	return err == nil && r.bounds(cr)
+}
+
+// bounds returns true if a cell reference is within the bounds of the range.
+func (r calcRange) bounds(cr reference.CellReference) bool {
+	return cr.RowIdx >= r.from.RowIdx && cr.RowIdx <= r.to.RowIdx &&
+		cr.ColumnIdx >= r.from.ColumnIdx && cr.ColumnIdx <= r.to.ColumnIdx
+}
+
+// referencedRanges returns the ranges of cells that a formula refers to
+// without evaluating it.
+func (e *calcEngine) referencedRanges(n *calcNode) []calcRange {
+	if n.expr == nil {
+		return nil
+	}
+	refs := n.expr.References()
+	for i, r := range refs {
+		// structured references depend on the table definitions and the cell
+		// containing the formula
+		if r.Type == formula.ReferenceTypeStructured {
+			ctx := &calcContext{e: e, s: n.sheet, node: n}
+			refs[i] = formula.NewStructuredRef(r.Value).Reference(ctx, e.ev)
+		}
+	}
+	return e.resolveReferences(n.sheet, refs, n.colOff, n.rowOff, map[string]struct{}{})
+}
+
+func (e *calcEngine) resolveReferences(s Sheet, refs []formula.Reference, colOff, rowOff uint32, names map[string]struct{}) []calcRange {
+	ret := []calcRange{}
+	for _, r := range refs {
+		switch r.Type {
+		case formula.ReferenceTypeCell, formula.ReferenceTypeRange:
+			sheet, ref := s, r.Value
+			if name, rest, ok := reference.SplitSheetPrefix(ref); ok {
+				sheet, ref = e.sheetByName(name), rest
+				if !sheet.IsValid() {
+					continue
+				}
+			}
+			sp := strings.Split(ref, ":")
+			from, err := reference.ParseCellReference(sp[0])
+			if err != nil {
+				continue
+			}
+			to := from
+			if len(sp) == 2 {
+				if to, err = reference.ParseCellReference(sp[1]); err != nil {
+					continue
+				}
+			}
+			from, to = offsetReference(from, colOff, rowOff), offsetReference(to, colOff, rowOff)
+			ret = append(ret, calcRange{sheet.x, from, to})
+		case formula.ReferenceTypeNamedRange:
+			if _, ok := names[r.Value]; ok {
+				continue
+			}
+			names[r.Value] = struct{}{}
+			nr := namedRangeReference(e.wb, r.Value)
+			if nr.Type == formula.ReferenceTypeInvalid {
+				continue
+			}
+			if expr := e.parse(nr.Value); expr != nil {
+				ret = append(ret, e.resolveReferences(s, expr.References(), 0, 0, names)...)
+			}
+		}
+	}
+	return ret
+}
+
+// offsetReference applies the offset of a shared formula to the relative
+// parts of a cell reference.
+func offsetReference(cr reference.CellReference, colOff, rowOff uint32) reference.CellReference {
+	if !cr.AbsoluteColumn {
+		cr.ColumnIdx += colOff
+		cr.Column = reference.IndexToColumn(cr.ColumnIdx)
+	}
+	if !cr.AbsoluteRow {
+		cr.RowIdx += rowOff
+	}
+	return cr
+}
+
+// cellsInRange returns the cells within a range that exist in the sheet, or
+// the cell itself for a range of one cell.
+func (e *calcEngine) cellsInRange(r calcRange) []calcKey {
+	if r.from.RowIdx == r.to.RowIdx && r.from.ColumnIdx == r.to.ColumnIdx {
+		return []calcKey{{r.ws, fmt.Sprintf("%s%d", r.from.Column, r.from.RowIdx)}}
+	}
+	ret := []calcKey{}
+	for _, row := range r.ws.SheetData.Row {
+		for _, c := range row.C {
+			if c.RAttr == nil {
+				continue
+			}
+			cr, err := reference.ParseCellReference(*c.RAttr)
+			if err == nil && r.bounds(cr) {
+				ret = append(ret, calcKey{r.ws, fmt.Sprintf("%s%d", cr.Column, cr.RowIdx)})
+			}
+		}
+	}
+	return ret
+}
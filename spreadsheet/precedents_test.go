@@ -0,0 +1,96 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+func TestPrecedentsAndDependents(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	data := wb.AddSheet()
+	calc := wb.AddSheet()
+	calc.SetName("Calc")
+	data.Cell("A1").SetNumber(1)
+	data.Cell("A2").SetNumber(2)
+	data.Cell("B1").SetNumber(3)
+	wb.AddDefinedName("Values", data.RangeReference("A1:A5"))
+
+	calc.Cell("A1").SetFormulaRaw("SUM(Values)")
+	calc.Cell("A2").SetFormulaRaw("A1+'Sheet 1'!B1")
+	calc.Cell("A3").SetFormulaRaw("A2*2")
+	calc.Cell("B1").SetFormulaRaw("SUM(B2:B10)")
+
+	td := []struct {
+		Ref        string
+		Transitive bool
+		Precedents bool
+		Exp        []string
+	}{
+		{"Calc!A1", false, true, []string{"'Sheet 1'!A1", "'Sheet 1'!A2"}},
+		{"Calc!A3", false, true, []string{"Calc!A2"}},
+		{"Calc!A3", true, true, []string{"'Sheet 1'!A1", "'Sheet 1'!B1", "'Sheet 1'!A2", "Calc!A1", "Calc!A2"}},
+		{"'Sheet 1'!A2", false, false, []string{"Calc!A1"}},
+		{"Sheet 1!A2", true, false, []string{"Calc!A1", "Calc!A2", "Calc!A3"}},
+		{"Calc!A3", true, false, []string{}},
+		// empty cells within a range that a formula refers to
+		{"Sheet 1!A4", false, false, []string{"Calc!A1"}},
+		{"Sheet 1!A4", true, false, []string{"Calc!A1", "Calc!A2", "Calc!A3"}},
+		{"Calc!B5", false, false, []string{"Calc!B1"}},
+		{"Calc!B11", false, false, []string{}},
+		// sheet names are matched without regard to case
+		{"'sheet 1'!A2", false, false, []string{"Calc!A1"}},
+		{"CALC!A3", false, true, []string{"Calc!A2"}},
+	}
+	for _, tc := range td {
+		var got []string
+		var err error
+		if tc.Precedents {
+			got, err = wb.Precedents(tc.Ref, tc.Transitive)
+		} else {
+			got, err = wb.Dependents(tc.Ref, tc.Transitive)
+		}
+		if err != nil {
+			t.Errorf("expected no error for %s, got %s", tc.Ref, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.Exp) {
+			t.Errorf("expected %v for %s (precedents=%v, transitive=%v), got %v", tc.Exp, tc.Ref, tc.Precedents, tc.Transitive, got)
+		}
+	}
+
+	if _, err := wb.Precedents("A1", false); err == nil {
+		t.Errorf("expected an error for a reference without a sheet")
+	}
+	if _, err := wb.Precedents("Missing!A1", false); err == nil {
+		t.Errorf("expected an error for a missing sheet")
+	}
+}
+
+func TestPrecedentsShared(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	for _, ref := range []string{"A1", "A2", "A3", "C1"} {
+		sheet.Cell(ref).SetNumber(1)
+	}
+	sheet.Cell("B1").SetFormulaShared("A1*$C$1", 2, 0)
+
+	got, err := wb.Precedents("Sheet 1!B3", false)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	exp := []string{"'Sheet 1'!C1", "'Sheet 1'!A3"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
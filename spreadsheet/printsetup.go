@@ -0,0 +1,375 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/measurement"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// PaperSize is the size of the paper that a sheet is printed on.
+type PaperSize uint32
+
+// PaperSize constants, which are a subset of the paper sizes defined by the
+// specification.
+const (
+	PaperSizeLetter    PaperSize = 1
+	PaperSizeTabloid   PaperSize = 3
+	PaperSizeLegal     PaperSize = 5
+	PaperSizeExecutive PaperSize = 7
+	PaperSizeA3        PaperSize = 8
+	PaperSizeA4        PaperSize = 9
+	PaperSizeA5        PaperSize = 11
+	PaperSizeB4        PaperSize = 12
+	PaperSizeB5        PaperSize = 13
+)
+
+// Codes that can be used in the text of headers and footers, which are
+// replaced when the sheet is printed.  A literal ampersand is written as &&.
+const (
+	HeaderFooterPageNumber = "&P"
+	HeaderFooterPageCount  = "&N"
+	HeaderFooterDate       = "&D"
+	HeaderFooterTime       = "&T"
+	HeaderFooterSheetName  = "&A"
+	HeaderFooterFileName   = "&F"
+	HeaderFooterFilePath   = "&Z"
+)
+
+// Names of the defined names that hold the print area and titles of a sheet.
+const (
+	definedNamePrintArea   = "_xlnm.Print_Area"
+	definedNamePrintTitles = "_xlnm.Print_Titles"
+)
+
+// PrintSetup controls how a sheet is printed.
+type PrintSetup struct {
+	s Sheet
+}
+
+// PrintSetup returns the print setup of the sheet.
+func (s Sheet) PrintSetup() PrintSetup {
+	return PrintSetup{s}
+}
+
+// X returns the inner wrapped XML type, creating it if the sheet doesn't have
+// a page setup.
+func (p PrintSetup) X() *sml.CT_PageSetup {
+	if p.s.x.PageSetup == nil {
+		p.s.x.PageSetup = sml.NewCT_PageSetup()
+	}
+	return p.s.x.PageSetup
+}
+
+// SetOrientation sets the orientation of the printed pages.
+func (p PrintSetup) SetOrientation(o sml.ST_Orientation) {
+	p.X().OrientationAttr = o
+}
+
+// SetPaperSize sets the size of the paper that the sheet is printed on.
+func (p PrintSetup) SetPaperSize(sz PaperSize) {
+	p.X().PaperSizeAttr = unioffice.Uint32(uint32(sz))
+}
+
+// SetScale scales the printed sheet by a percentage from 10 to 400, turning off
+// fitting it to a number of pages.
+func (p PrintSetup) SetScale(pct uint32) {
+	p.X().ScaleAttr = unioffice.Uint32(pct)
+	p.X().FitToWidthAttr = nil
+	p.X().FitToHeightAttr = nil
+	if pr := p.s.x.SheetPr; pr != nil && pr.PageSetUpPr != nil {
+		pr.PageSetUpPr.FitToPageAttr = nil
+	}
+}
+
+// SetFitToPage scales the printed sheet to fit a number of pages wide and
+// tall, where zero places no limit on the number of pages in that direction.
+func (p PrintSetup) SetFitToPage(width, height uint32) {
+	if p.s.x.SheetPr == nil {
+		p.s.x.SheetPr = sml.NewCT_SheetPr()
+	}
+	if p.s.x.SheetPr.PageSetUpPr == nil {
+		p.s.x.SheetPr.PageSetUpPr = sml.NewCT_PageSetUpPr()
+	}
+	p.s.x.SheetPr.PageSetUpPr.FitToPageAttr = unioffice.Bool(true)
+	p.X().ScaleAttr = nil
+	p.X().FitToWidthAttr = unioffice.Uint32(width)
+	p.X().FitToHeightAttr = unioffice.Uint32(height)
+}
+
+// SetMargins sets the page margins, and the distance of the header and footer
+// from the top and bottom of the page.
+func (p PrintSetup) SetMargins(left, right, top, bottom, header, footer measurement.Distance) {
+	m := sml.NewCT_PageMargins()
+	m.LeftAttr = float64(left / measurement.Inch)
+	m.RightAttr = float64(right / measurement.Inch)
+	m.TopAttr = float64(top / measurement.Inch)
+	m.BottomAttr = float64(bottom / measurement.Inch)
+	m.HeaderAttr = float64(header / measurement.Inch)
+	m.FooterAttr = float64(footer / measurement.Inch)
+	p.s.x.PageMargins = m
+}
+
+func (p PrintSetup) printOptions() *sml.CT_PrintOptions {
+	if p.s.x.PrintOptions == nil {
+		p.s.x.PrintOptions = sml.NewCT_PrintOptions()
+	}
+	return p.s.x.PrintOptions
+}
+
+// SetCentered controls centering the printed sheet on the page.
+func (p PrintSetup) SetCentered(horizontal, vertical bool) {
+	p.printOptions().HorizontalCenteredAttr = unioffice.Bool(horizontal)
+	p.printOptions().VerticalCenteredAttr = unioffice.Bool(vertical)
+}
+
+// SetPrintGridLines controls printing the cell grid lines.
+func (p PrintSetup) SetPrintGridLines(b bool) {
+	p.printOptions().GridLinesAttr = unioffice.Bool(b)
+}
+
+// SetPrintHeadings controls printing the row and column headings.
+func (p PrintSetup) SetPrintHeadings(b bool) {
+	p.printOptions().HeadingsAttr = unioffice.Bool(b)
+}
+
+// sheetIndex returns the index of the sheet in the workbook, which sheet local
+// defined names refer to it by.
+func (p PrintSetup) sheetIndex() uint32 {
+	for i, cts := range p.s.w.x.Sheets.Sheet {
+		if cts == p.s.cts {
+			return uint32(i)
+		}
+	}
+	return 0
+}
+
+// definedName returns the sheet local defined name with a name, if any.
+func (p PrintSetup) definedName(name string) *sml.CT_DefinedName {
+	if p.s.w.x.DefinedNames == nil {
+		return nil
+	}
+	idx := p.sheetIndex()
+	for _, dn := range p.s.w.x.DefinedNames.DefinedName {
+		if dn.NameAttr == name && dn.LocalSheetIdAttr != nil && *dn.LocalSheetIdAttr == idx {
+			return dn
+		}
+	}
+	return nil
+}
+
+// setDefinedName sets the content of a sheet local defined name, adding it if
+// it doesn't exist.
+func (p PrintSetup) setDefinedName(name, content string) {
+	if dn := p.definedName(name); dn != nil {
+		dn.Content = content
+		return
+	}
+	dn := p.s.w.AddDefinedName(name, content)
+	dn.SetLocalSheetID(p.sheetIndex())
+}
+
+// removeDefinedName removes a sheet local defined name.
+func (p PrintSetup) removeDefinedName(name string) {
+	if dn := p.definedName(name); dn != nil {
+		p.s.w.RemoveDefinedName(DefinedName{dn})
+	}
+}
+
+// SetPrintArea sets the range of cells (e.g. A1:D20) that is printed.
+func (p PrintSetup) SetPrintArea(rangeRef string) error {
+	from, to, err := reference.ParseRangeReference(strings.Replace(rangeRef, "$", "", -1))
+	if err != nil {
+		return err
+	}
+	from.AbsoluteColumn, from.AbsoluteRow = true, true
+	to.AbsoluteColumn, to.AbsoluteRow = true, true
+	sheet := reference.QuoteSheetName(p.s.Name())
+	p.setDefinedName(definedNamePrintArea, fmt.Sprintf("%s!%s:%s", sheet, from, to))
+	return nil
+}
+
+// PrintArea returns the range of cells that is printed (e.g. $A$1:$D$20), or
+// an empty string if the whole sheet is printed.
+func (p PrintSetup) PrintArea() string {
+	dn := p.definedName(definedNamePrintArea)
+	if dn == nil {
+		return ""
+	}
+	_, ref, ok := reference.SplitSheetPrefix(dn.Content)
+	if !ok {
+		return dn.Content
+	}
+	return ref
+}
+
+// ClearPrintArea removes the print area so that the whole sheet is printed.
+func (p PrintSetup) ClearPrintArea() {
+	p.removeDefinedName(definedNamePrintArea)
+}
+
+// titleRange returns the absolute form of a range of rows (e.g. 1:2) or
+// columns (e.g. A:B), where a single row or column is a range of one.
+func titleRange(s string, columns bool) (string, error) {
+	sp := strings.Split(strings.Replace(s, "$", "", -1), ":")
+	if len(sp) == 1 {
+		sp = append(sp, sp[0])
+	}
+	if len(sp) != 2 {
+		return "", fmt.Errorf("invalid range %s", s)
+	}
+	for _, v := range sp {
+		valid := v != ""
+		for _, c := range v {
+			if columns && (c < 'A' || c > 'Z') || !columns && (c < '0' || c > '9') {
+				valid = false
+			}
+		}
+		if !valid {
+			return "", fmt.Errorf("invalid range %s", s)
+		}
+	}
+	return "$" + sp[0] + ":$" + sp[1], nil
+}
+
+// SetPrintTitles sets the rows (e.g. 1:2) and columns (e.g. A:A) that are
+// repeated on each printed page, either of which can be empty.
+func (p PrintSetup) SetPrintTitles(rows, columns string) error {
+	sheet := reference.QuoteSheetName(p.s.Name())
+	titles := []string{}
+	if columns != "" {
+		cols, err := titleRange(columns, true)
+		if err != nil {
+			return err
+		}
+		titles = append(titles, sheet+"!"+cols)
+	}
+	if rows != "" {
+		rows, err := titleRange(rows, false)
+		if err != nil {
+			return err
+		}
+		titles = append(titles, sheet+"!"+rows)
+	}
+	if len(titles) == 0 {
+		p.ClearPrintTitles()
+		return nil
+	}
+	p.setDefinedName(definedNamePrintTitles, strings.Join(titles, ","))
+	return nil
+}
+
+// ClearPrintTitles removes the rows and columns that are repeated on each
+// printed page.
+func (p PrintSetup) ClearPrintTitles() {
+	p.removeDefinedName(definedNamePrintTitles)
+}
+
+// addBreak adds a manual page break before the row or column with an index.
+func addBreak(pb *sml.CT_PageBreak, id, max uint32) *sml.CT_PageBreak {
+	if pb == nil {
+		pb = sml.NewCT_PageBreak()
+	}
+	for _, b := range pb.Brk {
+		if b.IdAttr != nil && *b.IdAttr == id {
+			return pb
+		}
+	}
+	b := sml.NewCT_Break()
+	b.IdAttr = unioffice.Uint32(id)
+	b.MaxAttr = unioffice.Uint32(max)
+	b.ManAttr = unioffice.Bool(true)
+	pb.Brk = append(pb.Brk, b)
+	sort.Slice(pb.Brk, func(i, j int) bool {
+		return *pb.Brk[i].IdAttr < *pb.Brk[j].IdAttr
+	})
+	pb.CountAttr = unioffice.Uint32(uint32(len(pb.Brk)))
+	pb.ManualBreakCountAttr = unioffice.Uint32(uint32(len(pb.Brk)))
+	return pb
+}
+
+// AddRowBreak adds a manual page break before a row, where row is 1-based.
+func (p PrintSetup) AddRowBreak(row uint32) {
+	if row < 2 {
+		return
+	}
+	// the break ID is the number of rows before the break
+	p.s.x.RowBreaks = addBreak(p.s.x.RowBreaks, row-1, 16383)
+}
+
+// AddColumnBreak adds a manual page break before a column (e.g. "C").
+func (p PrintSetup) AddColumnBreak(column string) {
+	idx := reference.ColumnToIndex(column)
+	if idx == 0 {
+		return
+	}
+	p.s.x.ColBreaks = addBreak(p.s.x.ColBreaks, idx, 1048575)
+}
+
+// ClearPageBreaks removes the manual page breaks.
+func (p PrintSetup) ClearPageBreaks() {
+	p.s.x.RowBreaks = nil
+	p.s.x.ColBreaks = nil
+}
+
+func (p PrintSetup) headerFooter() *sml.CT_HeaderFooter {
+	if p.s.x.HeaderFooter == nil {
+		p.s.x.HeaderFooter = sml.NewCT_HeaderFooter()
+	}
+	return p.s.x.HeaderFooter
+}
+
+// headerFooterText returns the text of a header or footer with left, center
+// and right aligned parts, or nil if they're all empty.
+func headerFooterText(left, center, right string) *string {
+	s := ""
+	if left != "" {
+		s += "&L" + left
+	}
+	if center != "" {
+		s += "&C" + center
+	}
+	if right != "" {
+		s += "&R" + right
+	}
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// SetHeader sets the left, center and right aligned text of the header printed
+// at the top of each page, which can contain the HeaderFooter codes (e.g.
+// "Page &P of &N").
+func (p PrintSetup) SetHeader(left, center, right string) {
+	p.headerFooter().OddHeader = headerFooterText(left, center, right)
+}
+
+// SetFooter sets the left, center and right aligned text of the footer printed
+// at the bottom of each page, which can contain the HeaderFooter codes.
+func (p PrintSetup) SetFooter(left, center, right string) {
+	p.headerFooter().OddFooter = headerFooterText(left, center, right)
+}
+
+// SetFirstPageHeader sets a different header for the first page.
+func (p PrintSetup) SetFirstPageHeader(left, center, right string) {
+	p.headerFooter().DifferentFirstAttr = unioffice.Bool(true)
+	p.headerFooter().FirstHeader = headerFooterText(left, center, right)
+}
+
+// SetFirstPageFooter sets a different footer for the first page.
+func (p PrintSetup) SetFirstPageFooter(left, center, right string) {
+	p.headerFooter().DifferentFirstAttr = unioffice.Bool(true)
+	p.headerFooter().FirstFooter = headerFooterText(left, center, right)
+}
@@ -15,11 +15,22 @@ import (
 	"os"
 
 	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/encryption"
 	"github.com/unidoc/unioffice/zippkg"
 )
 
-// Read reads a workbook from an io.Reader(.xlsx).
+// Read reads a workbook from an io.Reader(.xlsx).  Encrypted workbooks can
+// only be read if they are encrypted with the default password, others must be
+// read with ReadWithPassword.
 func Read(r io.ReaderAt, size int64) (*Workbook, error) {
+	if encryption.IsEncrypted(r) {
+		wb, err := ReadWithPassword(r, size, encryption.DefaultPassword)
+		if err == encryption.ErrInvalidPassword {
+			return nil, encryption.ErrEncrypted
+		}
+		return wb, err
+	}
+
 	wb := New()
 	td, err := ioutil.TempDir("", "gooxml-xlsx")
 	if err != nil {
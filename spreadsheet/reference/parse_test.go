@@ -8,6 +8,7 @@
 package reference_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/unidoc/unioffice/spreadsheet/reference"
@@ -153,3 +154,93 @@ func TestColumnToIndexRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitSheetPrefix(t *testing.T) {
+	td := []struct {
+		Inp   string
+		Sheet string
+		Ref   string
+		Ok    bool
+	}{
+		{"Sheet1!A1", "Sheet1", "A1", true},
+		{"'Sheet 1'!$A$1:$B$2", "Sheet 1", "$A$1:$B$2", true},
+		{"'Bob''s Sheet'!C3", "Bob's Sheet", "C3", true},
+		{"A1", "", "", false},
+		{"'Sheet 1'", "", "", false},
+	}
+	for _, tc := range td {
+		sheet, ref, ok := reference.SplitSheetPrefix(tc.Inp)
+		if sheet != tc.Sheet || ref != tc.Ref || ok != tc.Ok {
+			t.Errorf("expected %s to split to (%s, %s, %v), got (%s, %s, %v)", tc.Inp, tc.Sheet, tc.Ref, tc.Ok, sheet, ref, ok)
+		}
+	}
+	if got := reference.QuoteSheetName("Bob's Sheet"); got != "'Bob''s Sheet'" {
+		t.Errorf("expected quoted sheet name 'Bob''s Sheet', got %s", got)
+	}
+}
+
+func TestSheetNameNeedsQuotes(t *testing.T) {
+	for _, tc := range []struct {
+		Name string
+		Exp  bool
+	}{
+		{"Sheet1", false},
+		{"Q1.Sales", false},
+		{"Résumé", false},
+		{"C3PO", false},
+		{"", true},
+		{"Sheet 1", true},
+		{"Bob's", true},
+		{"My_Sheet", true},
+		{"1Q", true},
+		{"Jan:Mar", true},
+		{"ab12", true},
+		{"XFD1", true},
+		{"R", true},
+		{"rc", true},
+		{"R1C1", true},
+		{"C12", true},
+	} {
+		if got := reference.SheetNameNeedsQuotes(tc.Name); got != tc.Exp {
+			t.Errorf("expected SheetNameNeedsQuotes(%q) = %v, got %v", tc.Name, tc.Exp, got)
+		}
+	}
+}
+
+func TestR1C1(t *testing.T) {
+	origin, _ := reference.ParseCellReference("C5")
+	for _, tc := range []struct {
+		Inp string
+		Exp string
+	}{
+		{"R1C1", "$A$1"},
+		{"RC", "C5"},
+		{"R[-2]C[1]", "D3"},
+		{"R2C[-2]", "A$2"},
+		{"R1048576C16384", "$XFD$1048576"},
+		{"r[1]c3", "$C6"},
+	} {
+		cref, err := reference.ParseR1C1Reference(tc.Inp, origin)
+		if err != nil {
+			t.Errorf("expected no error for input %s, got %s", tc.Inp, err)
+			continue
+		}
+		if cref.String() != tc.Exp {
+			t.Errorf("expected %s = %s, got %s", tc.Inp, tc.Exp, cref)
+		}
+		if got := cref.R1C1(origin); !strings.EqualFold(got, tc.Inp) {
+			t.Errorf("expected %s in R1C1 notation = %s, got %s", cref, tc.Inp, got)
+		}
+	}
+	for _, inp := range []string{"", "R1", "C1", "R[-5]C", "R0C1", "R1C1X", "R[1C1",
+		"R1048577C1", "R1C16385", "R[1048572]C", "RC[16382]", "R99999999999C1"} {
+		if _, err := reference.ParseR1C1Reference(inp, origin); err == nil {
+			t.Errorf("expected error for input %s", inp)
+		}
+	}
+
+	from, to, err := reference.ParseR1C1RangeReference("R1C:R[1]C[1]", origin)
+	if err != nil || from.String() != "C$1" || to.String() != "D6" {
+		t.Errorf("expected range C$1:D6, got %s:%s (%v)", from, to, err)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package reference
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// R1C1 returns the cell reference in R1C1 notation relative to the cell at
+// origin.  Absolute rows and columns are written as row and column numbers
+// (e.g. R2C3), and relative rows and columns as offsets from the origin (e.g.
+// R[1]C[-1], or RC for the origin itself).
+func (c CellReference) R1C1(origin CellReference) string {
+	return r1c1Part('R', c.RowIdx, origin.RowIdx, c.AbsoluteRow) +
+		r1c1Part('C', c.ColumnIdx+1, origin.ColumnIdx+1, c.AbsoluteColumn)
+}
+
+func r1c1Part(prefix byte, v, origin uint32, abs bool) string {
+	switch {
+	case abs:
+		return fmt.Sprintf("%c%d", prefix, v)
+	case v == origin:
+		return string(prefix)
+	}
+	return fmt.Sprintf("%c[%d]", prefix, int64(v)-int64(origin))
+}
+
+// maxR1C1Row and maxR1C1Column are the last row and column of a worksheet.
+const (
+	maxR1C1Row    = 1048576
+	maxR1C1Column = 16384
+)
+
+// ParseR1C1Reference parses a cell reference in R1C1 notation (e.g. R2C3,
+// R[-1]C or RC[2]) relative to the cell at origin.  Row and column numbers
+// become absolute rows and columns, and offsets relative ones.  References
+// outside of a worksheet are an error.
+func ParseR1C1Reference(s string, origin CellReference) (CellReference, error) {
+	ref := strings.TrimSpace(s)
+	if len(ref) == 0 || (ref[0] != 'R' && ref[0] != 'r') {
+		return CellReference{}, fmt.Errorf("invalid R1C1 reference %s", s)
+	}
+	row, absRow, n, err := parseR1C1Part(ref[1:], origin.RowIdx, maxR1C1Row)
+	if err != nil {
+		return CellReference{}, fmt.Errorf("invalid R1C1 reference %s: %s", s, err)
+	}
+	ref = ref[1+n:]
+	if len(ref) == 0 || (ref[0] != 'C' && ref[0] != 'c') {
+		return CellReference{}, fmt.Errorf("invalid R1C1 reference %s", s)
+	}
+	col, absCol, n, err := parseR1C1Part(ref[1:], origin.ColumnIdx+1, maxR1C1Column)
+	if err != nil {
+		return CellReference{}, fmt.Errorf("invalid R1C1 reference %s: %s", s, err)
+	}
+	if n != len(ref)-1 {
+		return CellReference{}, fmt.Errorf("invalid R1C1 reference %s", s)
+	}
+	return CellReference{
+		RowIdx:         row,
+		ColumnIdx:      col - 1,
+		Column:         IndexToColumn(col - 1),
+		AbsoluteRow:    absRow,
+		AbsoluteColumn: absCol,
+	}, nil
+}
+
+// parseR1C1Part parses the row or column number or offset that follows the R
+// or C of an R1C1 reference, returning the 1-based index, whether it is
+// absolute and the number of characters parsed.  The index must be no greater
+// than max.
+func parseR1C1Part(s string, origin, max uint32) (uint32, bool, int, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.IndexByte(s, ']')
+		if end == -1 {
+			return 0, false, 0, errors.New("missing ]")
+		}
+		d, err := strconv.ParseInt(s[1:end], 10, 32)
+		if err != nil {
+			return 0, false, 0, err
+		}
+		v := int64(origin) + d
+		if v < 1 {
+			return 0, false, 0, errors.New("reference before the first row or column")
+		}
+		if v > int64(max) {
+			return 0, false, 0, errors.New("reference after the last row or column")
+		}
+		return uint32(v), false, end + 1, nil
+	case len(s) > 0 && s[0] >= '0' && s[0] <= '9':
+		n := 0
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		v, err := strconv.ParseUint(s[:n], 10, 32)
+		if err != nil {
+			return 0, false, 0, err
+		}
+		if v < 1 {
+			return 0, false, 0, errors.New("row and column numbers start at 1")
+		}
+		if v > uint64(max) {
+			return 0, false, 0, fmt.Errorf("row or column number greater than %d", max)
+		}
+		return uint32(v), true, n, nil
+	}
+	// an omitted number refers to the row or column of the origin
+	if origin < 1 || origin > max {
+		return 0, false, 0, errors.New("origin outside of the worksheet")
+	}
+	return origin, false, 0, nil
+}
+
+// ParseR1C1RangeReference splits a range reference in R1C1 notation of the
+// form "R1C1:R[2]C[2]" into its components, relative to the cell at origin.
+func ParseR1C1RangeReference(s string, origin CellReference) (from, to CellReference, err error) {
+	sp := strings.Split(s, ":")
+	if len(sp) != 2 {
+		return CellReference{}, CellReference{}, errors.New("invalid range format")
+	}
+	fromRef, err := ParseR1C1Reference(sp[0], origin)
+	if err != nil {
+		return CellReference{}, CellReference{}, err
+	}
+	toRef, err := ParseR1C1Reference(sp[1], origin)
+	if err != nil {
+		return CellReference{}, CellReference{}, err
+	}
+	return fromRef, toRef, nil
+}
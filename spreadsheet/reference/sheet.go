@@ -0,0 +1,92 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package reference
+
+import (
+	"strings"
+	"unicode"
+)
+
+// QuoteSheetName returns a sheet name quoted for use in a reference, e.g.
+// 'Sheet 1'.  Single quotes in the name are escaped by doubling them.
+func QuoteSheetName(name string) string {
+	return "'" + strings.Replace(name, "'", "''", -1) + "'"
+}
+
+// SheetNameNeedsQuotes returns true if a sheet name must be quoted with
+// QuoteSheetName in a reference.  Names are left unquoted only if they start
+// with a letter, contain only letters, digits and periods and can't be
+// mistaken for a cell reference in either the A1 or R1C1 style.
+func SheetNameNeedsQuotes(name string) bool {
+	if name == "" {
+		return true
+	}
+	for i, c := range name {
+		if !unicode.IsLetter(c) && (i == 0 || (c < '0' || c > '9') && c != '.') {
+			return true
+		}
+	}
+	upper := strings.ToUpper(name)
+	return looksLikeA1(upper) || looksLikeR1C1(upper)
+}
+
+// looksLikeA1 returns true if s is up to three letters followed by digits,
+// such as AB12.
+func looksLikeA1(s string) bool {
+	n := 0
+	for n < len(s) && s[n] >= 'A' && s[n] <= 'Z' {
+		n++
+	}
+	if n == 0 || n > 3 || n == len(s) {
+		return false
+	}
+	return strings.Trim(s[n:], "0123456789") == ""
+}
+
+// looksLikeR1C1 returns true if s has the form of an R1C1 reference without
+// brackets, such as R, C2, RC or R1C1.
+func looksLikeR1C1(s string) bool {
+	i := 0
+	for _, l := range []byte{'R', 'C'} {
+		if i < len(s) && s[i] == l {
+			i++
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+		}
+	}
+	return i > 0 && i == len(s)
+}
+
+// SplitSheetPrefix splits a reference like 'Sheet 1'!A1:B3 into the sheet name
+// and the remaining reference.  The boolean is false if the reference has no
+// sheet prefix.
+func SplitSheetPrefix(s string) (sheet, ref string, ok bool) {
+	if strings.HasPrefix(s, "'") {
+		for i := 1; i < len(s)-1; i++ {
+			if s[i] != '\'' {
+				continue
+			}
+			if s[i+1] == '\'' {
+				// escaped quote
+				i++
+				continue
+			}
+			if s[i+1] == '!' {
+				return strings.Replace(s[1:i], "''", "'", -1), s[i+2:], true
+			}
+			return "", "", false
+		}
+		return "", "", false
+	}
+	idx := strings.LastIndex(s, "!")
+	if idx <= 0 {
+		return "", "", false
+	}
+	return s[:idx], s[idx+1:], true
+}
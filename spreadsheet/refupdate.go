@@ -0,0 +1,783 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/unidoc/unioffice"
+	crt "github.com/unidoc/unioffice/schema/soo/dml/chart"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/formula"
+	"github.com/unidoc/unioffice/spreadsheet/internal/refscan"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// refUpdater describes how a structural edit to a sheet moves its cells and
+// is used to update the references to them.  Each method returns false if the
+// cells referred to were deleted.
+type refUpdater interface {
+	// cell returns the new location of a cell.
+	cell(c reference.CellReference) (reference.CellReference, bool)
+	// area returns the new location of a range of cells.
+	area(from, to reference.CellReference) (reference.CellReference, reference.CellReference, bool)
+	// columnRange returns the new location of a range of whole columns
+	// (e.g. A:C) given 0-based column indexes.
+	columnRange(from, to uint32) (uint32, uint32, bool)
+	// rowRange returns the new location of a range of whole rows (e.g. 1:3)
+	// given 1-based row indexes.
+	rowRange(from, to uint32) (uint32, uint32, bool)
+	// ref returns the new form of a reference without a sheet prefix (e.g.
+	// A1, $A$1:B2, A:C or 1:3), leaving references that can't be parsed
+	// unchanged.
+	ref(ref string) (string, bool)
+}
+
+// queryUpdate inserts or removes rows or columns, or offsets the relative
+// parts of references as when the cells sharing a formula are expanded, using
+// the rules of a formula.UpdateQuery.  Its query treats every reference as
+// being on the edited sheet.
+type queryUpdate struct {
+	q *formula.UpdateQuery
+}
+
+// shiftQuery returns the update for inserting or removing rows or columns.
+func shiftQuery(t formula.UpdateType, at, count uint32) queryUpdate {
+	return queryUpdate{&formula.UpdateQuery{UpdateType: t, CurrentSheet: true, Index: at, Count: count}}
+}
+
+func (u queryUpdate) ref(ref string) (string, bool) {
+	return u.q.UpdateReference(ref)
+}
+
+func (u queryUpdate) cell(c reference.CellReference) (reference.CellReference, bool) {
+	ref, ok := u.q.UpdateReference(c.String())
+	if !ok {
+		return c, false
+	}
+	nc, err := reference.ParseCellReference(ref)
+	if err != nil {
+		return c, false
+	}
+	return nc, true
+}
+
+func (u queryUpdate) area(from, to reference.CellReference) (reference.CellReference, reference.CellReference, bool) {
+	ref, ok := u.q.UpdateReference(from.String() + ":" + to.String())
+	if !ok {
+		return from, to, false
+	}
+	nfrom, nto, err := reference.ParseRangeReference(ref)
+	if err != nil {
+		return from, to, false
+	}
+	return nfrom, nto, true
+}
+
+func (u queryUpdate) columnRange(from, to uint32) (uint32, uint32, bool) {
+	ref, ok := u.q.UpdateReference(reference.IndexToColumn(from) + ":" + reference.IndexToColumn(to))
+	if !ok {
+		return from, to, false
+	}
+	sp := strings.Split(ref, ":")
+	return reference.ColumnToIndex(sp[0]), reference.ColumnToIndex(sp[1]), true
+}
+
+func (u queryUpdate) rowRange(from, to uint32) (uint32, uint32, bool) {
+	ref, ok := u.q.UpdateReference(fmt.Sprintf("%d:%d", from, to))
+	if !ok {
+		return from, to, false
+	}
+	fmt.Sscanf(ref, "%d:%d", &from, &to)
+	return from, to, true
+}
+
+// columns returns true if the update inserts or removes columns.
+func (u queryUpdate) columns() bool {
+	return u.q.UpdateType == formula.UpdateTypeInsertColumns || u.q.UpdateType == formula.UpdateTypeRemoveColumns
+}
+
+// moveUpdate moves a range of cells by an offset, replacing the cells at the
+// destination.
+type moveUpdate struct {
+	from, to   reference.CellReference
+	dCol, dRow int64
+}
+
+func (u moveUpdate) inSource(c reference.CellReference) bool {
+	return c.ColumnIdx >= u.from.ColumnIdx && c.ColumnIdx <= u.to.ColumnIdx &&
+		c.RowIdx >= u.from.RowIdx && c.RowIdx <= u.to.RowIdx
+}
+
+func (u moveUpdate) inDestination(c reference.CellReference) bool {
+	col := int64(c.ColumnIdx) - u.dCol
+	row := int64(c.RowIdx) - u.dRow
+	return col >= int64(u.from.ColumnIdx) && col <= int64(u.to.ColumnIdx) &&
+		row >= int64(u.from.RowIdx) && row <= int64(u.to.RowIdx)
+}
+
+func (u moveUpdate) offset(c reference.CellReference) reference.CellReference {
+	c.ColumnIdx = uint32(int64(c.ColumnIdx) + u.dCol)
+	c.Column = reference.IndexToColumn(c.ColumnIdx)
+	c.RowIdx = uint32(int64(c.RowIdx) + u.dRow)
+	return c
+}
+
+func (u moveUpdate) cell(c reference.CellReference) (reference.CellReference, bool) {
+	switch {
+	case u.inSource(c):
+		return u.offset(c), true
+	case u.inDestination(c):
+		return c, false
+	}
+	return c, true
+}
+
+func (u moveUpdate) area(from, to reference.CellReference) (reference.CellReference, reference.CellReference, bool) {
+	switch {
+	case u.inSource(from) && u.inSource(to):
+		return u.offset(from), u.offset(to), true
+	case u.inDestination(from) && u.inDestination(to):
+		return from, to, false
+	}
+	// ranges that only partially overlap the moved cells are left alone
+	return from, to, true
+}
+
+func (u moveUpdate) columnRange(from, to uint32) (uint32, uint32, bool) {
+	return from, to, true
+}
+
+func (u moveUpdate) rowRange(from, to uint32) (uint32, uint32, bool) {
+	return from, to, true
+}
+
+func (u moveUpdate) ref(ref string) (string, bool) {
+	return updateRef(ref, u)
+}
+
+// updateRef updates a reference (e.g. A1, $A$1:B2, A:C or 1:3) without a
+// sheet prefix with the methods of an updater, returning false if the cells
+// it refers to were deleted.  References that can't be parsed are returned
+// unchanged.
+func updateRef(ref string, u refUpdater) (string, bool) {
+	a, b := ref, ""
+	if idx := strings.IndexByte(ref, ':'); idx != -1 {
+		a, b = ref[:idx], ref[idx+1:]
+	}
+	switch refscan.Classify(a, b) {
+	case refscan.KindCell:
+		c, err := reference.ParseCellReference(a)
+		if err != nil {
+			return ref, true
+		}
+		c, ok := u.cell(c)
+		return c.String(), ok
+	case refscan.KindArea:
+		from, err := reference.ParseCellReference(a)
+		if err != nil {
+			return ref, true
+		}
+		to, err := reference.ParseCellReference(b)
+		if err != nil {
+			return ref, true
+		}
+		from, to, ok := u.area(from, to)
+		return from.String() + ":" + to.String(), ok
+	case refscan.KindColumns:
+		from, to, ok := u.columnRange(reference.ColumnToIndex(strings.TrimPrefix(a, "$")),
+			reference.ColumnToIndex(strings.TrimPrefix(b, "$")))
+		return absPrefix(a) + reference.IndexToColumn(from) + ":" + absPrefix(b) + reference.IndexToColumn(to), ok
+	case refscan.KindRows:
+		var from, to uint32
+		fmt.Sscanf(strings.TrimPrefix(a, "$"), "%d", &from)
+		fmt.Sscanf(strings.TrimPrefix(b, "$"), "%d", &to)
+		from, to, ok := u.rowRange(from, to)
+		return fmt.Sprintf("%s%d:%s%d", absPrefix(a), from, absPrefix(b), to), ok
+	}
+	return ref, true
+}
+
+func absPrefix(s string) string {
+	if strings.HasPrefix(s, "$") {
+		return "$"
+	}
+	return ""
+}
+
+// rewriteFormula calls fn for each cell, range, column or row reference in
+// the text of a formula and replaces the reference with the result.  sheet is
+// the sheet prefix of the reference, and qualified is false if it has no
+// prefix.  References in external workbooks are left unchanged.
+func rewriteFormula(f string, fn func(sheet string, qualified bool, ref string) string) string {
+	return refscan.Rewriter{Ref: func(r refscan.Ref) string {
+		if r.External {
+			return r.Text
+		}
+		return fn(r.Sheet, r.Qualified, r.Text)
+	}}.Rewrite(f)
+}
+
+// renameSheetPrefixes replaces the sheet prefixes (e.g. 'Sheet 1'!) that refer
+// to a sheet in the text of a formula, leaving the rest of the text unchanged.
+func renameSheetPrefixes(f, old, name string) string {
+	return refscan.Rewriter{Prefix: func(sheet string, quoted bool) (string, bool) {
+		// the first or last sheet of a 3D reference (e.g. Jan:Mar!A1)
+		parts := strings.Split(sheet, ":")
+		renamed := false
+		for i, p := range parts {
+			if strings.EqualFold(p, old) {
+				parts[i] = name
+				renamed = true
+			}
+			quoted = quoted || reference.SheetNameNeedsQuotes(parts[i])
+		}
+		if !renamed {
+			return "", false
+		}
+		sheet = strings.Join(parts, ":")
+		if quoted {
+			return reference.QuoteSheetName(sheet) + "!", true
+		}
+		return sheet + "!", true
+	}}.Rewrite(f)
+}
+
+// renameTableNames replaces the table names that refer to a table in the text
+// of a formula, as in the structured reference Table1[Qty].
+func renameTableNames(f, old, name string) string {
+	return refscan.Rewriter{Name: func(n string) (string, bool) {
+		return name, strings.EqualFold(n, old)
+	}}.Rewrite(f)
+}
+
+// updateFormula updates the references in a formula for an edit to a sheet.
+// onSheet returns true if a sheet prefix refers to the edited sheet.  current
+// is true if the formula is on the edited sheet, in which case references
+// without a sheet prefix are also updated.
+func updateFormula(f string, onSheet func(prefix string) bool, current bool, u refUpdater) string {
+	return rewriteFormula(f, func(name string, qualified bool, ref string) string {
+		if (qualified && !onSheet(name)) || (!qualified && !current) {
+			return ref
+		}
+		ref, ok := u.ref(ref)
+		if !ok {
+			return "#REF!"
+		}
+		return ref
+	})
+}
+
+// sheetInRange returns true if a sheet prefix names a sheet, or is a 3D
+// reference (e.g. Jan:Mar) whose first and last sheets span it in the order
+// of the workbook's sheets.  Sheet names are compared without regard to case.
+func sheetInRange(sheets []string, prefix, sheet string) bool {
+	parts := strings.SplitN(prefix, ":", 2)
+	for _, p := range parts {
+		if strings.EqualFold(p, sheet) {
+			return true
+		}
+	}
+	if len(parts) != 2 {
+		return false
+	}
+	first, last, idx := -1, -1, -1
+	for i, s := range sheets {
+		switch {
+		case strings.EqualFold(s, parts[0]):
+			first = i
+		case strings.EqualFold(s, parts[1]):
+			last = i
+		case strings.EqualFold(s, sheet):
+			idx = i
+		}
+	}
+	if first == -1 || last == -1 || idx == -1 {
+		return false
+	}
+	return first < idx && idx < last || last < idx && idx < first
+}
+
+// offsetFormula offsets the relative references in a formula, as when it is
+// copied from one cell to another.
+func offsetFormula(f string, dCol, dRow int64) string {
+	u := queryUpdate{&formula.UpdateQuery{ColumnOffset: int(dCol), RowOffset: int(dRow)}}
+	return rewriteFormula(f, func(name string, qualified bool, ref string) string {
+		ref, ok := u.ref(ref)
+		if !ok {
+			return "#REF!"
+		}
+		return ref
+	})
+}
+
+// updateSqref updates a list of references, dropping those that were deleted.
+func updateSqref(sqref sml.ST_Sqref, u refUpdater) sml.ST_Sqref {
+	ret := sml.ST_Sqref{}
+	for _, ref := range sqref {
+		if ref, ok := u.ref(ref); ok {
+			ret = append(ret, ref)
+		}
+	}
+	return ret
+}
+
+// expandSharedFormulas replaces the shared formulas in a sheet with a formula
+// in each cell, as the cells sharing a formula may no longer be in the same
+// relative positions after a structural edit.
+func (s Sheet) expandSharedFormulas() {
+	type master struct {
+		ref     reference.CellReference
+		formula string
+	}
+	masters := map[uint32]master{}
+	for _, r := range s.x.SheetData.Row {
+		for _, c := range r.C {
+			if c.F == nil || c.F.TAttr != sml.ST_CellFormulaTypeShared || c.F.SiAttr == nil ||
+				c.F.RefAttr == nil || c.RAttr == nil {
+				continue
+			}
+			ref, err := reference.ParseCellReference(*c.RAttr)
+			if err != nil {
+				continue
+			}
+			masters[*c.F.SiAttr] = master{ref, c.F.Content}
+		}
+	}
+	if len(masters) == 0 {
+		return
+	}
+	for _, r := range s.x.SheetData.Row {
+		for _, c := range r.C {
+			if c.F == nil || c.F.TAttr != sml.ST_CellFormulaTypeShared || c.F.SiAttr == nil || c.RAttr == nil {
+				continue
+			}
+			m, ok := masters[*c.F.SiAttr]
+			if !ok {
+				continue
+			}
+			ref, err := reference.ParseCellReference(*c.RAttr)
+			if err != nil {
+				continue
+			}
+			f := sml.NewCT_CellFormula()
+			f.Content = offsetFormula(m.formula, int64(ref.ColumnIdx)-int64(m.ref.ColumnIdx),
+				int64(ref.RowIdx)-int64(m.ref.RowIdx))
+			c.F = f
+		}
+	}
+}
+
+// updateReferences updates the references throughout the workbook to cells
+// on a sheet after a structural edit to the sheet.
+func (wb *Workbook) updateReferences(s Sheet, u refUpdater) {
+	name := s.Name()
+	sheets := []string{}
+	for _, sheet := range wb.Sheets() {
+		sheets = append(sheets, sheet.Name())
+	}
+	onSheet := func(prefix string) bool {
+		return sheetInRange(sheets, prefix, name)
+	}
+	for _, sheet := range wb.Sheets() {
+		current := sheet.x == s.x
+		for _, r := range sheet.x.SheetData.Row {
+			for _, c := range r.C {
+				if c.F == nil {
+					continue
+				}
+				c.F.Content = updateFormula(c.F.Content, onSheet, current, u)
+				if current && c.F.RefAttr != nil {
+					if ref, ok := u.ref(*c.F.RefAttr); ok {
+						c.F.RefAttr = &ref
+					}
+				}
+			}
+		}
+
+		cfs := sheet.x.ConditionalFormatting[:0]
+		for _, cf := range sheet.x.ConditionalFormatting {
+			for _, rule := range cf.CfRule {
+				for i, f := range rule.Formula {
+					rule.Formula[i] = updateFormula(f, onSheet, current, u)
+				}
+			}
+			if current && cf.SqrefAttr != nil {
+				sqref := updateSqref(*cf.SqrefAttr, u)
+				if len(sqref) == 0 {
+					continue
+				}
+				cf.SqrefAttr = &sqref
+			}
+			cfs = append(cfs, cf)
+		}
+		sheet.x.ConditionalFormatting = cfs
+
+		if sheet.x.DataValidations != nil {
+			dvs := sheet.x.DataValidations.DataValidation[:0]
+			for _, dv := range sheet.x.DataValidations.DataValidation {
+				if dv.Formula1 != nil {
+					*dv.Formula1 = updateFormula(*dv.Formula1, onSheet, current, u)
+				}
+				if dv.Formula2 != nil {
+					*dv.Formula2 = updateFormula(*dv.Formula2, onSheet, current, u)
+				}
+				if current {
+					dv.SqrefAttr = updateSqref(dv.SqrefAttr, u)
+					if len(dv.SqrefAttr) == 0 {
+						continue
+					}
+				}
+				dvs = append(dvs, dv)
+			}
+			sheet.x.DataValidations.DataValidation = dvs
+			sheet.x.DataValidations.CountAttr = unioffice.Uint32(uint32(len(dvs)))
+			if len(dvs) == 0 {
+				sheet.x.DataValidations = nil
+			}
+		}
+
+		if sheet.x.Hyperlinks != nil {
+			for _, hl := range sheet.x.Hyperlinks.Hyperlink {
+				if hl.LocationAttr != nil {
+					*hl.LocationAttr = updateFormula(*hl.LocationAttr, onSheet, false, u)
+				}
+			}
+		}
+
+		sheet.sparklineFormulas(func(f *string) {
+			*f = updateFormula(*f, onSheet, current, u)
+		})
+	}
+
+	s.updateOwnReferences(u)
+
+	if wb.x.DefinedNames != nil {
+		for _, dn := range wb.x.DefinedNames.DefinedName {
+			dn.Content = updateFormula(dn.Content, onSheet, false, u)
+		}
+	}
+	for _, c := range wb.charts {
+		updateChartReferences(reflect.ValueOf(c), func(f *string) {
+			*f = updateFormula(*f, onSheet, false, u)
+		})
+	}
+	for _, pc := range wb.pivotCaches {
+		if pc.CacheSource == nil || pc.CacheSource.WorksheetSource == nil {
+			continue
+		}
+		src := pc.CacheSource.WorksheetSource
+		if src.SheetAttr != nil && strings.EqualFold(*src.SheetAttr, name) && src.RefAttr != nil {
+			if ref, ok := u.ref(*src.RefAttr); ok {
+				src.RefAttr = &ref
+			}
+		}
+	}
+	if wb.calc != nil {
+		wb.calc.rebuild = true
+	}
+}
+
+// renameSheetReferences updates the references throughout the workbook to a
+// sheet that has been renamed.
+func (wb *Workbook) renameSheetReferences(old, name string) {
+	wb.rewriteFormulas(func(f *string) {
+		*f = renameSheetPrefixes(*f, old, name)
+	})
+	for _, pc := range wb.pivotCaches {
+		if pc.CacheSource == nil || pc.CacheSource.WorksheetSource == nil {
+			continue
+		}
+		src := pc.CacheSource.WorksheetSource
+		if src.SheetAttr != nil && strings.EqualFold(*src.SheetAttr, old) {
+			src.SheetAttr = unioffice.String(name)
+		}
+	}
+	if wb.calc != nil {
+		wb.calc.rebuild = true
+	}
+}
+
+// rewriteFormulas calls fn with each formula in the workbook, including the
+// formulas of conditional formats, data validations, hyperlinks, sparklines,
+// defined names, tables and charts, so that it can rewrite them.
+func (wb *Workbook) rewriteFormulas(fn func(f *string)) {
+	for _, sheet := range wb.Sheets() {
+		if sheet.x.SheetData != nil {
+			for _, r := range sheet.x.SheetData.Row {
+				for _, c := range r.C {
+					if c.F != nil && c.F.Content != "" {
+						fn(&c.F.Content)
+					}
+				}
+			}
+		}
+		for _, cf := range sheet.x.ConditionalFormatting {
+			for _, rule := range cf.CfRule {
+				for i := range rule.Formula {
+					fn(&rule.Formula[i])
+				}
+			}
+		}
+		if sheet.x.DataValidations != nil {
+			for _, dv := range sheet.x.DataValidations.DataValidation {
+				if dv.Formula1 != nil {
+					fn(dv.Formula1)
+				}
+				if dv.Formula2 != nil {
+					fn(dv.Formula2)
+				}
+			}
+		}
+		if sheet.x.Hyperlinks != nil {
+			for _, hl := range sheet.x.Hyperlinks.Hyperlink {
+				if hl.LocationAttr != nil {
+					fn(hl.LocationAttr)
+				}
+			}
+		}
+		sheet.sparklineFormulas(fn)
+	}
+	if wb.x.DefinedNames != nil {
+		for _, dn := range wb.x.DefinedNames.DefinedName {
+			fn(&dn.Content)
+		}
+	}
+	for _, tbl := range wb.tables {
+		for _, c := range tbl.TableColumns.TableColumn {
+			if c.CalculatedColumnFormula != nil {
+				fn(&c.CalculatedColumnFormula.Content)
+			}
+			if c.TotalsRowFormula != nil {
+				fn(&c.TotalsRowFormula.Content)
+			}
+		}
+	}
+	for _, c := range wb.charts {
+		updateChartReferences(reflect.ValueOf(c), fn)
+	}
+}
+
+// updateOwnReferences updates the ranges stored in the edited sheet itself.
+func (s Sheet) updateOwnReferences(u refUpdater) {
+	if s.x.MergeCells != nil {
+		mcs := s.x.MergeCells.MergeCell[:0]
+		for _, mc := range s.x.MergeCells.MergeCell {
+			ref, ok := u.ref(mc.RefAttr)
+			// a merged cell that is reduced to a single cell is removed
+			if !ok || !strings.Contains(ref, ":") {
+				continue
+			}
+			if from, to, err := reference.ParseRangeReference(ref); err != nil || from == to {
+				continue
+			}
+			mc.RefAttr = ref
+			mcs = append(mcs, mc)
+		}
+		s.x.MergeCells.MergeCell = mcs
+		s.x.MergeCells.CountAttr = unioffice.Uint32(uint32(len(mcs)))
+		if len(mcs) == 0 {
+			s.x.MergeCells = nil
+		}
+	}
+
+	if s.x.Hyperlinks != nil {
+		hls := s.x.Hyperlinks.Hyperlink[:0]
+		for _, hl := range s.x.Hyperlinks.Hyperlink {
+			ref, ok := u.ref(hl.RefAttr)
+			if !ok {
+				continue
+			}
+			hl.RefAttr = ref
+			hls = append(hls, hl)
+		}
+		s.x.Hyperlinks.Hyperlink = hls
+	}
+
+	if s.x.AutoFilter != nil && s.x.AutoFilter.RefAttr != nil {
+		if ref, ok := u.ref(*s.x.AutoFilter.RefAttr); ok {
+			s.x.AutoFilter.RefAttr = &ref
+		} else {
+			s.ClearAutoFilter()
+		}
+	}
+
+	s.updateSparklineLocations(u)
+
+	// the dimension is recomputed by Excel
+	s.x.Dimension = nil
+
+	for _, cols := range s.x.Cols {
+		kept := cols.Col[:0]
+		for _, col := range cols.Col {
+			from, to, ok := u.columnRange(col.MinAttr-1, col.MaxAttr-1)
+			if !ok {
+				continue
+			}
+			col.MinAttr, col.MaxAttr = from+1, to+1
+			kept = append(kept, col)
+		}
+		cols.Col = kept
+	}
+	cols := s.x.Cols[:0]
+	for _, c := range s.x.Cols {
+		if len(c.Col) > 0 {
+			cols = append(cols, c)
+		}
+	}
+	s.x.Cols = cols
+
+	wb := s.w
+	for i, ws := range wb.xws {
+		if ws != s.x {
+			continue
+		}
+		if i < len(wb.comments) && wb.comments[i] != nil {
+			cl := wb.comments[i].CommentList
+			kept := cl.Comment[:0]
+			for _, c := range cl.Comment {
+				ref, ok := u.ref(c.RefAttr)
+				if !ok {
+					continue
+				}
+				c.RefAttr = ref
+				kept = append(kept, c)
+			}
+			cl.Comment = kept
+		}
+	}
+
+	for i, tbl := range wb.tables {
+		if ts, ok := wb.tableSheet(i); !ok || ts.x != s.x {
+			continue
+		}
+		updateTableReferences(tbl, u)
+	}
+	for _, pt := range s.PivotTables() {
+		if pt.x.Location == nil {
+			continue
+		}
+		if ref, ok := u.ref(pt.x.Location.RefAttr); ok {
+			pt.x.Location.RefAttr = ref
+		}
+	}
+}
+
+// updateTableReferences updates the range of a table, adding or removing table
+// columns if sheet columns are inserted into or removed from the table.
+func updateTableReferences(tbl *sml.Table, u refUpdater) {
+	from, to, err := reference.ParseRangeReference(tbl.RefAttr)
+	if err != nil {
+		return
+	}
+	if qu, ok := u.(queryUpdate); ok && qu.columns() && tbl.TableColumns != nil {
+		tc := tbl.TableColumns
+		at, count := qu.q.Index, qu.q.Count
+		switch {
+		case qu.q.UpdateType == formula.UpdateTypeRemoveColumns:
+			kept := tc.TableColumn[:0]
+			for i, c := range tc.TableColumn {
+				idx := from.ColumnIdx + uint32(i)
+				if idx >= at && idx < at+count {
+					continue
+				}
+				kept = append(kept, c)
+			}
+			tc.TableColumn = kept
+		case at > from.ColumnIdx && at <= to.ColumnIdx:
+			pos := int(at - from.ColumnIdx)
+			added := []*sml.CT_TableColumn{}
+			for n := uint32(0); n < count; n++ {
+				c := sml.NewCT_TableColumn()
+				c.IdAttr = nextTableColumnID(tc)
+				c.NameAttr = uniqueTableColumnName(tc)
+				tc.TableColumn = append(tc.TableColumn, c)
+				added = append(added, c)
+			}
+			cols := append([]*sml.CT_TableColumn{}, tc.TableColumn[:pos]...)
+			cols = append(cols, added...)
+			tc.TableColumn = append(cols, tc.TableColumn[pos:len(tc.TableColumn)-len(added)]...)
+		}
+		tc.CountAttr = unioffice.Uint32(uint32(len(tc.TableColumn)))
+	}
+
+	nfrom, nto, ok := u.area(from, to)
+	if !ok {
+		return
+	}
+	tbl.RefAttr = nfrom.String() + ":" + nto.String()
+	if tbl.AutoFilter != nil && tbl.AutoFilter.RefAttr != nil {
+		if ref, ok := u.ref(*tbl.AutoFilter.RefAttr); ok {
+			tbl.AutoFilter.RefAttr = &ref
+		}
+	}
+}
+
+func nextTableColumnID(tc *sml.CT_TableColumns) uint32 {
+	id := uint32(0)
+	for _, c := range tc.TableColumn {
+		if c.IdAttr > id {
+			id = c.IdAttr
+		}
+	}
+	return id + 1
+}
+
+func uniqueTableColumnName(tc *sml.CT_TableColumns) string {
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("Column%d", i)
+		used := false
+		for _, c := range tc.TableColumn {
+			if strings.EqualFold(c.NameAttr, name) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return name
+		}
+	}
+}
+
+// updateChartReferences calls fn with the formula of each data reference
+// within a chart.
+func updateChartReferences(v reflect.Value, fn func(f *string)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			updateChartReferences(v.Elem(), fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			updateChartReferences(v.Index(i), fn)
+		}
+	case reflect.Struct:
+		if v.CanAddr() {
+			switch x := v.Addr().Interface().(type) {
+			case *crt.CT_NumRef:
+				fn(&x.F)
+				return
+			case *crt.CT_StrRef:
+				fn(&x.F)
+				return
+			case *crt.CT_MultiLvlStrRef:
+				fn(&x.F)
+				return
+			}
+		}
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			updateChartReferences(v.Field(i), fn)
+		}
+	}
+}
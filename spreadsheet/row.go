@@ -62,6 +62,41 @@ func (r Row) SetHidden(hidden bool) {
 	}
 }
 
+// OutlineLevel returns the outline level of the row, which is the number of
+// groups that it's in.
+func (r Row) OutlineLevel() uint8 {
+	if r.x.OutlineLevelAttr == nil {
+		return 0
+	}
+	return *r.x.OutlineLevelAttr
+}
+
+// SetOutlineLevel sets the outline level of the row from 0 to 7.  Sheet's
+// GroupRows and UngroupRows also update the outline level of the sheet.
+func (r Row) SetOutlineLevel(level uint8) {
+	if level == 0 {
+		r.x.OutlineLevelAttr = nil
+	} else {
+		r.x.OutlineLevelAttr = unioffice.Uint8(level)
+	}
+}
+
+// IsCollapsed returns whether the group of rows that the row summarizes is
+// collapsed.
+func (r Row) IsCollapsed() bool {
+	return r.x.CollapsedAttr != nil && *r.x.CollapsedAttr
+}
+
+// SetCollapsed marks the group of rows that the row summarizes as collapsed.
+// It doesn't hide the rows of the group, which Sheet's CollapseRows does.
+func (r Row) SetCollapsed(b bool) {
+	if !b {
+		r.x.CollapsedAttr = nil
+	} else {
+		r.x.CollapsedAttr = unioffice.Bool(true)
+	}
+}
+
 // AddCell adds a cell to a spreadsheet.
 func (r Row) AddCell() Cell {
 	numCells := uint32(len(r.x.C))
@@ -9,11 +9,11 @@ package spreadsheet
 
 import (
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 
 	"github.com/unidoc/unioffice/spreadsheet/formula"
+	"github.com/unidoc/unioffice/spreadsheet/internal/refscan"
 	"github.com/unidoc/unioffice/spreadsheet/reference"
 
 	"github.com/unidoc/unioffice"
@@ -118,8 +118,12 @@ func (s Sheet) AddRow() Row {
 
 // InsertRow inserts a new row into a spreadsheet at a particular row number.  This
 // row will now be the row number specified, and any rows after it will be renumbed.
+// References to the moved cells in formulas, merged cells, defined names,
+// conditional formatting, data validations, hyperlinks, auto filters, tables
+// and charts are updated.
 func (s Sheet) InsertRow(rowNum int) Row {
 	rIdx := uint32(rowNum)
+	s.expandSharedFormulas()
 
 	// Renumber every row after the row we're inserting
 	for _, r := range s.Rows() {
@@ -136,26 +140,178 @@ func (s Sheet) InsertRow(rowNum int) Row {
 			}
 		}
 	}
+	s.w.updateReferences(s, shiftQuery(formula.UpdateTypeInsertRows, rIdx, 1))
 
-	// check for merged cells, and try to intelligently adjust them
-	// issue #212
-	for _, mc := range s.MergedCells() {
-		from, to, err := reference.ParseRangeReference(mc.Reference())
-		if err != nil {
+	// finally AddNumberedRow will add and re-sort rows
+	return s.AddNumberedRow(rIdx)
+}
+
+// RemoveRow removes a row from a spreadsheet, renumbering the rows after it.
+// References to the cells in the removed row become #REF! and references to
+// cells after it are updated as with InsertRow.
+func (s Sheet) RemoveRow(rowNum int) error {
+	if rowNum < 1 {
+		return fmt.Errorf("invalid row number %d", rowNum)
+	}
+	rIdx := uint32(rowNum)
+	s.expandSharedFormulas()
+
+	rows := s.x.SheetData.Row[:0]
+	for _, r := range s.x.SheetData.Row {
+		if r.RAttr != nil && *r.RAttr == rIdx {
 			continue
 		}
-		if int(from.RowIdx) >= rowNum {
-			from.RowIdx++
+		if r.RAttr != nil && *r.RAttr > rIdx {
+			Row{s.w, s.x, r}.renumberAs(*r.RAttr - 1)
+		}
+		rows = append(rows, r)
+	}
+	s.x.SheetData.Row = rows
+	s.w.updateReferences(s, shiftQuery(formula.UpdateTypeRemoveRows, rIdx, 1))
+	return nil
+}
+
+// InsertColumn inserts a new column into a spreadsheet before a particular
+// column (e.g. 'C'), moving that column and the columns after it to the
+// right.  References to the moved cells are updated as with InsertRow.
+func (s Sheet) InsertColumn(column string) error {
+	cIdx, err := parseColumn(column)
+	if err != nil {
+		return err
+	}
+	s.expandSharedFormulas()
+	s.shiftColumns(cIdx, false)
+	s.w.updateReferences(s, shiftQuery(formula.UpdateTypeInsertColumns, cIdx, 1))
+	return nil
+}
+
+// RemoveColumn removes a column (e.g. 'C') from a spreadsheet, moving the
+// columns after it to the left.  References to the cells in the removed column
+// become #REF! and references to cells after it are updated as with
+// InsertRow.
+func (s Sheet) RemoveColumn(column string) error {
+	cIdx, err := parseColumn(column)
+	if err != nil {
+		return err
+	}
+	s.expandSharedFormulas()
+	s.shiftColumns(cIdx, true)
+	s.w.updateReferences(s, shiftQuery(formula.UpdateTypeRemoveColumns, cIdx, 1))
+	return nil
+}
+
+// parseColumn returns the index of a column name such as 'C'.
+func parseColumn(column string) (uint32, error) {
+	column = strings.ToUpper(column)
+	if !refscan.IsColumn(column) || strings.HasPrefix(column, "$") {
+		return 0, fmt.Errorf("invalid column %s", column)
+	}
+	return reference.ColumnToIndex(column), nil
+}
+
+// shiftColumns moves the cells at or after a column one column to the right,
+// or removes the cells in the column and moves the cells after it one column
+// to the left.
+func (s Sheet) shiftColumns(cIdx uint32, remove bool) {
+	for _, r := range s.x.SheetData.Row {
+		cells := r.C[:0]
+		for _, c := range r.C {
+			if c.RAttr == nil {
+				cells = append(cells, c)
+				continue
+			}
+			cref, err := reference.ParseCellReference(*c.RAttr)
+			if err != nil || cref.ColumnIdx < cIdx {
+				cells = append(cells, c)
+				continue
+			}
+			switch {
+			case !remove:
+				cref.ColumnIdx++
+			case cref.ColumnIdx == cIdx:
+				continue
+			default:
+				cref.ColumnIdx--
+			}
+			cref.Column = reference.IndexToColumn(cref.ColumnIdx)
+			c.RAttr = unioffice.String(cref.String())
+			cells = append(cells, c)
 		}
-		if int(to.RowIdx) >= rowNum {
-			to.RowIdx++
+		r.C = cells
+		// the spans are only an optimization hint, so it's simpler to remove
+		// them than to update them
+		r.SpansAttr = nil
+	}
+}
+
+// MoveRange moves the cells in a range (e.g. 'A1:B5') so that its top left
+// cell is at another cell (e.g. 'D1'), replacing any cells already there.
+// References to the moved cells are updated to refer to their new location and
+// references to the replaced cells become #REF!, as when cutting and pasting
+// in Excel.
+func (s Sheet) MoveRange(rangeRef, dest string) error {
+	from, to, err := reference.ParseRangeReference(rangeRef)
+	if err != nil {
+		if from, err = reference.ParseCellReference(rangeRef); err != nil {
+			return fmt.Errorf("invalid range %s: %s", rangeRef, err)
 		}
-		ref := fmt.Sprintf("%s:%s", from, to)
-		mc.SetReference(ref)
+		to = from
 	}
+	d, err := reference.ParseCellReference(dest)
+	if err != nil {
+		return fmt.Errorf("invalid destination %s: %s", dest, err)
+	}
+	u := moveUpdate{from: from, to: to,
+		dCol: int64(d.ColumnIdx) - int64(from.ColumnIdx),
+		dRow: int64(d.RowIdx) - int64(from.RowIdx)}
+	if u.dCol == 0 && u.dRow == 0 {
+		return nil
+	}
+	s.expandSharedFormulas()
 
-	// finally AddNumberedRow will add and re-sort rows
-	return s.AddNumberedRow(rIdx)
+	// remove the moved cells along with those they replace
+	moved := []*sml.CT_Cell{}
+	for _, r := range s.x.SheetData.Row {
+		cells := r.C[:0]
+		for _, c := range r.C {
+			if c.RAttr == nil {
+				cells = append(cells, c)
+				continue
+			}
+			cref, err := reference.ParseCellReference(*c.RAttr)
+			switch {
+			case err != nil:
+				cells = append(cells, c)
+			case u.inSource(cref):
+				c.RAttr = unioffice.String(u.offset(cref).String())
+				moved = append(moved, c)
+			case !u.inDestination(cref):
+				cells = append(cells, c)
+			}
+		}
+		r.C = cells
+		r.SpansAttr = nil
+	}
+
+	for _, c := range moved {
+		cref, _ := reference.ParseCellReference(*c.RAttr)
+		r := s.Row(cref.RowIdx)
+		r.x.C = append(r.x.C, c)
+		sort.Slice(r.x.C, func(i, j int) bool {
+			return cellColumnIdx(r.x.C[i]) < cellColumnIdx(r.x.C[j])
+		})
+	}
+	s.w.updateReferences(s, u)
+	return nil
+}
+
+// cellColumnIdx returns the column index of a cell.
+func cellColumnIdx(c *sml.CT_Cell) uint32 {
+	if c.RAttr == nil {
+		return 0
+	}
+	cref, _ := reference.ParseCellReference(*c.RAttr)
+	return cref.ColumnIdx
 }
 
 // Name returns the sheet name
@@ -163,9 +319,14 @@ func (s Sheet) Name() string {
 	return s.cts.NameAttr
 }
 
-// SetName sets the sheet name.
+// SetName sets the sheet name, updating the formulas, defined names and charts
+// in the workbook that refer to the sheet by its old name.
 func (s Sheet) SetName(name string) {
+	old := s.cts.NameAttr
 	s.cts.NameAttr = name
+	if s.w != nil && old != "" && old != name {
+		s.w.renameSheetReferences(old, name)
+	}
 }
 
 // Validate validates the sheet, returning an error if it is found to be invalid.
@@ -614,6 +775,57 @@ func (s Sheet) AddDataValidation() DataValidation {
 	return DataValidation{dv}
 }
 
+// AddPivotTable adds a pivot table with its top left corner at location that
+// summarizes the data in sourceRef, a range reference that includes the sheet
+// name (e.g. "'Sheet 1'!A1:D100").  The first row of the range contains the
+// field names.
+func (s Sheet) AddPivotTable(name, location, sourceRef string) (PivotTable, error) {
+	sheet, ref, ok := reference.SplitSheetPrefix(sourceRef)
+	if !ok {
+		return PivotTable{}, fmt.Errorf("source reference %s must include a sheet name", sourceRef)
+	}
+	src := sml.NewCT_CacheSource()
+	src.TypeAttr = sml.ST_SourceTypeWorksheet
+	src.WorksheetSource = sml.NewCT_WorksheetSource()
+	src.WorksheetSource.SheetAttr = unioffice.String(sheet)
+	src.WorksheetSource.RefAttr = unioffice.String(strings.Replace(ref, "$", "", -1))
+	return s.addPivotTable(name, location, src)
+}
+
+// AddPivotTableFromTable adds a pivot table with its top left corner at
+// location that summarizes the data in a table.
+func (s Sheet) AddPivotTableFromTable(name, location string, tbl Table) (PivotTable, error) {
+	if tbl.Name() == "" {
+		return PivotTable{}, fmt.Errorf("table must have a name")
+	}
+	src := sml.NewCT_CacheSource()
+	src.TypeAttr = sml.ST_SourceTypeWorksheet
+	src.WorksheetSource = sml.NewCT_WorksheetSource()
+	src.WorksheetSource.NameAttr = unioffice.String(tbl.Name())
+	return s.addPivotTable(name, location, src)
+}
+
+// PivotTables returns the pivot tables on the sheet.
+func (s Sheet) PivotTables() []PivotTable {
+	ret := []PivotTable{}
+	for i, ws := range s.w.xws {
+		if ws != s.x {
+			continue
+		}
+		for _, r := range s.w.xwsRels[i].Relationships() {
+			if r.Type() != unioffice.PivotTableType {
+				continue
+			}
+			for j := range s.w.pivotTables {
+				if r.Target() == unioffice.RelativeFilename(unioffice.DocTypeSpreadsheet, unioffice.WorksheetType, unioffice.PivotTableType, j+1) {
+					ret = append(ret, s.w.pivotTable(s, j))
+				}
+			}
+		}
+	}
+	return ret
+}
+
 // ClearCachedFormulaResults clears any computed formula values that are stored
 // in the sheet. This may be required if you modify cells that are used as a
 // formula input to force the formulas to be recomputed the next time the sheet
@@ -629,82 +841,16 @@ func (s *Sheet) ClearCachedFormulaResults() {
 }
 
 // RecalculateFormulas re-computes any computed formula values that are stored
-// in the sheet. As gooxml formula support is still new and not all functins are
-// supported,  if formula execution fails either due to a parse error or missing
-// function, or erorr in the result (even if expected) the cached value will be
-// left empty allowing Excel to recompute it on load.
+// in the sheet. As gooxml formula support is still new and not all functions
+// are supported, formulas that can't be parsed or call a missing function
+// store an error value, as do formulas whose result is an error.  The cached
+// value is left empty only for circular references that aren't calculated
+// iteratively, allowing Excel to compute them on load.  Formulas are
+// evaluated with the evaluator last passed to
+// Workbook.RecalculateFormulasWith, if any.
 func (s *Sheet) RecalculateFormulas() {
-	ev := formula.NewEvaluator()
-	ctx := s.FormulaContext()
-	for _, r := range s.Rows() {
-		for _, c := range r.Cells() {
-			if c.X().F != nil {
-				formStr := c.X().F.Content
-
-				// if the formula is shared, but the content is empty, then it's
-				// a cell that a shared formula is applied to so we can ignreo
-				// for now.  The value will be calculated later and applied with
-				// setShared
-				if c.X().F.TAttr == sml.ST_CellFormulaTypeShared && len(formStr) == 0 {
-					continue
-				}
-
-				res := ev.Eval(ctx, formStr).AsString()
-				if res.Type == formula.ResultTypeError {
-					unioffice.Log("error evaulating formula %s: %s", formStr, res.ErrorMessage)
-					c.X().V = nil
-				} else {
-					if res.Type == formula.ResultTypeNumber {
-						c.X().TAttr = sml.ST_CellTypeN
-					} else {
-						c.X().TAttr = sml.ST_CellTypeInlineStr
-					}
-					c.X().V = unioffice.String(res.Value())
-
-					// the formula is of type array, so if the result is also an
-					// array we need to expand the array out into cells
-					if c.X().F.TAttr == sml.ST_CellFormulaTypeArray && res.Type == formula.ResultTypeArray {
-						s.setArray(c.Reference(), res)
-					} else if c.X().F.TAttr == sml.ST_CellFormulaTypeShared && c.X().F.RefAttr != nil {
-						from, to, err := reference.ParseRangeReference(*c.X().F.RefAttr)
-						if err != nil {
-							log.Printf("error in shared formula reference: %s", err)
-							continue
-						}
-						s.setShared(c.Reference(), from, to, formStr)
-					}
-				}
-			}
-		}
-	}
-}
-
-func (s *Sheet) setShared(origin string, from, to reference.CellReference, formulaStr string) {
-	ctx := s.FormulaContext()
-	ev := formula.NewEvaluator()
-
-	for r := from.RowIdx; r <= to.RowIdx; r++ {
-		for c := from.ColumnIdx; c <= to.ColumnIdx; c++ {
-			rowOffset := r - from.RowIdx
-			colOffset := c - from.ColumnIdx
-
-			// add an offset on the contex so that cell references will be
-			// offset during formula evaluation
-			ctx.SetOffset(colOffset, rowOffset)
-			res := ev.Eval(ctx, formulaStr)
-
-			cr := fmt.Sprintf("%s%d", reference.IndexToColumn(c), r)
-			c := s.Cell(cr)
-			if res.Type == formula.ResultTypeNumber {
-				c.X().TAttr = sml.ST_CellTypeN
-			} else {
-				c.X().TAttr = sml.ST_CellTypeInlineStr
-			}
-			c.X().V = unioffice.String(res.Value())
-		}
-	}
-	_ = ev
-	_ = ctx
+	e := s.w.calcEngine()
+	e.recalculate(s.x, e.ev)
 }
 
 // setArray expands an array into cached values starting at the origin which
@@ -719,7 +865,7 @@ func (s *Sheet) setArray(origin string, arr formula.Result) error {
 		sr := s.Row(cref.RowIdx + uint32(ir))
 		for ic, val := range row {
 			cell := sr.Cell(reference.IndexToColumn(cref.ColumnIdx + uint32(ic)))
-			cell.SetCachedFormulaResult(val.String())
+			setCachedResult(cell.x, val)
 		}
 	}
 	return nil
@@ -14,6 +14,8 @@ import (
 	"testing"
 
 	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/measurement"
+	"github.com/unidoc/unioffice/schema/soo/sml"
 	"github.com/unidoc/unioffice/spreadsheet"
 )
 
@@ -334,3 +336,380 @@ func TestSortStrings(t *testing.T) {
 		}
 	}
 }
+
+func expectFormula(t *testing.T, c spreadsheet.Cell, exp string) {
+	// TODO: uncomment once we quit building on 1.8
+	//t.Helper()
+	if got := c.GetFormula(); got != exp {
+		t.Errorf("expected %s formula %s, got %s", c.Reference(), exp, got)
+	}
+}
+
+func TestInsertRemoveRow(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	other := wb.AddSheet()
+	for i := 1; i <= 5; i++ {
+		sheet.Cell(fmt.Sprintf("A%d", i)).SetNumber(float64(i))
+	}
+	sheet.Cell("B1").SetFormulaRaw("SUM(A1:A5)+A4*$A$5")
+	sheet.Cell("B2").SetFormulaRaw(`A3&"A3"`)
+	other.Cell("A1").SetFormulaRaw("'Sheet 1'!A4+A4+SUM('Sheet 1'!3:4)")
+	wb.AddDefinedName("Total", "'Sheet 1'!$A$1:$A$5")
+	sheet.AddMergedCells("C3", "D4")
+
+	sheet.InsertRow(3)
+	expectNumber(t, sheet.Cell("A4"), 3)
+	expectFormula(t, sheet.Cell("B1"), "SUM(A1:A6)+A5*$A$6")
+	expectFormula(t, sheet.Cell("B2"), `A4&"A3"`)
+	expectFormula(t, other.Cell("A1"), "'Sheet 1'!A5+A4+SUM('Sheet 1'!4:5)")
+	if got := wb.DefinedNames()[0].Content(); got != "'Sheet 1'!$A$1:$A$6" {
+		t.Errorf("expected defined name 'Sheet 1'!$A$1:$A$6, got %s", got)
+	}
+	if got := sheet.MergedCells()[0].Reference(); got != "C4:D5" {
+		t.Errorf("expected merged cell C4:D5, got %s", got)
+	}
+
+	if err := sheet.RemoveRow(5); err != nil {
+		t.Fatalf("error removing row: %s", err)
+	}
+	expectNumber(t, sheet.Cell("A5"), 5)
+	expectFormula(t, sheet.Cell("B1"), "SUM(A1:A5)+#REF!*$A$5")
+	expectFormula(t, other.Cell("A1"), "'Sheet 1'!#REF!+A4+SUM('Sheet 1'!4:4)")
+	if got := sheet.MergedCells()[0].Reference(); got != "C4:D4" {
+		t.Errorf("expected merged cell C4:D4, got %s", got)
+	}
+	if err := sheet.Validate(); err != nil {
+		t.Errorf("expected a valid sheet: %s", err)
+	}
+}
+
+func TestInsertRowSheetPrefixes(t *testing.T) {
+	wb := spreadsheet.New()
+	first := wb.AddSheet()
+	first.SetName("First")
+	data := wb.AddSheet()
+	data.SetName("Data")
+	last := wb.AddSheet()
+	last.SetName("Last")
+	// sheet names are matched without regard to case, and 3D references are
+	// updated if they span the edited sheet
+	first.Cell("A1").SetFormulaRaw("data!A4+SUM(Data:Last!A4)+SUM(First:Last!A4)+SUM('First:data'!A4)+SUM(First:First!A4)")
+
+	data.InsertRow(3)
+	expectFormula(t, first.Cell("A1"), "data!A5+SUM(Data:Last!A5)+SUM(First:Last!A5)+SUM('First:data'!A5)+SUM(First:First!A4)")
+}
+
+func TestInsertRemoveColumn(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	row := sheet.AddRow()
+	for i := 1; i <= 4; i++ {
+		row.AddCell().SetNumber(float64(i))
+	}
+	sheet.Cell("A2").SetFormulaRaw("SUM(A1:D1)+C1+SUM(B:C)+SUM(1:1)")
+	sheet.Cell("B2").SetFormulaShared("B1*2", 0, 2)
+	sheet.Column(3).SetWidth(20)
+
+	if err := sheet.InsertColumn("B"); err != nil {
+		t.Fatalf("error inserting column: %s", err)
+	}
+	expectNumber(t, sheet.Cell("C1"), 2)
+	expectFormula(t, sheet.Cell("A2"), "SUM(A1:E1)+D1+SUM(C:D)+SUM(1:1)")
+	expectFormula(t, sheet.Cell("C2"), "C1*2")
+	expectFormula(t, sheet.Cell("E2"), "E1*2")
+	if got := sheet.X().Cols[0].Col[0].MinAttr; got != 4 {
+		t.Errorf("expected the column width to move to column 4, got %d", got)
+	}
+
+	if err := sheet.RemoveColumn("D"); err != nil {
+		t.Fatalf("error removing column: %s", err)
+	}
+	expectNumber(t, sheet.Cell("D1"), 4)
+	expectFormula(t, sheet.Cell("A2"), "SUM(A1:D1)+#REF!+SUM(C:C)+SUM(1:1)")
+	expectFormula(t, sheet.Cell("D2"), "D1*2")
+	if got := len(sheet.X().Cols); got != 0 {
+		t.Errorf("expected the column width to be removed, got %d", got)
+	}
+	if err := sheet.InsertColumn("1"); err == nil {
+		t.Errorf("expected an error for an invalid column")
+	}
+}
+
+func TestMoveRange(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetNumber(1)
+	sheet.Cell("A2").SetNumber(2)
+	sheet.Cell("C1").SetNumber(3)
+	sheet.Cell("B1").SetFormulaRaw("A1+A2+C1+SUM(A1:A2)")
+	sheet.Cell("B2").SetFormulaRaw("A1*2")
+
+	if err := sheet.MoveRange("A1:B2", "C1"); err != nil {
+		t.Fatalf("error moving range: %s", err)
+	}
+	expectNumber(t, sheet.Cell("C1"), 1)
+	expectNumber(t, sheet.Cell("C2"), 2)
+	expectFormula(t, sheet.Cell("D1"), "C1+C2+#REF!+SUM(C1:C2)")
+	expectFormula(t, sheet.Cell("D2"), "C1*2")
+	if sheet.Cell("A1").GetString() != "" {
+		t.Errorf("expected A1 to be empty after the move")
+	}
+	if err := sheet.MoveRange("A1:B2", "!"); err == nil {
+		t.Errorf("expected an error for an invalid destination")
+	}
+}
+
+func TestSetNameUpdatesReferences(t *testing.T) {
+	wb := spreadsheet.New()
+	data := wb.AddSheet()
+	calc := wb.AddSheet()
+	data.Cell("A1").SetNumber(2)
+	calc.Cell("A1").SetFormulaRaw("'Sheet 1'!A1*2")
+	calc.Cell("A2").SetFormulaRaw("A1+1")
+	// only the sheet prefixes are rewritten, the rest of the text is kept
+	calc.Cell("A3").SetFormulaRaw("'Sheet 1'!A1*10%")
+	calc.Cell("A4").SetFormulaRaw("'Sheet 1'!A1*1E+3")
+	calc.Cell("A5").SetFormulaRaw("-'Sheet 1'!A1^2")
+	calc.Cell("A6").SetFormulaRaw("SUM('Sheet 1'!A:A)+SUM('sheet 1'!$1:$2)")
+	calc.Cell("A7").SetFormulaRaw(`"'Sheet 1'!A1"&Sheet2!A1&'[1]Sheet 1'!A1`)
+	calc.Cell("A8").SetFormulaRaw("SUM('Sheet 1:Sheet 2'!B1)")
+	wb.AddDefinedName("Value", data.RangeReference("$A$1"))
+	wb.AddDefinedName("_xlnm.Print_Titles", "'Sheet 1'!$A:$A,'Sheet 1'!$1:$2")
+
+	data.SetName("Data 2024")
+	expectFormula(t, calc.Cell("A1"), "'Data 2024'!A1*2")
+	expectFormula(t, calc.Cell("A2"), "A1+1")
+	expectFormula(t, calc.Cell("A3"), "'Data 2024'!A1*10%")
+	expectFormula(t, calc.Cell("A4"), "'Data 2024'!A1*1E+3")
+	expectFormula(t, calc.Cell("A5"), "-'Data 2024'!A1^2")
+	expectFormula(t, calc.Cell("A6"), "SUM('Data 2024'!A:A)+SUM('Data 2024'!$1:$2)")
+	expectFormula(t, calc.Cell("A7"), `"'Sheet 1'!A1"&Sheet2!A1&'[1]Sheet 1'!A1`)
+	expectFormula(t, calc.Cell("A8"), "SUM('Data 2024:Sheet 2'!B1)")
+	if got := wb.DefinedNames()[0].Content(); got != "'Data 2024'!$A$1" {
+		t.Errorf("expected defined name to refer to the renamed sheet, got %s", got)
+	}
+	if got := wb.DefinedNames()[1].Content(); got != "'Data 2024'!$A:$A,'Data 2024'!$1:$2" {
+		t.Errorf("expected print titles to refer to the renamed sheet, got %s", got)
+	}
+	wb.RecalculateFormulas()
+	expectNumber(t, calc.Cell("A1"), 4)
+
+	// unquoted prefixes are only quoted if the new name requires it
+	calc.SetName("Calc")
+	data.Cell("B1").SetFormulaRaw("Calc!A1+SUM(calc!A:A)")
+	calc.SetName("Calc 2")
+	expectFormula(t, data.Cell("B1"), "'Calc 2'!A1+SUM('Calc 2'!A:A)")
+	calc.SetName("Totals")
+	expectFormula(t, data.Cell("B1"), "'Totals'!A1+SUM('Totals'!A:A)")
+	data.Cell("B2").SetFormulaRaw("Totals!A1")
+	calc.SetName("Summary")
+	expectFormula(t, data.Cell("B2"), "Summary!A1")
+	calc.SetName("A1")
+	expectFormula(t, data.Cell("B2"), "'A1'!A1")
+
+	// either sheet of a 3D reference without quotes
+	data.SetName("Jan")
+	calc.SetName("Mar")
+	data.Cell("B3").SetFormulaRaw("SUM(Jan:Mar!A4)+SUM(jan:Other!A4)")
+	data.SetName("January")
+	expectFormula(t, data.Cell("B3"), "SUM(January:Mar!A4)+SUM(January:Other!A4)")
+	calc.SetName("Q1 End")
+	expectFormula(t, data.Cell("B3"), "SUM('January:Q1 End'!A4)+SUM(January:Other!A4)")
+}
+
+func TestPrintSetup(t *testing.T) {
+	wb := spreadsheet.New()
+	wb.AddSheet()
+	sheet := wb.AddSheet()
+	ps := sheet.PrintSetup()
+	ps.SetOrientation(sml.ST_OrientationLandscape)
+	ps.SetPaperSize(spreadsheet.PaperSizeA4)
+	ps.SetFitToPage(1, 0)
+	ps.SetMargins(0.5*measurement.Inch, 0.5*measurement.Inch, measurement.Inch, measurement.Inch, 0.3*measurement.Inch, 0.3*measurement.Inch)
+	ps.SetHeader("", spreadsheet.HeaderFooterSheetName, spreadsheet.HeaderFooterDate)
+	ps.SetFooter("", "Page "+spreadsheet.HeaderFooterPageNumber+" of "+spreadsheet.HeaderFooterPageCount, "")
+	ps.AddRowBreak(21)
+	ps.AddRowBreak(11)
+	ps.AddColumnBreak("E")
+
+	if err := ps.SetPrintArea("A1:H40"); err != nil {
+		t.Fatalf("error setting print area: %s", err)
+	}
+	if err := ps.SetPrintTitles("1:2", "A"); err != nil {
+		t.Fatalf("error setting print titles: %s", err)
+	}
+	if err := ps.SetPrintTitles("1:x", ""); err == nil {
+		t.Errorf("expected an error for invalid title rows")
+	}
+
+	x := sheet.X()
+	if x.PageSetup.OrientationAttr != sml.ST_OrientationLandscape || *x.PageSetup.PaperSizeAttr != 9 {
+		t.Errorf("expected landscape A4 page setup")
+	}
+	if !*x.SheetPr.PageSetUpPr.FitToPageAttr || *x.PageSetup.FitToWidthAttr != 1 || *x.PageSetup.FitToHeightAttr != 0 {
+		t.Errorf("expected fit to one page wide")
+	}
+	if x.PageMargins.TopAttr != 1 || x.PageMargins.LeftAttr != 0.5 {
+		t.Errorf("expected margins in inches, got %v", x.PageMargins)
+	}
+	if exp := "&C&A&R&D"; *x.HeaderFooter.OddHeader != exp {
+		t.Errorf("expected header %s, got %s", exp, *x.HeaderFooter.OddHeader)
+	}
+	if exp := "&CPage &P of &N"; *x.HeaderFooter.OddFooter != exp {
+		t.Errorf("expected footer %s, got %s", exp, *x.HeaderFooter.OddFooter)
+	}
+	if len(x.RowBreaks.Brk) != 2 || *x.RowBreaks.Brk[0].IdAttr != 10 || *x.RowBreaks.Brk[1].IdAttr != 20 {
+		t.Errorf("expected row breaks after rows 10 and 20")
+	}
+	if len(x.ColBreaks.Brk) != 1 || *x.ColBreaks.Brk[0].IdAttr != 4 {
+		t.Errorf("expected a column break after column D")
+	}
+
+	dns := wb.DefinedNames()
+	if len(dns) != 2 {
+		t.Fatalf("expected print area and titles defined names, got %d", len(dns))
+	}
+	td := []struct {
+		name, content string
+	}{
+		{"_xlnm.Print_Area", "'Sheet 2'!$A$1:$H$40"},
+		{"_xlnm.Print_Titles", "'Sheet 2'!$A:$A,'Sheet 2'!$1:$2"},
+	}
+	for i, tc := range td {
+		if dns[i].Name() != tc.name || dns[i].Content() != tc.content || *dns[i].X().LocalSheetIdAttr != 1 {
+			t.Errorf("expected %s = %s local to sheet 1, got %s = %s", tc.name, tc.content, dns[i].Name(), dns[i].Content())
+		}
+	}
+	if got := ps.PrintArea(); got != "$A$1:$H$40" {
+		t.Errorf("expected print area $A$1:$H$40, got %s", got)
+	}
+	if err := wb.Validate(); err != nil {
+		t.Errorf("expected a valid workbook, got %s", err)
+	}
+
+	// removing the first sheet renumbers the names local to the second
+	wb.RemoveSheet(0)
+	if id := *wb.DefinedNames()[0].X().LocalSheetIdAttr; id != 0 {
+		t.Errorf("expected print area local to sheet 0, got %d", id)
+	}
+	ps.ClearPrintArea()
+	ps.ClearPrintTitles()
+	if len(wb.DefinedNames()) != 0 {
+		t.Errorf("expected no defined names after clearing the print area and titles")
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	for r := uint32(1); r <= 10; r++ {
+		sheet.Cell(fmt.Sprintf("A%d", r)).SetNumber(float64(r))
+	}
+	// rows 2-8 summarized by row 9, with a nested group 3-5 summarized by 6
+	if err := sheet.GroupRows(2, 8); err != nil {
+		t.Fatalf("error grouping rows: %s", err)
+	}
+	if err := sheet.GroupRows(3, 5); err != nil {
+		t.Fatalf("error grouping rows: %s", err)
+	}
+	if got := *sheet.X().SheetFormatPr.OutlineLevelRowAttr; got != 2 {
+		t.Errorf("expected sheet outline level 2, got %d", got)
+	}
+	if err := sheet.CollapseRows(3, 5); err != nil {
+		t.Fatalf("error collapsing rows: %s", err)
+	}
+	if err := sheet.CollapseRows(2, 8); err != nil {
+		t.Fatalf("error collapsing rows: %s", err)
+	}
+	hidden := func() string {
+		s := ""
+		for r := uint32(1); r <= 10; r++ {
+			if sheet.Row(r).IsHidden() {
+				s += "h"
+			} else {
+				s += "-"
+			}
+		}
+		return s
+	}
+	if got := hidden(); got != "-hhhhhhh--" {
+		t.Errorf("expected rows 2-8 hidden, got %s", got)
+	}
+	if !sheet.Row(9).IsCollapsed() || !sheet.Row(6).IsCollapsed() {
+		t.Errorf("expected summary rows 6 and 9 to be collapsed")
+	}
+
+	// the nested group stays collapsed
+	if err := sheet.ExpandRows(2, 8); err != nil {
+		t.Fatalf("error expanding rows: %s", err)
+	}
+	if got := hidden(); got != "--hhh-----" {
+		t.Errorf("expected rows 3-5 hidden, got %s", got)
+	}
+
+	// ungrouping the nested group shows its rows
+	if err := sheet.UngroupRows(3, 5); err != nil {
+		t.Fatalf("error ungrouping rows: %s", err)
+	}
+	if got := hidden(); got != "----------" {
+		t.Errorf("expected no hidden rows, got %s", got)
+	}
+	if sheet.Row(6).IsCollapsed() {
+		t.Errorf("expected row 6 to no longer be collapsed")
+	}
+	if got := *sheet.X().SheetFormatPr.OutlineLevelRowAttr; got != 1 {
+		t.Errorf("expected sheet outline level 1, got %d", got)
+	}
+	if err := sheet.CollapseRows(1, 1); err == nil {
+		t.Errorf("expected an error collapsing rows that aren't grouped")
+	}
+	if err := wb.Validate(); err != nil {
+		t.Errorf("expected a valid workbook, got %s", err)
+	}
+}
+
+func TestGroupColumns(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	sheet.SetOutlineSummary(true, false)
+	sheet.Column(1).SetWidth(10 * measurement.Character)
+	sheet.Column(1).X().MaxAttr = 5
+
+	if err := sheet.GroupColumns("C", "D"); err != nil {
+		t.Fatalf("error grouping columns: %s", err)
+	}
+	if err := sheet.CollapseColumns("C", "D"); err != nil {
+		t.Fatalf("error collapsing columns: %s", err)
+	}
+	// the column definition for A-E is split so that only C and D are hidden
+	for i := uint32(1); i <= 5; i++ {
+		col := sheet.Column(i)
+		grouped := i == 3 || i == 4
+		if col.IsHidden() != grouped || (col.OutlineLevel() == 1) != grouped {
+			t.Errorf("expected column %d hidden and grouped = %v", i, grouped)
+		}
+		if *col.X().WidthAttr != 10 {
+			t.Errorf("expected column %d to keep its width", i)
+		}
+	}
+	// the summary column is to the left
+	if !sheet.Column(2).IsCollapsed() {
+		t.Errorf("expected column B to be collapsed")
+	}
+	if got := *sheet.X().SheetFormatPr.OutlineLevelColAttr; got != 1 {
+		t.Errorf("expected sheet column outline level 1, got %d", got)
+	}
+	if err := sheet.UngroupColumns("C", "D"); err != nil {
+		t.Fatalf("error ungrouping columns: %s", err)
+	}
+	if sheet.Column(3).IsHidden() || sheet.Column(2).IsCollapsed() {
+		t.Errorf("expected ungrouped columns to be shown")
+	}
+	if sheet.X().SheetFormatPr.OutlineLevelColAttr != nil {
+		t.Errorf("expected no sheet column outline level")
+	}
+	if err := wb.Validate(); err != nil {
+		t.Errorf("expected a valid workbook, got %s", err)
+	}
+}
@@ -0,0 +1,656 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/color"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// Sparklines are stored in a worksheet extension that the sml package doesn't
+// model, so they are built and read as generic XML nodes.
+const (
+	sparklineGroupsURI = "{05C60535-1F16-4fd2-B633-F4F36F0B64E0}"
+	x14Namespace       = "http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"
+	xmNamespace        = "http://schemas.microsoft.com/office/excel/2006/main"
+)
+
+// SparklineType is the kind of chart drawn by a sparkline group.
+type SparklineType byte
+
+// SparklineType constants.
+const (
+	SparklineTypeLine    SparklineType = iota
+	SparklineTypeColumn                // vertical bars
+	SparklineTypeStacked               // win/loss
+)
+
+// SparklineAxisType controls how the minimum or maximum of the vertical axis
+// of a sparkline group is chosen.
+type SparklineAxisType byte
+
+// SparklineAxisType constants.
+const (
+	SparklineAxisIndividual SparklineAxisType = iota // per sparkline
+	SparklineAxisGroup                               // shared by the group
+	SparklineAxisCustom                              // a fixed value
+)
+
+// SparklineEmptyCells controls how empty cells in the data of a sparkline are
+// displayed.
+type SparklineEmptyCells byte
+
+// SparklineEmptyCells constants.
+const (
+	SparklineEmptyCellsGap SparklineEmptyCells = iota
+	SparklineEmptyCellsZero
+	SparklineEmptyCellsSpan // connect the points on either side with a line
+)
+
+// SparklineHighlight is a set of points of a sparkline that can be shown with
+// a distinct color.
+type SparklineHighlight byte
+
+// SparklineHighlight constants.
+const (
+	SparklineHighlightMarkers SparklineHighlight = iota // every point of a line
+	SparklineHighlightHigh
+	SparklineHighlightLow
+	SparklineHighlightFirst
+	SparklineHighlightLast
+	SparklineHighlightNegative
+)
+
+var sparklineTypes = []string{"line", "column", "stacked"}
+var sparklineAxisTypes = []string{"individual", "group", "custom"}
+var sparklineEmptyCells = []string{"gap", "zero", "span"}
+
+// the attribute that shows a highlight and the element holding its color
+var sparklineHighlights = []struct{ attr, color string }{
+	{"markers", "colorMarkers"},
+	{"high", "colorHigh"},
+	{"low", "colorLow"},
+	{"first", "colorFirst"},
+	{"last", "colorLast"},
+	{"negative", "colorNegative"},
+}
+
+// sparklineGroupChildren is the order of the child elements of a sparkline
+// group required by the schema.
+var sparklineGroupChildren = []string{"colorSeries", "colorNegative", "colorAxis",
+	"colorMarkers", "colorFirst", "colorLast", "colorHigh", "colorLow", "f", "sparklines"}
+
+// SparklineGroup is a group of sparklines that share a type and formatting.
+type SparklineGroup struct {
+	x *unioffice.XSDAny
+}
+
+// X returns the inner wrapped XML type, the x14:sparklineGroup element.
+func (g SparklineGroup) X() *unioffice.XSDAny {
+	return g.x
+}
+
+// Type returns the type of the sparklines.
+func (g SparklineGroup) Type() SparklineType {
+	return SparklineType(anyEnum(g.x, "type", sparklineTypes))
+}
+
+// SetType sets the type of the sparklines.
+func (g SparklineGroup) SetType(t SparklineType) {
+	setAnyEnum(g.x, "type", sparklineTypes, int(t))
+}
+
+// SeriesColor returns the ARGB hex color of the sparklines, or an empty string
+// if it isn't an RGB color.
+func (g SparklineGroup) SeriesColor() string {
+	return g.color("colorSeries")
+}
+
+// SetSeriesColor sets the color of the sparklines.
+func (g SparklineGroup) SetSeriesColor(c color.Color) {
+	g.setColor("colorSeries", c)
+}
+
+// AxisColor returns the ARGB hex color of the horizontal axis, or an empty
+// string if it isn't an RGB color.
+func (g SparklineGroup) AxisColor() string {
+	return g.color("colorAxis")
+}
+
+// SetAxisColor sets the color of the horizontal axis.
+func (g SparklineGroup) SetAxisColor(c color.Color) {
+	g.setColor("colorAxis", c)
+}
+
+// Highlighted returns true if a set of points is shown.
+func (g SparklineGroup) Highlighted(h SparklineHighlight) bool {
+	return anyBool(g.x, sparklineHighlights[h].attr)
+}
+
+// SetHighlight controls whether a set of points is shown.
+func (g SparklineGroup) SetHighlight(h SparklineHighlight, show bool) {
+	setAnyBool(g.x, sparklineHighlights[h].attr, show)
+}
+
+// HighlightColor returns the ARGB hex color of a set of points, or an empty
+// string if it isn't an RGB color.
+func (g SparklineGroup) HighlightColor(h SparklineHighlight) string {
+	return g.color(sparklineHighlights[h].color)
+}
+
+// SetHighlightColor sets the color of a set of points.
+func (g SparklineGroup) SetHighlightColor(h SparklineHighlight, c color.Color) {
+	g.setColor(sparklineHighlights[h].color, c)
+}
+
+// DisplayXAxis returns true if the horizontal axis is shown.
+func (g SparklineGroup) DisplayXAxis() bool {
+	return anyBool(g.x, "displayXAxis")
+}
+
+// SetDisplayXAxis controls whether the horizontal axis is shown.
+func (g SparklineGroup) SetDisplayXAxis(b bool) {
+	setAnyBool(g.x, "displayXAxis", b)
+}
+
+// DisplayHidden returns true if data in hidden rows and columns is shown.
+func (g SparklineGroup) DisplayHidden() bool {
+	return anyBool(g.x, "displayHidden")
+}
+
+// SetDisplayHidden controls whether data in hidden rows and columns is shown.
+func (g SparklineGroup) SetDisplayHidden(b bool) {
+	setAnyBool(g.x, "displayHidden", b)
+}
+
+// EmptyCells returns how empty cells are displayed.
+func (g SparklineGroup) EmptyCells() SparklineEmptyCells {
+	// zero is the schema default
+	if _, ok := anyAttr(g.x, "displayEmptyCellsAs"); !ok {
+		return SparklineEmptyCellsZero
+	}
+	return SparklineEmptyCells(anyEnum(g.x, "displayEmptyCellsAs", sparklineEmptyCells))
+}
+
+// SetEmptyCells sets how empty cells are displayed.
+func (g SparklineGroup) SetEmptyCells(e SparklineEmptyCells) {
+	setAnyAttr(g.x, "displayEmptyCellsAs", sparklineEmptyCells[e])
+}
+
+// LineWeight returns the width of the lines of line sparklines in points.
+func (g SparklineGroup) LineWeight() float64 {
+	if v, ok := anyFloat(g.x, "lineWeight"); ok {
+		return v
+	}
+	return 0.75
+}
+
+// SetLineWeight sets the width of the lines of line sparklines in points.
+func (g SparklineGroup) SetLineWeight(pts float64) {
+	setAnyAttr(g.x, "lineWeight", strconv.FormatFloat(pts, 'f', -1, 64))
+}
+
+// MinAxis returns how the minimum of the vertical axis is chosen, and the
+// minimum if it is a custom value.
+func (g SparklineGroup) MinAxis() (SparklineAxisType, float64) {
+	t := SparklineAxisType(anyEnum(g.x, "minAxisType", sparklineAxisTypes))
+	v, _ := anyFloat(g.x, "manualMin")
+	return t, v
+}
+
+// SetMinAxis sets how the minimum of the vertical axis is chosen.  The value is
+// only used by SparklineAxisCustom.
+func (g SparklineGroup) SetMinAxis(t SparklineAxisType, v float64) {
+	g.setAxis("minAxisType", "manualMin", t, v)
+}
+
+// MaxAxis returns how the maximum of the vertical axis is chosen, and the
+// maximum if it is a custom value.
+func (g SparklineGroup) MaxAxis() (SparklineAxisType, float64) {
+	t := SparklineAxisType(anyEnum(g.x, "maxAxisType", sparklineAxisTypes))
+	v, _ := anyFloat(g.x, "manualMax")
+	return t, v
+}
+
+// SetMaxAxis sets how the maximum of the vertical axis is chosen.  The value is
+// only used by SparklineAxisCustom.
+func (g SparklineGroup) SetMaxAxis(t SparklineAxisType, v float64) {
+	g.setAxis("maxAxisType", "manualMax", t, v)
+}
+
+func (g SparklineGroup) setAxis(typeAttr, valueAttr string, t SparklineAxisType, v float64) {
+	setAnyEnum(g.x, typeAttr, sparklineAxisTypes, int(t))
+	if t == SparklineAxisCustom {
+		setAnyAttr(g.x, valueAttr, strconv.FormatFloat(v, 'f', -1, 64))
+	} else {
+		removeAnyAttr(g.x, valueAttr)
+	}
+}
+
+func (g SparklineGroup) color(name string) string {
+	for _, n := range g.x.Nodes {
+		if n.XMLName.Local == name {
+			v, _ := anyAttr(n, "rgb")
+			return v
+		}
+	}
+	return ""
+}
+
+func (g SparklineGroup) setColor(name string, c color.Color) {
+	n := g.child(name, x14Namespace)
+	n.Attrs = nil
+	setAnyAttr(n, "rgb", *c.AsRGBAString())
+}
+
+// child returns the child element with a name, adding it in schema order if
+// the group doesn't have it.
+func (g SparklineGroup) child(name, ns string) *unioffice.XSDAny {
+	idx := 0
+	for i, s := range sparklineGroupChildren {
+		if s == name {
+			idx = i
+		}
+	}
+	pos := len(g.x.Nodes)
+	for i, n := range g.x.Nodes {
+		if n.XMLName.Local == name {
+			return n
+		}
+		for j := idx + 1; j < len(sparklineGroupChildren); j++ {
+			if n.XMLName.Local == sparklineGroupChildren[j] && pos > i {
+				pos = i
+			}
+		}
+	}
+	n := &unioffice.XSDAny{XMLName: xml.Name{Space: ns, Local: name}}
+	g.x.Nodes = append(g.x.Nodes, nil)
+	copy(g.x.Nodes[pos+1:], g.x.Nodes[pos:])
+	g.x.Nodes[pos] = n
+	return n
+}
+
+// Sparklines returns the sparklines in the group.
+func (g SparklineGroup) Sparklines() []Sparkline {
+	ret := []Sparkline{}
+	for _, n := range g.x.Nodes {
+		if n.XMLName.Local != "sparklines" {
+			continue
+		}
+		for _, sl := range n.Nodes {
+			if sl.XMLName.Local == "sparkline" {
+				ret = append(ret, Sparkline{sl})
+			}
+		}
+	}
+	return ret
+}
+
+// AddSparkline adds a sparkline to the group that charts the data in a range
+// (e.g. 'Sheet 1'!A1:E1) and is drawn in a cell (e.g. F1).
+func (g SparklineGroup) AddSparkline(dataRange, cell string) Sparkline {
+	sls := g.child("sparklines", x14Namespace)
+	sl := Sparkline{&unioffice.XSDAny{XMLName: xml.Name{Space: x14Namespace, Local: "sparkline"}}}
+	sl.SetDataRange(dataRange)
+	sl.SetLocation(cell)
+	sls.Nodes = append(sls.Nodes, sl.x)
+	return sl
+}
+
+// Sparkline is a single sparkline, a small chart drawn in a cell.
+type Sparkline struct {
+	x *unioffice.XSDAny
+}
+
+// X returns the inner wrapped XML type, the x14:sparkline element.
+func (s Sparkline) X() *unioffice.XSDAny {
+	return s.x
+}
+
+// DataRange returns the range of the data that is charted, which includes the
+// sheet name.
+func (s Sparkline) DataRange() string {
+	return s.text("f")
+}
+
+// SetDataRange sets the range of the data that is charted, which must include
+// the sheet name.
+func (s Sparkline) SetDataRange(ref string) {
+	s.setText("f", ref)
+}
+
+// Location returns the reference of the cell the sparkline is drawn in.
+func (s Sparkline) Location() string {
+	return s.text("sqref")
+}
+
+// SetLocation sets the reference of the cell the sparkline is drawn in.
+func (s Sparkline) SetLocation(cell string) {
+	s.setText("sqref", cell)
+}
+
+func (s Sparkline) text(name string) string {
+	for _, n := range s.x.Nodes {
+		if n.XMLName.Local == name {
+			return strings.TrimSpace(string(n.Data))
+		}
+	}
+	return ""
+}
+
+func (s Sparkline) setText(name, v string) {
+	for _, n := range s.x.Nodes {
+		if n.XMLName.Local == name {
+			n.Data = []byte(v)
+			return
+		}
+	}
+	n := &unioffice.XSDAny{XMLName: xml.Name{Space: xmNamespace, Local: name}, Data: []byte(v)}
+	// the data range precedes the location
+	if name == "f" {
+		s.x.Nodes = append([]*unioffice.XSDAny{n}, s.x.Nodes...)
+	} else {
+		s.x.Nodes = append(s.x.Nodes, n)
+	}
+}
+
+// sparklineGroups returns the x14:sparklineGroups element of the sheet,
+// optionally creating it.
+func (s Sheet) sparklineGroups(create bool) *unioffice.XSDAny {
+	if s.x.ExtLst != nil {
+		for _, ext := range s.x.ExtLst.Ext {
+			if ext.UriAttr == nil || *ext.UriAttr != sparklineGroupsURI {
+				continue
+			}
+			if x, ok := ext.Any.(*unioffice.XSDAny); ok {
+				return x
+			}
+		}
+	}
+	if !create {
+		return nil
+	}
+	if s.x.ExtLst == nil {
+		s.x.ExtLst = sml.NewCT_ExtensionList()
+	}
+	x := &unioffice.XSDAny{XMLName: xml.Name{Space: x14Namespace, Local: "sparklineGroups"}}
+	ext := sml.NewCT_Extension()
+	ext.UriAttr = unioffice.String(sparklineGroupsURI)
+	ext.Any = x
+	s.x.ExtLst.Ext = append(s.x.ExtLst.Ext, ext)
+	return x
+}
+
+// SparklineGroups returns the sparkline groups of the sheet.
+func (s Sheet) SparklineGroups() []SparklineGroup {
+	ret := []SparklineGroup{}
+	if sgs := s.sparklineGroups(false); sgs != nil {
+		for _, n := range sgs.Nodes {
+			if n.XMLName.Local == "sparklineGroup" {
+				ret = append(ret, SparklineGroup{n})
+			}
+		}
+	}
+	return ret
+}
+
+// AddSparklineGroup adds a group of sparklines to the sheet, drawn in the cells
+// of a location range (e.g. F1:F3) that is a single row or column.  The data
+// range (e.g. A1:E3) is split into one row or column per location cell, and
+// refers to the sheet itself if it doesn't include a sheet name.
+func (s Sheet) AddSparklineGroup(t SparklineType, dataRange, location string) (SparklineGroup, error) {
+	sheet, dataRef, ok := reference.SplitSheetPrefix(dataRange)
+	if !ok {
+		sheet, dataRef = s.Name(), dataRange
+	}
+	dFrom, dTo, err := parseSparklineRange(dataRef)
+	if err != nil {
+		return SparklineGroup{}, fmt.Errorf("invalid data range %s: %s", dataRange, err)
+	}
+	lFrom, lTo, err := parseSparklineRange(location)
+	if err != nil {
+		return SparklineGroup{}, fmt.Errorf("invalid location %s: %s", location, err)
+	}
+	rows := dTo.RowIdx - dFrom.RowIdx + 1
+	cols := dTo.ColumnIdx - dFrom.ColumnIdx + 1
+	vertical := lFrom.ColumnIdx == lTo.ColumnIdx
+	n := lTo.RowIdx - lFrom.RowIdx + 1
+	if !vertical {
+		if lFrom.RowIdx != lTo.RowIdx {
+			return SparklineGroup{}, errors.New("sparkline location must be a single row or column")
+		}
+		n = lTo.ColumnIdx - lFrom.ColumnIdx + 1
+	}
+
+	// one row of data per location cell, unless the location is a row and the
+	// data has a column per location cell
+	byRow := n == 1 || rows == n && (vertical || cols != n)
+	if !byRow && cols != n {
+		return SparklineGroup{}, fmt.Errorf("data range %s doesn't match the %d sparkline locations", dataRange, n)
+	}
+
+	g := SparklineGroup{&unioffice.XSDAny{XMLName: xml.Name{Space: x14Namespace, Local: "sparklineGroup"}}}
+	g.SetType(t)
+	g.SetEmptyCells(SparklineEmptyCellsGap)
+	g.SetSeriesColor(color.RGB(0x37, 0x60, 0x92))
+	g.SetAxisColor(color.RGB(0, 0, 0))
+	for h := SparklineHighlightMarkers; h <= SparklineHighlightNegative; h++ {
+		g.SetHighlightColor(h, color.RGB(0xD0, 0x00, 0x00))
+	}
+
+	for i := uint32(0); i < n; i++ {
+		from, to := dFrom, dTo
+		switch {
+		case n == 1:
+		case byRow:
+			from.RowIdx += i
+			to.RowIdx = from.RowIdx
+		default:
+			from.ColumnIdx += i
+			to.ColumnIdx = from.ColumnIdx
+		}
+		cell := lFrom
+		if vertical {
+			cell.RowIdx += i
+		} else {
+			cell.ColumnIdx += i
+		}
+		data := fmt.Sprintf("%s!%s%d:%s%d", reference.QuoteSheetName(sheet),
+			reference.IndexToColumn(from.ColumnIdx), from.RowIdx,
+			reference.IndexToColumn(to.ColumnIdx), to.RowIdx)
+		g.AddSparkline(data, fmt.Sprintf("%s%d", reference.IndexToColumn(cell.ColumnIdx), cell.RowIdx))
+	}
+
+	sgs := s.sparklineGroups(true)
+	sgs.Nodes = append(sgs.Nodes, g.x)
+	return g, nil
+}
+
+// RemoveSparklineGroup removes a sparkline group from the sheet.
+func (s Sheet) RemoveSparklineGroup(g SparklineGroup) error {
+	sgs := s.sparklineGroups(false)
+	if sgs != nil {
+		for i, n := range sgs.Nodes {
+			if n != g.x {
+				continue
+			}
+			copy(sgs.Nodes[i:], sgs.Nodes[i+1:])
+			sgs.Nodes = sgs.Nodes[:len(sgs.Nodes)-1]
+			if len(s.SparklineGroups()) == 0 {
+				s.removeExtension(sparklineGroupsURI)
+			}
+			return nil
+		}
+	}
+	return errors.New("sparkline group not found in sheet")
+}
+
+// sparklineFormulas calls fn with the data range of each sparkline in the
+// sheet and the date axis range of each group, so that it can rewrite them.
+func (s Sheet) sparklineFormulas(fn func(f *string)) {
+	for _, g := range s.SparklineGroups() {
+		nodes := append([]*unioffice.XSDAny{}, g.x.Nodes...)
+		for _, sl := range g.Sparklines() {
+			nodes = append(nodes, sl.x.Nodes...)
+		}
+		for _, n := range nodes {
+			if n.XMLName.Local != "f" {
+				continue
+			}
+			f := strings.TrimSpace(string(n.Data))
+			fn(&f)
+			n.Data = []byte(f)
+		}
+	}
+}
+
+// updateSparklineLocations updates the cells that the sheet's sparklines are
+// drawn in after an edit to the sheet, removing the sparklines whose cells
+// were removed and the groups that are left empty.
+func (s Sheet) updateSparklineLocations(u refUpdater) {
+	for _, g := range s.SparklineGroups() {
+		for _, n := range g.x.Nodes {
+			if n.XMLName.Local != "sparklines" {
+				continue
+			}
+			kept := n.Nodes[:0]
+			for _, x := range n.Nodes {
+				if x.XMLName.Local == "sparkline" {
+					sl := Sparkline{x}
+					ref, ok := u.ref(sl.Location())
+					if !ok {
+						continue
+					}
+					sl.SetLocation(ref)
+				}
+				kept = append(kept, x)
+			}
+			n.Nodes = kept
+		}
+		if len(g.Sparklines()) == 0 {
+			s.RemoveSparklineGroup(g)
+		}
+	}
+}
+
+// removeExtension removes the extension with a URI from the sheet.
+func (s Sheet) removeExtension(uri string) {
+	if s.x.ExtLst == nil {
+		return
+	}
+	exts := s.x.ExtLst.Ext[:0]
+	for _, ext := range s.x.ExtLst.Ext {
+		if ext.UriAttr == nil || *ext.UriAttr != uri {
+			exts = append(exts, ext)
+		}
+	}
+	s.x.ExtLst.Ext = exts
+	if len(exts) == 0 {
+		s.x.ExtLst = nil
+	}
+}
+
+// parseSparklineRange parses a range or a single cell.
+func parseSparklineRange(s string) (from, to reference.CellReference, err error) {
+	if !strings.Contains(s, ":") {
+		from, err = reference.ParseCellReference(s)
+		return from, from, err
+	}
+	from, to, err = reference.ParseRangeReference(s)
+	if err != nil {
+		return from, to, err
+	}
+	if to.RowIdx < from.RowIdx || to.ColumnIdx < from.ColumnIdx {
+		return from, to, errors.New("range must start at its top left cell")
+	}
+	return from, to, nil
+}
+
+// anyAttr returns the value of an unqualified attribute of a node.
+func anyAttr(n *unioffice.XSDAny, name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func setAnyAttr(n *unioffice.XSDAny, name, v string) {
+	for i, a := range n.Attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			n.Attrs[i].Value = v
+			return
+		}
+	}
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: v})
+}
+
+func removeAnyAttr(n *unioffice.XSDAny, name string) {
+	attrs := n.Attrs[:0]
+	for _, a := range n.Attrs {
+		if a.Name.Space != "" || a.Name.Local != name {
+			attrs = append(attrs, a)
+		}
+	}
+	n.Attrs = attrs
+}
+
+func anyBool(n *unioffice.XSDAny, name string) bool {
+	v, _ := anyAttr(n, name)
+	return v == "1" || v == "true"
+}
+
+// setAnyBool sets a boolean attribute, removing it if false as that is the
+// default of every boolean attribute of sparkline groups.
+func setAnyBool(n *unioffice.XSDAny, name string, b bool) {
+	if b {
+		setAnyAttr(n, name, "1")
+	} else {
+		removeAnyAttr(n, name)
+	}
+}
+
+func anyFloat(n *unioffice.XSDAny, name string) (float64, bool) {
+	v, ok := anyAttr(n, name)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	return f, err == nil
+}
+
+// anyEnum returns the index of the value of an attribute in a list of values,
+// the first of which is the default.
+func anyEnum(n *unioffice.XSDAny, name string, values []string) int {
+	v, _ := anyAttr(n, name)
+	for i, s := range values {
+		if s == v {
+			return i
+		}
+	}
+	return 0
+}
+
+// setAnyEnum sets an attribute to a value from a list, removing it if it is the
+// default first value.
+func setAnyEnum(n *unioffice.XSDAny, name string, values []string, idx int) {
+	if idx == 0 {
+		removeAnyAttr(n, name)
+	} else {
+		setAnyAttr(n, name, values[idx])
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/unidoc/unioffice/color"
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+func TestAddSparklineGroup(t *testing.T) {
+	wb := spreadsheet.New()
+	sheet := wb.AddSheet()
+	for r := 0; r < 3; r++ {
+		row := sheet.AddRow()
+		for c := 0; c < 5; c++ {
+			row.AddCell().SetNumber(float64(r*c - 2))
+		}
+	}
+
+	g, err := sheet.AddSparklineGroup(spreadsheet.SparklineTypeColumn, "A1:E3", "F1:F3")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	sls := g.Sparklines()
+	if len(sls) != 3 {
+		t.Fatalf("expected 3 sparklines, got %d", len(sls))
+	}
+	if exp := "'Sheet 1'!A2:E2"; sls[1].DataRange() != exp {
+		t.Errorf("expected data range %s, got %s", exp, sls[1].DataRange())
+	}
+	if exp := "F2"; sls[1].Location() != exp {
+		t.Errorf("expected location %s, got %s", exp, sls[1].Location())
+	}
+
+	// a row of locations takes a column of data each
+	h, err := sheet.AddSparklineGroup(spreadsheet.SparklineTypeLine, "'Sheet 1'!A1:E3", "A4:E4")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if sls := h.Sparklines(); len(sls) != 5 || sls[4].DataRange() != "'Sheet 1'!E1:E3" || sls[4].Location() != "E4" {
+		t.Errorf("unexpected sparklines for a row of locations")
+	}
+	if _, err := sheet.AddSparklineGroup(spreadsheet.SparklineTypeLine, "A1:E3", "G1:G2"); err == nil {
+		t.Errorf("expected an error for mismatched data and locations")
+	}
+	if _, err := sheet.AddSparklineGroup(spreadsheet.SparklineTypeLine, "A1:E3", "G1:H3"); err == nil {
+		t.Errorf("expected an error for a two dimensional location")
+	}
+
+	g.SetSeriesColor(color.RGB(0x12, 0x34, 0x56))
+	g.SetHighlight(spreadsheet.SparklineHighlightNegative, true)
+	g.SetHighlight(spreadsheet.SparklineHighlightHigh, true)
+	g.SetHighlightColor(spreadsheet.SparklineHighlightHigh, color.RGB(0, 0xff, 0))
+	g.SetDisplayXAxis(true)
+	g.SetMinAxis(spreadsheet.SparklineAxisCustom, -5)
+	g.SetMaxAxis(spreadsheet.SparklineAxisGroup, 0)
+
+	buf := bytes.Buffer{}
+	if err := wb.Save(&buf); err != nil {
+		t.Fatalf("error saving: %s", err)
+	}
+	wb2, err := spreadsheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading: %s", err)
+	}
+	groups := wb2.Sheets()[0].SparklineGroups()
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 sparkline groups, got %d", len(groups))
+	}
+	g = groups[0]
+	if g.Type() != spreadsheet.SparklineTypeColumn {
+		t.Errorf("expected column sparklines, got %v", g.Type())
+	}
+	if exp := "ff123456"; g.SeriesColor() != exp {
+		t.Errorf("expected series color %s, got %s", exp, g.SeriesColor())
+	}
+	if exp := "ff00ff00"; g.HighlightColor(spreadsheet.SparklineHighlightHigh) != exp {
+		t.Errorf("expected high color %s, got %s", exp, g.HighlightColor(spreadsheet.SparklineHighlightHigh))
+	}
+	if !g.Highlighted(spreadsheet.SparklineHighlightNegative) || !g.Highlighted(spreadsheet.SparklineHighlightHigh) ||
+		g.Highlighted(spreadsheet.SparklineHighlightLow) {
+		t.Errorf("unexpected highlighted points")
+	}
+	if !g.DisplayXAxis() {
+		t.Errorf("expected the horizontal axis to be displayed")
+	}
+	if at, v := g.MinAxis(); at != spreadsheet.SparklineAxisCustom || v != -5 {
+		t.Errorf("expected custom minimum of -5, got %v %v", at, v)
+	}
+	if at, _ := g.MaxAxis(); at != spreadsheet.SparklineAxisGroup {
+		t.Errorf("expected group maximum, got %v", at)
+	}
+	if g.EmptyCells() != spreadsheet.SparklineEmptyCellsGap {
+		t.Errorf("expected empty cells to be gaps, got %v", g.EmptyCells())
+	}
+	if sls := g.Sparklines(); len(sls) != 3 || sls[2].DataRange() != "'Sheet 1'!A3:E3" || sls[2].Location() != "F3" {
+		t.Errorf("unexpected sparklines after reading")
+	}
+
+	sheet = wb2.Sheets()[0]
+	for _, g := range sheet.SparklineGroups() {
+		if err := sheet.RemoveSparklineGroup(g); err != nil {
+			t.Errorf("expected no error removing group, got %s", err)
+		}
+	}
+	if sheet.X().ExtLst != nil {
+		t.Errorf("expected the extension list to be removed with the last group")
+	}
+}
+
+func TestSparklineReferences(t *testing.T) {
+	wb := spreadsheet.New()
+	data := wb.AddSheet()
+	sheet := wb.AddSheet()
+	if _, err := sheet.AddSparklineGroup(spreadsheet.SparklineTypeLine, "'Sheet 1'!A1:E2", "F1:F2"); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if _, err := sheet.AddSparklineGroup(spreadsheet.SparklineTypeLine, "A3:E3", "F3"); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	data.SetName("Data")
+	data.InsertRow(2)
+	sheet.InsertColumn("B")
+	if err := sheet.RemoveRow(3); err != nil {
+		t.Fatalf("error removing row: %s", err)
+	}
+	groups := sheet.SparklineGroups()
+	if len(groups) != 1 {
+		t.Fatalf("expected the group drawn in the removed row to be removed, got %d groups", len(groups))
+	}
+	sls := groups[0].Sparklines()
+	if len(sls) != 2 {
+		t.Fatalf("expected 2 sparklines, got %d", len(sls))
+	}
+	if exp := "'Data'!A1:E1"; sls[0].DataRange() != exp {
+		t.Errorf("expected data range %s, got %s", exp, sls[0].DataRange())
+	}
+	if exp := "'Data'!A3:E3"; sls[1].DataRange() != exp {
+		t.Errorf("expected data range %s, got %s", exp, sls[1].DataRange())
+	}
+	if exp := "G2"; sls[1].Location() != exp {
+		t.Errorf("expected location %s, got %s", exp, sls[1].Location())
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"fmt"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/formula"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// spill records the cells that the array result of a dynamic array formula
+// spills into.  If any of them aren't empty, the result is a #SPILL! error and
+// the formula doesn't spill at all.
+func (e *calcEngine) spill(n *calcNode, res formula.Result) formula.Result {
+	var arr [][]formula.Result
+	switch res.Type {
+	case formula.ResultTypeArray:
+		arr = res.ValueArray
+	case formula.ResultTypeList:
+		arr = [][]formula.Result{res.ValueList}
+	}
+	origin, err := reference.ParseCellReference(n.key.ref)
+	if err != nil {
+		return res
+	}
+
+	keys := []calcKey{}
+	members := []arrayMember{}
+	blocked := false
+	for r, row := range arr {
+		for c := range row {
+			if r == 0 && c == 0 {
+				continue
+			}
+			ref := fmt.Sprintf("%s%d", reference.IndexToColumn(origin.ColumnIdx+uint32(c)), origin.RowIdx+uint32(r))
+			key := calcKey{n.key.ws, ref}
+			if e.blocks(n, key) {
+				e.blocked[key] = n
+				blocked = true
+			}
+			keys = append(keys, key)
+			members = append(members, arrayMember{n, r, c})
+		}
+	}
+	if blocked {
+		keys, members = nil, nil
+		res = formula.MakeErrorResultType(formula.ErrorTypeSpill, "spill range for "+e.name(n.key)+" isn't blank")
+	}
+
+	// move the spill range, clearing the cells that the formula no longer
+	// spills into
+	prev := n.spilled
+	for _, k := range prev {
+		if m, ok := e.spills[k]; ok && m.node == n {
+			delete(e.spills, k)
+		}
+	}
+	for i, k := range keys {
+		e.spills[k] = members[i]
+	}
+	n.spilled = keys
+	for _, k := range prev {
+		if _, ok := e.spills[k]; !ok {
+			e.clearSpilledCell(k)
+		}
+	}
+	return res
+}
+
+// blocks returns true if a cell prevents the result of a dynamic array formula
+// from spilling into it.
+func (e *calcEngine) blocks(n *calcNode, key calcKey) bool {
+	if _, ok := e.nodes[key]; ok {
+		return true
+	}
+	if _, ok := e.arrays[key]; ok {
+		return true
+	}
+	if m, ok := e.spills[key]; ok {
+		return m.node != n
+	}
+	if c, ok := e.cells[key]; ok {
+		return !Cell{w: e.wb, s: key.ws, x: c}.IsEmpty()
+	}
+	return false
+}
+
+// releaseSpill clears the cells that the result of a dynamic array formula
+// spilled into.
+func (e *calcEngine) releaseSpill(n *calcNode) {
+	for _, k := range n.spilled {
+		if m, ok := e.spills[k]; ok && m.node == n {
+			delete(e.spills, k)
+			e.clearSpilledCell(k)
+		}
+	}
+	n.spilled = nil
+}
+
+// clearSpilledCell removes the value written to a cell that was part of a
+// spill range.
+func (e *calcEngine) clearSpilledCell(key calcKey) {
+	if c, ok := e.cells[key]; ok && c.F == nil {
+		c.V = nil
+		c.TAttr = sml.ST_CellTypeUnset
+	}
+}
+
+// spillMember returns the dynamic array formula whose result spills into a
+// cell, if any.  As the spill ranges aren't known until the formulas are
+// evaluated, the formulas that could spill into the cell are evaluated first.
+func (e *calcEngine) spillMember(key calcKey) (arrayMember, bool) {
+	cr, err := reference.ParseCellReference(key.ref)
+	if err != nil {
+		return arrayMember{}, false
+	}
+	for k, n := range e.dynamic {
+		if k.ws != key.ws || n.state != calcDirty {
+			continue
+		}
+		if from, err := reference.ParseCellReference(k.ref); err == nil &&
+			from.RowIdx <= cr.RowIdx && from.ColumnIdx <= cr.ColumnIdx {
+			e.evaluate(n)
+		}
+	}
+	m, ok := e.spills[key]
+	return m, ok
+}
+
+// spillValue returns the value of a cell that a dynamic array formula spills
+// into.
+func spillValue(m arrayMember) formula.Result {
+	res := m.node.result
+	switch res.Type {
+	case formula.ResultTypeArray:
+		if m.row < len(res.ValueArray) && m.col < len(res.ValueArray[m.row]) {
+			return res.ValueArray[m.row][m.col]
+		}
+	case formula.ResultTypeList:
+		if m.row == 0 && m.col < len(res.ValueList) {
+			return res.ValueList[m.col]
+		}
+	}
+	return formula.MakeEmptyResult()
+}
+
+// firstValue returns the top left value of an array or list result, or the
+// result itself otherwise.
+func firstValue(res formula.Result) formula.Result {
+	switch res.Type {
+	case formula.ResultTypeArray:
+		if len(res.ValueArray) > 0 && len(res.ValueArray[0]) > 0 {
+			return res.ValueArray[0][0]
+		}
+		return formula.MakeErrorResultType(formula.ErrorTypeNA, "")
+	case formula.ResultTypeList:
+		if len(res.ValueList) > 0 {
+			return res.ValueList[0]
+		}
+		return formula.MakeErrorResultType(formula.ErrorTypeNA, "")
+	}
+	return res
+}
+
+// storeSpill writes the values that the result of a dynamic array formula
+// spills into to the cells, and records the spill range as the range of the
+// formula.
+func (e *calcEngine) storeSpill(n *calcNode) {
+	origin, err := reference.ParseCellReference(n.key.ref)
+	if err != nil {
+		return
+	}
+	rows, cols := 0, 0
+	for _, k := range n.spilled {
+		m := e.spills[k]
+		cr, err := reference.ParseCellReference(k.ref)
+		if err != nil {
+			continue
+		}
+		c := n.sheet.Row(cr.RowIdx).Cell(cr.Column).x
+		e.cells[k] = c
+		storeSpilledValue(c, spillValue(m))
+		if m.row > rows {
+			rows = m.row
+		}
+		if m.col > cols {
+			cols = m.col
+		}
+	}
+	ref := n.key.ref
+	if rows > 0 || cols > 0 {
+		ref = fmt.Sprintf("%s:%s%d", ref, reference.IndexToColumn(origin.ColumnIdx+uint32(cols)), origin.RowIdx+uint32(rows))
+	}
+	n.x.F.RefAttr = unioffice.String(ref)
+}
+
+// storeSpilledValue writes a value that a dynamic array formula spills into a
+// cell.
+func storeSpilledValue(c *sml.CT_Cell, res formula.Result) {
+	if res.Type == formula.ResultTypeEmpty {
+		res = formula.MakeNumberResult(0)
+	}
+	setCachedResult(c, res)
+}
+
+// clearSpill removes the values that the result of a dynamic array formula in
+// the cell spilled into, as they're no longer valid once the formula changes.
+func (c Cell) clearSpill() {
+	if !isDynamicArray(c.x) || c.x.F.RefAttr == nil {
+		return
+	}
+	from, to, err := reference.ParseRangeReference(*c.x.F.RefAttr)
+	if err != nil {
+		return
+	}
+	for _, r := range c.s.SheetData.Row {
+		if r.RAttr == nil || *r.RAttr < from.RowIdx || *r.RAttr > to.RowIdx {
+			continue
+		}
+		for _, x := range r.C {
+			if x == c.x || x.F != nil || x.RAttr == nil {
+				continue
+			}
+			cr, err := reference.ParseCellReference(*x.RAttr)
+			if err != nil || cr.ColumnIdx < from.ColumnIdx || cr.ColumnIdx > to.ColumnIdx {
+				continue
+			}
+			x.V = nil
+			x.TAttr = sml.ST_CellTypeUnset
+		}
+	}
+}
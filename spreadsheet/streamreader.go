@@ -0,0 +1,352 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/schema/soo/pkg/relationships"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+	"github.com/unidoc/unioffice/zippkg"
+)
+
+// StreamReader reads the rows of a workbook's sheets one at a time without
+// decoding entire sheets into memory, allowing very large workbooks to be
+// processed.  The styles are only read once a row that needs them is read.
+// The shared strings table is read incrementally, as far as the highest
+// string index used by the rows read so far, and only the text of each string
+// is kept.  Memory use therefore grows with the text of the shared strings up
+// to that index rather than with the size of the table.
+type StreamReader struct {
+	wb         *Workbook
+	files      map[string]*zip.File
+	sheets     []streamSheet
+	sstFile    *zip.File
+	sstRC      io.ReadCloser
+	sstDec     *xml.Decoder
+	sstDone    bool
+	stylesFile *zip.File
+	stylesRead bool
+	closer     io.Closer
+}
+
+type streamSheet struct {
+	name string
+	f    *zip.File
+}
+
+// NewStreamReader constructs a StreamReader that reads a workbook (.xlsx).
+func NewStreamReader(r io.ReaderAt, size int64) (*StreamReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("parsing zip: %s", err)
+	}
+	sr := &StreamReader{wb: New(), files: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		sr.files[f.Name] = f
+	}
+
+	rels := relationships.NewRelationships()
+	if err := sr.decode(unioffice.BaseRelsFilename, rels); err != nil {
+		return nil, err
+	}
+	wbFn := ""
+	for _, r := range rels.Relationship {
+		if r.TypeAttr == unioffice.OfficeDocumentType {
+			wbFn = resolveTarget("", r.TargetAttr)
+		}
+	}
+	if wbFn == "" {
+		return nil, errors.New("no workbook found")
+	}
+	sr.wb.x = sml.NewWorkbook()
+	if err := sr.decode(wbFn, sr.wb.x); err != nil {
+		return nil, err
+	}
+	wbRels := relationships.NewRelationships()
+	if err := sr.decode(zippkg.RelationsPathFor(wbFn), wbRels); err != nil {
+		return nil, err
+	}
+
+	base := path.Dir(wbFn)
+	targets := map[string]string{}
+	for _, r := range wbRels.Relationship {
+		fn := resolveTarget(base, r.TargetAttr)
+		switch r.TypeAttr {
+		case unioffice.WorksheetType:
+			targets[r.IdAttr] = fn
+		case unioffice.SharedStingsType:
+			sr.sstFile = sr.files[fn]
+		case unioffice.StylesType:
+			sr.stylesFile = sr.files[fn]
+		}
+	}
+	for _, s := range sr.wb.x.Sheets.Sheet {
+		if f, ok := sr.files[targets[s.IdAttr]]; ok {
+			sr.sheets = append(sr.sheets, streamSheet{s.NameAttr, f})
+		}
+	}
+	return sr, nil
+}
+
+// OpenStreamReader opens a workbook (.xlsx) for reading with a StreamReader.
+// The StreamReader must be closed to close the file.
+func OpenStreamReader(filename string) (*StreamReader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %s", filename, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error opening %s: %s", filename, err)
+	}
+	sr, err := NewStreamReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	sr.closer = f
+	return sr, nil
+}
+
+// resolveTarget returns the path within the zip of a relationship target.
+func resolveTarget(base, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return target[1:]
+	}
+	return path.Clean(path.Join(base, target))
+}
+
+func (sr *StreamReader) decode(fn string, dest interface{}) error {
+	f, ok := sr.files[fn]
+	if !ok {
+		return fmt.Errorf("%s not found", fn)
+	}
+	return zippkg.Decode(f, dest)
+}
+
+// Close closes the file opened by OpenStreamReader.
+func (sr *StreamReader) Close() error {
+	if sr.sstRC != nil {
+		sr.sstRC.Close()
+		sr.sstRC = nil
+	}
+	if sr.closer != nil {
+		return sr.closer.Close()
+	}
+	return nil
+}
+
+// SheetNames returns the names of the sheets in the workbook.
+func (sr *StreamReader) SheetNames() []string {
+	ret := []string{}
+	for _, s := range sr.sheets {
+		ret = append(ret, s.name)
+	}
+	return ret
+}
+
+// Sheet returns a RowReader for reading the rows of a sheet.
+func (sr *StreamReader) Sheet(name string) (*RowReader, error) {
+	for i, s := range sr.sheets {
+		if s.name == name {
+			return sr.SheetByIndex(i)
+		}
+	}
+	return nil, ErrorNotFound
+}
+
+// SheetByIndex returns a RowReader for reading the rows of the sheet at the
+// given index.
+func (sr *StreamReader) SheetByIndex(idx int) (*RowReader, error) {
+	if idx < 0 || idx >= len(sr.sheets) {
+		return nil, ErrorNotFound
+	}
+	rc, err := sr.sheets[idx].f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", sr.sheets[idx].f.Name, err)
+	}
+	return &RowReader{sr: sr, rc: rc, dec: xml.NewDecoder(rc), ws: sml.NewWorksheet()}, nil
+}
+
+// prepare reads the shared strings used by a row, and the styles the first
+// time they are needed.
+func (sr *StreamReader) prepare(row *sml.CT_Row) error {
+	for _, c := range row.C {
+		if c.TAttr == sml.ST_CellTypeS && c.V != nil {
+			if id, err := strconv.Atoi(*c.V); err == nil {
+				if err := sr.readStrings(id); err != nil {
+					return err
+				}
+			}
+		}
+		if c.SAttr != nil && !sr.stylesRead {
+			sr.stylesRead = true
+			if sr.stylesFile != nil {
+				sr.wb.StyleSheet = NewStyleSheet(sr.wb)
+				if err := zippkg.Decode(sr.stylesFile, sr.wb.StyleSheet.X()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readStrings reads the shared strings table until it contains the string
+// with an index, keeping only the text of each string.
+func (sr *StreamReader) readStrings(id int) error {
+	sst := sr.wb.SharedStrings.X()
+	if sr.sstFile == nil || sr.sstDone || id < len(sst.Si) {
+		return nil
+	}
+	if sr.sstDec == nil {
+		rc, err := sr.sstFile.Open()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %s", sr.sstFile.Name, err)
+		}
+		sr.sstRC = rc
+		sr.sstDec = xml.NewDecoder(rc)
+	}
+	for id >= len(sst.Si) {
+		tok, err := sr.sstDec.Token()
+		if err != nil {
+			sr.sstDone = true
+			sr.sstRC.Close()
+			sr.sstRC = nil
+			if err != io.EOF {
+				return err
+			}
+			return nil
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok || el.Name.Local != "si" {
+			continue
+		}
+		x := sml.NewCT_Rst()
+		if err := sr.sstDec.DecodeElement(x, &el); err != nil {
+			return err
+		}
+		// rich text is reduced to the text of its runs
+		text := ""
+		if x.T != nil {
+			text = *x.T
+		}
+		for _, r := range x.R {
+			text += r.T
+		}
+		si := sml.NewCT_Rst()
+		si.T = unioffice.String(text)
+		sst.Si = append(sst.Si, si)
+	}
+	return nil
+}
+
+// RowReader reads the rows of a sheet in order.  Only the current row is held
+// in memory.
+type RowReader struct {
+	sr     *StreamReader
+	rc     io.ReadCloser
+	dec    *xml.Decoder
+	ws     *sml.Worksheet
+	row    Row
+	rowNum uint32
+	err    error
+	done   bool
+}
+
+// Next advances to the next row in the sheet, returning false when there are
+// no more rows or an error occurs.
+func (rr *RowReader) Next() bool {
+	if rr.done {
+		return false
+	}
+	for {
+		tok, err := rr.dec.Token()
+		if err != nil {
+			if err != io.EOF {
+				rr.err = err
+			}
+			rr.done = true
+			return false
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if el.Name.Local != "row" {
+				continue
+			}
+			x := sml.NewCT_Row()
+			if err := rr.dec.DecodeElement(x, &el); err != nil {
+				rr.err = err
+				rr.done = true
+				return false
+			}
+			rr.number(x)
+			if err := rr.sr.prepare(x); err != nil {
+				rr.err = err
+				rr.done = true
+				return false
+			}
+			rr.row = Row{rr.sr.wb, rr.ws, x}
+			return true
+		case xml.EndElement:
+			// the remainder of the sheet contains no rows
+			if el.Name.Local == "sheetData" {
+				rr.done = true
+				return false
+			}
+		}
+	}
+}
+
+// number fills in the row and cell references which are optional in the file
+// format.
+func (rr *RowReader) number(x *sml.CT_Row) {
+	if x.RAttr == nil {
+		x.RAttr = unioffice.Uint32(rr.rowNum + 1)
+	}
+	rr.rowNum = *x.RAttr
+	col := uint32(0)
+	for _, c := range x.C {
+		if c.RAttr != nil {
+			if cr, err := reference.ParseCellReference(*c.RAttr); err == nil {
+				col = cr.ColumnIdx + 1
+				continue
+			}
+		}
+		c.RAttr = unioffice.Stringf("%s%d", reference.IndexToColumn(col), rr.rowNum)
+		col++
+	}
+}
+
+// Row returns the current row.
+func (rr *RowReader) Row() Row {
+	return rr.row
+}
+
+// Err returns the error, if any, that stopped reading rows.
+func (rr *RowReader) Err() error {
+	return rr.err
+}
+
+// Close closes the sheet.
+func (rr *RowReader) Close() error {
+	rr.done = true
+	return rr.rc.Close()
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+func TestStreamReader(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	sheet.Cell("A1").SetString("shared")
+	sheet.Cell("B1").SetInlineString("inline")
+	sheet.Cell("C1").SetNumber(1.5)
+	sheet.Cell("A3").SetBool(true)
+	sheet.Cell("B3").SetDate(time.Date(2018, 2, 3, 0, 0, 0, 0, time.UTC))
+	cs := wb.StyleSheet.AddCellStyle()
+	cs.SetNumberFormat("yyyy-mm-dd")
+	sheet.Cell("B3").SetStyle(cs)
+	sheet.Cell("C3").SetFormulaRaw("C1*2")
+	sheet.Cell("C3").SetCachedFormulaResult("3")
+	other := wb.AddSheet()
+	other.SetName("Other")
+	other.Cell("D5").SetNumber(5)
+	other.Cell("E5").SetString("later")
+
+	buf := bytes.Buffer{}
+	if err := wb.Save(&buf); err != nil {
+		t.Fatalf("error saving workbook: %s", err)
+	}
+
+	sr, err := spreadsheet.NewStreamReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading workbook: %s", err)
+	}
+	defer sr.Close()
+	if got, exp := sr.SheetNames(), []string{"Sheet 1", "Other"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected sheets %v, got %v", exp, got)
+	}
+
+	rr, err := sr.SheetByIndex(0)
+	if err != nil {
+		t.Fatalf("error opening sheet: %s", err)
+	}
+	defer rr.Close()
+	got := map[string]string{}
+	rowNumbers := []uint32{}
+	for rr.Next() {
+		row := rr.Row()
+		rowNumbers = append(rowNumbers, row.RowNumber())
+		for _, c := range row.Cells() {
+			got[c.Reference()] = c.GetFormattedValue()
+		}
+	}
+	if err := rr.Err(); err != nil {
+		t.Fatalf("error reading rows: %s", err)
+	}
+	if exp := []uint32{1, 3}; !reflect.DeepEqual(rowNumbers, exp) {
+		t.Errorf("expected rows %v, got %v", exp, rowNumbers)
+	}
+	exp := map[string]string{
+		"A1": "shared",
+		"B1": "inline",
+		"C1": "1.5",
+		"A3": "TRUE",
+		"B3": "2018-02-03",
+		"C3": "3",
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	rr, err = sr.Sheet("Other")
+	if err != nil {
+		t.Fatalf("error opening sheet: %s", err)
+	}
+	defer rr.Close()
+	if !rr.Next() {
+		t.Fatalf("expected a row")
+	}
+	if v, _ := rr.Row().Cell("D").GetValueAsNumber(); v != 5 {
+		t.Errorf("expected 5 in D5, got %f", v)
+	}
+	if v := rr.Row().Cell("E").GetString(); v != "later" {
+		t.Errorf("expected later in E5, got %s", v)
+	}
+	if rr.Next() {
+		t.Errorf("expected a single row")
+	}
+
+	if _, err := sr.Sheet("Missing"); err == nil {
+		t.Errorf("expected an error for a missing sheet")
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/zippkg"
+)
+
+// StreamWriter writes a workbook to an io.Writer, writing each row to the
+// output as soon as the next row is added rather than holding the entire sheet
+// in memory.  This allows writing sheets that are too large to construct with a
+// Workbook.
+//
+// Sheets are written one at a time, and adding a sheet completes the previous
+// sheet.  Strings set with Cell.SetString are stored in the shared strings
+// table which is held in memory until the writer is closed, while strings set
+// with Cell.SetInlineString are written directly with the row.
+type StreamWriter struct {
+	wb     *Workbook
+	z      *zip.Writer
+	sheet  *StreamSheet
+	closed bool
+}
+
+// NewStreamWriter constructs a new StreamWriter that writes a workbook to w.
+// Close must be called to complete the workbook.
+func NewStreamWriter(w io.Writer) *StreamWriter {
+	return &StreamWriter{wb: New(), z: zip.NewWriter(w)}
+}
+
+// StyleSheet returns the stylesheet of the workbook being written which is
+// used to create cell styles.
+func (sw *StreamWriter) StyleSheet() StyleSheet {
+	return sw.wb.StyleSheet
+}
+
+// AddDefinedName adds a name for a cell or range reference that can be used in
+// formulas and charts.
+func (sw *StreamWriter) AddDefinedName(name, ref string) DefinedName {
+	return sw.wb.AddDefinedName(name, ref)
+}
+
+// AddSheet adds a new sheet to the workbook, completing the previously added
+// sheet.
+func (sw *StreamWriter) AddSheet() (*StreamSheet, error) {
+	if sw.closed {
+		return nil, errors.New("stream writer is closed")
+	}
+	if sw.sheet != nil {
+		if err := sw.sheet.finish(); err != nil {
+			return nil, err
+		}
+	}
+	s := sw.wb.AddSheet()
+	// the extents of the sheet aren't known until it has been written
+	s.x.Dimension = nil
+	sw.sheet = &StreamSheet{sw: sw, s: s, idx: len(sw.wb.xws)}
+	return sw.sheet, nil
+}
+
+// Close completes the current sheet and writes the remainder of the workbook.
+// It does not close the underlying writer.
+func (sw *StreamWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	// a workbook must contain at least one sheet
+	if sw.sheet == nil {
+		if _, err := sw.AddSheet(); err != nil {
+			return err
+		}
+	}
+	if err := sw.sheet.finish(); err != nil {
+		return err
+	}
+	sw.closed = true
+	if err := sw.wb.save(sw.z, true); err != nil {
+		return err
+	}
+	return sw.z.Close()
+}
+
+// StreamSheet is a sheet being written by a StreamWriter.  Column widths,
+// frozen panes and other settings that precede the cell data in the sheet must
+// be configured before the first row is added.
+type StreamSheet struct {
+	sw     *StreamWriter
+	s      Sheet
+	idx    int
+	w      io.Writer
+	enc    *xml.Encoder
+	row    *sml.CT_Row
+	rowNum uint32
+	done   bool
+}
+
+// Name returns the sheet name.
+func (ss *StreamSheet) Name() string {
+	return ss.s.Name()
+}
+
+// SetName sets the sheet name.
+func (ss *StreamSheet) SetName(name string) {
+	ss.s.SetName(name)
+}
+
+// Column returns the column properties for the given column index (1-N).
+// Column properties must be set before the first row is added, as they are
+// written before the rows, so an error is returned once a row has been added.
+func (ss *StreamSheet) Column(idx uint32) (Column, error) {
+	if ss.w != nil {
+		return Column{}, errors.New("column properties must be set before the first row is added")
+	}
+	return ss.s.Column(idx), nil
+}
+
+// SetFrozen freezes the first row, first column or both.  It must be called
+// before the first row is added, and returns an error otherwise.
+func (ss *StreamSheet) SetFrozen(firstRow, firstCol bool) error {
+	if ss.w != nil {
+		return errors.New("frozen panes must be set before the first row is added")
+	}
+	ss.s.SetFrozen(firstRow, firstCol)
+	return nil
+}
+
+// AddMergedCells merges cells within a sheet.  Merged cells may be added at any
+// time before the sheet is completed.
+func (ss *StreamSheet) AddMergedCells(fromRef, toRef string) MergedCell {
+	return ss.s.AddMergedCells(fromRef, toRef)
+}
+
+// AddRow writes the previously added row and adds a new row following it.
+func (ss *StreamSheet) AddRow() (Row, error) {
+	return ss.AddNumberedRow(ss.rowNum + 1)
+}
+
+// AddNumberedRow writes the previously added row and adds a new row with the
+// given row number (1-N).  Rows must be added in increasing order.
+func (ss *StreamSheet) AddNumberedRow(rowNum uint32) (Row, error) {
+	if ss.done {
+		return Row{}, errors.New("sheet has already been written")
+	}
+	if rowNum <= ss.rowNum {
+		return Row{}, fmt.Errorf("row %d must be after the previous row %d", rowNum, ss.rowNum)
+	}
+	if err := ss.start(); err != nil {
+		return Row{}, err
+	}
+	if err := ss.flush(); err != nil {
+		return Row{}, err
+	}
+	ss.row = sml.NewCT_Row()
+	ss.row.RAttr = unioffice.Uint32(rowNum)
+	ss.rowNum = rowNum
+	return Row{ss.sw.wb, ss.s.x, ss.row}, nil
+}
+
+// split marshals the sheet with no rows and splits it before and after the
+// sheet data.
+func (ss *StreamSheet) split() ([]byte, []byte, error) {
+	buf := bytes.Buffer{}
+	if err := xml.NewEncoder(&buf).Encode(ss.s.x); err != nil {
+		return nil, nil, err
+	}
+	const sheetData = "<ma:sheetData>"
+	b := buf.Bytes()
+	idx := bytes.Index(b, []byte(sheetData+"</ma:sheetData>"))
+	if idx == -1 {
+		return nil, nil, errors.New("unable to find sheet data")
+	}
+	idx += len(sheetData)
+	return b[:idx], b[idx:], nil
+}
+
+// start writes the start of the sheet up to the sheet data.
+func (ss *StreamSheet) start() error {
+	if ss.w != nil {
+		return nil
+	}
+	prefix, _, err := ss.split()
+	if err != nil {
+		return err
+	}
+	fh := &zip.FileHeader{}
+	fh.Method = zip.Deflate
+	fh.Name = unioffice.AbsoluteFilename(unioffice.DocTypeSpreadsheet, unioffice.WorksheetType, ss.idx)
+	fh.SetModTime(time.Now())
+	w, err := ss.sw.z.CreateHeader(fh)
+	if err != nil {
+		return fmt.Errorf("creating %s in zip: %s", fh.Name, err)
+	}
+	ss.w = zippkg.SelfClosingWriter{W: w}
+	if _, err := ss.w.Write([]byte(zippkg.XMLHeader)); err != nil {
+		return err
+	}
+	if _, err := ss.w.Write(prefix); err != nil {
+		return err
+	}
+	ss.enc = xml.NewEncoder(ss.w)
+	return nil
+}
+
+// flush writes the current row.
+func (ss *StreamSheet) flush() error {
+	if ss.row == nil {
+		return nil
+	}
+	err := ss.enc.EncodeElement(ss.row, xml.StartElement{Name: xml.Name{Local: "ma:row"}})
+	ss.row = nil
+	return err
+}
+
+// finish writes the current row and the remainder of the sheet.
+func (ss *StreamSheet) finish() error {
+	if ss.done {
+		return nil
+	}
+	if err := ss.start(); err != nil {
+		return err
+	}
+	if err := ss.flush(); err != nil {
+		return err
+	}
+	ss.done = true
+	_, suffix, err := ss.split()
+	if err != nil {
+		return err
+	}
+	if _, err := ss.w.Write(suffix); err != nil {
+		return err
+	}
+	_, err = ss.w.Write([]byte("\r\n"))
+	return err
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/unidoc/unioffice/measurement"
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+func TestStreamWriter(t *testing.T) {
+	buf := bytes.Buffer{}
+	sw := spreadsheet.NewStreamWriter(&buf)
+	cs := sw.StyleSheet().AddCellStyle()
+	cs.SetNumberFormat("0.00")
+
+	sheet, err := sw.AddSheet()
+	if err != nil {
+		t.Fatalf("error adding sheet: %s", err)
+	}
+	sheet.SetName("Data")
+	col, err := sheet.Column(1)
+	if err != nil {
+		t.Fatalf("error getting column: %s", err)
+	}
+	col.SetWidth(2 * measurement.Inch)
+	if err := sheet.SetFrozen(true, false); err != nil {
+		t.Fatalf("error freezing the first row: %s", err)
+	}
+	hdr, _ := sheet.AddRow()
+	hdr.AddCell().SetString("Name")
+	hdr.AddCell().SetInlineString("Value")
+	if _, err := sheet.Column(2); err == nil {
+		t.Errorf("expected an error getting a column after adding a row")
+	}
+	if err := sheet.SetFrozen(true, true); err == nil {
+		t.Errorf("expected an error freezing panes after adding a row")
+	}
+	for i := 0; i < 1000; i++ {
+		row, err := sheet.AddRow()
+		if err != nil {
+			t.Fatalf("error adding row: %s", err)
+		}
+		row.AddCell().SetString("name")
+		c := row.AddCell()
+		c.SetNumber(float64(i))
+		c.SetStyle(cs)
+	}
+	if _, err := sheet.AddNumberedRow(5); err == nil {
+		t.Errorf("expected an error adding an earlier row")
+	}
+	row, _ := sheet.AddNumberedRow(1010)
+	row.Cell("C").SetFormulaRaw("SUM(B2:B1001)")
+	sheet.AddMergedCells("A1003", "B1003")
+
+	second, err := sw.AddSheet()
+	if err != nil {
+		t.Fatalf("error adding sheet: %s", err)
+	}
+	if _, err := sheet.AddRow(); err == nil {
+		t.Errorf("expected an error adding a row to a completed sheet")
+	}
+	row, _ = second.AddRow()
+	row.AddCell().SetBool(true)
+	if err := sw.Close(); err != nil {
+		t.Fatalf("error closing stream writer: %s", err)
+	}
+
+	wb, err := spreadsheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading streamed workbook: %s", err)
+	}
+	defer wb.Close()
+	if err := wb.Validate(); err != nil {
+		t.Errorf("streamed workbook is invalid: %s", err)
+	}
+	if wb.SheetCount() != 2 {
+		t.Fatalf("expected 2 sheets, got %d", wb.SheetCount())
+	}
+	data, err := wb.GetSheet("Data")
+	if err != nil {
+		t.Fatalf("expected a sheet named Data: %s", err)
+	}
+	if got := len(data.Rows()); got != 1002 {
+		t.Errorf("expected 1002 rows, got %d", got)
+	}
+	if got := data.Cell("A1").GetString(); got != "Name" {
+		t.Errorf("expected Name in A1, got %s", got)
+	}
+	if got := data.Cell("B1").GetString(); got != "Value" {
+		t.Errorf("expected Value in B1, got %s", got)
+	}
+	if got := data.Cell("B1001").GetFormattedValue(); got != "999.00" {
+		t.Errorf("expected 999.00 in B1001, got %s", got)
+	}
+	if got := data.Cell("C1010").GetFormula(); got != "SUM(B2:B1001)" {
+		t.Errorf("expected formula in C1010, got %s", got)
+	}
+	if got := len(data.MergedCells()); got != 1 {
+		t.Errorf("expected 1 merged cell, got %d", got)
+	}
+	if views := data.SheetViews(); len(views) != 1 || views[0].X().Pane == nil {
+		t.Errorf("expected frozen pane")
+	}
+	if cols := data.X().Cols; len(cols) != 1 || cols[0].Col[0].WidthAttr == nil {
+		t.Errorf("expected column width")
+	}
+	if v, _ := wb.Sheets()[1].Cell("A1").GetValueAsBool(); !v {
+		t.Errorf("expected TRUE in second sheet")
+	}
+}
+
+func TestStreamWriterEmpty(t *testing.T) {
+	buf := bytes.Buffer{}
+	sw := spreadsheet.NewStreamWriter(&buf)
+	if err := sw.Close(); err != nil {
+		t.Fatalf("error closing stream writer: %s", err)
+	}
+	wb, err := spreadsheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading streamed workbook: %s", err)
+	}
+	defer wb.Close()
+	if wb.SheetCount() != 1 {
+		t.Errorf("expected 1 sheet, got %d", wb.SheetCount())
+	}
+}
@@ -7,9 +7,20 @@
 
 package spreadsheet
 
-import "github.com/unidoc/unioffice/schema/soo/sml"
+import (
+	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/unidoc/unioffice"
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet/reference"
+)
+
+// Table is a table (ListObject) on a sheet.  It consists of a header row that
+// names the table columns, the data rows and an optional totals row.
 type Table struct {
+	w *Workbook
 	x *sml.Table
 }
 
@@ -26,7 +37,547 @@ func (t Table) Name() string {
 	return ""
 }
 
+// SetName sets the name of the table which is used to refer to it in
+// formulas, updating the structured references to the table throughout the
+// workbook.
+func (t Table) SetName(name string) error {
+	if name == "" || strings.ContainsAny(name, " []#'!:") {
+		return fmt.Errorf("invalid table name %s", name)
+	}
+	for _, tbl := range t.w.tables {
+		if tbl != t.x && tbl.NameAttr != nil && strings.EqualFold(*tbl.NameAttr, name) {
+			return fmt.Errorf("table %s already exists", name)
+		}
+	}
+	if old := t.Name(); old != "" && old != name {
+		t.w.rewriteFormulas(func(f *string) {
+			*f = renameTableNames(*f, old, name)
+		})
+		if t.w.calc != nil {
+			t.w.calc.rebuild = true
+		}
+	}
+	t.x.NameAttr = unioffice.String(name)
+	t.x.DisplayNameAttr = name
+	return nil
+}
+
 // Reference returns the table reference (the cells within the table)
 func (t Table) Reference() string {
 	return t.x.RefAttr
 }
+
+// Sheet returns the sheet that contains the table.
+func (t Table) Sheet() (Sheet, bool) {
+	for i, tbl := range t.w.tables {
+		if tbl == t.x {
+			return t.w.tableSheet(i)
+		}
+	}
+	return Sheet{}, false
+}
+
+// SetStyle sets the table style (e.g. 'TableStyleMedium2').
+func (t Table) SetStyle(name string) {
+	t.styleInfo().NameAttr = unioffice.String(name)
+}
+
+// SetShowRowStripes controls whether the table style shades alternate rows.
+func (t Table) SetShowRowStripes(b bool) {
+	t.styleInfo().ShowRowStripesAttr = unioffice.Bool(b)
+}
+
+// SetShowColumnStripes controls whether the table style shades alternate
+// columns.
+func (t Table) SetShowColumnStripes(b bool) {
+	t.styleInfo().ShowColumnStripesAttr = unioffice.Bool(b)
+}
+
+// SetShowFirstColumn controls whether the table style highlights the first
+// column.
+func (t Table) SetShowFirstColumn(b bool) {
+	t.styleInfo().ShowFirstColumnAttr = unioffice.Bool(b)
+}
+
+// SetShowLastColumn controls whether the table style highlights the last
+// column.
+func (t Table) SetShowLastColumn(b bool) {
+	t.styleInfo().ShowLastColumnAttr = unioffice.Bool(b)
+}
+
+func (t Table) styleInfo() *sml.CT_TableStyleInfo {
+	if t.x.TableStyleInfo == nil {
+		t.x.TableStyleInfo = sml.NewCT_TableStyleInfo()
+	}
+	return t.x.TableStyleInfo
+}
+
+// SetAutoFilter controls whether the header row has filter buttons.
+func (t Table) SetAutoFilter(b bool) {
+	if !b {
+		t.x.AutoFilter = nil
+		return
+	}
+	if t.x.AutoFilter == nil {
+		t.x.AutoFilter = sml.NewCT_AutoFilter()
+	}
+	t.x.AutoFilter.RefAttr = unioffice.String(t.filterReference())
+}
+
+// filterReference returns the reference of the table without its totals row.
+func (t Table) filterReference() string {
+	from, to, err := reference.ParseRangeReference(t.x.RefAttr)
+	if err != nil {
+		return t.x.RefAttr
+	}
+	if t.ShowTotalsRow() {
+		to.RowIdx--
+	}
+	return fmt.Sprintf("%s:%s", from, to)
+}
+
+// Columns returns the columns of the table.
+func (t Table) Columns() []TableColumn {
+	ret := []TableColumn{}
+	if t.x.TableColumns == nil {
+		return ret
+	}
+	for i, c := range t.x.TableColumns.TableColumn {
+		ret = append(ret, TableColumn{t, c, i})
+	}
+	return ret
+}
+
+// Column returns the table column with a given name.
+func (t Table) Column(name string) (TableColumn, error) {
+	for _, c := range t.Columns() {
+		if strings.EqualFold(c.Name(), name) {
+			return c, nil
+		}
+	}
+	return TableColumn{}, fmt.Errorf("column %s not found", name)
+}
+
+// ShowTotalsRow returns true if the table has a totals row.
+func (t Table) ShowTotalsRow() bool {
+	return t.x.TotalsRowCountAttr != nil && *t.x.TotalsRowCountAttr > 0
+}
+
+// SetShowTotalsRow adds or removes a totals row below the data rows of the
+// table.  The totals row replaces the contents of the cells below the table and
+// the totals are computed with the function of each column.
+func (t Table) SetShowTotalsRow(b bool) {
+	if b == t.ShowTotalsRow() {
+		return
+	}
+	from, to, err := reference.ParseRangeReference(t.x.RefAttr)
+	if err != nil {
+		return
+	}
+	if b {
+		to.RowIdx++
+		t.x.TotalsRowCountAttr = unioffice.Uint32(1)
+		t.x.TotalsRowShownAttr = nil
+		t.x.RefAttr = fmt.Sprintf("%s:%s", from, to)
+		for _, c := range t.Columns() {
+			c.writeTotal()
+		}
+	} else {
+		for _, c := range t.Columns() {
+			if cell, ok := c.totalsCell(); ok {
+				cell.Clear()
+			}
+		}
+		to.RowIdx--
+		t.x.TotalsRowCountAttr = nil
+		t.x.TotalsRowShownAttr = unioffice.Bool(false)
+		t.x.RefAttr = fmt.Sprintf("%s:%s", from, to)
+	}
+	if t.x.AutoFilter != nil {
+		t.x.AutoFilter.RefAttr = unioffice.String(t.filterReference())
+	}
+}
+
+// Resize changes the range of the table.  The top left cell of the table must
+// remain the same and, if the table has a totals row, the range includes it.
+// Columns are added or removed from the right side of the table as needed.
+func (t Table) Resize(ref string) error {
+	s, ok := t.Sheet()
+	if !ok {
+		return errors.New("table is not on a sheet")
+	}
+	from, to, err := reference.ParseRangeReference(ref)
+	if err != nil {
+		return err
+	}
+	oldFrom, _, err := reference.ParseRangeReference(t.x.RefAttr)
+	if err != nil {
+		return err
+	}
+	if from.RowIdx != oldFrom.RowIdx || from.ColumnIdx != oldFrom.ColumnIdx {
+		return errors.New("the top left cell of a table can't be moved")
+	}
+	totals := t.ShowTotalsRow()
+	minRows := uint32(1)
+	if totals {
+		minRows++
+	}
+	if to.RowIdx < from.RowIdx+minRows {
+		return errors.New("a table must contain at least one data row")
+	}
+	if err := s.checkTableOverlap(t.x, from, to); err != nil {
+		return err
+	}
+
+	t.SetShowTotalsRow(false)
+	if totals {
+		to.RowIdx--
+	}
+	from.AbsoluteColumn, from.AbsoluteRow, to.AbsoluteColumn, to.AbsoluteRow = false, false, false, false
+	t.x.RefAttr = fmt.Sprintf("%s:%s", from, to)
+
+	// match the columns to the new width
+	tc := t.x.TableColumns
+	width := int(to.ColumnIdx - from.ColumnIdx + 1)
+	if len(tc.TableColumn) > width {
+		tc.TableColumn = tc.TableColumn[:width]
+	}
+	for i := len(tc.TableColumn); i < width; i++ {
+		c := sml.NewCT_TableColumn()
+		c.IdAttr = nextTableColumnID(tc)
+		c.NameAttr = s.tableHeader(tc, fmt.Sprintf("%s%d", reference.IndexToColumn(from.ColumnIdx+uint32(i)), from.RowIdx))
+		tc.TableColumn = append(tc.TableColumn, c)
+	}
+	tc.CountAttr = unioffice.Uint32(uint32(len(tc.TableColumn)))
+
+	for _, c := range t.Columns() {
+		if c.x.CalculatedColumnFormula != nil {
+			c.SetCalculatedColumnFormula(c.x.CalculatedColumnFormula.Content)
+		}
+	}
+	if t.x.AutoFilter != nil {
+		t.x.AutoFilter.RefAttr = unioffice.String(t.filterReference())
+	}
+	t.SetShowTotalsRow(totals)
+	// structured references to the table now refer to different cells
+	if t.w.calc != nil {
+		t.w.calc.rebuild = true
+	}
+	return nil
+}
+
+// TableColumn is a column within a table.
+type TableColumn struct {
+	t   Table
+	x   *sml.CT_TableColumn
+	idx int
+}
+
+// X returns the inner wrapped XML type.
+func (c TableColumn) X() *sml.CT_TableColumn {
+	return c.x
+}
+
+// Name returns the name of the column, which is also the text of its header
+// cell.
+func (c TableColumn) Name() string {
+	return c.x.NameAttr
+}
+
+// SetTotalsRowFunction sets the function used to compute the total of the
+// column in the totals row.
+func (c TableColumn) SetTotalsRowFunction(fn sml.ST_TotalsRowFunction) {
+	c.x.TotalsRowFunctionAttr = fn
+	c.x.TotalsRowLabelAttr = nil
+	if fn != sml.ST_TotalsRowFunctionCustom {
+		c.x.TotalsRowFormula = nil
+	}
+	c.writeTotal()
+}
+
+// SetTotalsRowFormula sets a custom formula used to compute the total of the
+// column in the totals row.
+func (c TableColumn) SetTotalsRowFormula(formula string) {
+	c.x.TotalsRowFunctionAttr = sml.ST_TotalsRowFunctionCustom
+	c.x.TotalsRowLabelAttr = nil
+	c.x.TotalsRowFormula = sml.NewCT_TableFormula()
+	c.x.TotalsRowFormula.Content = formula
+	c.writeTotal()
+}
+
+// SetTotalsRowLabel sets a label that is displayed in the totals row of the
+// column instead of a total.
+func (c TableColumn) SetTotalsRowLabel(label string) {
+	c.x.TotalsRowFunctionAttr = sml.ST_TotalsRowFunctionUnset
+	c.x.TotalsRowFormula = nil
+	c.x.TotalsRowLabelAttr = unioffice.String(label)
+	c.writeTotal()
+}
+
+// SetCalculatedColumnFormula sets a formula that is used for every data cell in
+// the column.  The formula is that of the first data row, and is written to
+// each cell with its relative references offset to the cell's row, as Excel
+// does for rows added to the table.
+func (c TableColumn) SetCalculatedColumnFormula(formula string) {
+	c.x.CalculatedColumnFormula = sml.NewCT_TableFormula()
+	c.x.CalculatedColumnFormula.Content = formula
+	s, ok := c.t.Sheet()
+	if !ok {
+		return
+	}
+	from, to, err := reference.ParseRangeReference(c.t.x.RefAttr)
+	if err != nil {
+		return
+	}
+	if c.t.ShowTotalsRow() {
+		to.RowIdx--
+	}
+	col := reference.IndexToColumn(from.ColumnIdx + uint32(c.idx))
+	for row := from.RowIdx + 1; row <= to.RowIdx; row++ {
+		s.Cell(fmt.Sprintf("%s%d", col, row)).SetFormulaRaw(offsetFormula(formula, 0, int64(row-from.RowIdx-1)))
+	}
+}
+
+// totalsCell returns the cell in the totals row for the column.
+func (c TableColumn) totalsCell() (Cell, bool) {
+	if !c.t.ShowTotalsRow() {
+		return Cell{}, false
+	}
+	s, ok := c.t.Sheet()
+	if !ok {
+		return Cell{}, false
+	}
+	from, to, err := reference.ParseRangeReference(c.t.x.RefAttr)
+	if err != nil {
+		return Cell{}, false
+	}
+	return s.Cell(fmt.Sprintf("%s%d", reference.IndexToColumn(from.ColumnIdx+uint32(c.idx)), to.RowIdx)), true
+}
+
+// subtotalFunctions maps totals row functions to the SUBTOTAL function number
+// that ignores hidden rows.
+var subtotalFunctions = map[sml.ST_TotalsRowFunction]int{
+	sml.ST_TotalsRowFunctionAverage:   101,
+	sml.ST_TotalsRowFunctionCountNums: 102,
+	sml.ST_TotalsRowFunctionCount:     103,
+	sml.ST_TotalsRowFunctionMax:       104,
+	sml.ST_TotalsRowFunctionMin:       105,
+	sml.ST_TotalsRowFunctionStdDev:    107,
+	sml.ST_TotalsRowFunctionSum:       109,
+	sml.ST_TotalsRowFunctionVar:       110,
+}
+
+// writeTotal writes the total or label for the column to the totals row.
+func (c TableColumn) writeTotal() {
+	cell, ok := c.totalsCell()
+	if !ok {
+		return
+	}
+	switch {
+	case c.x.TotalsRowLabelAttr != nil:
+		cell.SetString(*c.x.TotalsRowLabelAttr)
+	case c.x.TotalsRowFunctionAttr == sml.ST_TotalsRowFunctionCustom && c.x.TotalsRowFormula != nil:
+		cell.SetFormulaRaw(c.x.TotalsRowFormula.Content)
+	case subtotalFunctions[c.x.TotalsRowFunctionAttr] != 0:
+		cell.SetFormulaRaw(fmt.Sprintf("SUBTOTAL(%d,%s[%s])", subtotalFunctions[c.x.TotalsRowFunctionAttr],
+			c.t.Name(), escapeTableColumnName(c.Name())))
+	default:
+		cell.Clear()
+	}
+}
+
+// escapeTableColumnName escapes the characters in a column name that have a
+// special meaning in a structured reference.
+func escapeTableColumnName(name string) string {
+	r := strings.NewReplacer("'", "''", "[", "'[", "]", "']", "#", "'#")
+	return r.Replace(name)
+}
+
+// AddTable adds a table to the sheet covering a range of cells (e.g.
+// 'A1:C10').  The first row of the range is the header row and the text of
+// each header cell is used as the name of its column.  Empty or duplicate
+// headers are replaced with unique names.  The table is created with the
+// default table style, banded rows and an auto filter.
+func (s Sheet) AddTable(ref string) (Table, error) {
+	from, to, err := reference.ParseRangeReference(ref)
+	if err != nil {
+		return Table{}, err
+	}
+	if to.RowIdx <= from.RowIdx {
+		return Table{}, errors.New("a table must contain a header row and at least one data row")
+	}
+	if err := s.checkTableOverlap(nil, from, to); err != nil {
+		return Table{}, err
+	}
+	from.AbsoluteColumn, from.AbsoluteRow, to.AbsoluteColumn, to.AbsoluteRow = false, false, false, false
+
+	wb := s.w
+	x := sml.NewTable()
+	for _, tbl := range wb.tables {
+		if tbl.IdAttr >= x.IdAttr {
+			x.IdAttr = tbl.IdAttr + 1
+		}
+	}
+	if x.IdAttr == 0 {
+		x.IdAttr = 1
+	}
+	t := Table{wb, x}
+	for i := x.IdAttr; ; i++ {
+		if t.SetName(fmt.Sprintf("Table%d", i)) == nil {
+			break
+		}
+	}
+	x.RefAttr = fmt.Sprintf("%s:%s", from, to)
+	for col := from.ColumnIdx; col <= to.ColumnIdx; col++ {
+		c := sml.NewCT_TableColumn()
+		c.IdAttr = nextTableColumnID(x.TableColumns)
+		c.NameAttr = s.tableHeader(x.TableColumns, fmt.Sprintf("%s%d", reference.IndexToColumn(col), from.RowIdx))
+		x.TableColumns.TableColumn = append(x.TableColumns.TableColumn, c)
+	}
+	x.TableColumns.CountAttr = unioffice.Uint32(uint32(len(x.TableColumns.TableColumn)))
+	t.SetAutoFilter(true)
+	t.SetStyle("TableStyleMedium2")
+	t.SetShowFirstColumn(false)
+	t.SetShowLastColumn(false)
+	t.SetShowRowStripes(true)
+	t.SetShowColumnStripes(false)
+
+	dt := unioffice.DocTypeSpreadsheet
+	wb.tables = append(wb.tables, x)
+	idx := len(wb.tables)
+	wb.ContentTypes.AddOverride(unioffice.AbsoluteFilename(dt, unioffice.TableType, idx), unioffice.TableContentType)
+	for i, ws := range wb.xws {
+		if ws != s.x {
+			continue
+		}
+		rel := wb.xwsRels[i].AddAutoRelationship(dt, unioffice.WorksheetType, idx, unioffice.TableType)
+		if s.x.TableParts == nil {
+			s.x.TableParts = sml.NewCT_TableParts()
+		}
+		tp := sml.NewCT_TablePart()
+		tp.IdAttr = rel.ID()
+		s.x.TableParts.TablePart = append(s.x.TableParts.TablePart, tp)
+		s.x.TableParts.CountAttr = unioffice.Uint32(uint32(len(s.x.TableParts.TablePart)))
+	}
+	return t, nil
+}
+
+// tableHeader returns a unique column name for the header cell of a new table
+// column, writing the name to the cell if it's changed.
+func (s Sheet) tableHeader(tc *sml.CT_TableColumns, ref string) string {
+	cell := s.Cell(ref)
+	name := cell.GetString()
+	if name == "" {
+		name = uniqueTableColumnName(tc)
+	}
+	unique := name
+	for i := 2; ; i++ {
+		used := false
+		for _, c := range tc.TableColumn {
+			if strings.EqualFold(c.NameAttr, unique) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			break
+		}
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	if unique != cell.GetString() {
+		cell.SetString(unique)
+	}
+	return unique
+}
+
+// checkTableOverlap returns an error if a range overlaps a table on the sheet
+// other than the given table.
+func (s Sheet) checkTableOverlap(self *sml.Table, from, to reference.CellReference) error {
+	for _, t := range s.Tables() {
+		if t.x == self {
+			continue
+		}
+		tf, tt, err := reference.ParseRangeReference(t.x.RefAttr)
+		if err != nil {
+			continue
+		}
+		if from.ColumnIdx <= tt.ColumnIdx && to.ColumnIdx >= tf.ColumnIdx &&
+			from.RowIdx <= tt.RowIdx && to.RowIdx >= tf.RowIdx {
+			return fmt.Errorf("range overlaps table %s", t.Name())
+		}
+	}
+	return nil
+}
+
+// Tables returns the tables on the sheet.
+func (s Sheet) Tables() []Table {
+	ret := []Table{}
+	for i, tbl := range s.w.tables {
+		if ts, ok := s.w.tableSheet(i); ok && ts.x == s.x {
+			ret = append(ret, Table{s.w, tbl})
+		}
+	}
+	return ret
+}
+
+// RemoveTable removes a table from the sheet.  The cells of the table are left
+// unchanged.
+func (s Sheet) RemoveTable(t Table) error {
+	wb := s.w
+	idx := -1
+	for i, tbl := range wb.tables {
+		if tbl == t.x {
+			idx = i
+		}
+	}
+	if idx == -1 {
+		return errors.New("table not found")
+	}
+	if ts, ok := wb.tableSheet(idx); !ok || ts.x != s.x {
+		return errors.New("table not found on sheet")
+	}
+
+	// tables are numbered by their position, so the relationships to the tables
+	// after the removed table are renumbered
+	dt := unioffice.DocTypeSpreadsheet
+	targets := map[string]string{}
+	for i := idx + 1; i < len(wb.tables); i++ {
+		targets[unioffice.RelativeFilename(dt, unioffice.WorksheetType, unioffice.TableType, i+1)] =
+			unioffice.RelativeFilename(dt, unioffice.WorksheetType, unioffice.TableType, i)
+	}
+	removed := unioffice.RelativeFilename(dt, unioffice.WorksheetType, unioffice.TableType, idx+1)
+	for i, rels := range wb.xwsRels {
+		for _, r := range rels.Relationships() {
+			if r.Type() != unioffice.TableType {
+				continue
+			}
+			if r.Target() == removed {
+				rels.Remove(r)
+				if tp := wb.xws[i].TableParts; tp != nil {
+					tp.TablePart = removeTablePart(tp.TablePart, r.ID())
+				}
+			} else if target, ok := targets[r.Target()]; ok {
+				r.SetTarget(target)
+			}
+		}
+	}
+	if tp := s.x.TableParts; tp != nil {
+		tp.CountAttr = unioffice.Uint32(uint32(len(tp.TablePart)))
+		if len(tp.TablePart) == 0 {
+			s.x.TableParts = nil
+		}
+	}
+	wb.ContentTypes.RemoveOverride(unioffice.AbsoluteFilename(dt, unioffice.TableType, len(wb.tables)))
+	copy(wb.tables[idx:], wb.tables[idx+1:])
+	wb.tables = wb.tables[:len(wb.tables)-1]
+	return nil
+}
+
+func removeTablePart(parts []*sml.CT_TablePart, id string) []*sml.CT_TablePart {
+	for i, p := range parts {
+		if p.IdAttr == id {
+			return append(parts[:i], parts[i+1:]...)
+		}
+	}
+	return parts
+}
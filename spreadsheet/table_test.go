@@ -0,0 +1,136 @@
+// Copyright 2017 Baliance. All rights reserved.
+//
+// Use of this source code is governed by the terms of the Affero GNU General
+// Public License version 3.0 as published by the Free Software Foundation and
+// appearing in the file LICENSE included in the packaging of this file. A
+// commercial license can be purchased by contacting sales@baliance.com.
+
+package spreadsheet_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/unidoc/unioffice/schema/soo/sml"
+	"github.com/unidoc/unioffice/spreadsheet"
+)
+
+func TestAddTable(t *testing.T) {
+	wb := spreadsheet.New()
+	defer wb.Close()
+	sheet := wb.AddSheet()
+	pivotData(sheet)
+	sheet.Cell("D1").SetString("Sales")
+
+	tbl, err := sheet.AddTable("A1:D6")
+	if err != nil {
+		t.Fatalf("error adding table: %s", err)
+	}
+	if tbl.Name() != "Table1" {
+		t.Errorf("expected Table1, got %s", tbl.Name())
+	}
+	names := []string{}
+	for _, c := range tbl.Columns() {
+		names = append(names, c.Name())
+	}
+	if exp := []string{"Region", "Product", "Sales", "Sales2"}; len(names) != len(exp) || names[3] != exp[3] {
+		t.Errorf("expected columns %v, got %v", exp, names)
+	}
+	expectString(t, sheet.Cell("D1"), "Sales2")
+	if _, err := sheet.AddTable("C3:E8"); err == nil {
+		t.Errorf("expected an error for an overlapping table")
+	}
+
+	c, err := tbl.Column("Sales2")
+	if err != nil {
+		t.Fatalf("error finding column: %s", err)
+	}
+	c.SetCalculatedColumnFormula("C2*2")
+	expectFormula(t, sheet.Cell("D2"), "C2*2")
+	expectFormula(t, sheet.Cell("D6"), "C6*2")
+
+	tbl.SetShowTotalsRow(true)
+	sales, _ := tbl.Column("Sales")
+	sales.SetTotalsRowFunction(sml.ST_TotalsRowFunctionSum)
+	region, _ := tbl.Column("Region")
+	region.SetTotalsRowLabel("Total")
+	if tbl.Reference() != "A1:D7" {
+		t.Errorf("expected table A1:D7, got %s", tbl.Reference())
+	}
+	if got := *tbl.X().AutoFilter.RefAttr; got != "A1:D6" {
+		t.Errorf("expected auto filter A1:D6, got %s", got)
+	}
+	expectString(t, sheet.Cell("A7"), "Total")
+	expectFormula(t, sheet.Cell("C7"), "SUBTOTAL(109,Table1[Sales])")
+
+	if err := tbl.Resize("A1:E9"); err != nil {
+		t.Fatalf("error resizing table: %s", err)
+	}
+	if tbl.Reference() != "A1:E9" {
+		t.Errorf("expected table A1:E9, got %s", tbl.Reference())
+	}
+	expectString(t, sheet.Cell("A7"), "")
+	expectString(t, sheet.Cell("A9"), "Total")
+	expectFormula(t, sheet.Cell("C9"), "SUBTOTAL(109,Table1[Sales])")
+	expectFormula(t, sheet.Cell("D8"), "C8*2")
+	expectString(t, sheet.Cell("E1"), "Column1")
+	if err := tbl.Resize("B1:E9"); err == nil {
+		t.Errorf("expected an error moving the table")
+	}
+
+	tbl2, err := sheet.AddTable("G1:H3")
+	if err != nil {
+		t.Fatalf("error adding table: %s", err)
+	}
+	if tbl2.Name() != "Table2" {
+		t.Errorf("expected Table2, got %s", tbl2.Name())
+	}
+	if err := tbl2.SetName("table1"); err == nil {
+		t.Errorf("expected an error for a duplicate table name")
+	}
+	sheet.Cell("J1").SetFormulaRaw(`SUM(Table2[[#This Row],[Qty]])+ROWS(table2)+Table20&"Table2"`)
+	if err := tbl2.SetName("Totals"); err != nil {
+		t.Fatalf("error renaming table: %s", err)
+	}
+	expectFormula(t, sheet.Cell("J1"), `SUM(Totals[[#This Row],[Qty]])+ROWS(Totals)+Table20&"Table2"`)
+
+	buf := bytes.Buffer{}
+	if err := wb.Save(&buf); err != nil {
+		t.Fatalf("error saving: %s", err)
+	}
+	wb2, err := spreadsheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading: %s", err)
+	}
+	defer wb2.Close()
+	s2 := wb2.Sheets()[0]
+	tables := s2.Tables()
+	if len(tables) != 2 {
+		t.Fatalf("expected 2 tables, got %d", len(tables))
+	}
+	if err := s2.RemoveTable(tables[0]); err != nil {
+		t.Fatalf("error removing table: %s", err)
+	}
+	if got := len(s2.X().TableParts.TablePart); got != 1 {
+		t.Errorf("expected 1 table part, got %d", got)
+	}
+
+	buf.Reset()
+	if err := wb2.Save(&buf); err != nil {
+		t.Fatalf("error saving: %s", err)
+	}
+	wb3, err := spreadsheet.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("error reading: %s", err)
+	}
+	defer wb3.Close()
+	tables = wb3.Sheets()[0].Tables()
+	if len(tables) != 1 || tables[0].Name() != "Totals" || tables[0].Reference() != "G1:H3" {
+		t.Errorf("expected only Totals to remain, got %v", tables)
+	}
+	for _, o := range wb3.ContentTypes.X().Override {
+		if o.PartNameAttr == "/xl/tables/table2.xml" {
+			t.Errorf("expected the content type of the removed table to be removed")
+		}
+	}
+}
@@ -9,17 +9,20 @@ package spreadsheet
 
 import (
 	"archive/zip"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"io"
 	"os"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/unidoc/unioffice"
 	"github.com/unidoc/unioffice/common"
+	"github.com/unidoc/unioffice/spreadsheet/formula"
 	"github.com/unidoc/unioffice/vmldrawing"
 	"github.com/unidoc/unioffice/zippkg"
 
@@ -51,6 +54,16 @@ type Workbook struct {
 	vmlDrawings []*vmldrawing.Container
 	charts      []*crt.ChartSpace
 	tables      []*sml.Table
+	calc        *calcEngine
+
+	pivotTables    []*sml.PivotTableDefinition
+	pivotTableRels []common.Relationships
+	pivotCaches    []*sml.PivotCacheDefinition
+	pivotCacheRels []common.Relationships
+	pivotRecords   []*sml.PivotCacheRecords
+
+	// metadata holds the cell metadata that marks dynamic array formulas
+	metadata *sml.Metadata
 }
 
 // X returns the inner wrapped XML type.
@@ -135,6 +148,24 @@ func (wb *Workbook) RemoveSheet(ind int) error {
 	copy(wb.comments[ind:], wb.comments[ind+1:])
 	wb.comments = wb.comments[:len(wb.comments)-1]
 
+	// remove the names local to the sheet, such as its print area, and
+	// renumber those of the sheets after it
+	if wb.x.DefinedNames != nil {
+		names := wb.x.DefinedNames.DefinedName[:0]
+		for _, dn := range wb.x.DefinedNames.DefinedName {
+			if dn.LocalSheetIdAttr != nil {
+				if *dn.LocalSheetIdAttr == uint32(ind) {
+					continue
+				}
+				if *dn.LocalSheetIdAttr > uint32(ind) {
+					*dn.LocalSheetIdAttr--
+				}
+			}
+			names = append(names, dn)
+		}
+		wb.x.DefinedNames.DefinedName = names
+	}
+
 	return nil
 }
 
@@ -248,7 +279,7 @@ func (wb *Workbook) Uses1904Dates() bool {
 // Epoch returns the point at which the dates/times in the workbook are relative to.
 func (wb *Workbook) Epoch() time.Time {
 	if wb.Uses1904Dates() {
-		time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+		return time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
 	}
 	return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
 }
@@ -257,6 +288,15 @@ func (wb *Workbook) Epoch() time.Time {
 func (wb *Workbook) Save(w io.Writer) error {
 	z := zip.NewWriter(w)
 	defer z.Close()
+	if err := wb.save(z, false); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// save writes the workbook parts to a zip file.  If sheetsWritten is true, the
+// worksheets themselves have already been written by a StreamWriter.
+func (wb *Workbook) save(z *zip.Writer, sheetsWritten bool) error {
 	dt := unioffice.DocTypeSpreadsheet
 
 	if err := zippkg.MarshalXML(z, unioffice.BaseRelsFilename, wb.Rels.X()); err != nil {
@@ -287,11 +327,12 @@ func (wb *Workbook) Save(w io.Writer) error {
 		}
 	}
 	for i, sheet := range wb.xws {
-		// recalculate sheet dimensions
-		sheet.Dimension.RefAttr = Sheet{wb, nil, sheet}.Extents()
-
 		fn := unioffice.AbsoluteFilename(dt, unioffice.WorksheetType, i+1)
-		zippkg.MarshalXML(z, fn, sheet)
+		if !sheetsWritten {
+			// recalculate sheet dimensions
+			sheet.Dimension.RefAttr = Sheet{wb, nil, sheet}.Extents()
+			zippkg.MarshalXML(z, fn, sheet)
+		}
 		zippkg.MarshalXML(z, zippkg.RelationsPathFor(fn), wb.xwsRels[i].X())
 	}
 	if err := zippkg.MarshalXMLByType(z, dt, unioffice.SharedStingsType, wb.SharedStrings.X()); err != nil {
@@ -316,6 +357,26 @@ func (wb *Workbook) Save(w io.Writer) error {
 		fn := unioffice.AbsoluteFilename(dt, unioffice.TableType, i+1)
 		zippkg.MarshalXML(z, fn, tbl)
 	}
+	for i, pt := range wb.pivotTables {
+		fn := unioffice.AbsoluteFilename(dt, unioffice.PivotTableType, i+1)
+		zippkg.MarshalXML(z, fn, pt)
+		if !wb.pivotTableRels[i].IsEmpty() {
+			zippkg.MarshalXML(z, zippkg.RelationsPathFor(fn), wb.pivotTableRels[i].X())
+		}
+	}
+	for i, pc := range wb.pivotCaches {
+		fn := unioffice.AbsoluteFilename(dt, unioffice.PivotCacheDefinitionType, i+1)
+		zippkg.MarshalXML(z, fn, pc)
+		if !wb.pivotCacheRels[i].IsEmpty() {
+			zippkg.MarshalXML(z, zippkg.RelationsPathFor(fn), wb.pivotCacheRels[i].X())
+		}
+		if wb.pivotRecords[i] != nil {
+			zippkg.MarshalXML(z, unioffice.AbsoluteFilename(dt, unioffice.PivotCacheRecordsType, i+1), wb.pivotRecords[i])
+		}
+	}
+	if wb.metadata != nil {
+		zippkg.MarshalXMLByType(z, dt, unioffice.SheetMetadataType, wb.metadata)
+	}
 	for i, drawing := range wb.drawings {
 		fn := unioffice.AbsoluteFilename(dt, unioffice.DrawingType, i+1)
 		zippkg.MarshalXML(z, fn, drawing)
@@ -349,10 +410,7 @@ func (wb *Workbook) Save(w io.Writer) error {
 		zippkg.MarshalXML(z, unioffice.AbsoluteFilename(dt, unioffice.CommentsType, i+1), cmt)
 	}
 
-	if err := wb.WriteExtraFiles(z); err != nil {
-		return err
-	}
-	return z.Close()
+	return wb.WriteExtraFiles(z)
 }
 
 // Validate attempts to validate the structure of a workbook.
@@ -536,6 +594,44 @@ func (wb *Workbook) onNewRelationship(decMap *zippkg.DecodeMap, target, typ stri
 		decMap.AddTarget(target, tbl, typ, idx)
 		wb.tables = append(wb.tables, tbl)
 		rel.TargetAttr = unioffice.RelativeFilename(dt, src.Typ, typ, len(wb.tables))
+
+	case unioffice.PivotTableType:
+		pt := sml.NewPivotTableDefinition()
+		idx := uint32(len(wb.pivotTables))
+		decMap.AddTarget(target, pt, typ, idx)
+		wb.pivotTables = append(wb.pivotTables, pt)
+
+		ptRels := common.NewRelationships()
+		decMap.AddTarget(zippkg.RelationsPathFor(target), ptRels.X(), typ, idx)
+		wb.pivotTableRels = append(wb.pivotTableRels, ptRels)
+		rel.TargetAttr = unioffice.RelativeFilename(dt, src.Typ, typ, len(wb.pivotTables))
+
+	case unioffice.PivotCacheDefinitionType:
+		// the cache is referenced by both the workbook and its pivot tables
+		pc := sml.NewPivotCacheDefinition()
+		idx := len(wb.pivotCaches)
+		if decMap.AddTarget(target, pc, typ, uint32(idx)) {
+			decMap.RecordIndex(path.Clean(target), idx)
+			wb.pivotCaches = append(wb.pivotCaches, pc)
+			pcRels := common.NewRelationships()
+			decMap.AddTarget(zippkg.RelationsPathFor(target), pcRels.X(), typ, uint32(idx))
+			wb.pivotCacheRels = append(wb.pivotCacheRels, pcRels)
+			wb.pivotRecords = append(wb.pivotRecords, nil)
+		} else {
+			idx = decMap.IndexFor(path.Clean(target))
+		}
+		rel.TargetAttr = unioffice.RelativeFilename(dt, src.Typ, typ, idx+1)
+
+	case unioffice.PivotCacheRecordsType:
+		records := sml.NewPivotCacheRecords()
+		decMap.AddTarget(target, records, typ, src.Index)
+		wb.pivotRecords[src.Index] = records
+		rel.TargetAttr = unioffice.RelativeFilename(dt, src.Typ, typ, int(src.Index)+1)
+
+	case unioffice.SheetMetadataType:
+		wb.metadata = sml.NewMetadata()
+		decMap.AddTarget(target, wb.metadata, typ, 0)
+		rel.TargetAttr = unioffice.RelativeFilename(dt, src.Typ, typ, 0)
 	default:
 		unioffice.Log("unsupported relationship %s %s", target, typ)
 	}
@@ -605,14 +701,53 @@ func (wb *Workbook) ClearCachedFormulaResults() {
 }
 
 // RecalculateFormulas re-computes any computed formula values that are stored
-// in the sheet. As gooxml formula support is still new and not all functins are
-// supported,  if formula execution fails either due to a parse error or missing
-// function, or erorr in the result (even if expected) the cached value will be
-// left empty allowing Excel to recompute it on load.
+// in the sheet. As gooxml formula support is still new and not all functions
+// are supported, formulas that can't be parsed or call a missing function
+// store an error value, as do formulas whose result is an error.  The cached
+// value is left empty only for circular references that aren't calculated
+// iteratively, allowing Excel to compute them on load.
+//
+// Each formula is parsed once and evaluated after the cells it references, and
+// the references are recorded so that RecalculateDirty can later recompute
+// only the formulas affected by changed cells.  If the workbook enables
+// iterative calculation, circular references are evaluated repeatedly using
+// the iteration count and maximum change from the calculation properties.
+//
+// Formulas are evaluated with a new evaluator that calls the globally
+// registered functions.
 func (wb *Workbook) RecalculateFormulas() {
-	for _, s := range wb.Sheets() {
-		s.RecalculateFormulas()
+	wb.calcEngine().recalculate(nil, nil)
+}
+
+// RecalculateFormulasWith re-computes formula values like RecalculateFormulas,
+// but evaluates formulas with an evaluator such as one constructed with
+// formula.NewEvaluatorWithRegistry to provide custom functions.
+func (wb *Workbook) RecalculateFormulasWith(ev formula.Evaluator) {
+	wb.calcEngine().recalculate(nil, ev)
+}
+
+// RecalculateDirty re-computes only the formulas that depend on cells that
+// have been modified since the last call to RecalculateFormulas or
+// RecalculateDirty, along with formulas that call volatile functions such as
+// NOW().  If formulas have not been calculated yet, all formulas are
+// calculated.  The evaluator last passed to RecalculateFormulasWith, if
+// any, is reused.
+func (wb *Workbook) RecalculateDirty() {
+	wb.calcEngine().recalculateDirty()
+}
+
+// CircularReferences returns the cells, in the form "Sheet1!A1" or
+// "'Sheet 1'!A1", that were part of a circular reference during the last
+// recalculation.
+func (wb *Workbook) CircularReferences() []string {
+	return wb.calcEngine().circularReferences()
+}
+
+func (wb *Workbook) calcEngine() *calcEngine {
+	if wb.calc == nil {
+		wb.calc = newCalcEngine(wb)
 	}
+	return wb.calc
 }
 
 // AddImage adds an image to the workbook package, returning a reference that
@@ -666,7 +801,7 @@ func (wb *Workbook) Tables() []Table {
 	}
 	ret := []Table{}
 	for _, t := range wb.tables {
-		ret = append(ret, Table{t})
+		ret = append(ret, Table{wb, t})
 	}
 	return ret
 }
@@ -732,3 +867,99 @@ func (wb *Workbook) RemoveCalcChain() {
 		}
 	}
 }
+
+// dynamicArrayURI identifies the cell metadata extension that marks formulas
+// as dynamic array formulas.
+const dynamicArrayURI = "{bdbb8cdc-fa1e-496e-a857-3c3f30c029c3}"
+
+// dynamicArrayMetadata returns the index of the cell metadata that marks a
+// formula as a dynamic array formula, adding the metadata to the workbook if
+// necessary.
+func (wb *Workbook) dynamicArrayMetadata() uint32 {
+	dt := unioffice.DocTypeSpreadsheet
+	if wb.metadata == nil {
+		wb.metadata = sml.NewMetadata()
+		wb.ContentTypes.AddOverride(unioffice.AbsoluteFilename(dt, unioffice.SheetMetadataType, 0), unioffice.SheetMetadataContentType)
+		wb.wbRels.AddRelationship(unioffice.RelativeFilename(dt, unioffice.OfficeDocumentType, unioffice.SheetMetadataType, 0), unioffice.SheetMetadataType)
+	}
+	md := wb.metadata
+
+	// the metadata type, whose data is stored as future metadata
+	if md.MetadataTypes == nil {
+		md.MetadataTypes = sml.NewCT_MetadataTypes()
+	}
+	typeIdx := -1
+	for i, mt := range md.MetadataTypes.MetadataType {
+		if mt.NameAttr == "XLDAPR" {
+			typeIdx = i
+		}
+	}
+	if typeIdx == -1 {
+		mt := sml.NewCT_MetadataType()
+		mt.NameAttr = "XLDAPR"
+		mt.MinSupportedVersionAttr = 120000
+		t := unioffice.Bool(true)
+		mt.CopyAttr, mt.PasteAllAttr, mt.PasteValuesAttr, mt.MergeAttr = t, t, t, t
+		mt.SplitFirstAttr, mt.RowColShiftAttr, mt.ClearFormatsAttr = t, t, t
+		mt.ClearCommentsAttr, mt.AssignAttr, mt.CoerceAttr, mt.CellMetaAttr = t, t, t, t
+		md.MetadataTypes.MetadataType = append(md.MetadataTypes.MetadataType, mt)
+		md.MetadataTypes.CountAttr = unioffice.Uint32(uint32(len(md.MetadataTypes.MetadataType)))
+		typeIdx = len(md.MetadataTypes.MetadataType) - 1
+	}
+
+	// the dynamic array properties
+	var fm *sml.CT_FutureMetadata
+	for _, f := range md.FutureMetadata {
+		if f.NameAttr == "XLDAPR" {
+			fm = f
+		}
+	}
+	if fm == nil {
+		fm = sml.NewCT_FutureMetadata()
+		fm.NameAttr = "XLDAPR"
+		md.FutureMetadata = append(md.FutureMetadata, fm)
+	}
+	blockIdx := -1
+	for i, bk := range fm.Bk {
+		if bk.ExtLst != nil && len(bk.ExtLst.Ext) > 0 && bk.ExtLst.Ext[0].UriAttr != nil &&
+			*bk.ExtLst.Ext[0].UriAttr == dynamicArrayURI {
+			blockIdx = i
+			break
+		}
+	}
+	if blockIdx == -1 {
+		ext := sml.NewCT_Extension()
+		ext.UriAttr = unioffice.String(dynamicArrayURI)
+		ext.Any = &unioffice.XSDAny{
+			XMLName: xml.Name{Space: "http://schemas.microsoft.com/office/spreadsheetml/2017/dynamicarray", Local: "dynamicArrayProperties"},
+			Attrs: []xml.Attr{
+				{Name: xml.Name{Local: "fDynamic"}, Value: "1"},
+				{Name: xml.Name{Local: "fCollapsed"}, Value: "0"},
+			},
+		}
+		bk := sml.NewCT_FutureMetadataBlock()
+		bk.ExtLst = sml.NewCT_ExtensionList()
+		bk.ExtLst.Ext = append(bk.ExtLst.Ext, ext)
+		fm.Bk = append(fm.Bk, bk)
+		fm.CountAttr = unioffice.Uint32(uint32(len(fm.Bk)))
+		blockIdx = len(fm.Bk) - 1
+	}
+
+	// the cell metadata referring to the properties
+	if md.CellMetadata == nil {
+		md.CellMetadata = sml.NewCT_MetadataBlocks()
+	}
+	for i, bk := range md.CellMetadata.Bk {
+		if len(bk.Rc) == 1 && bk.Rc[0].TAttr == uint32(typeIdx+1) && bk.Rc[0].VAttr == uint32(blockIdx) {
+			return uint32(i + 1)
+		}
+	}
+	rc := sml.NewCT_MetadataRecord()
+	rc.TAttr = uint32(typeIdx + 1)
+	rc.VAttr = uint32(blockIdx)
+	bk := sml.NewCT_MetadataBlock()
+	bk.Rc = append(bk.Rc, rc)
+	md.CellMetadata.Bk = append(md.CellMetadata.Bk, bk)
+	md.CellMetadata.CountAttr = unioffice.Uint32(uint32(len(md.CellMetadata.Bk)))
+	return uint32(len(md.CellMetadata.Bk))
+}
@@ -39,7 +39,10 @@ var wellKnownSchemas = map[string]string{
 	"wpi":     "http://schemas.microsoft.com/office/word/2010/wordprocessingInk",
 	"wps":     "http://schemas.microsoft.com/office/word/2010/wordprocessingShape",
 	"xsi":     "http://www.w3.org/2001/XMLSchema-instance",
+	"x14":     "http://schemas.microsoft.com/office/spreadsheetml/2009/9/main",
 	"x15ac":   "http://schemas.microsoft.com/office/spreadsheetml/2010/11/ac",
+	"xm":      "http://schemas.microsoft.com/office/excel/2006/main",
+	"xda":     "http://schemas.microsoft.com/office/spreadsheetml/2017/dynamicarray",
 }
 
 var wellKnownSchemasInv = func() map[string]string {